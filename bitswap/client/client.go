@@ -5,6 +5,7 @@ package client
 import (
 	"context"
 	"errors"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	bssim "github.com/ipfs/boxo/bitswap/client/internal/sessioninterestmanager"
 	bssm "github.com/ipfs/boxo/bitswap/client/internal/sessionmanager"
 	bsspm "github.com/ipfs/boxo/bitswap/client/internal/sessionpeermanager"
+	bswp "github.com/ipfs/boxo/bitswap/client/internal/wantpersister"
 	"github.com/ipfs/boxo/bitswap/internal"
 	"github.com/ipfs/boxo/bitswap/internal/defaults"
 	bsmsg "github.com/ipfs/boxo/bitswap/message"
@@ -28,6 +30,7 @@ import (
 	rpqm "github.com/ipfs/boxo/routing/providerquerymanager"
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	delay "github.com/ipfs/go-ipfs-delay"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/go-metrics-interface"
@@ -53,6 +56,31 @@ func ProviderSearchDelay(newProvSearchDelay time.Duration) Option {
 	}
 }
 
+// ProviderSearchAfterBroadcasts sets after how many consecutive broadcasts of
+// the wantlist, made while a session receives no blocks, the session searches
+// for providers of its first want. Sessions broadcast their wantlist when they
+// do not receive blocks for a while, or when all their peers sent DONT_HAVE.
+// Less than one disables these searches, leaving only the periodic search of
+// [RebroadcastDelay] and the one of [ProviderSearchAfterIdle]. The default is
+// one: the first broadcast triggers a search.
+func ProviderSearchAfterBroadcasts(n int) Option {
+	return func(bs *Client) {
+		if n < 1 {
+			n = -1
+		}
+		bs.providerSearchPolicy.AfterBroadcasts = n
+	}
+}
+
+// ProviderSearchAfterIdle makes sessions search for providers of one of their
+// wants whenever they receive no block for the given duration, regardless of
+// their broadcasts. Zero, the default, disables these searches.
+func ProviderSearchAfterIdle(d time.Duration) Option {
+	return func(bs *Client) {
+		bs.providerSearchPolicy.AfterIdle = d
+	}
+}
+
 // RebroadcastDelay sets a custom delay for periodic search of a random want.
 // When the value ellapses, a random CID from the wantlist is chosen and the
 // client attempts to find more peers for it and sends them the single want.
@@ -90,6 +118,16 @@ func WithBlockReceivedNotifier(brn BlockReceivedNotifier) Option {
 	}
 }
 
+// WithBlockVerifier configures the Client to drop the blocks rejected by v as
+// they are received. A rejected block is handled as a DONT_HAVE from the peer
+// that sent it, which is not credited for it with the
+// [BlockReceivedNotifier].
+func WithBlockVerifier(v BlockVerifier) Option {
+	return func(bs *Client) {
+		bs.blockVerifier = v
+	}
+}
+
 // WithoutDuplicatedBlockStats disable collecting counts of duplicated blocks
 // received. This counter requires triggering a blockstore.Has() call for
 // every block received by launching goroutines in parallel. In the worst case
@@ -122,6 +160,36 @@ func WithDefaultProviderQueryManager(defaultProviderQueryManager bool) Option {
 	}
 }
 
+// WithWantlistPersistence persists the CIDs wanted by the client in the given
+// datastore, under the /bitswap/wantlist namespace. Wants that are still
+// outstanding when the client is closed, or when the process exits, are
+// resumed the next time a client is created with the same datastore: they are
+// fetched in the background and written to the blockstore, so that re-issued
+// requests, such as an interrupted pin, can complete from local storage.
+//
+// Wants are removed from the datastore once their block is received, or when
+// the request that wanted them is cancelled.
+func WithWantlistPersistence(ds datastore.Batching) Option {
+	return func(bs *Client) {
+		bs.wantPersister = bswp.New(ds)
+	}
+}
+
+// WithDuplicateWantSuppression makes the sessions wanting a block that
+// another session is already requesting wait for it, rather than requesting
+// it from other peers and receiving duplicates, for instance when concurrent
+// gateway requests need the same popular blocks. The block is delivered to
+// every session wanting it, and a session requests it itself if the other
+// one gives up or does not get it within claimTimeout. The number of
+// want-blocks avoided is reported by the duplicate_want_blocks_avoided_total
+// metric. Zero, the default, disables the suppression. See
+// [defaults.DuplicateWantClaimTimeout] for a suggested timeout.
+func WithDuplicateWantSuppression(claimTimeout time.Duration) Option {
+	return func(bs *Client) {
+		bs.duplicateWantClaimTimeout = claimTimeout
+	}
+}
+
 type BlockReceivedNotifier interface {
 	// ReceivedBlocks notifies the decision engine that a peer is well-behaving
 	// and gave us useful data, potentially increasing its score and making us
@@ -129,6 +197,15 @@ type BlockReceivedNotifier interface {
 	ReceivedBlocks(peer.ID, []blocks.Block)
 }
 
+// BlockVerifier checks the blocks received from peers, such as a
+// [blockservice.VerificationPolicy].
+//
+// [blockservice.VerificationPolicy]: https://pkg.go.dev/github.com/ipfs/boxo/blockservice#VerificationPolicy
+type BlockVerifier interface {
+	// VerifyBlock returns the reason why b must be rejected, or nil.
+	VerifyBlock(b blocks.Block) error
+}
+
 // ProviderFinder is a subset of
 // https://pkg.go.dev/github.com/libp2p/go-libp2p@v0.37.0/core/routing#ContentRouting
 type ProviderFinder interface {
@@ -149,6 +226,7 @@ func New(parent context.Context, network bsnet.BitSwapNetwork, providerFinder Pr
 	ctx, cancelFunc := context.WithCancel(parent)
 
 	bs := &Client{
+		ctx:                         ctx,
 		network:                     network,
 		providerFinder:              providerFinder,
 		blockstore:                  bstore,
@@ -191,7 +269,11 @@ func New(parent context.Context, network bsnet.BitSwapNetwork, providerFinder Pr
 
 	sim := bssim.New()
 	bpm := bsbpm.New()
-	pm := bspm.New(ctx, peerQueueFactory, network.Self())
+	var pmOpts []bspm.Option
+	if bs.duplicateWantClaimTimeout > 0 {
+		pmOpts = append(pmOpts, bspm.WithDuplicateWantSuppression(bs.duplicateWantClaimTimeout))
+	}
+	pm := bspm.New(ctx, peerQueueFactory, network.Self(), pmOpts...)
 
 	if bs.providerFinder != nil && bs.defaultProviderQueryManager {
 		// network can do dialing.
@@ -229,7 +311,7 @@ func New(parent context.Context, network bsnet.BitSwapNetwork, providerFinder Pr
 		} else if providerFinder != nil {
 			sessionProvFinder = providerFinder
 		}
-		return bssession.New(sessctx, sessmgr, id, spm, sessionProvFinder, sim, pm, bpm, notif, provSearchDelay, rebroadcastDelay, self)
+		return bssession.New(sessctx, sessmgr, id, spm, sessionProvFinder, sim, pm, bpm, notif, provSearchDelay, rebroadcastDelay, bs.providerSearchPolicy, self)
 	}
 	sessionPeerManagerFactory := func(ctx context.Context, id uint64) bssession.SessionPeerManager {
 		return bsspm.New(id, network.ConnectionManager())
@@ -242,6 +324,18 @@ func New(parent context.Context, network bsnet.BitSwapNetwork, providerFinder Pr
 	bs.pm = pm
 	bs.sim = sim
 
+	if bs.wantPersister != nil {
+		// The wants are loaded before the client is returned, so that only
+		// the wants of the previous run are resumed, not the ones of the
+		// requests made meanwhile.
+		keys, err := bs.wantPersister.Load(ctx)
+		if err != nil {
+			log.Warnf("failed to load persisted wants: %s", err)
+		} else if len(keys) != 0 {
+			go bs.resumeWants(ctx, keys)
+		}
+	}
+
 	return bs
 }
 
@@ -265,6 +359,7 @@ type Client struct {
 	// manages channels of outgoing blocks for sessions
 	notif notifications.PubSub
 
+	ctx       context.Context
 	cancel    context.CancelFunc
 	closing   chan struct{}
 	closeOnce sync.Once
@@ -293,14 +388,27 @@ type Client struct {
 	// how often to rebroadcast providing requests to find more optimized providers
 	rebroadcastDelay delay.D
 
+	// when else sessions search for providers
+	providerSearchPolicy bssession.ProviderSearchPolicy
+
 	blockReceivedNotifier BlockReceivedNotifier
 
+	// rejects received blocks, nil if disabled
+	blockVerifier BlockVerifier
+
 	// whether we should actually simulate dont haves on request timeout
 	simulateDontHavesOnTimeout bool
 	dontHaveTimeoutConfig      *bsmq.DontHaveTimeoutConfig
 
 	// dupMetric will stay at 0
 	skipDuplicatedBlocksStats bool
+
+	// persists outstanding wants across restarts, nil if disabled
+	wantPersister *bswp.WantPersister
+
+	// how long sessions wait for the blocks requested by other sessions, 0
+	// if they do not
+	duplicateWantClaimTimeout time.Duration
 }
 
 type counters struct {
@@ -323,7 +431,9 @@ func (bs *Client) GetBlock(ctx context.Context, k cid.Cid) (blocks.Block, error)
 // GetBlocks returns a channel where the caller may receive blocks that
 // correspond to the provided |keys|. Returns an error if BitSwap is unable to
 // begin this request within the deadline enforced by the context.
-// It returns a [github.com/ipfs/boxo/bitswap/client/traceability.Block] assertable [blocks.Block].
+// It returns a [github.com/ipfs/boxo/bitswap/client/traceability.Block] assertable [blocks.Block],
+// except for the blocks inlined in their CID with an identity multihash, which
+// are returned without being requested from the network.
 //
 // NB: Your request remains open until the context expires. To conserve
 // resources, provide a context with a reasonably short deadline (ie. not one
@@ -331,8 +441,55 @@ func (bs *Client) GetBlock(ctx context.Context, k cid.Cid) (blocks.Block, error)
 func (bs *Client) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
 	ctx, span := internal.StartSpan(ctx, "GetBlocks", trace.WithAttributes(attribute.Int("NumKeys", len(keys))))
 	defer span.End()
+
+	var idBlocks []blocks.Block
+	if slices.ContainsFunc(keys, blockstore.IsIdentity) {
+		wanted := make([]cid.Cid, 0, len(keys))
+		for _, k := range keys {
+			if blk, ok := blockstore.IdentityBlock(k); ok {
+				idBlocks = append(idBlocks, blk)
+			} else {
+				wanted = append(wanted, k)
+			}
+		}
+		keys = wanted
+	}
+
 	session := bs.sm.NewSession(ctx, bs.provSearchDelay, bs.rebroadcastDelay)
-	return session.GetBlocks(ctx, keys)
+	var out <-chan blocks.Block
+	var err error
+	if bs.wantPersister != nil {
+		out, err = bs.persistWants(ctx, keys, session.GetBlocks)
+	} else {
+		out, err = session.GetBlocks(ctx, keys)
+	}
+	if err != nil || len(idBlocks) == 0 {
+		return out, err
+	}
+	return prependBlocks(ctx, idBlocks, out), nil
+}
+
+// prependBlocks returns a channel of blks followed by the blocks of in.
+func prependBlocks(ctx context.Context, blks []blocks.Block, in <-chan blocks.Block) <-chan blocks.Block {
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		for _, blk := range blks {
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for blk := range in {
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
 }
 
 // NotifyNewBlocks announces the existence of blocks to this bitswap service.
@@ -434,6 +591,9 @@ func (bs *Client) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg.
 
 	haves := incoming.Haves()
 	dontHaves := incoming.DontHaves()
+	if bs.blockVerifier != nil && len(iblocks) > 0 {
+		iblocks, dontHaves = bs.verifyBlocks(p, iblocks, dontHaves)
+	}
 	if len(iblocks) > 0 || len(haves) > 0 || len(dontHaves) > 0 {
 		// Process blocks
 		err := bs.receiveBlocksFrom(ctx, p, iblocks, haves, dontHaves)
@@ -444,6 +604,21 @@ func (bs *Client) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg.
 	}
 }
 
+// verifyBlocks drops the blocks rejected by the block verifier and adds them
+// to the DONT_HAVEs of the peer.
+func (bs *Client) verifyBlocks(p peer.ID, blks []blocks.Block, dontHaves []cid.Cid) ([]blocks.Block, []cid.Cid) {
+	verified := make([]blocks.Block, 0, len(blks))
+	for _, b := range blks {
+		if err := bs.blockVerifier.VerifyBlock(b); err != nil {
+			log.Warnw("[recv] block rejected", "cid", b.Cid(), "peer", p, "error", err)
+			dontHaves = append(dontHaves, b.Cid())
+			continue
+		}
+		verified = append(verified, b)
+	}
+	return verified, dontHaves
+}
+
 func (bs *Client) updateReceiveCounters(blocks []blocks.Block) {
 	// Check which blocks are in the datastore
 	// (Note: any errors from the blockstore are simply logged out in
@@ -564,5 +739,9 @@ func (bs *Client) IsOnline() bool {
 func (bs *Client) NewSession(ctx context.Context) exchange.Fetcher {
 	ctx, span := internal.StartSpan(ctx, "NewSession")
 	defer span.End()
-	return bs.sm.NewSession(ctx, bs.provSearchDelay, bs.rebroadcastDelay)
+	session := bs.sm.NewSession(ctx, bs.provSearchDelay, bs.rebroadcastDelay)
+	if bs.wantPersister != nil {
+		return &persistedSession{Fetcher: session, bs: bs}
+	}
+	return session
 }
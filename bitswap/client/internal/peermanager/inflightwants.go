@@ -0,0 +1,153 @@
+package peermanager
+
+import (
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-metrics-interface"
+)
+
+// wantClaim is the claim of a session on the want-blocks of a CID.
+type wantClaim struct {
+	ses   uint64
+	since time.Time
+}
+
+// wantWaiter is a session waiting for the claim of another session on a CID.
+type wantWaiter struct {
+	wake func()
+	// timer wakes the session up once the claim times out, at until.
+	timer *time.Timer
+	until time.Time
+}
+
+func (w *wantWaiter) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// inflightWants keeps track of the session that sends the want-blocks for
+// each CID, so that the other sessions wanting the same CID wait for its block
+// rather than requesting it from other peers and receiving duplicates. The
+// block is delivered to every session interested in it. A claim older than
+// the timeout is taken over by the next session claiming the CID, as the
+// want-block of its owner may never be answered.
+type inflightWants struct {
+	// owners maps CIDs to the session sending their want-blocks.
+	owners map[cid.Cid]wantClaim
+	// waiters maps CIDs to the sessions waiting for them to be released by
+	// their owner.
+	waiters map[cid.Cid]map[uint64]*wantWaiter
+
+	// Counts the want-blocks not sent because another session was sending
+	// them.
+	avoided metrics.Counter
+
+	timeout time.Duration
+}
+
+func newInflightWants(avoided metrics.Counter, timeout time.Duration) *inflightWants {
+	return &inflightWants{
+		owners:  make(map[cid.Cid]wantClaim),
+		waiters: make(map[cid.Cid]map[uint64]*wantWaiter),
+		avoided: avoided,
+		timeout: timeout,
+	}
+}
+
+// claim returns the CIDs for which the session can send want-blocks, as no
+// other session does, or as the claim of the other session timed out. The
+// session waits for the others until they are released or time out, and wake
+// is then called.
+func (iw *inflightWants) claim(ses uint64, ks []cid.Cid, wake func()) []cid.Cid {
+	now := time.Now()
+	claimed := make([]cid.Cid, 0, len(ks))
+	for _, c := range ks {
+		owner, ok := iw.owners[c]
+		expired := ok && now.Sub(owner.since) >= iw.timeout
+		if !ok || owner.ses == ses || expired {
+			if expired && owner.ses != ses {
+				log.Debugw("taking over timed out want-block claim", "cid", c, "session", ses, "owner", owner.ses)
+			}
+			iw.owners[c] = wantClaim{ses: ses, since: now}
+			iw.removeWaiter(c, ses)
+			claimed = append(claimed, c)
+			continue
+		}
+
+		waiters, ok := iw.waiters[c]
+		if !ok {
+			waiters = make(map[uint64]*wantWaiter)
+			iw.waiters[c] = waiters
+		}
+		w, ok := waiters[ses]
+		if !ok {
+			iw.avoided.Inc()
+			w = &wantWaiter{}
+			waiters[ses] = w
+		}
+		w.wake = wake
+		// Claim again once the claim of the owner times out. The claim may
+		// have been taken over since the session started waiting.
+		until := owner.since.Add(iw.timeout)
+		if wake != nil && (w.timer == nil || !w.until.Equal(until)) {
+			w.stop()
+			w.timer = time.AfterFunc(until.Sub(now), wake)
+			w.until = until
+		}
+	}
+	return claimed
+}
+
+// release gives up the claims of the session on ks, and stops it waiting for
+// them. It returns the functions waking up the sessions waiting for the
+// released CIDs, which stop waiting, so that they claim them again.
+func (iw *inflightWants) release(ses uint64, ks []cid.Cid) []func() {
+	var wakes []func()
+	for _, c := range ks {
+		iw.removeWaiter(c, ses)
+		if owner, ok := iw.owners[c]; !ok || owner.ses != ses {
+			continue
+		}
+		delete(iw.owners, c)
+		for _, w := range iw.waiters[c] {
+			w.stop()
+			if w.wake != nil {
+				wakes = append(wakes, w.wake)
+			}
+		}
+		delete(iw.waiters, c)
+	}
+	return wakes
+}
+
+// releaseSession releases all the claims of the session.
+func (iw *inflightWants) releaseSession(ses uint64) []func() {
+	var ks []cid.Cid
+	for c, owner := range iw.owners {
+		if owner.ses == ses {
+			ks = append(ks, c)
+		}
+	}
+	for c, waiters := range iw.waiters {
+		if _, ok := waiters[ses]; ok {
+			ks = append(ks, c)
+		}
+	}
+	return iw.release(ses, ks)
+}
+
+func (iw *inflightWants) removeWaiter(c cid.Cid, ses uint64) {
+	waiters, ok := iw.waiters[c]
+	if !ok {
+		return
+	}
+	if w, ok := waiters[ses]; ok {
+		w.stop()
+		delete(waiters, ses)
+	}
+	if len(waiters) == 0 {
+		delete(iw.waiters, c)
+	}
+}
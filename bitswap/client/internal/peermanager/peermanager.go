@@ -3,6 +3,7 @@ package peermanager
 import (
 	"context"
 	"sync"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/go-metrics-interface"
@@ -46,14 +47,33 @@ type PeerManager struct {
 	sessions     map[uint64]Session
 	peerSessions map[peer.ID]map[uint64]struct{}
 
+	// inflight coordinates the want-blocks of the sessions, if enabled with
+	// WithDuplicateWantSuppression.
+	iwLk     sync.Mutex
+	inflight *inflightWants
+
 	self peer.ID
 }
 
+// Option configures a PeerManager.
+type Option func(*PeerManager)
+
+// WithDuplicateWantSuppression makes the sessions wanting a CID for which
+// another session already sent a want-block wait for its block, rather than
+// sending their own want-blocks, for up to claimTimeout. See
+// [PeerManager.ClaimWantBlocks].
+func WithDuplicateWantSuppression(claimTimeout time.Duration) Option {
+	return func(pm *PeerManager) {
+		avoided := metrics.NewCtx(pm.ctx, "duplicate_want_blocks_avoided_total", "Number of want-blocks not sent because another session was already fetching the block.").Counter()
+		pm.inflight = newInflightWants(avoided, claimTimeout)
+	}
+}
+
 // New creates a new PeerManager, given a context and a peerQueueFactory.
-func New(ctx context.Context, createPeerQueue PeerQueueFactory, self peer.ID) *PeerManager {
+func New(ctx context.Context, createPeerQueue PeerQueueFactory, self peer.ID, opts ...Option) *PeerManager {
 	wantGauge := metrics.NewCtx(ctx, "wantlist_total", "Number of items in wantlist.").Gauge()
 	wantBlockGauge := metrics.NewCtx(ctx, "want_blocks_total", "Number of want-blocks in wantlist.").Gauge()
-	return &PeerManager{
+	pm := &PeerManager{
 		peerQueues:      make(map[peer.ID]PeerQueue),
 		pwm:             newPeerWantManager(wantGauge, wantBlockGauge),
 		createPeerQueue: createPeerQueue,
@@ -63,6 +83,10 @@ func New(ctx context.Context, createPeerQueue PeerQueueFactory, self peer.ID) *P
 		sessions:     make(map[uint64]Session),
 		peerSessions: make(map[peer.ID]map[uint64]struct{}),
 	}
+	for _, opt := range opts {
+		opt(pm)
+	}
+	return pm
 }
 
 func (pm *PeerManager) AvailablePeers() []peer.ID {
@@ -164,6 +188,41 @@ func (pm *PeerManager) SendCancels(ctx context.Context, cancelKs []cid.Cid, excl
 	pm.pwm.sendCancels(cancelKs, excludePeer)
 }
 
+// ClaimWantBlocks returns the keys for which the session can send
+// want-blocks, which are all the keys unless WithDuplicateWantSuppression is
+// set. Otherwise, the keys for which another session sends want-blocks are
+// left out: the session waits for their blocks, which are delivered to every
+// interested session, and wake is called if the other session gives up, or
+// once its claim times out, so that the session claims them again.
+//
+// The claims are given up with ReleaseWantBlocks, or when the session is
+// unregistered.
+func (pm *PeerManager) ClaimWantBlocks(ses uint64, ks []cid.Cid, wake func()) []cid.Cid {
+	if pm.inflight == nil {
+		return ks
+	}
+
+	pm.iwLk.Lock()
+	defer pm.iwLk.Unlock()
+	return pm.inflight.claim(ses, ks, wake)
+}
+
+// ReleaseWantBlocks gives up the claims of the session on the given keys,
+// once it received their blocks or stopped sending want-blocks for them, and
+// stops it waiting for them.
+func (pm *PeerManager) ReleaseWantBlocks(ses uint64, ks []cid.Cid) {
+	if pm.inflight == nil {
+		return
+	}
+
+	pm.iwLk.Lock()
+	wakes := pm.inflight.release(ses, ks)
+	pm.iwLk.Unlock()
+	for _, wake := range wakes {
+		wake()
+	}
+}
+
 // CurrentWants returns the list of pending wants (both want-haves and want-blocks).
 func (pm *PeerManager) CurrentWants() []cid.Cid {
 	pm.pqLk.RLock()
@@ -228,6 +287,15 @@ func (pm *PeerManager) UnregisterSession(ses uint64) {
 	}
 
 	delete(pm.sessions, ses)
+
+	if pm.inflight != nil {
+		pm.iwLk.Lock()
+		wakes := pm.inflight.releaseSession(ses)
+		pm.iwLk.Unlock()
+		for _, wake := range wakes {
+			wake()
+		}
+	}
 }
 
 // signalAvailability is called when a peer's connectivity changes.
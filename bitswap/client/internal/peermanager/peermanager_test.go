@@ -4,6 +4,7 @@ import (
 	"context"
 	"math/rand"
 	"slices"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -423,3 +424,162 @@ func BenchmarkPeerManager(b *testing.B) {
 		}
 	}
 }
+
+func TestClaimWantBlocks(t *testing.T) {
+	msgs := make(chan msg, 16)
+	cids := random.Cids(3)
+
+	pm := New(context.Background(), makePeerQueueFactory(msgs), "")
+	if claimed := pm.ClaimWantBlocks(1, cids, nil); len(claimed) != len(cids) {
+		t.Fatal("wants must not be coordinated by default")
+	}
+
+	pm = New(context.Background(), makePeerQueueFactory(msgs), "", WithDuplicateWantSuppression(time.Hour))
+	var woken []uint64
+	wake := func(ses uint64) func() {
+		return func() { woken = append(woken, ses) }
+	}
+
+	if claimed := pm.ClaimWantBlocks(1, cids[:2], wake(1)); len(claimed) != 2 {
+		t.Fatalf("session 1 claimed %d wants, expected 2", len(claimed))
+	}
+	claimed := pm.ClaimWantBlocks(2, cids, wake(2))
+	if len(claimed) != 1 || claimed[0] != cids[2] {
+		t.Fatalf("session 2 claimed %v, expected %v", claimed, cids[2:])
+	}
+	if claimed := pm.ClaimWantBlocks(1, cids[:1], wake(1)); len(claimed) != 1 {
+		t.Fatal("session 1 could not claim its own want again")
+	}
+
+	pm.ReleaseWantBlocks(1, cids[:1])
+	if !slices.Equal(woken, []uint64{2}) {
+		t.Fatalf("woken sessions %v, expected session 2", woken)
+	}
+	if claimed := pm.ClaimWantBlocks(2, cids[:1], wake(2)); len(claimed) != 1 {
+		t.Fatal("session 2 could not claim the released want")
+	}
+
+	woken = nil
+	pm.UnregisterSession(1)
+	if !slices.Equal(woken, []uint64{2}) {
+		t.Fatalf("woken sessions %v, expected session 2", woken)
+	}
+	if claimed := pm.ClaimWantBlocks(2, cids[1:2], wake(2)); len(claimed) != 1 {
+		t.Fatal("session 2 could not claim the want of the unregistered session")
+	}
+}
+
+func TestClaimWantBlocksTimeout(t *testing.T) {
+	msgs := make(chan msg, 16)
+	cids := random.Cids(1)
+
+	pm := New(context.Background(), makePeerQueueFactory(msgs), "", WithDuplicateWantSuppression(50*time.Millisecond))
+	woken := make(chan struct{}, 1)
+	if claimed := pm.ClaimWantBlocks(1, cids, nil); len(claimed) != 1 {
+		t.Fatal("session 1 could not claim the want")
+	}
+	if claimed := pm.ClaimWantBlocks(2, cids, func() { woken <- struct{}{} }); len(claimed) != 0 {
+		t.Fatal("session 2 claimed the want of session 1")
+	}
+
+	// Session 2 is woken up once the claim of session 1 times out, and
+	// takes it over.
+	select {
+	case <-woken:
+	case <-time.After(time.Second):
+		t.Fatal("session 2 was not woken up")
+	}
+	if claimed := pm.ClaimWantBlocks(2, cids, nil); len(claimed) != 1 {
+		t.Fatal("session 2 could not take over the timed out claim")
+	}
+	if claimed := pm.ClaimWantBlocks(1, cids, nil); len(claimed) != 0 {
+		t.Fatal("session 1 claimed the want taken over by session 2")
+	}
+
+	// Releasing the lost claim has no effect.
+	pm.ReleaseWantBlocks(1, cids)
+	if claimed := pm.ClaimWantBlocks(3, cids, nil); len(claimed) != 0 {
+		t.Fatal("session 3 claimed the want of session 2")
+	}
+}
+
+func TestClaimWantBlocksReleaseStopsTimeout(t *testing.T) {
+	msgs := make(chan msg, 16)
+	cids := random.Cids(1)
+
+	pm := New(context.Background(), makePeerQueueFactory(msgs), "", WithDuplicateWantSuppression(50*time.Millisecond))
+	var woken atomic.Int32
+	if claimed := pm.ClaimWantBlocks(1, cids, nil); len(claimed) != 1 {
+		t.Fatal("session 1 could not claim the want")
+	}
+	if claimed := pm.ClaimWantBlocks(2, cids, func() { woken.Add(1) }); len(claimed) != 0 {
+		t.Fatal("session 2 claimed the want of session 1")
+	}
+
+	// Session 2 is woken up once by the release, and not again when the
+	// released claim would have timed out.
+	pm.ReleaseWantBlocks(1, cids)
+	time.Sleep(100 * time.Millisecond)
+	if n := woken.Load(); n != 1 {
+		t.Fatalf("session 2 was woken up %d times, expected once", n)
+	}
+}
+
+func TestClaimWantBlocksBroadcast(t *testing.T) {
+	ctx := context.Background()
+	msgs := make(chan msg, 16)
+	cids := random.Cids(1)
+	tp := random.Peers(3)
+	self, peer1, peer2 := tp[0], tp[1], tp[2]
+
+	pm := New(ctx, makePeerQueueFactory(msgs), self, WithDuplicateWantSuppression(time.Hour))
+	pm.Connected(peer1)
+	collectMessages(msgs, 2*time.Millisecond)
+
+	// Session 1 sends a want-block to peer1
+	if claimed := pm.ClaimWantBlocks(1, cids, nil); len(claimed) != 1 {
+		t.Fatal("session 1 could not claim the want")
+	}
+	pm.SendWants(ctx, peer1, cids, nil)
+	collected := collectMessages(msgs, 2*time.Millisecond)
+	if !slices.Equal(collected[peer1].wantBlocks, cids) {
+		t.Fatalf("peer1 received want-blocks %v, expected %v", collected[peer1].wantBlocks, cids)
+	}
+
+	// Session 2 has no peers yet, so it broadcasts a want-have, which is not
+	// sent to peer1 as it was already sent the want-block of session 1
+	pm.BroadcastWantHaves(ctx, cids)
+	collected = collectMessages(msgs, 2*time.Millisecond)
+	if len(collected[peer1].wantHaves) != 0 {
+		t.Fatal("peer1 was sent a want-have for the block it was asked")
+	}
+
+	// Peers connecting later only receive the broadcast want-have, once
+	pm.BroadcastWantHaves(ctx, cids)
+	pm.Connected(peer2)
+	collected = collectMessages(msgs, 2*time.Millisecond)
+	if !slices.Equal(collected[peer2].wantHaves, cids) || len(collected[peer2].wantBlocks) != 0 {
+		t.Fatalf("peer2 received %v, expected a single want-have", collected[peer2])
+	}
+
+	// peer2 answers the broadcast with a HAVE, but session 2 waits for the
+	// block fetched by session 1
+	var woken atomic.Int32
+	if claimed := pm.ClaimWantBlocks(2, cids, func() { woken.Add(1) }); len(claimed) != 0 {
+		t.Fatal("session 2 claimed the want of session 1")
+	}
+
+	// Session 1 gives up, and session 2 sends its own want-block to peer2
+	pm.ReleaseWantBlocks(1, cids)
+	if woken.Load() != 1 {
+		t.Fatal("session 2 was not woken up")
+	}
+	if claimed := pm.ClaimWantBlocks(2, cids, nil); len(claimed) != 1 {
+		t.Fatal("session 2 could not claim the released want")
+	}
+	pm.SendWants(ctx, peer2, cids, nil)
+	collected = collectMessages(msgs, 2*time.Millisecond)
+	if !slices.Equal(collected[peer2].wantBlocks, cids) {
+		t.Fatalf("peer2 received want-blocks %v, expected %v", collected[peer2].wantBlocks, cids)
+	}
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/boxo/bitswap/client/internal"
@@ -10,6 +11,7 @@ import (
 	notifications "github.com/ipfs/boxo/bitswap/client/internal/notifications"
 	bspm "github.com/ipfs/boxo/bitswap/client/internal/peermanager"
 	bssim "github.com/ipfs/boxo/bitswap/client/internal/sessioninterestmanager"
+	bsinternal "github.com/ipfs/boxo/bitswap/internal"
 	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 	delay "github.com/ipfs/go-ipfs-delay"
@@ -78,6 +80,20 @@ type ProviderFinder interface {
 	FindProvidersAsync(ctx context.Context, k cid.Cid, max int) <-chan peer.AddrInfo
 }
 
+// ProviderSearchPolicy tells when a session searches for providers of its
+// wants, in addition to the periodic search.
+type ProviderSearchPolicy struct {
+	// AfterBroadcasts is the number of consecutive broadcasts, made while no
+	// block is received, after which the session searches for providers of
+	// the first want. Zero means one, negative values disable the search on
+	// broadcasts.
+	AfterBroadcasts int
+
+	// AfterIdle, if positive, makes the session search for providers of a
+	// live want whenever it receives no block for this long.
+	AfterIdle time.Duration
+}
+
 // opType is the kind of operation that is being processed by the event loop
 type opType int
 
@@ -123,11 +139,13 @@ type Session struct {
 
 	// do not touch outside run loop
 	idleTick            *time.Timer
+	idleSearchTimer     *time.Timer
 	periodicSearchTimer *time.Timer
 	baseTickDelay       time.Duration
 	consecutiveTicks    int
 	initialSearchDelay  time.Duration
 	periodicSearchDelay delay.D
+	searchPolicy        ProviderSearchPolicy
 	// identifiers
 	notif notifications.PubSub
 	id    uint64
@@ -149,8 +167,15 @@ func New(
 	notif notifications.PubSub,
 	initialSearchDelay time.Duration,
 	periodicSearchDelay delay.D,
+	searchPolicy ProviderSearchPolicy,
 	self peer.ID,
 ) *Session {
+	if searchPolicy.AfterBroadcasts == 0 {
+		searchPolicy.AfterBroadcasts = 1
+	}
+	// The dials to the providers found by the session are counted against
+	// the dial budget of the network, if any.
+	ctx = bsinternal.ContextWithSessionDials(ctx, new(atomic.Int64))
 	ctx, cancel := context.WithCancel(ctx)
 	s := &Session{
 		sw:                  newSessionWants(broadcastLiveWantsLimit),
@@ -169,6 +194,7 @@ func New(
 		id:                  id,
 		initialSearchDelay:  initialSearchDelay,
 		periodicSearchDelay: periodicSearchDelay,
+		searchPolicy:        searchPolicy,
 		self:                self,
 	}
 	s.sws = newSessionWantSender(id, pm, sprm, sm, bpm, s.onWantsSent, s.onPeersExhausted)
@@ -302,6 +328,10 @@ func (s *Session) run(ctx context.Context) {
 
 	s.idleTick = time.NewTimer(s.initialSearchDelay)
 	s.periodicSearchTimer = time.NewTimer(s.periodicSearchDelay.NextWaitTime())
+	s.idleSearchTimer = time.NewTimer(s.searchPolicy.AfterIdle)
+	if s.searchPolicy.AfterIdle <= 0 {
+		s.idleSearchTimer.Stop()
+	}
 	sessionSpan := trace.SpanFromContext(ctx)
 	for {
 		select {
@@ -337,6 +367,11 @@ func (s *Session) run(ctx context.Context) {
 			opCtx, span := internal.StartSpan(ctx, "Session.IdleBroadcast")
 			s.broadcast(opCtx, nil)
 			span.End()
+		case <-s.idleSearchTimer.C:
+			// The session hasn't received blocks for a while, search
+			opCtx, span := internal.StartSpan(ctx, "Session.IdleSearch")
+			s.handleIdleSearch(opCtx)
+			span.End()
 		case <-s.periodicSearchTimer.C:
 			// Periodically search for a random live want
 			opCtx, span := internal.StartSpan(ctx, "Session.PeriodicSearch")
@@ -366,9 +401,9 @@ func (s *Session) broadcast(ctx context.Context, wants []cid.Cid) {
 	// Broadcast a want-have for the live wants to everyone we're connected to
 	s.broadcastWantHaves(ctx, wants)
 
-	// do not find providers on consecutive ticks
-	// -- just rely on periodic search widening
-	if len(wants) > 0 && (s.consecutiveTicks == 0) {
+	// only find providers once per series of consecutive ticks, after the
+	// configured number of them -- then rely on periodic search widening
+	if len(wants) > 0 && s.consecutiveTicks == s.searchPolicy.AfterBroadcasts-1 {
 		// Search for providers who have the first want in the list.
 		// Typically if the provider has the first block they will have
 		// the rest of the blocks also.
@@ -400,6 +435,16 @@ func (s *Session) handlePeriodicSearch(ctx context.Context) {
 	s.periodicSearchTimer.Reset(s.periodicSearchDelay.NextWaitTime())
 }
 
+// handleIdleSearch is called when the session has not received blocks for
+// the idle search delay, to search for providers of a randomly chosen CID in
+// the session.
+func (s *Session) handleIdleSearch(ctx context.Context) {
+	if randomWant := s.sw.RandomLiveWant(); randomWant.Defined() {
+		s.findMorePeers(ctx, randomWant)
+	}
+	s.idleSearchTimer.Reset(s.searchPolicy.AfterIdle)
+}
+
 // findMorePeers attempts to find more peers for a session by searching for
 // providers for the given Cid
 func (s *Session) findMorePeers(ctx context.Context, c cid.Cid) {
@@ -421,8 +466,9 @@ func (s *Session) findMorePeers(ctx context.Context, c cid.Cid) {
 
 // handleShutdown is called when the session shuts down
 func (s *Session) handleShutdown() {
-	// Stop the idle timer
+	// Stop the idle timers
 	s.idleTick.Stop()
+	s.idleSearchTimer.Stop()
 	// Shut down the session peer manager
 	s.sprm.Shutdown()
 	// Shut down the sessionWantSender (blocks until sessionWantSender stops
@@ -459,6 +505,16 @@ func (s *Session) handleReceive(ks []cid.Cid) {
 	if s.sw.HasLiveWants() {
 		s.resetIdleTick()
 	}
+
+	if s.searchPolicy.AfterIdle > 0 {
+		if !s.idleSearchTimer.Stop() {
+			select {
+			case <-s.idleSearchTimer.C:
+			default:
+			}
+		}
+		s.idleSearchTimer.Reset(s.searchPolicy.AfterIdle)
+	}
 }
 
 // wantBlocks is called when blocks are requested by the client
@@ -164,7 +164,7 @@ func TestSessionGetBlocks(t *testing.T) {
 	defer notif.Shutdown()
 	id := random.SequenceNext()
 	sm := newMockSessionMgr()
-	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), "")
+	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), ProviderSearchPolicy{}, "")
 	blks := random.BlocksOfSize(broadcastLiveWantsLimit*2, blockSize)
 	var cids []cid.Cid
 	for _, block := range blks {
@@ -244,7 +244,7 @@ func TestSessionFindMorePeers(t *testing.T) {
 	defer notif.Shutdown()
 	id := random.SequenceNext()
 	sm := newMockSessionMgr()
-	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), "")
+	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), ProviderSearchPolicy{}, "")
 	session.SetBaseTickDelay(200 * time.Microsecond)
 	blks := random.BlocksOfSize(broadcastLiveWantsLimit*2, blockSize)
 	var cids []cid.Cid
@@ -314,7 +314,7 @@ func TestSessionOnPeersExhausted(t *testing.T) {
 	defer notif.Shutdown()
 	id := random.SequenceNext()
 	sm := newMockSessionMgr()
-	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), "")
+	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), ProviderSearchPolicy{}, "")
 	blks := random.BlocksOfSize(broadcastLiveWantsLimit+5, blockSize)
 	var cids []cid.Cid
 	for _, block := range blks {
@@ -351,7 +351,7 @@ func TestSessionFailingToGetFirstBlock(t *testing.T) {
 	defer notif.Shutdown()
 	id := random.SequenceNext()
 	sm := newMockSessionMgr()
-	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, 10*time.Millisecond, delay.Fixed(100*time.Millisecond), "")
+	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, 10*time.Millisecond, delay.Fixed(100*time.Millisecond), ProviderSearchPolicy{}, "")
 	blks := random.BlocksOfSize(4, blockSize)
 	var cids []cid.Cid
 	for _, block := range blks {
@@ -439,6 +439,75 @@ func TestSessionFailingToGetFirstBlock(t *testing.T) {
 	}
 }
 
+func TestSessionProviderSearchPolicy(t *testing.T) {
+	newSession := func(ctx context.Context, policy ProviderSearchPolicy) (*fakePeerManager, *fakeProviderFinder) {
+		fpm := newFakePeerManager()
+		fpf := newFakeProviderFinder()
+		notif := notifications.New()
+		t.Cleanup(notif.Shutdown)
+		session := New(ctx, newMockSessionMgr(), random.SequenceNext(), newFakeSessionPeerManager(), fpf, bssim.New(), fpm, bsbpm.New(), notif, 10*time.Millisecond, delay.Fixed(time.Minute), policy, "")
+		_, err := session.GetBlocks(ctx, random.Cids(4))
+		require.NoError(t, err)
+		return fpm, fpf
+	}
+
+	t.Run("After broadcasts", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		fpm, fpf := newSession(ctx, ProviderSearchPolicy{AfterBroadcasts: 3})
+
+		// The initial broadcast, and then three broadcasts on idle ticks.
+		var broadcasts int
+		for {
+			select {
+			case <-fpm.wantReqs:
+				broadcasts++
+				continue
+			case <-fpf.findMorePeersRequested:
+			case <-ctx.Done():
+				t.Fatal("Did not find more peers")
+			}
+			break
+		}
+		require.GreaterOrEqual(t, broadcasts, 4)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		fpm, fpf := newSession(ctx, ProviderSearchPolicy{AfterBroadcasts: -1})
+
+		var broadcasts int
+		for ctx.Err() == nil {
+			select {
+			case <-fpm.wantReqs:
+				broadcasts++
+			case <-fpf.findMorePeersRequested:
+				t.Fatal("Should not have tried to find peers")
+			case <-ctx.Done():
+			}
+		}
+		require.Greater(t, broadcasts, 2)
+	})
+
+	t.Run("After idle", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		fpm, fpf := newSession(ctx, ProviderSearchPolicy{AfterBroadcasts: -1, AfterIdle: 50 * time.Millisecond})
+
+		for {
+			select {
+			case <-fpm.wantReqs:
+				continue
+			case <-fpf.findMorePeersRequested:
+			case <-ctx.Done():
+				t.Fatal("Did not find more peers")
+			}
+			break
+		}
+	})
+}
+
 func TestSessionCtxCancelClosesGetBlocksChannel(t *testing.T) {
 	fpm := newFakePeerManager()
 	fspm := newFakeSessionPeerManager()
@@ -452,7 +521,7 @@ func TestSessionCtxCancelClosesGetBlocksChannel(t *testing.T) {
 
 	// Create a new session with its own context
 	sessctx, sesscancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	session := New(sessctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), "")
+	session := New(sessctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), ProviderSearchPolicy{}, "")
 
 	timerCtx, timerCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
 	defer timerCancel()
@@ -496,7 +565,7 @@ func TestSessionOnShutdownCalled(t *testing.T) {
 	// Create a new session with its own context
 	sessctx, sesscancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer sesscancel()
-	session := New(sessctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), "")
+	session := New(sessctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), ProviderSearchPolicy{}, "")
 
 	// Shutdown the session
 	session.Shutdown()
@@ -519,7 +588,7 @@ func TestSessionReceiveMessageAfterCtxCancel(t *testing.T) {
 	defer notif.Shutdown()
 	id := random.SequenceNext()
 	sm := newMockSessionMgr()
-	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), "")
+	session := New(ctx, sm, id, fspm, fpf, sim, fpm, bpm, notif, time.Second, delay.Fixed(time.Minute), ProviderSearchPolicy{}, "")
 	blks := random.BlocksOfSize(2, blockSize)
 	cids := []cid.Cid{blks[0].Cid(), blks[1].Cid()}
 
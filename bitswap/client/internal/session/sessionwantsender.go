@@ -67,6 +67,16 @@ type change struct {
 	availability peerAvailability
 }
 
+// wantBlockClaimer is implemented by the PeerManagers coordinating the
+// want-blocks of the sessions, so that a single session sends want-blocks for
+// a CID at a time. See [peermanager.PeerManager.ClaimWantBlocks].
+//
+// [peermanager.PeerManager.ClaimWantBlocks]: https://pkg.go.dev/github.com/ipfs/boxo/bitswap/client/internal/peermanager#PeerManager.ClaimWantBlocks
+type wantBlockClaimer interface {
+	ClaimWantBlocks(ses uint64, ks []cid.Cid, wake func()) []cid.Cid
+	ReleaseWantBlocks(ses uint64, ks []cid.Cid)
+}
+
 type (
 	onSendFn           func(to peer.ID, wantBlocks []cid.Cid, wantHaves []cid.Cid)
 	onPeersExhaustedFn func([]cid.Cid)
@@ -100,6 +110,12 @@ type sessionWantSender struct {
 	peerRspTrkr *peerResponseTracker
 	// Sends wants to peers
 	pm PeerManager
+	// Coordinates the want-blocks with the other sessions, if supported by
+	// the PeerManager
+	claimer wantBlockClaimer
+	// The wants claimed from the claimer (true), or waiting for another
+	// session (false)
+	claims map[cid.Cid]bool
 	// Keeps track of peers in the session
 	spm SessionPeerManager
 	// Cancels wants
@@ -134,6 +150,10 @@ func newSessionWantSender(sid uint64, pm PeerManager, spm SessionPeerManager, ca
 		onSend:           onSend,
 		onPeersExhausted: onPeersExhausted,
 	}
+	if claimer, ok := pm.(wantBlockClaimer); ok {
+		sws.claimer = claimer
+		sws.claims = make(map[cid.Cid]bool)
+	}
 
 	return sws
 }
@@ -298,6 +318,9 @@ func (sws *sessionWantSender) onChange(changes []change) {
 	if sws.spm.HasPeers() {
 		sws.sendNextWants(newlyAvailable)
 	}
+
+	// Let other sessions send the want-blocks this session no longer sends
+	sws.releaseClaims()
 }
 
 // processAvailability updates the want queue with any changes in
@@ -528,6 +551,7 @@ func (aw allWants) forPeer(p peer.ID) *wantSets {
 // about which peers have / dont have blocks
 func (sws *sessionWantSender) sendNextWants(newlyAvailable []peer.ID) {
 	toSend := make(allWants)
+	claimed := sws.claimWantBlocks()
 
 	for c, wi := range sws.wants {
 		// Ensure we send want-haves to any newly available peers
@@ -548,6 +572,15 @@ func (sws *sessionWantSender) sendNextWants(newlyAvailable []peer.ID) {
 			continue
 		}
 
+		// Another session is fetching the block, which will be delivered to
+		// this session too, so only ask peers whether they have it
+		if !claimed.Has(c) {
+			for _, p := range sws.spm.Peers() {
+				toSend.forPeer(p).wantHaves.Add(c)
+			}
+			continue
+		}
+
 		// Send a want-block to the chosen peer
 		toSend.forPeer(wi.bestPeer).wantBlocks.Add(c)
 
@@ -563,7 +596,7 @@ func (sws *sessionWantSender) sendNextWants(newlyAvailable []peer.ID) {
 	sws.sendWants(toSend)
 
 	for c, wi := range sws.wants {
-		if wi.bestPeer != "" && wi.sentTo == "" {
+		if wi.bestPeer != "" && wi.sentTo == "" && claimed.Has(c) {
 			// check if a want block was successfully sent to the best peer
 			if toSend.forPeer(wi.bestPeer).sent {
 				// Record that we are sending a want-block for this want to the peer
@@ -573,6 +606,57 @@ func (sws *sessionWantSender) sendNextWants(newlyAvailable []peer.ID) {
 	}
 }
 
+// claimWantBlocks returns the wants for which a want-block can be sent, once
+// claimed from the claimer if any.
+func (sws *sessionWantSender) claimWantBlocks() *cid.Set {
+	var pending []cid.Cid
+	for c, wi := range sws.wants {
+		if wi.sentTo == "" && wi.bestPeer != "" {
+			pending = append(pending, c)
+		}
+	}
+	claimed := cid.NewSet()
+	if sws.claimer == nil {
+		for _, c := range pending {
+			claimed.Add(c)
+		}
+		return claimed
+	}
+
+	for _, c := range pending {
+		sws.claims[c] = false
+	}
+	ks := sws.claimer.ClaimWantBlocks(sws.sessionID, pending, func() {
+		// Send the wants released by the other session
+		sws.addChangeNonBlocking(change{})
+	})
+	for _, c := range ks {
+		sws.claims[c] = true
+		claimed.Add(c)
+	}
+	return claimed
+}
+
+// releaseClaims releases the claims on the wants that were removed, or whose
+// want-block could not be sent or was answered with a DONT_HAVE.
+func (sws *sessionWantSender) releaseClaims() {
+	if sws.claimer == nil {
+		return
+	}
+
+	var released []cid.Cid
+	for c, owned := range sws.claims {
+		wi, ok := sws.wants[c]
+		if !ok || (owned && wi.sentTo == "") {
+			released = append(released, c)
+			delete(sws.claims, c)
+		}
+	}
+	if len(released) > 0 {
+		sws.claimer.ReleaseWantBlocks(sws.sessionID, released)
+	}
+}
+
 // sendWants sends want-have and want-blocks to the appropriate peers
 func (sws *sessionWantSender) sendWants(sends allWants) {
 	// For each peer we're sending a request to
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -844,3 +845,99 @@ func TestConsecutiveDontHaveDontRemoveIfHasWantedBlock(t *testing.T) {
 	// (We received a HAVE for cid 0 but didn't yet receive the block)
 	require.True(t, fpm.HasPeer(p), "Expected peer to be available")
 }
+
+// claimingPeerManager coordinates the want-blocks of sessions with a real
+// PeerManager.
+type claimingPeerManager struct {
+	*mockPeerManager
+	pm *bspm.PeerManager
+}
+
+func (pm *claimingPeerManager) ClaimWantBlocks(ses uint64, ks []cid.Cid, wake func()) []cid.Cid {
+	return pm.pm.ClaimWantBlocks(ses, ks, wake)
+}
+
+func (pm *claimingPeerManager) ReleaseWantBlocks(ses uint64, ks []cid.Cid) {
+	pm.pm.ReleaseWantBlocks(ses, ks)
+}
+
+func TestDuplicateWantSuppression(t *testing.T) {
+	cids := random.Cids(1)
+	peers := random.Peers(2)
+	peerA := peers[0]
+	peerB := peers[1]
+	bpm := bsbpm.New()
+	onSend := func(peer.ID, []cid.Cid, []cid.Cid) {}
+	onPeersExhausted := func([]cid.Cid) {}
+	pm := bspm.New(context.Background(), nil, "", bspm.WithDuplicateWantSuppression(time.Hour))
+
+	pm1 := &claimingPeerManager{newMockPeerManager(), pm}
+	sws1 := newSessionWantSender(1, pm1, newFakeSessionPeerManager(), newMockSessionMgr(), bpm, onSend, onPeersExhausted)
+	defer sws1.Shutdown()
+	go sws1.Run()
+	pm2 := &claimingPeerManager{newMockPeerManager(), pm}
+	sws2 := newSessionWantSender(2, pm2, newFakeSessionPeerManager(), newMockSessionMgr(), bpm, onSend, onPeersExhausted)
+	defer sws2.Shutdown()
+	go sws2.Run()
+
+	// Session 1 sends a want-block to peerA
+	sws1.Add(cids)
+	sws1.Update(peerA, []cid.Cid{}, cids, []cid.Cid{})
+	peerSends := pm1.waitNextWants()
+	require.ElementsMatch(t, peerSends[peerA].wantBlocksKeys(), cids)
+
+	// Session 2 waits for the block fetched by session 1, and only sends a
+	// want-have to peerB
+	sws2.Add(cids)
+	sws2.Update(peerB, []cid.Cid{}, cids, []cid.Cid{})
+	peerSends = pm2.waitNextWants()
+	require.Empty(t, peerSends[peerB].wantBlocksKeys(), "Expecting no want-blocks")
+	require.ElementsMatch(t, peerSends[peerB].wantHavesKeys(), cids)
+
+	// peerA does not have the block, so session 2 sends its own want-block
+	bpm.ReceiveFrom(peerA, []cid.Cid{}, cids)
+	sws1.Update(peerA, []cid.Cid{}, []cid.Cid{}, cids)
+	peerSends = pm2.waitNextWants()
+	require.ElementsMatch(t, peerSends[peerB].wantBlocksKeys(), cids)
+}
+
+func TestDuplicateWantSuppressionTimeout(t *testing.T) {
+	cids := random.Cids(1)
+	peers := random.Peers(2)
+	peerA := peers[0]
+	peerB := peers[1]
+	bpm := bsbpm.New()
+	onSend := func(peer.ID, []cid.Cid, []cid.Cid) {}
+	onPeersExhausted := func([]cid.Cid) {}
+	pm := bspm.New(context.Background(), nil, "", bspm.WithDuplicateWantSuppression(100*time.Millisecond))
+
+	pm1 := &claimingPeerManager{newMockPeerManager(), pm}
+	sws1 := newSessionWantSender(1, pm1, newFakeSessionPeerManager(), newMockSessionMgr(), bpm, onSend, onPeersExhausted)
+	defer sws1.Shutdown()
+	go sws1.Run()
+	pm2 := &claimingPeerManager{newMockPeerManager(), pm}
+	sws2 := newSessionWantSender(2, pm2, newFakeSessionPeerManager(), newMockSessionMgr(), bpm, onSend, onPeersExhausted)
+	defer sws2.Shutdown()
+	go sws2.Run()
+
+	// Session 1 sends a want-block to peerA, which never answers
+	sws1.Add(cids)
+	sws1.Update(peerA, []cid.Cid{}, cids, []cid.Cid{})
+	peerSends := pm1.waitNextWants()
+	require.ElementsMatch(t, peerSends[peerA].wantBlocksKeys(), cids)
+
+	// Session 2 waits for session 1 even though peerB has the block
+	sws2.Add(cids)
+	sws2.Update(peerB, []cid.Cid{}, cids, []cid.Cid{})
+	bpm.ReceiveFrom(peerB, cids, []cid.Cid{})
+	sws2.Update(peerB, []cid.Cid{}, cids, []cid.Cid{})
+	peerSends = pm2.waitNextWants()
+	require.NotNil(t, peerSends[peerB])
+	require.Empty(t, peerSends[peerB].wantBlocksKeys(), "Expecting no want-blocks")
+
+	// Once the claim of session 1 times out, session 2 sends its own
+	// want-block
+	require.Eventually(t, func() bool {
+		return slices.Contains(peerSends[peerB].wantBlocksKeys(), cids[0])
+	}, time.Second, 10*time.Millisecond)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/ipfs/boxo/bitswap/internal/defaults"
 	logging "github.com/ipfs/go-log/v2"
 
 	peer "github.com/libp2p/go-libp2p/core/peer"
@@ -41,7 +42,7 @@ type SessionPeerManager struct {
 func New(id uint64, tagger PeerTagger) *SessionPeerManager {
 	return &SessionPeerManager{
 		id:     id,
-		tag:    fmt.Sprint("bs-ses-", id),
+		tag:    fmt.Sprint(defaults.SessionPeerTagPrefix, id),
 		tagger: tagger,
 		peers:  make(map[peer.ID]struct{}),
 	}
@@ -0,0 +1,130 @@
+package wantpersister
+
+import (
+	"context"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// keyPrefix is the datastore namespace under which wants are persisted.
+var keyPrefix = datastore.NewKey("/bitswap/wantlist")
+
+// WantPersister records the CIDs that are currently wanted by the client in
+// a datastore, so that they can be resumed after a restart.
+//
+// The same CID may be wanted by several requests at once, so the number of
+// requests is counted in memory and the CID is only removed from the
+// datastore once no request wants it any more.
+type WantPersister struct {
+	ds datastore.Batching
+
+	lk   sync.Mutex
+	refs map[cid.Cid]int
+}
+
+// New initializes a new WantPersister that stores wants in ds.
+func New(ds datastore.Batching) *WantPersister {
+	return &WantPersister{
+		ds:   namespace.Wrap(ds, keyPrefix),
+		refs: make(map[cid.Cid]int),
+	}
+}
+
+// Add records that a request wants the given CIDs. The caller must call
+// Remove for each of the CIDs once the request does not want it any more,
+// unless Add fails.
+func (wp *WantPersister) Add(ctx context.Context, ks []cid.Cid) error {
+	wp.lk.Lock()
+	defer wp.lk.Unlock()
+
+	b, err := wp.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for i, c := range ks {
+		wp.refs[c]++
+		if wp.refs[c] > 1 {
+			continue
+		}
+		if err := b.Put(ctx, dsKey(c), nil); err != nil {
+			wp.unref(ks[:i+1])
+			return err
+		}
+	}
+	if err := b.Commit(ctx); err != nil {
+		wp.unref(ks)
+		return err
+	}
+	return nil
+}
+
+// unref undoes the references added to ks by a failed Add, so that the
+// caller, which does not call Remove, does not keep them forever.
+func (wp *WantPersister) unref(ks []cid.Cid) {
+	for _, c := range ks {
+		if wp.refs[c] > 1 {
+			wp.refs[c]--
+		} else {
+			delete(wp.refs, c)
+		}
+	}
+}
+
+// Remove records that a request does not want the given CIDs any more. CIDs
+// that are not wanted by any other request are removed from the datastore.
+func (wp *WantPersister) Remove(ctx context.Context, ks []cid.Cid) error {
+	wp.lk.Lock()
+	defer wp.lk.Unlock()
+
+	b, err := wp.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range ks {
+		n, ok := wp.refs[c]
+		if !ok {
+			continue
+		}
+		if n > 1 {
+			wp.refs[c] = n - 1
+			continue
+		}
+		delete(wp.refs, c)
+		if err := b.Delete(ctx, dsKey(c)); err != nil {
+			return err
+		}
+	}
+	return b.Commit(ctx)
+}
+
+// Load returns the CIDs persisted in the datastore, typically by a previous
+// run of the client.
+func (wp *WantPersister) Load(ctx context.Context) ([]cid.Cid, error) {
+	res, err := wp.ds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var ks []cid.Cid
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := cid.Decode(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			// Skip entries that were not written by us.
+			continue
+		}
+		ks = append(ks, c)
+	}
+	return ks, nil
+}
+
+func dsKey(c cid.Cid) datastore.Key {
+	return datastore.NewKey(c.String())
+}
@@ -0,0 +1,94 @@
+package wantpersister
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-test/random"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddRemove(t *testing.T) {
+	ctx := context.Background()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	wp := New(ds)
+
+	cids := random.Cids(3)
+	require.NoError(t, wp.Add(ctx, cids))
+	require.NoError(t, wp.Add(ctx, cids[:1]))
+
+	loaded, err := wp.Load(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, cids, loaded)
+
+	// cids[0] is wanted twice, so it is kept after a single removal.
+	require.NoError(t, wp.Remove(ctx, cids[:2]))
+	loaded, err = wp.Load(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []cid.Cid{cids[0], cids[2]}, loaded)
+
+	require.NoError(t, wp.Remove(ctx, cids))
+	loaded, err = wp.Load(ctx)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+}
+
+func TestLoadAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	cids := random.Cids(2)
+	require.NoError(t, New(ds).Add(ctx, cids))
+
+	// Entries that are not ours are ignored.
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/bitswap/other"), nil))
+
+	wp := New(ds)
+	loaded, err := wp.Load(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, cids, loaded)
+
+	// Removing a loaded want requires it to be added again first, which is
+	// what resuming does.
+	require.NoError(t, wp.Add(ctx, loaded))
+	require.NoError(t, wp.Remove(ctx, loaded))
+	loaded, err = wp.Load(ctx)
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+}
+
+// failingDatastore fails the commits of its batches.
+type failingDatastore struct {
+	datastore.Batching
+}
+
+func (ds failingDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := ds.Batching.Batch(ctx)
+	return failingBatch{b}, err
+}
+
+type failingBatch struct {
+	datastore.Batch
+}
+
+func (b failingBatch) Commit(context.Context) error {
+	return errors.New("commit failed")
+}
+
+func TestFailedAdd(t *testing.T) {
+	ctx := context.Background()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	wp := New(ds)
+
+	cids := random.Cids(2)
+	require.NoError(t, wp.Add(ctx, cids[:1]))
+
+	// The references of a failed Add are undone.
+	wp.ds = failingDatastore{wp.ds.(datastore.Batching)}
+	require.Error(t, wp.Add(ctx, cids))
+	require.Equal(t, map[cid.Cid]int{cids[0]: 1}, wp.refs)
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	bsgetter "github.com/ipfs/boxo/bitswap/client/internal/getter"
+	exchange "github.com/ipfs/boxo/exchange"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// wantReleaseDelay is how long the wants of a request cancelled by its caller
+// are kept before being released. A graceful shutdown usually cancels the
+// requests before closing the client, and the wants must then survive the
+// restart.
+const wantReleaseDelay = time.Second
+
+// persistedSession records the wants of a session with the client's
+// WantPersister.
+type persistedSession struct {
+	exchange.Fetcher
+	bs *Client
+}
+
+func (s *persistedSession) GetBlock(ctx context.Context, k cid.Cid) (blocks.Block, error) {
+	return bsgetter.SyncGetBlock(ctx, k, s.GetBlocks)
+}
+
+func (s *persistedSession) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.Block, error) {
+	return s.bs.persistWants(ctx, keys, s.Fetcher.GetBlocks)
+}
+
+// shuttingDown returns true once the client is closed or its context is
+// done. Wants that are outstanding at this point are kept in the datastore to
+// be resumed on restart.
+func (bs *Client) shuttingDown() bool {
+	select {
+	case <-bs.closing:
+		return true
+	default:
+		return bs.ctx.Err() != nil
+	}
+}
+
+// persistWants records keys with the WantPersister for as long as they are
+// wanted by the request made with getBlocks. The WantPersister counts the
+// requests wanting each key, so a key wanted by concurrent requests stays
+// persisted until the last of them receives it or is cancelled.
+func (bs *Client) persistWants(ctx context.Context, keys []cid.Cid, getBlocks func(context.Context, []cid.Cid) (<-chan blocks.Block, error)) (<-chan blocks.Block, error) {
+	remaining := cid.NewSet()
+	for _, k := range keys {
+		remaining.Add(k)
+	}
+	if err := bs.wantPersister.Add(ctx, remaining.Keys()); err != nil {
+		// Persistence is best effort, do not fail the request.
+		log.Warnf("failed to persist wants: %s", err)
+		return getBlocks(ctx, keys)
+	}
+
+	blks, err := getBlocks(ctx, keys)
+	if err != nil {
+		bs.removeWants(remaining.Keys())
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		for b := range blks {
+			if remaining.Has(b.Cid()) {
+				remaining.Remove(b.Cid())
+				bs.removeWants([]cid.Cid{b.Cid()})
+			}
+			select {
+			case out <- b:
+			case <-ctx.Done():
+			}
+		}
+		// The remaining wants are only released when the caller cancelled
+		// the request, and not while the client is shutting down, in which
+		// case they must survive the restart.
+		if remaining.Len() > 0 && ctx.Err() != nil {
+			go bs.releaseCancelledWants(remaining.Keys())
+		}
+	}()
+	return out, nil
+}
+
+// releaseCancelledWants removes the wants of a cancelled request after
+// wantReleaseDelay, unless the client starts shutting down in the meantime.
+func (bs *Client) releaseCancelledWants(keys []cid.Cid) {
+	timer := time.NewTimer(wantReleaseDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-bs.closing:
+		return
+	case <-bs.ctx.Done():
+		return
+	}
+	if !bs.shuttingDown() {
+		bs.removeWants(keys)
+	}
+}
+
+// resumeWants fetches keys, the wants persisted by a previous run of the
+// client, and writes the blocks to the blockstore.
+func (bs *Client) resumeWants(ctx context.Context, keys []cid.Cid) {
+	if err := bs.wantPersister.Add(ctx, keys); err != nil {
+		log.Warnf("failed to load persisted wants: %s", err)
+		return
+	}
+
+	var missing, have []cid.Cid
+	for _, k := range keys {
+		has, err := bs.blockstore.Has(ctx, k)
+		if err != nil {
+			log.Infof("blockstore.Has error: %s", err)
+		}
+		if has {
+			have = append(have, k)
+		} else {
+			missing = append(missing, k)
+		}
+	}
+	bs.removeWants(have)
+	if len(missing) == 0 {
+		return
+	}
+
+	log.Infof("resuming %d persisted wants", len(missing))
+	session := bs.sm.NewSession(ctx, bs.provSearchDelay, bs.rebroadcastDelay)
+	blks, err := session.GetBlocks(ctx, missing)
+	if err != nil {
+		log.Warnf("failed to resume persisted wants: %s", err)
+		if !bs.shuttingDown() {
+			bs.removeWants(missing)
+		}
+		return
+	}
+	remaining := cid.NewSet()
+	for _, k := range missing {
+		remaining.Add(k)
+	}
+	for b := range blks {
+		if err := bs.blockstore.Put(ctx, b); err != nil {
+			log.Warnf("failed to store resumed block %s: %s", b.Cid(), err)
+			continue
+		}
+		if remaining.Has(b.Cid()) {
+			remaining.Remove(b.Cid())
+			bs.removeWants([]cid.Cid{b.Cid()})
+		}
+	}
+	// Like the wants of a request, the wants that were not resumed are
+	// released, unless the client is shutting down.
+	if remaining.Len() > 0 && !bs.shuttingDown() {
+		bs.removeWants(remaining.Keys())
+	}
+}
+
+func (bs *Client) removeWants(keys []cid.Cid) {
+	if err := bs.wantPersister.Remove(context.Background(), keys); err != nil {
+		log.Warnf("failed to remove persisted wants: %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	testinstance "github.com/ipfs/boxo/bitswap/testinstance"
+	mockrouting "github.com/ipfs/boxo/routing/mock"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-test/random"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistedWantsAreCounted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	ig := testinstance.NewTestInstanceGenerator(getVirtualNetwork(), mockrouting.NewServer(), nil, []bitswap.Option{bitswap.WithWantlistPersistence(ds)})
+	defer ig.Close()
+	inst := ig.Next()
+
+	block := random.BlocksOfSize(1, blockSize)[0]
+	key := datastore.NewKey("/bitswap/wantlist/" + block.Cid().String())
+	isPersisted := func() bool {
+		has, err := ds.Has(ctx, key)
+		require.NoError(t, err)
+		return has
+	}
+
+	// Two requests want the same block, which no peer has.
+	ctx1, cancel1 := context.WithCancel(ctx)
+	out1, err := inst.Exchange.NewSession(ctx1).GetBlocks(ctx1, []cid.Cid{block.Cid()})
+	require.NoError(t, err)
+	ctx2, cancel2 := context.WithCancel(ctx)
+	out2, err := inst.Exchange.NewSession(ctx2).GetBlocks(ctx2, []cid.Cid{block.Cid()})
+	require.NoError(t, err)
+	require.True(t, isPersisted())
+
+	// The want is kept while the second request is outstanding.
+	cancel1()
+	drain(out1)
+	require.True(t, isPersisted())
+
+	cancel2()
+	drain(out2)
+	require.Eventually(t, func() bool { return !isPersisted() }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPersistedWantsSurviveShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	ig := testinstance.NewTestInstanceGenerator(getVirtualNetwork(), mockrouting.NewServer(), nil, []bitswap.Option{bitswap.WithWantlistPersistence(ds)})
+	defer ig.Close()
+	inst := ig.Next()
+
+	block := random.BlocksOfSize(1, blockSize)[0]
+	key := datastore.NewKey("/bitswap/wantlist/" + block.Cid().String())
+
+	// A graceful shutdown cancels the requests, and then closes the client.
+	reqCtx, reqCancel := context.WithCancel(ctx)
+	out, err := inst.Exchange.NewSession(reqCtx).GetBlocks(reqCtx, []cid.Cid{block.Cid()})
+	require.NoError(t, err)
+	reqCancel()
+	drain(out)
+	require.NoError(t, inst.Exchange.Close())
+
+	time.Sleep(2 * time.Second)
+	has, err := ds.Has(ctx, key)
+	require.NoError(t, err)
+	require.True(t, has, "the want must be kept for the next run")
+}
+
+func drain(ch <-chan blocks.Block) {
+	for range ch {
+	}
+}
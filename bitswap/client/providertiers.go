@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProviderTier is a source of providers of a tiered [ProviderFinder].
+type ProviderTier struct {
+	// Finder finds the providers of this tier.
+	Finder ProviderFinder
+
+	// Timeout, if positive, bounds the time spent looking for providers in
+	// this tier before moving on to the next one.
+	Timeout time.Duration
+}
+
+// NewTieredProviderFinder returns a [ProviderFinder] looking for providers in
+// the given tiers by order of priority, for example the peers already
+// connected, then the peers on the local network, and then the DHT. A tier is
+// only queried once the previous ones are done, or timed out, and found fewer
+// providers than requested. Providers found by several tiers are returned
+// once.
+//
+// It can be passed to [New] to let sessions use it when they look for more
+// providers.
+func NewTieredProviderFinder(tiers ...ProviderTier) ProviderFinder {
+	return &tieredProviderFinder{tiers: tiers}
+}
+
+type tieredProviderFinder struct {
+	tiers []ProviderTier
+}
+
+func (f *tieredProviderFinder) FindProvidersAsync(ctx context.Context, k cid.Cid, count int) <-chan peer.AddrInfo {
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+
+		seen := make(map[peer.ID]struct{})
+		for _, tier := range f.tiers {
+			if !findInTier(ctx, tier, k, count, seen, out) {
+				return
+			}
+			if count > 0 && len(seen) >= count {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// findInTier sends the new providers found in tier to out, until count
+// providers have been found in total. It returns false if ctx is done.
+func findInTier(ctx context.Context, tier ProviderTier, k cid.Cid, count int, seen map[peer.ID]struct{}, out chan<- peer.AddrInfo) bool {
+	var tierCtx context.Context
+	var cancel context.CancelFunc
+	if tier.Timeout > 0 {
+		tierCtx, cancel = context.WithTimeout(ctx, tier.Timeout)
+	} else {
+		tierCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// Tiers may find the providers of the previous ones again, so they are
+	// all asked for count providers.
+	for p := range tier.Finder.FindProvidersAsync(tierCtx, k, count) {
+		if _, ok := seen[p.ID]; ok {
+			continue
+		}
+		seen[p.ID] = struct{}{}
+		select {
+		case out <- p:
+		case <-ctx.Done():
+			return false
+		}
+		if count > 0 && len(seen) >= count {
+			break
+		}
+	}
+	return ctx.Err() == nil
+}
@@ -0,0 +1,73 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap/client"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-test/random"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// staticProviderFinder returns its providers, then blocks until the context
+// is done if hang is set.
+type staticProviderFinder struct {
+	providers []peer.ID
+	hang      bool
+	queried   int
+}
+
+func (f *staticProviderFinder) FindProvidersAsync(ctx context.Context, _ cid.Cid, count int) <-chan peer.AddrInfo {
+	f.queried++
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		for i, p := range f.providers {
+			if count > 0 && i >= count {
+				return
+			}
+			select {
+			case out <- peer.AddrInfo{ID: p}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if f.hang {
+			<-ctx.Done()
+		}
+	}()
+	return out
+}
+
+func TestTieredProviderFinder(t *testing.T) {
+	peers := random.Peers(4)
+	connected := &staticProviderFinder{providers: peers[:1]}
+	local := &staticProviderFinder{providers: []peer.ID{peers[0], peers[1]}, hang: true}
+	dht := &staticProviderFinder{providers: peers[2:]}
+	pf := client.NewTieredProviderFinder(
+		client.ProviderTier{Finder: connected},
+		client.ProviderTier{Finder: local, Timeout: 50 * time.Millisecond},
+		client.ProviderTier{Finder: dht},
+	)
+
+	find := func(count int) []peer.ID {
+		var found []peer.ID
+		for p := range pf.FindProvidersAsync(context.Background(), random.Cids(1)[0], count) {
+			found = append(found, p.ID)
+		}
+		return found
+	}
+
+	// The providers are returned by order of priority, once.
+	require.Equal(t, peers, find(0))
+	require.Equal(t, 1, dht.queried)
+
+	// Lower tiers are not queried once enough providers are found.
+	require.Equal(t, peers[:2], find(2))
+	require.Equal(t, 1, dht.queried)
+	require.Equal(t, peers[:1], find(1))
+	require.Equal(t, 2, local.queried)
+}
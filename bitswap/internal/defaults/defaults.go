@@ -35,4 +35,13 @@ const (
 
 	// DefaultWantHaveReplaceSize controls the implicit behavior of WithWantHaveReplaceSize.
 	DefaultWantHaveReplaceSize = 1024
+
+	// SessionPeerTagPrefix prefixes the connection manager tags of the peers
+	// of a session, followed by the ID of the session.
+	SessionPeerTagPrefix = "bs-ses-"
+
+	// DuplicateWantClaimTimeout is a suggested time after which a session
+	// waiting for the block requested by another session requests it itself,
+	// see client.WithDuplicateWantSuppression.
+	DuplicateWantClaimTimeout = time.Second
 )
@@ -0,0 +1,21 @@
+package internal
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type sessionDialsKey struct{}
+
+// ContextWithSessionDials returns a context whose dials to new peers, made by
+// the bitswap network on behalf of a session, are counted in dials.
+func ContextWithSessionDials(ctx context.Context, dials *atomic.Int64) context.Context {
+	return context.WithValue(ctx, sessionDialsKey{}, dials)
+}
+
+// SessionDials returns the counter of the dials of the session of ctx, or nil
+// if ctx is not the context of a session.
+func SessionDials(ctx context.Context) *atomic.Int64 {
+	dials, _ := ctx.Value(sessionDialsKey{}).(*atomic.Int64)
+	return dials
+}
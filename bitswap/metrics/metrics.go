@@ -44,3 +44,11 @@ func PendingBlocksGauge(ctx context.Context) metrics.Gauge {
 func ActiveBlocksGauge(ctx context.Context) metrics.Gauge {
 	return metrics.NewCtx(ctx, "active_block_tasks", "Total number of active blockstore tasks").Gauge()
 }
+
+func OutboundQueueBytesGauge(ctx context.Context) metrics.Gauge {
+	return metrics.NewCtx(ctx, "outbound_queue_bytes", "Total size of the blocks loaded for outgoing messages that are not sent yet").Gauge()
+}
+
+func OutboundQueueDropsCounter(ctx context.Context) metrics.Counter {
+	return metrics.NewCtx(ctx, "outbound_queue_drops_total", "Number of outgoing messages whose blocks were dropped because the outbound queue memory was full").Counter()
+}
@@ -0,0 +1,252 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/klauspost/compress/zstd"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-msgio"
+)
+
+// DefaultCompressionThreshold is the size, in bytes, from which messages are
+// compressed when [Compression] is enabled with a threshold of 0.
+const DefaultCompressionThreshold = 1024
+
+const (
+	// minCompressionRatio is the ratio under which compressing the messages
+	// sent to a peer is not worth the CPU time.
+	minCompressionRatio = 1.1
+
+	// compressionProbeInterval is the number of messages sent uncompressed
+	// to a peer with a poor ratio before trying compressing again, in case
+	// the content exchanged changed.
+	compressionProbeInterval = 32
+
+	// compressionRatioWeight is the weight of the last message in the
+	// moving average of the ratio of a peer.
+	compressionRatioWeight = 0.25
+)
+
+// Flags starting the frames of the zstd protocol.
+const (
+	frameUncompressed byte = 0
+	frameZstd         byte = 1
+)
+
+// compressor compresses and decompresses the messages of the
+// [ProtocolBitswapZstd] protocol. Each message is framed by its varint
+// length, like on the other protocols, followed by a flag telling whether the
+// protobuf message is compressed.
+type compressor struct {
+	threshold int
+	filter    func(peer.ID) bool
+
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+
+	mu    sync.Mutex
+	peers map[peer.ID]*peerCompression
+
+	messagesCompressed   atomic.Uint64
+	messagesDecompressed atomic.Uint64
+	bytesUncompressed    atomic.Uint64
+	bytesCompressed      atomic.Uint64
+	compressionTime      atomic.Int64
+	decompressionTime    atomic.Int64
+}
+
+// peerCompression is the per-peer state of the compression decision.
+type peerCompression struct {
+	ratio   float64
+	skipped int
+}
+
+func newCompressor(threshold int, filter func(peer.ID) bool) (*compressor, error) {
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(network.MessageSizeMax))
+	if err != nil {
+		return nil, err
+	}
+	return &compressor{
+		threshold: threshold,
+		filter:    filter,
+		enc:       enc,
+		dec:       dec,
+		peers:     make(map[peer.ID]*peerCompression),
+	}, nil
+}
+
+// shouldCompress returns true if a message of the given size sent to p should
+// be compressed.
+func (c *compressor) shouldCompress(p peer.ID, size int) bool {
+	if size < c.threshold {
+		return false
+	}
+	if c.filter != nil && !c.filter(p) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc, ok := c.peers[p]
+	if !ok || pc.ratio >= minCompressionRatio {
+		return true
+	}
+	pc.skipped++
+	if pc.skipped < compressionProbeInterval {
+		return false
+	}
+	pc.skipped = 0
+	return true
+}
+
+// record updates the compression ratio of the messages sent to p.
+func (c *compressor) record(p peer.ID, uncompressed, compressed int) {
+	ratio := float64(uncompressed) / float64(compressed)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc, ok := c.peers[p]
+	if !ok {
+		c.peers[p] = &peerCompression{ratio: ratio}
+		return
+	}
+	pc.ratio = (1-compressionRatioWeight)*pc.ratio + compressionRatioWeight*ratio
+}
+
+// forget drops the state of p, once it is disconnected.
+func (c *compressor) forget(p peer.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.peers, p)
+}
+
+// write writes msg to w, compressed if it is worth it.
+func (c *compressor) write(w io.Writer, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	data, err := msg.ToProtoV1().Marshal()
+	if err != nil {
+		return err
+	}
+
+	flag := frameUncompressed
+	if c.shouldCompress(p, len(data)) {
+		start := time.Now()
+		compressed := c.enc.EncodeAll(data, make([]byte, 0, len(data)))
+		c.compressionTime.Add(int64(time.Since(start)))
+		c.messagesCompressed.Add(1)
+		c.bytesUncompressed.Add(uint64(len(data)))
+		c.bytesCompressed.Add(uint64(len(compressed)))
+		c.record(p, len(data), len(compressed))
+
+		if len(compressed) < len(data) {
+			flag = frameZstd
+			data = compressed
+		}
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64+1+len(data))
+	n := binary.PutUvarint(buf, uint64(1+len(data)))
+	buf[n] = flag
+	n++
+	n += copy(buf[n:], data)
+	_, err = w.Write(buf[:n])
+	return err
+}
+
+// reader returns a [msgio.Reader] reading the decompressed messages of r.
+func (c *compressor) reader(r msgio.Reader) msgio.Reader {
+	return &decompressingReader{Reader: r, c: c}
+}
+
+type decompressingReader struct {
+	msgio.Reader
+	c *compressor
+}
+
+func (r *decompressingReader) ReadMsg() ([]byte, error) {
+	frame, err := r.Reader.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Reader.ReleaseMsg(frame)
+
+	if len(frame) == 0 {
+		return nil, errors.New("empty bitswap message frame")
+	}
+	switch frame[0] {
+	case frameUncompressed:
+		return append([]byte(nil), frame[1:]...), nil
+	case frameZstd:
+		start := time.Now()
+		data, err := r.c.dec.DecodeAll(frame[1:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing bitswap message: %w", err)
+		}
+		r.c.decompressionTime.Add(int64(time.Since(start)))
+		r.c.messagesDecompressed.Add(1)
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown bitswap message frame flag %d", frame[0])
+	}
+}
+
+// ReleaseMsg does nothing, as decompressed messages are not pooled.
+func (r *decompressingReader) ReleaseMsg([]byte) {}
+
+// stats returns the compression statistics.
+func (c *compressor) stats() CompressionStats {
+	return CompressionStats{
+		MessagesCompressed:   c.messagesCompressed.Load(),
+		MessagesDecompressed: c.messagesDecompressed.Load(),
+		BytesUncompressed:    c.bytesUncompressed.Load(),
+		BytesCompressed:      c.bytesCompressed.Load(),
+		CompressionTime:      time.Duration(c.compressionTime.Load()),
+		DecompressionTime:    time.Duration(c.decompressionTime.Load()),
+	}
+}
+
+// CompressionStats are the statistics of the compression of the messages, see
+// [Compression].
+type CompressionStats struct {
+	// MessagesCompressed is the number of sent messages which were
+	// compressed, including the ones sent uncompressed because compressing
+	// them did not make them smaller.
+	MessagesCompressed uint64
+	// MessagesDecompressed is the number of received messages which were
+	// decompressed.
+	MessagesDecompressed uint64
+	// BytesUncompressed and BytesCompressed are the sizes of the compressed
+	// messages, before and after compression. Their ratio is the compression
+	// ratio.
+	BytesUncompressed uint64
+	BytesCompressed   uint64
+	// CompressionTime and DecompressionTime are the CPU time spent
+	// compressing and decompressing messages.
+	CompressionTime   time.Duration
+	DecompressionTime time.Duration
+}
+
+// Ratio returns the compression ratio of the compressed messages, or 0 if no
+// message was compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.BytesCompressed == 0 {
+		return 0
+	}
+	return float64(s.BytesUncompressed) / float64(s.BytesCompressed)
+}
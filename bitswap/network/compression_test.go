@@ -0,0 +1,94 @@
+package network
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-test/random"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-msgio"
+	"github.com/stretchr/testify/require"
+)
+
+func roundTrip(t *testing.T, c *compressor, p peer.ID, msg bsmsg.BitSwapMessage) (bsmsg.BitSwapMessage, byte) {
+	var buf bytes.Buffer
+	require.NoError(t, c.write(&buf, p, msg))
+
+	frame, err := msgio.NewVarintReaderSize(bytes.NewReader(buf.Bytes()), network.MessageSizeMax).ReadMsg()
+	require.NoError(t, err)
+
+	received, err := bsmsg.FromMsgReader(c.reader(msgio.NewVarintReaderSize(&buf, network.MessageSizeMax)))
+	require.NoError(t, err)
+	return received, frame[0]
+}
+
+func TestCompression(t *testing.T) {
+	p := peer.ID("peer")
+	compressible := blocks.NewBlock([]byte(strings.Repeat(`{"hello": "world"}`, 1000)))
+
+	t.Run("Compresses large messages", func(t *testing.T) {
+		c, err := newCompressor(0, nil)
+		require.NoError(t, err)
+
+		msg := bsmsg.New(false)
+		msg.AddBlock(compressible)
+		received, flag := roundTrip(t, c, p, msg)
+		require.Equal(t, frameZstd, flag)
+		require.Equal(t, []blocks.Block{compressible}, received.Blocks())
+
+		st := c.stats()
+		require.EqualValues(t, 1, st.MessagesCompressed)
+		require.EqualValues(t, 1, st.MessagesDecompressed)
+		require.Greater(t, st.Ratio(), 3.0)
+	})
+
+	t.Run("Does not compress small messages", func(t *testing.T) {
+		c, err := newCompressor(0, nil)
+		require.NoError(t, err)
+
+		msg := bsmsg.New(false)
+		msg.AddBlock(blocks.NewBlock([]byte("small")))
+		_, flag := roundTrip(t, c, p, msg)
+		require.Equal(t, frameUncompressed, flag)
+		require.Zero(t, c.stats().MessagesCompressed)
+	})
+
+	t.Run("Filters peers", func(t *testing.T) {
+		c, err := newCompressor(0, func(peer.ID) bool { return false })
+		require.NoError(t, err)
+
+		msg := bsmsg.New(false)
+		msg.AddBlock(compressible)
+		_, flag := roundTrip(t, c, p, msg)
+		require.Equal(t, frameUncompressed, flag)
+	})
+
+	t.Run("Disables compression for incompressible content", func(t *testing.T) {
+		c, err := newCompressor(0, nil)
+		require.NoError(t, err)
+
+		msg := bsmsg.New(false)
+		msg.AddBlock(blocks.NewBlock(random.Bytes(4096)))
+		_, flag := roundTrip(t, c, p, msg)
+		require.Equal(t, frameUncompressed, flag)
+		require.EqualValues(t, 1, c.stats().MessagesCompressed)
+
+		// The next messages are not compressed until the next probe.
+		for i := 0; i < compressionProbeInterval-1; i++ {
+			roundTrip(t, c, p, msg)
+		}
+		require.EqualValues(t, 1, c.stats().MessagesCompressed)
+		roundTrip(t, c, p, msg)
+		require.EqualValues(t, 2, c.stats().MessagesCompressed)
+
+		// Other peers are not affected.
+		msg = bsmsg.New(false)
+		msg.AddBlock(compressible)
+		_, flag = roundTrip(t, c, peer.ID("other"), msg)
+		require.Equal(t, frameZstd, flag)
+	})
+}
@@ -0,0 +1,257 @@
+package network
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap/internal/defaults"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// DefaultSessionPeerActiveWeight is the connection manager tag weight of
+	// the session peers sending messages, see [SessionPeerWeights].
+	DefaultSessionPeerActiveWeight = 5
+	// DefaultSessionPeerIdleWeight is the connection manager tag weight of
+	// the idle session peers, see [SessionPeerWeights].
+	DefaultSessionPeerIdleWeight = 1
+	// DefaultSessionPeerIdleTimeout is the time after which a session peer
+	// that sent no message is idle, see [SessionPeerWeights].
+	DefaultSessionPeerIdleTimeout = 30 * time.Second
+)
+
+// sessionConnManager is the connection manager of the host, whose tags of
+// the peers of bitswap sessions are weighted according to the activity of
+// the peers, and limited per session.
+type sessionConnManager struct {
+	connmgr.ConnManager
+
+	activeWeight int
+	idleWeight   int
+	idleTimeout  time.Duration
+	budget       int
+
+	lk sync.Mutex
+	// sessions are the peers tagged by each session, by tag, and whether
+	// the session protects them.
+	sessions map[string]map[peer.ID]bool
+	peers    map[peer.ID]*sessionPeer
+	stop     chan struct{}
+}
+
+// sessionPeer is the activity of a peer of one or more sessions.
+type sessionPeer struct {
+	lastActive time.Time
+	idle       bool
+	sessions   int
+}
+
+func newSessionConnManager(inner connmgr.ConnManager, s Settings) *sessionConnManager {
+	cm := &sessionConnManager{
+		ConnManager:  inner,
+		activeWeight: s.SessionPeerActiveWeight,
+		idleWeight:   s.SessionPeerIdleWeight,
+		idleTimeout:  s.SessionPeerIdleTimeout,
+		budget:       s.SessionPeerBudget,
+		sessions:     make(map[string]map[peer.ID]bool),
+		peers:        make(map[peer.ID]*sessionPeer),
+	}
+	if cm.idleTimeout <= 0 {
+		cm.idleTimeout = DefaultSessionPeerIdleTimeout
+	}
+	return cm
+}
+
+func isSessionTag(tag string) bool {
+	return strings.HasPrefix(tag, defaults.SessionPeerTagPrefix)
+}
+
+// TagPeer tags the peers of sessions with the weight of their activity,
+// rather than value, and evicts the idlest unprotected peer of a session
+// over its budget. The peer is not tagged if all the others are protected.
+func (cm *sessionConnManager) TagPeer(p peer.ID, tag string, value int) {
+	if !isSessionTag(tag) {
+		cm.ConnManager.TagPeer(p, tag, value)
+		return
+	}
+
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	set, ok := cm.sessions[tag]
+	if !ok {
+		set = make(map[peer.ID]bool)
+		cm.sessions[tag] = set
+	}
+	if _, ok := set[p]; !ok {
+		if cm.budget > 0 && len(set) >= cm.budget && !cm.evictLocked(tag, set) {
+			log.Debugw("session peer budget exhausted", "tag", tag, "peer", p)
+			return
+		}
+		set[p] = false
+		sp, ok := cm.peers[p]
+		if !ok {
+			sp = &sessionPeer{lastActive: time.Now()}
+			cm.peers[p] = sp
+		}
+		sp.sessions++
+	}
+	cm.ConnManager.TagPeer(p, tag, cm.weight(cm.peers[p]))
+}
+
+func (cm *sessionConnManager) UntagPeer(p peer.ID, tag string) {
+	if isSessionTag(tag) {
+		cm.lk.Lock()
+		cm.removeLocked(p, tag)
+		cm.lk.Unlock()
+	}
+	cm.ConnManager.UntagPeer(p, tag)
+}
+
+func (cm *sessionConnManager) Protect(p peer.ID, tag string) {
+	if isSessionTag(tag) {
+		cm.lk.Lock()
+		if set, ok := cm.sessions[tag]; ok {
+			if _, ok := set[p]; ok {
+				set[p] = true
+			}
+		}
+		cm.lk.Unlock()
+	}
+	cm.ConnManager.Protect(p, tag)
+}
+
+func (cm *sessionConnManager) Unprotect(p peer.ID, tag string) bool {
+	if isSessionTag(tag) {
+		cm.lk.Lock()
+		if set, ok := cm.sessions[tag]; ok {
+			if _, ok := set[p]; ok {
+				set[p] = false
+			}
+		}
+		cm.lk.Unlock()
+	}
+	return cm.ConnManager.Unprotect(p, tag)
+}
+
+// evictLocked untags the unprotected peer of the session that was idle for
+// the longest time. It returns false if there is none.
+func (cm *sessionConnManager) evictLocked(tag string, set map[peer.ID]bool) bool {
+	var victim peer.ID
+	var lastActive time.Time
+	for p, protected := range set {
+		if protected {
+			continue
+		}
+		if sp := cm.peers[p]; victim == "" || sp.lastActive.Before(lastActive) {
+			victim, lastActive = p, sp.lastActive
+		}
+	}
+	if victim == "" {
+		return false
+	}
+	log.Debugw("evicting idle session peer", "tag", tag, "peer", victim)
+	cm.removeLocked(victim, tag)
+	cm.ConnManager.UntagPeer(victim, tag)
+	return true
+}
+
+func (cm *sessionConnManager) removeLocked(p peer.ID, tag string) {
+	set, ok := cm.sessions[tag]
+	if !ok {
+		return
+	}
+	if _, ok := set[p]; !ok {
+		return
+	}
+	delete(set, p)
+	if len(set) == 0 {
+		delete(cm.sessions, tag)
+	}
+	sp := cm.peers[p]
+	sp.sessions--
+	if sp.sessions == 0 {
+		delete(cm.peers, p)
+	}
+}
+
+func (cm *sessionConnManager) weight(sp *sessionPeer) int {
+	if sp.idle {
+		return cm.idleWeight
+	}
+	return cm.activeWeight
+}
+
+// touch records that p sent a message, which makes it active again if it
+// was idle.
+func (cm *sessionConnManager) touch(p peer.ID) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	sp, ok := cm.peers[p]
+	if !ok {
+		return
+	}
+	sp.lastActive = time.Now()
+	if !sp.idle {
+		return
+	}
+	sp.idle = false
+	cm.retagLocked(map[peer.ID]struct{}{p: {}})
+}
+
+// refresh lowers the weight of the session peers that became idle, so that
+// the connection manager trims them first.
+func (cm *sessionConnManager) refresh() {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	idleSince := time.Now().Add(-cm.idleTimeout)
+	changed := make(map[peer.ID]struct{})
+	for p, sp := range cm.peers {
+		if !sp.idle && sp.lastActive.Before(idleSince) {
+			sp.idle = true
+			changed[p] = struct{}{}
+		}
+	}
+	if len(changed) != 0 {
+		cm.retagLocked(changed)
+	}
+}
+
+// retagLocked updates the tags of the peers in the sessions tagging them.
+func (cm *sessionConnManager) retagLocked(peers map[peer.ID]struct{}) {
+	for tag, set := range cm.sessions {
+		for p := range peers {
+			if _, ok := set[p]; ok {
+				cm.ConnManager.TagPeer(p, tag, cm.weight(cm.peers[p]))
+			}
+		}
+	}
+}
+
+// start refreshes the weights of the session peers until close is called.
+func (cm *sessionConnManager) start() {
+	cm.stop = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(cm.idleTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cm.refresh()
+			case <-stop:
+				return
+			}
+		}
+	}(cm.stop)
+}
+
+func (cm *sessionConnManager) close() {
+	if cm.stop != nil {
+		close(cm.stop)
+		cm.stop = nil
+	}
+}
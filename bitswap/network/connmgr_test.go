@@ -0,0 +1,118 @@
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// recordingConnMgr records the tags of the peers.
+type recordingConnMgr struct {
+	connmgr.NullConnMgr
+	lk   sync.Mutex
+	tags map[peer.ID]map[string]int
+}
+
+func (cm *recordingConnMgr) TagPeer(p peer.ID, tag string, value int) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	if cm.tags[p] == nil {
+		cm.tags[p] = make(map[string]int)
+	}
+	cm.tags[p][tag] = value
+}
+
+func (cm *recordingConnMgr) UntagPeer(p peer.ID, tag string) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	delete(cm.tags[p], tag)
+}
+
+func (cm *recordingConnMgr) tag(p peer.ID, tag string) (int, bool) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	v, ok := cm.tags[p][tag]
+	return v, ok
+}
+
+func newTestSessionConnManager(opts ...NetOpt) (*sessionConnManager, *recordingConnMgr) {
+	inner := &recordingConnMgr{tags: make(map[peer.ID]map[string]int)}
+	return newSessionConnManager(inner, processSettings(opts...)), inner
+}
+
+func TestSessionPeerWeights(t *testing.T) {
+	cm, inner := newTestSessionConnManager(SessionPeerWeights(10, 2, time.Minute))
+	p := peer.ID("peer")
+
+	cm.TagPeer(p, "other", 7)
+	cm.TagPeer(p, "bs-ses-1", 5)
+	cm.TagPeer(p, "bs-ses-2", 5)
+	if v, _ := inner.tag(p, "other"); v != 7 {
+		t.Fatalf("other tag is %d, expected 7", v)
+	}
+	if v, _ := inner.tag(p, "bs-ses-1"); v != 10 {
+		t.Fatalf("session tag is %d, expected the active weight", v)
+	}
+
+	cm.lk.Lock()
+	cm.peers[p].lastActive = time.Now().Add(-2 * time.Minute)
+	cm.lk.Unlock()
+	cm.refresh()
+	for _, tag := range []string{"bs-ses-1", "bs-ses-2"} {
+		if v, _ := inner.tag(p, tag); v != 2 {
+			t.Fatalf("%s tag is %d, expected the idle weight", tag, v)
+		}
+	}
+
+	cm.touch(p)
+	if v, _ := inner.tag(p, "bs-ses-2"); v != 10 {
+		t.Fatalf("session tag is %d, expected the active weight", v)
+	}
+
+	cm.UntagPeer(p, "bs-ses-1")
+	cm.UntagPeer(p, "bs-ses-2")
+	if len(cm.peers) != 0 || len(cm.sessions) != 0 {
+		t.Fatal("untagged peers are still tracked")
+	}
+}
+
+func TestSessionPeerBudget(t *testing.T) {
+	cm, inner := newTestSessionConnManager(SessionPeerBudget(2))
+	tag := "bs-ses-1"
+	idle, active, protected := peer.ID("idle"), peer.ID("active"), peer.ID("protected")
+
+	cm.TagPeer(idle, tag, 5)
+	cm.TagPeer(active, tag, 5)
+	cm.lk.Lock()
+	cm.peers[idle].lastActive = time.Now().Add(-time.Minute)
+	cm.lk.Unlock()
+
+	// The idlest peer makes room for the new one.
+	cm.TagPeer(protected, tag, 5)
+	cm.Protect(protected, tag)
+	if _, ok := inner.tag(idle, tag); ok {
+		t.Fatal("idle peer was not evicted")
+	}
+	if v, ok := inner.tag(active, tag); !ok || v != DefaultSessionPeerActiveWeight {
+		t.Fatalf("active peer tag is %d, expected %d", v, DefaultSessionPeerActiveWeight)
+	}
+
+	// Protected peers are not evicted.
+	cm.Protect(active, tag)
+	cm.TagPeer(idle, tag, 5)
+	if _, ok := inner.tag(idle, tag); ok {
+		t.Fatal("peer over budget was tagged")
+	}
+	if _, ok := inner.tag(protected, tag); !ok {
+		t.Fatal("protected peer was evicted")
+	}
+
+	// Other sessions have their own budget.
+	cm.TagPeer(idle, "bs-ses-2", 5)
+	if _, ok := inner.tag(idle, "bs-ses-2"); !ok {
+		t.Fatal("peer of another session was not tagged")
+	}
+}
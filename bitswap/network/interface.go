@@ -23,6 +23,9 @@ var (
 	ProtocolBitswapOneOne = internal.ProtocolBitswapOneOne
 	// ProtocolBitswap is the current version of the bitswap protocol: 1.2.0
 	ProtocolBitswap = internal.ProtocolBitswap
+	// ProtocolBitswapZstd is version 1.2.0 with zstd compressed messages, see
+	// [Compression]
+	ProtocolBitswapZstd = internal.ProtocolBitswapZstd
 )
 
 // BitSwapNetwork provides network connectivity for BitSwap sessions.
@@ -106,4 +109,7 @@ type Pinger interface {
 type Stats struct {
 	MessagesSent  uint64
 	MessagesRecvd uint64
+
+	// Compression is only set with [Compression].
+	Compression CompressionStats
 }
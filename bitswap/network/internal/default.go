@@ -13,6 +13,8 @@ var (
 	ProtocolBitswapOneOne protocol.ID = "/ipfs/bitswap/1.1.0"
 	// ProtocolBitswap is the current version of the bitswap protocol: 1.2.0
 	ProtocolBitswap protocol.ID = "/ipfs/bitswap/1.2.0"
+	// ProtocolBitswapZstd is version 1.2.0 with zstd compressed messages
+	ProtocolBitswapZstd protocol.ID = "/ipfs/bitswap/1.2.0+zstd"
 )
 
 var DefaultProtocols = []protocol.ID{
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"sync/atomic"
 	"time"
 
+	bsinternal "github.com/ipfs/boxo/bitswap/internal"
 	bsmsg "github.com/ipfs/boxo/bitswap/message"
 	"github.com/ipfs/boxo/bitswap/network/internal"
 
@@ -25,6 +27,10 @@ import (
 
 var log = logging.Logger("bitswap/network")
 
+// ErrSessionDialBudget is returned by the dials of a session over the budget
+// set with [SessionDialBudget].
+var ErrSessionDialBudget = errors.New("bitswap session dial budget exhausted")
+
 var (
 	maxSendTimeout = 2 * time.Minute
 	minSendTimeout = 10 * time.Second
@@ -43,18 +49,47 @@ func NewFromIpfsHost(host host.Host, opts ...NetOpt) BitSwapNetwork {
 		protocolBitswapOneZero: s.ProtocolPrefix + ProtocolBitswapOneZero,
 		protocolBitswapOneOne:  s.ProtocolPrefix + ProtocolBitswapOneOne,
 		protocolBitswap:        s.ProtocolPrefix + ProtocolBitswap,
+		protocolBitswapZstd:    s.ProtocolPrefix + ProtocolBitswapZstd,
 
 		supportedProtocols: s.SupportedProtocols,
+		dialBudget:         s.SessionDialBudget,
+	}
+
+	if s.Compression {
+		c, err := newCompressor(s.CompressionThreshold, s.CompressionFilter)
+		if err != nil {
+			log.Errorf("disabling bitswap compression: %s", err)
+			bitswapNetwork.supportedProtocols = slices.DeleteFunc(bitswapNetwork.supportedProtocols, func(p protocol.ID) bool {
+				return p == bitswapNetwork.protocolBitswapZstd
+			})
+		} else {
+			bitswapNetwork.compressor = c
+		}
+	}
+
+	if s.SessionPeerTagging {
+		bitswapNetwork.connMgr = newSessionConnManager(host.ConnManager(), s)
 	}
 
 	return &bitswapNetwork
 }
 
 func processSettings(opts ...NetOpt) Settings {
-	s := Settings{SupportedProtocols: append([]protocol.ID(nil), internal.DefaultProtocols...)}
+	s := Settings{
+		SupportedProtocols:      append([]protocol.ID(nil), internal.DefaultProtocols...),
+		SessionPeerActiveWeight: DefaultSessionPeerActiveWeight,
+		SessionPeerIdleWeight:   DefaultSessionPeerIdleWeight,
+	}
 	for _, opt := range opts {
 		opt(&s)
 	}
+	// The zstd protocol is only supported, and preferred, with compression.
+	s.SupportedProtocols = slices.DeleteFunc(slices.Clone(s.SupportedProtocols), func(p protocol.ID) bool {
+		return p == internal.ProtocolBitswapZstd
+	})
+	if s.Compression {
+		s.SupportedProtocols = append([]protocol.ID{internal.ProtocolBitswapZstd}, s.SupportedProtocols...)
+	}
 	for i, proto := range s.SupportedProtocols {
 		s.SupportedProtocols[i] = s.ProtocolPrefix + proto
 	}
@@ -75,9 +110,21 @@ type impl struct {
 	protocolBitswapOneZero protocol.ID
 	protocolBitswapOneOne  protocol.ID
 	protocolBitswap        protocol.ID
+	protocolBitswapZstd    protocol.ID
 
 	supportedProtocols []protocol.ID
 
+	// compressor is only set with the Compression option.
+	compressor *compressor
+
+	// connMgr is only set with the SessionPeerWeights and SessionPeerBudget
+	// options.
+	connMgr *sessionConnManager
+
+	// dialBudget is the number of dials allowed per session, see
+	// SessionDialBudget.
+	dialBudget int
+
 	// inbound messages from the network are forwarded to the receiver
 	receivers []Receiver
 }
@@ -295,6 +342,11 @@ func (bsnet *impl) msgToStream(ctx context.Context, s network.Stream, msg bsmsg.
 	// to convert the message to the appropriate format depending on the remote
 	// peer's Bitswap version.
 	switch s.Protocol() {
+	case bsnet.protocolBitswapZstd:
+		if err := bsnet.compressor.write(s, s.Conn().RemotePeer(), msg); err != nil {
+			log.Debugf("error: %s", err)
+			return err
+		}
 	case bsnet.protocolBitswapOneOne, bsnet.protocolBitswap:
 		if err := msg.ToNetV1(s); err != nil {
 			log.Debugf("error: %s", err)
@@ -399,9 +451,15 @@ func (bsnet *impl) Start(r ...Receiver) {
 	}
 	bsnet.host.Network().Notify((*netNotifiee)(bsnet))
 	bsnet.connectEvtMgr.Start()
+	if bsnet.connMgr != nil {
+		bsnet.connMgr.start()
+	}
 }
 
 func (bsnet *impl) Stop() {
+	if bsnet.connMgr != nil {
+		bsnet.connMgr.close()
+	}
 	bsnet.connectEvtMgr.Stop()
 	bsnet.host.Network().StopNotify((*netNotifiee)(bsnet))
 }
@@ -410,6 +468,12 @@ func (bsnet *impl) Connect(ctx context.Context, p peer.AddrInfo) error {
 	if p.ID == bsnet.host.ID() {
 		return nil
 	}
+	if bsnet.dialBudget > 0 && bsnet.host.Network().Connectedness(p.ID) != network.Connected {
+		if dials := bsinternal.SessionDials(ctx); dials != nil && dials.Add(1) > int64(bsnet.dialBudget) {
+			log.Debugw("session dial budget exhausted", "peer", p.ID)
+			return ErrSessionDialBudget
+		}
+	}
 	return bsnet.host.Connect(ctx, p)
 }
 
@@ -426,7 +490,10 @@ func (bsnet *impl) handleNewStream(s network.Stream) {
 		return
 	}
 
-	reader := msgio.NewVarintReaderSize(s, network.MessageSizeMax)
+	var reader msgio.Reader = msgio.NewVarintReaderSize(s, network.MessageSizeMax)
+	if s.Protocol() == bsnet.protocolBitswapZstd {
+		reader = bsnet.compressor.reader(reader)
+	}
 	for {
 		received, err := bsmsg.FromMsgReader(reader)
 		if err != nil {
@@ -444,6 +511,7 @@ func (bsnet *impl) handleNewStream(s network.Stream) {
 		ctx := context.Background()
 		log.Debugf("bitswap net handleNewStream from %s", s.Conn().RemotePeer())
 		bsnet.connectEvtMgr.OnMessage(s.Conn().RemotePeer())
+		bsnet.touch(p)
 		atomic.AddUint64(&bsnet.stats.MessagesRecvd, 1)
 		for _, v := range bsnet.receivers {
 			v.ReceiveMessage(ctx, p, received)
@@ -452,14 +520,28 @@ func (bsnet *impl) handleNewStream(s network.Stream) {
 }
 
 func (bsnet *impl) ConnectionManager() connmgr.ConnManager {
+	if bsnet.connMgr != nil {
+		return bsnet.connMgr
+	}
 	return bsnet.host.ConnManager()
 }
 
+// touch records that p sent a message, if it is a session peer.
+func (bsnet *impl) touch(p peer.ID) {
+	if bsnet.connMgr != nil {
+		bsnet.connMgr.touch(p)
+	}
+}
+
 func (bsnet *impl) Stats() Stats {
-	return Stats{
+	st := Stats{
 		MessagesRecvd: atomic.LoadUint64(&bsnet.stats.MessagesRecvd),
 		MessagesSent:  atomic.LoadUint64(&bsnet.stats.MessagesSent),
 	}
+	if bsnet.compressor != nil {
+		st.Compression = bsnet.compressor.stats()
+	}
+	return st
 }
 
 type netNotifiee impl
@@ -484,6 +566,9 @@ func (nn *netNotifiee) Disconnected(n network.Network, v network.Conn) {
 	}
 
 	nn.impl().connectEvtMgr.Disconnected(v.RemotePeer())
+	if c := nn.impl().compressor; c != nil {
+		c.forget(v.RemotePeer())
+	}
 }
 func (nn *netNotifiee) OpenedStream(n network.Network, s network.Stream) {}
 func (nn *netNotifiee) ClosedStream(n network.Network, v network.Stream) {}
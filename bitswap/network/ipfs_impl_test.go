@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	bsinternal "github.com/ipfs/boxo/bitswap/internal"
 	bsmsg "github.com/ipfs/boxo/bitswap/message"
 	pb "github.com/ipfs/boxo/bitswap/message/pb"
 	bsnet "github.com/ipfs/boxo/bitswap/network"
@@ -662,3 +664,47 @@ func TestNetworkCounters(t *testing.T) {
 		testNetworkCounters(t, 10-n, n)
 	}
 }
+
+func TestSessionDialBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New()
+	defer mn.Close()
+	h, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var peers []peer.AddrInfo
+	for i := 0; i < 3; i++ {
+		p, err := mn.GenPeer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers = append(peers, peer.AddrInfo{ID: p.ID(), Addrs: p.Addrs()})
+	}
+	if err = mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	bsn := bsnet.NewFromIpfsHost(h, bsnet.SessionDialBudget(1))
+	sessionCtx := bsinternal.ContextWithSessionDials(ctx, new(atomic.Int64))
+	if err = bsn.Connect(sessionCtx, peers[0]); err != nil {
+		t.Fatal(err)
+	}
+	// Connected peers are not counted.
+	if err = bsn.Connect(sessionCtx, peers[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = bsn.Connect(sessionCtx, peers[1]); !errors.Is(err, bsnet.ErrSessionDialBudget) {
+		t.Fatalf("expected the dial budget to be exhausted, got %v", err)
+	}
+	// The budget is per session, and dials outside sessions are not limited.
+	otherCtx := bsinternal.ContextWithSessionDials(ctx, new(atomic.Int64))
+	if err = bsn.Connect(otherCtx, peers[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = bsn.Connect(ctx, peers[2]); err != nil {
+		t.Fatal(err)
+	}
+}
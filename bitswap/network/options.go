@@ -1,12 +1,31 @@
 package network
 
-import "github.com/libp2p/go-libp2p/core/protocol"
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
 
 type NetOpt func(*Settings)
 
 type Settings struct {
 	ProtocolPrefix     protocol.ID
 	SupportedProtocols []protocol.ID
+
+	Compression          bool
+	CompressionThreshold int
+	CompressionFilter    func(peer.ID) bool
+
+	// SessionPeerTagging is set by [SessionPeerWeights] and
+	// [SessionPeerBudget].
+	SessionPeerTagging      bool
+	SessionPeerActiveWeight int
+	SessionPeerIdleWeight   int
+	SessionPeerIdleTimeout  time.Duration
+	SessionPeerBudget       int
+
+	SessionDialBudget int
 }
 
 func Prefix(prefix protocol.ID) NetOpt {
@@ -20,3 +39,70 @@ func SupportedProtocols(protos []protocol.ID) NetOpt {
 		settings.SupportedProtocols = protos
 	}
 }
+
+// Compression enables the zstd compression of the messages of at least
+// threshold bytes, or [DefaultCompressionThreshold] if threshold is 0, with
+// the peers supporting [ProtocolBitswapZstd], which is preferred over the
+// other protocols.
+//
+// Compression is decided per peer: it is disabled for the peers whose
+// messages do not compress well, and retried from time to time. The CPU time
+// and ratio of the compression are reported in [Stats].
+func Compression(threshold int) NetOpt {
+	return func(settings *Settings) {
+		settings.Compression = true
+		settings.CompressionThreshold = threshold
+	}
+}
+
+// CompressionFilter sets a function deciding if the messages sent to a peer
+// can be compressed, for example to only compress them for the peers behind
+// metered connections. It only applies with [Compression].
+func CompressionFilter(filter func(peer.ID) bool) NetOpt {
+	return func(settings *Settings) {
+		settings.CompressionFilter = filter
+	}
+}
+
+// SessionPeerWeights sets the weights of the connection manager tags of the
+// peers of bitswap sessions: active for the peers that sent messages within
+// idleTimeout, idle for the others, so that the connection manager
+// closes the connections to the idle session peers first when trimming. A
+// zero idleTimeout means [DefaultSessionPeerIdleTimeout].
+//
+// Without this option, session peers are tagged with a fixed weight, unless
+// [SessionPeerBudget] is given, which uses [DefaultSessionPeerActiveWeight]
+// and [DefaultSessionPeerIdleWeight].
+func SessionPeerWeights(active, idle int, idleTimeout time.Duration) NetOpt {
+	return func(settings *Settings) {
+		settings.SessionPeerTagging = true
+		settings.SessionPeerActiveWeight = active
+		settings.SessionPeerIdleWeight = idle
+		settings.SessionPeerIdleTimeout = idleTimeout
+	}
+}
+
+// SessionPeerBudget limits the number of peers each bitswap session tags in
+// the connection manager. Past the budget, the session peer that was idle for
+// the longest time is untagged, so that its connection can be trimmed, unless
+// all the peers of the session are protected because they sent blocks, in
+// which case the new peer is not tagged. The connections to the peers over
+// budget are left to the trimming of the connection manager, see
+// [SessionDialBudget] to limit the dials. A budget of 0 means no limit.
+func SessionPeerBudget(budget int) NetOpt {
+	return func(settings *Settings) {
+		settings.SessionPeerTagging = true
+		settings.SessionPeerBudget = budget
+	}
+}
+
+// SessionDialBudget limits the number of dials each bitswap session makes to
+// connect to the providers it finds. The dials to the peers that are already
+// connected are not counted. Past the budget, the dials of the session fail
+// with [ErrSessionDialBudget], so that the session keeps using the peers it
+// is connected to. A budget of 0 means no limit.
+func SessionDialBudget(budget int) NetOpt {
+	return func(settings *Settings) {
+		settings.SessionDialBudget = budget
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/ipfs/boxo/bitswap/client"
 	"github.com/ipfs/boxo/bitswap/server"
 	"github.com/ipfs/boxo/bitswap/tracer"
+	"github.com/ipfs/go-datastore"
 	delay "github.com/ipfs/go-ipfs-delay"
 )
 
@@ -33,6 +34,18 @@ func MaxQueuedWantlistEntriesPerPeer(count uint) Option {
 	return Option{server.MaxQueuedWantlistEntriesPerPeer(count)}
 }
 
+// MaxOutboundQueueMemory only affects the server.
+// See [server.MaxOutboundQueueMemory] for details.
+func MaxOutboundQueueMemory(size int) Option {
+	return Option{server.MaxOutboundQueueMemory(size)}
+}
+
+// OutboundQueueQuantum only affects the server.
+// See [server.OutboundQueueQuantum] for details.
+func OutboundQueueQuantum(size int) Option {
+	return Option{server.OutboundQueueQuantum(size)}
+}
+
 // MaxCidSize only affects the server.
 // If it is 0 no limit is applied.
 func MaxCidSize(n uint) Option {
@@ -74,10 +87,52 @@ func WithWantHaveReplaceSize(size int) Option {
 	return Option{server.WithWantHaveReplaceSize(size)}
 }
 
+// WithHasProvider sets a HasProvider consulted before the blockstore to
+// answer HAVE requests. See [server.WithHasProvider] for details.
+func WithHasProvider(hp server.HasProvider) Option {
+	return Option{server.WithHasProvider(hp)}
+}
+
+// WithDemandSignaler sets a DemandSignaler told about the blocks sent to
+// peers. See [server.WithDemandSignaler] for details.
+func WithDemandSignaler(ds server.DemandSignaler) Option {
+	return Option{server.WithDemandSignaler(ds)}
+}
+
+// WithReadAhead enables the read-ahead of the next count blocks of sequential
+// requesters. See [server.WithReadAhead] for details.
+func WithReadAhead(count int) Option {
+	return Option{server.WithReadAhead(count)}
+}
+
+// WithReadAheadBlocks makes read-ahead send the small predicted blocks. See
+// [server.WithReadAheadBlocks] for details.
+func WithReadAheadBlocks(maxSize int) Option {
+	return Option{server.WithReadAheadBlocks(maxSize)}
+}
+
+// WithReadAheadPredictor sets the ReadAheadPredictor used for read-ahead.
+// See [server.WithReadAheadPredictor] for details.
+func WithReadAheadPredictor(p server.ReadAheadPredictor) Option {
+	return Option{server.WithReadAheadPredictor(p)}
+}
+
 func ProviderSearchDelay(newProvSearchDelay time.Duration) Option {
 	return Option{client.ProviderSearchDelay(newProvSearchDelay)}
 }
 
+// ProviderSearchAfterBroadcasts only affects the client.
+// See [client.ProviderSearchAfterBroadcasts] for details.
+func ProviderSearchAfterBroadcasts(n int) Option {
+	return Option{client.ProviderSearchAfterBroadcasts(n)}
+}
+
+// ProviderSearchAfterIdle only affects the client.
+// See [client.ProviderSearchAfterIdle] for details.
+func ProviderSearchAfterIdle(d time.Duration) Option {
+	return Option{client.ProviderSearchAfterIdle(d)}
+}
+
 func RebroadcastDelay(newRebroadcastDelay delay.D) Option {
 	return Option{client.RebroadcastDelay(newRebroadcastDelay)}
 }
@@ -90,10 +145,28 @@ func WithBlockReceivedNotifier(brn client.BlockReceivedNotifier) Option {
 	return Option{client.WithBlockReceivedNotifier(brn)}
 }
 
+func WithBlockVerifier(v client.BlockVerifier) Option {
+	return Option{client.WithBlockVerifier(v)}
+}
+
 func WithoutDuplicatedBlockStats() Option {
 	return Option{client.WithoutDuplicatedBlockStats()}
 }
 
+// WithWantlistPersistence persists the wants of the client in ds so that they
+// are resumed after a restart. See [client.WithWantlistPersistence] for
+// details.
+func WithWantlistPersistence(ds datastore.Batching) Option {
+	return Option{client.WithWantlistPersistence(ds)}
+}
+
+// WithDuplicateWantSuppression makes the sessions wanting a block that
+// another session is already requesting wait for it, for up to claimTimeout.
+// See [client.WithDuplicateWantSuppression] for details.
+func WithDuplicateWantSuppression(claimTimeout time.Duration) Option {
+	return Option{client.WithDuplicateWantSuppression(claimTimeout)}
+}
+
 func WithTracer(tap tracer.Tracer) Option {
 	// Only trace the server, both receive the same messages anyway
 	return Option{
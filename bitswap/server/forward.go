@@ -13,4 +13,6 @@ type (
 	ScorePeerFunc          = decision.ScorePeerFunc
 	PeerLedger             = decision.PeerLedger
 	PeerEntry              = decision.PeerEntry
+	HasProvider            = decision.HasProvider
+	ReadAheadPredictor     = decision.ReadAheadPredictor
 )
@@ -16,6 +16,7 @@ import (
 // blockstoreManager maintains a pool of workers that make requests to the blockstore.
 type blockstoreManager struct {
 	bs           bstore.Blockstore
+	hasProvider  HasProvider
 	workerCount  int
 	jobs         chan func()
 	pendingGauge metrics.Gauge
@@ -85,7 +86,31 @@ func (bsm *blockstoreManager) addJob(ctx context.Context, job func()) error {
 	}
 }
 
+// lookupHasProvider splits ks into the blocks that the HasProvider knows are
+// available, and the ones it cannot tell about. Blocks it knows are not
+// available are dropped.
+func (bsm *blockstoreManager) lookupHasProvider(ctx context.Context, ks []cid.Cid) (has, unknown []cid.Cid) {
+	if bsm.hasProvider == nil {
+		return nil, ks
+	}
+	unknown = make([]cid.Cid, 0, len(ks))
+	for _, c := range ks {
+		switch found, ok := bsm.hasProvider.Has(ctx, c); {
+		case !ok:
+			unknown = append(unknown, c)
+		case found:
+			has = append(has, c)
+		}
+	}
+	return has, unknown
+}
+
 func (bsm *blockstoreManager) getBlockSizes(ctx context.Context, ks []cid.Cid) (map[cid.Cid]int, error) {
+	if bsm.hasProvider != nil {
+		// The size of the available blocks is still needed.
+		has, unknown := bsm.lookupHasProvider(ctx, ks)
+		ks = append(has, unknown...)
+	}
 	if len(ks) == 0 {
 		return nil, nil
 	}
@@ -122,8 +147,16 @@ func (bsm *blockstoreManager) getBlockSizes(ctx context.Context, ks []cid.Cid) (
 }
 
 func (bsm *blockstoreManager) hasBlocks(ctx context.Context, ks []cid.Cid) (map[cid.Cid]struct{}, error) {
+	known, ks := bsm.lookupHasProvider(ctx, ks)
 	if len(ks) == 0 {
-		return nil, nil
+		if len(known) == 0 {
+			return nil, nil
+		}
+		res := make(map[cid.Cid]struct{}, len(known))
+		for _, c := range known {
+			res[c] = struct{}{}
+		}
+		return res, nil
 	}
 	hasBlocks := make([]bool, len(ks))
 
@@ -143,12 +176,15 @@ func (bsm *blockstoreManager) hasBlocks(ctx context.Context, ks []cid.Cid) (map[
 	if err != nil {
 		return nil, err
 	}
-	results := count.Load()
+	results := int(count.Load()) + len(known)
 	if results == 0 {
 		return nil, nil
 	}
 
 	res := make(map[cid.Cid]struct{}, results)
+	for _, c := range known {
+		res[c] = struct{}{}
+	}
 	for i, ok := range hasBlocks {
 		if ok {
 			res[ks[i]] = struct{}{}
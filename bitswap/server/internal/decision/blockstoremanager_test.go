@@ -145,6 +145,59 @@ func TestBlockstoreManager(t *testing.T) {
 	}
 }
 
+// testHasProvider answers conclusively for the blocks in its map.
+type testHasProvider map[cid.Cid]bool
+
+func (p testHasProvider) Has(_ context.Context, c cid.Cid) (bool, bool) {
+	has, ok := p[c]
+	return has, ok
+}
+
+func TestBlockstoreManagerHasProvider(t *testing.T) {
+	ctx := context.Background()
+	bstore := blockstore.NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+
+	bsm := newBlockstoreManagerForTesting(t, ctx, bstore, 5)
+
+	blks := random.BlocksOfSize(3, 1024)
+	if err := bstore.PutMany(ctx, blks[1:]); err != nil {
+		t.Fatal(err)
+	}
+	cids := []cid.Cid{blks[0].Cid(), blks[1].Cid(), blks[2].Cid()}
+
+	// The provider is trusted over the blockstore, and the blockstore is
+	// read for the blocks the provider cannot tell about.
+	bsm.hasProvider = testHasProvider{
+		cids[0]: true,
+		cids[1]: false,
+	}
+
+	hasBlocks, err := bsm.hasBlocks(ctx, cids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hasBlocks) != 2 {
+		t.Fatal("Wrong response length")
+	}
+	if _, ok := hasBlocks[cids[0]]; !ok {
+		t.Fatal("Block known by the provider should be in hasBlocks")
+	}
+	if _, ok := hasBlocks[cids[1]]; ok {
+		t.Fatal("Block unknown to the provider should not be in hasBlocks")
+	}
+	if _, ok := hasBlocks[cids[2]]; !ok {
+		t.Fatal("Block in the blockstore should be in hasBlocks")
+	}
+
+	sizes, err := bsm.getBlockSizes(ctx, cids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 1 || sizes[cids[2]] != 1024 {
+		t.Fatal("Only the size of the block in the blockstore should be returned")
+	}
+}
+
 func TestBlockstoreManagerConcurrency(t *testing.T) {
 	ctx := context.Background()
 	bsdelay := delay.Fixed(3 * time.Millisecond)
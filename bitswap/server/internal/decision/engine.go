@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"slices"
 	"sync"
 	"sync/atomic"
@@ -26,7 +27,6 @@ import (
 	"github.com/ipfs/go-peertaskqueue/peertask"
 	"github.com/ipfs/go-peertaskqueue/peertracker"
 	"github.com/libp2p/go-libp2p/core/peer"
-	mh "github.com/multiformats/go-multihash"
 )
 
 // TODO consider taking responsibility for other types of requests. For
@@ -204,6 +204,17 @@ type Engine struct {
 	// which to replace a WantHave with a WantBlock.
 	wantHaveReplaceSize int
 
+	// hasProvider, if set, is consulted before the blockstore.
+	hasProvider HasProvider
+
+	// readAhead predicts the next readAheadCount blocks wanted by sequential
+	// requesters, nil if read-ahead is disabled. The predicted blocks up to
+	// readAheadBlockSize bytes, if positive, are sent, the others are
+	// announced.
+	readAhead          ReadAheadPredictor
+	readAheadCount     int
+	readAheadBlockSize int
+
 	sendDontHaves bool
 
 	self peer.ID
@@ -226,6 +237,11 @@ type Engine struct {
 
 	maxQueuedWantlistEntriesPerPeer uint
 	maxCidSize                      uint
+
+	maxOutboundQueueMemory int
+	outboundQueueQuantum   int
+	// nil if maxOutboundQueueMemory is 0
+	outboundLimiter *outboundLimiter
 }
 
 // TaskInfo represents the details of a request from a peer.
@@ -251,6 +267,19 @@ type TaskComparator func(ta, tb *TaskInfo) bool
 // It should return true if the request should be fullfilled.
 type PeerBlockRequestFilter func(p peer.ID, c cid.Cid) bool
 
+// HasProvider tells whether blocks are available without reading the
+// blockstore, for example from an index or a manifest of its content. It is
+// consulted before the blockstore for the HAVE requests, which are then
+// answered with a HAVE rather than replaced by the block (see
+// WithWantHaveReplaceSize), and to skip the blocks that are not available.
+type HasProvider interface {
+	// Has returns whether the block c is available, with ok true if the
+	// answer is conclusive. A bloom filter, for example, is only conclusive
+	// about the blocks it does not contain. Inconclusive answers are checked
+	// with the blockstore.
+	Has(ctx context.Context, c cid.Cid) (has bool, ok bool)
+}
+
 type Option func(*Engine)
 
 func WithTaskComparator(comparator TaskComparator) Option {
@@ -341,6 +370,32 @@ func WithSetSendDontHave(send bool) Option {
 	}
 }
 
+// WithMaxOutboundQueueMemory caps the total size of the blocks loaded for
+// outgoing messages that are not sent yet, across all peers. Messages wait for
+// memory in per-peer queues served with deficit round robin, and are dropped
+// when the bytes waiting exceed the cap too. Setting it to 0 disables the
+// limit.
+func WithMaxOutboundQueueMemory(size int) Option {
+	if size < 0 {
+		panic(fmt.Sprintf("max outbound queue memory is %d but must be >= 0", size))
+	}
+	return func(e *Engine) {
+		e.maxOutboundQueueMemory = size
+	}
+}
+
+// WithOutboundQueueQuantum sets the number of bytes a peer is credited with
+// on each deficit round robin round, when [WithMaxOutboundQueueMemory] is set.
+// It defaults to the target message size.
+func WithOutboundQueueQuantum(size int) Option {
+	if size <= 0 {
+		panic(fmt.Sprintf("outbound queue quantum is %d but must be > 0", size))
+	}
+	return func(e *Engine) {
+		e.outboundQueueQuantum = size
+	}
+}
+
 // WithWantHaveReplaceSize sets the maximum size of a block in bytes up to
 // which to replace a WantHave with a WantBlock response.
 func WithWantHaveReplaceSize(size int) Option {
@@ -349,6 +404,36 @@ func WithWantHaveReplaceSize(size int) Option {
 	}
 }
 
+// WithHasProvider sets the HasProvider consulted before the blockstore.
+func WithHasProvider(hp HasProvider) Option {
+	return func(e *Engine) {
+		e.hasProvider = hp
+	}
+}
+
+// WithReadAhead enables read-ahead of the next count blocks of sequential
+// requesters, announcing them with HAVEs.
+func WithReadAhead(count int) Option {
+	return func(e *Engine) {
+		e.readAheadCount = count
+	}
+}
+
+// WithReadAheadBlocks makes read-ahead send the predicted blocks up to
+// maxSize bytes, rather than announcing them.
+func WithReadAheadBlocks(maxSize int) Option {
+	return func(e *Engine) {
+		e.readAheadBlockSize = maxSize
+	}
+}
+
+// WithReadAheadPredictor sets the ReadAheadPredictor used for read-ahead.
+func WithReadAheadPredictor(p ReadAheadPredictor) Option {
+	return func(e *Engine) {
+		e.readAhead = p
+	}
+}
+
 // wrapTaskComparator wraps a TaskComparator so it can be used as a QueueTaskComparator
 func wrapTaskComparator(tc TaskComparator) peertask.QueueTaskComparator {
 	return func(a, b *peertask.QueueTask) bool {
@@ -417,7 +502,23 @@ func NewEngine(
 		e.peerLedger = NewDefaultPeerLedger(e.maxQueuedWantlistEntriesPerPeer)
 	}
 
+	if e.maxOutboundQueueMemory > 0 {
+		quantum := e.outboundQueueQuantum
+		if quantum == 0 {
+			quantum = e.targetMessageSize
+		}
+		e.outboundLimiter = newOutboundLimiter(e.maxOutboundQueueMemory, quantum,
+			bmetrics.OutboundQueueBytesGauge(ctx), bmetrics.OutboundQueueDropsCounter(ctx))
+	}
+
+	if e.readAheadCount <= 0 {
+		e.readAhead = nil
+	} else if e.readAhead == nil {
+		e.readAhead = newSiblingPredictor(defaultReadAheadParents)
+	}
+
 	e.bsm = newBlockstoreManager(bs, e.bstoreWorkerCount, bmetrics.PendingBlocksGauge(ctx), bmetrics.ActiveBlocksGauge(ctx))
+	e.bsm.hasProvider = e.hasProvider
 
 	// default peer task queue options
 	peerTaskQueueOpts := []peertaskqueue.Option{
@@ -614,9 +715,32 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 			}
 		}
 
+		// Wait for memory to load the blocks
+		var blocksSize int
+		if e.outboundLimiter != nil && len(blockCids) != 0 {
+			for _, td := range blockTasks {
+				blocksSize += td.BlockSize
+			}
+			if !e.outboundLimiter.acquire(ctx, p, blocksSize) {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				// The blocks were dropped, forget about the wants so that
+				// they are served if the peer asks again.
+				e.dropBlockWants(p, blockCids)
+				blockCids, blockTasks, blocksSize = nil, nil, 0
+			}
+		}
+		releaseMemory := func() {
+			if blocksSize != 0 {
+				e.outboundLimiter.release(blocksSize)
+			}
+		}
+
 		// Fetch blocks from datastore
 		blks, err := e.bsm.getBlocks(ctx, blockCids)
 		if err != nil {
+			releaseMemory()
 			// we're dropping the envelope but that's not an issue in practice.
 			return nil, err
 		}
@@ -638,6 +762,7 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 
 		// If there's nothing in the message, bail out
 		if msg.Empty() {
+			releaseMemory()
 			e.peerRequestQueue.TasksDone(p, nextTasks...)
 			continue
 		}
@@ -647,6 +772,8 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 			Peer:    p,
 			Message: msg,
 			Sent: func() {
+				releaseMemory()
+
 				// Once the message has been sent, signal the request queue so
 				// it can be cleared from the queue
 				e.peerRequestQueue.TasksDone(p, nextTasks...)
@@ -658,6 +785,17 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 	}
 }
 
+// dropBlockWants cancels the want-blocks of p for blocks that were dropped
+// from the outbound queue.
+func (e *Engine) dropBlockWants(p peer.ID, cids []cid.Cid) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, c := range cids {
+		e.peerLedger.CancelWantWithType(p, c, pb.Message_Wantlist_Block)
+	}
+}
+
 // Outbox returns a channel of one-time use Envelope channels.
 func (e *Engine) Outbox() <-chan (<-chan *Envelope) {
 	return e.outbox
@@ -692,11 +830,23 @@ func (e *Engine) MessageReceived(ctx context.Context, p peer.ID, m bsmsg.BitSwap
 
 	// Get block sizes for unique CIDs.
 	wantKs := make([]cid.Cid, 0, len(wants))
-	var haveKs []cid.Cid
+	var haveKs, knownKs []cid.Cid
 	for _, entry := range wants {
-		if noReplace && entry.WantType == pb.Message_Wantlist_Have {
+		switch {
+		case entry.WantType != pb.Message_Wantlist_Have:
+			wantKs = append(wantKs, entry.Cid)
+		case noReplace:
 			haveKs = append(haveKs, entry.Cid)
-		} else {
+		case e.hasProvider != nil:
+			// The HAVEs answered by the HasProvider are not replaced by
+			// blocks, so that the blockstore is not read for them.
+			switch has, ok := e.hasProvider.Has(ctx, entry.Cid); {
+			case !ok:
+				wantKs = append(wantKs, entry.Cid)
+			case has:
+				knownKs = append(knownKs, entry.Cid)
+			}
+		default:
 			wantKs = append(wantKs, entry.Cid)
 		}
 	}
@@ -705,6 +855,16 @@ func (e *Engine) MessageReceived(ctx context.Context, p peer.ID, m bsmsg.BitSwap
 		log.Info("aborting message processing", err)
 		return false
 	}
+	if len(knownKs) != 0 {
+		if blockSizes == nil {
+			blockSizes = make(map[cid.Cid]int, len(knownKs))
+		}
+		for _, c := range knownKs {
+			if _, ok := blockSizes[c]; !ok {
+				blockSizes[c] = 0
+			}
+		}
+	}
 	if len(haveKs) != 0 {
 		hasBlocks, err := e.bsm.hasBlocks(ctx, haveKs)
 		if err != nil {
@@ -812,6 +972,10 @@ func (e *Engine) MessageReceived(ctx context.Context, p peer.ID, m bsmsg.BitSwap
 		})
 	}
 
+	if e.readAhead != nil {
+		activeEntries = append(activeEntries, e.readAheadTasks(ctx, p, wants, blockSizes)...)
+	}
+
 	// Push entries onto the request queue and signal network that new work is ready.
 	if len(activeEntries) != 0 {
 		e.peerRequestQueue.PushTasksTruncated(e.maxQueuedWantlistEntriesPerPeer, p, activeEntries...)
@@ -821,6 +985,63 @@ func (e *Engine) MessageReceived(ctx context.Context, p peer.ID, m bsmsg.BitSwap
 	return false
 }
 
+// readAheadTasks returns the tasks announcing, or sending, the blocks that p
+// is predicted to want after the given wants. They have a lower priority than
+// the wants, so that they do not delay them.
+func (e *Engine) readAheadTasks(ctx context.Context, p peer.ID, wants []bsmsg.Entry, blockSizes map[cid.Cid]int) []peertask.Task {
+	wanted := make([]cid.Cid, 0, len(wants))
+	priority := math.MaxInt32
+	for _, entry := range wants {
+		if _, found := blockSizes[entry.Cid]; found {
+			wanted = append(wanted, entry.Cid)
+			priority = min(priority, int(entry.Priority))
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	predicted := e.readAhead.Predict(p, wanted, e.readAheadCount)
+	predicted = slices.DeleteFunc(predicted, func(c cid.Cid) bool {
+		_, wanted := blockSizes[c]
+		return wanted || (e.peerBlockRequestFilter != nil && !e.peerBlockRequestFilter(p, c))
+	})
+	if len(predicted) == 0 {
+		return nil
+	}
+	sizes, err := e.bsm.getBlockSizes(ctx, predicted)
+	if err != nil {
+		log.Debugw("Bitswap engine: read-ahead failed", "local", e.self, "to", p, "err", err)
+		return nil
+	}
+
+	var tasks []peertask.Task
+	for _, c := range predicted {
+		size, found := sizes[c]
+		if !found {
+			continue
+		}
+		isWantBlock := size != 0 && size <= e.readAheadBlockSize
+		work := size
+		if !isWantBlock {
+			work = bsmsg.BlockPresenceSize(c)
+		}
+		priority--
+		tasks = append(tasks, peertask.Task{
+			Topic:    c,
+			Priority: priority,
+			Work:     work,
+			Data: &taskData{
+				BlockSize:   size,
+				HaveBlock:   true,
+				IsWantBlock: isWantBlock,
+			},
+		})
+	}
+	log.Debugw("Bitswap engine: read-ahead", "local", e.self, "to", p, "count", len(tasks))
+	return tasks
+}
+
 func (e *Engine) filterOverflow(p peer.ID, wants, overflow []bsmsg.Entry) ([]bsmsg.Entry, []bsmsg.Entry) {
 	if len(wants) == 0 {
 		return wants, overflow
@@ -934,7 +1155,7 @@ func (e *Engine) splitWantsCancelsDenials(p peer.ID, m bsmsg.BitSwapMessage) ([]
 			// Ignore requests about CIDs that big.
 			continue
 		}
-		if c.Prefix().MhType == mh.IDENTITY {
+		if bstore.IsIdentity(c) {
 			return nil, nil, nil, errors.New("peer canceled an identity CID")
 		}
 
@@ -1046,6 +1267,10 @@ func (e *Engine) NotifyNewBlocks(blks []blocks.Block) {
 // MessageSent is called when a message has successfully been sent out, to record
 // changes.
 func (e *Engine) MessageSent(p peer.ID, m bsmsg.BitSwapMessage) {
+	if e.readAhead != nil {
+		e.readAhead.BlocksSent(p, m.Blocks())
+	}
+
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
@@ -1076,12 +1301,19 @@ func (e *Engine) PeerConnected(p peer.ID) {
 // PeerDisconnected is called when a peer disconnects.
 func (e *Engine) PeerDisconnected(p peer.ID) {
 	e.peerRequestQueue.Clear(p)
+	if e.outboundLimiter != nil {
+		e.outboundLimiter.peerDisconnected(p)
+	}
 
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
 	e.peerLedger.PeerDisconnected(p)
 	e.scoreLedger.PeerDisconnected(p)
+
+	if e.readAhead != nil {
+		e.readAhead.PeerDisconnected(p)
+	}
 }
 
 // If the want is a want-have, and it's below a certain size, send the full
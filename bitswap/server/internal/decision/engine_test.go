@@ -991,6 +991,43 @@ func TestSendDontHave(t *testing.T) {
 	}
 }
 
+func TestHasProviderAnswersHaves(t *testing.T) {
+	// The blockstore is empty: the HAVEs come from the provider alone.
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	partner := libp2ptest.RandPeerIDFatal(t)
+
+	blks := random.BlocksOfSize(2, 8*1024)
+	hp := testHasProvider{blks[0].Cid(): true, blks[1].Cid(): false}
+	e := newEngineForTesting(bs, &fakePeerTagger{}, "localhost", 1024*1024, WithHasProvider(hp), WithScoreLedger(NewTestScoreLedger(shortTerm, nil, clock.New())))
+	defer e.Close()
+
+	msg := message.New(false)
+	msg.AddEntry(blks[0].Cid(), 2, pb.Message_Wantlist_Have, true)
+	msg.AddEntry(blks[1].Cid(), 1, pb.Message_Wantlist_Have, true)
+	e.MessageReceived(context.Background(), partner, msg)
+
+	_, env := getNextEnvelope(e, nil, 10*time.Millisecond)
+	if env == nil {
+		t.Fatal("expected envelope")
+	}
+	if len(env.Message.Blocks()) > 0 {
+		t.Fatal("expected no blocks")
+	}
+	presences := env.Message.BlockPresences()
+	if len(presences) != 2 {
+		t.Fatal("expected 2 block presences")
+	}
+	for _, bp := range presences {
+		expected := pb.Message_DontHave
+		if bp.Cid.Equals(blks[0].Cid()) {
+			expected = pb.Message_Have
+		}
+		if bp.Type != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, bp.Cid, bp.Type)
+		}
+	}
+}
+
 func TestWantlistForPeer(t *testing.T) {
 	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
 	partner := libp2ptest.RandPeerIDFatal(t)
@@ -0,0 +1,242 @@
+package decision
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-metrics-interface"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// outboundLimiter caps the memory held by blocks that were loaded from the
+// blockstore for outgoing messages and are not sent yet.
+//
+// Messages wait for memory in per-peer queues, which are served with deficit
+// round robin: on each round a peer gains quantum bytes of credit and may send
+// queued messages for as long as its credit covers their size. Peers sending
+// large blocks therefore need several rounds per message, and cannot starve
+// peers sending small ones.
+//
+// The bytes waiting for memory are capped too. When a new message does not
+// fit, the most recent message of the peer with the most bytes waiting is
+// dropped, which may be the new message itself.
+type outboundLimiter struct {
+	maxBytes int
+	quantum  int
+
+	lk      sync.Mutex
+	used    int
+	waiting int
+	peers   map[peer.ID]*drrPeer
+	// round robin list of the peers with queued messages, the first peer is
+	// the one currently being served
+	active []*drrPeer
+
+	usedGauge   metrics.Gauge
+	dropCounter metrics.Counter
+}
+
+type drrPeer struct {
+	id      peer.ID
+	deficit int
+	// whether the peer received its quantum in the current round
+	credited bool
+	waiting  int
+	queue    []*outboundRequest
+}
+
+type outboundRequest struct {
+	size  int
+	ready chan struct{}
+	// set when ready is closed, true if memory was granted and false if the
+	// request was dropped
+	granted bool
+}
+
+func newOutboundLimiter(maxBytes, quantum int, usedGauge metrics.Gauge, dropCounter metrics.Counter) *outboundLimiter {
+	return &outboundLimiter{
+		maxBytes:    maxBytes,
+		quantum:     quantum,
+		peers:       make(map[peer.ID]*drrPeer),
+		usedGauge:   usedGauge,
+		dropCounter: dropCounter,
+	}
+}
+
+// clamp ensures that a single message larger than the limit can still be
+// sent, on its own.
+func (l *outboundLimiter) clamp(size int) int {
+	if size > l.maxBytes {
+		return l.maxBytes
+	}
+	return size
+}
+
+// acquire waits until size bytes of memory are granted for a message to p.
+// It returns false if the message was dropped, or if ctx is done. Memory that
+// was granted must be returned with release.
+func (l *outboundLimiter) acquire(ctx context.Context, p peer.ID, size int) bool {
+	size = l.clamp(size)
+
+	l.lk.Lock()
+	dp, ok := l.peers[p]
+	if !ok {
+		dp = &drrPeer{id: p}
+		l.peers[p] = dp
+	}
+	if !l.makeRoom(dp, size) {
+		l.removeIfIdle(dp)
+		l.lk.Unlock()
+		l.dropCounter.Inc()
+		return false
+	}
+
+	req := &outboundRequest{size: size, ready: make(chan struct{})}
+	dp.queue = append(dp.queue, req)
+	dp.waiting += size
+	l.waiting += size
+	if len(dp.queue) == 1 {
+		l.active = append(l.active, dp)
+	}
+	l.schedule()
+	l.lk.Unlock()
+
+	select {
+	case <-req.ready:
+		return req.granted
+	case <-ctx.Done():
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	select {
+	case <-req.ready:
+		// Granted or dropped in the meantime.
+		if req.granted {
+			l.releaseLocked(size)
+		}
+	default:
+		l.removeRequest(dp, req)
+	}
+	return false
+}
+
+// release returns the memory granted for a message of the given size.
+func (l *outboundLimiter) release(size int) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	l.releaseLocked(l.clamp(size))
+}
+
+func (l *outboundLimiter) releaseLocked(size int) {
+	l.used -= size
+	l.usedGauge.Set(float64(l.used))
+	l.schedule()
+}
+
+// peerDisconnected drops the messages waiting for memory for p.
+func (l *outboundLimiter) peerDisconnected(p peer.ID) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	dp, ok := l.peers[p]
+	if !ok {
+		return
+	}
+	for len(dp.queue) > 0 {
+		req := dp.queue[len(dp.queue)-1]
+		l.removeRequest(dp, req)
+		close(req.ready)
+	}
+	l.schedule()
+}
+
+// makeRoom drops waiting messages until a new message of the given size for dp
+// fits. It returns false if the new message must be dropped instead.
+func (l *outboundLimiter) makeRoom(dp *drrPeer, size int) bool {
+	for l.waiting+size > l.maxBytes {
+		// The new message counts towards the bytes waiting for dp.
+		heaviest, most := dp, dp.waiting+size
+		for _, ap := range l.active {
+			if ap.waiting > most {
+				heaviest, most = ap, ap.waiting
+			}
+		}
+		if heaviest == dp {
+			return false
+		}
+		req := heaviest.queue[len(heaviest.queue)-1]
+		l.removeRequest(heaviest, req)
+		close(req.ready)
+		l.dropCounter.Inc()
+	}
+	return true
+}
+
+// removeRequest removes a request that was not granted from the queue of dp.
+func (l *outboundLimiter) removeRequest(dp *drrPeer, req *outboundRequest) {
+	for i, r := range dp.queue {
+		if r == req {
+			dp.queue = append(dp.queue[:i], dp.queue[i+1:]...)
+			break
+		}
+	}
+	dp.waiting -= req.size
+	l.waiting -= req.size
+	if len(dp.queue) == 0 {
+		for i, ap := range l.active {
+			if ap == dp {
+				l.active = append(l.active[:i], l.active[i+1:]...)
+				break
+			}
+		}
+		dp.deficit = 0
+		dp.credited = false
+		l.removeIfIdle(dp)
+	}
+}
+
+func (l *outboundLimiter) removeIfIdle(dp *drrPeer) {
+	if len(dp.queue) == 0 {
+		delete(l.peers, dp.id)
+	}
+}
+
+// schedule grants memory to waiting messages, in deficit round robin order,
+// until there is no waiting message or not enough free memory for the next
+// one. Rounds only run while there is free memory, so that peers do not gain
+// credit while everyone is waiting.
+func (l *outboundLimiter) schedule() {
+	for len(l.active) > 0 && l.used < l.maxBytes {
+		dp := l.active[0]
+		if !dp.credited {
+			dp.deficit += l.quantum
+			dp.credited = true
+		}
+		for len(dp.queue) > 0 && dp.queue[0].size <= dp.deficit {
+			req := dp.queue[0]
+			if l.used+req.size > l.maxBytes {
+				// Keep the position in the round until memory is released.
+				return
+			}
+			dp.queue = dp.queue[1:]
+			dp.deficit -= req.size
+			dp.waiting -= req.size
+			l.waiting -= req.size
+			l.used += req.size
+			l.usedGauge.Set(float64(l.used))
+			req.granted = true
+			close(req.ready)
+		}
+
+		// Move on to the next peer.
+		l.active = l.active[1:]
+		dp.credited = false
+		if len(dp.queue) > 0 {
+			l.active = append(l.active, dp)
+		} else {
+			dp.deficit = 0
+			l.removeIfIdle(dp)
+		}
+	}
+}
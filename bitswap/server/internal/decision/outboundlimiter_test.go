@@ -0,0 +1,226 @@
+package decision
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-clock"
+	message "github.com/ipfs/boxo/bitswap/message"
+	pb "github.com/ipfs/boxo/bitswap/message/pb"
+	blockstore "github.com/ipfs/boxo/blockstore"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-metrics-interface"
+	"github.com/ipfs/go-test/random"
+	"github.com/libp2p/go-libp2p/core/peer"
+	libp2ptest "github.com/libp2p/go-libp2p/core/test"
+)
+
+type fakeCounter struct {
+	n atomic.Int64
+}
+
+func (c *fakeCounter) Inc()          { c.n.Add(1) }
+func (c *fakeCounter) Add(f float64) { c.n.Add(int64(f)) }
+
+func newTestOutboundLimiter(maxBytes, quantum int) (*outboundLimiter, *fakeCounter) {
+	drops := &fakeCounter{}
+	gauge := metrics.NewCtx(context.Background(), "outbound_queue_bytes", "").Gauge()
+	return newOutboundLimiter(maxBytes, quantum, gauge, drops), drops
+}
+
+// acquireAsync calls acquire in a goroutine and waits until the request is
+// queued.
+func acquireAsync(t *testing.T, l *outboundLimiter, ctx context.Context, p peer.ID, size int) <-chan bool {
+	t.Helper()
+
+	l.lk.Lock()
+	waiting := l.waiting
+	l.lk.Unlock()
+
+	res := make(chan bool, 1)
+	go func() {
+		res <- l.acquire(ctx, p, size)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.lk.Lock()
+		queued := l.waiting == waiting+size
+		l.lk.Unlock()
+		if queued {
+			return res
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("request was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectResult(t *testing.T, res <-chan bool, expected bool) {
+	t.Helper()
+	select {
+	case r := <-res:
+		if r != expected {
+			t.Fatalf("expected acquire to return %t", expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not return")
+	}
+}
+
+func TestOutboundLimiterDeficitRoundRobin(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestOutboundLimiter(100, 10)
+	big, small, other := peer.ID("big"), peer.ID("small"), peer.ID("other")
+
+	if !l.acquire(ctx, other, 50) || !l.acquire(ctx, other, 50) {
+		t.Fatal("expected memory to be granted")
+	}
+
+	// The large message of big is queued first.
+	bigRes := acquireAsync(t, l, ctx, big, 60)
+	smallRes := acquireAsync(t, l, ctx, small, 30)
+
+	// Once there is free memory, small gets enough credit for its message
+	// before big does.
+	l.release(50)
+	expectResult(t, smallRes, true)
+	select {
+	case <-bigRes:
+		t.Fatal("large message should still be waiting")
+	default:
+	}
+
+	l.release(50)
+	expectResult(t, bigRes, true)
+
+	l.release(30)
+	l.release(60)
+	if l.used != 0 || l.waiting != 0 || len(l.peers) != 0 || len(l.active) != 0 {
+		t.Fatal("expected limiter to be empty")
+	}
+}
+
+func TestOutboundLimiterLargeMessage(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestOutboundLimiter(100, 10)
+
+	// Messages larger than the limit are sent on their own.
+	if !l.acquire(ctx, peer.ID("p"), 500) {
+		t.Fatal("expected memory to be granted")
+	}
+	res := acquireAsync(t, l, ctx, peer.ID("q"), 1)
+	l.release(500)
+	expectResult(t, res, true)
+}
+
+func TestOutboundLimiterDrops(t *testing.T) {
+	ctx := context.Background()
+	l, drops := newTestOutboundLimiter(100, 10)
+	heavy, light := peer.ID("heavy"), peer.ID("light")
+
+	if !l.acquire(ctx, peer.ID("other"), 100) {
+		t.Fatal("expected memory to be granted")
+	}
+
+	heavy1 := acquireAsync(t, l, ctx, heavy, 50)
+	heavy2 := acquireAsync(t, l, ctx, heavy, 40)
+
+	// There is no room for the light message, so the last message of the
+	// heavy peer is dropped.
+	lightRes := make(chan bool, 1)
+	go func() {
+		lightRes <- l.acquire(ctx, light, 20)
+	}()
+	expectResult(t, heavy2, false)
+	if drops.n.Load() != 1 {
+		t.Fatal("expected one drop")
+	}
+
+	// The heavy peer is still the heaviest with its new message, which is
+	// dropped.
+	if l.acquire(ctx, heavy, 50) {
+		t.Fatal("expected message to be dropped")
+	}
+	if drops.n.Load() != 2 {
+		t.Fatal("expected two drops")
+	}
+
+	l.release(100)
+	expectResult(t, heavy1, true)
+	expectResult(t, lightRes, true)
+}
+
+func TestOutboundLimiterCancel(t *testing.T) {
+	l, drops := newTestOutboundLimiter(100, 10)
+	p := peer.ID("p")
+
+	if !l.acquire(context.Background(), peer.ID("other"), 100) {
+		t.Fatal("expected memory to be granted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := acquireAsync(t, l, ctx, p, 50)
+	cancel()
+	expectResult(t, res, false)
+
+	res = acquireAsync(t, l, context.Background(), p, 50)
+	l.peerDisconnected(p)
+	expectResult(t, res, false)
+
+	if drops.n.Load() != 0 {
+		t.Fatal("cancelled messages should not be counted as drops")
+	}
+	if l.waiting != 0 || len(l.active) != 0 {
+		t.Fatal("expected no waiting messages")
+	}
+}
+
+func TestEngineMaxOutboundQueueMemory(t *testing.T) {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	partner := libp2ptest.RandPeerIDFatal(t)
+
+	e := newEngineForTesting(bs, &fakePeerTagger{}, "localhost", 0,
+		WithScoreLedger(NewTestScoreLedger(shortTerm, nil, clock.New())),
+		WithBlockstoreWorkerCount(4),
+		WithMaxOutboundQueueMemory(16*1024),
+	)
+	defer e.Close()
+
+	blks := random.BlocksOfSize(2, 8*1024)
+	if err := bs.PutMany(context.Background(), blks); err != nil {
+		t.Fatal(err)
+	}
+	msg := message.New(false)
+	for _, b := range blks {
+		msg.AddEntry(b.Cid(), 1, pb.Message_Wantlist_Block, false)
+	}
+	e.MessageReceived(context.Background(), partner, msg)
+
+	_, env := getNextEnvelope(e, nil, time.Second)
+	if env == nil {
+		t.Fatal("expected envelope")
+	}
+	if len(env.Message.Blocks()) == 0 {
+		t.Fatal("expected blocks")
+	}
+
+	e.outboundLimiter.lk.Lock()
+	used := e.outboundLimiter.used
+	e.outboundLimiter.lk.Unlock()
+	if used == 0 {
+		t.Fatal("expected memory to be held until the message is sent")
+	}
+
+	env.Sent()
+	e.outboundLimiter.lk.Lock()
+	used = e.outboundLimiter.used
+	e.outboundLimiter.lk.Unlock()
+	if used != 0 {
+		t.Fatal("expected memory to be released once the message is sent")
+	}
+}
@@ -0,0 +1,219 @@
+package decision
+
+import (
+	"slices"
+	"sync"
+
+	mdpb "github.com/ipfs/boxo/ipld/merkledag/pb"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// defaultReadAheadParents is the number of parents whose children are tracked
+// per peer by the default ReadAheadPredictor.
+const defaultReadAheadParents = 16
+
+// ReadAheadPredictor predicts the blocks that a peer will request next, so
+// that they can be announced, or sent when they are small, before they are
+// requested. Sequential requesters, such as peers streaming a video, then
+// save a round trip per block.
+type ReadAheadPredictor interface {
+	// BlocksSent is called with the blocks sent to p. It must not block.
+	BlocksSent(p peer.ID, blks []blocks.Block)
+	// Predict returns up to n blocks that p is likely to request after the
+	// available blocks it just requested, or nil. It must not block.
+	Predict(p peer.ID, wants []cid.Cid, n int) []cid.Cid
+	// PeerDisconnected is called when p disconnects.
+	PeerDisconnected(p peer.ID)
+}
+
+// siblingPredictor is the default ReadAheadPredictor. It remembers the links
+// of the last dag-pb blocks sent to each peer, such as the nodes of a UnixFS
+// file, and predicts the next siblings of their children once a peer requests
+// them in order. The blocks are only decoded once the peer requests more
+// blocks, rather than when they are sent.
+type siblingPredictor struct {
+	maxParents int
+
+	lk    sync.Mutex
+	peers map[peer.ID]*peerSiblings
+}
+
+// peerSiblings are the parents tracked for a peer, from the oldest to the
+// most recently sent, and their children. The parents sent since the last
+// prediction are pending, not decoded yet.
+type peerSiblings struct {
+	pending  []blocks.Block
+	parents  []*siblings
+	children map[string]childPosition
+}
+
+// siblings are the links of a parent.
+type siblings struct {
+	key   string
+	links []cid.Cid
+	// last is the index of the last child requested, or -1.
+	last int
+	// predicted is the index of the next child to predict.
+	predicted int
+}
+
+type childPosition struct {
+	parent *siblings
+	index  int
+}
+
+func newSiblingPredictor(maxParents int) *siblingPredictor {
+	return &siblingPredictor{
+		maxParents: maxParents,
+		peers:      make(map[peer.ID]*peerSiblings),
+	}
+}
+
+// pbLinksTag is the first byte of the dag-pb blocks with links, which are
+// encoded before the data.
+const pbLinksTag = 0x12
+
+func (sp *siblingPredictor) BlocksSent(p peer.ID, blks []blocks.Block) {
+	// Leaves, most of the blocks sent, are skipped without decoding them.
+	var parents []blocks.Block
+	for _, blk := range blks {
+		data := blk.RawData()
+		if blk.Cid().Prefix().Codec == cid.DagProtobuf && len(data) != 0 && data[0] == pbLinksTag {
+			parents = append(parents, blk)
+		}
+	}
+	if len(parents) == 0 {
+		return
+	}
+
+	sp.lk.Lock()
+	defer sp.lk.Unlock()
+	ps := sp.peerSiblings(p)
+	ps.pending = append(ps.pending, parents...)
+	if n := len(ps.pending) - sp.maxParents; n > 0 {
+		ps.pending = ps.pending[n:]
+	}
+}
+
+func (sp *siblingPredictor) peerSiblings(p peer.ID) *peerSiblings {
+	ps, ok := sp.peers[p]
+	if !ok {
+		ps = &peerSiblings{children: make(map[string]childPosition)}
+		sp.peers[p] = ps
+	}
+	return ps
+}
+
+// decodePending tracks the links of the parents pending for ps.
+func (sp *siblingPredictor) decodePending(ps *peerSiblings) {
+	for _, blk := range ps.pending {
+		var nd mdpb.PBNode
+		if err := nd.Unmarshal(blk.RawData()); err != nil || len(nd.Links) < 2 {
+			continue
+		}
+		links := make([]cid.Cid, 0, len(nd.Links))
+		for _, l := range nd.Links {
+			c, err := cid.Cast(l.Hash)
+			if err != nil {
+				links = nil
+				break
+			}
+			links = append(links, c)
+		}
+		if links != nil {
+			sp.addParent(ps, string(blk.Cid().Hash()), links)
+		}
+	}
+	ps.pending = nil
+}
+
+// addParent tracks the links of a parent sent to the peer of ps, forgetting
+// the oldest parent if needed.
+func (sp *siblingPredictor) addParent(ps *peerSiblings, key string, links []cid.Cid) {
+	if slices.ContainsFunc(ps.parents, func(s *siblings) bool { return s.key == key }) {
+		return
+	}
+	if len(ps.parents) >= sp.maxParents {
+		oldest := ps.parents[0]
+		ps.parents = ps.parents[1:]
+		for _, c := range oldest.links {
+			if pos, ok := ps.children[string(c.Hash())]; ok && pos.parent == oldest {
+				delete(ps.children, string(c.Hash()))
+			}
+		}
+	}
+
+	s := &siblings{key: key, links: links, last: -1}
+	ps.parents = append(ps.parents, s)
+	for i, c := range links {
+		ps.children[string(c.Hash())] = childPosition{parent: s, index: i}
+	}
+}
+
+func (sp *siblingPredictor) Predict(p peer.ID, wants []cid.Cid, n int) []cid.Cid {
+	sp.lk.Lock()
+	defer sp.lk.Unlock()
+
+	ps, ok := sp.peers[p]
+	if !ok {
+		return nil
+	}
+	sp.decodePending(ps)
+
+	// Group the wanted children by parent.
+	var touched []*siblings
+	indexes := make(map[*siblings][]int)
+	for _, c := range wants {
+		pos, ok := ps.children[string(c.Hash())]
+		if !ok {
+			continue
+		}
+		if _, ok := indexes[pos.parent]; !ok {
+			touched = append(touched, pos.parent)
+		}
+		indexes[pos.parent] = append(indexes[pos.parent], pos.index)
+	}
+
+	var predicted []cid.Cid
+	for _, s := range touched {
+		idx := indexes[s]
+		if s.last >= 0 {
+			idx = append(idx, s.last)
+		}
+		slices.Sort(idx)
+		idx = slices.Compact(idx)
+
+		// The children are requested in order if two of them follow each
+		// other, including the last one requested before.
+		sequential := false
+		for i := 1; i < len(idx); i++ {
+			if idx[i] == idx[i-1]+1 {
+				sequential = true
+				break
+			}
+		}
+		s.last = idx[len(idx)-1]
+		if !sequential {
+			continue
+		}
+
+		start := max(s.last+1, s.predicted)
+		end := min(s.last+1+n, len(s.links), start+n-len(predicted))
+		if start < end {
+			predicted = append(predicted, s.links[start:end]...)
+			s.predicted = end
+		}
+		if len(predicted) >= n {
+			break
+		}
+	}
+	return predicted
+}
+
+func (sp *siblingPredictor) PeerDisconnected(p peer.ID) {
+	sp.lk.Lock()
+	defer sp.lk.Unlock()
+	delete(sp.peers, p)
+}
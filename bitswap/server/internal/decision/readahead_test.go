@@ -0,0 +1,162 @@
+package decision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	message "github.com/ipfs/boxo/bitswap/message"
+	pb "github.com/ipfs/boxo/bitswap/message/pb"
+	blockstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-test/random"
+	libp2ptest "github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFile returns a dag-pb parent linking to leaves of the given sizes.
+func newTestFile(t *testing.T, sizes ...int) (blocks.Block, []blocks.Block) {
+	parent := merkledag.NodeWithData(nil)
+	leaves := make([]blocks.Block, len(sizes))
+	for i, size := range sizes {
+		leaf := merkledag.NewRawNode(random.Bytes(size))
+		require.NoError(t, parent.AddNodeLink("", leaf))
+		leaves[i] = leaf
+	}
+	return parent, leaves
+}
+
+func cids(blks ...blocks.Block) []cid.Cid {
+	out := make([]cid.Cid, len(blks))
+	for i, b := range blks {
+		out[i] = b.Cid()
+	}
+	return out
+}
+
+func TestSiblingPredictor(t *testing.T) {
+	p := libp2ptest.RandPeerIDFatal(t)
+	parent, leaves := newTestFile(t, 10, 10, 10, 10, 10, 10)
+
+	sp := newSiblingPredictor(defaultReadAheadParents)
+	require.Nil(t, sp.Predict(p, cids(leaves[0]), 2), "nothing sent yet")
+
+	sp.BlocksSent(p, []blocks.Block{parent})
+	require.Nil(t, sp.Predict(p, cids(leaves[0]), 2), "a single request is not sequential")
+	require.Equal(t, cids(leaves[2], leaves[3]), sp.Predict(p, cids(leaves[1]), 2))
+	require.Equal(t, cids(leaves[4]), sp.Predict(p, cids(leaves[2]), 2), "the predicted blocks are not predicted again")
+	require.Equal(t, cids(leaves[5]), sp.Predict(p, cids(leaves[3], leaves[4]), 2), "the prediction stops at the last sibling")
+
+	other := libp2ptest.RandPeerIDFatal(t)
+	require.Nil(t, sp.Predict(other, cids(leaves[0], leaves[1]), 2), "the blocks sent are tracked per peer")
+
+	sp.PeerDisconnected(p)
+	require.Nil(t, sp.Predict(p, cids(leaves[0], leaves[1]), 2))
+}
+
+func TestSiblingPredictorSkipsLeaves(t *testing.T) {
+	p := libp2ptest.RandPeerIDFatal(t)
+	parent, _ := newTestFile(t, 10, 10)
+	leaf := merkledag.NodeWithData([]byte("leaf"))
+
+	sp := newSiblingPredictor(defaultReadAheadParents)
+	sp.BlocksSent(p, []blocks.Block{leaf})
+	require.Empty(t, sp.peers, "leaves are not tracked")
+	sp.BlocksSent(p, []blocks.Block{parent, leaf})
+	require.Len(t, sp.peers[p].pending, 1)
+}
+
+func TestReadAhead(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	partner := libp2ptest.RandPeerIDFatal(t)
+
+	parent, leaves := newTestFile(t, 100, 100, 100, 4096, 100)
+	require.NoError(t, bs.PutMany(ctx, append([]blocks.Block{parent}, leaves...)))
+
+	e := newEngineForTesting(bs, &fakePeerTagger{}, "localhost", 0, WithReadAhead(2), WithReadAheadBlocks(1024))
+	defer e.Close()
+
+	want := func(blks ...blocks.Block) {
+		msg := message.New(false)
+		for i, b := range blks {
+			msg.AddEntry(b.Cid(), int32(len(blks)-i), pb.Message_Wantlist_Block, false)
+		}
+		e.MessageReceived(ctx, partner, msg)
+	}
+	// The pending envelope channel is kept between calls, as the engine
+	// sends the next envelope to it.
+	var next envChan
+	receive := func() (blks []cid.Cid, haves []cid.Cid) {
+		for {
+			var env *Envelope
+			next, env = getNextEnvelope(e, next, 50*time.Millisecond)
+			if env == nil {
+				return blks, haves
+			}
+			require.Equal(t, partner, env.Peer)
+			e.MessageSent(partner, env.Message)
+			env.Sent()
+			for _, b := range env.Message.Blocks() {
+				blks = append(blks, b.Cid())
+			}
+			for _, bp := range env.Message.BlockPresences() {
+				require.Equal(t, pb.Message_Have, bp.Type)
+				haves = append(haves, bp.Cid)
+			}
+		}
+	}
+
+	want(parent)
+	blks, haves := receive()
+	require.Equal(t, cids(parent), blks)
+	require.Empty(t, haves)
+
+	// The next siblings of sequential wants are sent, or announced if large.
+	want(leaves[0], leaves[1])
+	blks, haves = receive()
+	require.ElementsMatch(t, cids(leaves[0], leaves[1], leaves[2]), blks)
+	require.Equal(t, cids(leaves[3]), haves)
+}
+
+func TestReadAheadHaveOnly(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	partner := libp2ptest.RandPeerIDFatal(t)
+
+	parent, leaves := newTestFile(t, 100, 100, 100, 100)
+	require.NoError(t, bs.PutMany(ctx, append([]blocks.Block{parent}, leaves...)))
+
+	e := newEngineForTesting(bs, &fakePeerTagger{}, "localhost", 0, WithReadAhead(2))
+	defer e.Close()
+
+	// The predicted blocks are only announced by default.
+	e.readAhead.BlocksSent(partner, []blocks.Block{parent})
+	msg := message.New(false)
+	msg.AddEntry(leaves[0].Cid(), 2, pb.Message_Wantlist_Block, false)
+	msg.AddEntry(leaves[1].Cid(), 1, pb.Message_Wantlist_Block, false)
+	e.MessageReceived(ctx, partner, msg)
+
+	var blks, haves []cid.Cid
+	var next envChan
+	for {
+		var env *Envelope
+		next, env = getNextEnvelope(e, next, 50*time.Millisecond)
+		if env == nil {
+			break
+		}
+		env.Sent()
+		for _, b := range env.Message.Blocks() {
+			blks = append(blks, b.Cid())
+		}
+		for _, bp := range env.Message.BlockPresences() {
+			haves = append(haves, bp.Cid)
+		}
+	}
+	require.ElementsMatch(t, cids(leaves[0], leaves[1]), blks)
+	require.ElementsMatch(t, cids(leaves[2], leaves[3]), haves)
+}
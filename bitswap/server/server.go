@@ -44,6 +44,9 @@ type Server struct {
 	// External statistics interface
 	tracer tracer.Tracer
 
+	// told about the blocks sent, nil if disabled
+	demandSignaler DemandSignaler
+
 	// Counters for various statistics
 	counterLk sync.Mutex
 	counters  Stat
@@ -210,6 +213,31 @@ func MaxCidSize(n uint) Option {
 	}
 }
 
+// MaxOutboundQueueMemory caps the total size of the blocks loaded for outgoing
+// messages that are not sent yet, across all peers. Messages wait for memory
+// in per-peer queues served with deficit round robin weighted by message size,
+// so that a few peers requesting large blocks cannot starve the others. When
+// the bytes waiting exceed the cap too, the blocks of the peer with the most
+// bytes waiting are dropped, and counted in the outbound_queue_drops_total
+// metric.
+// Setting it to 0 (the default) disables the limit.
+func MaxOutboundQueueMemory(size int) Option {
+	o := decision.WithMaxOutboundQueueMemory(size)
+	return func(bs *Server) {
+		bs.engineOptions = append(bs.engineOptions, o)
+	}
+}
+
+// OutboundQueueQuantum sets the number of bytes each peer is credited with on
+// every deficit round robin round when [MaxOutboundQueueMemory] is set. It
+// defaults to the target message size.
+func OutboundQueueQuantum(size int) Option {
+	o := decision.WithOutboundQueueQuantum(size)
+	return func(bs *Server) {
+		bs.engineOptions = append(bs.engineOptions, o)
+	}
+}
+
 // WithWantHaveReplaceSize sets the maximum size of a block in bytes up to
 // which the bitswap server will replace a WantHave with a WantBlock response.
 //
@@ -242,6 +270,68 @@ func WithWantHaveReplaceSize(size int) Option {
 	}
 }
 
+// WithHasProvider sets a HasProvider telling which blocks are available
+// without reading the blockstore, for example from an index of its content.
+// The server consults it first to answer HAVE requests, and to skip the
+// blocks that are not available, only reading the blockstore when it cannot
+// tell.
+func WithHasProvider(hp HasProvider) Option {
+	return func(bs *Server) {
+		bs.engineOptions = append(bs.engineOptions, decision.WithHasProvider(hp))
+	}
+}
+
+// WithReadAhead enables read-ahead for sequential requesters: when a peer
+// requests blocks in order, such as the leaves of a UnixFS file it streams,
+// the server announces the next count blocks with HAVEs before they are
+// requested, so that the peer can send its want-blocks right away. The
+// blocks are predicted by the [ReadAheadPredictor] set with
+// [WithReadAheadPredictor], which by default follows the siblings of the
+// children of the dag-pb blocks sent to the peer.
+//
+// Read-ahead is disabled by default, and with a count of 0.
+func WithReadAhead(count int) Option {
+	return func(bs *Server) {
+		bs.engineOptions = append(bs.engineOptions, decision.WithReadAhead(count))
+	}
+}
+
+// WithReadAheadBlocks makes [WithReadAhead] send the predicted blocks up to
+// maxSize bytes, instead of announcing them, which saves a round trip per
+// block. This requires clients accepting blocks they did not request yet:
+// the boxo client drops them, and requests them again later, so that their
+// bandwidth is spent twice.
+func WithReadAheadBlocks(maxSize int) Option {
+	return func(bs *Server) {
+		bs.engineOptions = append(bs.engineOptions, decision.WithReadAheadBlocks(maxSize))
+	}
+}
+
+// WithReadAheadPredictor sets the ReadAheadPredictor used by [WithReadAhead].
+func WithReadAheadPredictor(p ReadAheadPredictor) Option {
+	return func(bs *Server) {
+		bs.engineOptions = append(bs.engineOptions, decision.WithReadAheadPredictor(p))
+	}
+}
+
+// DemandSignaler is told which blocks the server sends to peers, such as the
+// [provider.DemandSignaler] of a provider system with [provider.ProvideAhead].
+//
+// [provider.DemandSignaler]: https://pkg.go.dev/github.com/ipfs/boxo/provider#DemandSignaler
+// [provider.ProvideAhead]: https://pkg.go.dev/github.com/ipfs/boxo/provider#ProvideAhead
+type DemandSignaler interface {
+	// Demanded signals that c is being requested. It must not block.
+	Demanded(c cid.Cid)
+}
+
+// WithDemandSignaler sets a DemandSignaler told about every block sent to
+// peers, so that the content in demand can be announced first.
+func WithDemandSignaler(ds DemandSignaler) Option {
+	return func(bs *Server) {
+		bs.demandSignaler = ds
+	}
+}
+
 // WantlistForPeer returns the currently understood list of blocks requested by a
 // given peer.
 func (bs *Server) WantlistForPeer(p peer.ID) []cid.Cid {
@@ -358,6 +448,11 @@ func (bs *Server) sendBlocks(ctx context.Context, env *decision.Envelope) {
 	for _, b := range blocks {
 		dataSent += len(b.RawData())
 	}
+	if bs.demandSignaler != nil {
+		for _, b := range blocks {
+			bs.demandSignaler.Demanded(b.Cid())
+		}
+	}
 	bs.counterLk.Lock()
 	bs.counters.BlocksSent += uint64(len(blocks))
 	bs.counters.DataSent += uint64(dataSent)
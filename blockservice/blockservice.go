@@ -75,6 +75,7 @@ var _ BoundedBlockService = (*blockService)(nil)
 
 type blockService struct {
 	allowlist  verifcid.Allowlist
+	policy     VerificationPolicy
 	blockstore blockstore.Blockstore
 	exchange   exchange.Interface
 	// If checkFirst is true then first check that a block doesn't
@@ -99,6 +100,15 @@ func WithAllowlist(allowlist verifcid.Allowlist) Option {
 	}
 }
 
+// WithVerificationPolicy sets a [VerificationPolicy] checking the blocks
+// added to the blockservice or fetched from the exchange. Rejected blocks are
+// not stored and fail with a [*RejectedBlockError].
+func WithVerificationPolicy(policy VerificationPolicy) Option {
+	return func(bs *blockService) {
+		bs.policy = policy
+	}
+}
+
 // New creates a BlockService with given datastore instance.
 func New(bs blockstore.Blockstore, exchange exchange.Interface, opts ...Option) BlockService {
 	if exchange == nil {
@@ -133,6 +143,12 @@ func (s *blockService) Allowlist() verifcid.Allowlist {
 	return s.allowlist
 }
 
+// VerificationPolicy returns the policy set with [WithVerificationPolicy], or
+// nil.
+func (s *blockService) VerificationPolicy() VerificationPolicy {
+	return s.policy
+}
+
 // NewSession creates a new session that allows for
 // controlled exchange of wantlists to decrease the bandwidth overhead.
 // If the current exchange is a SessionExchange, a new exchange
@@ -163,6 +179,9 @@ func (s *blockService) AddBlock(ctx context.Context, o blocks.Block) error {
 	if err != nil {
 		return err
 	}
+	if err := verifyBlock(s.policy, o); err != nil {
+		return err
+	}
 	if s.checkFirst {
 		if has, err := s.blockstore.Has(ctx, c); has || err != nil {
 			return err
@@ -194,6 +213,9 @@ func (s *blockService) AddBlocks(ctx context.Context, bs []blocks.Block) error {
 		if err != nil {
 			return err
 		}
+		if err := verifyBlock(s.policy, b); err != nil {
+			return err
+		}
 	}
 	var toput []blocks.Block
 	if s.checkFirst {
@@ -253,6 +275,10 @@ func getBlock(ctx context.Context, c cid.Cid, bs BlockService, fetchFactory func
 		return nil, err
 	}
 
+	if blk, ok := blockstore.IdentityBlock(c); ok {
+		return blk, nil
+	}
+
 	blockstore := bs.Blockstore()
 
 	block, err := blockstore.Get(ctx, c)
@@ -276,6 +302,9 @@ func getBlock(ctx context.Context, c cid.Cid, bs BlockService, fetchFactory func
 	if err != nil {
 		return nil, err
 	}
+	if err := verifyBlock(grabVerificationPolicyFromBlockservice(bs), blk); err != nil {
+		return nil, err
+	}
 	// also write in the blockstore for caching, inform the exchange that the block is available
 	err = blockstore.Put(ctx, blk)
 	if err != nil {
@@ -340,10 +369,14 @@ func getBlocks(ctx context.Context, ks []cid.Cid, blockservice BlockService, fet
 
 		var misses []cid.Cid
 		for _, c := range ks {
-			hit, err := bs.Get(ctx, c)
-			if err != nil {
-				misses = append(misses, c)
-				continue
+			hit, ok := blockstore.IdentityBlock(c)
+			if !ok {
+				var err error
+				hit, err = bs.Get(ctx, c)
+				if err != nil {
+					misses = append(misses, c)
+					continue
+				}
 			}
 			select {
 			case out <- hit:
@@ -364,6 +397,7 @@ func getBlocks(ctx context.Context, ks []cid.Cid, blockservice BlockService, fet
 		}
 
 		ex := blockservice.Exchange()
+		policy := grabVerificationPolicyFromBlockservice(blockservice)
 		var cache [1]blocks.Block // preallocate once for all iterations
 		for {
 			var b blocks.Block
@@ -377,6 +411,11 @@ func getBlocks(ctx context.Context, ks []cid.Cid, blockservice BlockService, fet
 				return
 			}
 
+			if err := verifyBlock(policy, b); err != nil {
+				logger.Errorf("block from the network rejected by blockService.GetBlocks: %s", err)
+				continue
+			}
+
 			// write in the blockstore for caching
 			err = bs.Put(ctx, b)
 			if err != nil {
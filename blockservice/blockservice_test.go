@@ -14,6 +14,7 @@ import (
 	dssync "github.com/ipfs/go-datastore/sync"
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-test/random"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/assert"
 )
@@ -288,6 +289,98 @@ func TestAllowlist(t *testing.T) {
 	check(NewSession(ctx, blockservice).GetBlock)
 }
 
+func TestIdentityBlocks(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := []byte("inlined")
+	mh, err := multihash.Sum(data, multihash.IDENTITY, -1)
+	a.NoError(err)
+	c := cid.NewCidV1(cid.Raw, mh)
+
+	// The blockstore does not handle identity CIDs, and there is no exchange.
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	blockservice := New(bs, nil)
+
+	blk, err := blockservice.GetBlock(ctx, c)
+	a.NoError(err)
+	a.Equal(data, blk.RawData())
+
+	var got []blocks.Block
+	for blk := range blockservice.GetBlocks(ctx, []cid.Cid{c}) {
+		got = append(got, blk)
+	}
+	a.Len(got, 1)
+	a.Equal(c, got[0].Cid())
+
+	has, err := bs.Has(ctx, c)
+	a.NoError(err)
+	a.False(has)
+}
+
+func TestVerificationPolicy(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newBlock := func(data []byte, codec uint64) blocks.Block {
+		mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		a.NoError(err)
+		b, err := blocks.NewBlockWithCid(data, cid.NewCidV1(codec, mh))
+		a.NoError(err)
+		return b
+	}
+	raw := newBlock([]byte("raw"), cid.Raw)
+	large := newBlock([]byte("too large"), cid.Raw)
+	cbor := newBlock([]byte("cbor"), cid.DagCBOR)
+
+	exchbstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	a.NoError(exchbstore.PutMany(ctx, []blocks.Block{raw, cbor}))
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	policy := AllPolicies(MaxBlockSize(blockSize), AllowedCodecs(multicodec.Raw))
+	blockservice := New(bstore, offline.Exchange(exchbstore), WithVerificationPolicy(policy))
+
+	// Added blocks.
+	err := blockservice.AddBlock(ctx, large)
+	a.ErrorIs(err, ErrBlockTooLarge)
+	var rejected *RejectedBlockError
+	a.ErrorAs(err, &rejected)
+	a.Equal(large.Cid(), rejected.Cid)
+	a.ErrorIs(blockservice.AddBlocks(ctx, []blocks.Block{raw, large}), ErrBlockTooLarge)
+	has, err := bstore.Has(ctx, raw.Cid())
+	a.NoError(err)
+	a.False(has)
+
+	// Fetched blocks.
+	for _, getBlock := range []func(context.Context, cid.Cid) (blocks.Block, error){
+		blockservice.GetBlock,
+		NewSession(ctx, blockservice).GetBlock,
+	} {
+		_, err = getBlock(ctx, cbor.Cid())
+		a.ErrorIs(err, ErrCodecNotAllowed)
+		_, err = getBlock(ctx, raw.Cid())
+		a.NoError(err)
+	}
+	has, err = bstore.Has(ctx, cbor.Cid())
+	a.NoError(err)
+	a.False(has)
+
+	a.NoError(bstore.DeleteBlock(ctx, raw.Cid()))
+	var got []cid.Cid
+	for b := range blockservice.GetBlocks(ctx, []cid.Cid{cbor.Cid(), raw.Cid()}) {
+		got = append(got, b.Cid())
+	}
+	a.Equal([]cid.Cid{raw.Cid()}, got)
+	has, err = bstore.Has(ctx, cbor.Cid())
+	a.NoError(err)
+	a.False(has)
+}
+
 type fakeIsNewSessionCreateExchange struct {
 	ses                 exchange.Fetcher
 	newSessionWasCalled bool
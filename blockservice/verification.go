@@ -0,0 +1,115 @@
+package blockservice
+
+import (
+	"errors"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+)
+
+var (
+	// ErrBlockTooLarge is the reason of the rejection of the blocks larger
+	// than the [MaxBlockSize] policy allows.
+	ErrBlockTooLarge = errors.New("block is too large")
+
+	// ErrCodecNotAllowed is the reason of the rejection of the blocks whose
+	// codec is not allowed by the [AllowedCodecs] policy.
+	ErrCodecNotAllowed = errors.New("codec is not allowed")
+)
+
+// RejectedBlockError is returned for a block rejected by a
+// [VerificationPolicy]. It wraps the reason returned by the policy.
+type RejectedBlockError struct {
+	Cid cid.Cid
+	Err error
+}
+
+func (e *RejectedBlockError) Error() string {
+	return fmt.Sprintf("block %s rejected: %s", e.Cid, e.Err)
+}
+
+func (e *RejectedBlockError) Unwrap() error {
+	return e.Err
+}
+
+// VerificationPolicy decides which blocks can enter a blockservice, when they
+// are added or fetched from the exchange. Rejected blocks are not stored.
+//
+// Unlike a [verifcid.Allowlist], which only sees CIDs, it sees the blocks
+// themselves. Its method matches the [client.BlockVerifier] interface of the
+// bitswap client, so the same policy can reject blocks as they are received
+// from peers, which are then not credited for them.
+//
+// [client.BlockVerifier]: https://pkg.go.dev/github.com/ipfs/boxo/bitswap/client#BlockVerifier
+type VerificationPolicy interface {
+	// VerifyBlock returns the reason why b must be rejected, or nil.
+	VerifyBlock(b blocks.Block) error
+}
+
+// VerificationPolicyFunc is a [VerificationPolicy] implemented by a function.
+type VerificationPolicyFunc func(b blocks.Block) error
+
+func (f VerificationPolicyFunc) VerifyBlock(b blocks.Block) error {
+	return f(b)
+}
+
+// MaxBlockSize returns a policy rejecting the blocks larger than size bytes
+// with [ErrBlockTooLarge].
+func MaxBlockSize(size int) VerificationPolicy {
+	return VerificationPolicyFunc(func(b blocks.Block) error {
+		if len(b.RawData()) > size {
+			return fmt.Errorf("%w: %d bytes, the maximum is %d", ErrBlockTooLarge, len(b.RawData()), size)
+		}
+		return nil
+	})
+}
+
+// AllowedCodecs returns a policy rejecting the blocks whose CID codec is not
+// one of codecs with [ErrCodecNotAllowed].
+func AllowedCodecs(codecs ...multicodec.Code) VerificationPolicy {
+	allowed := make(map[uint64]struct{}, len(codecs))
+	for _, c := range codecs {
+		allowed[uint64(c)] = struct{}{}
+	}
+	return VerificationPolicyFunc(func(b blocks.Block) error {
+		codec := b.Cid().Prefix().Codec
+		if _, ok := allowed[codec]; !ok {
+			return fmt.Errorf("%w: %s", ErrCodecNotAllowed, multicodec.Code(codec))
+		}
+		return nil
+	})
+}
+
+// AllPolicies returns a policy rejecting the blocks rejected by any of
+// policies, with the reason of the first one.
+func AllPolicies(policies ...VerificationPolicy) VerificationPolicy {
+	return VerificationPolicyFunc(func(b blocks.Block) error {
+		for _, p := range policies {
+			if err := p.VerifyBlock(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// verifyBlock returns a [RejectedBlockError] if policy rejects b.
+func verifyBlock(policy VerificationPolicy, b blocks.Block) error {
+	if policy == nil {
+		return nil
+	}
+	if err := policy.VerifyBlock(b); err != nil {
+		return &RejectedBlockError{Cid: b.Cid(), Err: err}
+	}
+	return nil
+}
+
+// grabVerificationPolicyFromBlockservice returns nil if bs has no policy.
+func grabVerificationPolicyFromBlockservice(bs BlockService) VerificationPolicy {
+	if vbs, ok := bs.(interface{ VerificationPolicy() VerificationPolicy }); ok {
+		return vbs.VerificationPolicy()
+	}
+	return nil
+}
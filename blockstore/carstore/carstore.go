@@ -0,0 +1,540 @@
+// Package carstore implements a blockstore backed by a directory of CARv2
+// files.
+//
+// Blocks are appended to an active CAR file. When it reaches the maximum size
+// (see [WithMaxCARSize]) it is finalized, and a new active file is started.
+// Finalized files are never modified again: deleted blocks are recorded in a
+// journal, and small or mostly deleted files are merged into new files by
+// [Store.Compact]. This makes snapshots cheap (see [Store.Snapshot]) and the
+// directory friendly to incremental copies, e.g. with rsync.
+//
+// A combined index of the blocks of all files is kept in memory, and rebuilt
+// from the indexes of the CAR files when the store is opened.
+package carstore
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
+	carv2 "github.com/ipld/go-car/v2"
+	carbs "github.com/ipld/go-car/v2/blockstore"
+	"github.com/ipld/go-car/v2/index"
+	"github.com/multiformats/go-multihash"
+)
+
+var logger = logging.Logger("blockstore/carstore")
+
+const (
+	carExt     = ".car"
+	tmpExt     = ".tmp"
+	journalExt = ".journal"
+
+	journalName = "deleted" + journalExt
+)
+
+// ErrClosed is returned by the operations of a closed [Store].
+var ErrClosed = errors.New("carstore: closed")
+
+// placeholderRoot is the root of all CAR files, since the CAR format requires
+// at least one. It is the identity CID of empty data.
+var placeholderRoot = func() cid.Cid {
+	mh, err := multihash.Sum(nil, multihash.IDENTITY, -1)
+	if err != nil {
+		panic(err)
+	}
+	return cid.NewCidV1(cid.Raw, mh)
+}()
+
+// carOptions are the options of all CAR files of a store. Identity CIDs are
+// stored as other blocks, so that the store behaves as the default blockstore.
+var carOptions = []carv2.Option{carv2.StoreIdentityCIDs(true)}
+
+// carFile is a finalized CAR file.
+type carFile struct {
+	id   uint64
+	ro   *carbs.ReadOnly
+	size int64
+	// blocks is the number of blocks in the file, and live the number of
+	// those that are in the combined index.
+	blocks int
+	live   int
+}
+
+// activeFile is the CAR file blocks are appended to.
+type activeFile struct {
+	id     uint64
+	rw     *carbs.ReadWrite
+	size   int64
+	blocks int
+	live   int
+}
+
+// Store is a [blockstore.Blockstore] backed by a directory of CARv2 files.
+type Store struct {
+	dir  string
+	opts options
+
+	rehash atomic.Bool
+
+	lk     sync.RWMutex
+	closed bool
+	files  map[uint64]*carFile
+	active *activeFile
+	nextID uint64
+	// index maps the multihash of each block to the ID of the file holding
+	// it.
+	index map[string]uint64
+	// deleted holds the multihashes of the deleted blocks that may still be
+	// in a file.
+	deleted map[string]struct{}
+	journal *journal
+
+	// compactLk serializes compactions and snapshots.
+	compactLk sync.Mutex
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+var _ blockstore.Blockstore = (*Store)(nil)
+
+// Open opens the store in dir, creating the directory if needed. Files that
+// were not finalized, e.g. after a crash, are finalized, and a new active file
+// is started. Close must be called to finalize the active file.
+func Open(dir string, opts ...Option) (*Store, error) {
+	s := &Store{
+		dir:     dir,
+		opts:    defaultOptions(),
+		files:   make(map[uint64]*carFile),
+		index:   make(map[string]uint64),
+		deleted: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	if err := s.startActive(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	if s.opts.compactionInterval > 0 {
+		var ctx context.Context
+		ctx, s.cancel = context.WithCancel(context.Background())
+		s.wg.Add(1)
+		go s.compactLoop(ctx)
+	}
+	return s, nil
+}
+
+// load opens the files of the directory and builds the combined index.
+func (s *Store) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasSuffix(name, tmpExt):
+			// Left over by an interrupted compaction or snapshot.
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+		case strings.HasSuffix(name, carExt):
+			id, err := strconv.ParseUint(strings.TrimSuffix(name, carExt), 16, 64)
+			if err != nil {
+				logger.Warnf("ignoring unexpected file %s", name)
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		f, err := s.openFile(id)
+		if err != nil {
+			return err
+		}
+		if err := s.addFile(f); err != nil {
+			return fmt.Errorf("could not read the index of %s: %w", s.path(id), err)
+		}
+		s.nextID = id + 1
+	}
+
+	s.journal, err = openJournal(filepath.Join(s.dir, journalName))
+	if err != nil {
+		return err
+	}
+	return s.journal.replay(func(mh string, deleted bool) {
+		if !deleted {
+			delete(s.deleted, mh)
+			return
+		}
+		s.deleted[mh] = struct{}{}
+		if id, ok := s.index[mh]; ok {
+			delete(s.index, mh)
+			s.files[id].live--
+		}
+	})
+}
+
+// openFile opens a CAR file of the directory, finalizing it first if needed.
+func (s *Store) openFile(id uint64) (*carFile, error) {
+	path := s.path(id)
+	finalized, err := isFinalized(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	if !finalized {
+		logger.Infof("finalizing %s", path)
+		rw, err := carbs.OpenReadWrite(path, []cid.Cid{placeholderRoot}, carOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("could not resume %s: %w", path, err)
+		}
+		if err := rw.Finalize(); err != nil {
+			return nil, fmt.Errorf("could not finalize %s: %w", path, err)
+		}
+	}
+	return openReadOnly(id, path)
+}
+
+func openReadOnly(id uint64, path string) (*carFile, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	ro, err := carbs.OpenReadOnly(path, carOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	return &carFile{id: id, ro: ro, size: st.Size()}, nil
+}
+
+// isFinalized returns true if the CARv2 header of the file at path has been
+// written, which is only done when the file is finalized. Until then, the
+// header is zeroed.
+func isFinalized(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if version, err := carv2.ReadVersion(f); err != nil {
+		return false, err
+	} else if version != 2 {
+		return false, fmt.Errorf("unexpected CAR version %d", version)
+	}
+	// The header starts with 16 bytes of characteristics, followed by the
+	// offset and the size of the data payload.
+	var header [carv2.HeaderSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return false, err
+	}
+	return binary.LittleEndian.Uint64(header[24:32]) != 0, nil
+}
+
+// addFile adds the blocks of f that are not in the combined index yet.
+func (s *Store) addFile(f *carFile) error {
+	s.files[f.id] = f
+	return f.forEach(func(mh multihash.Multihash) error {
+		f.blocks++
+		if _, ok := s.index[string(mh)]; !ok {
+			s.index[string(mh)] = f.id
+			f.live++
+		}
+		return nil
+	})
+}
+
+// forEach calls fn with the multihash of each block of the file.
+func (f *carFile) forEach(fn func(multihash.Multihash) error) error {
+	idx, ok := f.ro.Index().(index.IterableIndex)
+	if !ok {
+		return fmt.Errorf("index of type %s cannot be iterated", f.ro.Index().Codec())
+	}
+	return idx.ForEach(func(mh multihash.Multihash, _ uint64) error {
+		return fn(mh)
+	})
+}
+
+// startActive starts a new active file.
+func (s *Store) startActive() error {
+	id := s.nextID
+	rw, err := carbs.OpenReadWrite(s.path(id), []cid.Cid{placeholderRoot}, carOptions...)
+	if err != nil {
+		return err
+	}
+	s.nextID++
+	s.active = &activeFile{id: id, rw: rw}
+	return nil
+}
+
+// rotate finalizes the active file and starts a new one. It must be called
+// with lk held.
+func (s *Store) rotate() error {
+	a := s.active
+	if err := a.rw.Finalize(); err != nil {
+		return err
+	}
+	f, err := openReadOnly(a.id, s.path(a.id))
+	if err != nil {
+		return err
+	}
+	f.blocks, f.live = a.blocks, a.live
+	s.files[f.id] = f
+	return s.startActive()
+}
+
+func (s *Store) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, carExt))
+}
+
+// lookup returns the file holding the block of c. It must be called with lk
+// held.
+func (s *Store) lookup(c cid.Cid) (blockstore.Blockstore, bool) {
+	id, ok := s.index[string(c.Hash())]
+	if !ok {
+		return nil, false
+	}
+	if id == s.active.id {
+		return s.active.rw, true
+	}
+	return s.files[id].ro, true
+}
+
+func (s *Store) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	if s.closed {
+		return false, ErrClosed
+	}
+	_, ok := s.index[string(c.Hash())]
+	return ok, nil
+}
+
+func (s *Store) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if !c.Defined() {
+		logger.Error("undefined cid in blockstore")
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	f, ok := s.lookup(c)
+	if !ok {
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+	blk, err := f.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if s.rehash.Load() {
+		rbcid, err := c.Prefix().Sum(blk.RawData())
+		if err != nil {
+			return nil, err
+		}
+		if !rbcid.Equals(c) {
+			return nil, blockstore.ErrHashMismatch
+		}
+	}
+	return blk, nil
+}
+
+func (s *Store) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	if s.closed {
+		return -1, ErrClosed
+	}
+	f, ok := s.lookup(c)
+	if !ok {
+		return -1, ipld.ErrNotFound{Cid: c}
+	}
+	return f.GetSize(ctx, c)
+}
+
+func (s *Store) Put(ctx context.Context, blk blocks.Block) error {
+	return s.PutMany(ctx, []blocks.Block{blk})
+}
+
+func (s *Store) PutMany(ctx context.Context, blks []blocks.Block) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	for _, blk := range blks {
+		mh := string(blk.Cid().Hash())
+		if _, ok := s.index[mh]; ok {
+			continue
+		}
+		if s.active.size >= s.opts.maxCARSize {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		// The block may be in the active file already, if it was deleted.
+		stored, err := s.active.rw.Has(ctx, blk.Cid())
+		if err != nil {
+			return err
+		}
+		if !stored {
+			if err := s.active.rw.Put(ctx, blk); err != nil {
+				return err
+			}
+			s.active.size += int64(len(blk.Cid().Bytes()) + len(blk.RawData()))
+			s.active.blocks++
+		}
+		if _, ok := s.deleted[mh]; ok {
+			if err := s.journal.append(mh, false); err != nil {
+				return err
+			}
+			delete(s.deleted, mh)
+		}
+		s.index[mh] = s.active.id
+		s.active.live++
+	}
+	return nil
+}
+
+// DeleteBlock removes the block from the index. Its data stays in its CAR
+// file until the file is compacted.
+func (s *Store) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	mh := string(c.Hash())
+	id, ok := s.index[mh]
+	if !ok {
+		return nil
+	}
+	if err := s.journal.append(mh, true); err != nil {
+		return err
+	}
+	delete(s.index, mh)
+	s.deleted[mh] = struct{}{}
+	if id == s.active.id {
+		s.active.live--
+	} else {
+		s.files[id].live--
+	}
+	return nil
+}
+
+// AllKeysChan returns the CIDs of the blocks in the store, with the raw codec.
+func (s *Store) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	s.lk.RLock()
+	if s.closed {
+		s.lk.RUnlock()
+		return nil, ErrClosed
+	}
+	keys := make([]string, 0, len(s.index))
+	for mh := range s.index {
+		keys = append(keys, mh)
+	}
+	s.lk.RUnlock()
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		for _, mh := range keys {
+			select {
+			case out <- cid.NewCidV1(cid.Raw, multihash.Multihash(mh)):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *Store) HashOnRead(enabled bool) {
+	s.rehash.Store(enabled)
+}
+
+// Seal finalizes the active file, if it holds blocks, and starts a new one, so
+// that all the blocks put so far are in finalized files.
+func (s *Store) Seal() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if s.active.blocks == 0 {
+		return nil
+	}
+	return s.rotate()
+}
+
+// Close stops the background compaction and finalizes the active file. The
+// active file is removed if it holds no blocks.
+func (s *Store) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	if a := s.active; a.blocks == 0 {
+		a.rw.Discard()
+		err = os.Remove(s.path(a.id))
+	} else {
+		err = a.rw.Finalize()
+	}
+	s.active = nil
+	return errors.Join(err, s.closeFiles())
+}
+
+func (s *Store) closeFiles() error {
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.ro.Close())
+	}
+	if s.active != nil {
+		s.active.rw.Discard()
+	}
+	if s.journal != nil {
+		errs = append(errs, s.journal.close())
+	}
+	return errors.Join(errs...)
+}
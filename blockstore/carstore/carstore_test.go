@@ -0,0 +1,243 @@
+package carstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/stretchr/testify/require"
+)
+
+var bg = context.Background()
+
+func makeBlocks(n int) []blocks.Block {
+	blks := make([]blocks.Block, n)
+	for i := range blks {
+		blks[i] = blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+	}
+	return blks
+}
+
+func carFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), carExt) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func requireBlocks(t *testing.T, s *Store, present, absent []blocks.Block) {
+	t.Helper()
+	for _, blk := range present {
+		got, err := s.Get(bg, blk.Cid())
+		require.NoError(t, err)
+		require.Equal(t, blk.RawData(), got.RawData())
+		size, err := s.GetSize(bg, blk.Cid())
+		require.NoError(t, err)
+		require.Equal(t, len(blk.RawData()), size)
+	}
+	for _, blk := range absent {
+		has, err := s.Has(bg, blk.Cid())
+		require.NoError(t, err)
+		require.False(t, has)
+		_, err = s.Get(bg, blk.Cid())
+		require.True(t, ipld.IsNotFound(err))
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	blks := makeBlocks(10)
+	require.NoError(t, s.PutMany(bg, blks))
+	require.NoError(t, s.DeleteBlock(bg, blks[0].Cid()))
+	requireBlocks(t, s, blks[1:], blks[:1])
+
+	// Keys are matched by multihash.
+	raw := cid.NewCidV1(cid.Raw, blks[1].Cid().Hash())
+	has, err := s.Has(bg, raw)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	keys, err := s.AllKeysChan(bg)
+	require.NoError(t, err)
+	var n int
+	for range keys {
+		n++
+	}
+	require.Equal(t, 9, n)
+
+	require.NoError(t, s.Close())
+	_, err = s.Get(bg, blks[1].Cid())
+	require.ErrorIs(t, err, ErrClosed)
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+	requireBlocks(t, s, blks[1:], blks[:1])
+
+	// Put again after deletion.
+	require.NoError(t, s.Put(bg, blks[0]))
+	requireBlocks(t, s, blks, nil)
+}
+
+func TestStoreRotate(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, WithMaxCARSize(100))
+	require.NoError(t, err)
+
+	blks := makeBlocks(20)
+	for _, blk := range blks {
+		require.NoError(t, s.Put(bg, blk))
+	}
+	requireBlocks(t, s, blks, nil)
+	require.Greater(t, len(carFiles(t, dir)), 2)
+
+	require.NoError(t, s.Close())
+	s, err = Open(dir, WithMaxCARSize(100))
+	require.NoError(t, err)
+	defer s.Close()
+	requireBlocks(t, s, blks, nil)
+}
+
+func TestStoreResumeUnfinalized(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	blks := makeBlocks(5)
+	require.NoError(t, s.PutMany(bg, blks))
+	require.NoError(t, s.DeleteBlock(bg, blks[0].Cid()))
+
+	// Simulate a crash, leaving the active file unfinalized.
+	s.active.rw.Discard()
+	require.NoError(t, s.journal.close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+	requireBlocks(t, s, blks[1:], blks[:1])
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, WithMaxCARSize(1<<20), WithCompactionMinSize(1<<16))
+	require.NoError(t, err)
+
+	blks := makeBlocks(30)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.PutMany(bg, blks[i*10:(i+1)*10]))
+		require.NoError(t, s.Seal())
+	}
+	for _, blk := range blks[:5] {
+		require.NoError(t, s.DeleteBlock(bg, blk.Cid()))
+	}
+	require.Len(t, carFiles(t, dir), 4)
+
+	require.NoError(t, s.Compact(bg))
+	// The three small files are merged, next to the active file.
+	require.Len(t, carFiles(t, dir), 2)
+	requireBlocks(t, s, blks[5:], blks[:5])
+	require.Empty(t, s.deleted)
+
+	// Nothing to do.
+	require.NoError(t, s.Compact(bg))
+	require.Len(t, carFiles(t, dir), 2)
+
+	require.NoError(t, s.Close())
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+	requireBlocks(t, s, blks[5:], blks[:5])
+}
+
+func TestStoreCompactSparse(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, WithCompactionMinSize(0))
+	require.NoError(t, err)
+	defer s.Close()
+
+	blks := makeBlocks(10)
+	require.NoError(t, s.PutMany(bg, blks))
+	require.NoError(t, s.Seal())
+
+	for _, blk := range blks[:4] {
+		require.NoError(t, s.DeleteBlock(bg, blk.Cid()))
+	}
+	// 60% of the blocks are live.
+	require.NoError(t, s.Compact(bg))
+	require.Len(t, s.deleted, 4)
+
+	require.NoError(t, s.DeleteBlock(bg, blks[4].Cid()))
+	require.NoError(t, s.DeleteBlock(bg, blks[5].Cid()))
+	require.NoError(t, s.Compact(bg))
+	require.Empty(t, s.deleted)
+	requireBlocks(t, s, blks[6:], blks[:6])
+}
+
+func TestStoreCompactConcurrentDelete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, WithMaxCARSize(1<<20), WithCompactionMinSize(1<<16))
+	require.NoError(t, err)
+	defer s.Close()
+
+	blks := makeBlocks(20)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, s.PutMany(bg, blks[i*10:(i+1)*10]))
+		require.NoError(t, s.Seal())
+	}
+
+	// Run the steps of Compact, deleting blocks once they are copied.
+	candidates, err := s.compactionCandidates()
+	require.NoError(t, err)
+	require.Len(t, candidates, 2)
+	w := &compactWriter{s: s}
+	for _, f := range candidates {
+		require.NoError(t, s.copyLive(bg, f, w))
+	}
+	outputs, err := w.finish()
+	require.NoError(t, err)
+	for _, blk := range blks[:5] {
+		require.NoError(t, s.DeleteBlock(bg, blk.Cid()))
+	}
+	require.NoError(t, s.swap(candidates, outputs))
+
+	requireBlocks(t, s, blks[5:], blks[:5])
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	blks := makeBlocks(10)
+	require.NoError(t, s.PutMany(bg, blks))
+	require.NoError(t, s.DeleteBlock(bg, blks[0].Cid()))
+
+	dst := filepath.Join(t.TempDir(), "snapshot")
+	require.NoError(t, s.Snapshot(dst))
+
+	// Changes after the snapshot are not in it.
+	require.NoError(t, s.DeleteBlock(bg, blks[1].Cid()))
+	more := makeBlocks(12)[10:]
+	require.NoError(t, s.PutMany(bg, more))
+
+	snap, err := Open(dst)
+	require.NoError(t, err)
+	defer snap.Close()
+	requireBlocks(t, snap, blks[1:], append(blks[:1:1], more...))
+}
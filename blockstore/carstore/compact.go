@@ -0,0 +1,358 @@
+package carstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	carbs "github.com/ipld/go-car/v2/blockstore"
+	"github.com/multiformats/go-multihash"
+)
+
+// Compact merges the finalized CAR files smaller than the minimum size (see
+// [WithCompactionMinSize]), and the files with too few live blocks (see
+// [WithCompactionMinLive]), into new files without the deleted blocks. Reads
+// and writes proceed while the new files are written.
+func (s *Store) Compact(ctx context.Context) error {
+	s.compactLk.Lock()
+	defer s.compactLk.Unlock()
+
+	candidates, err := s.compactionCandidates()
+	if err != nil || len(candidates) == 0 {
+		return err
+	}
+	logger.Debugf("compacting %d files", len(candidates))
+
+	w := &compactWriter{s: s}
+	for _, f := range candidates {
+		if err := s.copyLive(ctx, f, w); err != nil {
+			w.discard()
+			return err
+		}
+	}
+	outputs, err := w.finish()
+	if err != nil {
+		w.discard()
+		return err
+	}
+	return s.swap(candidates, outputs)
+}
+
+// compactionCandidates returns the finalized files to compact.
+func (s *Store) compactionCandidates() ([]*carFile, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	var candidates []*carFile
+	for _, f := range s.files {
+		small := f.size < s.opts.compactionMinSize
+		sparse := f.blocks > 0 && float64(f.live)/float64(f.blocks) < s.opts.compactionMinLive
+		if small || sparse {
+			candidates = append(candidates, f)
+		}
+	}
+	// Rewriting a single file without deleted blocks would not change
+	// anything.
+	if len(candidates) == 1 && candidates[0].live == candidates[0].blocks {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].id < candidates[j].id })
+	return candidates, nil
+}
+
+// copyLive writes the blocks of f that are in the combined index to w.
+func (s *Store) copyLive(ctx context.Context, f *carFile, w *compactWriter) error {
+	var mhs []multihash.Multihash
+	err := f.forEach(func(mh multihash.Multihash) error {
+		mhs = append(mhs, mh)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, mh := range mhs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		blk, err := s.getLive(ctx, f, mh)
+		if err != nil {
+			return err
+		}
+		if blk == nil {
+			continue
+		}
+		if err := w.put(ctx, blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLive returns the block of mh from f, or nil if the combined index does
+// not point to f.
+func (s *Store) getLive(ctx context.Context, f *carFile, mh multihash.Multihash) (blocks.Block, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if id, ok := s.index[string(mh)]; !ok || id != f.id {
+		return nil, nil
+	}
+	return f.ro.Get(ctx, cid.NewCidV1(cid.Raw, mh))
+}
+
+// compactOutput is a file written by a compaction.
+type compactOutput struct {
+	id   uint64
+	mhs  []string
+	size int64
+}
+
+// compactWriter writes the output files of a compaction, under temporary
+// names, starting a new file whenever the maximum size is reached.
+type compactWriter struct {
+	s       *Store
+	rw      *carbs.ReadWrite
+	cur     *compactOutput
+	outputs []*compactOutput
+}
+
+func (w *compactWriter) put(ctx context.Context, blk blocks.Block) error {
+	if w.cur != nil && w.cur.size >= w.s.opts.maxCARSize {
+		if err := w.finalize(); err != nil {
+			return err
+		}
+	}
+	if w.cur == nil {
+		w.s.lk.Lock()
+		id := w.s.nextID
+		w.s.nextID++
+		w.s.lk.Unlock()
+
+		rw, err := carbs.OpenReadWrite(w.s.path(id)+tmpExt, []cid.Cid{placeholderRoot}, carOptions...)
+		if err != nil {
+			return err
+		}
+		w.rw = rw
+		w.cur = &compactOutput{id: id}
+		w.outputs = append(w.outputs, w.cur)
+	}
+
+	if err := w.rw.Put(ctx, blk); err != nil {
+		return err
+	}
+	w.cur.mhs = append(w.cur.mhs, string(blk.Cid().Hash()))
+	w.cur.size += int64(len(blk.Cid().Bytes()) + len(blk.RawData()))
+	return nil
+}
+
+func (w *compactWriter) finalize() error {
+	err := w.rw.Finalize()
+	w.rw, w.cur = nil, nil
+	return err
+}
+
+// finish finalizes the output files and renames them to their final names.
+func (w *compactWriter) finish() ([]*compactOutput, error) {
+	if w.rw != nil {
+		if err := w.finalize(); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range w.outputs {
+		path := w.s.path(out.id)
+		if err := os.Rename(path+tmpExt, path); err != nil {
+			return nil, err
+		}
+	}
+	return w.outputs, nil
+}
+
+// discard removes the output files.
+func (w *compactWriter) discard() {
+	if w.rw != nil {
+		w.rw.Discard()
+	}
+	for _, out := range w.outputs {
+		path := w.s.path(out.id)
+		os.Remove(path + tmpExt)
+		os.Remove(path)
+	}
+}
+
+// swap replaces the compacted files with the output files in the combined
+// index, removes them, and drops the journal records of the deleted blocks
+// that are no longer in any file.
+//
+// If the process stops before the compacted files are removed, their blocks
+// are duplicated in the output files, which is harmless. The journal is only
+// rewritten after the compacted files are removed, so that deleted blocks
+// cannot reappear.
+func (s *Store) swap(compacted []*carFile, outputs []*compactOutput) error {
+	files := make([]*carFile, 0, len(outputs))
+	for _, out := range outputs {
+		f, err := openReadOnly(out.id, s.path(out.id))
+		if err != nil {
+			for _, f := range files {
+				f.ro.Close()
+			}
+			return err
+		}
+		f.blocks = len(out.mhs)
+		files = append(files, f)
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		for _, f := range files {
+			f.ro.Close()
+		}
+		return ErrClosed
+	}
+
+	old := make(map[uint64]struct{}, len(compacted))
+	for _, f := range compacted {
+		old[f.id] = struct{}{}
+	}
+	for i, f := range files {
+		s.files[f.id] = f
+		for _, mh := range outputs[i].mhs {
+			// Blocks deleted or written again meanwhile are not moved.
+			if id, ok := s.index[mh]; ok {
+				if _, ok := old[id]; ok {
+					s.index[mh] = f.id
+					f.live++
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, f := range compacted {
+		delete(s.files, f.id)
+		errs = append(errs, f.ro.Close(), os.Remove(s.path(f.id)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("could not remove compacted files: %w", err)
+	}
+
+	keep := make([]string, 0, len(s.deleted))
+	for mh := range s.deleted {
+		stored, err := s.stored(multihash.Multihash(mh))
+		if err != nil {
+			return err
+		}
+		if stored {
+			keep = append(keep, mh)
+		} else {
+			delete(s.deleted, mh)
+		}
+	}
+	return s.journal.rewrite(keep)
+}
+
+// stored returns true if any file holds the block of mh. It must be called
+// with lk held.
+func (s *Store) stored(mh multihash.Multihash) (bool, error) {
+	c := cid.NewCidV1(cid.Raw, mh)
+	if has, err := s.active.rw.Has(context.Background(), c); err != nil || has {
+		return has, err
+	}
+	for _, f := range s.files {
+		if has, err := f.ro.Has(context.Background(), c); err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) compactLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.opts.compactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Compact(ctx); err != nil && ctx.Err() == nil {
+				logger.Errorf("compaction failed: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Snapshot writes a copy of the store to the directory dst, which can be
+// opened with [Open]. The active file is sealed first (see [Store.Seal]), and
+// the finalized files are hard-linked into dst, or copied if they cannot be
+// linked, e.g. across file systems.
+func (s *Store) Snapshot(dst string) error {
+	s.compactLk.Lock()
+	defer s.compactLk.Unlock()
+
+	if err := s.Seal(); err != nil {
+		return err
+	}
+
+	s.lk.RLock()
+	paths := make([]string, 0, len(s.files))
+	for id := range s.files {
+		paths = append(paths, s.path(id))
+	}
+	journal, err := os.ReadFile(s.journal.f.Name())
+	s.lk.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := linkOrCopy(path, filepath.Join(dst, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(filepath.Join(dst, journalName), journal)
+}
+
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + tmpExt
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,155 @@
+package carstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	opDelete byte = 'd'
+	opPut    byte = 'p'
+
+	maxMultihashSize = 1 << 12
+)
+
+// journal is an append-only log of the blocks deleted from, and put again in,
+// the store. Each record is an operation byte followed by the
+// varint-length-prefixed multihash of the block.
+type journal struct {
+	f *os.File
+}
+
+func openJournal(path string) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f}, nil
+}
+
+// replay calls fn for each record, in order. A truncated record at the end of
+// the journal, left by an interrupted write, is removed.
+func (j *journal) replay(fn func(mh string, deleted bool)) error {
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(j.f)
+
+	var valid int64
+	for {
+		mh, deleted, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			logger.Warnf("removing truncated record at the end of %s", j.f.Name())
+			if err := j.f.Truncate(valid); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fn(mh, deleted)
+		valid += n
+	}
+
+	_, err := j.f.Seek(valid, io.SeekStart)
+	return err
+}
+
+func readRecord(r *bufio.Reader) (mh string, deleted bool, n int64, err error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return "", false, 0, err
+	}
+	if op != opDelete && op != opPut {
+		return "", false, 0, errors.New("carstore: corrupt journal")
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", false, 0, err
+	}
+	if size > maxMultihashSize {
+		return "", false, 0, errors.New("carstore: corrupt journal")
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", false, 0, err
+	}
+	return string(buf), op == opDelete, int64(1 + varintSize(size) + len(buf)), nil
+}
+
+func varintSize(x uint64) int {
+	return len(binary.AppendUvarint(nil, x))
+}
+
+func appendRecord(buf []byte, mh string, deleted bool) []byte {
+	op := opPut
+	if deleted {
+		op = opDelete
+	}
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(mh)))
+	return append(buf, mh...)
+}
+
+func (j *journal) append(mh string, deleted bool) error {
+	_, err := j.f.Write(appendRecord(nil, mh, deleted))
+	return err
+}
+
+// rewrite atomically replaces the journal with the deletion of each of mhs.
+func (j *journal) rewrite(mhs []string) error {
+	var buf []byte
+	for _, mh := range mhs {
+		buf = appendRecord(buf, mh, true)
+	}
+
+	path := j.f.Name()
+	if err := writeFileAtomic(path, buf); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	j.f.Close()
+	j.f = f
+	return nil
+}
+
+func (j *journal) close() error {
+	return j.f.Close()
+}
+
+// writeFileAtomic writes data to a temporary file that is renamed to path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + tmpExt
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,68 @@
+package carstore
+
+import "time"
+
+const (
+	// DefaultMaxCARSize is the default size at which the active CAR file is
+	// finalized.
+	DefaultMaxCARSize = 128 << 20
+	// DefaultCompactionMinLive is the default fraction of live blocks under
+	// which a CAR file is compacted.
+	DefaultCompactionMinLive = 0.5
+)
+
+type options struct {
+	maxCARSize         int64
+	compactionMinSize  int64
+	compactionMinLive  float64
+	compactionInterval time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		maxCARSize:        DefaultMaxCARSize,
+		compactionMinSize: DefaultMaxCARSize / 4,
+		compactionMinLive: DefaultCompactionMinLive,
+	}
+}
+
+// Option configures a [Store].
+type Option func(*options)
+
+// WithMaxCARSize sets the size at which the active CAR file is finalized and a
+// new one is started, and the maximum size of the files written by
+// compactions. Defaults to [DefaultMaxCARSize].
+//
+// The files smaller than a quarter of the maximum size are merged by
+// compactions, unless [WithCompactionMinSize] is set.
+func WithMaxCARSize(size int64) Option {
+	return func(o *options) {
+		o.maxCARSize = size
+		o.compactionMinSize = size / 4
+	}
+}
+
+// WithCompactionMinSize sets the size under which finalized CAR files are
+// merged by compactions. It must be set after [WithMaxCARSize].
+func WithCompactionMinSize(size int64) Option {
+	return func(o *options) {
+		o.compactionMinSize = size
+	}
+}
+
+// WithCompactionMinLive sets the fraction of live blocks, in [0, 1], under
+// which finalized CAR files are rewritten by compactions to reclaim the space
+// of deleted blocks. Defaults to [DefaultCompactionMinLive].
+func WithCompactionMinLive(fraction float64) Option {
+	return func(o *options) {
+		o.compactionMinLive = fraction
+	}
+}
+
+// WithCompactionInterval runs [Store.Compact] in the background at the given
+// interval. Background compaction is disabled by default.
+func WithCompactionInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.compactionInterval = interval
+	}
+}
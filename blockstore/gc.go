@@ -0,0 +1,308 @@
+package blockstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// GetLinks returns the CIDs linked from the block with the given CID. It is
+// used by [SnapshotGCBlockstore] to walk DAGs, and must only read local
+// blocks.
+type GetLinks func(ctx context.Context, c cid.Cid) ([]cid.Cid, error)
+
+// GCRoots are the roots of the mark set of a garbage collection, e.g. the pins
+// of a pinner.
+type GCRoots struct {
+	// Recursive roots are kept along with all their descendants.
+	Recursive []cid.Cid
+	// Direct roots are kept without their descendants.
+	Direct []cid.Cid
+}
+
+// GCRootsFunc returns the roots of a garbage collection. It is called by
+// [SnapshotGCBlockstore.GC] once the collection is running, so that the
+// blocks of the roots added meanwhile, e.g. of a pin, are marked when they
+// are accessed.
+type GCRootsFunc func(ctx context.Context) (GCRoots, error)
+
+// GCResult is a block removed by a garbage collection, or the error that
+// stopped it.
+type GCResult struct {
+	Removed cid.Cid
+	Err     error
+}
+
+// SnapshotGCBlockstore is a [GCBlockstore] whose garbage collection does not
+// stall writes.
+//
+// Instead of locking the blockstore for the whole garbage collection, the mark
+// set is a snapshot of the roots and of the roots of in-flight sessions (see
+// [SnapshotGCBlockstore.Protect]) taken once the collection started, to which
+// every block accessed while the collection runs is added. Blocks are
+// only removed if they are in neither, so blocks written or read during the
+// collection, e.g. by an import that is not pinned yet, are kept until the
+// next one.
+//
+// The [GCLocker] methods are kept for compatibility with code that collects
+// garbage itself; [SnapshotGCBlockstore.GC] does not take the GC lock.
+type SnapshotGCBlockstore struct {
+	Blockstore
+	GCLocker
+
+	getLinks GetLinks
+
+	// gcLk ensures a single garbage collection runs at a time.
+	gcLk sync.Mutex
+	gc   atomic.Pointer[gcRun]
+	// opLk is held in read mode by every operation, and briefly in write
+	// mode when a garbage collection starts, so that the operations that
+	// did not see it are complete before the mark phase.
+	opLk sync.RWMutex
+
+	lk        sync.Mutex
+	protected map[cid.Cid]int
+}
+
+var _ GCBlockstore = (*SnapshotGCBlockstore)(nil)
+
+// NewSnapshotGCBlockstore returns a [SnapshotGCBlockstore] that walks DAGs with
+// getLinks.
+func NewSnapshotGCBlockstore(bs Blockstore, getLinks GetLinks) *SnapshotGCBlockstore {
+	return &SnapshotGCBlockstore{
+		Blockstore: bs,
+		GCLocker:   NewGCLocker(),
+		getLinks:   getLinks,
+		protected:  make(map[cid.Cid]int),
+	}
+}
+
+// gcRun is the mark set of a running garbage collection, keyed by multihash as
+// blocks are.
+type gcRun struct {
+	lk   sync.Mutex
+	live map[string]struct{}
+}
+
+// mark adds c to the mark set.
+func (r *gcRun) mark(c cid.Cid) {
+	r.lk.Lock()
+	r.live[string(c.Hash())] = struct{}{}
+	r.lk.Unlock()
+}
+
+// markDAG marks root and all its descendants. Nodes in visited are skipped.
+// Missing blocks are ignored if ignoreMissing is set.
+//
+// The mark set cannot be used to skip nodes, since it contains blocks that
+// were accessed, but whose descendants were not walked.
+func (r *gcRun) markDAG(ctx context.Context, getLinks GetLinks, root cid.Cid, visited *cid.Set, ignoreMissing bool) error {
+	stack := []cid.Cid{root}
+	for len(stack) != 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !visited.Visit(c) {
+			continue
+		}
+		r.mark(c)
+		links, err := getLinks(ctx, c)
+		if err != nil {
+			if ignoreMissing && ipld.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("could not get links of %s: %w", c, err)
+		}
+		stack = append(stack, links...)
+	}
+	return nil
+}
+
+// touch adds c to the mark set of the running garbage collection, if any. It
+// must be called before accessing the block.
+func (bs *SnapshotGCBlockstore) touch(c cid.Cid) {
+	if run := bs.gc.Load(); run != nil {
+		run.mark(c)
+	}
+}
+
+func (bs *SnapshotGCBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	bs.opLk.RLock()
+	defer bs.opLk.RUnlock()
+	bs.touch(c)
+	return bs.Blockstore.Has(ctx, c)
+}
+
+func (bs *SnapshotGCBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	bs.opLk.RLock()
+	defer bs.opLk.RUnlock()
+	bs.touch(c)
+	return bs.Blockstore.Get(ctx, c)
+}
+
+func (bs *SnapshotGCBlockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	bs.opLk.RLock()
+	defer bs.opLk.RUnlock()
+	bs.touch(c)
+	return bs.Blockstore.GetSize(ctx, c)
+}
+
+func (bs *SnapshotGCBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	bs.opLk.RLock()
+	defer bs.opLk.RUnlock()
+	bs.touch(blk.Cid())
+	return bs.Blockstore.Put(ctx, blk)
+}
+
+func (bs *SnapshotGCBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	bs.opLk.RLock()
+	defer bs.opLk.RUnlock()
+	if run := bs.gc.Load(); run != nil {
+		for _, blk := range blks {
+			run.mark(blk.Cid())
+		}
+	}
+	return bs.Blockstore.PutMany(ctx, blks)
+}
+
+// Protect adds roots to the mark set of garbage collections until release is
+// called, along with their descendants. It is meant for in-flight sessions,
+// e.g. an import, whose root is not pinned yet. If a garbage collection is
+// running, the DAGs of the roots are marked before Protect returns.
+func (bs *SnapshotGCBlockstore) Protect(ctx context.Context, roots ...cid.Cid) (release func(), err error) {
+	bs.lk.Lock()
+	for _, c := range roots {
+		bs.protected[c]++
+	}
+	bs.lk.Unlock()
+
+	release = func() {
+		bs.lk.Lock()
+		defer bs.lk.Unlock()
+		for _, c := range roots {
+			if bs.protected[c]--; bs.protected[c] == 0 {
+				delete(bs.protected, c)
+			}
+		}
+	}
+
+	if run := bs.gc.Load(); run != nil {
+		visited := cid.NewSet()
+		for _, c := range roots {
+			if err := run.markDAG(ctx, bs.getLinks, c, visited, true); err != nil {
+				release()
+				return nil, err
+			}
+		}
+	}
+	return release, nil
+}
+
+// GC removes the blocks that are not reachable from the roots returned by
+// roots, or from the protected roots, and that are not accessed while it
+// runs. roots is called once the collection is running, so that the roots
+// added before it returns are either listed, or have their blocks marked
+// when they are accessed. Removed blocks
+// are sent on the returned channel, which is closed when the collection is
+// done. If the DAG of a recursive root cannot be walked, nothing is removed and
+// the error is sent.
+//
+// Reads and writes proceed concurrently, they are only held back while the
+// operations in progress when the collection starts complete. Only one
+// collection runs at a time.
+func (bs *SnapshotGCBlockstore) GC(ctx context.Context, roots GCRootsFunc) <-chan GCResult {
+	out := make(chan GCResult, 128)
+	go func() {
+		defer close(out)
+
+		bs.gcLk.Lock()
+		defer bs.gcLk.Unlock()
+
+		run := &gcRun{live: make(map[string]struct{})}
+		bs.opLk.Lock()
+		bs.gc.Store(run)
+		bs.opLk.Unlock()
+		defer bs.gc.Store(nil)
+
+		emit := func(res GCResult) bool {
+			select {
+			case out <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		snapshot, err := roots(ctx)
+		if err != nil {
+			emit(GCResult{Err: fmt.Errorf("could not get the roots: %w", err)})
+			return
+		}
+
+		bs.lk.Lock()
+		protected := make([]cid.Cid, 0, len(bs.protected))
+		for c := range bs.protected {
+			protected = append(protected, c)
+		}
+		bs.lk.Unlock()
+
+		for _, c := range snapshot.Direct {
+			run.mark(c)
+		}
+		visited := cid.NewSet()
+		for _, c := range snapshot.Recursive {
+			if err := run.markDAG(ctx, bs.getLinks, c, visited, false); err != nil {
+				emit(GCResult{Err: err})
+				return
+			}
+		}
+		for _, c := range protected {
+			if err := run.markDAG(ctx, bs.getLinks, c, visited, true); err != nil {
+				emit(GCResult{Err: err})
+				return
+			}
+		}
+
+		keys, err := bs.Blockstore.AllKeysChan(ctx)
+		if err != nil {
+			emit(GCResult{Err: err})
+			return
+		}
+		for c := range keys {
+			removed, err := bs.sweep(ctx, run, c)
+			if err != nil {
+				if !emit(GCResult{Err: err}) {
+					return
+				}
+				continue
+			}
+			if removed && !emit(GCResult{Removed: c}) {
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			emit(GCResult{Err: ctx.Err()})
+		}
+	}()
+	return out
+}
+
+// sweep removes c if it is not marked. The mark set is locked until the block
+// is removed, so that blocks accessed concurrently are either marked in time,
+// or accessed after the removal.
+func (bs *SnapshotGCBlockstore) sweep(ctx context.Context, run *gcRun, c cid.Cid) (bool, error) {
+	run.lk.Lock()
+	defer run.lk.Unlock()
+	if _, ok := run.live[string(c.Hash())]; ok {
+		return false, nil
+	}
+	err := bs.Blockstore.DeleteBlock(ctx, c)
+	if err != nil && !ipld.IsNotFound(err) {
+		return false, fmt.Errorf("could not remove %s: %w", c, err)
+	}
+	return err == nil, nil
+}
@@ -0,0 +1,259 @@
+package blockstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+type testDAG struct {
+	bs    Blockstore
+	links map[cid.Cid][]cid.Cid
+	// hook is called when the links of a node are walked.
+	hook func(cid.Cid)
+}
+
+func (d *testDAG) getLinks(ctx context.Context, c cid.Cid) ([]cid.Cid, error) {
+	if d.hook != nil {
+		d.hook(c)
+	}
+	if has, err := d.bs.Has(ctx, c); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+	return d.links[c], nil
+}
+
+// node adds a block linking to children.
+func (d *testDAG) node(t *testing.T, name string, children ...cid.Cid) cid.Cid {
+	t.Helper()
+	blk := blocks.NewBlock([]byte(name))
+	if err := d.bs.Put(bg, blk); err != nil {
+		t.Fatal(err)
+	}
+	d.links[blk.Cid()] = children
+	return blk.Cid()
+}
+
+func newTestGC(t *testing.T) (*SnapshotGCBlockstore, *testDAG) {
+	dag := &testDAG{
+		bs:    NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore())),
+		links: make(map[cid.Cid][]cid.Cid),
+	}
+	return NewSnapshotGCBlockstore(dag.bs, dag.getLinks), dag
+}
+
+func staticRoots(roots GCRoots) GCRootsFunc {
+	return func(context.Context) (GCRoots, error) {
+		return roots, nil
+	}
+}
+
+func runGC(t *testing.T, gcbs *SnapshotGCBlockstore, roots GCRoots) int {
+	t.Helper()
+	var removed int
+	for res := range gcbs.GC(bg, staticRoots(roots)) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		removed++
+	}
+	return removed
+}
+
+func assertHas(t *testing.T, bs Blockstore, c cid.Cid, want bool) {
+	t.Helper()
+	has, err := bs.Has(bg, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has != want {
+		t.Fatalf("has %s = %t, expected %t", c, has, want)
+	}
+}
+
+func TestSnapshotGC(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+
+	leaf := dag.node(t, "leaf")
+	mid := dag.node(t, "mid", leaf)
+	root := dag.node(t, "root", mid)
+	directChild := dag.node(t, "direct child")
+	direct := dag.node(t, "direct", directChild)
+	garbage := dag.node(t, "garbage")
+
+	removed := runGC(t, gcbs, GCRoots{Recursive: []cid.Cid{root}, Direct: []cid.Cid{direct}})
+	if removed != 2 {
+		t.Fatalf("removed %d blocks, expected 2", removed)
+	}
+	for _, c := range []cid.Cid{leaf, mid, root, direct} {
+		assertHas(t, dag.bs, c, true)
+	}
+	assertHas(t, dag.bs, directChild, false)
+	assertHas(t, dag.bs, garbage, false)
+}
+
+func TestSnapshotGCMissingRecursiveRoot(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+
+	garbage := dag.node(t, "garbage")
+	missing := blocks.NewBlock([]byte("missing")).Cid()
+
+	var gotErr bool
+	for res := range gcbs.GC(bg, staticRoots(GCRoots{Recursive: []cid.Cid{missing}})) {
+		if res.Err == nil {
+			t.Fatalf("unexpected removal of %s", res.Removed)
+		}
+		gotErr = true
+	}
+	if !gotErr {
+		t.Fatal("expected an error")
+	}
+	assertHas(t, dag.bs, garbage, true)
+}
+
+func TestSnapshotGCKeepsAccessedBlocks(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+
+	root := dag.node(t, "root")
+	read := dag.node(t, "read")
+	written := blocks.NewBlock([]byte("written"))
+
+	// Access blocks while the mark phase runs.
+	dag.hook = func(cid.Cid) {
+		if _, err := gcbs.Get(bg, read); err != nil {
+			t.Error(err)
+		}
+		if err := gcbs.Put(bg, written); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if removed := runGC(t, gcbs, GCRoots{Recursive: []cid.Cid{root}}); removed != 0 {
+		t.Fatalf("removed %d blocks, expected 0", removed)
+	}
+	assertHas(t, dag.bs, read, true)
+	assertHas(t, dag.bs, written.Cid(), true)
+
+	// Blocks accessed during a collection are removed by the next one.
+	dag.hook = nil
+	if removed := runGC(t, gcbs, GCRoots{Recursive: []cid.Cid{root}}); removed != 2 {
+		t.Fatalf("removed %d blocks, expected 2", removed)
+	}
+}
+
+func TestSnapshotGCTouchedBlockChildren(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+
+	leaf := dag.node(t, "leaf")
+	mid := dag.node(t, "mid", leaf)
+	root := dag.node(t, "root", mid)
+
+	// mid is marked by a read before the walk reaches it, its children must
+	// still be walked.
+	dag.hook = func(c cid.Cid) {
+		if c.Equals(root) {
+			if _, err := gcbs.Has(bg, mid); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if removed := runGC(t, gcbs, GCRoots{Recursive: []cid.Cid{root}}); removed != 0 {
+		t.Fatalf("removed %d blocks, expected 0", removed)
+	}
+	assertHas(t, dag.bs, leaf, true)
+}
+
+func TestSnapshotGCProtect(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+
+	leaf := dag.node(t, "leaf")
+	root := dag.node(t, "root", leaf)
+	later := dag.node(t, "later", dag.node(t, "later child"))
+
+	release, err := gcbs.Protect(bg, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Protect later while the collection runs.
+	var (
+		releaseLater func()
+		protected    bool
+	)
+	dag.hook = func(c cid.Cid) {
+		if protected {
+			return
+		}
+		protected = true
+		var err error
+		releaseLater, err = gcbs.Protect(bg, later)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if removed := runGC(t, gcbs, GCRoots{}); removed != 0 {
+		t.Fatalf("removed %d blocks, expected 0", removed)
+	}
+
+	dag.hook = nil
+	release()
+	releaseLater()
+	if removed := runGC(t, gcbs, GCRoots{}); removed != 4 {
+		t.Fatalf("removed %d blocks, expected 4", removed)
+	}
+}
+
+func TestSnapshotGCCancel(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+	for i := 0; i < 10; i++ {
+		dag.node(t, fmt.Sprint("garbage ", i))
+	}
+
+	ctx, cancel := context.WithCancel(bg)
+	cancel()
+	for res := range gcbs.GC(ctx, staticRoots(GCRoots{})) {
+		if res.Err == nil {
+			continue
+		}
+	}
+	// A new collection can run after the cancelled one.
+	runGC(t, gcbs, GCRoots{})
+}
+
+func TestSnapshotGCRootsListedWhileRunning(t *testing.T) {
+	gcbs, dag := newTestGC(t)
+
+	unpinned := dag.node(t, "unpinned")
+	pinned := dag.node(t, "pinned")
+
+	// A pin added while the roots are listed, and missed by the listing, has
+	// its blocks read by the pinner, which marks them.
+	roots := func(ctx context.Context) (GCRoots, error) {
+		if _, err := gcbs.Get(ctx, pinned); err != nil {
+			return GCRoots{}, err
+		}
+		return GCRoots{}, nil
+	}
+	var removed int
+	for res := range gcbs.GC(bg, roots) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		removed++
+	}
+	if removed != 1 {
+		t.Fatalf("removed %d blocks, expected 1", removed)
+	}
+	assertHas(t, dag.bs, pinned, true)
+	assertHas(t, dag.bs, unpinned, false)
+}
@@ -21,6 +21,9 @@ var (
 	_ io.Closer  = (*idstore)(nil)
 )
 
+// NewIdStore returns a [Blockstore] answering the reads of the blocks with an
+// identity multihash from their CID, without touching bs, and not storing
+// them. See [InlineBuilder] to create such CIDs for small blocks.
 func NewIdStore(bs Blockstore) Blockstore {
 	ids := &idstore{bs: bs}
 	if v, ok := bs.(Viewer); ok {
@@ -29,6 +32,28 @@ func NewIdStore(bs Blockstore) Blockstore {
 	return ids
 }
 
+// IsIdentity returns true if the multihash of c is an identity multihash,
+// whose digest is the content of the block.
+func IsIdentity(c cid.Cid) bool {
+	isId, _ := extractContents(c)
+	return isId
+}
+
+// IdentityBlock returns the block whose content is inlined in c, if c has an
+// identity multihash. It allows reading these blocks without looking them up
+// in a [Blockstore] or on the network.
+func IdentityBlock(c cid.Cid) (blocks.Block, bool) {
+	isId, bdata := extractContents(c)
+	if !isId {
+		return nil, false
+	}
+	blk, err := blocks.NewBlockWithCid(bdata, c)
+	if err != nil {
+		return nil, false
+	}
+	return blk, true
+}
+
 func extractContents(k cid.Cid) (bool, []byte) {
 	// Pre-check by calling Prefix(), this much faster than extracting the hash.
 	if k.Prefix().MhType != mh.IDENTITY {
@@ -0,0 +1,41 @@
+package blockstore
+
+import (
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// DefaultInlineLimit is the default [InlineBuilder.Limit]. It keeps the CIDs
+// short enough to fit in a DNS label once encoded in base32.
+const DefaultInlineLimit = 32
+
+// InlineBuilder is a [cid.Builder] inlining the data of small blocks in their
+// CID, with an identity multihash, so that they are never stored or
+// transferred, see [NewIdStore]. The CIDs of the larger blocks are built with
+// Builder.
+type InlineBuilder struct {
+	cid.Builder
+
+	// Limit is the size, in bytes, up to which blocks are inlined.
+	// [DefaultInlineLimit] is used if it is 0.
+	Limit int
+}
+
+var _ cid.Builder = InlineBuilder{}
+
+// Sum implements [cid.Builder].
+func (b InlineBuilder) Sum(data []byte) (cid.Cid, error) {
+	limit := b.Limit
+	if limit == 0 {
+		limit = DefaultInlineLimit
+	}
+	if len(data) > limit {
+		return b.Builder.Sum(data)
+	}
+	return cid.V1Builder{Codec: b.GetCodec(), MhType: mh.IDENTITY}.Sum(data)
+}
+
+// WithCodec implements [cid.Builder].
+func (b InlineBuilder) WithCodec(c uint64) cid.Builder {
+	return InlineBuilder{Builder: b.Builder.WithCodec(c), Limit: b.Limit}
+}
@@ -0,0 +1,46 @@
+package blockstore
+
+import (
+	"bytes"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestInlineBuilder(t *testing.T) {
+	b := InlineBuilder{Builder: cid.V1Builder{Codec: cid.Raw, MhType: mh.SHA2_256}}
+
+	small := []byte("small")
+	c, err := b.Sum(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsIdentity(c) || c.Prefix().Codec != cid.Raw {
+		t.Fatalf("expected an inlined raw CID, got %s", c)
+	}
+	blk, ok := IdentityBlock(c)
+	if !ok || !bytes.Equal(blk.RawData(), small) {
+		t.Fatal("IdentityBlock() did not return the inlined data")
+	}
+
+	large := bytes.Repeat([]byte("a"), DefaultInlineLimit+1)
+	c, err = b.Sum(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsIdentity(c) {
+		t.Fatalf("expected a sha2-256 CID, got %s", c)
+	}
+	if _, ok := IdentityBlock(c); ok {
+		t.Fatal("IdentityBlock() succeeded on a sha2-256 CID")
+	}
+
+	c, err = InlineBuilder{Builder: b.Builder, Limit: 64}.WithCodec(cid.DagCBOR).Sum(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsIdentity(c) || c.Prefix().Codec != cid.DagCBOR {
+		t.Fatalf("expected an inlined dag-cbor CID, got %s", c)
+	}
+}
@@ -0,0 +1,628 @@
+package blockstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Owner is a logical owner of stored blocks, whose usage is accounted, and
+// limited, by a [StorageManager].
+type Owner string
+
+const (
+	// OwnerPins owns the blocks of the pinned DAGs.
+	OwnerPins Owner = "pins"
+	// OwnerMFS owns the blocks of the MFS root.
+	OwnerMFS Owner = "mfs"
+	// OwnerCache owns the blocks written without owner, such as the blocks
+	// fetched from the network. These are the only blocks evicted by a
+	// [StorageManager], once checked as not pinned.
+	OwnerCache Owner = "cache"
+)
+
+// ErrQuotaExceeded is returned by the writes of a [StorageManager] that would
+// exceed a quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type ownerCtxKey struct{}
+
+// ContextWithOwner returns a context whose writes to a [StorageManager] are
+// accounted to owner.
+func ContextWithOwner(ctx context.Context, owner Owner) context.Context {
+	return context.WithValue(ctx, ownerCtxKey{}, owner)
+}
+
+// ownerFromContext returns the owner of the writes made with ctx, which is
+// [OwnerCache] by default.
+func ownerFromContext(ctx context.Context) Owner {
+	if owner, ok := ctx.Value(ownerCtxKey{}).(Owner); ok && owner != "" {
+		return owner
+	}
+	return OwnerCache
+}
+
+// StorageOption is an option of [NewStorageManager].
+type StorageOption func(*StorageManager)
+
+// WithQuota limits the bytes stored by owner. Writes exceeding the quota
+// are rejected with [ErrQuotaExceeded], unless the owner is [OwnerCache] and
+// eviction is enabled, see [WithEviction].
+func WithQuota(owner Owner, bytes int64) StorageOption {
+	return func(sm *StorageManager) {
+		sm.quotas[owner] = bytes
+	}
+}
+
+// WithTotalQuota limits the bytes stored by all the owners. Writes exceeding
+// the quota are rejected with [ErrQuotaExceeded], unless enough blocks of
+// [OwnerCache] can be evicted, see [WithEviction].
+func WithTotalQuota(bytes int64) StorageOption {
+	return func(sm *StorageManager) {
+		sm.totalQuota = bytes
+	}
+}
+
+// PinnedFunc reports whether the block c must be kept, for instance because
+// it is pinned or belongs to MFS, see [WithEviction]. The blocks stored
+// before the [StorageManager] was created are checked with the CIDs returned
+// by AllKeysChan, whose codec may differ from the one of the pins, so their
+// multihashes should be compared.
+type PinnedFunc func(ctx context.Context, c cid.Cid) (bool, error)
+
+// WithEviction enables the removal of the least recently used blocks of
+// [OwnerCache] to make room for the writes that would exceed a quota.
+//
+// isPinned is called before evicting a block, and again before removing it
+// from the blockstore, and is required: blocks written without
+// [ContextWithOwner], such as the blocks fetched by bitswap while pinning,
+// and the blocks stored before the [StorageManager] was created are
+// accounted to [OwnerCache], although they may be pinned. The blocks it
+// reports as pinned are never evicted, and are claimed by [OwnerPins]
+// instead. It is called without holding the locks of the
+// StorageManager, so it can read the blockstore.
+func WithEviction(isPinned PinnedFunc) StorageOption {
+	return func(sm *StorageManager) {
+		sm.evict = true
+		sm.isPinned = isPinned
+	}
+}
+
+// storedBlock is the accounting of a stored block.
+type storedBlock struct {
+	key   string
+	c     cid.Cid
+	owner Owner
+	size  int64
+	// elem is the element of the block in the LRU list of the cache, if it
+	// is owned by [OwnerCache].
+	elem *list.Element
+}
+
+// StorageManager is a [Blockstore] accounting for the bytes stored by each
+// [Owner], and enforcing quotas by rejecting writes or by evicting the least
+// recently used blocks of [OwnerCache].
+//
+// The owner of a write is set with [ContextWithOwner]. A block is owned by a
+// single owner: blocks written again by an owner other than [OwnerCache] are
+// claimed by it, other blocks keep their owner. Blocks can be moved between
+// owners with [StorageManager.Claim] and [StorageManager.Release], for
+// instance when they are pinned or unpinned.
+//
+// The accounting is kept in memory, about a hundred bytes per block, and
+// rebuilt by [NewStorageManager], which accounts the blocks already stored to
+// [OwnerCache]. Writes that bypass the StorageManager are not accounted.
+type StorageManager struct {
+	Blockstore
+
+	quotas     map[Owner]int64
+	totalQuota int64
+	evict      bool
+	isPinned   PinnedFunc
+
+	lk     sync.Mutex
+	blocks map[string]*storedBlock
+	usage  map[Owner]int64
+	total  int64
+	// lru lists the blocks of [OwnerCache], from the most recently used.
+	lru *list.List
+	// evicting are the blocks being removed from the blockstore, closed
+	// once removed. Their writes wait for the removal.
+	evicting map[string]chan struct{}
+}
+
+// NewStorageManager returns a [StorageManager] storing blocks in bs, whose
+// existing blocks are accounted to [OwnerCache].
+func NewStorageManager(ctx context.Context, bs Blockstore, opts ...StorageOption) (*StorageManager, error) {
+	sm := &StorageManager{
+		Blockstore: bs,
+		quotas:     make(map[Owner]int64),
+		blocks:     make(map[string]*storedBlock),
+		usage:      make(map[Owner]int64),
+		lru:        list.New(),
+		evicting:   make(map[string]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	if sm.evict && sm.isPinned == nil {
+		return nil, errors.New("eviction requires a pinned check")
+	}
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for c := range keys {
+		size, err := bs.GetSize(ctx, c)
+		if err != nil {
+			if ipld.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("could not get size of %s: %w", c, err)
+		}
+		sm.add(c, OwnerCache, int64(size))
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// Usage returns the bytes stored by owner.
+func (sm *StorageManager) Usage(owner Owner) int64 {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	return sm.usage[owner]
+}
+
+// TotalUsage returns the bytes stored by all the owners.
+func (sm *StorageManager) TotalUsage() int64 {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	return sm.total
+}
+
+// Owner returns the owner of the block c, or false if it is not stored.
+func (sm *StorageManager) Owner(c cid.Cid) (Owner, bool) {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	if b, ok := sm.blocks[string(c.Hash())]; ok {
+		return b.owner, true
+	}
+	return "", false
+}
+
+// Claim moves the stored blocks among cids to owner. Blocks that would
+// exceed the quota of owner are not moved, and [ErrQuotaExceeded] is
+// returned.
+func (sm *StorageManager) Claim(owner Owner, cids ...cid.Cid) error {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	for _, c := range cids {
+		b, ok := sm.blocks[string(c.Hash())]
+		if !ok || b.owner == owner {
+			continue
+		}
+		if quota, ok := sm.quotas[owner]; ok && sm.usage[owner]+b.size > quota {
+			return sm.quotaError(owner, quota, b.size)
+		}
+		sm.setOwner(b, owner)
+	}
+	return nil
+}
+
+// Release moves the stored blocks among cids that are owned by owner to
+// [OwnerCache], which makes them evictable.
+func (sm *StorageManager) Release(owner Owner, cids ...cid.Cid) {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	for _, c := range cids {
+		if b, ok := sm.blocks[string(c.Hash())]; ok && b.owner == owner {
+			sm.setOwner(b, OwnerCache)
+		}
+	}
+}
+
+// Evict removes the least recently used blocks of [OwnerCache] that are not
+// pinned until at least bytes are freed, or there are none left. It returns
+// the bytes freed. Eviction must be enabled with [WithEviction].
+func (sm *StorageManager) Evict(ctx context.Context, bytes int64) (int64, error) {
+	if !sm.evict {
+		return 0, errors.New("eviction is not enabled")
+	}
+
+	var victims []*storedBlock
+	var freed int64
+	for freed < bytes {
+		sm.lk.Lock()
+		candidates := sm.evictionCandidates(bytes-freed, nil)
+		sm.lk.Unlock()
+		if len(candidates) == 0 {
+			break
+		}
+		evicted, err := sm.evictUnpinned(ctx, candidates)
+		victims = append(victims, evicted...)
+		if err != nil {
+			sm.restore(victims)
+			return 0, err
+		}
+		for _, b := range evicted {
+			freed += b.size
+		}
+	}
+	return sm.removeEvicted(ctx, victims)
+}
+
+func (sm *StorageManager) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	sm.touch(c)
+	return sm.Blockstore.Has(ctx, c)
+}
+
+func (sm *StorageManager) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	sm.touch(c)
+	return sm.Blockstore.Get(ctx, c)
+}
+
+func (sm *StorageManager) Put(ctx context.Context, blk blocks.Block) error {
+	return sm.PutMany(ctx, []blocks.Block{blk})
+}
+
+func (sm *StorageManager) PutMany(ctx context.Context, blks []blocks.Block) error {
+	owner := ownerFromContext(ctx)
+
+	res, err := sm.reserve(ctx, owner, blks)
+	if err != nil {
+		return err
+	}
+	// The blocks being evicted are written once removed, not before.
+	for _, done := range res.evicting {
+		if err = waitEvicted(ctx, done); err != nil {
+			sm.unreserve(res)
+			return err
+		}
+	}
+
+	if len(blks) == 1 {
+		err = sm.Blockstore.Put(ctx, blks[0])
+	} else {
+		err = sm.Blockstore.PutMany(ctx, blks)
+	}
+	if err != nil {
+		sm.unreserve(res)
+		return err
+	}
+
+	// The evicted blocks are only removed once the write succeeded, so that
+	// a failed write leaves the blockstore unchanged.
+	if _, err = sm.removeEvicted(ctx, res.victims); err != nil {
+		logger.Warnf("could not evict blocks: %s", err)
+	}
+	return nil
+}
+
+func (sm *StorageManager) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	err := sm.Blockstore.DeleteBlock(ctx, c)
+	if err == nil || ipld.IsNotFound(err) {
+		sm.lk.Lock()
+		if b, ok := sm.blocks[string(c.Hash())]; ok {
+			sm.remove(b)
+		}
+		sm.lk.Unlock()
+	}
+	return err
+}
+
+// reservation is the accounting of a write, to undo if it fails.
+type reservation struct {
+	owner Owner
+	// evicted blocks, to remove from the blockstore once written
+	victims []*storedBlock
+	// blocks added, and blocks of [OwnerCache] claimed by owner
+	added, claimed []*storedBlock
+	// evicting are the blocks being removed from the blockstore, to write
+	// once removed
+	evicting []chan struct{}
+}
+
+// reserve accounts the new blocks among blks to owner, and the blocks of
+// [OwnerCache] among blks that owner claims, evicting other blocks from the
+// accounting if needed.
+func (sm *StorageManager) reserve(ctx context.Context, owner Owner, blks []blocks.Block) (*reservation, error) {
+	res := &reservation{owner: owner}
+	for {
+		sm.lk.Lock()
+		written, evictBytes, err := sm.needed(owner, blks)
+		if err != nil {
+			sm.lk.Unlock()
+			sm.restore(res.victims)
+			return nil, err
+		}
+		if evictBytes <= 0 {
+			sm.account(res, blks)
+			sm.lk.Unlock()
+			return res, nil
+		}
+		candidates := sm.evictionCandidates(evictBytes, written)
+		sm.lk.Unlock()
+
+		evicted, err := sm.evictUnpinned(ctx, candidates)
+		res.victims = append(res.victims, evicted...)
+		if err != nil {
+			sm.restore(res.victims)
+			return nil, err
+		}
+	}
+}
+
+// needed returns the blocks among blks, and the bytes to evict to write them
+// within the quotas.
+func (sm *StorageManager) needed(owner Owner, blks []blocks.Block) (map[string]struct{}, int64, error) {
+	// The bytes added to owner, and to the total, and the bytes of the
+	// blocks of the cache that are written, which are not evicted.
+	var ownerBytes, newBytes, cacheBytes int64
+	written := make(map[string]struct{}, len(blks))
+	for _, blk := range blks {
+		key := string(blk.Cid().Hash())
+		if _, ok := written[key]; ok || IsIdentity(blk.Cid()) {
+			continue
+		}
+		written[key] = struct{}{}
+		if b, ok := sm.blocks[key]; ok {
+			if b.owner == OwnerCache {
+				cacheBytes += b.size
+				if owner != OwnerCache {
+					ownerBytes += b.size
+				}
+			}
+			continue
+		}
+		size := int64(len(blk.RawData()))
+		ownerBytes += size
+		newBytes += size
+	}
+
+	var evictBytes int64
+	if quota, ok := sm.quotas[owner]; ok && sm.usage[owner]+ownerBytes > quota {
+		if owner != OwnerCache || !sm.evict {
+			return nil, 0, sm.quotaError(owner, quota, ownerBytes)
+		}
+		evictBytes = sm.usage[owner] + ownerBytes - quota
+	}
+	if sm.totalQuota > 0 && sm.total+newBytes > sm.totalQuota {
+		if !sm.evict {
+			return nil, 0, fmt.Errorf("%w: %d bytes stored, %d bytes written, quota is %d bytes", ErrQuotaExceeded, sm.total, newBytes, sm.totalQuota)
+		}
+		evictBytes = max(evictBytes, sm.total+newBytes-sm.totalQuota)
+	}
+	if evictBytes > sm.usage[OwnerCache]-cacheBytes {
+		return nil, 0, fmt.Errorf("%w: %d bytes written, %d bytes of cache can be evicted, %d bytes needed", ErrQuotaExceeded, newBytes, sm.usage[OwnerCache]-cacheBytes, evictBytes)
+	}
+	return written, evictBytes, nil
+}
+
+// account accounts the blocks of a write to the owner of res.
+func (sm *StorageManager) account(res *reservation, blks []blocks.Block) {
+	for _, blk := range blks {
+		c := blk.Cid()
+		if IsIdentity(c) {
+			continue
+		}
+		if done, ok := sm.evicting[string(c.Hash())]; ok {
+			res.evicting = append(res.evicting, done)
+		}
+		if b, ok := sm.blocks[string(c.Hash())]; ok {
+			if b.owner == OwnerCache && res.owner != OwnerCache {
+				sm.setOwner(b, res.owner)
+				res.claimed = append(res.claimed, b)
+			} else {
+				sm.use(b)
+			}
+			continue
+		}
+		res.added = append(res.added, sm.add(c, res.owner, int64(len(blk.RawData()))))
+	}
+}
+
+// unreserve undoes the accounting of a failed write.
+func (sm *StorageManager) unreserve(res *reservation) {
+	sm.lk.Lock()
+	for _, b := range res.added {
+		if sm.blocks[b.key] == b {
+			sm.remove(b)
+		}
+	}
+	for _, b := range res.claimed {
+		if sm.blocks[b.key] == b && b.owner == res.owner {
+			sm.setOwner(b, OwnerCache)
+		}
+	}
+	sm.lk.Unlock()
+	sm.restore(res.victims)
+}
+
+// restore accounts again the evicted blocks that were not removed from the
+// blockstore.
+func (sm *StorageManager) restore(victims []*storedBlock) {
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	for _, b := range victims {
+		if _, ok := sm.blocks[b.key]; !ok {
+			sm.add(b.c, OwnerCache, b.size)
+		}
+	}
+}
+
+func (sm *StorageManager) quotaError(owner Owner, quota, bytes int64) error {
+	return fmt.Errorf("%w: %s stores %d bytes, %d bytes written, quota is %d bytes", ErrQuotaExceeded, owner, sm.usage[owner], bytes, quota)
+}
+
+// evictionCandidates returns the least recently used blocks of
+// [OwnerCache], except the ones in skip, totaling at least bytes.
+func (sm *StorageManager) evictionCandidates(bytes int64, skip map[string]struct{}) []*storedBlock {
+	var candidates []*storedBlock
+	elem := sm.lru.Back()
+	for total := int64(0); total < bytes && elem != nil; elem = elem.Prev() {
+		b := elem.Value.(*storedBlock)
+		if _, ok := skip[b.key]; ok {
+			continue
+		}
+		candidates = append(candidates, b)
+		total += b.size
+	}
+	return candidates
+}
+
+// evictUnpinned removes the candidates that are not pinned from the
+// accounting, and returns them. The pinned ones are claimed by [OwnerPins],
+// so that they are not candidates anymore.
+func (sm *StorageManager) evictUnpinned(ctx context.Context, candidates []*storedBlock) ([]*storedBlock, error) {
+	pinned := make([]bool, len(candidates))
+	for i, b := range candidates {
+		var err error
+		if pinned[i], err = sm.isPinned(ctx, b.c); err != nil {
+			return nil, fmt.Errorf("could not check whether %s is pinned: %w", b.c, err)
+		}
+	}
+
+	sm.lk.Lock()
+	defer sm.lk.Unlock()
+	var victims []*storedBlock
+	for i, b := range candidates {
+		// The block may have been claimed or deleted meanwhile.
+		if sm.blocks[b.key] != b || b.owner != OwnerCache {
+			continue
+		}
+		if pinned[i] {
+			sm.setOwner(b, OwnerPins)
+			continue
+		}
+		sm.remove(b)
+		victims = append(victims, b)
+	}
+	return victims, nil
+}
+
+// removeEvicted removes the evicted blocks from the blockstore.
+func (sm *StorageManager) removeEvicted(ctx context.Context, victims []*storedBlock) (int64, error) {
+	var freed int64
+	for _, b := range victims {
+		sm.lk.Lock()
+		// The block may have been written again meanwhile.
+		if _, rewritten := sm.blocks[b.key]; rewritten {
+			sm.lk.Unlock()
+			continue
+		}
+		// The writes of the block wait until it is removed, so that they
+		// are not lost.
+		done := make(chan struct{})
+		sm.evicting[b.key] = done
+		sm.lk.Unlock()
+
+		removed, err := sm.removeUnpinned(ctx, b)
+
+		sm.lk.Lock()
+		if sm.evicting[b.key] == done {
+			delete(sm.evicting, b.key)
+		}
+		sm.lk.Unlock()
+		close(done)
+
+		if err != nil {
+			return freed, err
+		}
+		if removed {
+			freed += b.size
+		}
+	}
+	return freed, nil
+}
+
+// removeUnpinned removes the evicted block b from the blockstore, unless it
+// was pinned since it was evicted, in which case it is accounted again to
+// [OwnerPins].
+func (sm *StorageManager) removeUnpinned(ctx context.Context, b *storedBlock) (bool, error) {
+	pinned, err := sm.isPinned(ctx, b.c)
+	if err != nil {
+		return false, fmt.Errorf("could not check whether %s is pinned: %w", b.c, err)
+	}
+	if pinned {
+		sm.lk.Lock()
+		if _, ok := sm.blocks[b.key]; !ok {
+			sm.add(b.c, OwnerPins, b.size)
+		}
+		sm.lk.Unlock()
+		return false, nil
+	}
+	err = sm.Blockstore.DeleteBlock(ctx, b.c)
+	if err != nil && !ipld.IsNotFound(err) {
+		return false, fmt.Errorf("could not evict %s: %w", b.c, err)
+	}
+	return true, nil
+}
+
+// touch marks c as recently used.
+func (sm *StorageManager) touch(c cid.Cid) {
+	sm.lk.Lock()
+	if b, ok := sm.blocks[string(c.Hash())]; ok {
+		sm.use(b)
+	}
+	sm.lk.Unlock()
+}
+
+// waitEvicted waits until the evicted block whose removal closes done is
+// removed.
+func waitEvicted(ctx context.Context, done chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (sm *StorageManager) use(b *storedBlock) {
+	if b.elem != nil {
+		sm.lru.MoveToFront(b.elem)
+	}
+}
+
+func (sm *StorageManager) add(c cid.Cid, owner Owner, size int64) *storedBlock {
+	b := &storedBlock{key: string(c.Hash()), c: c, size: size}
+	sm.blocks[b.key] = b
+	sm.total += size
+	sm.setOwner(b, owner)
+	return b
+}
+
+func (sm *StorageManager) remove(b *storedBlock) {
+	delete(sm.blocks, b.key)
+	sm.total -= b.size
+	sm.usage[b.owner] -= b.size
+	if b.elem != nil {
+		sm.lru.Remove(b.elem)
+		b.elem = nil
+	}
+}
+
+func (sm *StorageManager) setOwner(b *storedBlock, owner Owner) {
+	if b.owner != "" {
+		sm.usage[b.owner] -= b.size
+	}
+	b.owner = owner
+	sm.usage[owner] += b.size
+	if owner == OwnerCache {
+		if b.elem == nil {
+			b.elem = sm.lru.PushFront(b)
+		}
+	} else if b.elem != nil {
+		sm.lru.Remove(b.elem)
+		b.elem = nil
+	}
+}
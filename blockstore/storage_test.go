@@ -0,0 +1,344 @@
+package blockstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+)
+
+func newStorageManager(t *testing.T, opts ...StorageOption) *StorageManager {
+	t.Helper()
+	sm, err := NewStorageManager(bg, NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore())), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+// sizedBlock returns a block of size bytes, distinct for each seed.
+func sizedBlock(seed byte, size int) blocks.Block {
+	data := bytes.Repeat([]byte{seed}, size)
+	return blocks.NewBlock(data)
+}
+
+func checkUsage(t *testing.T, sm *StorageManager, owner Owner, expected int64) {
+	t.Helper()
+	if usage := sm.Usage(owner); usage != expected {
+		t.Fatalf("usage of %s is %d, expected %d", owner, usage, expected)
+	}
+}
+
+func TestStorageUsage(t *testing.T) {
+	sm := newStorageManager(t)
+
+	if err := sm.Put(bg, sizedBlock(1, 100)); err != nil {
+		t.Fatal(err)
+	}
+	pinned := sizedBlock(2, 200)
+	if err := sm.PutMany(ContextWithOwner(bg, OwnerPins), []blocks.Block{pinned, sizedBlock(3, 300)}); err != nil {
+		t.Fatal(err)
+	}
+	// Written again to the cache, the block stays pinned.
+	if err := sm.Put(bg, pinned); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, sm, OwnerCache, 100)
+	checkUsage(t, sm, OwnerPins, 500)
+	if total := sm.TotalUsage(); total != 600 {
+		t.Fatalf("total usage is %d, expected 600", total)
+	}
+
+	sm.Release(OwnerPins, pinned.Cid())
+	checkUsage(t, sm, OwnerCache, 300)
+	if owner, ok := sm.Owner(pinned.Cid()); !ok || owner != OwnerCache {
+		t.Fatalf("owner is %q, expected %q", owner, OwnerCache)
+	}
+	if err := sm.Claim(OwnerMFS, pinned.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, sm, OwnerMFS, 200)
+
+	if err := sm.DeleteBlock(bg, pinned.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, sm, OwnerMFS, 0)
+	if _, ok := sm.Owner(pinned.Cid()); ok {
+		t.Fatal("deleted block is still accounted")
+	}
+
+	// The existing blocks are accounted to the cache.
+	sm, err := NewStorageManager(bg, sm.Blockstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, sm, OwnerCache, 400)
+}
+
+func TestStorageQuota(t *testing.T) {
+	sm := newStorageManager(t, WithQuota(OwnerPins, 250))
+	ctx := ContextWithOwner(bg, OwnerPins)
+
+	if err := sm.Put(ctx, sizedBlock(1, 200)); err != nil {
+		t.Fatal(err)
+	}
+	blk := sizedBlock(2, 100)
+	if err := sm.Put(ctx, blk); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if has, _ := sm.Has(bg, blk.Cid()); has {
+		t.Fatal("rejected block was stored")
+	}
+
+	// Cached blocks can not be claimed beyond the quota either.
+	if err := sm.Put(bg, blk); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Claim(OwnerPins, blk.Cid()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	checkUsage(t, sm, OwnerPins, 200)
+	checkUsage(t, sm, OwnerCache, 100)
+}
+
+// notPinned is a [PinnedFunc] reporting every block as not pinned.
+func notPinned(context.Context, cid.Cid) (bool, error) {
+	return false, nil
+}
+
+func TestStorageEviction(t *testing.T) {
+	sm := newStorageManager(t, WithTotalQuota(1000), WithEviction(notPinned))
+
+	cached := make([]blocks.Block, 4)
+	for i := range cached {
+		cached[i] = sizedBlock(byte(i), 200)
+		if err := sm.Put(bg, cached[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first block is used again, the second is the least recently used.
+	if _, err := sm.Get(bg, cached[0].Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := sizedBlock(10, 300)
+	if err := sm.Put(ContextWithOwner(bg, OwnerPins), pinned); err != nil {
+		t.Fatal(err)
+	}
+	for i, blk := range cached {
+		has, err := sm.Has(bg, blk.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (i != 1) {
+			t.Fatalf("block %d: has is %t", i, has)
+		}
+	}
+	if total := sm.TotalUsage(); total != 900 {
+		t.Fatalf("total usage is %d, expected 900", total)
+	}
+
+	// Pinned blocks are never evicted.
+	if err := sm.Put(bg, sizedBlock(11, 800)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if has, _ := sm.Has(bg, pinned.Cid()); !has {
+		t.Fatal("pinned block was evicted")
+	}
+
+	freed, err := sm.Evict(bg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 200 {
+		t.Fatalf("freed %d bytes, expected 200", freed)
+	}
+	checkUsage(t, sm, OwnerCache, 400)
+}
+
+func TestStorageEvictionRequiresPinnedCheck(t *testing.T) {
+	_, err := NewStorageManager(bg, NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore())), WithEviction(nil))
+	if err == nil {
+		t.Fatal("expected an error without pinned check")
+	}
+}
+
+func TestStorageEvictionSkipsPinned(t *testing.T) {
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+
+	// Blocks stored before the StorageManager, or written without owner,
+	// are accounted to the cache, although they are pinned.
+	pinned := sizedBlock(1, 300)
+	if err := bs.Put(bg, pinned); err != nil {
+		t.Fatal(err)
+	}
+	isPinned := func(_ context.Context, c cid.Cid) (bool, error) {
+		return bytes.Equal(c.Hash(), pinned.Cid().Hash()), nil
+	}
+	sm, err := NewStorageManager(bg, bs, WithTotalQuota(1000), WithEviction(isPinned))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := sizedBlock(2, 300)
+	if err := sm.Put(bg, cached); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, sm, OwnerCache, 600)
+
+	if err := sm.Put(bg, sizedBlock(3, 600)); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := sm.Has(bg, pinned.Cid()); !has {
+		t.Fatal("pinned block was evicted")
+	}
+	if has, _ := sm.Has(bg, cached.Cid()); has {
+		t.Fatal("cached block was not evicted")
+	}
+	if owner, _ := sm.Owner(pinned.Cid()); owner != OwnerPins {
+		t.Fatalf("owner of the pinned block is %q, expected %q", owner, OwnerPins)
+	}
+
+	// The pinned block can not make room.
+	if err := sm.Put(bg, sizedBlock(4, 800)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+// failingBlockstore fails the writes.
+type failingBlockstore struct {
+	Blockstore
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (bs failingBlockstore) Put(context.Context, blocks.Block) error {
+	return errWriteFailed
+}
+
+func (bs failingBlockstore) PutMany(context.Context, []blocks.Block) error {
+	return errWriteFailed
+}
+
+func TestStorageFailedWrite(t *testing.T) {
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	cached := []blocks.Block{sizedBlock(1, 400), sizedBlock(2, 400)}
+	if err := bs.PutMany(bg, cached); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewStorageManager(bg, failingBlockstore{bs}, WithTotalQuota(1000), WithEviction(notPinned))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The write evicts a block and claims the other one, then fails.
+	err = sm.PutMany(ContextWithOwner(bg, OwnerPins), []blocks.Block{cached[0], sizedBlock(3, 500)})
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected the write to fail, got %v", err)
+	}
+	checkUsage(t, sm, OwnerCache, 800)
+	checkUsage(t, sm, OwnerPins, 0)
+	if total := sm.TotalUsage(); total != 800 {
+		t.Fatalf("total usage is %d, expected 800", total)
+	}
+	for _, blk := range cached {
+		if has, _ := sm.Has(bg, blk.Cid()); !has {
+			t.Fatalf("block %s was removed by a failed write", blk.Cid())
+		}
+	}
+}
+
+// blockingBlockstore blocks the deletions until unblock is closed.
+type blockingBlockstore struct {
+	Blockstore
+	deleting chan cid.Cid
+	unblock  chan struct{}
+}
+
+func (bs blockingBlockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	bs.deleting <- c
+	<-bs.unblock
+	return bs.Blockstore.DeleteBlock(ctx, c)
+}
+
+func TestStorageWriteDuringEviction(t *testing.T) {
+	bs := blockingBlockstore{
+		Blockstore: NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore())),
+		deleting:   make(chan cid.Cid, 1),
+		unblock:    make(chan struct{}),
+	}
+	sm, err := NewStorageManager(bg, bs, WithEviction(notPinned))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk := sizedBlock(1, 100)
+	if err := sm.Put(bg, blk); err != nil {
+		t.Fatal(err)
+	}
+
+	evicted := make(chan error, 1)
+	go func() {
+		_, err := sm.Evict(bg, 1)
+		evicted <- err
+	}()
+	<-bs.deleting
+
+	// The block is written again while it is being removed.
+	written := make(chan error, 1)
+	go func() {
+		written <- sm.Put(bg, blk)
+	}()
+	for sm.Usage(OwnerCache) != 100 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("write did not wait for the removal: %v", err)
+	default:
+	}
+
+	close(bs.unblock)
+	if err := <-evicted; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := sm.Has(bg, blk.Cid()); !has {
+		t.Fatal("block written during its eviction was lost")
+	}
+	checkUsage(t, sm, OwnerCache, 100)
+}
+
+func TestStoragePinnedDuringEviction(t *testing.T) {
+	sm := newStorageManager(t, WithEviction(notPinned))
+	blk := sizedBlock(1, 100)
+	if err := sm.Put(bg, blk); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block is pinned once evicted, before being removed.
+	var checks int
+	sm.isPinned = func(context.Context, cid.Cid) (bool, error) {
+		checks++
+		return checks > 1, nil
+	}
+	freed, err := sm.Evict(bg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 0 {
+		t.Fatalf("freed %d bytes, expected 0", freed)
+	}
+	if has, _ := sm.Has(bg, blk.Cid()); !has {
+		t.Fatal("block pinned during its eviction was removed")
+	}
+	if owner, _ := sm.Owner(blk.Cid()); owner != OwnerPins {
+		t.Fatalf("owner is %q, expected %q", owner, OwnerPins)
+	}
+}
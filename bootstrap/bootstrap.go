@@ -58,6 +58,8 @@ type BootstrapConfig struct {
 
 	saveBackupBootstrapPeers func(context.Context, []peer.AddrInfo)
 	loadBackupBootstrapPeers func(context.Context) []peer.AddrInfo
+
+	peerSources *peerSources
 }
 
 // DefaultBootstrapConfig specifies default sane parameters for bootstrapping.
@@ -109,14 +111,25 @@ func (cfg *BootstrapConfig) SetBackupPeers(load func(context.Context) []peer.Add
 // connections to well-known bootstrap peers. It also kicks off subsystem
 // bootstrapping (i.e. routing).
 func Bootstrap(id peer.ID, host host.Host, rt routing.Routing, cfg BootstrapConfig) (io.Closer, error) {
-	if len(cfg.BootstrapPeers()) == 0 {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if cfg.peerSources != nil {
+		// The sources are refreshed in the background, so that slow sources
+		// do not delay the first round, which uses the static and backup
+		// peers. Another round is run once the sources have been queried.
+		go cfg.peerSources.run(ctx, cfg.ConnectionTimeout, func() {
+			if err := bootstrapRound(ctx, host, cfg); err != nil {
+				log.Debugf("%s bootstrap error: %s", id, err)
+			}
+		})
+	}
+
+	if cfg.peerSources == nil && len(cfg.bootstrapPeers()) == 0 {
 		// We *need* to bootstrap but we have no bootstrap peers
 		// configured *at all*, inform the user.
 		log.Warn("no bootstrap nodes configured: go-ipfs may have difficulty connecting to the network")
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
 	// Signal when first bootstrap round is complete, started independent of ticker.
 	doneWithRound := make(chan struct{})
 
@@ -214,7 +227,7 @@ func saveConnectedPeersAsTemporaryBootstrap(ctx context.Context, host host.Host,
 	// Randomize the list of connected peers, we don't prioritize anyone.
 	connectedPeers := randomizeList(host.Network().Peers())
 
-	bootstrapPeers := cfg.BootstrapPeers()
+	bootstrapPeers := cfg.bootstrapPeers()
 	backupPeers := make([]peer.AddrInfo, 0, cfg.MaxBackupBootstrapSize)
 	foundPeers := make(map[peer.ID]struct{}, cfg.MaxBackupBootstrapSize+len(bootstrapPeers))
 
@@ -276,7 +289,7 @@ func bootstrapRound(ctx context.Context, host host.Host, cfg BootstrapConfig) er
 
 	// get bootstrap peers from config. retrieving them here makes
 	// sure we remain observant of changes to client configuration.
-	peers := cfg.BootstrapPeers()
+	peers := cfg.bootstrapPeers()
 	// determine how many bootstrap connections to open
 	connected := host.Network().Peers()
 	if len(connected) >= cfg.MinPeerThreshold {
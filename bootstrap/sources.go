@@ -0,0 +1,313 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// DefaultPeerSourceRefreshInterval is the interval at which peer sources are
+// refreshed when none is given to [WithPeerSources].
+const DefaultPeerSourceRefreshInterval = 10 * time.Minute
+
+// maxHTTPSourceResponseSize limits the size of the list of peers fetched by an
+// HTTPSource.
+const maxHTTPSourceResponseSize = 1 << 20
+
+// PeerSource provides bootstrap peers from a location that may change over
+// time, such as a DNS record or an HTTP endpoint, so that bootstrap peers can
+// be rotated without redeploying nodes.
+type PeerSource interface {
+	// BootstrapPeers returns the current set of bootstrap peers.
+	BootstrapPeers(ctx context.Context) ([]peer.AddrInfo, error)
+}
+
+// WithPeerSources configures sources of bootstrap peers, used in addition to
+// [BootstrapConfig.BootstrapPeers]. The sources are queried in the background
+// when the bootstrap process starts, so the first round only uses the static
+// and backup peers, and then refreshed every interval. If a source fails, the
+// peers it returned last are kept. A zero interval defaults to
+// [DefaultPeerSourceRefreshInterval].
+func WithPeerSources(interval time.Duration, sources ...PeerSource) func(*BootstrapConfig) {
+	if interval == 0 {
+		interval = DefaultPeerSourceRefreshInterval
+	}
+	return func(cfg *BootstrapConfig) {
+		if len(sources) == 0 {
+			cfg.peerSources = nil
+			return
+		}
+		cfg.peerSources = &peerSources{
+			sources:  sources,
+			interval: interval,
+			peers:    make([][]peer.AddrInfo, len(sources)),
+		}
+	}
+}
+
+// peerSources keeps the peers last returned by each source.
+type peerSources struct {
+	sources  []PeerSource
+	interval time.Duration
+
+	lk    sync.RWMutex
+	peers [][]peer.AddrInfo
+}
+
+func (ps *peerSources) refresh(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, s := range ps.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			peers, err := s.BootstrapPeers(ctx)
+			if err != nil {
+				log.Warnf("failed to refresh bootstrap peer source %v: %s", s, err)
+				return
+			}
+			ps.lk.Lock()
+			ps.peers[i] = peers
+			ps.lk.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// run refreshes the sources, calls refreshed, and then keeps refreshing them
+// every interval until ctx is done.
+func (ps *peerSources) run(ctx context.Context, timeout time.Duration, refreshed func()) {
+	ps.refresh(ctx, timeout)
+	if ctx.Err() != nil {
+		return
+	}
+	refreshed()
+
+	ticker := time.NewTicker(ps.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ps.refresh(ctx, timeout)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ps *peerSources) bootstrapPeers() []peer.AddrInfo {
+	ps.lk.RLock()
+	defer ps.lk.RUnlock()
+	var out []peer.AddrInfo
+	for _, peers := range ps.peers {
+		out = append(out, peers...)
+	}
+	return out
+}
+
+// bootstrapPeers returns the configured bootstrap peers, merged with the
+// peers from the peer sources.
+func (cfg *BootstrapConfig) bootstrapPeers() []peer.AddrInfo {
+	var peers []peer.AddrInfo
+	if cfg.BootstrapPeers != nil {
+		peers = cfg.BootstrapPeers()
+	}
+	if cfg.peerSources == nil {
+		return peers
+	}
+	return mergeAddrInfos(peers, cfg.peerSources.bootstrapPeers())
+}
+
+// mergeAddrInfos returns the union of the given lists, with the addresses of
+// peers present in several lists merged.
+func mergeAddrInfos(lists ...[]peer.AddrInfo) []peer.AddrInfo {
+	var out []peer.AddrInfo
+	index := make(map[peer.ID]int)
+	for _, list := range lists {
+		for _, pi := range list {
+			i, ok := index[pi.ID]
+			if !ok {
+				index[pi.ID] = len(out)
+				out = append(out, peer.AddrInfo{ID: pi.ID, Addrs: append([]ma.Multiaddr(nil), pi.Addrs...)})
+				continue
+			}
+			for _, a := range pi.Addrs {
+				if !ma.Contains(out[i].Addrs, a) {
+					out[i].Addrs = append(out[i].Addrs, a)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// parseAddrs parses multiaddrs that include a /p2p component into peers.
+func parseAddrs(addrs []string) ([]peer.AddrInfo, error) {
+	mas := make([]ma.Multiaddr, 0, len(addrs))
+	for _, s := range addrs {
+		m, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap address %q: %w", s, err)
+		}
+		mas = append(mas, m)
+	}
+	return peer.AddrInfosFromP2pAddrs(mas...)
+}
+
+// DNSSource reads bootstrap peers from the TXT records of a domain. Each
+// record holds one multiaddr with a /p2p component, optionally prefixed with
+// "dnsaddr=" as in [dnsaddr] records.
+//
+// [dnsaddr]: https://github.com/multiformats/multiaddr/blob/master/protocols/DNSADDR.md
+type DNSSource struct {
+	domain    string
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+}
+
+var _ PeerSource = (*DNSSource)(nil)
+
+// NewDNSSource returns a [DNSSource] for the given domain. If resolver is nil,
+// [net.DefaultResolver] is used.
+func NewDNSSource(domain string, resolver *net.Resolver) *DNSSource {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DNSSource{
+		domain:    domain,
+		lookupTXT: resolver.LookupTXT,
+	}
+}
+
+func (s *DNSSource) BootstrapPeers(ctx context.Context) ([]peer.AddrInfo, error) {
+	records, err := s.lookupTXT(ctx, s.domain)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(records))
+	for _, r := range records {
+		addrs = append(addrs, strings.TrimPrefix(r, "dnsaddr="))
+	}
+	return parseAddrs(addrs)
+}
+
+func (s *DNSSource) String() string {
+	return "dns:" + s.domain
+}
+
+// HTTPSource fetches bootstrap peers from an HTTP endpoint that returns a JSON
+// array of multiaddrs with a /p2p component, in the same format as the
+// Bootstrap list of the Kubo configuration.
+type HTTPSource struct {
+	url    string
+	client *http.Client
+}
+
+var _ PeerSource = (*HTTPSource)(nil)
+
+// NewHTTPSource returns an [HTTPSource] for the given URL. If client is nil,
+// [http.DefaultClient] is used.
+func NewHTTPSource(url string, client *http.Client) *HTTPSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSource{
+		url:    url,
+		client: client,
+	}
+}
+
+func (s *HTTPSource) BootstrapPeers(ctx context.Context) ([]peer.AddrInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var addrs []string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPSourceResponseSize)).Decode(&addrs); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap peer list: %w", err)
+	}
+	return parseAddrs(addrs)
+}
+
+func (s *HTTPSource) String() string {
+	return s.url
+}
+
+// DatastoreSource persists a set of peers in a datastore. It can be used as a
+// [PeerSource], and its Load and Save methods can be passed to
+// [WithBackupPeers] to keep previously-good peers across restarts.
+type DatastoreSource struct {
+	ds  datastore.Datastore
+	key datastore.Key
+}
+
+var _ PeerSource = (*DatastoreSource)(nil)
+
+// NewDatastoreSource returns a [DatastoreSource] that stores peers in ds under
+// key.
+func NewDatastoreSource(ds datastore.Datastore, key datastore.Key) *DatastoreSource {
+	return &DatastoreSource{
+		ds:  ds,
+		key: key,
+	}
+}
+
+func (s *DatastoreSource) BootstrapPeers(ctx context.Context) ([]peer.AddrInfo, error) {
+	data, err := s.ds.Get(ctx, s.key)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var peers []peer.AddrInfo
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// Load returns the stored peers. Errors are logged.
+func (s *DatastoreSource) Load(ctx context.Context) []peer.AddrInfo {
+	peers, err := s.BootstrapPeers(ctx)
+	if err != nil {
+		log.Warnf("failed to load bootstrap peers from datastore: %s", err)
+	}
+	return peers
+}
+
+// Save replaces the stored peers. Errors are logged.
+func (s *DatastoreSource) Save(ctx context.Context, peers []peer.AddrInfo) {
+	data, err := json.Marshal(peers)
+	if err == nil {
+		err = s.ds.Put(ctx, s.key, data)
+	}
+	if err != nil {
+		log.Warnf("failed to save bootstrap peers to datastore: %s", err)
+	}
+}
+
+func (s *DatastoreSource) String() string {
+	return "datastore:" + s.key.String()
+}
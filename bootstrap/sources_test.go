@@ -0,0 +1,212 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func randAddrInfo(t *testing.T, addr string) peer.AddrInfo {
+	t.Helper()
+	pid, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer.AddrInfo{ID: pid, Addrs: []ma.Multiaddr{ma.StringCast(addr)}}
+}
+
+func p2pAddr(pi peer.AddrInfo) string {
+	return pi.Addrs[0].String() + "/p2p/" + pi.ID.String()
+}
+
+type fakeSource struct {
+	peers []peer.AddrInfo
+	err   error
+}
+
+func (s *fakeSource) BootstrapPeers(context.Context) ([]peer.AddrInfo, error) {
+	return s.peers, s.err
+}
+
+func TestDNSSource(t *testing.T) {
+	p1 := randAddrInfo(t, "/ip4/1.2.3.4/tcp/4001")
+	p2 := randAddrInfo(t, "/dns4/example.com/tcp/4001")
+
+	s := NewDNSSource("_dnsaddr.bootstrap.example.com", nil)
+	s.lookupTXT = func(_ context.Context, name string) ([]string, error) {
+		if name != "_dnsaddr.bootstrap.example.com" {
+			t.Fatalf("unexpected lookup of %s", name)
+		}
+		return []string{"dnsaddr=" + p2pAddr(p1), p2pAddr(p2)}, nil
+	}
+
+	peers, err := s.BootstrapPeers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+	for _, pi := range peers {
+		if pi.ID != p1.ID && pi.ID != p2.ID {
+			t.Fatalf("unexpected peer %s", pi.ID)
+		}
+	}
+
+	s.lookupTXT = func(context.Context, string) ([]string, error) {
+		return []string{"not a multiaddr"}, nil
+	}
+	if _, err := s.BootstrapPeers(context.Background()); err == nil {
+		t.Fatal("expected error for invalid record")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	p1 := randAddrInfo(t, "/ip4/1.2.3.4/tcp/4001")
+	body := `["` + p2pAddr(p1) + `"]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/peers.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	peers, err := NewHTTPSource(ts.URL+"/peers.json", nil).BootstrapPeers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].ID != p1.ID {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+
+	if _, err := NewHTTPSource(ts.URL+"/missing", nil).BootstrapPeers(context.Background()); err == nil {
+		t.Fatal("expected error for missing list")
+	}
+}
+
+func TestDatastoreSource(t *testing.T) {
+	ctx := context.Background()
+	s := NewDatastoreSource(dssync.MutexWrap(datastore.NewMapDatastore()), datastore.NewKey("/bootstrap/peers"))
+
+	if peers := s.Load(ctx); len(peers) != 0 {
+		t.Fatal("expected no peers")
+	}
+
+	saved := []peer.AddrInfo{randAddrInfo(t, "/ip4/1.2.3.4/tcp/4001"), randAddrInfo(t, "/ip4/5.6.7.8/udp/4001/quic-v1")}
+	s.Save(ctx, saved)
+
+	peers, err := s.BootstrapPeers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].ID != saved[0].ID || !peers[1].Addrs[0].Equal(saved[1].Addrs[0]) {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+
+	cfg := BootstrapConfigWithPeers(nil, WithBackupPeers(s.Load, s.Save))
+	load, _ := cfg.BackupPeers()
+	if len(load(ctx)) != 2 {
+		t.Fatal("expected backup peers to be loaded from the datastore")
+	}
+}
+
+func TestPeerSources(t *testing.T) {
+	static := randAddrInfo(t, "/ip4/1.2.3.4/tcp/4001")
+	dynamic := randAddrInfo(t, "/ip4/5.6.7.8/tcp/4001")
+	// The same peer as static, with another address.
+	staticAlt := peer.AddrInfo{ID: static.ID, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")}}
+
+	source := &fakeSource{peers: []peer.AddrInfo{dynamic, staticAlt}}
+	failing := &fakeSource{err: errors.New("unavailable")}
+	cfg := BootstrapConfigWithPeers([]peer.AddrInfo{static}, WithPeerSources(time.Minute, source, failing))
+
+	if peers := cfg.bootstrapPeers(); len(peers) != 1 {
+		t.Fatal("expected only the static peer before the first refresh")
+	}
+
+	cfg.peerSources.refresh(context.Background(), time.Second)
+	peers := cfg.bootstrapPeers()
+	if len(peers) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(peers))
+	}
+	if peers[0].ID != static.ID || len(peers[0].Addrs) != 2 {
+		t.Fatal("expected the addresses of the static peer to be merged")
+	}
+	if peers[1].ID != dynamic.ID {
+		t.Fatal("expected the dynamic peer")
+	}
+
+	// A failing refresh keeps the previous peers.
+	source.err = errors.New("unavailable")
+	cfg.peerSources.refresh(context.Background(), time.Second)
+	if len(cfg.bootstrapPeers()) != 2 {
+		t.Fatal("expected peers to be kept after a failed refresh")
+	}
+}
+
+// blockingSource returns its peers once released.
+type blockingSource struct {
+	fakeSource
+	queried chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSource) BootstrapPeers(ctx context.Context) ([]peer.AddrInfo, error) {
+	close(s.queried)
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.fakeSource.BootstrapPeers(ctx)
+}
+
+func TestBootstrapRefreshesPeerSourcesInBackground(t *testing.T) {
+	static := randAddrInfo(t, "/ip4/127.0.0.1/tcp/1")
+	dynamic := randAddrInfo(t, "/ip4/127.0.0.1/tcp/2")
+	source := &blockingSource{
+		fakeSource: fakeSource{peers: []peer.AddrInfo{dynamic}},
+		queried:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	cfg := BootstrapConfigWithPeers([]peer.AddrInfo{static}, WithPeerSources(time.Minute, source))
+	cfg.ConnectionTimeout = time.Second
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// Bootstrap does not wait for the source, and starts with the static peers.
+	bootstrapper, err := Bootstrap(h.ID(), h, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bootstrapper.Close()
+	<-source.queried
+	if peers := cfg.bootstrapPeers(); len(peers) != 1 || peers[0].ID != static.ID {
+		t.Fatalf("expected only the static peer while the source is queried, got %v", peers)
+	}
+
+	close(source.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cfg.bootstrapPeers()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the peers of the source after the refresh")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
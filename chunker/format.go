@@ -0,0 +1,300 @@
+package chunk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FormatHeaderSize is the maximum number of bytes given to a
+// [FormatDetector] and a [RecordScanner].
+const FormatHeaderSize = 512
+
+// FormatDetector recognizes a container format, such as tar or zip, so that
+// a splitter created by [NewFormatSplitter] aligns the chunks to the records
+// of the data, such as the entries of an archive. The records that are the
+// same between versions of the data then produce the same chunks, which are
+// deduplicated.
+type FormatDetector interface {
+	// Detect returns a RecordScanner for the data starting with header if
+	// it is in the format of the detector, or nil. header holds the first
+	// FormatHeaderSize bytes of the data, or all the data if it is shorter.
+	Detect(header []byte) RecordScanner
+}
+
+// RecordScanner returns the lengths of the records of data in a container
+// format, in order, starting with the first record of the data.
+type RecordScanner interface {
+	// RecordLength returns the length of the record starting with header,
+	// which holds the first FormatHeaderSize bytes of the record, or up to
+	// the end of the data if it is shorter. It returns false if the record
+	// is invalid or its length is unknown, which ends the alignment of the
+	// chunks to the records.
+	RecordLength(header []byte) (int64, bool)
+}
+
+// DefaultFormatDetectors are the detectors used by [NewFormatSplitter] when
+// none are given. They recognize tar and zip archives, WebAssembly modules
+// and MP4 files.
+var DefaultFormatDetectors = []FormatDetector{
+	tarFormat{},
+	zipFormat{},
+	wasmFormat{},
+	mp4Format{},
+}
+
+type formatSplitter struct {
+	r         io.Reader
+	size      int
+	min       int
+	detectors []FormatDetector
+
+	// buf holds the data read and not returned yet.
+	buf []byte
+	// scanner finds the records of the data, if its format was detected.
+	scanner RecordScanner
+	// boundary is the offset in buf of the next record whose length is not
+	// known yet, or -1 if there is none.
+	boundary int64
+	// aligned is true if buf starts at a record boundary.
+	aligned bool
+
+	detected bool
+	err      error
+}
+
+// NewFormatSplitter returns a Splitter producing chunks of at most size
+// bytes, which end at the boundaries of the records of the data when its
+// format is recognized by one of the detectors, or by
+// [DefaultFormatDetectors] if none are given. Chunks starting at a record
+// boundary are extended to the first record boundary after size/4 bytes, so
+// that small records are grouped. Data in an unknown format is split in
+// chunks of size bytes.
+func NewFormatSplitter(r io.Reader, size int64, detectors ...FormatDetector) Splitter {
+	if len(detectors) == 0 {
+		detectors = DefaultFormatDetectors
+	}
+	return &formatSplitter{
+		r:         r,
+		size:      int(size),
+		min:       int(size / 4),
+		detectors: detectors,
+		buf:       make([]byte, 0, int(size)+FormatHeaderSize),
+		boundary:  -1,
+	}
+}
+
+// Reader returns the io.Reader associated to this Splitter.
+func (fs *formatSplitter) Reader() io.Reader {
+	return fs.r
+}
+
+// NextBytes produces a new chunk.
+func (fs *formatSplitter) NextBytes() ([]byte, error) {
+	if fs.err == nil {
+		// Read enough to find the length of a record starting at the end of
+		// the chunk.
+		n, err := io.ReadFull(fs.r, fs.buf[len(fs.buf):cap(fs.buf)])
+		fs.buf = fs.buf[:len(fs.buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			fs.err = io.EOF
+		} else if err != nil {
+			fs.err = err
+			return nil, err
+		}
+	}
+	if len(fs.buf) == 0 {
+		return nil, fs.err
+	}
+
+	if !fs.detected {
+		fs.detected = true
+		header := fs.buf[:min(len(fs.buf), FormatHeaderSize)]
+		for _, d := range fs.detectors {
+			if fs.scanner = d.Detect(header); fs.scanner != nil {
+				fs.boundary = 0
+				fs.aligned = true
+				break
+			}
+		}
+	}
+
+	cut := fs.nextCut()
+	chunk := make([]byte, cut)
+	copy(chunk, fs.buf)
+	fs.buf = fs.buf[:copy(fs.buf, fs.buf[cut:])]
+	if fs.boundary >= 0 {
+		fs.boundary -= int64(cut)
+	}
+	fs.aligned = fs.boundary == 0
+	return chunk, nil
+}
+
+// nextCut returns the length of the next chunk.
+func (fs *formatSplitter) nextCut() int {
+	for fs.scanner != nil && fs.boundary >= 0 && fs.boundary <= int64(fs.size) {
+		b := int(fs.boundary)
+		// Chunks that do not start at a boundary end at the first one, to
+		// align the next chunk.
+		if b > 0 && (b >= fs.min || !fs.aligned) {
+			return b
+		}
+		if b >= len(fs.buf) {
+			break
+		}
+		length, ok := fs.scanner.RecordLength(fs.buf[b:min(len(fs.buf), b+FormatHeaderSize)])
+		if !ok || length <= 0 {
+			fs.scanner = nil
+			fs.boundary = -1
+			break
+		}
+		fs.boundary += length
+	}
+	return min(fs.size, len(fs.buf))
+}
+
+// tarFormat detects POSIX tar archives, whose records are the entries.
+type tarFormat struct{}
+
+func (tarFormat) Detect(header []byte) RecordScanner {
+	if len(header) < 512 || string(header[257:262]) != "ustar" {
+		return nil
+	}
+	return tarFormat{}
+}
+
+func (tarFormat) RecordLength(header []byte) (int64, bool) {
+	if len(header) < 512 || header[0] == 0 {
+		// The end of the archive.
+		return 0, false
+	}
+	size, ok := parseTarNumber(header[124:136])
+	if !ok || size < 0 {
+		return 0, false
+	}
+	return 512 + (size+511)/512*512, true
+}
+
+// parseTarNumber parses a numeric field of a tar header, in octal or in
+// base-256.
+func parseTarNumber(field []byte) (int64, bool) {
+	if field[0]&0x80 != 0 {
+		if field[0] != 0x80 || len(field) < 9 {
+			return 0, false
+		}
+		v := binary.BigEndian.Uint64(field[len(field)-8:])
+		return int64(v), v < 1<<63 && bytes.Count(field[1:len(field)-8], []byte{0}) == len(field)-9
+	}
+	s := strings.Trim(string(field), " \x00")
+	if s == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseInt(s, 8, 64)
+	return v, err == nil
+}
+
+// zipFormat detects zip archives, whose records are the local file headers
+// followed by the data of the files, then the entries of the central
+// directory.
+type zipFormat struct{}
+
+func (zipFormat) Detect(header []byte) RecordScanner {
+	if !bytes.HasPrefix(header, []byte("PK\x03\x04")) {
+		return nil
+	}
+	return zipFormat{}
+}
+
+func (zipFormat) RecordLength(header []byte) (int64, bool) {
+	if len(header) < 4 {
+		return 0, false
+	}
+	le := binary.LittleEndian
+	switch string(header[:4]) {
+	case "PK\x03\x04":
+		if len(header) < 30 {
+			return 0, false
+		}
+		// The sizes of the files written with a data descriptor, and of
+		// zip64 files, are not in the local file header.
+		csize := le.Uint32(header[18:])
+		if le.Uint16(header[6:])&0x8 != 0 || csize == 0xffffffff {
+			return 0, false
+		}
+		return 30 + int64(le.Uint16(header[26:])) + int64(le.Uint16(header[28:])) + int64(csize), true
+	case "PK\x01\x02":
+		if len(header) < 46 {
+			return 0, false
+		}
+		return 46 + int64(le.Uint16(header[28:])) + int64(le.Uint16(header[30:])) + int64(le.Uint16(header[32:])), true
+	case "PK\x05\x06":
+		if len(header) < 22 {
+			return 0, false
+		}
+		return 22 + int64(le.Uint16(header[20:])), true
+	default:
+		return 0, false
+	}
+}
+
+// wasmFormat detects WebAssembly modules, whose records are the preamble and
+// the sections.
+type wasmFormat struct{}
+
+func (wasmFormat) Detect(header []byte) RecordScanner {
+	if !bytes.HasPrefix(header, []byte("\x00asm")) || len(header) < 8 {
+		return nil
+	}
+	return &wasmScanner{}
+}
+
+type wasmScanner struct {
+	preamble bool
+}
+
+func (ws *wasmScanner) RecordLength(header []byte) (int64, bool) {
+	if !ws.preamble {
+		ws.preamble = true
+		return 8, true
+	}
+	if len(header) < 2 {
+		return 0, false
+	}
+	size, n := binary.Uvarint(header[1:min(len(header), 6)])
+	if n <= 0 || size > 1<<32-1 {
+		return 0, false
+	}
+	return 1 + int64(n) + int64(size), true
+}
+
+// mp4Format detects MP4 files, and other ISO base media files, whose records
+// are the top-level boxes.
+type mp4Format struct{}
+
+func (mp4Format) Detect(header []byte) RecordScanner {
+	if len(header) < 8 || string(header[4:8]) != "ftyp" {
+		return nil
+	}
+	return mp4Format{}
+}
+
+func (mp4Format) RecordLength(header []byte) (int64, bool) {
+	if len(header) < 8 {
+		return 0, false
+	}
+	switch size := binary.BigEndian.Uint32(header); size {
+	case 0:
+		// The box extends to the end of the file.
+		return 0, false
+	case 1:
+		if len(header) < 16 {
+			return 0, false
+		}
+		largeSize := binary.BigEndian.Uint64(header[8:])
+		return int64(largeSize), largeSize >= 16 && largeSize < 1<<63
+	default:
+		return int64(size), size >= 8
+	}
+}
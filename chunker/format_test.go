@@ -0,0 +1,236 @@
+package chunk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// scanRecords returns the offsets of the records of data found by d.
+func scanRecords(t *testing.T, d FormatDetector, data []byte) []int64 {
+	s := d.Detect(data[:min(len(data), FormatHeaderSize)])
+	if s == nil {
+		t.Fatal("format not detected")
+	}
+	var offsets []int64
+	for off := int64(0); off < int64(len(data)); {
+		length, ok := s.RecordLength(data[off:min(int64(len(data)), off+FormatHeaderSize)])
+		if !ok {
+			break
+		}
+		offsets = append(offsets, off)
+		off += length
+	}
+	return offsets
+}
+
+type tarFile struct {
+	name string
+	data []byte
+}
+
+func makeTar(t *testing.T, files ...tarFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Format: tar.FormatUSTAR})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFormatRecords(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tar", func(t *testing.T) {
+		data := makeTar(t, tarFile{"a", randBuf(t, 1000)}, tarFile{"b", nil}, tarFile{"c", randBuf(t, 512)})
+		offsets := scanRecords(t, tarFormat{}, data)
+		if !equalOffsets(offsets, []int64{0, 1536, 2048}) {
+			t.Fatal("unexpected records", offsets)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, name := range []string{"a", "bb"} {
+			content := randBuf(t, 700)
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               name,
+				Method:             zip.Store,
+				CRC32:              crc32.ChecksumIEEE(content),
+				CompressedSize64:   uint64(len(content)),
+				UncompressedSize64: uint64(len(content)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = w.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		offsets := scanRecords(t, zipFormat{}, data)
+		if !equalOffsets(offsets, []int64{0, 731, 1463, 1510, 1558}) {
+			t.Fatal("unexpected records", offsets)
+		}
+		if offsets[len(offsets)-1]+22 != int64(len(data)) {
+			t.Fatal("records do not cover the archive")
+		}
+	})
+
+	t.Run("wasm", func(t *testing.T) {
+		data := []byte("\x00asm\x01\x00\x00\x00")
+		data = append(data, 1, 2, 0xaa, 0xbb)
+		data = append(data, 10, 0x80, 0x01)
+		data = append(data, make([]byte, 128)...)
+		offsets := scanRecords(t, wasmFormat{}, data)
+		if !equalOffsets(offsets, []int64{0, 8, 12}) {
+			t.Fatal("unexpected records", offsets)
+		}
+	})
+
+	t.Run("mp4", func(t *testing.T) {
+		box := func(typ string, size int) []byte {
+			b := make([]byte, size)
+			binary.BigEndian.PutUint32(b, uint32(size))
+			copy(b[4:], typ)
+			return b
+		}
+		data := append(box("ftyp", 24), box("moov", 100)...)
+		mdat := make([]byte, 20)
+		binary.BigEndian.PutUint32(mdat, 1)
+		copy(mdat[4:], "mdat")
+		binary.BigEndian.PutUint64(mdat[8:], 20)
+		data = append(data, mdat...)
+		offsets := scanRecords(t, mp4Format{}, data)
+		if !equalOffsets(offsets, []int64{0, 24, 124}) {
+			t.Fatal("unexpected records", offsets)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		data := randBuf(t, 1000)
+		for _, d := range DefaultFormatDetectors {
+			if d.Detect(data) != nil {
+				t.Fatalf("%T detected random data", d)
+			}
+		}
+	})
+}
+
+func equalOffsets(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitChunks(t *testing.T, s Splitter) [][]byte {
+	var chunks [][]byte
+	for {
+		chunk, err := s.NextBytes()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// sharedBytes returns the size of the chunks of b that are also chunks of a.
+func sharedBytes(a, b [][]byte) int {
+	seen := make(map[string]bool)
+	for _, c := range a {
+		seen[string(c)] = true
+	}
+	var shared int
+	for _, c := range b {
+		if seen[string(c)] {
+			shared += len(c)
+		}
+	}
+	return shared
+}
+
+func TestFormatSplitter(t *testing.T) {
+	t.Parallel()
+
+	const size = 64 << 10
+	b, c, d := randBuf(t, 3000), randBuf(t, 400<<10), randBuf(t, 50<<10)
+	v1 := makeTar(t, tarFile{"a", randBuf(t, 100<<10)}, tarFile{"b", b}, tarFile{"c", c}, tarFile{"d", d})
+	v2 := makeTar(t, tarFile{"a", randBuf(t, 130<<10)}, tarFile{"b", b}, tarFile{"c", c}, tarFile{"d", d})
+
+	chunks1 := splitChunks(t, NewFormatSplitter(bytes.NewReader(v1), size))
+	chunks2 := splitChunks(t, NewFormatSplitter(bytes.NewReader(v2), size))
+	for _, chunk := range chunks2 {
+		if len(chunk) > size {
+			t.Fatal("chunk larger than size", len(chunk))
+		}
+	}
+	if !bytes.Equal(bytes.Join(chunks2, nil), v2) {
+		t.Fatal("chunks do not match the data")
+	}
+
+	// The entries after the modified one are in the same chunks.
+	unchanged := len(v2) - 130<<10 - 512
+	if shared := sharedBytes(chunks1, chunks2); shared < unchanged-1024 {
+		t.Fatalf("expected at least %d bytes deduplicated, got %d", unchanged-1024, shared)
+	}
+	sizeShared := sharedBytes(splitChunks(t, NewSizeSplitter(bytes.NewReader(v1), size)), splitChunks(t, NewSizeSplitter(bytes.NewReader(v2), size)))
+	if sizeShared >= unchanged/2 {
+		t.Fatal("expected the size splitter to deduplicate less, got", sizeShared)
+	}
+
+	// Data in an unknown format is split by size.
+	data := randBuf(t, 3*size+10)
+	chunks := splitChunks(t, NewFormatSplitter(bytes.NewReader(data), size))
+	if len(chunks) != 4 || len(chunks[0]) != size || len(chunks[3]) != 10 {
+		t.Fatal("unexpected chunks of unknown data")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	r := bytes.NewReader(randBuf(t, 1000))
+
+	if _, err := FromString(r, "format"); err != nil {
+		t.Fatalf("Expected success, got: %#v", err)
+	}
+
+	if _, err := FromString(r, "format-32"); err != nil {
+		t.Fatalf("Expected success, got: %#v", err)
+	}
+
+	if _, err := FromString(r, "format-0"); err != ErrSize {
+		t.Fatalf("Expected an 'ErrSize' error, got: %#v", err)
+	}
+
+	if _, err := FromString(r, "format-2000000"); err != ErrSizeMax {
+		t.Fatalf("Expected 'ErrSizeMax', got: %#v", err)
+	}
+}
@@ -26,7 +26,7 @@ var (
 
 // FromString returns a Splitter depending on the given string:
 // it supports "default" (""), "size-{size}", "rabin", "rabin-{blocksize}",
-// "rabin-{min}-{avg}-{max}" and "buzhash".
+// "rabin-{min}-{avg}-{max}", "buzhash", "format" and "format-{size}".
 func FromString(r io.Reader, chunker string) (Splitter, error) {
 	switch {
 	case chunker == "" || chunker == "default":
@@ -50,6 +50,20 @@ func FromString(r io.Reader, chunker string) (Splitter, error) {
 	case chunker == "buzhash":
 		return NewBuzhash(r), nil
 
+	case chunker == "format":
+		return NewFormatSplitter(r, DefaultBlockSize), nil
+
+	case strings.HasPrefix(chunker, "format-"):
+		size, err := strconv.Atoi(strings.TrimPrefix(chunker, "format-"))
+		if err != nil {
+			return nil, err
+		} else if size <= 0 {
+			return nil, ErrSize
+		} else if size > ChunkSizeLimit {
+			return nil, ErrSizeMax
+		}
+		return NewFormatSplitter(r, int64(size)), nil
+
 	default:
 		return nil, fmt.Errorf("unrecognized chunker option: %s", chunker)
 	}
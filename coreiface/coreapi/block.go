@@ -0,0 +1,98 @@
+package coreapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/coreiface"
+	"github.com/ipfs/boxo/path"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+type blockAPI CoreAPI
+
+// Put implements [coreiface.BlockAPI].
+func (api *blockAPI) Put(ctx context.Context, data []byte, opts ...coreiface.PutOption) (coreiface.BlockStat, error) {
+	options := coreiface.ProcessPutOptions(opts)
+	if options.Pin && api.pinner == nil {
+		return coreiface.BlockStat{}, ErrNoPinner
+	}
+
+	prefix := cid.Prefix{
+		Version:  1,
+		Codec:    options.Codec,
+		MhType:   options.MhType,
+		MhLength: -1,
+	}
+	c, err := prefix.Sum(data)
+	if err != nil {
+		return coreiface.BlockStat{}, err
+	}
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return coreiface.BlockStat{}, err
+	}
+	if err := api.blockService.AddBlock(ctx, blk); err != nil {
+		return coreiface.BlockStat{}, err
+	}
+
+	if options.Pin {
+		if err := api.pinner.PinWithMode(ctx, c, pin.Recursive, options.PinName); err != nil {
+			return coreiface.BlockStat{}, err
+		}
+		if err := api.pinner.Flush(ctx); err != nil {
+			return coreiface.BlockStat{}, err
+		}
+	}
+	return coreiface.BlockStat{Path: path.FromCid(c), Size: len(data)}, nil
+}
+
+// Get implements [coreiface.BlockAPI].
+func (api *blockAPI) Get(ctx context.Context, p path.Path) (io.Reader, error) {
+	blk, err := api.getBlock(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(blk.RawData()), nil
+}
+
+// Stat implements [coreiface.BlockAPI].
+func (api *blockAPI) Stat(ctx context.Context, p path.Path) (coreiface.BlockStat, error) {
+	blk, err := api.getBlock(ctx, p)
+	if err != nil {
+		return coreiface.BlockStat{}, err
+	}
+	return coreiface.BlockStat{Path: path.FromCid(blk.Cid()), Size: len(blk.RawData())}, nil
+}
+
+// Rm implements [coreiface.BlockAPI].
+func (api *blockAPI) Rm(ctx context.Context, p path.Path) error {
+	rp, _, err := (*CoreAPI)(api).ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+	c := rp.RootCid()
+
+	if api.pinner != nil {
+		reason, pinned, err := api.pinner.IsPinned(ctx, c)
+		if err != nil {
+			return err
+		}
+		if pinned {
+			return fmt.Errorf("cannot remove block %s: pinned %s", c, reason)
+		}
+	}
+	return api.blockService.DeleteBlock(ctx, c)
+}
+
+func (api *blockAPI) getBlock(ctx context.Context, p path.Path) (blocks.Block, error) {
+	rp, _, err := (*CoreAPI)(api).ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return api.blockService.GetBlock(ctx, rp.RootCid())
+}
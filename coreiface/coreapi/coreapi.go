@@ -0,0 +1,153 @@
+// Package coreapi implements [coreiface.CoreAPI] in-process with boxo
+// components: a [blockservice.BlockService], over bitswap or any other
+// exchange, for the content, a [pin.Pinner] for the pins, and a
+// [namesys.NameSystem] with a [keystore.Keystore] for the IPNS names.
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/coreiface"
+	bsfetcher "github.com/ipfs/boxo/fetcher/impl/blockservice"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/boxo/path/resolver"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-unixfsnode"
+	dagpb "github.com/ipld/go-codec-dagpb"
+)
+
+var (
+	// ErrNoPinner is returned by the pinning operations of a [CoreAPI]
+	// created without [WithPinner].
+	ErrNoPinner = errors.New("no pinner has been provided")
+
+	// ErrNoKeystore is returned by [coreiface.NameAPI.Publish] for a
+	// [CoreAPI] created without [WithKeystore].
+	ErrNoKeystore = errors.New("no keystore has been provided")
+)
+
+// CoreAPI implements [coreiface.CoreAPI] with boxo components.
+type CoreAPI struct {
+	blockService blockservice.BlockService
+	dagService   ipld.DAGService
+	resolver     resolver.Resolver
+	pinner       pin.Pinner
+	nameSystem   namesys.NameSystem
+	keystore     keystore.Keystore
+}
+
+var _ coreiface.CoreAPI = (*CoreAPI)(nil)
+
+// Option configures a [CoreAPI] created with [New].
+type Option func(*CoreAPI)
+
+// WithPinner sets the pinner of the [CoreAPI], without which the pinning
+// operations fail with [ErrNoPinner].
+func WithPinner(pinner pin.Pinner) Option {
+	return func(api *CoreAPI) {
+		api.pinner = pinner
+	}
+}
+
+// WithNameSystem sets the name system with which the [CoreAPI] publishes and
+// resolves IPNS names and DNSLinks, without which they fail with
+// [namesys.ErrNoNamesys].
+func WithNameSystem(ns namesys.NameSystem) Option {
+	return func(api *CoreAPI) {
+		api.nameSystem = ns
+	}
+}
+
+// WithKeystore sets the keystore holding the keys with which the [CoreAPI]
+// publishes IPNS names, without which publishing fails with [ErrNoKeystore].
+func WithKeystore(ks keystore.Keystore) Option {
+	return func(api *CoreAPI) {
+		api.keystore = ks
+	}
+}
+
+// New creates a [CoreAPI] storing and retrieving the content with
+// blockService.
+func New(blockService blockservice.BlockService, opts ...Option) *CoreAPI {
+	fetcherCfg := bsfetcher.NewFetcherConfig(blockService)
+	fetcherCfg.PrototypeChooser = dagpb.AddSupportToChooser(bsfetcher.DefaultPrototypeChooser)
+
+	api := &CoreAPI{
+		blockService: blockService,
+		dagService:   merkledag.NewDAGService(blockService),
+		resolver:     resolver.NewBasicResolver(fetcherCfg.WithReifier(unixfsnode.Reify)),
+	}
+	for _, opt := range opts {
+		opt(api)
+	}
+	return api
+}
+
+// Unixfs implements [coreiface.CoreAPI].
+func (api *CoreAPI) Unixfs() coreiface.UnixfsAPI {
+	return (*unixfsAPI)(api)
+}
+
+// Block implements [coreiface.CoreAPI].
+func (api *CoreAPI) Block() coreiface.BlockAPI {
+	return (*blockAPI)(api)
+}
+
+// Dag implements [coreiface.CoreAPI].
+func (api *CoreAPI) Dag() ipld.DAGService {
+	return api.dagService
+}
+
+// Name implements [coreiface.CoreAPI].
+func (api *CoreAPI) Name() coreiface.NameAPI {
+	return (*nameAPI)(api)
+}
+
+// Pin implements [coreiface.CoreAPI].
+func (api *CoreAPI) Pin() coreiface.PinAPI {
+	return (*pinAPI)(api)
+}
+
+// ResolvePath implements [coreiface.CoreAPI].
+func (api *CoreAPI) ResolvePath(ctx context.Context, p path.Path) (path.ImmutablePath, []string, error) {
+	if p.Mutable() {
+		if api.nameSystem == nil {
+			return path.ImmutablePath{}, nil, namesys.ErrNoNamesys
+		}
+		res, err := api.nameSystem.Resolve(ctx, p)
+		if err != nil {
+			return path.ImmutablePath{}, nil, err
+		}
+		p = res.Path
+	}
+
+	imPath, err := path.NewImmutablePath(p)
+	if err != nil {
+		return path.ImmutablePath{}, nil, err
+	}
+	c, remainder, err := api.resolver.ResolveToLastNode(ctx, imPath)
+	if err != nil {
+		return path.ImmutablePath{}, nil, err
+	}
+	return path.FromCid(c), remainder, nil
+}
+
+// ResolveNode implements [coreiface.CoreAPI].
+func (api *CoreAPI) ResolveNode(ctx context.Context, p path.Path) (ipld.Node, error) {
+	rp, _, err := api.ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := api.dagService.Get(ctx, rp.RootCid())
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s: %w", rp, err)
+	}
+	return nd, nil
+}
@@ -0,0 +1,202 @@
+package coreapi
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/coreiface"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/boxo/pinning/pinner/dspinner"
+	offroute "github.com/ipfs/boxo/routing/offline"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	record "github.com/libp2p/go-libp2p-record"
+	ci "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAPI(t *testing.T) *CoreAPI {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := blockstore.NewBlockstore(dstore)
+	bserv := blockservice.New(bs, offline.Exchange(bs))
+
+	pinner, err := dspinner.New(ctx, dstore, merkledag.NewDAGService(bserv))
+	require.NoError(t, err)
+
+	ks := keystore.NewMemKeystore()
+	sk, _, err := ci.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	require.NoError(t, ks.Put("self", sk))
+
+	routing := offroute.NewOfflineRouter(dstore, record.NamespacedValidator{
+		"ipns": ipns.Validator{},
+		"pk":   record.PublicKeyValidator{},
+	})
+	ns, err := namesys.NewNameSystem(routing, namesys.WithDatastore(dstore))
+	require.NoError(t, err)
+
+	return New(bserv, WithPinner(pinner), WithNameSystem(ns), WithKeystore(ks))
+}
+
+func TestUnixfs(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("hello")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"b.txt": files.NewBytesFile([]byte("world")),
+		}),
+	})
+	root, err := api.Unixfs().Add(ctx, dir, coreiface.AddWithPin("dir"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), root.RootCid().Version())
+
+	p, err := path.Join(root, "sub", "b.txt")
+	require.NoError(t, err)
+	nd, err := api.Unixfs().Get(ctx, p)
+	require.NoError(t, err)
+	data, err := io.ReadAll(files.ToFile(nd))
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+
+	entries, err := api.Unixfs().Ls(ctx, root)
+	require.NoError(t, err)
+	var names []string
+	for entry := range entries {
+		require.NoError(t, entry.Err)
+		names = append(names, entry.Name)
+	}
+	require.ElementsMatch(t, []string{"a.txt", "sub"}, names)
+
+	reason, pinned, err := api.Pin().IsPinned(ctx, p)
+	require.NoError(t, err)
+	require.True(t, pinned)
+	require.Contains(t, reason, root.RootCid().String())
+
+	t.Run("CIDv0", func(t *testing.T) {
+		p, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("hello")), coreiface.AddWithCidVersion(0))
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), p.RootCid().Version())
+	})
+}
+
+func TestBlock(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+
+	stat, err := api.Block().Put(ctx, []byte("block"))
+	require.NoError(t, err)
+	require.Equal(t, 5, stat.Size)
+
+	r, err := api.Block().Get(ctx, stat.Path)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "block", string(data))
+
+	require.NoError(t, api.Block().Rm(ctx, stat.Path))
+	_, err = api.Block().Stat(ctx, stat.Path)
+	require.Error(t, err)
+
+	t.Run("Pinned blocks are not removed", func(t *testing.T) {
+		stat, err := api.Block().Put(ctx, []byte("pinned"), coreiface.PutWithPin(""))
+		require.NoError(t, err)
+		require.Error(t, api.Block().Rm(ctx, stat.Path))
+
+		require.NoError(t, api.Pin().Rm(ctx, stat.Path, true))
+		require.NoError(t, api.Block().Rm(ctx, stat.Path))
+	})
+}
+
+func TestPin(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+
+	a, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("a")))
+	require.NoError(t, err)
+	b, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("b")))
+	require.NoError(t, err)
+
+	require.NoError(t, api.Pin().Add(ctx, a, true, "a"))
+	require.NoError(t, api.Pin().Add(ctx, b, false, "b"))
+
+	pins, err := api.Pin().Ls(ctx, pin.Any)
+	require.NoError(t, err)
+	modes := map[string]pin.Mode{}
+	for sp := range pins {
+		require.NoError(t, sp.Err)
+		modes[sp.Pin.Name] = sp.Pin.Mode
+	}
+	require.Equal(t, map[string]pin.Mode{"a": pin.Recursive, "b": pin.Direct}, modes)
+
+	c, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("c")))
+	require.NoError(t, err)
+	require.NoError(t, api.Pin().Update(ctx, a, c, true))
+	_, pinned, err := api.Pin().IsPinned(ctx, a)
+	require.NoError(t, err)
+	require.False(t, pinned)
+
+	require.NoError(t, api.Pin().Rm(ctx, b, false))
+	_, pinned, err = api.Pin().IsPinned(ctx, b)
+	require.NoError(t, err)
+	require.False(t, pinned)
+
+	_, err = api.Pin().Ls(ctx, pin.Indirect)
+	require.Error(t, err)
+}
+
+func TestName(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+
+	root, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"index.html": files.NewBytesFile([]byte("<p>hello</p>")),
+	}))
+	require.NoError(t, err)
+
+	name, err := api.Name().Publish(ctx, root, "self")
+	require.NoError(t, err)
+
+	p, err := api.Name().Resolve(ctx, name.String())
+	require.NoError(t, err)
+	require.Equal(t, root.String(), p.String())
+
+	// Paths are resolved through their IPNS names.
+	ipnsPath, err := path.Join(name.AsPath(), "index.html")
+	require.NoError(t, err)
+	nd, err := api.Unixfs().Get(ctx, ipnsPath)
+	require.NoError(t, err)
+	data, err := io.ReadAll(files.ToFile(nd))
+	require.NoError(t, err)
+	require.Equal(t, "<p>hello</p>", string(data))
+
+	_, err = api.Name().Publish(ctx, root, "missing")
+	require.ErrorIs(t, err, keystore.ErrNoSuchKey)
+}
+
+func TestMissingComponents(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	api := New(blockservice.New(bs, offline.Exchange(bs)))
+
+	root, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("a")))
+	require.NoError(t, err)
+
+	_, err = api.Unixfs().Add(ctx, files.NewBytesFile([]byte("a")), coreiface.AddWithPin(""))
+	require.ErrorIs(t, err, ErrNoPinner)
+	require.ErrorIs(t, api.Pin().Add(ctx, root, true, ""), ErrNoPinner)
+	_, err = api.Name().Publish(ctx, root, "self")
+	require.ErrorIs(t, err, namesys.ErrNoNamesys)
+}
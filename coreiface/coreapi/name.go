@@ -0,0 +1,55 @@
+package coreapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type nameAPI CoreAPI
+
+// Publish implements [coreiface.NameAPI].
+func (api *nameAPI) Publish(ctx context.Context, p path.Path, key string, opts ...namesys.PublishOption) (ipns.Name, error) {
+	if api.nameSystem == nil {
+		return ipns.Name{}, namesys.ErrNoNamesys
+	}
+	if api.keystore == nil {
+		return ipns.Name{}, ErrNoKeystore
+	}
+
+	sk, err := api.keystore.Get(key)
+	if err != nil {
+		return ipns.Name{}, err
+	}
+	pid, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return ipns.Name{}, err
+	}
+	if err := api.nameSystem.Publish(ctx, sk, p, opts...); err != nil {
+		return ipns.Name{}, err
+	}
+	return ipns.NameFromPeer(pid), nil
+}
+
+// Resolve implements [coreiface.NameAPI].
+func (api *nameAPI) Resolve(ctx context.Context, name string, opts ...namesys.ResolveOption) (path.Path, error) {
+	if api.nameSystem == nil {
+		return nil, namesys.ErrNoNamesys
+	}
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + path.IPNSNamespace + "/" + name
+	}
+	p, err := path.NewPath(name)
+	if err != nil {
+		return nil, err
+	}
+	res, err := api.nameSystem.Resolve(ctx, p, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.Path, nil
+}
@@ -0,0 +1,107 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/boxo/path"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+)
+
+type pinAPI CoreAPI
+
+// Add implements [coreiface.PinAPI].
+func (api *pinAPI) Add(ctx context.Context, p path.Path, recursive bool, name string) error {
+	if api.pinner == nil {
+		return ErrNoPinner
+	}
+	nd, err := (*CoreAPI)(api).ResolveNode(ctx, p)
+	if err != nil {
+		return err
+	}
+	if err := api.pinner.Pin(ctx, nd, recursive, name); err != nil {
+		return err
+	}
+	return api.pinner.Flush(ctx)
+}
+
+// Rm implements [coreiface.PinAPI].
+func (api *pinAPI) Rm(ctx context.Context, p path.Path, recursive bool) error {
+	if api.pinner == nil {
+		return ErrNoPinner
+	}
+	rp, _, err := (*CoreAPI)(api).ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+	if err := api.pinner.Unpin(ctx, rp.RootCid(), recursive); err != nil {
+		return err
+	}
+	return api.pinner.Flush(ctx)
+}
+
+// Update implements [coreiface.PinAPI].
+func (api *pinAPI) Update(ctx context.Context, from, to path.Path, unpin bool) error {
+	if api.pinner == nil {
+		return ErrNoPinner
+	}
+	fromPath, _, err := (*CoreAPI)(api).ResolvePath(ctx, from)
+	if err != nil {
+		return err
+	}
+	toPath, _, err := (*CoreAPI)(api).ResolvePath(ctx, to)
+	if err != nil {
+		return err
+	}
+	if err := api.pinner.Update(ctx, fromPath.RootCid(), toPath.RootCid(), unpin); err != nil {
+		return err
+	}
+	return api.pinner.Flush(ctx)
+}
+
+// IsPinned implements [coreiface.PinAPI].
+func (api *pinAPI) IsPinned(ctx context.Context, p path.Path) (string, bool, error) {
+	if api.pinner == nil {
+		return "", false, ErrNoPinner
+	}
+	rp, _, err := (*CoreAPI)(api).ResolvePath(ctx, p)
+	if err != nil {
+		return "", false, err
+	}
+	return api.pinner.IsPinned(ctx, rp.RootCid())
+}
+
+// Ls implements [coreiface.PinAPI].
+func (api *pinAPI) Ls(ctx context.Context, mode pin.Mode) (<-chan pin.StreamedPin, error) {
+	if api.pinner == nil {
+		return nil, ErrNoPinner
+	}
+	switch mode {
+	case pin.Direct:
+		return api.pinner.DirectKeys(ctx, true), nil
+	case pin.Recursive:
+		return api.pinner.RecursiveKeys(ctx, true), nil
+	case pin.Any:
+	default:
+		modeStr, _ := pin.ModeToString(mode)
+		return nil, fmt.Errorf("cannot list the %q pins", modeStr)
+	}
+
+	out := make(chan pin.StreamedPin)
+	go func() {
+		defer close(out)
+		for _, keys := range []func(context.Context, bool) <-chan pin.StreamedPin{
+			api.pinner.DirectKeys,
+			api.pinner.RecursiveKeys,
+		} {
+			for sp := range keys(ctx, true) {
+				select {
+				case out <- sp:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
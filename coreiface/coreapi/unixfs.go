@@ -0,0 +1,157 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/coreiface"
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	h "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/trickle"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+type unixfsAPI CoreAPI
+
+// Add implements [coreiface.UnixfsAPI].
+func (api *unixfsAPI) Add(ctx context.Context, node files.Node, opts ...coreiface.AddOption) (path.ImmutablePath, error) {
+	options := coreiface.ProcessAddOptions(opts)
+	if options.Pin && api.pinner == nil {
+		return path.ImmutablePath{}, ErrNoPinner
+	}
+	prefix, err := merkledag.PrefixForCidVersion(options.CidVersion)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+
+	nd, err := api.add(ctx, node, options, prefix)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+
+	if options.Pin {
+		if err := api.pinner.Pin(ctx, nd, true, options.PinName); err != nil {
+			return path.ImmutablePath{}, err
+		}
+		if err := api.pinner.Flush(ctx); err != nil {
+			return path.ImmutablePath{}, err
+		}
+	}
+	return path.FromCid(nd.Cid()), nil
+}
+
+func (api *unixfsAPI) add(ctx context.Context, node files.Node, options coreiface.AddOptions, prefix cid.Prefix) (ipld.Node, error) {
+	switch n := node.(type) {
+	case *files.Symlink:
+		data, err := ft.SymlinkData(n.Target)
+		if err != nil {
+			return nil, err
+		}
+		nd := merkledag.NodeWithData(data)
+		if err := nd.SetCidBuilder(prefix); err != nil {
+			return nil, err
+		}
+		if err := api.dagService.Add(ctx, nd); err != nil {
+			return nil, err
+		}
+		return nd, nil
+	case files.File:
+		spl, err := chunker.FromString(n, options.Chunker)
+		if err != nil {
+			return nil, err
+		}
+		params := h.DagBuilderParams{
+			Dagserv:    api.dagService,
+			Maxlinks:   h.DefaultLinksPerBlock,
+			RawLeaves:  options.RawLeaves,
+			CidBuilder: prefix,
+		}
+		db, err := params.New(spl)
+		if err != nil {
+			return nil, err
+		}
+		if options.Trickle {
+			return trickle.Layout(db)
+		}
+		return balanced.Layout(db)
+	case files.Directory:
+		dir := uio.NewDirectory(api.dagService)
+		dir.SetCidBuilder(prefix)
+		it := n.Entries()
+		for it.Next() {
+			child, err := api.add(ctx, it.Node(), options, prefix)
+			if err != nil {
+				return nil, err
+			}
+			if err := dir.AddChild(ctx, it.Name(), child); err != nil {
+				return nil, err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		nd, err := dir.GetNode()
+		if err != nil {
+			return nil, err
+		}
+		if err := api.dagService.Add(ctx, nd); err != nil {
+			return nil, err
+		}
+		return nd, nil
+	default:
+		return nil, fmt.Errorf("unsupported node type %T", node)
+	}
+}
+
+// Get implements [coreiface.UnixfsAPI].
+func (api *unixfsAPI) Get(ctx context.Context, p path.Path) (files.Node, error) {
+	nd, err := (*CoreAPI)(api).ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return unixfile.NewUnixfsFile(ctx, api.dagService, nd)
+}
+
+// Ls implements [coreiface.UnixfsAPI].
+func (api *unixfsAPI) Ls(ctx context.Context, p path.Path) (<-chan coreiface.DirEntry, error) {
+	nd, err := (*CoreAPI)(api).ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := uio.NewDirectoryFromNode(api.dagService, nd)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan coreiface.DirEntry)
+	go func() {
+		defer close(out)
+		for res := range dir.EnumLinksAsync(ctx) {
+			var entry coreiface.DirEntry
+			if res.Err != nil {
+				entry.Err = res.Err
+			} else {
+				entry.Name = res.Link.Name
+				entry.Cid = res.Link.Cid
+				entry.Size = res.Link.Size
+			}
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				return
+			}
+			if entry.Err != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
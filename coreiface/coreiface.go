@@ -0,0 +1,134 @@
+// Package coreiface defines the API with which applications embed an IPFS
+// node: adding and retrieving UnixFS content, raw blocks and IPLD nodes,
+// pinning, and publishing and resolving IPNS names.
+//
+// The API only depends on boxo types, and package
+// [github.com/ipfs/boxo/coreiface/coreapi] implements it in-process with boxo
+// components, so that applications can embed a node without depending on
+// Kubo.
+package coreiface
+
+import (
+	"context"
+	"io"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// CoreAPI is the entry point of the API of an IPFS node.
+type CoreAPI interface {
+	// Unixfs returns the API to add and retrieve UnixFS files and
+	// directories.
+	Unixfs() UnixfsAPI
+
+	// Block returns the API to store and retrieve raw blocks.
+	Block() BlockAPI
+
+	// Dag returns the DAG service of the node, to store and retrieve IPLD
+	// nodes.
+	Dag() ipld.DAGService
+
+	// Name returns the API to publish and resolve IPNS names.
+	Name() NameAPI
+
+	// Pin returns the API to keep content from being garbage collected.
+	Pin() PinAPI
+
+	// ResolvePath resolves the path p, resolving its IPNS names or DNSLinks
+	// first, and returns the path of the last node it traverses, along with
+	// the segments of p remaining within that node.
+	ResolvePath(ctx context.Context, p path.Path) (path.ImmutablePath, []string, error)
+
+	// ResolveNode resolves the path p, as ResolvePath, and returns the last
+	// node it traverses.
+	ResolveNode(ctx context.Context, p path.Path) (ipld.Node, error)
+}
+
+// UnixfsAPI adds and retrieves UnixFS files and directories.
+type UnixfsAPI interface {
+	// Add imports node, a file, a directory or a symlink, as UnixFS and
+	// returns the path of its root.
+	Add(ctx context.Context, node files.Node, opts ...AddOption) (path.ImmutablePath, error)
+
+	// Get returns the UnixFS file, directory or symlink at p.
+	Get(ctx context.Context, p path.Path) (files.Node, error)
+
+	// Ls lists the entries of the UnixFS directory at p. The channel is
+	// closed once all the entries are sent, or on the first error, which is
+	// sent as the Err of the last entry.
+	Ls(ctx context.Context, p path.Path) (<-chan DirEntry, error)
+}
+
+// DirEntry is an entry of a UnixFS directory listed by [UnixfsAPI.Ls].
+type DirEntry struct {
+	Name string
+	Cid  cid.Cid
+
+	// Size is the cumulative size of the DAG of the entry, as recorded in
+	// the link of the directory.
+	Size uint64
+
+	Err error
+}
+
+// BlockAPI stores and retrieves raw blocks.
+type BlockAPI interface {
+	// Put stores data as a block and returns its path and size.
+	Put(ctx context.Context, data []byte, opts ...PutOption) (BlockStat, error)
+
+	// Get returns the data of the block at p.
+	Get(ctx context.Context, p path.Path) (io.Reader, error)
+
+	// Stat returns the path and size of the block at p.
+	Stat(ctx context.Context, p path.Path) (BlockStat, error)
+
+	// Rm removes the block at p from the local store. Pinned blocks are not
+	// removed.
+	Rm(ctx context.Context, p path.Path) error
+}
+
+// BlockStat describes a block returned by [BlockAPI].
+type BlockStat struct {
+	Path path.ImmutablePath
+	Size int
+}
+
+// NameAPI publishes and resolves IPNS names.
+type NameAPI interface {
+	// Publish publishes p under the IPNS name of the key named key, and
+	// returns that name.
+	Publish(ctx context.Context, p path.Path, key string, opts ...namesys.PublishOption) (ipns.Name, error)
+
+	// Resolve resolves name, an IPNS name or a DNSLink domain, with or
+	// without the /ipns/ prefix.
+	Resolve(ctx context.Context, name string, opts ...namesys.ResolveOption) (path.Path, error)
+}
+
+// PinAPI keeps content from being garbage collected.
+type PinAPI interface {
+	// Add pins the node at p, and all its descendants if recursive is set,
+	// fetching them if needed. Pinning again with another name replaces the
+	// name of the pin.
+	Add(ctx context.Context, p path.Path, recursive bool, name string) error
+
+	// Rm unpins the node at p. If recursive is set, a recursive or a direct
+	// pin is removed, otherwise only a direct pin.
+	Rm(ctx context.Context, p path.Path, recursive bool) error
+
+	// Update moves a recursive pin from the node at from to the node at to,
+	// keeping the pin of from unless unpin is set.
+	Update(ctx context.Context, from, to path.Path, unpin bool) error
+
+	// IsPinned returns whether the node at p is pinned, and how.
+	IsPinned(ctx context.Context, p path.Path) (string, bool, error)
+
+	// Ls lists the pins of mode, which is [pin.Direct], [pin.Recursive] or
+	// [pin.Any] for both.
+	Ls(ctx context.Context, mode pin.Mode) (<-chan pin.StreamedPin, error)
+}
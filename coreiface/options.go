@@ -0,0 +1,146 @@
+package coreiface
+
+import (
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// AddOptions specifies options for [UnixfsAPI.Add].
+type AddOptions struct {
+	// Chunker is the chunker string, such as "size-262144" or "rabin",
+	// with which files are split, see
+	// [github.com/ipfs/boxo/chunker.FromString].
+	Chunker string
+
+	// CidVersion is the version of the CIDs of the nodes.
+	CidVersion int
+
+	// RawLeaves stores the leaves of the files as raw blocks.
+	RawLeaves bool
+
+	// Trickle lays the files out as trickle DAGs instead of balanced ones.
+	Trickle bool
+
+	// Pin pins the root recursively, with the name PinName.
+	Pin     bool
+	PinName string
+}
+
+// DefaultAddOptions returns the default options for adding content: files
+// are split in chunks of 256 KiB into balanced DAGs with raw leaves, and all
+// the nodes use CIDv1.
+func DefaultAddOptions() AddOptions {
+	return AddOptions{
+		Chunker:    "size-262144",
+		CidVersion: 1,
+		RawLeaves:  true,
+	}
+}
+
+// AddOption is used to set an option for [AddOptions].
+type AddOption func(*AddOptions)
+
+// AddWithChunker sets the chunker string with which files are split.
+func AddWithChunker(chunker string) AddOption {
+	return func(o *AddOptions) {
+		o.Chunker = chunker
+	}
+}
+
+// AddWithCidVersion sets the version of the CIDs of the nodes. Raw leaves are
+// disabled with CIDv0, which cannot represent them.
+func AddWithCidVersion(version int) AddOption {
+	return func(o *AddOptions) {
+		o.CidVersion = version
+		if version == 0 {
+			o.RawLeaves = false
+		}
+	}
+}
+
+// AddWithRawLeaves sets whether the leaves of the files are raw blocks.
+func AddWithRawLeaves(rawLeaves bool) AddOption {
+	return func(o *AddOptions) {
+		o.RawLeaves = rawLeaves
+	}
+}
+
+// AddWithTrickle sets whether files are laid out as trickle DAGs.
+func AddWithTrickle(trickle bool) AddOption {
+	return func(o *AddOptions) {
+		o.Trickle = trickle
+	}
+}
+
+// AddWithPin pins the root of the added content recursively with name.
+func AddWithPin(name string) AddOption {
+	return func(o *AddOptions) {
+		o.Pin = true
+		o.PinName = name
+	}
+}
+
+// ProcessAddOptions converts an array of [AddOption] into a [AddOptions] object.
+func ProcessAddOptions(opts []AddOption) AddOptions {
+	addOptions := DefaultAddOptions()
+	for _, option := range opts {
+		option(&addOptions)
+	}
+	return addOptions
+}
+
+// PutOptions specifies options for [BlockAPI.Put].
+type PutOptions struct {
+	// Codec is the multicodec of the CID of the block.
+	Codec uint64
+
+	// MhType is the multihash function of the CID of the block.
+	MhType uint64
+
+	// Pin pins the block recursively, with the name PinName.
+	Pin     bool
+	PinName string
+}
+
+// DefaultPutOptions returns the default options for storing blocks: raw
+// blocks hashed with sha2-256.
+func DefaultPutOptions() PutOptions {
+	return PutOptions{
+		Codec:  cid.Raw,
+		MhType: mh.SHA2_256,
+	}
+}
+
+// PutOption is used to set an option for [PutOptions].
+type PutOption func(*PutOptions)
+
+// PutWithCodec sets the multicodec of the CID of the block.
+func PutWithCodec(codec uint64) PutOption {
+	return func(o *PutOptions) {
+		o.Codec = codec
+	}
+}
+
+// PutWithMhType sets the multihash function of the CID of the block.
+func PutWithMhType(mhType uint64) PutOption {
+	return func(o *PutOptions) {
+		o.MhType = mhType
+	}
+}
+
+// PutWithPin pins the block recursively with name.
+func PutWithPin(name string) PutOption {
+	return func(o *PutOptions) {
+		o.Pin = true
+		o.PinName = name
+	}
+}
+
+// ProcessPutOptions converts an array of [PutOption] into a [PutOptions] object.
+func ProcessPutOptions(opts []PutOption) PutOptions {
+	putOptions := DefaultPutOptions()
+	for _, option := range opts {
+		option(&putOptions)
+	}
+	return putOptions
+}
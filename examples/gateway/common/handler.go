@@ -80,8 +80,9 @@ func NewHandler(gwAPI gateway.IPFSBackend) http.Handler {
 	handler = withConnect(handler)
 
 	// Add headers middleware that applies any headers we define to all requests
-	// as well as a default CORS configuration.
-	handler = gateway.NewHeaders(nil).ApplyCors().Wrap(handler)
+	// as well as a default CORS configuration, refined by the CORS policies of
+	// the configuration, if any.
+	handler = gateway.NewHeaders(nil).ApplyCors().ApplyCORSPolicies(conf).Wrap(handler)
 
 	// Finally, wrap with the otelhttp handler. This will allow the tracing system
 	// to work and for correct propagation of tracing headers. This step is optional
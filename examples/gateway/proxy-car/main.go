@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ipfs/boxo/examples/gateway/common"
 	"github.com/ipfs/boxo/gateway"
@@ -15,10 +17,14 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	gatewayUrlPtr := flag.String("g", "", "gateway to proxy to")
+	gatewayUrlPtr := flag.String("g", "", "gateways to proxy to, separated by commas")
 	port := flag.Int("p", 8040, "port to run this gateway from")
+	race := flag.Int("race", 1, "number of gateways each request is raced against")
+	cacheSize := flag.Int("cache", 10000, "number of verified blocks kept in memory")
 	flag.Parse()
 
+	gatewayURLs := strings.Split(*gatewayUrlPtr, ",")
+
 	// Setups up tracing. This is optional and only required if the implementer
 	// wants to be able to enable tracing.
 	tp, err := common.SetupTracing(ctx, "CAR Gateway Example")
@@ -27,8 +33,30 @@ func main() {
 	}
 	defer (func() { _ = tp.Shutdown(ctx) })()
 
+	// Creates the CAR fetcher, which races requests against the remote gateways,
+	// retries partial and failed responses, and caches the verified blocks.
+	fetcher, err := gateway.NewRemoteCarFetcher(gatewayURLs, nil, gateway.WithUpstreamRacing(*race, 500*time.Millisecond))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fetcher, err = gateway.NewRetryCarFetcher(fetcher, 3)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache, err := gateway.NewCacheBlockStore(*cacheSize, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fetcher = gateway.NewCachingCarFetcher(fetcher, cache)
+
+	// Creates the value store, to fetch IPNS records from the remote gateways.
+	vs, err := gateway.NewRemoteValueStore(gatewayURLs, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Creates the gateway with the remote car (IPIP-402) backend.
-	backend, err := gateway.NewRemoteCarBackend([]string{*gatewayUrlPtr}, nil)
+	backend, err := gateway.NewCarBackend(fetcher, gateway.WithValueStore(vs))
 	if err != nil {
 		log.Fatal(err)
 	}
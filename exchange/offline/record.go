@@ -0,0 +1,225 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	exchange "github.com/ipfs/boxo/exchange"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+)
+
+// Recorder is an exchange recording the CIDs requested from, and the blocks
+// served by, the exchange it wraps, so that they can be saved as a CAR
+// fixture with WriteCAR and replayed with [Replay], e.g. to write
+// deterministic tests of gateways and applications.
+type Recorder struct {
+	ex exchange.Interface
+
+	lk        sync.Mutex
+	requested []cid.Cid
+	reqSet    *cid.Set
+	served    []blocks.Block
+	servedSet *cid.Set
+}
+
+var _ exchange.SessionExchange = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder wrapping ex.
+func NewRecorder(ex exchange.Interface) *Recorder {
+	return &Recorder{
+		ex:        ex,
+		reqSet:    cid.NewSet(),
+		servedSet: cid.NewSet(),
+	}
+}
+
+func (r *Recorder) GetBlock(ctx context.Context, k cid.Cid) (blocks.Block, error) {
+	return r.getBlock(ctx, r.ex, k)
+}
+
+func (r *Recorder) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return r.getBlocks(ctx, r.ex, ks)
+}
+
+// NewSession records the requests of a session of the wrapped exchange, if
+// it supports sessions.
+func (r *Recorder) NewSession(ctx context.Context) exchange.Fetcher {
+	sx, ok := r.ex.(exchange.SessionExchange)
+	if !ok {
+		return r
+	}
+	return &recorderSession{r: r, f: sx.NewSession(ctx)}
+}
+
+func (r *Recorder) NotifyNewBlocks(ctx context.Context, blks ...blocks.Block) error {
+	return r.ex.NotifyNewBlocks(ctx, blks...)
+}
+
+func (r *Recorder) Close() error {
+	return r.ex.Close()
+}
+
+// Requested returns the CIDs requested so far, in the order of their first
+// request.
+func (r *Recorder) Requested() []cid.Cid {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return append([]cid.Cid(nil), r.requested...)
+}
+
+// WriteCAR writes a CARv1 fixture whose roots are the CIDs requested so far,
+// and whose blocks are the blocks served so far, in the order they were
+// served.
+func (r *Recorder) WriteCAR(ctx context.Context, w io.Writer) error {
+	r.lk.Lock()
+	requested := append([]cid.Cid(nil), r.requested...)
+	served := append([]blocks.Block(nil), r.served...)
+	r.lk.Unlock()
+
+	if len(requested) == 0 {
+		return errors.New("no block was requested")
+	}
+	cw, err := storage.NewWritable(w, requested, carv2.WriteAsCarV1(true))
+	if err != nil {
+		return err
+	}
+	for _, blk := range served {
+		if err := cw.Put(ctx, blk.Cid().KeyString(), blk.RawData()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Recorder) request(ks ...cid.Cid) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	for _, k := range ks {
+		if r.reqSet.Visit(k) {
+			r.requested = append(r.requested, k)
+		}
+	}
+}
+
+func (r *Recorder) serve(blk blocks.Block) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if r.servedSet.Visit(blk.Cid()) {
+		r.served = append(r.served, blk)
+	}
+}
+
+func (r *Recorder) getBlock(ctx context.Context, f exchange.Fetcher, k cid.Cid) (blocks.Block, error) {
+	r.request(k)
+	blk, err := f.GetBlock(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	r.serve(blk)
+	return blk, nil
+}
+
+func (r *Recorder) getBlocks(ctx context.Context, f exchange.Fetcher, ks []cid.Cid) (<-chan blocks.Block, error) {
+	r.request(ks...)
+	in, err := f.GetBlocks(ctx, ks)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		for blk := range in {
+			r.serve(blk)
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// recorderSession records the requests of a session.
+type recorderSession struct {
+	r *Recorder
+	f exchange.Fetcher
+}
+
+func (s *recorderSession) GetBlock(ctx context.Context, k cid.Cid) (blocks.Block, error) {
+	return s.r.getBlock(ctx, s.f, k)
+}
+
+func (s *recorderSession) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return s.r.getBlocks(ctx, s.f, ks)
+}
+
+// Replay returns an exchange serving only the blocks of the CAR fixture read
+// from r, e.g. written by [Recorder.WriteCAR]. The blocks that are not in the
+// fixture are not found.
+func Replay(r io.Reader) (exchange.Interface, error) {
+	br, err := carv2.NewBlockReader(r)
+	if err != nil {
+		return nil, err
+	}
+	e := &replayExchange{blocks: make(map[cid.Cid]blocks.Block)}
+	for {
+		blk, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.blocks[blk.Cid()] = blk
+	}
+	return e, nil
+}
+
+// replayExchange serves the blocks of a fixture.
+type replayExchange struct {
+	blocks map[cid.Cid]blocks.Block
+}
+
+func (e *replayExchange) GetBlock(ctx context.Context, k cid.Cid) (blocks.Block, error) {
+	blk, ok := e.blocks[k]
+	if !ok {
+		return nil, fmt.Errorf("block was not found in the fixture (replay): %w", ipld.ErrNotFound{Cid: k})
+	}
+	return blk, nil
+}
+
+func (e *replayExchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		for _, k := range ks {
+			blk, ok := e.blocks[k]
+			if !ok {
+				continue
+			}
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// NotifyNewBlocks does nothing, as the fixture is immutable.
+func (e *replayExchange) NotifyNewBlocks(ctx context.Context, blocks ...blocks.Block) error {
+	return nil
+}
+
+func (e *replayExchange) Close() error {
+	return nil
+}
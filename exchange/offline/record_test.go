@@ -0,0 +1,79 @@
+package offline
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	u "github.com/ipfs/boxo/util"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-test/random"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	store := bstore()
+	blks := random.BlocksOfSize(3, blockSize)
+	for _, b := range blks {
+		if err := store.Put(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := cid.NewCidV0(u.Hash([]byte("missing")))
+
+	rec := NewRecorder(Exchange(store))
+	if _, err := rec.GetBlock(ctx, blks[0].Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.GetBlock(ctx, missing); err == nil {
+		t.Fatal("missing block was found")
+	}
+	ch, err := rec.NewSession(ctx).GetBlocks(ctx, []cid.Cid{blks[0].Cid(), blks[1].Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range ch {
+	}
+
+	requested := rec.Requested()
+	if len(requested) != 3 || requested[0] != blks[0].Cid() || requested[1] != missing || requested[2] != blks[1].Cid() {
+		t.Fatalf("unexpected requested CIDs: %v", requested)
+	}
+
+	var buf bytes.Buffer
+	if err := rec.WriteCAR(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := Replay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range blks[:2] {
+		blk, err := replay.GetBlock(ctx, b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(blk.RawData(), b.RawData()) {
+			t.Fatal("replayed block differs from the recorded one")
+		}
+	}
+	for _, k := range []cid.Cid{blks[2].Cid(), missing} {
+		if _, err := replay.GetBlock(ctx, k); !ipld.IsNotFound(err) {
+			t.Fatalf("expected block not found, got %v", err)
+		}
+	}
+
+	ch, err = replay.GetBlocks(ctx, []cid.Cid{blks[0].Cid(), blks[2].Cid(), blks[1].Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	for range ch {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("replayed %d blocks, expected 2", count)
+	}
+}
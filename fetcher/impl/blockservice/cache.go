@@ -0,0 +1,135 @@
+package bsfetcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	metrics "github.com/ipfs/go-metrics-interface"
+)
+
+// BlockCache is a block cache shared by the sessions of fetchers, see
+// [FetcherConfig.BlockCache]. It deduplicates the block requests of concurrent
+// traversals over overlapping DAGs: a block requested while another session
+// is fetching it is not requested again but waits for that fetch, and the
+// most recently fetched blocks are served from memory.
+type BlockCache struct {
+	mu       sync.Mutex
+	inflight map[string]*inflightBlock
+	recent   *lru.Cache[string, blocks.Block]
+
+	hits   atomic.Uint64
+	shared atomic.Uint64
+	misses atomic.Uint64
+
+	hitsMetric   metrics.Counter
+	sharedMetric metrics.Counter
+	missesMetric metrics.Counter
+}
+
+// inflightBlock is a block being fetched by a session.
+type inflightBlock struct {
+	done chan struct{}
+	blk  blocks.Block
+	err  error
+}
+
+// BlockCacheStats are the statistics of a [BlockCache].
+type BlockCacheStats struct {
+	// Hits is the number of blocks served from the recently fetched blocks.
+	Hits uint64
+	// Shared is the number of blocks served by waiting for the fetch of
+	// another session.
+	Shared uint64
+	// Misses is the number of blocks fetched from the block service.
+	Misses uint64
+}
+
+// NewBlockCache creates a [BlockCache] keeping the size most recently fetched
+// blocks in memory. With a size of 0, the cache only deduplicates the
+// concurrent requests. The metrics of the cache are registered in the scope
+// of ctx.
+func NewBlockCache(ctx context.Context, size int) (*BlockCache, error) {
+	c := &BlockCache{inflight: make(map[string]*inflightBlock)}
+	if size > 0 {
+		recent, err := lru.New[string, blocks.Block](size)
+		if err != nil {
+			return nil, err
+		}
+		c.recent = recent
+	}
+	c.hitsMetric = metrics.NewCtx(ctx, "boxo_fetcher.cache_hits", "Number of blocks served from the fetcher cache").Counter()
+	c.sharedMetric = metrics.NewCtx(ctx, "boxo_fetcher.cache_shared", "Number of blocks served by waiting for a concurrent fetch").Counter()
+	c.missesMetric = metrics.NewCtx(ctx, "boxo_fetcher.cache_misses", "Number of blocks fetched from the block service").Counter()
+	return c, nil
+}
+
+// Stats returns the statistics of the cache.
+func (c *BlockCache) Stats() BlockCacheStats {
+	return BlockCacheStats{
+		Hits:   c.hits.Load(),
+		Shared: c.shared.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// getBlock returns the block k, from the cache or from the in-flight fetch of
+// another session if any, and using fetch otherwise.
+func (c *BlockCache) getBlock(ctx context.Context, k cid.Cid, fetch func(context.Context, cid.Cid) (blocks.Block, error)) (blocks.Block, error) {
+	key := string(k.Hash())
+	for {
+		c.mu.Lock()
+		if c.recent != nil {
+			if blk, ok := c.recent.Get(key); ok {
+				c.mu.Unlock()
+				c.hits.Add(1)
+				c.hitsMetric.Inc()
+				return blk, nil
+			}
+		}
+
+		if f, ok := c.inflight[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			// The session fetching the block ended before getting it, but
+			// this one did not: fetch the block again.
+			if isContextError(f.err) && ctx.Err() == nil {
+				continue
+			}
+			if f.err == nil {
+				c.shared.Add(1)
+				c.sharedMetric.Inc()
+			}
+			return f.blk, f.err
+		}
+
+		f := &inflightBlock{done: make(chan struct{})}
+		c.inflight[key] = f
+		c.mu.Unlock()
+
+		c.misses.Add(1)
+		c.missesMetric.Inc()
+		f.blk, f.err = fetch(ctx, k)
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if f.err == nil && c.recent != nil {
+			c.recent.Add(key, f.blk)
+		}
+		c.mu.Unlock()
+		close(f.done)
+		return f.blk, f.err
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,132 @@
+package bsfetcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/fetcher"
+	"github.com/ipfs/boxo/fetcher/helpers"
+	"github.com/ipfs/boxo/fetcher/testutil"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime/fluent"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/stretchr/testify/require"
+)
+
+type countingBlockstore struct {
+	blockstore.Blockstore
+	gets atomic.Int64
+}
+
+func (bs *countingBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	bs.gets.Add(1)
+	return bs.Blockstore.Get(ctx, c)
+}
+
+func TestBlockCacheDeduplicatesConcurrentRequests(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewBlockCache(ctx, 0)
+	require.NoError(t, err)
+
+	blk := blocks.NewBlock([]byte("block"))
+	release := make(chan struct{})
+	var fetches atomic.Int64
+	fetch := func(context.Context, cid.Cid) (blocks.Block, error) {
+		fetches.Add(1)
+		<-release
+		return blk, nil
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cache.getBlock(ctx, blk.Cid(), fetch)
+			require.NoError(t, err)
+			require.Equal(t, blk.RawData(), got.RawData())
+		}()
+	}
+	require.Eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return len(cache.inflight) == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.EqualValues(t, 1, fetches.Load())
+	st := cache.Stats()
+	require.EqualValues(t, 1, st.Misses)
+	require.EqualValues(t, n-1, st.Hits+st.Shared)
+}
+
+func TestBlockCacheRetriesCanceledFetch(t *testing.T) {
+	cache, err := NewBlockCache(context.Background(), 0)
+	require.NoError(t, err)
+
+	blk := blocks.NewBlock([]byte("block"))
+	started := make(chan struct{})
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		_, err := cache.getBlock(canceledCtx, blk.Cid(), func(ctx context.Context, _ cid.Cid) (blocks.Block, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		errCh <- err
+	}()
+	<-started
+
+	go cancel()
+	got, err := cache.getBlock(context.Background(), blk.Cid(), func(context.Context, cid.Cid) (blocks.Block, error) {
+		return blk, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, blk.RawData(), got.RawData())
+	require.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func TestFetcherWithBlockCache(t *testing.T) {
+	ctx := context.Background()
+	block2, _, link2 := testutil.EncodeBlock(fluent.MustBuildMap(basicnode.Prototype__Map{}, 1, func(na fluent.MapAssembler) {
+		na.AssembleEntry("two").AssignBool(true)
+	}))
+	block1, _, link1 := testutil.EncodeBlock(fluent.MustBuildMap(basicnode.Prototype__Map{}, 2, func(na fluent.MapAssembler) {
+		na.AssembleEntry("link2").AssignLink(link2)
+		na.AssembleEntry("again").AssignLink(link2)
+	}))
+
+	bs := &countingBlockstore{Blockstore: blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))}
+	require.NoError(t, bs.PutMany(ctx, []blocks.Block{block1, block2}))
+
+	cache, err := NewBlockCache(ctx, 16)
+	require.NoError(t, err)
+	fc := NewFetcherConfig(blockservice.New(bs, nil))
+	fc.BlockCache = cache
+
+	for i := 0; i < 2; i++ {
+		var visited int
+		err = helpers.BlockAll(ctx, fc.NewSession(ctx), link1, func(fetcher.FetchResult) error {
+			visited++
+			return nil
+		})
+		require.NoError(t, err)
+		require.NotZero(t, visited)
+	}
+
+	require.EqualValues(t, 2, bs.gets.Load())
+	st := cache.Stats()
+	require.EqualValues(t, 2, st.Misses)
+	require.EqualValues(t, 4, st.Hits)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/ipfs/boxo/blockservice"
 	"github.com/ipfs/boxo/fetcher"
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
@@ -26,6 +27,10 @@ type FetcherConfig struct {
 	blockService     blockservice.BlockService
 	NodeReifier      ipld.NodeReifier
 	PrototypeChooser traversal.LinkTargetNodePrototypeChooser
+
+	// BlockCache, if set, is shared by the sessions of the fetchers to avoid
+	// requesting the same block several times in parallel.
+	BlockCache *BlockCache
 }
 
 // NewFetcherConfig creates a FetchConfig from which session may be created and nodes retrieved.
@@ -47,7 +52,7 @@ func (fc FetcherConfig) FetcherWithSession(ctx context.Context, s *blockservice.
 	// while we may be loading blocks remotely, they are already hash verified by the time they load
 	// into ipld-prime
 	ls.TrustedStorage = true
-	ls.StorageReadOpener = blockOpener(ctx, s)
+	ls.StorageReadOpener = blockOpener(ctx, s, fc.BlockCache)
 	ls.NodeReifier = fc.NodeReifier
 
 	protoChooser := fc.PrototypeChooser
@@ -61,6 +66,7 @@ func (fc FetcherConfig) WithReifier(nr ipld.NodeReifier) fetcher.Factory {
 		blockService:     fc.blockService,
 		NodeReifier:      nr,
 		PrototypeChooser: fc.PrototypeChooser,
+		BlockCache:       fc.BlockCache,
 	}
 }
 
@@ -131,14 +137,20 @@ var DefaultPrototypeChooser = func(lnk ipld.Link, lnkCtx ipld.LinkContext) (ipld
 	return basicnode.Prototype.Any, nil
 }
 
-func blockOpener(ctx context.Context, bs *blockservice.Session) ipld.BlockReadOpener {
+func blockOpener(ctx context.Context, bs *blockservice.Session, cache *BlockCache) ipld.BlockReadOpener {
 	return func(_ ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
 		cidLink, ok := lnk.(cidlink.Link)
 		if !ok {
 			return nil, fmt.Errorf("invalid link type for loading: %v", lnk)
 		}
 
-		blk, err := bs.GetBlock(ctx, cidLink.Cid)
+		var blk blocks.Block
+		var err error
+		if cache != nil {
+			blk, err = cache.getBlock(ctx, cidLink.Cid, bs.GetBlock)
+		} else {
+			blk, err = bs.GetBlock(ctx, cidLink.Cid)
+		}
 		if err != nil {
 			return nil, err
 		}
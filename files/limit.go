@@ -0,0 +1,189 @@
+package files
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// ErrTooManyEntries is returned by the iterators of a directory from
+	// [LimitDirectory] once it has more entries than allowed.
+	ErrTooManyEntries = errors.New("directory has too many entries")
+
+	// ErrTooLarge is returned by the iterators and files of a directory from
+	// [LimitDirectory] once its files are larger than allowed.
+	ErrTooLarge = errors.New("directory content is too large")
+)
+
+// EntryCounter is implemented by the directories which know their number of
+// entries without iterating over them, like the UnixFS directories.
+type EntryCounter interface {
+	// EntryCount returns the number of entries of the directory, not
+	// including the entries of its sub-directories, or [ErrNotSupported] if
+	// it is not known.
+	EntryCount() (int, error)
+}
+
+// EntryCount returns the number of entries of dir, not including the entries
+// of its sub-directories, if it is known without iterating over them.
+// Otherwise, it returns [ErrNotSupported].
+func EntryCount(dir Directory) (int, error) {
+	if ec, ok := dir.(EntryCounter); ok {
+		return ec.EntryCount()
+	}
+	return 0, ErrNotSupported
+}
+
+// LimitOption configures the limits of [LimitDirectory].
+type LimitOption func(*dirLimits)
+
+// WithMaxEntries limits the number of entries of a directory, including the
+// entries of its sub-directories, to n.
+func WithMaxEntries(n int) LimitOption {
+	return func(l *dirLimits) {
+		l.maxEntries = n
+	}
+}
+
+// WithMaxBytes limits the cumulative size of the files of a directory,
+// including the files of its sub-directories, to n bytes.
+func WithMaxBytes(n int64) LimitOption {
+	return func(l *dirLimits) {
+		l.maxBytes = n
+	}
+}
+
+type dirLimits struct {
+	maxEntries int
+	maxBytes   int64
+
+	entries int
+	bytes   int64
+}
+
+// LimitDirectory returns a [Directory] iterating over dir, and its
+// sub-directories, until it exceeds the given limits. Its iterators then stop
+// with [ErrTooManyEntries] or [ErrTooLarge], and reading its files fails with
+// [ErrTooLarge], so that services can enforce limits while importing, without
+// walking the whole directory first.
+//
+// Limits are checked as early as possible: a directory with an [EntryCounter]
+// fails before its first entry if it has too many entries, and a file is
+// rejected before being read if its size is known. Otherwise, the bytes read
+// from the files are counted.
+//
+// The returned directory, and its sub-directories, must be iterated over
+// sequentially.
+func LimitDirectory(dir Directory, opts ...LimitOption) Directory {
+	l := &dirLimits{}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return &limitedDirectory{Directory: dir, limits: l}
+}
+
+type limitedDirectory struct {
+	Directory
+	limits *dirLimits
+}
+
+func (d *limitedDirectory) Entries() DirIterator {
+	return &limitedIterator{DirIterator: d.Directory.Entries(), dir: d.Directory, limits: d.limits}
+}
+
+func (d *limitedDirectory) EntryCount() (int, error) {
+	return EntryCount(d.Directory)
+}
+
+type limitedIterator struct {
+	DirIterator
+	dir     Directory
+	limits  *dirLimits
+	started bool
+	node    Node
+	err     error
+}
+
+func (it *limitedIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	l := it.limits
+
+	if !it.started {
+		it.started = true
+		if n, err := EntryCount(it.dir); err == nil && l.maxEntries > 0 && l.entries+n > l.maxEntries {
+			it.err = ErrTooManyEntries
+			return false
+		}
+	}
+
+	if !it.DirIterator.Next() {
+		return false
+	}
+	l.entries++
+	if l.maxEntries > 0 && l.entries > l.maxEntries {
+		it.err = ErrTooManyEntries
+		return false
+	}
+
+	switch n := it.DirIterator.Node().(type) {
+	case Directory:
+		it.node = &limitedDirectory{Directory: n, limits: l}
+	case *Symlink:
+		it.node = n
+	case File:
+		if size, err := n.Size(); err == nil && l.maxBytes > 0 && l.bytes+size > l.maxBytes {
+			it.err = ErrTooLarge
+			return false
+		}
+		lf := &limitedFile{File: n, limits: l}
+		if fi, ok := n.(FileInfo); ok {
+			it.node = &limitedFileInfo{limitedFile: lf, fi: fi}
+		} else {
+			it.node = lf
+		}
+	default:
+		it.node = n
+	}
+	return true
+}
+
+func (it *limitedIterator) Node() Node {
+	return it.node
+}
+
+func (it *limitedIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.DirIterator.Err()
+}
+
+type limitedFile struct {
+	File
+	limits *dirLimits
+}
+
+func (f *limitedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.limits.bytes += int64(n)
+	if f.limits.maxBytes > 0 && f.limits.bytes > f.limits.maxBytes {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// limitedFileInfo keeps the [FileInfo] of the limited files.
+type limitedFileInfo struct {
+	*limitedFile
+	fi FileInfo
+}
+
+func (f *limitedFileInfo) AbsPath() string {
+	return f.fi.AbsPath()
+}
+
+func (f *limitedFileInfo) Stat() os.FileInfo {
+	return f.fi.Stat()
+}
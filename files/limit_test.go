@@ -0,0 +1,103 @@
+package files
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingDirectory hides the EntryCounter of a directory.
+type countingDirectory struct {
+	Directory
+}
+
+func TestLimitDirectory(t *testing.T) {
+	newDir := func() Directory {
+		return NewMapDirectory(map[string]Node{
+			"a": NewBytesFile([]byte("1234")),
+			"b": NewMapDirectory(map[string]Node{
+				"c": NewBytesFile([]byte("5678")),
+				"d": NewLinkFile("a", nil),
+			}),
+		})
+	}
+
+	// walk iterates over dir and reads its files, returning the number of
+	// entries and bytes seen.
+	var walk func(dir Directory) (int, int64, error)
+	walk = func(dir Directory) (int, int64, error) {
+		var entries int
+		var bytes int64
+		it := dir.Entries()
+		for it.Next() {
+			entries++
+			switch n := it.Node().(type) {
+			case Directory:
+				e, b, err := walk(n)
+				entries += e
+				bytes += b
+				if err != nil {
+					return entries, bytes, err
+				}
+			case *Symlink:
+			case File:
+				b, err := io.Copy(io.Discard, n)
+				bytes += b
+				if err != nil {
+					return entries, bytes, err
+				}
+			}
+		}
+		return entries, bytes, it.Err()
+	}
+
+	n, err := EntryCount(newDir())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	_, err = EntryCount(countingDirectory{newDir()})
+	require.ErrorIs(t, err, ErrNotSupported)
+
+	t.Run("Within limits", func(t *testing.T) {
+		entries, bytes, err := walk(LimitDirectory(newDir(), WithMaxEntries(4), WithMaxBytes(8)))
+		require.NoError(t, err)
+		require.Equal(t, 4, entries)
+		require.EqualValues(t, 8, bytes)
+	})
+
+	t.Run("Too many entries", func(t *testing.T) {
+		entries, _, err := walk(LimitDirectory(countingDirectory{newDir()}, WithMaxEntries(1)))
+		require.ErrorIs(t, err, ErrTooManyEntries)
+		require.Equal(t, 1, entries)
+
+		// Directories with a known number of entries fail before iterating.
+		entries, _, err = walk(LimitDirectory(newDir(), WithMaxEntries(1)))
+		require.ErrorIs(t, err, ErrTooManyEntries)
+		require.Zero(t, entries)
+		entries, _, err = walk(LimitDirectory(newDir(), WithMaxEntries(3)))
+		require.ErrorIs(t, err, ErrTooManyEntries)
+		require.Equal(t, 2, entries)
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		// Files with a known size fail before being read.
+		entries, bytes, err := walk(LimitDirectory(newDir(), WithMaxBytes(7)))
+		require.ErrorIs(t, err, ErrTooLarge)
+		require.Equal(t, 2, entries)
+		require.EqualValues(t, 4, bytes)
+
+		// Otherwise, reading fails.
+		dir := NewMapDirectory(map[string]Node{
+			"a": NewReaderFile(io.LimitReader(zeroReader{}, 16)),
+		})
+		_, _, err = walk(LimitDirectory(dir, WithMaxBytes(8)))
+		require.ErrorIs(t, err, ErrTooLarge)
+	})
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
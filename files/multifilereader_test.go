@@ -136,6 +136,22 @@ func getTestMultiFileReader(t *testing.T) *MultiFileReader {
 	return NewMultiFileReader(sf, true, false)
 }
 
+func TestMultiPartFileSize(t *testing.T) {
+	_, mfr := makeMultiFileReader(t, false, false)
+	mf, err := NewFileFromPartReader(multipart.NewReader(mfr, mfr.Boundary()), multipartFormdataType)
+	require.NoError(t, err)
+
+	// The size of a part is unknown until it is read.
+	it := mf.Entries()
+	require.True(t, it.Next())
+	require.Equal(t, "beep.txt", it.Name())
+	f := ToFile(it.Node())
+	require.NotNil(t, f)
+	_, err = f.Size()
+	require.ErrorIs(t, err, ErrNotSupported)
+	require.Equal(t, int64(-1), f.(FileInfo).Stat().Size())
+}
+
 func TestMultiFileReaderToMultiFileSkip(t *testing.T) {
 	mfr := getTestMultiFileReader(t)
 	mpReader := multipart.NewReader(mfr, mfr.Boundary())
@@ -38,7 +38,7 @@ func (fi *multiPartFileInfo) Mode() os.FileMode  { return fi.mode }
 func (fi *multiPartFileInfo) ModTime() time.Time { return fi.mtime }
 func (fi *multiPartFileInfo) IsDir() bool        { return fi.mode.IsDir() }
 func (fi *multiPartFileInfo) Sys() interface{}   { return nil }
-func (fi *multiPartFileInfo) Size() int64        { panic("size for multipart file info is not supported") }
+func (fi *multiPartFileInfo) Size() int64        { return -1 } // unknown until the part is read
 
 type multipartDirectory struct {
 	path   string
@@ -152,6 +152,7 @@ func (w *multipartWalker) nextFile() (Node, error) {
 			reader:  part,
 			abspath: absPath,
 			stat:    fileInfo(name, part),
+			fsize:   -1,
 		}, nil
 	}
 }
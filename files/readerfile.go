@@ -89,7 +89,7 @@ func (f *ReaderFile) Stat() os.FileInfo {
 }
 
 func (f *ReaderFile) Size() (int64, error) {
-	if f.stat == nil {
+	if f.stat == nil || f.stat.Size() < 0 {
 		if f.fsize >= 0 {
 			return f.fsize, nil
 		}
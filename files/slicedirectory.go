@@ -113,6 +113,11 @@ func (f *SliceFile) Length() int {
 	return len(f.files)
 }
 
+// EntryCount implements [EntryCounter].
+func (f *SliceFile) EntryCount() (int, error) {
+	return len(f.files), nil
+}
+
 func (f *SliceFile) Size() (int64, error) {
 	var size int64
 
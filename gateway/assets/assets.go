@@ -119,6 +119,14 @@ type DirectoryTemplateData struct {
 	Breadcrumbs []Breadcrumb
 	BackLink    string
 	Hash        string
+
+	// PrevPageLink and NextPageLink are set when the listing is paginated and
+	// there is a previous, respectively next, page.
+	PrevPageLink string
+	NextPageLink string
+
+	SortByNameLink string
+	SortBySizeLink string
 }
 
 type DirectoryItem struct {
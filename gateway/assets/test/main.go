@@ -74,8 +74,11 @@ var directoryTestData = assets.DirectoryTemplateData{
 		Name: "c",
 		Path: testPath,
 	}},
-	BackLink: testPath + "/..",
-	Hash:     "QmFooBazBar2mzChmMeKY47C43LxUdg1NDJ5MWcKMKxDu7",
+	BackLink:       testPath + "/..",
+	Hash:           "QmFooBazBar2mzChmMeKY47C43LxUdg1NDJ5MWcKMKxDu7",
+	NextPageLink:   "?offset=3",
+	SortByNameLink: "?sort=name",
+	SortBySizeLink: "?sort=size",
 }
 
 var dagTestData = map[string]*assets.DagTemplateData{}
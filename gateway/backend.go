@@ -111,6 +111,9 @@ func newBaseBackend(vs routing.ValueStore, ns namesys.NameSystem) (baseBackend,
 func (bb *baseBackend) ResolveMutable(ctx context.Context, p path.Path) (path.ImmutablePath, time.Duration, time.Time, error) {
 	switch p.Namespace() {
 	case path.IPNSNamespace:
+		if IsOffline(ctx) {
+			return path.ImmutablePath{}, 0, time.Time{}, offlineError(ctx, p)
+		}
 		res, err := namesys.Resolve(ctx, bb.namesys, p)
 		if err != nil {
 			return path.ImmutablePath{}, 0, time.Time{}, err
@@ -138,6 +141,10 @@ func (bb *baseBackend) GetIPNSRecord(ctx context.Context, c cid.Cid) ([]byte, er
 		return nil, NewErrorStatusCode(err, http.StatusBadRequest)
 	}
 
+	if IsOffline(ctx) {
+		return nil, offlineError(ctx, name)
+	}
+
 	return bb.routing.GetValue(ctx, string(name.RoutingKey()))
 }
 
@@ -147,6 +154,9 @@ func (bb *baseBackend) GetDNSLinkRecord(ctx context.Context, hostname string) (p
 		if err != nil {
 			return nil, err
 		}
+		if IsOffline(ctx) {
+			return nil, offlineError(ctx, p)
+		}
 		res, err := bb.namesys.Resolve(ctx, p, namesys.ResolveWithDepth(1))
 		if err == namesys.ErrResolveRecursion {
 			err = nil
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/ipfs/boxo/blockservice"
 	blockstore "github.com/ipfs/boxo/blockstore"
@@ -16,6 +18,7 @@ import (
 	bsfetcher "github.com/ipfs/boxo/fetcher/impl/blockservice"
 	"github.com/ipfs/boxo/files"
 	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
 	ufile "github.com/ipfs/boxo/ipld/unixfs/file"
 	uio "github.com/ipfs/boxo/ipld/unixfs/io"
 	"github.com/ipfs/boxo/path"
@@ -65,6 +68,10 @@ func NewBlocksBackend(blockService blockservice.BlockService, opts ...BackendOpt
 		}
 	}
 
+	// Requests in offline mode must not use the exchange, and the blocks
+	// retrieved for requests with a budget are accounted.
+	blockService = newOfflineBlockService(newBudgetBlockService(blockService))
+
 	// Setup the DAG services, which use the CAR block store.
 	dagService := merkledag.NewDAGService(blockService)
 
@@ -174,7 +181,17 @@ func (bb *BlocksBackend) Get(ctx context.Context, path path.ImmutablePath, range
 		if sz < 0 {
 			return ContentPathMetadata{}, nil, errors.New("directory cumulative DAG size cannot be negative")
 		}
-		return md, NewGetResponseFromDirectoryListing(uint64(sz), dir.EnumLinksAsync(ctx), nil), nil
+		ctx, cancel := context.WithCancel(ctx)
+		var entries <-chan unixfs.LinkResult
+		if IsOrderedDirListing(ctx) {
+			entries = enumLinksInOrder(ctx, dir)
+		} else {
+			entries = dir.EnumLinksAsync(ctx)
+		}
+		return md, NewGetResponseFromDirectoryListing(uint64(sz), entries, func() error {
+			cancel()
+			return nil
+		}), nil
 	}
 	if file, ok := f.(files.File); ok {
 		fileSize, err := f.Size()
@@ -196,6 +213,33 @@ func (bb *BlocksBackend) Get(ctx context.Context, path path.ImmutablePath, range
 	return ContentPathMetadata{}, nil, fmt.Errorf("data was not a valid file or directory: %w", ErrInternalServerError) // TODO: should there be a gateway invalid content type to abstract over the various IPLD error types?
 }
 
+// enumLinksInOrder sends the links of dir on the returned channel, in the
+// order of the directory, until ctx is done. Unlike EnumLinksAsync, which
+// walks the shards of HAMT-sharded directories in parallel, the links are
+// sent in the same order on every call, so that paginated directory listings
+// are consistent.
+func enumLinksInOrder(ctx context.Context, dir uio.Directory) <-chan unixfs.LinkResult {
+	ch := make(chan unixfs.LinkResult)
+	go func() {
+		defer close(ch)
+		err := dir.ForEachLink(ctx, func(l *format.Link) error {
+			select {
+			case ch <- unixfs.LinkResult{Link: l}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			select {
+			case ch <- unixfs.LinkResult{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch
+}
+
 func (bb *BlocksBackend) GetAll(ctx context.Context, path path.ImmutablePath) (ContentPathMetadata, files.Node, error) {
 	md, nd, err := bb.getNode(ctx, path)
 	if err != nil {
@@ -263,12 +307,106 @@ func (bb *BlocksBackend) Head(ctx context.Context, path path.ImmutablePath) (Con
 	return ContentPathMetadata{}, nil, errors.New("unsupported UnixFS file type")
 }
 
+var _ WithDagStats = (*BlocksBackend)(nil)
+
+// DagStats implements [WithDagStats]. The size of the DAG is read from the
+// root block metadata, such as the cumulative size of dag-pb nodes, and the
+// DAG is then walked breadth-first for at most maxBlocks blocks. If the walk
+// does not finish, the number of blocks is extrapolated from the average size
+// of the walked blocks.
+func (bb *BlocksBackend) DagStats(ctx context.Context, p path.ImmutablePath, maxBlocks int) (DagStats, error) {
+	_, nd, err := bb.getNode(ctx, p)
+	if err != nil {
+		return DagStats{}, err
+	}
+
+	metaSize, err := nd.Size()
+	if err != nil {
+		return DagStats{}, err
+	}
+
+	if maxBlocks <= 0 {
+		return DagStats{Size: metaSize}, nil
+	}
+
+	var (
+		blocks    uint64
+		size      uint64
+		visited   = cid.NewSet()
+		queue     = []format.Node{nd}
+		truncated bool
+	)
+	visited.Add(nd.Cid())
+
+walk:
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		blocks++
+		size += uint64(len(cur.RawData()))
+
+		for _, l := range cur.Links() {
+			if !visited.Visit(l.Cid) {
+				continue
+			}
+			if visited.Len() > maxBlocks {
+				truncated = true
+				break walk
+			}
+			child, err := bb.dagService.Get(ctx, l.Cid)
+			if err != nil {
+				return DagStats{}, err
+			}
+			queue = append(queue, child)
+		}
+	}
+
+	if !truncated {
+		return DagStats{Size: size, Blocks: blocks, Complete: true}, nil
+	}
+
+	// Count the blocks fetched, but not yet processed, too.
+	for _, n := range queue {
+		blocks++
+		size += uint64(len(n.RawData()))
+	}
+
+	stats := DagStats{Size: metaSize, Blocks: blocks}
+	if size > stats.Size {
+		stats.Size = size
+	} else if size > 0 {
+		stats.Blocks = blocks * stats.Size / size
+	}
+	return stats, nil
+}
+
 // emptyRoot is a CAR root with the empty identity CID. CAR files are recommended
 // to always include a CID in their root, even if it's just the empty CID.
 // https://ipld.io/specs/transport/car/carv1/#number-of-roots
 var emptyRoot = []cid.Cid{cid.MustParse("bafkqaaa")}
 
 func (bb *BlocksBackend) GetCAR(ctx context.Context, p path.ImmutablePath, params CarParams) (ContentPathMetadata, io.ReadCloser, error) {
+	return bb.getCAR(ctx, p, params, nil)
+}
+
+var _ WithPartialCAR = (*BlocksBackend)(nil)
+
+// GetPartialCAR implements [WithPartialCAR]. The blocks that are not found
+// are skipped. When a block of the requested byte range of a file is missing,
+// the CAR ends with the blocks read before it.
+func (bb *BlocksBackend) GetPartialCAR(ctx context.Context, p path.ImmutablePath, params CarParams) (ContentPathMetadata, PartialCAR, error) {
+	pc := &partialCAR{}
+	md, rc, err := bb.getCAR(ctx, p, params, pc)
+	if err != nil {
+		return md, nil, err
+	}
+	pc.ReadCloser = rc
+	return md, pc, nil
+}
+
+// getCAR returns the CAR of p. If pc is not nil, the missing blocks are
+// skipped and added to it.
+func (bb *BlocksBackend) getCAR(ctx context.Context, p path.ImmutablePath, params CarParams, pc *partialCAR) (ContentPathMetadata, io.ReadCloser, error) {
 	pathMetadata, resolveErr := bb.ResolvePath(ctx, p)
 	if resolveErr != nil {
 		rootCid, err := cid.Decode(strings.Split(p.String(), "/")[2])
@@ -339,6 +477,9 @@ func (bb *BlocksBackend) GetCAR(ctx context.Context, p path.ImmutablePath, param
 		lsys := cidlink.DefaultLinkSystem()
 		unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
 		lsys.StorageReadOpener = blockOpener(ctx, blockGetter)
+		if pc != nil {
+			lsys.StorageReadOpener = pc.skipMissing(lsys.StorageReadOpener)
+		}
 
 		// First resolve the path since we always need to.
 		lastCid, remainder, err := pathResolver.ResolveToLastNode(ctx, p)
@@ -351,6 +492,11 @@ func (bb *BlocksBackend) GetCAR(ctx context.Context, p path.ImmutablePath, param
 		// TODO: support selectors passed as request param: https://github.com/ipfs/kubo/issues/8769
 		// TODO: this is very slow if blocks are remote due to linear traversal. Do we need deterministic traversals here?
 		carWriteErr := walkGatewaySimpleSelector(ctx, lastCid, nil, remainder, params, &lsys)
+		if carWriteErr != nil && pc != nil && ctx.Err() == nil && pc.skipped(carWriteErr) {
+			// The walk stopped at a missing block it could not skip, such
+			// as a block of a file range: the CAR ends there.
+			carWriteErr = nil
+		}
 
 		// io.PipeWriter.CloseWithError always returns nil.
 		_ = w.CloseWithError(carWriteErr)
@@ -519,15 +665,18 @@ func walkGatewaySimpleSelector(ctx context.Context, lastCid cid.Cid, terminalBlk
 				to = fileLength + *entityRange.To
 			}
 
+			// Empty ranges only need the root block of the file, which has
+			// already been loaded, and ranges past the end of the file are
+			// clamped to it.
 			numToRead := 1 + to - from
-			if numToRead < 0 {
-				return errors.New("tried to read less than zero bytes")
+			if numToRead <= 0 {
+				return nil
 			}
 
 			if _, err := f.Seek(from, io.SeekStart); err != nil {
 				return err
 			}
-			_, err = io.CopyN(io.Discard, f, numToRead)
+			_, err = io.Copy(io.Discard, io.LimitReader(f, numToRead))
 			return err
 		default:
 			// Not a supported type, so we're done
@@ -804,6 +953,44 @@ func (n *nodeGetterFetcherSingleUseFactory) blankProgress(ctx context.Context) t
 	}
 }
 
+// partialCAR is the [PartialCAR] returned by [BlocksBackend.GetPartialCAR].
+type partialCAR struct {
+	io.ReadCloser
+
+	lk      sync.Mutex
+	missing []cid.Cid
+}
+
+func (pc *partialCAR) MissingBlocks() []cid.Cid {
+	pc.lk.Lock()
+	defer pc.lk.Unlock()
+	return slices.Clone(pc.missing)
+}
+
+// skipMissing wraps opener so that the blocks that are not found are skipped
+// by the traversals, and recorded.
+func (pc *partialCAR) skipMissing(opener ipld.BlockReadOpener) ipld.BlockReadOpener {
+	return func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		r, err := opener(lctx, lnk)
+		if err != nil && isErrNotFound(err) {
+			if cidLink, ok := lnk.(cidlink.Link); ok {
+				pc.lk.Lock()
+				pc.missing = append(pc.missing, cidLink.Cid)
+				pc.lk.Unlock()
+				return nil, traversal.SkipMe{}
+			}
+		}
+		return r, err
+	}
+}
+
+// skipped returns true if err is caused by a block that was skipped.
+func (pc *partialCAR) skipped(err error) bool {
+	pc.lk.Lock()
+	defer pc.lk.Unlock()
+	return len(pc.missing) > 0 && (errors.As(err, &traversal.SkipMe{}) || isErrNotFound(err))
+}
+
 func blockOpener(ctx context.Context, ng format.NodeGetter) ipld.BlockReadOpener {
 	return func(_ ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
 		cidLink, ok := lnk.(cidlink.Link)
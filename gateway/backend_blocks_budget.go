@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"context"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange"
+	"github.com/ipfs/boxo/verifcid"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// budgetBlockService is a [blockservice.BlockService] accounting the blocks
+// it retrieves, from its blockstore or its exchange, to the budget of their
+// request (see [ContextWithRequestBudget]).
+type budgetBlockService struct {
+	blockservice.BlockService
+	blockstore blockstore.Blockstore
+	exchange   exchange.Interface
+}
+
+// newBudgetBlockService wraps bs so that it honors [ContextWithRequestBudget].
+func newBudgetBlockService(bs blockservice.BlockService) blockservice.BlockService {
+	s := &budgetBlockService{
+		BlockService: bs,
+		blockstore:   &budgetBlockstore{Blockstore: bs.Blockstore()},
+	}
+	if ex := bs.Exchange(); ex != nil {
+		s.exchange = &budgetExchange{budgetFetcher: budgetFetcher{ex}, inner: ex}
+	}
+	return s
+}
+
+var _ blockservice.BoundedBlockService = (*budgetBlockService)(nil)
+
+// Blockstore and Exchange are used by the sessions of the block services
+// wrapping s, see [blockservice.NewSession].
+func (s *budgetBlockService) Blockstore() blockstore.Blockstore {
+	return s.blockstore
+}
+
+func (s *budgetBlockService) Exchange() exchange.Interface {
+	return s.exchange
+}
+
+func (s *budgetBlockService) Allowlist() verifcid.Allowlist {
+	if bbs, ok := s.BlockService.(blockservice.BoundedBlockService); ok {
+		return bbs.Allowlist()
+	}
+	return verifcid.DefaultAllowlist
+}
+
+func (s *budgetBlockService) VerificationPolicy() blockservice.VerificationPolicy {
+	if vbs, ok := s.BlockService.(interface {
+		VerificationPolicy() blockservice.VerificationPolicy
+	}); ok {
+		return vbs.VerificationPolicy()
+	}
+	return nil
+}
+
+func (s *budgetBlockService) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := s.BlockService.GetBlock(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err = spendBudget(ctx, blk); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+func (s *budgetBlockService) GetBlocks(ctx context.Context, ks []cid.Cid) <-chan blocks.Block {
+	if !hasRequestBudget(ctx) {
+		return s.BlockService.GetBlocks(ctx, ks)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return spendBudgetBlocks(ctx, cancel, s.BlockService.GetBlocks(ctx, ks))
+}
+
+// budgetBlockstore accounts the blocks read from its blockstore.
+type budgetBlockstore struct {
+	blockstore.Blockstore
+}
+
+func (bs *budgetBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.Blockstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err = spendBudget(ctx, blk); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+// budgetFetcher accounts the blocks fetched by its fetcher.
+type budgetFetcher struct {
+	exchange.Fetcher
+}
+
+func (f budgetFetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := f.Fetcher.GetBlock(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err = spendBudget(ctx, blk); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+func (f budgetFetcher) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	if !hasRequestBudget(ctx) {
+		return f.Fetcher.GetBlocks(ctx, ks)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	in, err := f.Fetcher.GetBlocks(ctx, ks)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return spendBudgetBlocks(ctx, cancel, in), nil
+}
+
+// budgetExchange accounts the blocks fetched by its exchange, and by the
+// sessions of its exchange.
+type budgetExchange struct {
+	budgetFetcher
+	inner exchange.Interface
+}
+
+var _ exchange.SessionExchange = (*budgetExchange)(nil)
+
+func (e *budgetExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	if sesEx, ok := e.inner.(exchange.SessionExchange); ok {
+		return budgetFetcher{sesEx.NewSession(ctx)}
+	}
+	return e.budgetFetcher
+}
+
+func (e *budgetExchange) NotifyNewBlocks(ctx context.Context, blks ...blocks.Block) error {
+	return e.inner.NotifyNewBlocks(ctx, blks...)
+}
+
+func (e *budgetExchange) Close() error {
+	return e.inner.Close()
+}
+
+// spendBudgetBlocks forwards the blocks of in while the budget of the request
+// of ctx is not exhausted, and then cancels the retrieval of the others.
+func spendBudgetBlocks(ctx context.Context, cancel context.CancelFunc, in <-chan blocks.Block) <-chan blocks.Block {
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		defer cancel()
+		for blk := range in {
+			if spendBudget(ctx, blk) != nil {
+				return
+			}
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
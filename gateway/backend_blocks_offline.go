@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/exchange"
+	"github.com/ipfs/boxo/verifcid"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// offlineBlockService is a [blockservice.BlockService] that does not use its
+// exchange for the requests in offline mode (see [ContextWithOffline]), so
+// that they are answered from the blockstore only.
+type offlineBlockService struct {
+	blockservice.BlockService
+	exchange *offlineExchange
+}
+
+// newOfflineBlockService wraps bs so that it honors [ContextWithOffline]. A
+// [blockservice.BlockService] without an exchange is returned as is.
+func newOfflineBlockService(bs blockservice.BlockService) blockservice.BlockService {
+	ex := bs.Exchange()
+	if ex == nil {
+		return bs
+	}
+	return &offlineBlockService{
+		BlockService: bs,
+		exchange:     &offlineExchange{inner: ex},
+	}
+}
+
+var _ blockservice.BoundedBlockService = (*offlineBlockService)(nil)
+
+func (s *offlineBlockService) Exchange() exchange.Interface {
+	return s.exchange
+}
+
+func (s *offlineBlockService) Allowlist() verifcid.Allowlist {
+	if bbs, ok := s.BlockService.(blockservice.BoundedBlockService); ok {
+		return bbs.Allowlist()
+	}
+	return verifcid.DefaultAllowlist
+}
+
+func (s *offlineBlockService) VerificationPolicy() blockservice.VerificationPolicy {
+	if vbs, ok := s.BlockService.(interface {
+		VerificationPolicy() blockservice.VerificationPolicy
+	}); ok {
+		return vbs.VerificationPolicy()
+	}
+	return nil
+}
+
+// hasSession returns whether ctx carries a session of s, see
+// [blockservice.ContextWithSession].
+func (s *offlineBlockService) hasSession(ctx context.Context) bool {
+	return ctx.Value(blockservice.BlockService(s)) != nil
+}
+
+// GetBlock uses a session of s for the requests in offline mode, and for the
+// requests with a session, so that blocks are fetched with the exchange of s.
+func (s *offlineBlockService) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if IsOffline(ctx) || s.hasSession(ctx) {
+		return blockservice.NewSession(ctx, s).GetBlock(ctx, c)
+	}
+	return s.BlockService.GetBlock(ctx, c)
+}
+
+func (s *offlineBlockService) GetBlocks(ctx context.Context, ks []cid.Cid) <-chan blocks.Block {
+	if IsOffline(ctx) || s.hasSession(ctx) {
+		return blockservice.NewSession(ctx, s).GetBlocks(ctx, ks)
+	}
+	return s.BlockService.GetBlocks(ctx, ks)
+}
+
+// offlineExchange returns [ErrOffline] instead of fetching blocks for the
+// requests in offline mode.
+type offlineExchange struct {
+	inner exchange.Interface
+}
+
+var _ exchange.SessionExchange = (*offlineExchange)(nil)
+
+func (e *offlineExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if IsOffline(ctx) {
+		return nil, offlineError(ctx, c)
+	}
+	return e.inner.GetBlock(ctx, c)
+}
+
+func (e *offlineExchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	if IsOffline(ctx) {
+		return nil, offlineError(ctx, fmt.Sprintf("%d blocks", len(ks)))
+	}
+	return e.inner.GetBlocks(ctx, ks)
+}
+
+func (e *offlineExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	if IsOffline(ctx) {
+		return e
+	}
+	if sesEx, ok := e.inner.(exchange.SessionExchange); ok {
+		return sesEx.NewSession(ctx)
+	}
+	return e.inner
+}
+
+func (e *offlineExchange) NotifyNewBlocks(ctx context.Context, blks ...blocks.Block) error {
+	return e.inner.NotifyNewBlocks(ctx, blks...)
+}
+
+func (e *offlineExchange) Close() error {
+	return e.inner.Close()
+}
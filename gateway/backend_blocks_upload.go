@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	h "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+var _ WithUploads = (*BlocksBackend)(nil)
+
+// PutBlocks implements [WithUploads].
+func (bb *BlocksBackend) PutBlocks(ctx context.Context, blks []blocks.Block) error {
+	for _, blk := range blks {
+		if err := CheckUpload(ctx, blk.Cid()); err != nil {
+			return err
+		}
+	}
+	return bb.blockService.AddBlocks(ctx, blks)
+}
+
+// AddUnixFS implements [WithUploads]. Files are chunked with the default
+// splitter into a balanced DAG with raw leaves, and all the nodes use CIDv1.
+func (bb *BlocksBackend) AddUnixFS(ctx context.Context, node files.Node) (cid.Cid, error) {
+	ds := &uploadDAGService{DAGService: bb.dagService, ctx: ctx}
+	nd, err := addUnixFSNode(ctx, ds, node)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+// uploadDAGService calls [CheckUpload] with the context of the upload before
+// storing each node, as the UnixFS importer adds them with other contexts.
+type uploadDAGService struct {
+	format.DAGService
+	ctx context.Context
+}
+
+func (ds *uploadDAGService) Add(ctx context.Context, nd format.Node) error {
+	if err := CheckUpload(ds.ctx, nd.Cid()); err != nil {
+		return err
+	}
+	return ds.DAGService.Add(ctx, nd)
+}
+
+func (ds *uploadDAGService) AddMany(ctx context.Context, nds []format.Node) error {
+	for _, nd := range nds {
+		if err := CheckUpload(ds.ctx, nd.Cid()); err != nil {
+			return err
+		}
+	}
+	return ds.DAGService.AddMany(ctx, nds)
+}
+
+func addUnixFSNode(ctx context.Context, ds format.DAGService, node files.Node) (format.Node, error) {
+	switch n := node.(type) {
+	case *files.Symlink:
+		data, err := ft.SymlinkData(n.Target)
+		if err != nil {
+			return nil, err
+		}
+		nd := merkledag.NodeWithData(data)
+		if err := nd.SetCidBuilder(merkledag.V1CidPrefix()); err != nil {
+			return nil, err
+		}
+		if err := ds.Add(ctx, nd); err != nil {
+			return nil, err
+		}
+		return nd, nil
+	case files.File:
+		params := h.DagBuilderParams{
+			Dagserv:    ds,
+			Maxlinks:   h.DefaultLinksPerBlock,
+			RawLeaves:  true,
+			CidBuilder: merkledag.V1CidPrefix(),
+		}
+		db, err := params.New(chunker.DefaultSplitter(n))
+		if err != nil {
+			return nil, err
+		}
+		return balanced.Layout(db)
+	case files.Directory:
+		dir := uio.NewDirectory(ds)
+		dir.SetCidBuilder(merkledag.V1CidPrefix())
+		it := n.Entries()
+		for it.Next() {
+			child, err := addUnixFSNode(ctx, ds, it.Node())
+			if err != nil {
+				return nil, err
+			}
+			if err := dir.AddChild(ctx, it.Name(), child); err != nil {
+				return nil, err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		nd, err := dir.GetNode()
+		if err != nil {
+			return nil, err
+		}
+		if err := ds.Add(ctx, nd); err != nil {
+			return nil, err
+		}
+		return nd, nil
+	default:
+		return nil, fmt.Errorf("unsupported node type %T", node)
+	}
+}
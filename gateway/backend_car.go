@@ -1080,7 +1080,7 @@ func checkRetryableError(e *error, fn func() error) error {
 }
 
 func isRetryableError(err error) (bool, error) {
-	if errors.Is(err, ErrFetcherUnexpectedEOF) {
+	if errors.Is(err, ErrFetcherUnexpectedEOF) || errors.Is(err, ErrOffline) {
 		return false, err
 	}
 
@@ -1127,7 +1127,8 @@ func isRetryableError(err error) (bool, error) {
 // it also makes sure Retry-After hint from remote blockstore will be passed to HTTP client, if present.
 func blockstoreErrToGatewayErr(err error) error {
 	if errors.Is(err, &ErrorStatusCode{}) ||
-		errors.Is(err, &ErrorRetryAfter{}) {
+		errors.Is(err, &ErrorRetryAfter{}) ||
+		errors.Is(err, ErrOffline) {
 		// already correct error
 		return err
 	}
@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/path"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+)
+
+// maxCarSectionSize is the maximum size of the sections of the CARs verified
+// by a caching [CarFetcher].
+const maxCarSectionSize = 8 << 20
+
+type cachingCarFetcher struct {
+	inner CarFetcher
+	cache blockstore.Blockstore
+}
+
+// NewCachingCarFetcher returns a [CarFetcher] that verifies the blocks of the
+// CARs fetched by inner as they stream, and stores them in cache, for example a
+// [NewCacheBlockStore]. The data of a block is only passed to the
+// [DataCallback] once verified, so a block that does not match its CID ends
+// the stream with an [ErrInvalidResponse] before any of its data is read.
+//
+// Requests for a single block (see [DagScopeBlock]) of a CID without a path
+// remainder are served from the cache when possible.
+func NewCachingCarFetcher(inner CarFetcher, cache blockstore.Blockstore) CarFetcher {
+	return &cachingCarFetcher{
+		inner: inner,
+		cache: cache,
+	}
+}
+
+func (f *cachingCarFetcher) Fetch(ctx context.Context, p path.ImmutablePath, params CarParams, cb DataCallback) error {
+	if params.Scope == DagScopeBlock && len(p.Segments()) == 2 {
+		if blk, err := f.cache.Get(ctx, p.RootCid()); err == nil {
+			car, err := singleBlockCar(blk)
+			if err != nil {
+				return err
+			}
+			return cb(p, car)
+		}
+	}
+
+	return f.inner.Fetch(ctx, p, params, func(p path.ImmutablePath, reader io.Reader) error {
+		return cb(p, &verifyingCarReader{
+			ctx:   ctx,
+			r:     bufio.NewReader(reader),
+			cache: f.cache,
+		})
+	})
+}
+
+// singleBlockCar returns a CAR holding only blk.
+func singleBlockCar(blk blocks.Block) (io.Reader, error) {
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{blk.Cid()}, Version: 1}, &buf); err != nil {
+		return nil, err
+	}
+	if err := util.LdWrite(&buf, blk.Cid().Bytes(), blk.RawData()); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// verifyingCarReader passes a CAR through, one section at a time, after
+// checking that the block of the section matches its CID, and storing it in
+// the cache.
+type verifyingCarReader struct {
+	ctx   context.Context
+	r     *bufio.Reader
+	cache blockstore.Blockstore
+
+	readHeader bool
+	pending    []byte
+	err        error
+}
+
+func (v *verifyingCarReader) Read(p []byte) (int, error) {
+	for len(v.pending) == 0 {
+		if v.err != nil {
+			return 0, v.err
+		}
+		v.pending, v.err = v.next()
+	}
+	n := copy(p, v.pending)
+	v.pending = v.pending[n:]
+	return n, nil
+}
+
+// next returns the next section of the CAR, starting with the header.
+func (v *verifyingCarReader) next() ([]byte, error) {
+	size, err := binary.ReadUvarint(v.r)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 && v.readHeader {
+		// Some CARs are padded with zeros.
+		return nil, io.EOF
+	}
+	if size > maxCarSectionSize {
+		return nil, ErrInvalidResponse{Message: fmt.Sprintf("car section of %d bytes exceeds the maximum of %d bytes", size, maxCarSectionSize)}
+	}
+
+	section := binary.AppendUvarint(nil, size)
+	prefix := len(section)
+	section = append(section, make([]byte, size)...)
+	if _, err := io.ReadFull(v.r, section[prefix:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if !v.readHeader {
+		v.readHeader = true
+		return section, nil
+	}
+
+	data := section[prefix:]
+	n, c, err := cid.CidFromBytes(data)
+	if err != nil {
+		return nil, ErrInvalidResponse{Message: fmt.Sprintf("invalid cid in car section: %s", err)}
+	}
+	data = data[n:]
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, ErrInvalidResponse{Message: fmt.Sprintf("could not hash block %s: %s", c, err)}
+	}
+	if !sum.Equals(c) {
+		return nil, ErrInvalidResponse{Message: fmt.Sprintf("block %s does not match its cid", c)}
+	}
+
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.cache.Put(v.ctx, blk); err != nil {
+		log.Debugw("could not cache block", "cid", c, "error", err)
+	}
+	return section, nil
+}
@@ -1,6 +1,8 @@
 package gateway
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -8,8 +10,11 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/boxo/path"
@@ -24,67 +29,272 @@ type CarFetcher interface {
 
 type remoteCarFetcher struct {
 	httpClient *http.Client
-	gatewayURL []string
-	rand       *rand.Rand
+	upstreams  []*carUpstream
+
+	race      int
+	raceDelay time.Duration
+
+	randLk sync.Mutex
+	rand   *rand.Rand
+}
+
+// carUpstream is a gateway of a [remoteCarFetcher].
+type carUpstream struct {
+	url string
+	// failures is the number of consecutive failed requests to the gateway.
+	failures atomic.Int64
+}
+
+type remoteCarFetcherOptions struct {
+	race      int
+	raceDelay time.Duration
+}
+
+// RemoteCarFetcherOption configures a [CarFetcher] returned by
+// [NewRemoteCarFetcher].
+type RemoteCarFetcherOption func(*remoteCarFetcherOptions) error
+
+// WithUpstreamRacing sends each request to up to n gateways. The first request
+// is sent to the gateway with the fewest recent failures, and the next one
+// is sent after delay if no gateway responded yet, or as soon as a request
+// fails. The first gateway to start sending a CAR wins, the other requests are
+// cancelled. A delay of zero sends all requests at once.
+func WithUpstreamRacing(n int, delay time.Duration) RemoteCarFetcherOption {
+	return func(opts *remoteCarFetcherOptions) error {
+		if n < 1 {
+			return errors.New("number of raced gateways must be at least 1")
+		}
+		opts.race = n
+		opts.raceDelay = delay
+		return nil
+	}
 }
 
 // NewRemoteCarFetcher returns a [CarFetcher] that is backed by one or more gateways
 // that support partial [CAR requests], as described in [IPIP-402]. You can optionally
 // pass your own [http.Client].
 //
+// Gateways whose requests failed recently are tried last. By default, each
+// request is sent to a single gateway, see [WithUpstreamRacing] to send it to
+// several.
+//
 // [CAR requests]: https://www.iana.org/assignments/media-types/application/vnd.ipld.car
 // [IPIP-402]: https://specs.ipfs.tech/ipips/ipip-0402
-func NewRemoteCarFetcher(gatewayURL []string, httpClient *http.Client) (CarFetcher, error) {
+func NewRemoteCarFetcher(gatewayURL []string, httpClient *http.Client, opts ...RemoteCarFetcherOption) (CarFetcher, error) {
 	if len(gatewayURL) == 0 {
 		return nil, errors.New("missing gateway URLs to which to proxy")
 	}
 
+	compiledOptions := remoteCarFetcherOptions{race: 1}
+	for _, o := range opts {
+		if err := o(&compiledOptions); err != nil {
+			return nil, err
+		}
+	}
+
 	if httpClient == nil {
 		httpClient = newRemoteHTTPClient()
 	}
 
+	upstreams := make([]*carUpstream, len(gatewayURL))
+	for i, u := range gatewayURL {
+		upstreams[i] = &carUpstream{url: u}
+	}
+
 	return &remoteCarFetcher{
-		gatewayURL: gatewayURL,
+		upstreams:  upstreams,
 		httpClient: httpClient,
+		race:       min(compiledOptions.race, len(upstreams)),
+		raceDelay:  compiledOptions.raceDelay,
 		rand:       rand.New(rand.NewSource(time.Now().Unix())),
 	}, nil
 }
 
 func (ps *remoteCarFetcher) Fetch(ctx context.Context, path path.ImmutablePath, params CarParams, cb DataCallback) error {
+	if IsOffline(ctx) {
+		return offlineError(ctx, path)
+	}
+
+	resp, up, err := ps.raceUpstreams(ctx, ps.pickUpstreams(), path, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := &failureTrackingReader{r: resp.Body}
+	err = cb(path, body)
+	if body.err != nil {
+		if ctx.Err() == nil {
+			up.failures.Add(1)
+		}
+	} else {
+		up.failures.Store(0)
+	}
+	return err
+}
+
+// pickUpstreams returns the gateways to send a request to, the ones with the
+// fewest recent failures first, in random order otherwise.
+func (ps *remoteCarFetcher) pickUpstreams() []*carUpstream {
+	ups := slices.Clone(ps.upstreams)
+	ps.randLk.Lock()
+	ps.rand.Shuffle(len(ups), func(i, j int) { ups[i], ups[j] = ups[j], ups[i] })
+	ps.randLk.Unlock()
+
+	failures := make(map[*carUpstream]int64, len(ups))
+	for _, up := range ups {
+		failures[up] = up.failures.Load()
+	}
+	slices.SortStableFunc(ups, func(a, b *carUpstream) int {
+		return cmp.Compare(failures[a], failures[b])
+	})
+	return ups[:ps.race]
+}
+
+// raceUpstreams sends the request to the given gateways, see
+// [WithUpstreamRacing], and returns the response of the first one that starts
+// sending a CAR.
+func (ps *remoteCarFetcher) raceUpstreams(ctx context.Context, ups []*carUpstream, path path.ImmutablePath, params CarParams) (*http.Response, *carUpstream, error) {
+	type result struct {
+		i    int
+		resp *http.Response
+		err  error
+	}
+
+	results := make(chan result, len(ups))
+	cancels := make([]context.CancelFunc, 0, len(ups))
+	start := func() {
+		i := len(cancels)
+		reqCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := ps.fetchFrom(reqCtx, ups[i], path, params)
+			results <- result{i, resp, err}
+		}()
+	}
+	// abandon cancels the requests that are still pending, and closes their
+	// responses in the background.
+	abandon := func(pending int, except int) {
+		for i, cancel := range cancels {
+			if i != except {
+				cancel()
+			}
+		}
+		go func() {
+			for ; pending > 0; pending-- {
+				if r := <-results; r.resp != nil {
+					r.resp.Body.Close()
+				}
+			}
+		}()
+	}
+
+	timer := time.NewTimer(ps.raceDelay)
+	defer timer.Stop()
+
+	start()
+	pending := 1
+	var errs []error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				abandon(pending, r.i)
+				r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancels[r.i]}
+				return r.resp, ups[r.i], nil
+			}
+			if ctx.Err() == nil {
+				ups[r.i].failures.Add(1)
+			}
+			errs = append(errs, r.err)
+			if len(cancels) < len(ups) && ctx.Err() == nil {
+				start()
+				pending++
+				timer.Reset(ps.raceDelay)
+			}
+		case <-timer.C:
+			if len(cancels) < len(ups) {
+				start()
+				pending++
+				timer.Reset(ps.raceDelay)
+			}
+		case <-ctx.Done():
+			abandon(pending, -1)
+			return nil, nil, ctx.Err()
+		}
+	}
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return nil, nil, errors.Join(errs...)
+}
+
+// fetchFrom sends the request to a gateway, and returns its response once the
+// first byte of the CAR is received.
+func (ps *remoteCarFetcher) fetchFrom(ctx context.Context, up *carUpstream, path path.ImmutablePath, params CarParams) (*http.Response, error) {
 	url := contentPathToCarUrl(path, params)
 
-	urlStr := fmt.Sprintf("%s%s", ps.getRandomGatewayURL(), url.String())
+	urlStr := fmt.Sprintf("%s%s", up.url, url.String())
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Debugw("car fetch", "url", req.URL)
 	req.Header.Set("Accept", "application/vnd.ipld.car;order=dfs;dups=y")
 	resp, err := ps.httpClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		errData, err := io.ReadAll(resp.Body)
 		if err != nil {
 			err = fmt.Errorf("could not read error message: %w", err)
 		} else {
 			err = fmt.Errorf("%q", string(errData))
 		}
-		return fmt.Errorf("http error from car gateway: %s: %w", resp.Status, err)
+		return nil, fmt.Errorf("http error from car gateway: %s: %w", resp.Status, err)
 	}
 
-	err = cb(path, resp.Body)
-	if err != nil {
+	br := bufio.NewReader(resp.Body)
+	if _, err := br.Peek(1); err != nil {
 		resp.Body.Close()
-		return err
+		return nil, fmt.Errorf("could not read car from gateway: %w", err)
 	}
-	return resp.Body.Close()
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, resp.Body}
+	return resp, nil
+}
+
+// cancelOnClose cancels the context of a request when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
 }
 
-func (ps *remoteCarFetcher) getRandomGatewayURL() string {
-	return ps.gatewayURL[ps.rand.Intn(len(ps.gatewayURL))]
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// failureTrackingReader records the first error, other than io.EOF, of the
+// reader.
+type failureTrackingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failureTrackingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err != nil && err != io.EOF && f.err == nil {
+		f.err = err
+	}
+	return n, err
 }
 
 // contentPathToCarUrl returns an URL that allows retrieval of specified resource
@@ -143,8 +353,8 @@ func (r *retryCarFetcher) Fetch(ctx context.Context, path path.ImmutablePath, pa
 
 func (r *retryCarFetcher) fetch(ctx context.Context, path path.ImmutablePath, params CarParams, cb DataCallback, retriesLeft int) error {
 	err := r.inner.Fetch(ctx, path, params, cb)
-	if err == nil {
-		return nil
+	if err == nil || errors.Is(err, ErrOffline) {
+		return err
 	}
 
 	if retriesLeft > 0 {
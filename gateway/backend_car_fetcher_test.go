@@ -1,8 +1,20 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 
 	"github.com/ipfs/boxo/path"
@@ -58,3 +70,155 @@ func TestContentPathToCarUrl(t *testing.T) {
 		})
 	}
 }
+
+func carFetcherTestPath(t *testing.T, c cid.Cid) path.ImmutablePath {
+	p, err := path.NewImmutablePath(path.FromCid(c))
+	require.NoError(t, err)
+	return p
+}
+
+func TestRemoteCarFetcherRacing(t *testing.T) {
+	blk := blocks.NewBlock([]byte("racing"))
+	carData, err := singleBlockCar(blk)
+	require.NoError(t, err)
+	carBytes, err := io.ReadAll(carData)
+	require.NoError(t, err)
+
+	var fastRequests, failingRequests atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastRequests.Add(1)
+		w.Write(carBytes)
+	}))
+	defer fast.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingRequests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	fetch := func(t *testing.T, f CarFetcher) {
+		err := f.Fetch(context.Background(), carFetcherTestPath(t, blk.Cid()), CarParams{Scope: DagScopeBlock}, func(_ path.ImmutablePath, reader io.Reader) error {
+			data, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, carBytes, data)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("First response wins", func(t *testing.T) {
+		f, err := NewRemoteCarFetcher([]string{slow.URL, fast.URL}, nil, WithUpstreamRacing(2, 0))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fetch(t, f)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.Fatal("racing fetch did not complete")
+		}
+	})
+
+	t.Run("Failures start the next request", func(t *testing.T) {
+		fastRequests.Store(0)
+		f, err := NewRemoteCarFetcher([]string{failing.URL, fast.URL}, nil, WithUpstreamRacing(2, time.Hour))
+		require.NoError(t, err)
+
+		// The failing gateway is tried last once it failed.
+		for i := 0; i < 5; i++ {
+			fetch(t, f)
+		}
+		require.EqualValues(t, 5, fastRequests.Load())
+		require.LessOrEqual(t, failingRequests.Load(), int32(1))
+	})
+
+	t.Run("All gateways fail", func(t *testing.T) {
+		f, err := NewRemoteCarFetcher([]string{failing.URL}, nil)
+		require.NoError(t, err)
+		err = f.Fetch(context.Background(), carFetcherTestPath(t, blk.Cid()), CarParams{}, func(_ path.ImmutablePath, reader io.Reader) error {
+			t.Fatal("unexpected callback")
+			return nil
+		})
+		require.ErrorContains(t, err, "503")
+	})
+}
+
+type carFetcherFunc func(ctx context.Context, path path.ImmutablePath, params CarParams, cb DataCallback) error
+
+func (f carFetcherFunc) Fetch(ctx context.Context, path path.ImmutablePath, params CarParams, cb DataCallback) error {
+	return f(ctx, path, params, cb)
+}
+
+func TestCachingCarFetcher(t *testing.T) {
+	good := blocks.NewBlock([]byte("good"))
+	bad, err := blocks.NewBlockWithCid([]byte("bad"), blocks.NewBlock([]byte("expected")).Cid())
+	require.NoError(t, err)
+
+	carWith := func(blks ...blocks.Block) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{blks[0].Cid()}, Version: 1}, &buf))
+		for _, blk := range blks {
+			require.NoError(t, util.LdWrite(&buf, blk.Cid().Bytes(), blk.RawData()))
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("Verified blocks are cached", func(t *testing.T) {
+		cache, err := NewCacheBlockStore(16, prometheus.NewRegistry())
+		require.NoError(t, err)
+
+		var fetches int
+		carBytes := carWith(good)
+		f := NewCachingCarFetcher(carFetcherFunc(func(ctx context.Context, p path.ImmutablePath, params CarParams, cb DataCallback) error {
+			fetches++
+			return cb(p, bytes.NewReader(carBytes))
+		}), cache)
+
+		for i := 0; i < 2; i++ {
+			err = f.Fetch(context.Background(), carFetcherTestPath(t, good.Cid()), CarParams{Scope: DagScopeBlock}, func(_ path.ImmutablePath, reader io.Reader) error {
+				data, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				require.Equal(t, carBytes, data)
+				return nil
+			})
+			require.NoError(t, err)
+		}
+		// The second request is served from the cache.
+		require.Equal(t, 1, fetches)
+
+		has, err := cache.Has(context.Background(), good.Cid())
+		require.NoError(t, err)
+		require.True(t, has)
+	})
+
+	t.Run("Corrupt blocks stop the stream", func(t *testing.T) {
+		cache, err := NewCacheBlockStore(16, prometheus.NewRegistry())
+		require.NoError(t, err)
+
+		carBytes := carWith(good, bad)
+		f := NewCachingCarFetcher(carFetcherFunc(func(ctx context.Context, p path.ImmutablePath, params CarParams, cb DataCallback) error {
+			return cb(p, bytes.NewReader(carBytes))
+		}), cache)
+
+		err = f.Fetch(context.Background(), carFetcherTestPath(t, good.Cid()), CarParams{}, func(_ path.ImmutablePath, reader io.Reader) error {
+			data, err := io.ReadAll(reader)
+			// The corrupt block is not passed on.
+			require.Equal(t, carWith(good), data)
+			return err
+		})
+		require.ErrorAs(t, err, &ErrInvalidResponse{})
+
+		has, err := cache.Has(context.Background(), bad.Cid())
+		require.NoError(t, err)
+		require.False(t, has)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/boxo/verifcid"
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
@@ -18,7 +19,6 @@ import (
 	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/ipld/go-ipld-prime/linking"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
-	"github.com/multiformats/go-multihash"
 )
 
 type getBlock func(ctx context.Context, cid cid.Cid) (blocks.Block, error)
@@ -65,9 +65,8 @@ func carToLinearBlockGetter(ctx context.Context, reader io.Reader, timeout time.
 			return nil, err
 		}
 
-		isId, bdata := extractIdentityMultihashCIDContents(c)
-		if isId {
-			return blocks.NewBlockWithCid(bdata, c)
+		if blk, ok := blockstore.IdentityBlock(c); ok {
+			return blk, nil
 		}
 
 		// initially set a higher timeout here so that if there's an initial timeout error we get it from the car reader.
@@ -99,28 +98,15 @@ func carToLinearBlockGetter(ctx context.Context, reader io.Reader, timeout time.
 			if !blkRead.block.Cid().Equals(c) {
 				return nil, ErrInvalidResponse{Message: fmt.Sprintf("received block with cid %s, expected %s", blkRead.block.Cid(), c)}
 			}
+			if err := spendBudget(ctx, blkRead.block); err != nil {
+				return nil, err
+			}
 			return blkRead.block, nil
 		}
 		return nil, errNilBlock
 	}, nil
 }
 
-// extractIdentityMultihashCIDContents will check if a given CID has an identity multihash and if so return true and
-// the bytes encoded in the digest, otherwise will return false.
-// Taken from https://github.com/ipfs/boxo/blob/b96767cc0971ca279feb36e7844e527a774309ab/blockstore/idstore.go#L30
-func extractIdentityMultihashCIDContents(k cid.Cid) (bool, []byte) {
-	// Pre-check by calling Prefix(), this much faster than extracting the hash.
-	if k.Prefix().MhType != multihash.IDENTITY {
-		return false, nil
-	}
-
-	dmh, err := multihash.Decode(k.Hash())
-	if err != nil || dmh.Code != multihash.IDENTITY {
-		return false, nil
-	}
-	return true, dmh.Digest
-}
-
 func getCarLinksystem(fn getBlock) *ipld.LinkSystem {
 	lsys := cidlink.DefaultLinkSystem()
 	lsys.StorageReadOpener = func(linkContext linking.LinkContext, link datamodel.Link) (io.Reader, error) {
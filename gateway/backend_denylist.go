@@ -0,0 +1,257 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// denylistBackend refuses the requests for the content blocked by a
+// [Denylist], checking the requested paths, and the CIDs they resolve to.
+type denylistBackend struct {
+	backend  IPFSBackend
+	denylist *Denylist
+}
+
+func newDenylistBackend(backend IPFSBackend, denylist *Denylist) *denylistBackend {
+	return &denylistBackend{backend: backend, denylist: denylist}
+}
+
+// checkMetadata checks the CIDs that a path resolved to.
+func (b *denylistBackend) checkMetadata(md ContentPathMetadata) error {
+	for _, c := range md.PathSegmentRoots {
+		if err := b.denylist.Blocked(path.FromCid(c)); err != nil {
+			return err
+		}
+	}
+	if c := md.LastSegment.RootCid(); c.Defined() {
+		return b.denylist.Blocked(path.FromCid(c))
+	}
+	return nil
+}
+
+func (b *denylistBackend) Get(ctx context.Context, p path.ImmutablePath, ranges ...ByteRange) (ContentPathMetadata, *GetResponse, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, nil, err
+	}
+	md, resp, err := b.backend.Get(ctx, p, ranges...)
+	if err != nil {
+		return md, resp, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		resp.Close()
+		return ContentPathMetadata{}, nil, err
+	}
+	return md, resp, nil
+}
+
+func (b *denylistBackend) GetAll(ctx context.Context, p path.ImmutablePath) (ContentPathMetadata, files.Node, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, nil, err
+	}
+	md, n, err := b.backend.GetAll(ctx, p)
+	if err != nil {
+		return md, n, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		n.Close()
+		return ContentPathMetadata{}, nil, err
+	}
+	return md, n, nil
+}
+
+func (b *denylistBackend) GetBlock(ctx context.Context, p path.ImmutablePath) (ContentPathMetadata, files.File, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, nil, err
+	}
+	md, f, err := b.backend.GetBlock(ctx, p)
+	if err != nil {
+		return md, f, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		f.Close()
+		return ContentPathMetadata{}, nil, err
+	}
+	return md, f, nil
+}
+
+func (b *denylistBackend) Head(ctx context.Context, p path.ImmutablePath) (ContentPathMetadata, *HeadResponse, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, nil, err
+	}
+	md, resp, err := b.backend.Head(ctx, p)
+	if err != nil {
+		return md, resp, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		resp.Close()
+		return ContentPathMetadata{}, nil, err
+	}
+	return md, resp, nil
+}
+
+func (b *denylistBackend) ResolvePath(ctx context.Context, p path.ImmutablePath) (ContentPathMetadata, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, err
+	}
+	md, err := b.backend.ResolvePath(ctx, p)
+	if err != nil {
+		return md, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		return ContentPathMetadata{}, err
+	}
+	return md, nil
+}
+
+func (b *denylistBackend) GetCAR(ctx context.Context, p path.ImmutablePath, params CarParams) (ContentPathMetadata, io.ReadCloser, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, nil, err
+	}
+	md, rc, err := b.backend.GetCAR(ctx, p, params)
+	if err != nil {
+		return md, rc, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		rc.Close()
+		return ContentPathMetadata{}, nil, err
+	}
+	return md, rc, nil
+}
+
+func (b *denylistBackend) IsCached(ctx context.Context, p path.Path) bool {
+	if b.denylist.Blocked(p) != nil {
+		return false
+	}
+	return b.backend.IsCached(ctx, p)
+}
+
+func (b *denylistBackend) GetIPNSRecord(ctx context.Context, c cid.Cid) ([]byte, error) {
+	p, err := path.NewPathFromSegments(path.IPNSNamespace, c.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := b.denylist.Blocked(p); err != nil {
+		return nil, err
+	}
+	return b.backend.GetIPNSRecord(ctx, c)
+}
+
+func (b *denylistBackend) ResolveMutable(ctx context.Context, p path.Path) (path.ImmutablePath, time.Duration, time.Time, error) {
+	if err := b.denylist.Blocked(p); err != nil {
+		return path.ImmutablePath{}, 0, time.Time{}, err
+	}
+	ip, ttl, lastMod, err := b.backend.ResolveMutable(ctx, p)
+	if err != nil {
+		return ip, ttl, lastMod, err
+	}
+	if err := b.denylist.Blocked(ip); err != nil {
+		return path.ImmutablePath{}, 0, time.Time{}, err
+	}
+	return ip, ttl, lastMod, nil
+}
+
+func (b *denylistBackend) GetDNSLinkRecord(ctx context.Context, fqdn string) (path.Path, error) {
+	p, err := path.NewPathFromSegments(path.IPNSNamespace, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.denylist.Blocked(p); err != nil {
+		return nil, err
+	}
+	p, err = b.backend.GetDNSLinkRecord(ctx, fqdn)
+	if err != nil {
+		return p, err
+	}
+	if err := b.denylist.Blocked(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+var _ IPFSBackend = (*denylistBackend)(nil)
+var _ WithContextHint = (*denylistBackend)(nil)
+var _ WithDagStats = (*denylistBackend)(nil)
+var _ WithUploads = (*denylistBackend)(nil)
+var _ WithPartialCAR = (*denylistBackend)(nil)
+
+func (b *denylistBackend) WrapContextForRequest(ctx context.Context) context.Context {
+	if withCtxWrap, ok := b.backend.(WithContextHint); ok {
+		return withCtxWrap.WrapContextForRequest(ctx)
+	}
+	return ctx
+}
+
+func (b *denylistBackend) DagStats(ctx context.Context, p path.ImmutablePath, maxBlocks int) (DagStats, error) {
+	withDagStats, ok := b.backend.(WithDagStats)
+	if !ok {
+		return DagStats{}, errors.ErrUnsupported
+	}
+	if err := b.denylist.Blocked(p); err != nil {
+		return DagStats{}, err
+	}
+	// DagStats has no metadata: the CIDs that a path with segments resolves
+	// to are checked by resolving it first.
+	if len(p.Segments()) > 2 {
+		md, err := b.backend.ResolvePath(ctx, p)
+		if err != nil {
+			return DagStats{}, err
+		}
+		if err := b.checkMetadata(md); err != nil {
+			return DagStats{}, err
+		}
+	}
+	return withDagStats.DagStats(ctx, p, maxBlocks)
+}
+
+func (b *denylistBackend) GetPartialCAR(ctx context.Context, p path.ImmutablePath, params CarParams) (ContentPathMetadata, PartialCAR, error) {
+	withPartialCAR, ok := b.backend.(WithPartialCAR)
+	if !ok {
+		return ContentPathMetadata{}, nil, errors.ErrUnsupported
+	}
+	if err := b.denylist.Blocked(p); err != nil {
+		return ContentPathMetadata{}, nil, err
+	}
+	md, pc, err := withPartialCAR.GetPartialCAR(ctx, p, params)
+	if err != nil {
+		return md, pc, err
+	}
+	if err := b.checkMetadata(md); err != nil {
+		pc.Close()
+		return ContentPathMetadata{}, nil, err
+	}
+	return md, pc, nil
+}
+
+func (b *denylistBackend) PutBlocks(ctx context.Context, blks []blocks.Block) error {
+	withUploads, ok := b.backend.(WithUploads)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	for _, blk := range blks {
+		if err := b.checkUpload(blk.Cid()); err != nil {
+			return err
+		}
+	}
+	return withUploads.PutBlocks(withUploadCheck(ctx, b.checkUpload), blks)
+}
+
+// AddUnixFS refuses the uploads containing blocked blocks before they are
+// stored, through [CheckUpload].
+func (b *denylistBackend) AddUnixFS(ctx context.Context, node files.Node) (cid.Cid, error) {
+	withUploads, ok := b.backend.(WithUploads)
+	if !ok {
+		return cid.Undef, errors.ErrUnsupported
+	}
+	return withUploads.AddUnixFS(withUploadCheck(ctx, b.checkUpload), node)
+}
+
+func (b *denylistBackend) checkUpload(c cid.Cid) error {
+	return b.denylist.Blocked(path.FromCid(c))
+}
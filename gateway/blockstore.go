@@ -174,6 +174,10 @@ func NewRemoteBlockstore(gatewayURL []string, httpClient *http.Client) (blocksto
 }
 
 func (ps *remoteBlockstore) fetch(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if IsOffline(ctx) {
+		return nil, offlineError(ctx, c)
+	}
+
 	urlStr := fmt.Sprintf("%s/ipfs/%s?format=raw", ps.getRandomGatewayURL(), c)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
 	if err != nil {
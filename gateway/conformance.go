@@ -0,0 +1,594 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	h "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	format "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
+)
+
+// Sections of the Trustless Gateway specification tested by
+// [ConformanceCheck].
+const (
+	specBlockResponses = "Block Responses (application/vnd.ipld.raw)"
+	specCARResponses   = "CAR Responses (application/vnd.ipld.car)"
+	specCARParams      = "CAR version, order and dups parameters"
+	specDagScope       = "dag-scope Request Query Parameter"
+	specEntityBytes    = "entity-bytes Request Query Parameter"
+	specHTTPAPI        = "HTTP API"
+)
+
+// ConformanceResult is the result of a test of [ConformanceCheck].
+type ConformanceResult struct {
+	// Name describes the tested behavior, such as "raw block with
+	// ?format=raw".
+	Name string
+	// Spec is the section of the Trustless Gateway specification requiring
+	// the behavior.
+	Spec string
+	// Err is why the test failed, or nil if it passed.
+	Err error
+}
+
+// Passed returns whether the test passed.
+func (r ConformanceResult) Passed() bool {
+	return r.Err == nil
+}
+
+// ConformanceFixture returns the blocks requested by [ConformanceCheck],
+// which must be served by the gateway under test, e.g. by adding them to its
+// blockstore. They are a UnixFS directory holding a file of several raw
+// leaves, and a file whose two leaves are the same block. They are the same
+// on every call.
+func ConformanceFixture() ([]blocks.Block, error) {
+	fx, err := newConformanceFixture()
+	if err != nil {
+		return nil, err
+	}
+	return fx.blocks, nil
+}
+
+// ConformanceCheck runs the tests of the Trustless Gateway specification
+// against the gateway at baseURL, such as "http://127.0.0.1:8080", serving
+// the blocks of [ConformanceFixture]. It returns a result per test, and an
+// error if the tests could not be run.
+//
+// The tests cover the requirements of the specification for /ipfs/ content
+// paths: block and CAR responses, negotiated with the format query parameter
+// or the Accept header, and their headers; the dag-scope and entity-bytes
+// parameters; the order and dups CAR parameters; HEAD requests; and the
+// rejection of invalid requests. IPNS record responses are not tested, as
+// they require a name published to the routing of the gateway.
+//
+// See https://specs.ipfs.tech/http-gateways/trustless-gateway/.
+func ConformanceCheck(ctx context.Context, baseURL string) ([]ConformanceResult, error) {
+	return runConformanceCheck(ctx, http.DefaultClient, baseURL)
+}
+
+// ConformanceCheckHandler is like [ConformanceCheck], but tests the gateway
+// handler h in-process, without listening.
+func ConformanceCheckHandler(ctx context.Context, h http.Handler) ([]ConformanceResult, error) {
+	return runConformanceCheck(ctx, &http.Client{Transport: handlerTransport{h}}, "http://localhost")
+}
+
+// handlerTransport is a [http.RoundTripper] serving the requests with a
+// handler.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, r)
+	res := rec.Result()
+	if r.Method == http.MethodHead {
+		// Like [http.Server], do not send the body written by the handler.
+		res.Body = http.NoBody
+	}
+	res.Request = r
+	return res, nil
+}
+
+// conformanceFixture is the content of [ConformanceFixture].
+type conformanceFixture struct {
+	// dir holds dup.txt and file.txt.
+	dir cid.Cid
+	// file is file.txt, whose leaves are 1 KiB each.
+	file       cid.Cid
+	fileLeaves []cid.Cid
+	// dup is dup.txt, whose two leaves are dupLeaf.
+	dup     cid.Cid
+	dupLeaf cid.Cid
+	// blocks are the blocks of dir, in depth-first order without
+	// duplicates.
+	blocks []blocks.Block
+}
+
+// conformanceChunkSize is the size of the leaves of the fixture.
+const conformanceChunkSize = 1024
+
+func newConformanceFixture() (*conformanceFixture, error) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	dagService := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+
+	addFile := func(content []byte) (format.Node, error) {
+		params := h.DagBuilderParams{
+			Dagserv:    dagService,
+			Maxlinks:   h.DefaultLinksPerBlock,
+			RawLeaves:  true,
+			CidBuilder: merkledag.V1CidPrefix(),
+		}
+		db, err := params.New(chunker.NewSizeSplitter(bytes.NewReader(content), conformanceChunkSize))
+		if err != nil {
+			return nil, err
+		}
+		return balanced.Layout(db)
+	}
+
+	// 128 lines of 32 bytes make 4 leaves of 1 KiB.
+	var content bytes.Buffer
+	for i := 0; i < 128; i++ {
+		fmt.Fprintf(&content, "conformance fixture line %06d\n", i)
+	}
+	file, err := addFile(content.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	dup, err := addFile(bytes.Repeat([]byte("duplicate block\n"), 2*conformanceChunkSize/16))
+	if err != nil {
+		return nil, err
+	}
+
+	dir := ft.EmptyDirNode()
+	if err = dir.SetCidBuilder(merkledag.V1CidPrefix()); err != nil {
+		return nil, err
+	}
+	// The links of UnixFS directories are sorted by name.
+	if err = dir.AddNodeLink("dup.txt", dup); err != nil {
+		return nil, err
+	}
+	if err = dir.AddNodeLink("file.txt", file); err != nil {
+		return nil, err
+	}
+	if err = dagService.Add(ctx, dir); err != nil {
+		return nil, err
+	}
+
+	fx := &conformanceFixture{
+		dir:        dir.Cid(),
+		file:       file.Cid(),
+		fileLeaves: linkCids(file.Links()),
+		dup:        dup.Cid(),
+		dupLeaf:    dup.Links()[0].Cid,
+	}
+	for _, c := range fx.dfs(false) {
+		blk, err := bs.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		fx.blocks = append(fx.blocks, blk)
+	}
+	return fx, nil
+}
+
+// dfs returns the CIDs of the blocks of the directory in depth-first order,
+// with the duplicate leaf of dup.txt if dups is true.
+func (fx *conformanceFixture) dfs(dups bool) []cid.Cid {
+	cids := []cid.Cid{fx.dir, fx.dup, fx.dupLeaf}
+	if dups {
+		cids = append(cids, fx.dupLeaf)
+	}
+	return append(append(cids, fx.file), fx.fileLeaves...)
+}
+
+func linkCids(links []*format.Link) []cid.Cid {
+	cids := make([]cid.Cid, len(links))
+	for i, l := range links {
+		cids[i] = l.Cid
+	}
+	return cids
+}
+
+// conformanceTest is a test of [ConformanceCheck].
+type conformanceTest struct {
+	name  string
+	spec  string
+	check func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error
+}
+
+// conformanceClient sends the requests of the tests to a gateway.
+type conformanceClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// do sends a request to the gateway and reads the response body.
+func (c *conformanceClient) do(ctx context.Context, method, urlPath string, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+urlPath, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
+
+func runConformanceCheck(ctx context.Context, client *http.Client, baseURL string) ([]ConformanceResult, error) {
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid gateway URL: %w", err)
+	}
+	fx, err := newConformanceFixture()
+	if err != nil {
+		return nil, fmt.Errorf("could not build the fixture: %w", err)
+	}
+
+	c := &conformanceClient{client: client, baseURL: strings.TrimSuffix(baseURL, "/")}
+	results := make([]ConformanceResult, 0, len(conformanceTests))
+	for _, test := range conformanceTests {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results = append(results, ConformanceResult{
+			Name: test.name,
+			Spec: test.spec,
+			Err:  test.check(ctx, c, fx),
+		})
+	}
+	return results, nil
+}
+
+var conformanceTests = []conformanceTest{
+	// Block responses
+	{"raw block with ?format=raw", specBlockResponses, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, err := getRawBlock(ctx, c, "/ipfs/"+fx.dir.String()+"?format=raw", nil, fx.dir)
+		return err
+	}},
+	{"raw block with Accept: application/vnd.ipld.raw", specBlockResponses, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, err := getRawBlock(ctx, c, "/ipfs/"+fx.fileLeaves[0].String(), http.Header{"Accept": {rawResponseFormat}}, fx.fileLeaves[0])
+		return err
+	}},
+	{"raw block response headers", specBlockResponses, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, err := getRawBlock(ctx, c, "/ipfs/"+fx.dir.String()+"?format=raw", nil, fx.dir)
+		if err != nil {
+			return err
+		}
+		if etag, expected := res.Header.Get("Etag"), `"`+fx.dir.String()+`.raw"`; etag != expected {
+			return fmt.Errorf("expected Etag %s, got %q", expected, etag)
+		}
+		return checkVerifiableHeaders(res, fx.dir.String()+".bin")
+	}},
+	{"HEAD raw block", specHTTPAPI, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		return checkHead(ctx, c, "/ipfs/"+fx.dir.String()+"?format=raw", rawResponseFormat)
+	}},
+
+	// CAR responses
+	{"CAR with ?format=car", specCARResponses, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car", nil, fx.dir)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, fx.dfs(false), false)
+	}},
+	{"CAR with Accept: application/vnd.ipld.car; version=1", specCARResponses, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String(), http.Header{"Accept": {carResponseFormat + "; version=1"}}, fx.dir)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, fx.dfs(false), false)
+	}},
+	{"CAR response headers", specCARResponses, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, _, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car", nil, fx.dir)
+		if err != nil {
+			return err
+		}
+		if err := checkCARParam(res, "version", "1"); err != nil {
+			return err
+		}
+		if etag := res.Header.Get("Etag"); etag == "" {
+			return errors.New("expected an Etag")
+		}
+		return checkVerifiableHeaders(res, fx.dir.String()+".car")
+	}},
+	{"HEAD CAR", specHTTPAPI, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		return checkHead(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car", carResponseFormat)
+	}},
+
+	// CAR content type parameters
+	{"CAR without duplicates by default", specCARParams, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car", nil, fx.dir)
+		if err != nil {
+			return err
+		}
+		if err := checkCARParam(res, "dups", "n"); err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, fx.dfs(false), false)
+	}},
+	{"CAR in depth-first order with order=dfs", specCARParams, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String(), http.Header{"Accept": {carResponseFormat + "; version=1; order=dfs"}}, fx.dir)
+		if err != nil {
+			return err
+		}
+		if err := checkCARParam(res, "order", "dfs"); err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, fx.dfs(false), true)
+	}},
+	{"CAR with duplicates with dups=y", specCARParams, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String(), http.Header{"Accept": {carResponseFormat + "; version=1; order=dfs; dups=y"}}, fx.dir)
+		if err != nil {
+			return err
+		}
+		if err := checkCARParam(res, "dups", "y"); err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, fx.dfs(true), true)
+	}},
+	{"CAR with ?car-order=dfs&car-dups=y", specCARParams, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car&car-order=dfs&car-dups=y", nil, fx.dir)
+		if err != nil {
+			return err
+		}
+		if err := checkCARParam(res, "order", "dfs"); err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, fx.dfs(true), true)
+	}},
+	{"unsupported CAR version is rejected with 400", specCARParams, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		return checkBadRequest(ctx, c, "/ipfs/"+fx.dir.String(), http.Header{"Accept": {carResponseFormat + "; version=2"}})
+	}},
+
+	// dag-scope
+	{"dag-scope=block of a content path", specDagScope, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		res, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"/file.txt?format=car&dag-scope=block", nil, fx.file)
+		if err != nil {
+			return err
+		}
+		if roots, expected := res.Header.Get("X-Ipfs-Roots"), fx.dir.String()+","+fx.file.String(); roots != expected {
+			return fmt.Errorf("expected X-Ipfs-Roots %s, got %q", expected, roots)
+		}
+		return checkCARBlocks(blks, []cid.Cid{fx.dir, fx.file}, false)
+	}},
+	{"dag-scope=entity of a file", specDagScope, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"/file.txt?format=car&dag-scope=entity", nil, fx.file)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, append([]cid.Cid{fx.dir, fx.file}, fx.fileLeaves...), false)
+	}},
+	{"dag-scope=entity of a directory", specDagScope, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car&dag-scope=entity", nil, fx.dir)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, []cid.Cid{fx.dir}, false)
+	}},
+	{"dag-scope=all of a content path", specDagScope, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, "/ipfs/"+fx.dir.String()+"/dup.txt?format=car&dag-scope=all", nil, fx.dup)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, []cid.Cid{fx.dir, fx.dup, fx.dupLeaf}, false)
+	}},
+	{"invalid dag-scope is rejected with 400", specDagScope, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		return checkBadRequest(ctx, c, "/ipfs/"+fx.dir.String()+"?format=car&dag-scope=invalid", nil)
+	}},
+
+	// entity-bytes
+	{"entity-bytes of the first leaf", specEntityBytes, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, fmt.Sprintf("/ipfs/%s/file.txt?format=car&dag-scope=entity&entity-bytes=0:%d", fx.dir, conformanceChunkSize-1), nil, fx.file)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, []cid.Cid{fx.dir, fx.file, fx.fileLeaves[0]}, false)
+	}},
+	{"entity-bytes of the last leaf, from the end", specEntityBytes, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		_, blks, err := getCAR(ctx, c, fmt.Sprintf("/ipfs/%s/file.txt?format=car&dag-scope=entity&entity-bytes=-%d:*", fx.dir, conformanceChunkSize), nil, fx.file)
+		if err != nil {
+			return err
+		}
+		return checkCARBlocks(blks, []cid.Cid{fx.dir, fx.file, fx.fileLeaves[len(fx.fileLeaves)-1]}, false)
+	}},
+	{"invalid entity-bytes is rejected with 400", specEntityBytes, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		return checkBadRequest(ctx, c, "/ipfs/"+fx.dir.String()+"/file.txt?format=car&entity-bytes=invalid", nil)
+	}},
+
+	// Invalid requests
+	{"invalid CID is rejected with 400", specHTTPAPI, func(ctx context.Context, c *conformanceClient, fx *conformanceFixture) error {
+		return checkBadRequest(ctx, c, "/ipfs/not-a-cid?format=raw", nil)
+	}},
+}
+
+func checkStatus(res *http.Response, expected int) error {
+	if res.StatusCode != expected {
+		return fmt.Errorf("expected status %d, got %d", expected, res.StatusCode)
+	}
+	return nil
+}
+
+func checkBadRequest(ctx context.Context, c *conformanceClient, urlPath string, header http.Header) error {
+	res, _, err := c.do(ctx, http.MethodGet, urlPath, header)
+	if err != nil {
+		return err
+	}
+	return checkStatus(res, http.StatusBadRequest)
+}
+
+// checkVerifiableHeaders checks the headers of the responses of verifiable
+// formats, such as raw blocks and CARs, sent as the file filename.
+func checkVerifiableHeaders(res *http.Response, filename string) error {
+	if cc := res.Header.Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		return fmt.Errorf("expected an immutable Cache-Control, got %q", cc)
+	}
+	if xcto := res.Header.Get("X-Content-Type-Options"); xcto != "nosniff" {
+		return fmt.Errorf("expected X-Content-Type-Options nosniff, got %q", xcto)
+	}
+	cd := res.Header.Get("Content-Disposition")
+	disposition, params, err := mime.ParseMediaType(cd)
+	if err != nil || disposition != "attachment" || params["filename"] != filename {
+		return fmt.Errorf("expected an attachment Content-Disposition with filename %s, got %q", filename, cd)
+	}
+	return nil
+}
+
+func checkMediaType(res *http.Response, expected string) error {
+	ctype := res.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(ctype); err != nil || mediaType != expected {
+		return fmt.Errorf("expected Content-Type %s, got %q", expected, ctype)
+	}
+	return nil
+}
+
+// checkCARParam checks a parameter of the Content-Type of a CAR response.
+func checkCARParam(res *http.Response, name, expected string) error {
+	ctype := res.Header.Get("Content-Type")
+	if _, params, err := mime.ParseMediaType(ctype); err != nil || params[name] != expected {
+		return fmt.Errorf("expected %s=%s in Content-Type, got %q", name, expected, ctype)
+	}
+	return nil
+}
+
+func checkHead(ctx context.Context, c *conformanceClient, urlPath, mediaType string) error {
+	res, body, err := c.do(ctx, http.MethodHead, urlPath, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, http.StatusOK); err != nil {
+		return err
+	}
+	if err := checkMediaType(res, mediaType); err != nil {
+		return err
+	}
+	if len(body) != 0 {
+		return fmt.Errorf("expected no body, got %d bytes", len(body))
+	}
+	return nil
+}
+
+// checkBlock checks that data is the block c.
+func checkBlock(c cid.Cid, data []byte) error {
+	actual, err := c.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !actual.Equals(c) {
+		return fmt.Errorf("block %s does not match its CID", c)
+	}
+	return nil
+}
+
+func getRawBlock(ctx context.Context, c *conformanceClient, urlPath string, header http.Header, expected cid.Cid) (*http.Response, error) {
+	res, body, err := c.do(ctx, http.MethodGet, urlPath, header)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, http.StatusOK); err != nil {
+		return nil, err
+	}
+	if err := checkMediaType(res, rawResponseFormat); err != nil {
+		return nil, err
+	}
+	return res, checkBlock(expected, body)
+}
+
+// getCAR requests a CARv1 whose only root must be root, the CID of the last
+// segment of the content path, and returns the CIDs of its blocks, in order,
+// after checking their data.
+func getCAR(ctx context.Context, c *conformanceClient, urlPath string, header http.Header, root cid.Cid) (*http.Response, []cid.Cid, error) {
+	res, body, err := c.do(ctx, http.MethodGet, urlPath, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkStatus(res, http.StatusOK); err != nil {
+		return nil, nil, err
+	}
+	if err := checkMediaType(res, carResponseFormat); err != nil {
+		return nil, nil, err
+	}
+
+	br, err := carv2.NewBlockReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CAR: %w", err)
+	}
+	if br.Version != 1 {
+		return nil, nil, fmt.Errorf("expected a CARv1, got a CARv%d", br.Version)
+	}
+	if len(br.Roots) != 1 || !br.Roots[0].Equals(root) {
+		return nil, nil, fmt.Errorf("expected the CAR root %s, got %v", root, br.Roots)
+	}
+
+	var cids []cid.Cid
+	for {
+		blk, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CAR: %w", err)
+		}
+		if err := checkBlock(blk.Cid(), blk.RawData()); err != nil {
+			return nil, nil, err
+		}
+		cids = append(cids, blk.Cid())
+	}
+	return res, cids, nil
+}
+
+// checkCARBlocks checks that the blocks of a CAR are the expected ones, in
+// the same order if ordered is true, or without duplicates otherwise.
+func checkCARBlocks(actual, expected []cid.Cid, ordered bool) error {
+	if ordered {
+		if !slices.Equal(actual, expected) {
+			return fmt.Errorf("expected the blocks %v in order, got %v", expected, actual)
+		}
+		return nil
+	}
+
+	received := cid.NewSet()
+	for _, c := range actual {
+		if !received.Visit(c) {
+			return fmt.Errorf("block %s is duplicated in the CAR", c)
+		}
+	}
+	for _, c := range expected {
+		if !received.Has(c) {
+			return fmt.Errorf("block %s is missing from the CAR", c)
+		}
+	}
+	if received.Len() != len(expected) {
+		return fmt.Errorf("expected %d blocks in the CAR, got %d", len(expected), received.Len())
+	}
+	return nil
+}
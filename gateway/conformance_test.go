@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newConformanceTestBackend(t *testing.T) *BlocksBackend {
+	blks, err := ConformanceFixture()
+	require.NoError(t, err)
+	backend, bs, _ := newBlocksTestBackend(t, nil)
+	require.NoError(t, bs.PutMany(context.Background(), blks))
+	return backend
+}
+
+func TestConformanceCheck(t *testing.T) {
+	t.Parallel()
+
+	backend := newConformanceTestBackend(t)
+
+	requirePassed := func(t *testing.T, results []ConformanceResult) {
+		require.Len(t, results, len(conformanceTests))
+		for _, r := range results {
+			require.True(t, r.Passed(), "%s: %v", r.Name, r.Err)
+		}
+	}
+
+	t.Run("Server", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, backend, Config{})
+		results, err := ConformanceCheck(context.Background(), ts.URL)
+		require.NoError(t, err)
+		requirePassed(t, results)
+	})
+
+	t.Run("Handler", func(t *testing.T) {
+		t.Parallel()
+
+		results, err := ConformanceCheckHandler(context.Background(), NewHandler(Config{DeserializedResponses: true}, backend))
+		require.NoError(t, err)
+		requirePassed(t, results)
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		t.Parallel()
+
+		results, err := ConformanceCheckHandler(context.Background(), http.NotFoundHandler())
+		require.NoError(t, err)
+		require.Len(t, results, len(conformanceTests))
+		for _, r := range results {
+			require.False(t, r.Passed(), r.Name)
+		}
+	})
+
+	t.Run("Block order is only checked when requested", func(t *testing.T) {
+		t.Parallel()
+
+		fx, err := newConformanceFixture()
+		require.NoError(t, err)
+		expected := fx.dfs(false)
+		reversed := slices.Clone(expected)
+		slices.Reverse(reversed)
+
+		require.NoError(t, checkCARBlocks(reversed, expected, false))
+		require.Error(t, checkCARBlocks(reversed, expected, true))
+		require.Error(t, checkCARBlocks(append(reversed, expected[0]), expected, false))
+	})
+
+	t.Run("Fixture is deterministic", func(t *testing.T) {
+		t.Parallel()
+
+		a, err := ConformanceFixture()
+		require.NoError(t, err)
+		b, err := ConformanceFixture()
+		require.NoError(t, err)
+		require.Len(t, a, 8)
+		require.Equal(t, a, b)
+	})
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"net/http"
+	gopath "path"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/go-cid"
+)
+
+// ContentTypeOverride forces the Content-Type of UnixFS files that match
+// either Extension or PathPattern.
+type ContentTypeOverride struct {
+	// Extension matches the extension of the file name, including the leading
+	// dot, e.g. ".wasm". It is matched case-insensitively.
+	Extension string
+
+	// PathPattern matches the content path, e.g. "/ipns/example.com/*.js",
+	// using the syntax of [gopath.Match]. Note that "*" does not match "/".
+	PathPattern string
+
+	// ContentType is the value of the Content-Type header for matching files.
+	ContentType string
+}
+
+func (o ContentTypeOverride) matches(contentPath, name string) bool {
+	if o.Extension != "" && strings.EqualFold(gopath.Ext(name), o.Extension) {
+		return true
+	}
+	if o.PathPattern != "" {
+		if ok, _ := gopath.Match(o.PathPattern, contentPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTypeOverride returns the Content-Type forced by the overrides of the
+// [PublicGateway] of the request, or of the [Config], for the given content
+// path and file name.
+func (i *handler) contentTypeOverride(r *http.Request, contentPath, name string) string {
+	var overrides []ContentTypeOverride
+	if gw, ok := i.publicGatewayForRequest(r); ok {
+		overrides = gw.ContentTypeOverrides
+	}
+	for _, list := range [][]ContentTypeOverride{overrides, i.config.ContentTypeOverrides} {
+		for _, o := range list {
+			if o.matches(contentPath, name) {
+				return o.ContentType
+			}
+		}
+	}
+	return ""
+}
+
+// ContentTypeCache stores the Content-Type sniffed from the content of UnixFS
+// files, keyed by the CID of the file. Since CIDs are immutable, entries never
+// need to be invalidated. Implementations must be safe for concurrent use, and
+// may be persistent.
+type ContentTypeCache interface {
+	// Get returns the Content-Type stored for the CID, if any.
+	Get(c cid.Cid) (string, bool)
+
+	// Add stores the Content-Type for the CID.
+	Add(c cid.Cid, contentType string)
+}
+
+// NewContentTypeCache returns an in-memory [ContentTypeCache] that keeps up to
+// size of the most recently used entries.
+func NewContentTypeCache(size int) (ContentTypeCache, error) {
+	c, err := lru.New[cid.Cid, string](size)
+	if err != nil {
+		return nil, err
+	}
+	return &lruContentTypeCache{lru: c}, nil
+}
+
+type lruContentTypeCache struct {
+	lru *lru.Cache[cid.Cid, string]
+}
+
+func (c *lruContentTypeCache) Get(k cid.Cid) (string, bool) {
+	return c.lru.Get(k)
+}
+
+func (c *lruContentTypeCache) Add(k cid.Cid, contentType string) {
+	c.lru.Add(k, contentType)
+}
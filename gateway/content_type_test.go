@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// countingContentTypeCache is a ContentTypeCache that counts its calls.
+type countingContentTypeCache struct {
+	mu    sync.Mutex
+	m     map[cid.Cid]string
+	hits  int
+	added int
+}
+
+func (c *countingContentTypeCache) Get(k cid.Cid) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[k]
+	if ok {
+		c.hits++
+	}
+	return v, ok
+}
+
+func (c *countingContentTypeCache) Add(k cid.Cid, contentType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.added++
+	c.m[k] = contentType
+}
+
+func TestContentTypeOverrides(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "headers-test.car")
+	ts := newTestServerWithConfig(t, backend, Config{
+		DeserializedResponses: true,
+		ContentTypeOverrides: []ContentTypeOverride{
+			{PathPattern: "/ipfs/*/subdir/fnord", ContentType: "application/x-fnord"},
+			{Extension: ".TXT", ContentType: "text/x-custom"},
+		},
+		PublicGateways: map[string]*PublicGateway{
+			"site.example.com": {
+				Paths:                 []string{"/ipfs"},
+				DeserializedResponses: true,
+				ContentTypeOverrides: []ContentTypeOverride{
+					{PathPattern: "/ipfs/*/subdir/fnord", ContentType: "application/x-site-fnord"},
+				},
+			},
+		},
+	})
+
+	get := func(t *testing.T, host, p string) *http.Response {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+p, nil)
+		if host != "" {
+			req.Host = host
+		}
+		res := mustDoWithoutRedirect(t, req)
+		t.Cleanup(func() { res.Body.Close() })
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		return res
+	}
+
+	t.Run("Path pattern", func(t *testing.T) {
+		res := get(t, "", "/ipfs/"+root.String()+"/subdir/fnord")
+		require.Equal(t, "application/x-fnord", res.Header.Get("Content-Type"))
+	})
+
+	t.Run("Extension", func(t *testing.T) {
+		res := get(t, "", "/ipfs/"+root.String()+"/hamt/685.txt")
+		require.Equal(t, "text/x-custom", res.Header.Get("Content-Type"))
+	})
+
+	t.Run("Public gateway overrides take precedence", func(t *testing.T) {
+		res := get(t, "site.example.com", "/ipfs/"+root.String()+"/subdir/fnord")
+		require.Equal(t, "application/x-site-fnord", res.Header.Get("Content-Type"))
+	})
+}
+
+func TestContentTypeCache(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "headers-test.car")
+	cache := &countingContentTypeCache{m: map[cid.Cid]string{}}
+	ts := newTestServerWithConfig(t, backend, Config{
+		DeserializedResponses: true,
+		ContentTypeCache:      cache,
+	})
+
+	get := func(t *testing.T, rangeHeader string) string {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		res := mustDoWithoutRedirect(t, req)
+		defer res.Body.Close()
+		return res.Header.Get("Content-Type")
+	}
+
+	first := get(t, "")
+	require.NotEmpty(t, first)
+	require.Equal(t, 1, cache.added)
+	require.Equal(t, 0, cache.hits)
+
+	// The sniffed type is now returned from the cache, also for range
+	// requests that do not start at the beginning of the file.
+	require.Equal(t, first, get(t, ""))
+	require.Equal(t, first, get(t, "bytes=2-"))
+	require.Equal(t, 1, cache.added)
+	require.Equal(t, 2, cache.hits)
+}
+
+func TestNewContentTypeCache(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewContentTypeCache(1)
+	require.NoError(t, err)
+
+	c1 := cid.MustParse("bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	c2 := cid.MustParse("bafkreiba3vpkcqpc6xtp3hsatzcod6iwneouzjoq7ymy4m2js6gc3czt6i")
+
+	cache.Add(c1, "text/plain")
+	v, ok := cache.Get(c1)
+	require.True(t, ok)
+	require.Equal(t, "text/plain", v)
+
+	cache.Add(c2, "image/png")
+	_, ok = cache.Get(c1)
+	require.False(t, ok)
+}
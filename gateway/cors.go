@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"net/http"
+	"slices"
+)
+
+// CORSPolicy is the CORS configuration of the requests to a mount, such as
+// /ipfs, /ipns or /api, see [Config.CORS] and [PublicGateway.CORS]. The
+// headers of a policy replace the ones set by [Headers.ApplyCors] when they
+// are not empty.
+type CORSPolicy struct {
+	// PathPrefix is the path prefix of the requests the policy applies to,
+	// such as "/ipfs". On [Subdomain Gateways], the prefix of the requests is
+	// the namespace of their subdomain, such as "/ipns" for
+	// http://{name}.ipns.{gateway}/. An empty prefix matches all the requests.
+	//
+	// [Subdomain Gateways]: https://specs.ipfs.tech/http-gateways/subdomain-gateway/
+	PathPrefix string
+
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// or "*" for any origin. The Origin of the allowed requests is returned
+	// in Access-Control-Allow-Origin. Otherwise, the header is removed so
+	// that browsers block the requests.
+	AllowedOrigins []string
+
+	// AllowedMethods are returned in Access-Control-Allow-Methods.
+	AllowedMethods []string
+
+	// AllowedHeaders are returned in Access-Control-Allow-Headers.
+	AllowedHeaders []string
+
+	// ExposedHeaders are returned in Access-Control-Expose-Headers.
+	ExposedHeaders []string
+}
+
+// matches returns true if the policy applies to the requests with the given
+// path.
+func (p *CORSPolicy) matches(path string) bool {
+	return p.PathPrefix == "" || hasPrefix(path, p.PathPrefix)
+}
+
+// corsPolicies selects the [CORSPolicy] of the requests.
+type corsPolicies struct {
+	gateways *hostnameGateways
+	policies []CORSPolicy
+}
+
+// policy returns the first policy matching r, from the policies of its
+// [PublicGateway], then from the global ones, or nil.
+func (cp *corsPolicies) policy(r *http.Request) *CORSPolicy {
+	host := r.Host
+	if xHost := r.Header.Get("X-Forwarded-Host"); xHost != "" {
+		host = xHost
+	}
+
+	path := r.URL.Path
+	var policies []CORSPolicy
+	if gw, ok := cp.gateways.isKnownHostname(host); ok {
+		policies = gw.CORS
+	} else if gw, _, ns, _, ok := cp.gateways.knownSubdomainDetails(host); ok {
+		policies = gw.CORS
+		path = "/" + ns + path
+	}
+
+	for _, policies := range [][]CORSPolicy{policies, cp.policies} {
+		for i := range policies {
+			if policies[i].matches(path) {
+				return &policies[i]
+			}
+		}
+	}
+	return nil
+}
+
+// apply sets the CORS headers of the policy matching r, if any.
+func (cp *corsPolicies) apply(w http.ResponseWriter, r *http.Request) {
+	p := cp.policy(r)
+	if p == nil {
+		return
+	}
+
+	header := w.Header()
+	if len(p.AllowedOrigins) > 0 {
+		origin := r.Header.Get("Origin")
+		switch {
+		case slices.Contains(p.AllowedOrigins, "*"):
+			header.Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && slices.Contains(p.AllowedOrigins, origin):
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		default:
+			header.Del("Access-Control-Allow-Origin")
+			header.Add("Vary", "Origin")
+		}
+	}
+	if len(p.AllowedMethods) > 0 {
+		header["Access-Control-Allow-Methods"] = p.AllowedMethods
+	}
+	if len(p.AllowedHeaders) > 0 {
+		header["Access-Control-Allow-Headers"] = cleanHeaderSet(p.AllowedHeaders)
+	}
+	if len(p.ExposedHeaders) > 0 {
+		header["Access-Control-Expose-Headers"] = cleanHeaderSet(p.ExposedHeaders)
+	}
+}
@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSPolicies(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		PublicGateways: map[string]*PublicGateway{
+			"dweb.link": {
+				UseSubdomains: true,
+				CORS: []CORSPolicy{{
+					PathPrefix:     "/ipns",
+					AllowedOrigins: []string{"https://app.example.com"},
+				}},
+			},
+			"example.com": {
+				Paths: []string{"/ipfs", "/api"},
+			},
+		},
+		CORS: []CORSPolicy{
+			{
+				PathPrefix:     "/api",
+				AllowedOrigins: []string{"https://admin.example.com"},
+				AllowedMethods: []string{http.MethodPost, http.MethodOptions},
+				AllowedHeaders: []string{"Authorization"},
+				ExposedHeaders: []string{"x-custom"},
+			},
+		},
+	}
+	handler := NewHeaders(nil).ApplyCors().ApplyCORSPolicies(config).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(host, path, origin string) http.Header {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header()
+	}
+
+	t.Run("Default policy", func(t *testing.T) {
+		t.Parallel()
+		h := do("example.com", "/ipfs/bafkqaaa", "https://any.example.net")
+		require.Equal(t, "*", h.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, []string{http.MethodGet, http.MethodHead, http.MethodOptions}, h.Values("Access-Control-Allow-Methods"))
+		require.Contains(t, h.Values("Access-Control-Expose-Headers"), "X-Ipfs-Path")
+	})
+
+	t.Run("Global policy of a path", func(t *testing.T) {
+		t.Parallel()
+		h := do("example.com", "/api/v0/id", "https://admin.example.com")
+		require.Equal(t, "https://admin.example.com", h.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "Origin", h.Get("Vary"))
+		require.Equal(t, []string{http.MethodPost, http.MethodOptions}, h.Values("Access-Control-Allow-Methods"))
+		require.Equal(t, []string{"Authorization"}, h.Values("Access-Control-Allow-Headers"))
+		require.Equal(t, []string{"X-Custom"}, h.Values("Access-Control-Expose-Headers"))
+
+		h = do("example.com", "/api/v0/id", "https://evil.example.net")
+		require.Empty(t, h.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Policy of a subdomain gateway", func(t *testing.T) {
+		t.Parallel()
+		h := do("en.wikipedia-on-ipfs.org.ipns.dweb.link", "/", "https://app.example.com")
+		require.Equal(t, "https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+
+		h = do("en.wikipedia-on-ipfs.org.ipns.dweb.link", "/", "https://other.example.com")
+		require.Empty(t, h.Get("Access-Control-Allow-Origin"))
+
+		// The policy only applies to the /ipns namespace.
+		h = do("bafkqaaa.ipfs.dweb.link", "/", "https://other.example.com")
+		require.Equal(t, "*", h.Get("Access-Control-Allow-Origin"))
+	})
+}
@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/routing/http/server"
+	"github.com/ipfs/boxo/routing/http/types"
+	"github.com/ipfs/boxo/routing/http/types/iter"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+type delegatedRoutingOptions struct {
+	contentRouting routing.ContentRouting
+	peerRouting    routing.PeerRouting
+	serverOptions  []server.Option
+}
+
+// DelegatedRoutingOption is an option for [NewDelegatedRoutingHandler].
+type DelegatedRoutingOption func(*delegatedRoutingOptions)
+
+// WithContentRouting sets the [routing.ContentRouting] used to answer provider
+// lookups. If not set, provider lookups are not supported.
+func WithContentRouting(cr routing.ContentRouting) DelegatedRoutingOption {
+	return func(opts *delegatedRoutingOptions) {
+		opts.contentRouting = cr
+	}
+}
+
+// WithPeerRouting sets the [routing.PeerRouting] used to answer peer lookups.
+// If not set, peer lookups are not supported.
+func WithPeerRouting(pr routing.PeerRouting) DelegatedRoutingOption {
+	return func(opts *delegatedRoutingOptions) {
+		opts.peerRouting = pr
+	}
+}
+
+// WithDelegatedRoutingServerOptions passes the given options to the
+// underlying [server.Handler].
+func WithDelegatedRoutingServerOptions(serverOpts ...server.Option) DelegatedRoutingOption {
+	return func(opts *delegatedRoutingOptions) {
+		opts.serverOptions = append(opts.serverOptions, serverOpts...)
+	}
+}
+
+// NewDelegatedRoutingHandler returns an [http.Handler] that serves the read-only
+// subset of the [Delegated Routing V1 HTTP API] under /routing/v1, backed by the
+// same [IPFSBackend] used by the gateway. IPNS records are retrieved with
+// [IPFSBackend.GetIPNSRecord] and verified before being returned. Providers and
+// peers are looked up with [WithContentRouting] and [WithPeerRouting].
+//
+// This allows a single process to act both as a [Trustless Gateway] and as a
+// delegated router by mounting both handlers on the same mux:
+//
+//	mux.Handle("/ipfs/", gwHandler)
+//	mux.Handle("/ipns/", gwHandler)
+//	mux.Handle("/routing/v1/", gateway.NewDelegatedRoutingHandler(backend, gateway.WithContentRouting(cr)))
+//
+// When used with [NewHostnameHandler] and known [PublicGateway]s, "/routing"
+// must be included in [PublicGateway.Paths].
+//
+// [Delegated Routing V1 HTTP API]: https://specs.ipfs.tech/routing/http-routing-v1/
+// [Trustless Gateway]: https://specs.ipfs.tech/http-gateways/trustless-gateway/
+func NewDelegatedRoutingHandler(backend IPFSBackend, opts ...DelegatedRoutingOption) http.Handler {
+	var compiledOptions delegatedRoutingOptions
+	for _, o := range opts {
+		o(&compiledOptions)
+	}
+
+	return server.Handler(&delegatedRouter{
+		backend:        backend,
+		contentRouting: compiledOptions.contentRouting,
+		peerRouting:    compiledOptions.peerRouting,
+	}, compiledOptions.serverOptions...)
+}
+
+// delegatedRouter implements [server.ContentRouter] on top of an [IPFSBackend].
+type delegatedRouter struct {
+	backend        IPFSBackend
+	contentRouting routing.ContentRouting
+	peerRouting    routing.PeerRouting
+}
+
+var _ server.ContentRouter = (*delegatedRouter)(nil)
+
+func (dr *delegatedRouter) FindProviders(ctx context.Context, c cid.Cid, limit int) (iter.ResultIter[types.Record], error) {
+	if dr.contentRouting == nil {
+		return nil, routing.ErrNotSupported
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ch := dr.contentRouting.FindProvidersAsync(ctx, c, limit)
+	return &addrInfoIter{ch: ch, cancel: cancel}, nil
+}
+
+func (dr *delegatedRouter) FindPeers(ctx context.Context, pid peer.ID, limit int) (iter.ResultIter[*types.PeerRecord], error) {
+	if dr.peerRouting == nil {
+		return nil, routing.ErrNotSupported
+	}
+
+	ai, err := dr.peerRouting.FindPeer(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := addrInfoToPeerRecord(ai)
+	return iter.FromSlice([]iter.Result[*types.PeerRecord]{{Val: rec}}), nil
+}
+
+func (dr *delegatedRouter) GetIPNS(ctx context.Context, name ipns.Name) (*ipns.Record, error) {
+	raw, err := dr.backend.GetIPNSRecord(ctx, name.Cid())
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := ipns.UnmarshalRecord(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ipns.ValidateWithName(rec, name); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (dr *delegatedRouter) PutIPNS(ctx context.Context, name ipns.Name, record *ipns.Record) error {
+	return routing.ErrNotSupported
+}
+
+func (dr *delegatedRouter) ProvideBitswap(ctx context.Context, req *server.BitswapWriteProvideRequest) (time.Duration, error) {
+	return 0, routing.ErrNotSupported
+}
+
+func addrInfoToPeerRecord(ai peer.AddrInfo) *types.PeerRecord {
+	addrs := make([]types.Multiaddr, 0, len(ai.Addrs))
+	for _, a := range ai.Addrs {
+		addrs = append(addrs, types.Multiaddr{Multiaddr: a})
+	}
+
+	return &types.PeerRecord{
+		Schema: types.SchemaPeer,
+		ID:     &ai.ID,
+		Addrs:  addrs,
+	}
+}
+
+// addrInfoIter is an [iter.ResultIter] over the results of
+// [routing.ContentRouting.FindProvidersAsync].
+type addrInfoIter struct {
+	ch     <-chan peer.AddrInfo
+	cancel context.CancelFunc
+	val    iter.Result[types.Record]
+}
+
+func (it *addrInfoIter) Next() bool {
+	ai, ok := <-it.ch
+	if !ok {
+		return false
+	}
+	it.val = iter.Result[types.Record]{Val: addrInfoToPeerRecord(ai)}
+	return true
+}
+
+func (it *addrInfoIter) Val() iter.Result[types.Record] {
+	return it.val
+}
+
+func (it *addrInfoIter) Close() error {
+	it.cancel()
+	return nil
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+type ipnsRecordMockBackend struct {
+	*mockBackend
+	records map[cid.Cid][]byte
+}
+
+func (mb *ipnsRecordMockBackend) GetIPNSRecord(ctx context.Context, c cid.Cid) ([]byte, error) {
+	if rec, ok := mb.records[c]; ok {
+		return rec, nil
+	}
+	return nil, routing.ErrNotFound
+}
+
+type mockContentRouting struct {
+	providers map[cid.Cid][]peer.AddrInfo
+}
+
+func (m *mockContentRouting) Provide(context.Context, cid.Cid, bool) error {
+	return routing.ErrNotSupported
+}
+
+func (m *mockContentRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, limit int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo, len(m.providers[c]))
+	for _, ai := range m.providers[c] {
+		ch <- ai
+	}
+	close(ch)
+	return ch
+}
+
+func TestDelegatedRoutingHandler(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+
+	sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	name := ipns.NameFromPeer(pid)
+
+	rec, err := ipns.NewRecord(sk, path.FromCid(root), 1, time.Now().Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	rawRec, err := ipns.MarshalRecord(rec)
+	require.NoError(t, err)
+
+	ma, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	require.NoError(t, err)
+
+	handler := NewDelegatedRoutingHandler(&ipnsRecordMockBackend{
+		mockBackend: backend,
+		records:     map[cid.Cid][]byte{name.Cid(): rawRec},
+	}, WithContentRouting(&mockContentRouting{
+		providers: map[cid.Cid][]peer.AddrInfo{root: {{ID: pid, Addrs: []multiaddr.Multiaddr{ma}}}},
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/ipfs/", NewHandler(Config{}, backend))
+	mux.Handle("/routing/v1/", handler)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	t.Run("GET /routing/v1/ipns/{name}", func(t *testing.T) {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/routing/v1/ipns/"+name.String(), nil)
+		req.Header.Set("Accept", "application/vnd.ipfs.ipns-record")
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, rawRec, body)
+	})
+
+	t.Run("GET /routing/v1/ipns/{name} for unknown name", func(t *testing.T) {
+		otherSk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		otherPid, err := peer.IDFromPrivateKey(otherSk)
+		require.NoError(t, err)
+
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/routing/v1/ipns/"+ipns.NameFromPeer(otherPid).String(), nil)
+		req.Header.Set("Accept", "application/vnd.ipfs.ipns-record")
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("GET /routing/v1/providers/{cid}", func(t *testing.T) {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/routing/v1/providers/"+root.String(), nil)
+		req.Header.Set("Accept", "application/json")
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Providers []struct {
+				Schema string
+				ID     string
+				Addrs  []string
+			}
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		require.Len(t, body.Providers, 1)
+		require.Equal(t, "peer", body.Providers[0].Schema)
+		require.Equal(t, pid.String(), body.Providers[0].ID)
+		require.Equal(t, []string{ma.String()}, body.Providers[0].Addrs)
+	})
+
+	t.Run("Gateway is still served on the same mux", func(t *testing.T) {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=raw", nil)
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
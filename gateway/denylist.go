@@ -0,0 +1,676 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+)
+
+// DefaultDenylistRefreshInterval is the default interval at which the files
+// and URLs of a [Denylist] are checked for changes.
+const DefaultDenylistRefreshInterval = time.Minute
+
+// maxDenylistLineSize is the maximum size of a line of a denylist.
+const maxDenylistLineSize = 1 << 20
+
+// ErrContentBlocked is returned for content that is blocked by a [Denylist].
+// The gateway responds to requests for blocked content with 410 Gone.
+type ErrContentBlocked struct {
+	// Path is the blocked content path.
+	Path string
+	// Rule is the denylist rule that blocks the content.
+	Rule string
+	// Hints are the hints of the rule, such as "reason:DMCA".
+	Hints []string
+}
+
+func (e ErrContentBlocked) Error() string {
+	msg := fmt.Sprintf("%s is blocked and cannot be provided", e.Path)
+	if len(e.Hints) != 0 {
+		msg += " (" + strings.Join(e.Hints, ", ") + ")"
+	}
+	return msg
+}
+
+// Denylist decides which content the gateway refuses to serve. Rules are
+// loaded from files, URLs and static lines, in the [compact denylist format],
+// or in the legacy [Bad Bits] JSON format, a list of {"anchor": "<hex>"}
+// objects. The compact format supports the following rules, one per line,
+// optionally followed by hints such as "reason:DMCA":
+//
+//	/ipfs/<cid>          the CID, wherever it is resolved
+//	/ipfs/<cid>/<path>   the exact path
+//	/ipfs/<cid>/<path>/* the path, and the paths under it
+//	/ipns/<name>         the IPNS name or DNSLink domain, and the paths under it
+//	/ipns/<name>/<path>  the exact path (with the same /* suffix)
+//	//<hash>             the hex sha2-256 digest, or the base58 multihash, of
+//	                     "<cidv1 base32>", "<cidv1 base32>/<path>", "<name>"
+//	                     or "<name>/<path>", known as a double-hash
+//	<cid>                the CID, like /ipfs/<cid>
+//
+// Rules prefixed with "!" allow content, and take precedence over the rules
+// that block it. Lines starting with "#" are comments, and everything before a
+// "---" line is a header that is ignored.
+//
+// Files and URLs are checked for changes periodically (see
+// [WithDenylistRefreshInterval]), and whenever [Denylist.Reload] is called.
+//
+// [compact denylist format]: https://specs.ipfs.tech/compact-denylist-format/
+// [Bad Bits]: https://badbits.dwebops.pub/
+type Denylist struct {
+	sources         []*denylistSource
+	client          *http.Client
+	refreshInterval time.Duration
+
+	rules    atomic.Pointer[denylistRules]
+	reloadLk sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// DenylistOption is an option for [NewDenylist].
+type DenylistOption func(*Denylist) error
+
+// WithDenylistFile adds the rules of the file at path.
+func WithDenylistFile(path string) DenylistOption {
+	return func(d *Denylist) error {
+		d.sources = append(d.sources, &denylistSource{file: path})
+		return nil
+	}
+}
+
+// WithDenylistURL adds the rules downloaded from url.
+func WithDenylistURL(url string) DenylistOption {
+	return func(d *Denylist) error {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("denylist url %q must be http or https", url)
+		}
+		d.sources = append(d.sources, &denylistSource{url: url})
+		return nil
+	}
+}
+
+// WithDenylistRules adds rules, one per line.
+func WithDenylistRules(lines ...string) DenylistOption {
+	return func(d *Denylist) error {
+		entries, err := parseDenylist("rules", strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			return err
+		}
+		d.sources = append(d.sources, &denylistSource{entries: entries})
+		return nil
+	}
+}
+
+// WithDenylistRefreshInterval sets the interval at which the files and URLs
+// are checked for changes. Defaults to [DefaultDenylistRefreshInterval]. Zero
+// disables the periodic checks.
+func WithDenylistRefreshInterval(d time.Duration) DenylistOption {
+	return func(dl *Denylist) error {
+		if d < 0 {
+			return errors.New("denylist refresh interval must not be negative")
+		}
+		dl.refreshInterval = d
+		return nil
+	}
+}
+
+// WithDenylistHTTPClient sets the client used to download the URLs.
+func WithDenylistHTTPClient(c *http.Client) DenylistOption {
+	return func(d *Denylist) error {
+		d.client = c
+		return nil
+	}
+}
+
+// NewDenylist returns a [Denylist] with the rules of the given sources. It
+// fails if a file or URL cannot be loaded. Call [Denylist.Close] to stop the
+// periodic checks for changes.
+func NewDenylist(opts ...DenylistOption) (*Denylist, error) {
+	d := &Denylist{
+		client:          &http.Client{Timeout: 30 * time.Second},
+		refreshInterval: DefaultDenylistRefreshInterval,
+	}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	d.rules.Store(newDenylistRules(nil))
+
+	if err := d.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	remote := false
+	for _, s := range d.sources {
+		remote = remote || s.file != "" || s.url != ""
+	}
+	if remote && d.refreshInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		d.cancel = cancel
+		d.wg.Add(1)
+		go d.refreshLoop(ctx)
+	}
+	return d, nil
+}
+
+// Reload loads the files and URLs that changed since they were last loaded.
+// A source that cannot be loaded keeps its previous rules, and the errors are
+// returned once the other sources are applied.
+func (d *Denylist) Reload(ctx context.Context) error {
+	d.reloadLk.Lock()
+	defer d.reloadLk.Unlock()
+
+	var errs []error
+	changed := false
+	for _, s := range d.sources {
+		c, err := s.load(ctx, d.client)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		changed = changed || c
+	}
+
+	if changed {
+		var entries []denylistEntry
+		for _, s := range d.sources {
+			entries = append(entries, s.entries...)
+		}
+		d.rules.Store(newDenylistRules(entries))
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the periodic checks for changes.
+func (d *Denylist) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+	return nil
+}
+
+func (d *Denylist) refreshLoop(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Reload(ctx); err != nil && ctx.Err() == nil {
+				log.Warnw("could not reload denylist", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Blocked returns an [ErrContentBlocked] if p is blocked, and nil otherwise.
+// Only the given path is checked: the CIDs that it resolves to must be checked
+// separately, for example with [path.FromCid].
+func (d *Denylist) Blocked(p path.Path) error {
+	segments := p.Segments()
+	if len(segments) < 2 {
+		return nil
+	}
+	ns, key, canonical := segments[0], segments[1], segments[1]
+	rest := strings.Join(segments[2:], "/")
+
+	switch ns {
+	case path.IPFSNamespace:
+		c, err := cid.Decode(key)
+		if err != nil {
+			return nil
+		}
+		key = string(c.Hash())
+		canonical = cid.NewCidV1(c.Type(), c.Hash()).String()
+	case path.IPNSNamespace:
+		key, canonical = normalizeIPNSName(key)
+	default:
+		return nil
+	}
+
+	rules := d.rules.Load()
+	if rules.allow.match(ns, key, canonical, rest) != nil {
+		return nil
+	}
+	if r := rules.block.match(ns, key, canonical, rest); r != nil {
+		return ErrContentBlocked{Path: p.String(), Rule: r.line, Hints: r.hints}
+	}
+	return nil
+}
+
+// normalizeIPNSName returns the key of an IPNS name in the rules, which is the
+// multihash of the name if it is a key, and the lowercase domain otherwise, and
+// its canonical form for double-hashes.
+func normalizeIPNSName(name string) (key, canonical string) {
+	mh, err := ipnsNameMultihash(name)
+	if err != nil {
+		name = strings.ToLower(name)
+		return name, name
+	}
+	canonical, err = cid.NewCidV1(cid.Libp2pKey, mh).StringOfBase(multibase.Base36)
+	if err != nil {
+		canonical = name
+	}
+	return string(mh), canonical
+}
+
+func ipnsNameMultihash(name string) (multihash.Multihash, error) {
+	if c, err := cid.Decode(name); err == nil {
+		return c.Hash(), nil
+	}
+	return multihash.FromB58String(name)
+}
+
+type denylistRule struct {
+	line  string
+	hints []string
+}
+
+type denylistKind int
+
+const (
+	denyCID denylistKind = iota
+	denyPath
+	denyPrefix
+	denyDoubleHash
+)
+
+type denylistEntry struct {
+	allow bool
+	kind  denylistKind
+	key   denylistKey
+	rule  *denylistRule
+}
+
+// denylistKey identifies content in the rules. key is the multihash of a CID
+// or IPNS key, or a domain, and rest the path under it.
+type denylistKey struct {
+	ns, key, rest string
+}
+
+type denylistRules struct {
+	block, allow denylistRuleSet
+}
+
+type denylistRuleSet struct {
+	cids         map[string]*denylistRule
+	paths        map[denylistKey]*denylistRule
+	prefixes     map[denylistKey]*denylistRule
+	doubleHashes map[string]*denylistRule
+	hashCodes    []uint64
+}
+
+func newDenylistRules(entries []denylistEntry) *denylistRules {
+	rules := &denylistRules{}
+	for _, set := range []*denylistRuleSet{&rules.block, &rules.allow} {
+		set.cids = map[string]*denylistRule{}
+		set.paths = map[denylistKey]*denylistRule{}
+		set.prefixes = map[denylistKey]*denylistRule{}
+		set.doubleHashes = map[string]*denylistRule{}
+	}
+
+	for _, e := range entries {
+		set := &rules.block
+		if e.allow {
+			set = &rules.allow
+		}
+		switch e.kind {
+		case denyCID:
+			set.cids[e.key.key] = e.rule
+		case denyPath:
+			set.paths[e.key] = e.rule
+		case denyPrefix:
+			set.prefixes[e.key] = e.rule
+		case denyDoubleHash:
+			set.doubleHashes[e.key.key] = e.rule
+			dh, _ := multihash.Decode(multihash.Multihash(e.key.key))
+			if !containsCode(set.hashCodes, dh.Code) {
+				set.hashCodes = append(set.hashCodes, dh.Code)
+			}
+		}
+	}
+	return rules
+}
+
+func containsCode(codes []uint64, code uint64) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the rule matching the content path /ns/key/rest, or nil.
+func (s *denylistRuleSet) match(ns, key, canonical, rest string) *denylistRule {
+	if ns == path.IPFSNamespace {
+		if r := s.cids[key]; r != nil {
+			return r
+		}
+	}
+	if r := s.paths[denylistKey{ns, key, rest}]; r != nil {
+		return r
+	}
+
+	prefix := rest
+	for {
+		if r := s.prefixes[denylistKey{ns, key, prefix}]; r != nil {
+			return r
+		}
+		if prefix == "" {
+			break
+		}
+		i := strings.LastIndexByte(prefix, '/')
+		if i < 0 {
+			i = 0
+		}
+		prefix = prefix[:i]
+	}
+
+	if len(s.doubleHashes) != 0 {
+		candidates := []string{canonical, canonical + "/"}
+		if rest != "" {
+			candidates = append(candidates, canonical+"/"+rest)
+		}
+		for _, code := range s.hashCodes {
+			for _, c := range candidates {
+				mh, err := multihash.Sum([]byte(c), code, -1)
+				if err != nil {
+					break
+				}
+				if r := s.doubleHashes[string(mh)]; r != nil {
+					return r
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseDenylist parses a denylist in the compact format or, if it starts with
+// "[", in the legacy Bad Bits JSON format. Invalid rules are logged and
+// skipped.
+func parseDenylist(name string, r io.Reader) ([]denylistEntry, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		if b[0] == '[' {
+			return parseLegacyDenylist(name, br)
+		}
+		break
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(nil, maxDenylistLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "---" {
+			// Everything so far was the header.
+			lines = lines[:0]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read denylist %s: %w", name, err)
+	}
+
+	entries := make([]denylistEntry, 0, len(lines))
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseDenylistRule(line)
+		if err != nil {
+			log.Warnw("skipping invalid denylist rule", "denylist", name, "line", i+1, "rule", line, "error", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseDenylistRule(line string) (denylistEntry, error) {
+	fields := strings.Fields(line)
+	e := denylistEntry{rule: &denylistRule{line: fields[0], hints: fields[1:]}}
+
+	rule := fields[0]
+	if strings.HasPrefix(rule, "!") {
+		e.allow = true
+		rule = rule[1:]
+	}
+
+	switch {
+	case strings.HasPrefix(rule, "//"):
+		mh, err := parseDoubleHash(rule[2:])
+		if err != nil {
+			return e, err
+		}
+		e.kind = denyDoubleHash
+		e.key.key = string(mh)
+		return e, nil
+	case !strings.HasPrefix(rule, "/"):
+		c, err := cid.Decode(rule)
+		if err != nil {
+			return e, err
+		}
+		e.kind = denyCID
+		e.key = denylistKey{ns: path.IPFSNamespace, key: string(c.Hash())}
+		return e, nil
+	}
+
+	segments := strings.Split(strings.TrimPrefix(rule, "/"), "/")
+	if len(segments) < 2 || segments[1] == "" {
+		return e, errors.New("missing cid or name")
+	}
+	e.key.ns = segments[0]
+	switch e.key.ns {
+	case path.IPFSNamespace:
+		c, err := cid.Decode(segments[1])
+		if err != nil {
+			return e, err
+		}
+		e.key.key = string(c.Hash())
+	case path.IPNSNamespace:
+		e.key.key, _ = normalizeIPNSName(segments[1])
+	default:
+		return e, fmt.Errorf("unsupported namespace %q", e.key.ns)
+	}
+
+	rest := segments[2:]
+	if len(rest) != 0 && rest[len(rest)-1] == "" {
+		rest = rest[:len(rest)-1]
+	}
+	switch {
+	case len(rest) == 0 && e.key.ns == path.IPFSNamespace:
+		e.kind = denyCID
+	case len(rest) == 0:
+		e.kind = denyPrefix
+	case rest[len(rest)-1] == "*":
+		e.kind = denyPrefix
+		rest = rest[:len(rest)-1]
+	default:
+		e.kind = denyPath
+	}
+	e.key.rest = strings.Join(rest, "/")
+	if strings.Contains(e.key.rest, "*") {
+		return e, errors.New("wildcards are only supported at the end of the path")
+	}
+	return e, nil
+}
+
+// parseDoubleHash parses a hex sha2-256 digest, as used by Bad Bits, or a
+// base58 multihash.
+func parseDoubleHash(s string) (multihash.Multihash, error) {
+	if len(s) == 2*sha256.Size {
+		if digest, err := hex.DecodeString(s); err == nil {
+			return multihash.Encode(digest, multihash.SHA2_256)
+		}
+	}
+	mh, err := multihash.FromB58String(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid double-hash: %w", err)
+	}
+	return mh, nil
+}
+
+// parseLegacyDenylist parses the Bad Bits JSON format, a list of objects with
+// the hex sha2-256 double-hash of the blocked content as "anchor".
+func parseLegacyDenylist(name string, r io.Reader) ([]denylistEntry, error) {
+	var items []struct {
+		Anchor string `json:"anchor"`
+	}
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("could not decode denylist %s: %w", name, err)
+	}
+
+	entries := make([]denylistEntry, 0, len(items))
+	for _, item := range items {
+		mh, err := parseDoubleHash(item.Anchor)
+		if err != nil {
+			log.Warnw("skipping invalid denylist anchor", "denylist", name, "anchor", item.Anchor, "error", err)
+			continue
+		}
+		entries = append(entries, denylistEntry{
+			kind: denyDoubleHash,
+			key:  denylistKey{key: string(mh)},
+			rule: &denylistRule{line: "//" + item.Anchor},
+		})
+	}
+	return entries, nil
+}
+
+// denylistSource is a file, a URL, or static rules, with the entries it was
+// last loaded with.
+type denylistSource struct {
+	file string
+	url  string
+
+	entries []denylistEntry
+	loaded  bool
+
+	modTime      time.Time
+	size         int64
+	etag         string
+	lastModified string
+}
+
+// load loads the source if it changed, and returns true if it did.
+func (s *denylistSource) load(ctx context.Context, client *http.Client) (bool, error) {
+	switch {
+	case s.file != "":
+		return s.loadFile()
+	case s.url != "":
+		return s.loadURL(ctx, client)
+	default:
+		changed := !s.loaded
+		s.loaded = true
+		return changed, nil
+	}
+}
+
+func (s *denylistSource) loadFile() (bool, error) {
+	f, err := os.Open(s.file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if s.loaded && fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return false, nil
+	}
+
+	entries, err := parseDenylist(s.file, f)
+	if err != nil {
+		return false, err
+	}
+	s.entries, s.loaded = entries, true
+	s.modTime, s.size = fi.ModTime(), fi.Size()
+	log.Infow("loaded denylist", "file", s.file, "rules", len(entries))
+	return true, nil
+}
+
+func (s *denylistSource) loadURL(ctx context.Context, client *http.Client) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	if s.loaded {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if s.loaded {
+			return false, nil
+		}
+		fallthrough
+	default:
+		return false, fmt.Errorf("could not download denylist %s: %s", s.url, resp.Status)
+	}
+
+	// Read the whole body first, so that a broken download does not replace
+	// the previous rules with a partial list.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("could not download denylist %s: %w", s.url, err)
+	}
+	entries, err := parseDenylist(s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	s.entries, s.loaded = entries, true
+	s.etag, s.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	log.Infow("loaded denylist", "url", s.url, "rules", len(entries))
+	return true, nil
+}
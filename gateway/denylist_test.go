@@ -0,0 +1,297 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func testCid(t *testing.T, data string) cid.Cid {
+	mh, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.DagProtobuf, mh)
+}
+
+func doubleHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func requireBlocked(t *testing.T, d *Denylist, blocked bool, paths ...string) {
+	t.Helper()
+	for _, s := range paths {
+		p, err := path.NewPath(s)
+		require.NoError(t, err)
+		err = d.Blocked(p)
+		if blocked {
+			require.ErrorAs(t, err, &ErrContentBlocked{}, s)
+			require.True(t, isErrContentBlocked(err))
+		} else {
+			require.NoError(t, err, s)
+		}
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	t.Parallel()
+
+	c1, c2, c3, c4 := testCid(t, "1"), testCid(t, "2"), testCid(t, "3"), testCid(t, "4")
+	// CIDv0 of c4, to check that rules match any version of a CID.
+	c4v0 := cid.NewCidV0(c4.Hash())
+
+	d, err := NewDenylist(WithDenylistRules(
+		"version: 1",
+		"name: test",
+		"---",
+		"# comment",
+		"/ipfs/"+c1.String()+" reason:DMCA",
+		"/ipfs/"+c2.String()+"/a/b",
+		"/ipfs/"+c2.String()+"/c/*",
+		"!/ipfs/"+c2.String()+"/c/allowed",
+		"/ipns/Example.com",
+		"/ipns/docs.example.com/private/*",
+		"//"+doubleHash(c3.String()+"/secret"),
+		c4v0.String(),
+		"/ipfs/not-a-cid",
+		"/ipfs/"+c1.String()+"/*/foo",
+	))
+	require.NoError(t, err)
+	defer d.Close()
+
+	requireBlocked(t, d, true,
+		"/ipfs/"+c1.String(),
+		"/ipfs/"+c1.String()+"/any/path",
+		"/ipfs/"+cid.NewCidV1(cid.Raw, c1.Hash()).String(),
+		"/ipfs/"+c2.String()+"/a/b",
+		"/ipfs/"+c2.String()+"/c",
+		"/ipfs/"+c2.String()+"/c/d/e",
+		"/ipns/example.com",
+		"/ipns/example.com/any/path",
+		"/ipns/docs.example.com/private",
+		"/ipns/docs.example.com/private/file",
+		"/ipfs/"+c3.String()+"/secret",
+		"/ipfs/"+cid.NewCidV0(c3.Hash()).String()+"/secret",
+		"/ipfs/"+c4.String(),
+	)
+	requireBlocked(t, d, false,
+		"/ipfs/"+c2.String(),
+		"/ipfs/"+c2.String()+"/a",
+		"/ipfs/"+c2.String()+"/a/b/c",
+		"/ipfs/"+c2.String()+"/cc",
+		"/ipfs/"+c2.String()+"/c/allowed",
+		"/ipns/docs.example.com",
+		"/ipns/docs.example.com/public",
+		"/ipfs/"+c3.String(),
+		"/ipfs/"+c3.String()+"/public",
+	)
+
+	p, err := path.NewPath("/ipfs/" + c1.String())
+	require.NoError(t, err)
+	err = d.Blocked(p)
+	require.ErrorContains(t, err, "is blocked and cannot be provided (reason:DMCA)")
+	var blockedErr ErrContentBlocked
+	require.ErrorAs(t, err, &blockedErr)
+	require.Equal(t, "/ipfs/"+c1.String(), blockedErr.Rule)
+}
+
+func TestDenylistIPNSKeys(t *testing.T) {
+	t.Parallel()
+
+	const peerID = "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"
+	const name = "k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"
+
+	d, err := NewDenylist(WithDenylistRules("/ipns/" + peerID))
+	require.NoError(t, err)
+	requireBlocked(t, d, true, "/ipns/"+name, "/ipns/"+peerID+"/path")
+
+	d, err = NewDenylist(WithDenylistRules("//" + doubleHash(name+"/path")))
+	require.NoError(t, err)
+	requireBlocked(t, d, true, "/ipns/"+peerID+"/path")
+	requireBlocked(t, d, false, "/ipns/"+peerID)
+}
+
+func TestDenylistBadBits(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := testCid(t, "1"), testCid(t, "2")
+	mh, err := multihash.Sum([]byte(c2.String()+"/path"), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "denylist.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(fmt.Sprintf(`[{"anchor": %q}, {"anchor": "invalid"}]`, doubleHash(c1.String()+"/"))), 0o644))
+	denyFile := filepath.Join(dir, "badbits.deny")
+	require.NoError(t, os.WriteFile(denyFile, []byte("//"+mh.B58String()+"\n"), 0o644))
+
+	d, err := NewDenylist(WithDenylistFile(jsonFile), WithDenylistFile(denyFile), WithDenylistRefreshInterval(0))
+	require.NoError(t, err)
+	requireBlocked(t, d, true, "/ipfs/"+c1.String(), "/ipfs/"+c1.String()+"/any", "/ipfs/"+c2.String()+"/path")
+	requireBlocked(t, d, false, "/ipfs/"+c2.String())
+
+	_, err = NewDenylist(WithDenylistFile(filepath.Join(dir, "missing")))
+	require.Error(t, err)
+}
+
+func TestDenylistReload(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := testCid(t, "1"), testCid(t, "2")
+	file := filepath.Join(t.TempDir(), "denylist.deny")
+	require.NoError(t, os.WriteFile(file, []byte("/ipfs/"+c1.String()+"\n"), 0o644))
+
+	d, err := NewDenylist(WithDenylistFile(file), WithDenylistRefreshInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer d.Close()
+	requireBlocked(t, d, true, "/ipfs/"+c1.String())
+	requireBlocked(t, d, false, "/ipfs/"+c2.String())
+
+	require.NoError(t, os.WriteFile(file, []byte("/ipfs/"+c2.String()+" reason:updated\n"), 0o644))
+	// Make sure that the change is visible even on file systems with coarse
+	// modification times.
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Hour)))
+	require.Eventually(t, func() bool {
+		p, _ := path.NewPath("/ipfs/" + c2.String())
+		return d.Blocked(p) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	requireBlocked(t, d, false, "/ipfs/"+c1.String())
+
+	// A file that cannot be read keeps its previous rules.
+	require.NoError(t, os.Remove(file))
+	require.Error(t, d.Reload(context.Background()))
+	requireBlocked(t, d, true, "/ipfs/"+c2.String())
+}
+
+func TestDenylistURL(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := testCid(t, "1"), testCid(t, "2")
+	var (
+		body     atomic.Value
+		requests atomic.Int32
+		fail     atomic.Bool
+	)
+	body.Store("/ipfs/" + c1.String() + "\n")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		b := body.Load().(string)
+		etag := `"` + doubleHash(b) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, b)
+	}))
+	defer ts.Close()
+
+	d, err := NewDenylist(WithDenylistURL(ts.URL), WithDenylistRefreshInterval(0))
+	require.NoError(t, err)
+	requireBlocked(t, d, true, "/ipfs/"+c1.String())
+
+	// Not modified.
+	require.NoError(t, d.Reload(context.Background()))
+	require.Equal(t, int32(2), requests.Load())
+	requireBlocked(t, d, true, "/ipfs/"+c1.String())
+
+	body.Store("/ipfs/" + c2.String() + "\n")
+	require.NoError(t, d.Reload(context.Background()))
+	requireBlocked(t, d, true, "/ipfs/"+c2.String())
+	requireBlocked(t, d, false, "/ipfs/"+c1.String())
+
+	// Failures keep the previous rules.
+	fail.Store(true)
+	require.Error(t, d.Reload(context.Background()))
+	requireBlocked(t, d, true, "/ipfs/"+c2.String())
+
+	_, err = NewDenylist(WithDenylistURL("ftp://example.com/denylist"))
+	require.Error(t, err)
+}
+
+func TestDenylistGateway(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+	p, err := path.Join(path.FromCid(root), "subdir", "fnord")
+	require.NoError(t, err)
+	k, err := backend.resolvePathNoRootsReturned(context.Background(), p)
+	require.NoError(t, err)
+
+	d, err := NewDenylist(WithDenylistRules(
+		"/ipfs/"+root.String()+"/subdir reason:test",
+		"/ipfs/"+k.RootCid().String(),
+	))
+	require.NoError(t, err)
+	ts := newTestServerWithConfig(t, backend, Config{
+		DeserializedResponses: true,
+		Denylist:              d,
+	})
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/ipfs/" + root.String() + "/", http.StatusOK},
+		{"/ipfs/" + root.String() + "/subdir/", http.StatusGone},
+		// Blocked once resolved to the CID of fnord.
+		{"/ipfs/" + root.String() + "/subdir/fnord", http.StatusGone},
+		{"/ipfs/" + k.RootCid().String(), http.StatusGone},
+		{"/ipfs/" + root.String() + "/subdir?format=car", http.StatusGone},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			res := mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+tc.path, nil))
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code == http.StatusGone {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				require.True(t, strings.Contains(string(body), "is blocked and cannot be provided"), string(body))
+			}
+		})
+	}
+}
+
+func TestDenylistDagStats(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+	p, err := path.Join(path.FromCid(root), "subdir", "fnord")
+	require.NoError(t, err)
+	k, err := backend.resolvePathNoRootsReturned(context.Background(), p)
+	require.NoError(t, err)
+
+	d, err := NewDenylist(WithDenylistRules("/ipfs/" + k.RootCid().String()))
+	require.NoError(t, err)
+	b := newDenylistBackend(backend, d)
+
+	// Blocked once resolved to the CID of fnord.
+	ip, err := path.NewImmutablePath(p)
+	require.NoError(t, err)
+	_, err = b.DagStats(context.Background(), ip, 0)
+	require.ErrorAs(t, err, &ErrContentBlocked{})
+
+	other, err := path.Join(path.FromCid(root), "subdir")
+	require.NoError(t, err)
+	ip, err = path.NewImmutablePath(other)
+	require.NoError(t, err)
+	_, err = b.DagStats(context.Background(), ip, 0)
+	require.NoError(t, err)
+}
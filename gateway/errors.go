@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/ipld/go-ipld-prime/schema"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -166,14 +168,34 @@ func (epr ErrPartialResponse) Error() string {
 	return "received a partial CAR response from the backend"
 }
 
+// ErrorResponse is the body of the error responses of the gateway to the
+// requests preferring application/json over text/html in their Accept header,
+// for the API clients to unmarshal instead of parsing text/plain messages.
+type ErrorResponse struct {
+	// Code is the HTTP status code of the response.
+	Code int `json:"code"`
+
+	// Message describes the error.
+	Message string `json:"message"`
+
+	// RetryAfter is the number of seconds to wait before retrying, when the
+	// response has a Retry-After header.
+	RetryAfter int `json:"retry_after,omitempty"`
+
+	// TraceID is the OpenTelemetry trace ID of the request, when traced.
+	TraceID string `json:"trace_id,omitempty"`
+}
+
 func webError(w http.ResponseWriter, r *http.Request, c *Config, err error, defaultCode int) {
 	code := defaultCode
+	var retryAfter int
 
 	// Pass Retry-After hint to the client
 	var era *ErrorRetryAfter
 	if errors.As(err, &era) {
 		if era.RetryAfter > 0 {
 			w.Header().Set("Retry-After", era.RetryAfterHeader())
+			retryAfter = int(era.roundSeconds().Seconds())
 			// Adjust defaultCode if needed
 			if code != http.StatusTooManyRequests && code != http.StatusServiceUnavailable {
 				code = http.StatusTooManyRequests
@@ -184,6 +206,10 @@ func webError(w http.ResponseWriter, r *http.Request, c *Config, err error, defa
 
 	// Handle status code
 	switch {
+	case isTimeoutCause(err), errors.Is(err, ErrOffline):
+		code = http.StatusGatewayTimeout
+	case errors.Is(err, ErrRequestBudgetExceeded):
+		code = http.StatusRequestEntityTooLarge
 	case errors.Is(err, &cid.ErrInvalidCid{}):
 		code = http.StatusBadRequest
 	case isErrContentBlocked(err):
@@ -201,7 +227,20 @@ func webError(w http.ResponseWriter, r *http.Request, c *Config, err error, defa
 	}
 
 	acceptsHTML := !c.DisableHTMLErrors && strings.Contains(r.Header.Get("Accept"), "text/html")
-	if acceptsHTML {
+	if prefersJSONErrors(r) {
+		res := ErrorResponse{
+			Code:       code,
+			Message:    err.Error(),
+			RetryAfter: retryAfter,
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			res.TraceID = sc.TraceID().String()
+		}
+		w.Header().Set("Content-Type", jsonResponseFormat)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(res)
+	} else if acceptsHTML {
 		w.Header().Set("Content-Type", "text/html")
 		w.WriteHeader(code)
 		err = assets.ErrorTemplate.Execute(w, assets.ErrorTemplateData{
@@ -220,6 +259,41 @@ func webError(w http.ResponseWriter, r *http.Request, c *Config, err error, defa
 	}
 }
 
+// prefersJSONErrors returns true if application/json is accepted with a
+// higher quality than text/html in the Accept headers of r. When both have the
+// same quality, the first one listed is preferred.
+func prefersJSONErrors(r *http.Request) bool {
+	jsonQ, htmlQ := -1.0, -1.0
+	jsonFirst := false
+	for _, header := range r.Header.Values("Accept") {
+		for _, value := range strings.Split(header, ",") {
+			mediaType, params, _ := strings.Cut(value, ";")
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				if name, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(name) == "q" {
+					var err error
+					if q, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+						q = 0
+					}
+				}
+			}
+			switch strings.ToLower(strings.TrimSpace(mediaType)) {
+			case jsonResponseFormat:
+				if jsonQ < 0 && htmlQ < 0 {
+					jsonFirst = true
+				}
+				jsonQ = q
+			case "text/html":
+				htmlQ = q
+			}
+		}
+	}
+	if jsonQ <= 0 {
+		return false
+	}
+	return jsonQ > htmlQ || (jsonQ == htmlQ && jsonFirst)
+}
+
 // isErrNotFound returns true for IPLD errors that should return 4xx errors (e.g. the path doesn't exist, the data is
 // the wrong type, etc.), rather than issues with just finding and retrieving the data.
 func isErrNotFound(err error) bool {
@@ -253,6 +327,10 @@ func isErrNotFound(err error) bool {
 
 // isErrContentBlocked returns true for content filtering system errors
 func isErrContentBlocked(err error) bool {
+	if errors.As(err, &ErrContentBlocked{}) {
+		return true
+	}
+
 	// TODO: we match error message to avoid pulling nopfs as a dependency
 	// Ref. https://github.com/ipfs-shipyard/nopfs/blob/cde3b5ba964c13e977f4a95f3bd8ca7d7710fbda/status.go#L87-L89
 	return strings.Contains(err.Error(), "blocked and cannot be provided")
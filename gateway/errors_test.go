@@ -1,6 +1,8 @@
 package gateway
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestErrRetryAfterIs(t *testing.T) {
@@ -104,7 +107,7 @@ func TestWebError(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/blah", nil)
-		r.Header.Set("Accept", "application/json")
+		r.Header.Set("Accept", "application/vnd.ipld.car")
 		webError(w, r, config, NewErrorStatusCodeFromStatus(http.StatusTeapot), http.StatusInternalServerError)
 		require.Equal(t, http.StatusTeapot, w.Result().StatusCode)
 		require.Contains(t, w.Result().Header.Get("Content-Type"), "text/plain")
@@ -122,3 +125,79 @@ func TestWebError(t *testing.T) {
 		require.Contains(t, w.Result().Header.Get("Content-Type"), "text/plain")
 	})
 }
+
+func TestWebErrorJSON(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{}
+
+	t.Run("Structured body when JSON is preferred", func(t *testing.T) {
+		t.Parallel()
+
+		traceID := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  trace.SpanID{1},
+		}))
+		err := NewErrorRetryAfter(ErrServiceUnavailable, 42*time.Second)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/blah", nil).WithContext(ctx)
+		r.Header.Set("Accept", "application/json;q=0.9, text/html;q=0.8")
+		webError(w, r, config, err, http.StatusInternalServerError)
+
+		res := w.Result()
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		var body ErrorResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		require.Equal(t, ErrorResponse{
+			Code:       http.StatusServiceUnavailable,
+			Message:    "Service Unavailable",
+			RetryAfter: 42,
+			TraceID:    traceID.String(),
+		}, body)
+	})
+
+	t.Run("Optional fields are omitted", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/blah", nil)
+		r.Header.Set("Accept", "application/json")
+		webError(w, r, config, errors.New("not found"), http.StatusNotFound)
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		require.JSONEq(t, `{"code":404,"message":"not found"}`, w.Body.String())
+	})
+
+	t.Run("HTML is preferred", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/blah", nil)
+		r.Header.Set("Accept", "text/html,application/json")
+		webError(w, r, config, errors.New("not found"), http.StatusNotFound)
+		require.Equal(t, "text/html", w.Result().Header.Get("Content-Type"))
+	})
+}
+
+func TestPrefersJSONErrors(t *testing.T) {
+	t.Parallel()
+
+	for accept, expected := range map[string]bool{
+		"":                                      false,
+		"text/html":                             false,
+		"application/json":                      true,
+		"application/json;q=0":                  false,
+		"application/json; q=0.0, text/plain":   false,
+		"application/json;q=invalid":            false,
+		"text/html, application/json":           false,
+		"application/json, text/html":           true,
+		"text/html;q=0.5, application/json":     true,
+		"application/json;q=0.5, text/html":     false,
+		"application/json;q=0.1, text/html;q=0": true,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/blah", nil)
+		r.Header.Set("Accept", accept)
+		require.Equal(t, expected, prefersJSONErrors(r), accept)
+	}
+}
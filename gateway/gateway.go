@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/ipfs/boxo/gateway/assets"
 	"github.com/ipfs/boxo/ipld/unixfs"
 	"github.com/ipfs/boxo/path"
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 )
 
@@ -38,16 +40,166 @@ type Config struct {
 	// DisableHTMLErrors disables pretty HTML pages when an error occurs. Instead, a `text/plain`
 	// page will be sent with the raw error message. This can be useful if this gateway
 	// is being proxied by other service, which wants to use the error message.
+	// Requests preferring application/json receive an [ErrorResponse] either way.
 	DisableHTMLErrors bool
 
 	// PublicGateways configures the behavior of known public gateways. Each key is
 	// a fully qualified domain name (FQDN). To be used with WithHostname.
 	PublicGateways map[string]*PublicGateway
 
+	// CORS are the CORS policies of the requests which do not match any
+	// policy of their [PublicGateway], the first matching one being applied.
+	// To be used with [Headers.ApplyCORSPolicies].
+	CORS []CORSPolicy
+
 	// Menu adds items to the gateway menu that are shown in pages, such as
 	// directory listings, DAG previews and errors. These will be displayed to the
 	// right of "About IPFS" and "Install IPFS".
 	Menu []assets.MenuItem
+
+	// DagStatsMaxBlocks is the maximum number of blocks the gateway walks to
+	// compute the X-Ipfs-DagSize and X-Ipfs-DagBlockCount headers when a
+	// request includes the ?dag-stats query parameter. Past this limit, the
+	// values are estimated. Only used if the [IPFSBackend] implements
+	// [WithDagStats]. Defaults to [DefaultDagStatsMaxBlocks].
+	DagStatsMaxBlocks int
+
+	// PathResolutionTimeout is the maximum time allowed to resolve the content
+	// path, including IPNS names, DNSLinks and path segments. It bounds the
+	// backend calls until they return the response to stream, such as
+	// [IPFSBackend.Get] or [IPFSBackend.GetCAR]. When exceeded, the request
+	// fails with 504 Gateway Timeout and [ErrPathResolutionTimeout]. Zero
+	// means no timeout.
+	PathResolutionTimeout time.Duration
+
+	// FirstBlockTimeout is the maximum time allowed, once the content path is
+	// resolved, before the first byte of the response body is written. When
+	// exceeded, the request fails with 504 Gateway Timeout and
+	// [ErrFirstBlockTimeout]. Zero means no timeout.
+	FirstBlockTimeout time.Duration
+
+	// StallTimeout is the maximum time allowed between two writes of the
+	// response body, so that slow but progressing transfers are allowed while
+	// stalled ones are not. When exceeded before the response started, the
+	// request fails with 504 Gateway Timeout and [ErrStallTimeout], otherwise
+	// the response is aborted. Zero means no timeout.
+	StallTimeout time.Duration
+
+	// DirectoryListingPageSize is the number of entries shown on a page of a
+	// generated HTML directory listing, and the maximum of the ?limit query
+	// parameter. Pages are selected with the ?offset and ?limit query
+	// parameters, and entries can be sorted with ?sort=name|size and
+	// ?order=asc|desc. Zero, the default, shows all the entries unless ?limit
+	// is set.
+	DirectoryListingPageSize int
+
+	// UnixFSBudget, CARBudget and TarBudget limit the blocks and bytes
+	// retrieved to serve a single deserialized, CAR or TAR response. Requests
+	// whose content exceeds their budget fail with 413 Content Too Large and
+	// [ErrRequestBudgetExceeded], or are aborted if the response already
+	// started, while other retrieval failures still fail with 502 Bad
+	// Gateway. The zero value means no limit.
+	//
+	// The backend must honor [ContextWithRequestBudget], as [BlocksBackend]
+	// and [CarBackend] do.
+	UnixFSBudget RequestBudget
+	CARBudget    RequestBudget
+	TarBudget    RequestBudget
+
+	// ContentTypeOverrides force the Content-Type of UnixFS files matching
+	// an extension or a path pattern. Overrides in [PublicGateway] take
+	// precedence over these.
+	ContentTypeOverrides []ContentTypeOverride
+
+	// ContentTypeCache, if set, stores the Content-Type sniffed from the
+	// content of UnixFS files, so that it is not sniffed again on every
+	// request for the same CID. See [NewContentTypeCache].
+	ContentTypeCache ContentTypeCache
+
+	// Denylist, if set, blocks the requests for the content it denies, which
+	// are answered with 410 Gone. See [NewDenylist].
+	Denylist *Denylist
+
+	// Offline makes the gateway answer only with the content available
+	// locally, for example during an outage of the network or of the remote
+	// gateways it retrieves content from, or for deterministic tests. Requests
+	// needing content that would have to be retrieved fail with 504 Gateway
+	// Timeout and [ErrOffline]. Mutable paths (/ipns/) cannot be resolved in
+	// this mode. A single request can be switched to the offline mode with
+	// the X-Ipfs-Offline: true header or the ?offline query parameter.
+	//
+	// The backend must honor [ContextWithOffline], as [BlocksBackend] and the
+	// remote backends of this package do.
+	Offline bool
+
+	// EarlyHints makes the gateway look for the stylesheets, scripts and
+	// images referenced by the HTML files it serves, and hint them with
+	// preload Link headers, so that browsers start fetching them before the
+	// page is parsed. Over HTTP/2 and later, these are also sent in a 103
+	// Early Hints response as soon as they are known. Only the relative
+	// references within the same DAG, below the directory of the page, in the
+	// beginning of the file are hinted.
+	EarlyHints bool
+
+	// DemandSignaler, if set, is told the root CID of the content
+	// successfully served by the gateway, so that a provider system can
+	// prioritize announcing the content in demand.
+	DemandSignaler DemandSignaler
+
+	// Writable, if set, makes the gateway accept uploads with POST and PUT
+	// requests to /ipfs/, and reply with 201 Created and the CID of their
+	// root. The backend must implement [WithUploads]. The request body is
+	// read according to its Content-Type:
+	//
+	//   - application/vnd.ipld.raw: a single raw block, of at most 2 MiB, the
+	//     largest block transferred by bitswap.
+	//   - application/vnd.ipld.car: a CAR, whose blocks are verified and
+	//     stored, and whose first root, which must be in the CAR or already
+	//     stored, is returned.
+	//   - multipart/form-data: files and directories, imported as UnixFS in a
+	//     directory wrapping them.
+	//   - anything else: a file, imported as UnixFS.
+	Writable *WritableConfig
+
+	// AccessLog, if set, logs a structured record per request, with the
+	// IPFS-specific details of the request and of its response.
+	AccessLog *AccessLogConfig
+
+	// Compression, if set, compresses the UnixFS files of compressible
+	// content types with the content coding negotiated with the
+	// Accept-Encoding header of the request, among zstd, brotli and gzip.
+	// Compressed responses have a weak ETag with the coding as suffix, such
+	// as W/"cid.gz". Range requests are answered uncompressed.
+	Compression *CompressionConfig
+}
+
+// WritableConfig configures the uploads to a writable gateway, see
+// [Config.Writable].
+type WritableConfig struct {
+	// Authorize is called before accepting an upload. Returned errors are
+	// sent to the client with the 403 Forbidden status code, unless they are
+	// an [ErrorStatusCode]. If nil, every upload is refused: a gateway open
+	// to anonymous uploads must set a function returning nil.
+	Authorize func(r *http.Request) error
+
+	// MaxBodySize, if positive, limits the size of the request bodies, in
+	// bytes. Larger uploads fail with 413 Content Too Large.
+	MaxBodySize int64
+
+	// MaxEntries, if positive, limits the number of files and directories
+	// of multipart uploads. Larger uploads fail with 413 Content Too Large.
+	MaxEntries int
+}
+
+// DemandSignaler is told which content is requested from the gateway, such as
+// the [provider.DemandSignaler] of a provider system with
+// [provider.ProvideAhead].
+//
+// [provider.DemandSignaler]: https://pkg.go.dev/github.com/ipfs/boxo/provider#DemandSignaler
+// [provider.ProvideAhead]: https://pkg.go.dev/github.com/ipfs/boxo/provider#ProvideAhead
+type DemandSignaler interface {
+	// Demanded signals that c is being requested. It must not block.
+	Demanded(c cid.Cid)
 }
 
 // PublicGateway is the specification of an IPFS Public Gateway.
@@ -86,6 +238,21 @@ type PublicGateway struct {
 	// DeserializedResponses configures this gateway to support returning data
 	// in deserialized format. This setting overrides the global setting.
 	DeserializedResponses bool
+
+	// UnixFSBudget, CARBudget and TarBudget, if not zero, replace the
+	// budgets of [Config] of the same name for this gateway.
+	UnixFSBudget RequestBudget
+	CARBudget    RequestBudget
+	TarBudget    RequestBudget
+
+	// ContentTypeOverrides force the Content-Type of UnixFS files matching
+	// an extension or a path pattern on this gateway. These are checked
+	// before the global [Config.ContentTypeOverrides].
+	ContentTypeOverrides []ContentTypeOverride
+
+	// CORS are the CORS policies of the requests to this gateway, including
+	// its subdomains. These are checked before the global [Config.CORS].
+	CORS []CORSPolicy
 }
 
 type CarParams struct {
@@ -93,6 +260,10 @@ type CarParams struct {
 	Scope      DagScope
 	Order      DagOrder
 	Duplicates DuplicateBlocksPolicy
+
+	// AllowPartial is true if the client accepts a CAR with only the blocks of
+	// the DAG available to the backend, see [WithPartialCAR].
+	AllowPartial bool
 }
 
 // DagByteRange describes a range request within a UnixFS file. "From" and
@@ -388,6 +559,82 @@ type WithContextHint interface {
 	WrapContextForRequest(context.Context) context.Context
 }
 
+// DagStats describes the size of a DAG, as returned by [WithDagStats].
+type DagStats struct {
+	// Size is the cumulative size of the DAG, in bytes.
+	Size uint64
+
+	// Blocks is the number of blocks in the DAG. Zero means unknown.
+	Blocks uint64
+
+	// Complete is true if the whole DAG was walked, in which case Size and
+	// Blocks are exact. Otherwise, they are estimates derived from the DAG
+	// metadata (such as the UnixFS cumulative size) and the walked blocks.
+	Complete bool
+}
+
+// WithDagStats is an optional interface that an [IPFSBackend] can implement to
+// allow the gateway to return the size of the requested DAG in the
+// X-Ipfs-DagSize and X-Ipfs-DagBlockCount headers of HEAD responses, and of
+// any response to a request with the ?dag-stats query parameter. This allows
+// clients to decide whether to fetch a DAG before committing bandwidth.
+type WithDagStats interface {
+	// DagStats returns the [DagStats] of the DAG at the given path, reading at
+	// most maxBlocks blocks. If maxBlocks is zero, only the root block is read
+	// and the result is based solely on its metadata.
+	DagStats(ctx context.Context, p path.ImmutablePath, maxBlocks int) (DagStats, error)
+}
+
+// WithUploads is an optional interface that an [IPFSBackend] must implement to
+// store the content uploaded to a writable gateway, see [Config.Writable].
+// Implementations must call [CheckUpload] before storing each block, so that
+// the content blocked by [Config.Denylist] is never stored.
+type WithUploads interface {
+	// PutBlocks stores blks, whose CIDs have been verified.
+	PutBlocks(ctx context.Context, blks []blocks.Block) error
+
+	// AddUnixFS imports node, a file or a directory, as UnixFS and returns
+	// the CID of its root.
+	AddUnixFS(ctx context.Context, node files.Node) (cid.Cid, error)
+}
+
+type uploadCheckKey struct{}
+
+// withUploadCheck returns a context with which [CheckUpload] calls check.
+func withUploadCheck(ctx context.Context, check func(c cid.Cid) error) context.Context {
+	return context.WithValue(ctx, uploadCheckKey{}, check)
+}
+
+// CheckUpload returns an error if the block c, part of an upload made with
+// ctx, must not be stored. It is called by the implementations of
+// [WithUploads].
+func CheckUpload(ctx context.Context, c cid.Cid) error {
+	if check, ok := ctx.Value(uploadCheckKey{}).(func(c cid.Cid) error); ok {
+		return check(c)
+	}
+	return nil
+}
+
+// WithPartialCAR is an optional interface that an [IPFSBackend] can implement
+// to serve the blocks it has of an incomplete DAG to the clients requesting it
+// with [CarParams.AllowPartial], instead of failing the CAR stream midway. The
+// gateway then declares whether the DAG was complete in the X-Ipfs-DagComplete
+// and X-Ipfs-DagMissingBlocks trailers of the response.
+type WithPartialCAR interface {
+	// GetPartialCAR is like GetCAR, but skips the missing blocks of the DAG,
+	// along with the blocks only reachable through them.
+	GetPartialCAR(context.Context, path.ImmutablePath, CarParams) (ContentPathMetadata, PartialCAR, error)
+}
+
+// PartialCAR is a CAR stream returned by [WithPartialCAR].
+type PartialCAR interface {
+	io.ReadCloser
+
+	// MissingBlocks returns the CIDs of the blocks skipped so far. Once the
+	// stream is read to the end, these are all the blocks skipped.
+	MissingBlocks() []cid.Cid
+}
+
 // RequestContextKey is a type representing a [context.Context] value key.
 type RequestContextKey string
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
@@ -1216,3 +1217,38 @@ func TestBrowserErrorHTML(t *testing.T) {
 		require.Contains(t, string(body), "<!DOCTYPE html>")
 	})
 }
+
+type recordingDemandSignaler struct {
+	lk       sync.Mutex
+	demanded []cid.Cid
+}
+
+func (s *recordingDemandSignaler) Demanded(c cid.Cid) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.demanded = append(s.demanded, c)
+}
+
+func TestDemandSignaler(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+	signaler := &recordingDemandSignaler{}
+	ts := newTestServerWithConfig(t, backend, Config{
+		DeserializedResponses: true,
+		DemandSignaler:        signaler,
+	})
+
+	res := mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil))
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	res = mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=car", nil))
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Failed requests are not signaled.
+	res = mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/missing", nil))
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	signaler.lk.Lock()
+	defer signaler.lk.Unlock()
+	require.Equal(t, []cid.Cid{root, root}, signaler.demanded)
+}
@@ -132,12 +132,19 @@ func (i *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Hour)
 	defer cancel()
 
+	if i.isOfflineRequest(r) {
+		ctx = ContextWithOffline(ctx)
+	}
+
 	if withCtxWrap, ok := i.backend.(WithContextHint); ok {
 		ctx = withCtxWrap.WrapContextForRequest(ctx)
 	}
 
 	r = r.WithContext(ctx)
 
+	w, r, logAccess := i.withAccessLog(w, r)
+	defer logAccess()
+
 	switch r.Method {
 	case http.MethodGet, http.MethodHead:
 		i.getOrHeadHandler(w, r)
@@ -145,26 +152,35 @@ func (i *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case http.MethodOptions:
 		i.optionsHandler(w, r)
 		return
+	case http.MethodPost, http.MethodPut:
+		if i.config.Writable != nil {
+			i.uploadHandler(w, r)
+			return
+		}
 	}
 
-	addAllowHeader(w)
+	i.addAllowHeader(w)
 
 	errmsg := "Method " + r.Method + " not allowed: read only access"
 	http.Error(w, errmsg, http.StatusMethodNotAllowed)
 }
 
 func (i *handler) optionsHandler(w http.ResponseWriter, r *http.Request) {
-	addAllowHeader(w)
+	i.addAllowHeader(w)
 	// OPTIONS is a noop request that is used by the browsers to check if server accepts
 	// cross-site XMLHttpRequest, which is indicated by the presence of CORS headers:
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Access_control_CORS#Preflighted_requests
 }
 
 // addAllowHeader sets Allow header with supported HTTP methods
-func addAllowHeader(w http.ResponseWriter) {
+func (i *handler) addAllowHeader(w http.ResponseWriter) {
 	w.Header().Add("Allow", http.MethodGet)
 	w.Header().Add("Allow", http.MethodHead)
 	w.Header().Add("Allow", http.MethodOptions)
+	if i.config.Writable != nil {
+		w.Header().Add("Allow", http.MethodPost)
+		w.Header().Add("Allow", http.MethodPut)
+	}
 }
 
 type requestData struct {
@@ -179,6 +195,7 @@ type requestData struct {
 	immutablePath path.ImmutablePath
 	ttl           time.Duration
 	lastMod       time.Time
+	resolution    time.Duration // Time spent resolving mutable paths.
 
 	// Defined if resolution has already happened.
 	pathMetadata *ContentPathMetadata
@@ -259,6 +276,7 @@ func (i *handler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 		responseParams: formatParams,
 	}
 
+	setAccessLogRequest(r.Context(), rq)
 	addContentLocation(r, w, rq)
 
 	// IPNS Record response format can be handled now, since (1) it needs the
@@ -271,8 +289,13 @@ func (i *handler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if contentPath.Mutable() {
-		rq.immutablePath, rq.ttl, rq.lastMod, err = i.backend.ResolveMutable(r.Context(), contentPath)
+		resolveCtx, cancel := i.pathResolutionContext(r.Context())
+		resolveBegin := time.Now()
+		rq.immutablePath, rq.ttl, rq.lastMod, err = i.backend.ResolveMutable(resolveCtx, contentPath)
+		rq.resolution = time.Since(resolveBegin)
+		cancel()
 		if err != nil {
+			err = withTimeoutCause(resolveCtx, err)
 			err = fmt.Errorf("failed to resolve %s: %w", debugStr(contentPath.String()), err)
 			i.webError(w, r, err, http.StatusInternalServerError)
 			return
@@ -286,6 +309,26 @@ func (i *handler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Only the content actually served is signaled, not the missing one.
+	if i.config.DemandSignaler != nil {
+		defer func() {
+			if success {
+				i.config.DemandSignaler.Demanded(rq.immutablePath.RootCid())
+			}
+		}()
+	}
+
+	// From here on, the response must start within Config.FirstBlockTimeout
+	// and must not stall for longer than Config.StallTimeout.
+	w, r, stopTimeouts := i.startTransferTimeouts(w, r)
+	defer stopTimeouts()
+
+	// The blocks retrieved for the response are limited by the budget of
+	// its format. Computing the DAG stats is bounded separately.
+	if budget := i.requestBudget(r, responseFormat); !budget.isZero() {
+		r = r.WithContext(ContextWithRequestBudget(r.Context(), budget))
+	}
+
 	// CAR response format can be handled now, since (1) it explicitly needs the
 	// full immutable path to include in the CAR, and (2) has custom If-None-Match
 	// header handling due to custom ETag.
@@ -305,6 +348,10 @@ func (i *handler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Report the DAG size for HEAD and ?dag-stats requests, if supported,
+	// once the response is known not to be 304 Not Modified.
+	i.addDagStatsHeaders(w, r, rq)
+
 	// Support custom response formats passed via ?format or Accept HTTP header
 	switch responseFormat {
 	case "", jsonResponseFormat, cborResponseFormat:
@@ -328,6 +375,18 @@ func (i *handler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 // are allowed on the specified hostname, or globally. Host-specific rules
 // override global config.
 func (i *handler) isDeserializedResponsePossible(r *http.Request) bool {
+	// If the gateway is defined, return whatever is set.
+	if gw, ok := i.publicGatewayForRequest(r); ok {
+		return gw.DeserializedResponses
+	}
+
+	// Otherwise, the default.
+	return i.config.DeserializedResponses
+}
+
+// publicGatewayForRequest returns the [PublicGateway] configured for the
+// hostname of the request, if any.
+func (i *handler) publicGatewayForRequest(r *http.Request) (*PublicGateway, bool) {
 	// Get the value from HTTP Host header
 	host := r.Host
 
@@ -342,13 +401,8 @@ func (i *handler) isDeserializedResponsePossible(r *http.Request) bool {
 		host = xHost
 	}
 
-	// If the gateway is defined, return whatever is set.
-	if gw, ok := i.config.PublicGateways[host]; ok {
-		return gw.DeserializedResponses
-	}
-
-	// Otherwise, the default.
-	return i.config.DeserializedResponses
+	gw, ok := i.config.PublicGateways[host]
+	return gw, ok
 }
 
 // isTrustlessRequest returns true if the responseFormat and contentPath allow
@@ -727,17 +781,20 @@ func debugStr(path string) string {
 func (i *handler) handleIfNoneMatch(w http.ResponseWriter, r *http.Request, rq *requestData) bool {
 	// Detect when If-None-Match HTTP header allows returning HTTP 304 Not Modified
 	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
-		pathMetadata, err := i.backend.ResolvePath(r.Context(), rq.immutablePath)
+		resolveCtx, cancel := i.pathResolutionContext(r.Context())
+		defer cancel()
+		pathMetadata, err := i.backend.ResolvePath(resolveCtx, rq.immutablePath)
 		if err != nil {
 			var forwardedPath path.ImmutablePath
 			var continueProcessing bool
 			if isWebRequest(rq.responseFormat) {
 				forwardedPath, continueProcessing = i.handleWebRequestErrors(w, r, rq.mostlyResolvedPath(), rq.immutablePath, rq.contentPath, err, rq.logger)
 				if continueProcessing {
-					pathMetadata, err = i.backend.ResolvePath(r.Context(), forwardedPath)
+					pathMetadata, err = i.backend.ResolvePath(resolveCtx, forwardedPath)
 				}
 			}
 			if !continueProcessing || err != nil {
+				err = withTimeoutCause(resolveCtx, err)
 				err = fmt.Errorf("failed to resolve %s: %w", debugStr(rq.contentPath.String()), err)
 				i.webError(w, r, err, http.StatusInternalServerError)
 				return true
@@ -752,6 +809,8 @@ func (i *handler) handleIfNoneMatch(w http.ResponseWriter, r *http.Request, rq *
 		dirEtag := getDirListingEtag(pathCid)
 		dagEtag := getDagIndexEtag(pathCid)
 
+		// The ETags of compressed responses are matched when serving the
+		// file, once it is known whether it would be compressed.
 		if etagMatch(ifNoneMatch, cidEtag, dirEtag, dagEtag) {
 			// Finish early if client already has a matching Etag
 			w.WriteHeader(http.StatusNotModified)
@@ -780,17 +839,20 @@ func (i *handler) handleIfModifiedSince(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Resolve path to be able to read pathMetadata.ModTime
-	pathMetadata, err := i.backend.ResolvePath(r.Context(), rq.immutablePath)
+	resolveCtx, cancel := i.pathResolutionContext(r.Context())
+	defer cancel()
+	pathMetadata, err := i.backend.ResolvePath(resolveCtx, rq.immutablePath)
 	if err != nil {
 		var forwardedPath path.ImmutablePath
 		var continueProcessing bool
 		if isWebRequest(rq.responseFormat) {
 			forwardedPath, continueProcessing = i.handleWebRequestErrors(w, r, rq.mostlyResolvedPath(), rq.immutablePath, rq.contentPath, err, rq.logger)
 			if continueProcessing {
-				pathMetadata, err = i.backend.ResolvePath(r.Context(), forwardedPath)
+				pathMetadata, err = i.backend.ResolvePath(resolveCtx, forwardedPath)
 			}
 		}
 		if !continueProcessing || err != nil {
+			err = withTimeoutCause(resolveCtx, err)
 			err = fmt.Errorf("failed to resolve %s: %w", debugStr(rq.contentPath.String()), err)
 			i.webError(w, r, err, http.StatusInternalServerError)
 			return true
@@ -1030,5 +1092,6 @@ func (i *handler) getTemplateGlobalData(r *http.Request, contentPath path.Path)
 }
 
 func (i *handler) webError(w http.ResponseWriter, r *http.Request, err error, defaultCode int) {
-	webError(w, r, i.config, err, defaultCode)
+	err = withBudgetCause(r.Context(), withTimeoutCause(r.Context(), err))
+	webError(w, r, i.config, withOfflineCause(r.Context(), err), defaultCode)
 }
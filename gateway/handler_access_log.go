@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// AccessLogConfig configures the access log of the gateway, see
+// [Config.AccessLog].
+type AccessLogConfig struct {
+	// Logger receives a record per logged request, with the following
+	// attributes:
+	//
+	//   - method, host and uri: the request.
+	//   - status, bytes, duration and ttfb: the response, its body size, and
+	//     the time until it was complete and until it started.
+	//   - content_path, resolved_path, cid and format: the requested content
+	//     path, its resolution and root CID, and the response format, when
+	//     known.
+	//   - resolution: the time spent resolving mutable paths.
+	//   - cache_control: the Cache-Control header of the response, whose
+	//     status is 304 when the cache of the client is up to date.
+	//   - client_ip, user_agent, referer and accept: the client hints. The
+	//     client IP is the address of the peer of the connection, unless it
+	//     is one of the TrustedProxies.
+	Logger *slog.Logger
+
+	// Level is the level of the records. Defaults to [slog.LevelInfo].
+	Level slog.Level
+
+	// SampleRate, if between 0 and 1 exclusive, is the fraction of the
+	// successful requests that are logged. Requests answered with an error
+	// status are always logged. By default, every request is logged.
+	SampleRate float64
+
+	// Redact are the attributes whose value is replaced by "REDACTED", for
+	// instance "client_ip" or "uri".
+	Redact []string
+
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-For header is trusted. The client IP of the requests they
+	// forward is the last address of the header that is not a trusted proxy.
+	// By default, the header is ignored, as any client can set it.
+	TrustedProxies []netip.Prefix
+}
+
+// accessLogKey is the context key of the [accessRecord] of a request.
+type accessLogKey struct{}
+
+// accessRecord collects the attributes of the access log record of a
+// request.
+type accessRecord struct {
+	rq *requestData
+}
+
+// withAccessLog logs the request, once served with the returned writer and
+// request, if the access log is enabled. The returned function must be
+// called once the response is done.
+func (i *handler) withAccessLog(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	cfg := i.config.AccessLog
+	if cfg == nil || cfg.Logger == nil {
+		return w, r, func() {}
+	}
+
+	begin := time.Now()
+	rec := &accessRecord{}
+	aw := &accessLogResponseWriter{ResponseWriter: w}
+	r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, rec))
+
+	return aw, r, func() {
+		status := aw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status < 400 && cfg.SampleRate > 0 && cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+
+		ttfb := time.Duration(0)
+		if !aw.started.IsZero() {
+			ttfb = aw.started.Sub(begin)
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("host", r.Host),
+			slog.String("uri", r.RequestURI),
+			slog.Int("status", status),
+			slog.Int64("bytes", aw.bytes),
+			slog.Duration("duration", time.Since(begin)),
+			slog.Duration("ttfb", ttfb),
+		}
+		if rq := rec.rq; rq != nil {
+			attrs = append(attrs, slog.String("content_path", rq.contentPath.String()))
+			if resolved := rq.mostlyResolvedPath(); resolved.RootCid().Defined() {
+				attrs = append(attrs,
+					slog.String("resolved_path", resolved.String()),
+					slog.String("cid", resolved.RootCid().String()),
+				)
+			}
+			attrs = append(attrs, slog.String("format", rq.responseFormat))
+			if rq.resolution > 0 {
+				attrs = append(attrs, slog.Duration("resolution", rq.resolution))
+			}
+		}
+		if cc := aw.Header().Get("Cache-Control"); cc != "" {
+			attrs = append(attrs, slog.String("cache_control", cc))
+		}
+		attrs = append(attrs,
+			slog.String("client_ip", clientIP(r, cfg.TrustedProxies)),
+			slog.String("user_agent", r.UserAgent()),
+			slog.String("referer", r.Referer()),
+			slog.String("accept", r.Header.Get("Accept")),
+		)
+
+		for j, a := range attrs {
+			for _, key := range cfg.Redact {
+				if a.Key == key {
+					attrs[j].Value = slog.StringValue("REDACTED")
+				}
+			}
+		}
+
+		cfg.Logger.LogAttrs(r.Context(), cfg.Level, "gateway request", attrs...)
+	}
+}
+
+// setAccessLogRequest makes the access log record of the request, if any,
+// report the content of rq.
+func setAccessLogRequest(ctx context.Context, rq *requestData) {
+	if rec, ok := ctx.Value(accessLogKey{}).(*accessRecord); ok {
+		rec.rq = rq
+	}
+}
+
+// clientIP returns the IP address of the client, as forwarded by the trusted
+// reverse proxies if any. The X-Forwarded-For header is read from the end, as
+// its first addresses are set by the client.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		ip = addr
+		if !isTrustedProxy(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// isTrustedProxy returns whether ip is in one of the trusted networks.
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLogResponseWriter records the status and the size of the response.
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	started time.Time
+}
+
+func (w *accessLogResponseWriter) WriteHeader(code int) {
+	// Informational responses, such as 103 Early Hints, are followed by the
+	// actual one.
+	if w.status == 0 && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		w.status = code
+		w.started = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+		w.started = time.Now()
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows [http.ResponseController] to reach the underlying writer.
+func (w *accessLogResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
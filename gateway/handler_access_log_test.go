@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// chanWriter sends every write, that is every JSON record, to a channel.
+type chanWriter chan map[string]any
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	var record map[string]any
+	if err := json.Unmarshal(p, &record); err != nil {
+		return 0, err
+	}
+	c <- record
+	return len(p), nil
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(t *testing.T, cfg AccessLogConfig) (string, chanWriter) {
+		records := make(chanWriter, 10)
+		cfg.Logger = slog.New(slog.NewJSONHandler(records, nil))
+		backend, _, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			AccessLog:             &cfg,
+		})
+		return ts.URL + "/ipfs/" + root.String(), records
+	}
+
+	get := func(t *testing.T, url string) {
+		req := mustNewRequest(t, http.MethodGet, url, nil)
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("X-Forwarded-For", "192.0.2.1, 198.51.100.1")
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		_, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+	}
+
+	next := func(t *testing.T, records chanWriter) map[string]any {
+		select {
+		case record := <-records:
+			return record
+		case <-time.After(5 * time.Second):
+			t.Fatal("no access log record")
+			return nil
+		}
+	}
+
+	t.Run("Fields", func(t *testing.T) {
+		t.Parallel()
+
+		url, records := newServer(t, AccessLogConfig{Redact: []string{"client_ip"}})
+		get(t, url+"/subdir/fnord?format=raw")
+		record := next(t, records)
+
+		require.Equal(t, "gateway request", record["msg"])
+		require.Equal(t, "INFO", record["level"])
+		require.Equal(t, http.MethodGet, record["method"])
+		require.EqualValues(t, http.StatusOK, record["status"])
+		require.NotZero(t, record["bytes"])
+		require.Equal(t, rawResponseFormat, record["format"])
+		require.Contains(t, record["content_path"], "/subdir/fnord")
+		require.NotEmpty(t, record["cid"])
+		require.NotEmpty(t, record["cache_control"])
+		require.Equal(t, "test-agent", record["user_agent"])
+		require.Equal(t, "REDACTED", record["client_ip"])
+	})
+
+	t.Run("Sampling", func(t *testing.T) {
+		t.Parallel()
+
+		url, records := newServer(t, AccessLogConfig{SampleRate: 1e-9})
+		get(t, url+"/subdir/fnord")
+		get(t, url+"/not-found")
+
+		// Only the error is logged.
+		record := next(t, records)
+		require.EqualValues(t, http.StatusNotFound, record["status"])
+		require.Empty(t, records)
+	})
+
+	t.Run("Client IP", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tc := range []struct {
+			name    string
+			trusted []string
+			ip      string
+		}{
+			// X-Forwarded-For is ignored by default.
+			{"Untrusted", nil, "127.0.0.1"},
+			{"Trusted proxy", []string{"127.0.0.0/8"}, "198.51.100.1"},
+			{"Trusted proxies", []string{"127.0.0.0/8", "198.51.100.0/24"}, "192.0.2.1"},
+		} {
+			var trusted []netip.Prefix
+			for _, p := range tc.trusted {
+				trusted = append(trusted, netip.MustParsePrefix(p))
+			}
+			url, records := newServer(t, AccessLogConfig{TrustedProxies: trusted})
+			get(t, url+"/subdir/fnord")
+			require.Equal(t, tc.ip, next(t, records)["client_ip"], tc.name)
+		}
+	})
+}
@@ -14,8 +14,11 @@ func (i *handler) serveRawBlock(ctx context.Context, w http.ResponseWriter, r *h
 	ctx, span := spanTrace(ctx, "Handler.ServeRawBlock", trace.WithAttributes(attribute.String("path", rq.immutablePath.String())))
 	defer span.End()
 
-	pathMetadata, data, err := i.backend.GetBlock(ctx, rq.mostlyResolvedPath())
-	if !i.handleRequestErrors(w, r, rq.contentPath, err) {
+	resolveCtx, resolved, cancel := i.backendResolutionContext(ctx)
+	defer cancel()
+	pathMetadata, data, err := i.backend.GetBlock(resolveCtx, rq.mostlyResolvedPath())
+	resolved()
+	if !i.handleRequestErrors(w, r, rq.contentPath, withTimeoutCause(resolveCtx, err)) {
 		return false
 	}
 	defer data.Close()
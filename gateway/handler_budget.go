@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+// ErrRequestBudgetExceeded is returned with HTTP 413 when a request needs to
+// retrieve more blocks or bytes than allowed by its [RequestBudget].
+var ErrRequestBudgetExceeded = errors.New("request exceeds the retrieval budget of the gateway")
+
+// RequestBudget limits the blocks and bytes retrieved to serve a single
+// request, so that pathologically deep or large DAGs cannot monopolize a
+// shared gateway. Zero values mean no limit.
+type RequestBudget struct {
+	// MaxBlocks is the maximum number of blocks retrieved.
+	MaxBlocks int
+
+	// MaxBytes is the maximum size of the blocks retrieved, in bytes.
+	MaxBytes int64
+}
+
+func (b RequestBudget) isZero() bool {
+	return b.MaxBlocks <= 0 && b.MaxBytes <= 0
+}
+
+type budgetContextKey struct{}
+
+// budgetState accounts the blocks retrieved by a request with a budget.
+type budgetState struct {
+	budget   RequestBudget
+	blocks   atomic.Int64
+	bytes    atomic.Int64
+	exceeded atomic.Bool
+}
+
+// ContextWithRequestBudget returns a context for a request limited by
+// budget. The backends honoring it, such as [BlocksBackend] and [CarBackend],
+// account the blocks they retrieve for requests with this context, and return
+// [ErrRequestBudgetExceeded] once the budget is exhausted.
+func ContextWithRequestBudget(ctx context.Context, budget RequestBudget) context.Context {
+	if budget.isZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetContextKey{}, &budgetState{budget: budget})
+}
+
+func hasRequestBudget(ctx context.Context) bool {
+	_, ok := ctx.Value(budgetContextKey{}).(*budgetState)
+	return ok
+}
+
+// withoutRequestBudget returns a context whose retrievals are not accounted
+// to the budget of the request of ctx, if any.
+func withoutRequestBudget(ctx context.Context) context.Context {
+	if !hasRequestBudget(ctx) {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetContextKey{}, nil)
+}
+
+// spendBudget accounts blk to the budget of the request of ctx, if any, and
+// returns [ErrRequestBudgetExceeded] if it is exhausted.
+func spendBudget(ctx context.Context, blk blocks.Block) error {
+	s, ok := ctx.Value(budgetContextKey{}).(*budgetState)
+	if !ok {
+		return nil
+	}
+	n := s.blocks.Add(1)
+	size := s.bytes.Add(int64(len(blk.RawData())))
+	var err error
+	switch {
+	case s.budget.MaxBlocks > 0 && n > int64(s.budget.MaxBlocks):
+		err = fmt.Errorf("%w: the response needs more than %d blocks", ErrRequestBudgetExceeded, s.budget.MaxBlocks)
+	case s.budget.MaxBytes > 0 && size > s.budget.MaxBytes:
+		err = fmt.Errorf("%w: the response needs more than %d bytes of blocks", ErrRequestBudgetExceeded, s.budget.MaxBytes)
+	default:
+		return nil
+	}
+	s.exceeded.Store(true)
+	return err
+}
+
+// withBudgetCause adds [ErrRequestBudgetExceeded] to err if the request of
+// ctx exhausted its budget, so that the client gets 413 with the reason
+// rather than a generic error, such as a failure to fetch a node of a DAG.
+func withBudgetCause(ctx context.Context, err error) error {
+	s, ok := ctx.Value(budgetContextKey{}).(*budgetState)
+	if !ok || !s.exceeded.Load() || errors.Is(err, ErrRequestBudgetExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrRequestBudgetExceeded, err)
+}
+
+// requestBudget returns the budget of the responses to r in responseFormat,
+// see [Config.UnixFSBudget], [Config.CARBudget] and [Config.TarBudget]. The
+// budgets of the [PublicGateway] of the hostname of r take precedence.
+func (i *handler) requestBudget(r *http.Request, responseFormat string) RequestBudget {
+	var budget, gwBudget RequestBudget
+	gw, hasGateway := i.publicGatewayForRequest(r)
+	switch responseFormat {
+	case "", jsonResponseFormat, cborResponseFormat:
+		budget = i.config.UnixFSBudget
+		if hasGateway {
+			gwBudget = gw.UnixFSBudget
+		}
+	case carResponseFormat:
+		budget = i.config.CARBudget
+		if hasGateway {
+			gwBudget = gw.CARBudget
+		}
+	case tarResponseFormat:
+		budget = i.config.TarBudget
+		if hasGateway {
+			gwBudget = gw.TarBudget
+		}
+	}
+	if !gwBudget.isZero() {
+		return gwBudget
+	}
+	return budget
+}
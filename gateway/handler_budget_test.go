@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange"
+	"github.com/ipfs/boxo/exchange/offline"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBudget(t *testing.T) {
+	t.Parallel()
+
+	requireBudgetExceeded := func(t *testing.T, res *http.Response) {
+		t.Helper()
+		defer res.Body.Close()
+		require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), ErrRequestBudgetExceeded.Error())
+	}
+
+	t.Run("UnixFS", func(t *testing.T) {
+		t.Parallel()
+
+		backend, _, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			UnixFSBudget:          RequestBudget{MaxBlocks: 2},
+		})
+
+		// The file, and its parent directories, are retrieved from the
+		// exchange the first time, and from the blockstore the second time.
+		for i := 0; i < 2; i++ {
+			res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil))
+			requireBudgetExceeded(t, res)
+		}
+
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=raw", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode, "raw blocks have no budget")
+	})
+
+	t.Run("Other failures", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, root := newOfflineTestBackend(t)
+		backend, _, _ := newBlocksTestBackend(t, failingExchange{Interface: offline.Exchange(blockstore.NewBlockstore(datastore.NewMapDatastore()))})
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			UnixFSBudget:          RequestBudget{MaxBlocks: 2},
+		})
+
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadGateway, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NotContains(t, string(body), ErrRequestBudgetExceeded.Error())
+	})
+
+	t.Run("Within budget", func(t *testing.T) {
+		t.Parallel()
+
+		backend, _, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			UnixFSBudget:          RequestBudget{MaxBlocks: 10, MaxBytes: 1 << 20},
+		})
+
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("Public gateway", func(t *testing.T) {
+		t.Parallel()
+
+		backend, _, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			PublicGateways: map[string]*PublicGateway{
+				"limited.example.com": {
+					Paths:                 []string{"/ipfs"},
+					DeserializedResponses: true,
+					UnixFSBudget:          RequestBudget{MaxBlocks: 2},
+				},
+			},
+		})
+
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil)
+		req.Host = "limited.example.com"
+		requireBudgetExceeded(t, mustDo(t, req))
+
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode, "other hostnames have no budget")
+	})
+
+	t.Run("TAR", func(t *testing.T) {
+		t.Parallel()
+
+		backend, _, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			TarBudget:             RequestBudget{MaxBytes: 1},
+		})
+
+		requireBudgetExceeded(t, mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=tar", nil)))
+	})
+
+	t.Run("CAR", func(t *testing.T) {
+		t.Parallel()
+
+		backend, _, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			CARBudget: RequestBudget{MaxBlocks: 1},
+		})
+
+		// The response starts with the first block, and is then aborted.
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=car", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		br, err := carv2.NewBlockReader(res.Body)
+		require.NoError(t, err)
+		_, err = br.Next()
+		require.NoError(t, err)
+		_, err = br.Next()
+		require.Error(t, err)
+	})
+}
+
+// failingExchange fails to fetch the blocks, like a backend whose remote
+// gateway fails.
+type failingExchange struct {
+	exchange.Interface
+}
+
+var errFetchFailed = fmt.Errorf("%w: fetch failed", ErrBadGateway)
+
+func (failingExchange) GetBlock(context.Context, cid.Cid) (blocks.Block, error) {
+	return nil, errFetchFailed
+}
+
+func (failingExchange) GetBlocks(context.Context, []cid.Cid) (<-chan blocks.Block, error) {
+	return nil, errFetchFailed
+}
@@ -26,6 +26,7 @@ const (
 	carVersionKey             = "car-version"
 	carDuplicatesKey          = "car-dups"
 	carOrderKey               = "car-order"
+	carPartialKey             = "car-partial"
 )
 
 // serveCAR returns a CAR stream for specific DAG+selector
@@ -64,24 +65,64 @@ func (i *handler) serveCAR(ctx context.Context, w http.ResponseWriter, r *http.R
 	// Set Cache-Control (same logic as for a regular files)
 	addCacheControlHeaders(w, r, rq.contentPath, rq.ttl, rq.lastMod, rootCid, carResponseFormat)
 
-	// Generate the CAR Etag.
-	etag := getCarEtag(rq.immutablePath, params, rootCid)
-	w.Header().Set("Etag", etag)
-
-	// Terminate early if Etag matches. We cannot rely on handleIfNoneMatch since
-	// since it does not contain the parameters information we retrieve here.
-	if etagMatch(r.Header.Get("If-None-Match"), etag) {
-		w.WriteHeader(http.StatusNotModified)
+	// Generate the CAR Etag, and terminate early if it matches. We cannot rely
+	// on handleIfNoneMatch since it does not contain the parameters
+	// information we retrieve here.
+	notModified := func() bool {
+		etag := getCarEtag(rq.immutablePath, params, rootCid)
+		w.Header().Set("Etag", etag)
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if notModified() {
 		return false
 	}
 
-	md, carFile, err := i.backend.GetCAR(ctx, rq.immutablePath, params)
-	if !i.handleRequestErrors(w, r, rq.contentPath, err) {
+	// Report the DAG size for HEAD and ?dag-stats requests, if supported.
+	i.addDagStatsHeaders(w, r, rq)
+
+	var (
+		md         ContentPathMetadata
+		carFile    io.ReadCloser
+		partialCAR PartialCAR
+	)
+	ctx, resolved, cancel := i.backendResolutionContext(ctx)
+	defer cancel()
+	if params.AllowPartial {
+		err = errors.ErrUnsupported
+		if backend, ok := i.backend.(WithPartialCAR); ok {
+			md, partialCAR, err = backend.GetPartialCAR(ctx, rq.immutablePath, params)
+			carFile = partialCAR
+		}
+		if errors.Is(err, errors.ErrUnsupported) {
+			// The backend only serves complete DAGs, which the response
+			// declares by not having the partial parameter.
+			params.AllowPartial = false
+			if notModified() {
+				return false
+			}
+		}
+	}
+	if !params.AllowPartial {
+		md, carFile, err = i.backend.GetCAR(ctx, rq.immutablePath, params)
+	}
+	resolved()
+	if !i.handleRequestErrors(w, r, rq.contentPath, withTimeoutCause(ctx, err)) {
 		return false
 	}
 	defer carFile.Close()
 	setIpfsRootsHeader(w, rq, &md)
 
+	if partialCAR != nil {
+		// The blocks available may change, so partial CARs are not cached.
+		// Whether the DAG was complete is only known once it is streamed.
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Trailer", "X-Ipfs-DagComplete, X-Ipfs-DagMissingBlocks, X-Stream-Error")
+	}
+
 	// Make it clear we don't support range-requests over a car stream
 	// Partial downloads and resumes should be handled using requests for
 	// sub-DAGs and IPLD selectors: https://github.com/ipfs/go-ipfs/issues/8769
@@ -105,6 +146,12 @@ func (i *handler) serveCAR(ctx context.Context, w http.ResponseWriter, r *http.R
 		return false
 	}
 
+	if partialCAR != nil {
+		missing := len(partialCAR.MissingBlocks())
+		w.Header().Set("X-Ipfs-DagComplete", strconv.FormatBool(missing == 0))
+		w.Header().Set("X-Ipfs-DagMissingBlocks", strconv.Itoa(missing))
+	}
+
 	// Update metrics
 	i.carStreamGetMetric.WithLabelValues(rq.contentPath.Namespace()).Observe(time.Since(rq.begin).Seconds())
 	return true
@@ -152,6 +199,7 @@ func buildCarParams(r *http.Request, contentTypeParams map[string]string) (CarPa
 	versionStr := queryParams.Get(carVersionKey)
 	duplicatesStr := queryParams.Get(carDuplicatesKey)
 	orderStr := queryParams.Get(carOrderKey)
+	partialStr := queryParams.Get(carPartialKey)
 	if v, ok := contentTypeParams["version"]; ok {
 		versionStr = v
 	}
@@ -161,6 +209,9 @@ func buildCarParams(r *http.Request, contentTypeParams map[string]string) (CarPa
 	if v, ok := contentTypeParams["dups"]; ok {
 		duplicatesStr = v
 	}
+	if v, ok := contentTypeParams["partial"]; ok {
+		partialStr = v
+	}
 
 	// version of CAR format
 	switch versionStr {
@@ -199,6 +250,16 @@ func buildCarParams(r *http.Request, contentTypeParams map[string]string) (CarPa
 	}
 	params.Duplicates = dups
 
+	// optional partial, allowing the backends to return the blocks they have
+	// of incomplete DAGs
+	switch partialStr {
+	case "y":
+		params.AllowPartial = true
+	case "n", "":
+	default:
+		return CarParams{}, fmt.Errorf("unsupported application/vnd.ipld.car content type partial parameter: %q", partialStr)
+	}
+
 	return params, nil
 }
 
@@ -219,6 +280,10 @@ func buildContentTypeFromCarParams(params CarParams) string {
 		h.WriteString(params.Duplicates.String())
 	}
 
+	if params.AllowPartial {
+		h.WriteString("; partial=y")
+	}
+
 	return h.String()
 }
 
@@ -268,6 +333,12 @@ func getCarEtag(imPath path.ImmutablePath, params CarParams, rootCid cid.Cid) st
 		h.WriteString("\x00dups=y")
 	}
 
+	// 'partial' impacts Etag only if allowed, since complete DAGs are the
+	// default
+	if params.AllowPartial {
+		h.WriteString("\x00partial=y")
+	}
+
 	if params.Range != nil {
 		if params.Range.From != 0 || params.Range.To != nil {
 			h.WriteString("\x00range=")
@@ -1,12 +1,25 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
 	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -198,3 +211,288 @@ func TestGetCarEtag(t *testing.T) {
 		require.NotEqual(t, a, b)
 	})
 }
+
+func TestCarOrderDuplicatesAndEntityBytes(t *testing.T) {
+	t.Parallel()
+
+	// A directory linking twice to a file made of 16 identical chunks and a
+	// different last one.
+	ctx := context.Background()
+	backend, _, dag := newBlocksTestBackend(t, nil)
+	content := append(bytes.Repeat([]byte("0123456789abcdef"), 16), "last chunk......"...)
+	file, err := importer.BuildDagFromReader(dag, chunker.NewSizeSplitter(bytes.NewReader(content), 16))
+	require.NoError(t, err)
+	dir := unixfs.EmptyDirNode()
+	require.NoError(t, dir.AddNodeLink("a", file))
+	require.NoError(t, dir.AddNodeLink("b", file))
+	require.NoError(t, dag.Add(ctx, dir))
+
+	names := map[cid.Cid]string{
+		dir.Cid():            "dir",
+		file.Cid():           "file",
+		file.Links()[0].Cid:  "chunk",
+		file.Links()[16].Cid: "last",
+	}
+
+	ts := newTestServer(t, backend)
+
+	getCar := func(t *testing.T, p, accept string) (string, []string) {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+p, nil)
+		req.Header.Set("Accept", accept)
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Empty(t, res.Trailer.Get("X-Stream-Error"))
+
+		br, err := carv2.NewBlockReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		var blocks []string
+		for {
+			blk, err := br.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			blocks = append(blocks, names[blk.Cid()])
+		}
+		return res.Header.Get("Content-Type"), blocks
+	}
+
+	repeat := func(s string, n int) []string {
+		r := make([]string, n)
+		for i := range r {
+			r[i] = s
+		}
+		return r
+	}
+	fileBlocks := append(append([]string{"file"}, repeat("chunk", 16)...), "last")
+	root := "/ipfs/" + dir.Cid().String()
+
+	t.Run("Duplicates in DFS order", func(t *testing.T) {
+		t.Parallel()
+
+		ctype, blocks := getCar(t, root, "application/vnd.ipld.car; order=dfs; dups=y")
+		require.Equal(t, "application/vnd.ipld.car; version=1; order=dfs; dups=y", ctype)
+		require.Equal(t, append(append([]string{"dir"}, fileBlocks...), fileBlocks...), blocks)
+
+		_, blocks = getCar(t, root+"?format=car&car-dups=y&car-order=dfs", "")
+		require.Equal(t, append(append([]string{"dir"}, fileBlocks...), fileBlocks...), blocks)
+	})
+
+	t.Run("No duplicates", func(t *testing.T) {
+		t.Parallel()
+
+		ctype, blocks := getCar(t, root, "application/vnd.ipld.car; dups=n")
+		require.Equal(t, "application/vnd.ipld.car; version=1; order=dfs; dups=n", ctype)
+		require.Equal(t, []string{"dir", "file", "chunk", "last"}, blocks)
+
+		_, blocks = getCar(t, root+"/a?format=car&dag-scope=entity", "")
+		require.Equal(t, []string{"dir", "file", "chunk", "last"}, blocks)
+	})
+
+	for _, tc := range []struct {
+		entityBytes string
+		dups        string
+		blocks      []string
+	}{
+		{"16:47", "y", []string{"dir", "file", "chunk", "chunk"}},
+		{"16:47", "n", []string{"dir", "file", "chunk"}},
+		{"-16:*", "y", []string{"dir", "file", "last"}},
+		{"250:-1", "y", []string{"dir", "file", "chunk", "last"}},
+		{"260:1000", "y", []string{"dir", "file", "last"}},
+		{"1000:*", "y", []string{"dir", "file"}},
+		{"100:-200", "y", []string{"dir", "file"}},
+	} {
+		tc := tc
+		t.Run(fmt.Sprintf("entity-bytes=%s dups=%s", tc.entityBytes, tc.dups), func(t *testing.T) {
+			t.Parallel()
+
+			query := "?format=car&dag-scope=entity&entity-bytes=" + tc.entityBytes + "&car-dups=" + tc.dups
+			_, blocks := getCar(t, root+"/a"+query, "")
+			require.Equal(t, tc.blocks, blocks)
+
+			// The stream ends without error, which HTTP clients cannot see.
+			params, err := buildCarParams(mustNewRequest(t, http.MethodGet, ts.URL+root+"/a"+query, nil), nil)
+			require.NoError(t, err)
+			p, err := path.NewPath(root + "/a")
+			require.NoError(t, err)
+			imPath, err := path.NewImmutablePath(p)
+			require.NoError(t, err)
+			_, car, err := backend.GetCAR(ctx, imPath, params)
+			require.NoError(t, err)
+			defer car.Close()
+			_, err = io.ReadAll(car)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPartialCAR(t *testing.T) {
+	t.Parallel()
+
+	// A directory with a file made of three chunks, the second of which is
+	// missing, and a complete single block file.
+	ctx := context.Background()
+	backend, bs, dag := newBlocksTestBackend(t, nil)
+	content := []byte("first chunk.....second chunk....third chunk.....")
+	file, err := importer.BuildDagFromReader(dag, chunker.NewSizeSplitter(bytes.NewReader(content), 16))
+	require.NoError(t, err)
+	require.Len(t, file.Links(), 3)
+	small := merkledag.NewRawNode([]byte("small"))
+	require.NoError(t, dag.Add(ctx, small))
+	dir := unixfs.EmptyDirNode()
+	require.NoError(t, dir.AddNodeLink("a", file))
+	require.NoError(t, dir.AddNodeLink("b", small))
+	require.NoError(t, dag.Add(ctx, dir))
+	require.NoError(t, bs.DeleteBlock(ctx, file.Links()[1].Cid))
+
+	names := map[cid.Cid]string{
+		dir.Cid():           "dir",
+		file.Cid():          "file",
+		file.Links()[0].Cid: "first",
+		file.Links()[2].Cid: "third",
+		small.Cid():         "small",
+	}
+
+	root := "/ipfs/" + dir.Cid().String()
+
+	getCar := func(t *testing.T, ts *httptest.Server, p, accept string) (*http.Response, []string) {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+p, nil)
+		req.Header.Set("Accept", accept)
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		br, err := carv2.NewBlockReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		var blocks []string
+		for {
+			blk, err := br.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			blocks = append(blocks, names[blk.Cid()])
+		}
+		return res, blocks
+	}
+
+	t.Run("Missing blocks are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		res, blocks := getCar(t, ts, root+"?format=car&car-partial=y", "")
+		require.Equal(t, "application/vnd.ipld.car; version=1; order=dfs; dups=n; partial=y", res.Header.Get("Content-Type"))
+		require.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+		require.Equal(t, []string{"dir", "file", "first", "third", "small"}, blocks)
+		require.Equal(t, "false", res.Trailer.Get("X-Ipfs-DagComplete"))
+		require.Equal(t, "1", res.Trailer.Get("X-Ipfs-DagMissingBlocks"))
+		require.Empty(t, res.Trailer.Get("X-Stream-Error"))
+	})
+
+	t.Run("File range ends at the missing block", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		res, blocks := getCar(t, ts, root+"/a?dag-scope=entity", "application/vnd.ipld.car; partial=y")
+		require.Equal(t, []string{"dir", "file", "first"}, blocks)
+		require.Equal(t, "false", res.Trailer.Get("X-Ipfs-DagComplete"))
+		require.Equal(t, "1", res.Trailer.Get("X-Ipfs-DagMissingBlocks"))
+		require.Empty(t, res.Trailer.Get("X-Stream-Error"))
+	})
+
+	t.Run("Complete DAG", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		res, blocks := getCar(t, ts, root+"/b", "application/vnd.ipld.car; partial=y")
+		require.Equal(t, []string{"dir", "small"}, blocks)
+		require.Equal(t, "true", res.Trailer.Get("X-Ipfs-DagComplete"))
+		require.Equal(t, "0", res.Trailer.Get("X-Ipfs-DagMissingBlocks"))
+	})
+
+	t.Run("Backend without partial CARs", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, struct{ IPFSBackend }{backend})
+		res, blocks := getCar(t, ts, root+"/b", "application/vnd.ipld.car; partial=y")
+		require.Equal(t, "application/vnd.ipld.car; version=1; order=dfs; dups=n", res.Header.Get("Content-Type"))
+		require.NotEqual(t, "no-store", res.Header.Get("Cache-Control"))
+		require.Equal(t, []string{"dir", "small"}, blocks)
+		require.Empty(t, res.Trailer.Get("X-Ipfs-DagComplete"))
+	})
+
+	t.Run("Invalid partial parameter", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := buildCarParams(mustNewRequest(t, http.MethodGet, "http://example.com/?car-partial=maybe", nil), nil)
+		require.Error(t, err)
+	})
+}
+
+func TestCarEntityBytesIntermediateNodes(t *testing.T) {
+	t.Parallel()
+
+	// A file of 8 distinct chunks, in a balanced tree of 2 links per node.
+	backend, _, dag := newBlocksTestBackend(t, nil)
+	var content []byte
+	for i := 0; i < 8; i++ {
+		content = append(content, fmt.Sprintf("chunk %d.........", i)...)
+	}
+	dbp := helpers.DagBuilderParams{Dagserv: dag, Maxlinks: 2}
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(content), 16))
+	require.NoError(t, err)
+	file, err := balanced.Layout(db)
+	require.NoError(t, err)
+
+	// The blocks are named by the indexes of the links from the root.
+	names := map[cid.Cid]string{}
+	var register func(nd ipld.Node, name string)
+	register = func(nd ipld.Node, name string) {
+		names[nd.Cid()] = name
+		for i, l := range nd.Links() {
+			child, err := l.GetNode(context.Background(), dag)
+			require.NoError(t, err)
+			register(child, fmt.Sprint(name, i))
+		}
+	}
+	register(file, "r")
+
+	ts := newTestServer(t, backend)
+
+	for _, tc := range []struct {
+		entityBytes string
+		blocks      []string
+	}{
+		{"32:47", []string{"r", "r0", "r01", "r010"}},
+		{"48:79", []string{"r", "r0", "r01", "r011", "r1", "r10", "r100"}},
+		{"-16:*", []string{"r", "r1", "r11", "r111"}},
+		{"0:*", []string{"r", "r0", "r00", "r000", "r001", "r01", "r010", "r011", "r1", "r10", "r100", "r101", "r11", "r110", "r111"}},
+	} {
+		tc := tc
+		t.Run("entity-bytes="+tc.entityBytes, func(t *testing.T) {
+			t.Parallel()
+
+			res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+file.Cid().String()+"?format=car&dag-scope=entity&entity-bytes="+tc.entityBytes, nil))
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			br, err := carv2.NewBlockReader(res.Body)
+			require.NoError(t, err)
+			var blocks []string
+			for {
+				blk, err := br.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				blocks = append(blocks, names[blk.Cid()])
+			}
+			require.Equal(t, tc.blocks, blocks)
+		})
+	}
+}
@@ -62,8 +62,11 @@ func (i *handler) serveCodec(ctx context.Context, w http.ResponseWriter, r *http
 	ctx, span := spanTrace(ctx, "Handler.ServeCodec", trace.WithAttributes(attribute.String("path", rq.immutablePath.String()), attribute.String("requestedContentType", rq.responseFormat)))
 	defer span.End()
 
-	pathMetadata, data, err := i.backend.GetBlock(ctx, rq.mostlyResolvedPath())
-	if !i.handleRequestErrors(w, r, rq.contentPath, err) {
+	resolveCtx, resolved, cancel := i.backendResolutionContext(ctx)
+	defer cancel()
+	pathMetadata, data, err := i.backend.GetBlock(resolveCtx, rq.mostlyResolvedPath())
+	resolved()
+	if !i.handleRequestErrors(w, r, rq.contentPath, withTimeoutCause(resolveCtx, err)) {
 		return false
 	}
 	defer data.Close()
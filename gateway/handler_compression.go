@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressibleContentTypes are the media types compressed by default
+// when [Config.Compression] is set. Entries ending with a slash match every
+// subtype.
+var DefaultCompressibleContentTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/ld+json",
+	"application/manifest+json",
+	"application/wasm",
+	"application/xhtml+xml",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// DefaultCompressionMinSize is the size, in bytes, under which files are not
+// compressed when [CompressionConfig.MinSize] is 0.
+const DefaultCompressionMinSize = 1024
+
+// CompressionConfig configures the compression of the UnixFS file responses
+// of the gateway, see [Config.Compression].
+type CompressionConfig struct {
+	// ContentTypes are the media types of the files that are compressed.
+	// Entries ending with a slash, such as "text/", match every subtype.
+	// Defaults to [DefaultCompressibleContentTypes]. Already compressed
+	// media, such as images, videos or archives, should not be listed.
+	ContentTypes []string
+
+	// MinSize is the size, in bytes, under which files are sent
+	// uncompressed. Defaults to [DefaultCompressionMinSize].
+	MinSize int64
+}
+
+// Content codings supported by the gateway, in order of preference.
+var contentEncodings = []string{"zstd", "br", "gzip"}
+
+// contentEncodingEtagSuffixes are the suffixes added to the ETags of the
+// responses compressed with each content coding.
+var contentEncodingEtagSuffixes = map[string]string{
+	"zstd": "zst",
+	"br":   "br",
+	"gzip": "gz",
+}
+
+// negotiateContentEncoding returns the content coding with which the file
+// response to r, of the given content type and size, is compressed, or "" if
+// it is sent as is. Only the complete files returned to GET requests are
+// compressed, so that ranges and sizes keep referring to the file.
+func (i *handler) negotiateContentEncoding(r *http.Request, ctype string, size int64) string {
+	cfg := i.config.Compression
+	if cfg == nil || r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+		return ""
+	}
+
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	if size < minSize {
+		return ""
+	}
+
+	contentTypes := cfg.ContentTypes
+	if contentTypes == nil {
+		contentTypes = DefaultCompressibleContentTypes
+	}
+	if !isCompressibleContentType(ctype, contentTypes) {
+		return ""
+	}
+
+	return selectContentEncoding(r.Header.Get("Accept-Encoding"))
+}
+
+// isCompressibleContentType returns whether ctype is one of contentTypes.
+func isCompressibleContentType(ctype string, contentTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	for _, ct := range contentTypes {
+		ct = strings.ToLower(ct)
+		if mediaType == ct || (strings.HasSuffix(ct, "/") && strings.HasPrefix(mediaType, ct)) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectContentEncoding returns the supported content coding with the
+// highest quality in the given Accept-Encoding header, or "" if none is
+// accepted.
+func selectContentEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, spec := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(spec, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				continue
+			}
+		}
+		if coding == "*" {
+			wildcard = q
+		} else {
+			qualities[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range contentEncodings {
+		q, ok := qualities[enc]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// getCompressedEtag returns the ETag of the response with the given ETag,
+// compressed with the given content coding. It is weak, as the compressed
+// bytes may change with the implementation of the compressor.
+func getCompressedEtag(etag, encoding string) string {
+	if etag == "" {
+		return ""
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	return `W/` + strings.TrimSuffix(etag, `"`) + `.` + contentEncodingEtagSuffixes[encoding] + `"`
+}
+
+// compressedResponseWriter compresses the body of the response with a content
+// coding. The encoder is only created once the body is written to, so that no
+// body is sent along with responses such as 304 Not Modified. Close must be
+// called once the response is complete.
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	enc      io.WriteCloser
+	err      error
+}
+
+func newCompressedResponseWriter(w http.ResponseWriter, encoding string) *compressedResponseWriter {
+	return &compressedResponseWriter{ResponseWriter: w, encoding: encoding}
+}
+
+func (w *compressedResponseWriter) WriteHeader(code int) {
+	// The length of the compressed body is not known in advance.
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressedResponseWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.enc == nil {
+		w.Header().Del("Content-Length")
+		switch w.encoding {
+		case "zstd":
+			w.enc, w.err = zstd.NewWriter(w.ResponseWriter, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(8<<20))
+		case "br":
+			w.enc = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		default:
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		}
+		if w.err != nil {
+			return 0, w.err
+		}
+	}
+	return w.enc.Write(p)
+}
+
+// Close flushes the compressed body, if any.
+func (w *compressedResponseWriter) Close() error {
+	if w.enc == nil {
+		return w.err
+	}
+	return w.enc.Close()
+}
+
+func (w *compressedResponseWriter) Flush() {
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows [http.ResponseController] to reach the underlying writer.
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
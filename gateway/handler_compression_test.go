@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/unixfs/importer"
+	"github.com/ipfs/go-cid"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectContentEncoding(t *testing.T) {
+	t.Parallel()
+
+	for header, expected := range map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"br":                       "br",
+		"gzip":                     "gzip",
+		"gzip, deflate, br, zstd":  "zstd",
+		"gzip, br":                 "br",
+		"br;q=0.5, gzip":           "gzip",
+		"zstd;q=0.5, gzip":         "gzip",
+		"zstd;q=0, gzip;q=0.1":     "gzip",
+		"*":                        "zstd",
+		"*;q=0.5, zstd;q=0, GZIP":  "gzip",
+		"gzip;q=0, zstd;q=invalid": "",
+	} {
+		require.Equal(t, expected, selectContentEncoding(header), header)
+	}
+
+	require.True(t, isCompressibleContentType("text/plain; charset=utf-8", DefaultCompressibleContentTypes))
+	require.True(t, isCompressibleContentType("image/svg+xml", DefaultCompressibleContentTypes))
+	require.False(t, isCompressibleContentType("image/png", DefaultCompressibleContentTypes))
+	require.False(t, isCompressibleContentType("application/gzip", DefaultCompressibleContentTypes))
+}
+
+func newCompressionTestBackend(t *testing.T, files ...[]byte) (*BlocksBackend, []cid.Cid) {
+	backend, _, dag := newBlocksTestBackend(t, nil)
+	var roots []cid.Cid
+	for _, file := range files {
+		nd, err := importer.BuildDagFromReader(dag, chunker.NewSizeSplitter(bytes.NewReader(file), 1024))
+		require.NoError(t, err)
+		roots = append(roots, nd.Cid())
+	}
+	return backend, roots
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	text := []byte(strings.Repeat("Hello, compressed IPFS gateway!\n", 256))
+	binary := make([]byte, 4096)
+	_, err := rand.Read(binary)
+	require.NoError(t, err)
+	small := []byte("Hello, small file!\n")
+
+	backend, roots := newCompressionTestBackend(t, text, binary, small)
+	textURL := "/ipfs/" + roots[0].String() + "?filename=hello.txt"
+	binaryURL := "/ipfs/" + roots[1].String()
+	smallURL := "/ipfs/" + roots[2].String() + "?filename=small.txt"
+
+	get := func(t *testing.T, ts string, url string, headers map[string]string) (*http.Response, []byte) {
+		req := mustNewRequest(t, http.MethodGet, ts+url, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, backend, Config{DeserializedResponses: true})
+		res, body := get(t, ts.URL, textURL, map[string]string{"Accept-Encoding": "gzip"})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Empty(t, res.Header.Get("Content-Encoding"))
+		require.Empty(t, res.Header.Get("Vary"))
+		require.Equal(t, text, body)
+	})
+
+	ts := newTestServerWithConfig(t, backend, Config{DeserializedResponses: true, Compression: &CompressionConfig{}})
+
+	t.Run("gzip", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := get(t, ts.URL, textURL, map[string]string{"Accept-Encoding": "gzip, deflate"})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+		require.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+		require.Equal(t, `W/"`+roots[0].String()+`.gz"`, res.Header.Get("Etag"))
+		require.Less(t, len(body), len(text))
+
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		require.Equal(t, text, decoded)
+
+		// The compressed ETag is matched by If-None-Match.
+		res, body = get(t, ts.URL, textURL, map[string]string{"Accept-Encoding": "gzip", "If-None-Match": res.Header.Get("Etag")})
+		require.Equal(t, http.StatusNotModified, res.StatusCode)
+		require.Empty(t, body)
+	})
+
+	t.Run("br", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := get(t, ts.URL, textURL, map[string]string{"Accept-Encoding": "gzip, br"})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "br", res.Header.Get("Content-Encoding"))
+		require.Equal(t, `W/"`+roots[0].String()+`.br"`, res.Header.Get("Etag"))
+		require.Less(t, len(body), len(text))
+
+		decoded, err := io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+		require.NoError(t, err)
+		require.Equal(t, text, decoded)
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		t.Parallel()
+
+		res, body := get(t, ts.URL, textURL, map[string]string{"Accept-Encoding": "gzip, zstd"})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "zstd", res.Header.Get("Content-Encoding"))
+		require.Equal(t, `W/"`+roots[0].String()+`.zst"`, res.Header.Get("Etag"))
+
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		defer zr.Close()
+		decoded, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		require.Equal(t, text, decoded)
+	})
+
+	t.Run("Uncompressed", func(t *testing.T) {
+		t.Parallel()
+
+		for name, tc := range map[string]struct {
+			url     string
+			headers map[string]string
+			status  int
+			body    []byte
+		}{
+			"Not accepted":      {textURL, map[string]string{"Accept-Encoding": "identity"}, http.StatusOK, text},
+			"Not compressible":  {binaryURL, map[string]string{"Accept-Encoding": "gzip"}, http.StatusOK, binary},
+			"Too small":         {smallURL, map[string]string{"Accept-Encoding": "gzip"}, http.StatusOK, small},
+			"Range":             {textURL, map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-4"}, http.StatusPartialContent, text[:5]},
+			"Uncompressed ETag": {textURL, map[string]string{"Accept-Encoding": "identity", "If-None-Match": `"` + roots[0].String() + `"`}, http.StatusNotModified, nil},
+			// Compressed ETags only match responses that would be compressed.
+			"Compressed ETag, not accepted":     {textURL, map[string]string{"Accept-Encoding": "identity", "If-None-Match": `W/"` + roots[0].String() + `.gz"`}, http.StatusOK, text},
+			"Compressed ETag, not compressible": {binaryURL, map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `W/"` + roots[1].String() + `.gz"`}, http.StatusOK, binary},
+		} {
+			res, body := get(t, ts.URL, tc.url, tc.headers)
+			require.Equal(t, tc.status, res.StatusCode, name)
+			require.Empty(t, res.Header.Get("Content-Encoding"), name)
+			if tc.body != nil {
+				require.Equal(t, "Accept-Encoding", res.Header.Get("Vary"), name)
+				require.Equal(t, tc.body, body, name)
+			}
+		}
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			Compression:           &CompressionConfig{ContentTypes: []string{"application/json"}},
+		})
+		res, body := get(t, ts.URL, textURL, map[string]string{"Accept-Encoding": "gzip"})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Empty(t, res.Header.Get("Content-Encoding"))
+		require.Equal(t, text, body)
+	})
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// DefaultDagStatsMaxBlocks is the default value of [Config.DagStatsMaxBlocks].
+const DefaultDagStatsMaxBlocks = 1024
+
+const dagStatsQueryParam = "dag-stats"
+
+// addDagStatsHeaders sets the X-Ipfs-DagSize and X-Ipfs-DagBlockCount headers
+// for HEAD requests, and for any request with the ?dag-stats query parameter.
+// HEAD requests without ?dag-stats only read the root block of the DAG, while
+// ?dag-stats triggers a walk bounded by [Config.DagStatsMaxBlocks].
+//
+// It is called once the conditional requests are known not to be answered
+// with 304 Not Modified, and the blocks it reads are not accounted to the
+// budget of the request. The headers are a best-effort hint: any error is
+// logged and the response is served without them.
+func (i *handler) addDagStatsHeaders(w http.ResponseWriter, r *http.Request, rq *requestData) {
+	walk := r.URL.Query().Has(dagStatsQueryParam)
+	if r.Method != http.MethodHead && !walk {
+		return
+	}
+
+	backend, ok := i.backend.(WithDagStats)
+	if !ok {
+		return
+	}
+
+	maxBlocks := 0
+	if walk {
+		maxBlocks = i.config.DagStatsMaxBlocks
+		if maxBlocks <= 0 {
+			maxBlocks = DefaultDagStatsMaxBlocks
+		}
+	}
+
+	stats, err := backend.DagStats(withoutRequestBudget(r.Context()), rq.mostlyResolvedPath(), maxBlocks)
+	if err != nil {
+		if !errors.Is(err, errors.ErrUnsupported) {
+			rq.logger.Debugw("could not compute dag stats", "path", rq.contentPath, "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("X-Ipfs-DagSize", strconv.FormatUint(stats.Size, 10))
+	if stats.Blocks > 0 {
+		w.Header().Set("X-Ipfs-DagBlockCount", strconv.FormatUint(stats.Blocks, 10))
+	}
+	if stats.Complete {
+		w.Header().Set("X-Ipfs-DagStats", "exact")
+	} else {
+		w.Header().Set("X-Ipfs-DagStats", "estimated")
+	}
+}
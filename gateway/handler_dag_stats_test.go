@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	carblockstore "github.com/ipld/go-car/v2/blockstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDagStats(t *testing.T) {
+	t.Parallel()
+
+	const fixture = "directory-with-multilayer-hamt-and-multiblock-files.car"
+
+	// All the blocks in the fixture belong to the DAG of its root.
+	f, err := os.Open(filepath.Join("./testdata", fixture))
+	require.NoError(t, err)
+	defer f.Close()
+	bs, err := carblockstore.NewReadOnly(f, nil)
+	require.NoError(t, err)
+	defer bs.Close()
+	keys, err := bs.AllKeysChan(context.Background())
+	require.NoError(t, err)
+	var expectedBlocks, expectedSize uint64
+	for k := range keys {
+		blk, err := bs.Get(context.Background(), k)
+		require.NoError(t, err)
+		expectedBlocks++
+		expectedSize += uint64(len(blk.RawData()))
+	}
+
+	backend, root := newMockBackend(t, fixture)
+
+	t.Run("HEAD only reads the root block", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		req := mustNewRequest(t, http.MethodHead, ts.URL+"/ipfs/"+root.String()+"/", nil)
+		res := mustDoWithoutRedirect(t, req)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		size, err := strconv.ParseUint(res.Header.Get("X-Ipfs-DagSize"), 10, 64)
+		require.NoError(t, err)
+		require.NotZero(t, size)
+		require.Empty(t, res.Header.Get("X-Ipfs-DagBlockCount"))
+		require.Equal(t, "estimated", res.Header.Get("X-Ipfs-DagStats"))
+	})
+
+	t.Run("GET with ?dag-stats walks the DAG", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/?dag-stats", nil)
+		res := mustDoWithoutRedirect(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		require.Equal(t, strconv.FormatUint(expectedSize, 10), res.Header.Get("X-Ipfs-DagSize"))
+		require.Equal(t, strconv.FormatUint(expectedBlocks, 10), res.Header.Get("X-Ipfs-DagBlockCount"))
+		require.Equal(t, "exact", res.Header.Get("X-Ipfs-DagStats"))
+	})
+
+	t.Run("Walk is bounded by DagStatsMaxBlocks", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, backend, Config{
+			DeserializedResponses: true,
+			DagStatsMaxBlocks:     2,
+		})
+		req := mustNewRequest(t, http.MethodHead, ts.URL+"/ipfs/"+root.String()+"/?dag-stats", nil)
+		res := mustDoWithoutRedirect(t, req)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		require.Equal(t, "estimated", res.Header.Get("X-Ipfs-DagStats"))
+		blocks, err := strconv.ParseUint(res.Header.Get("X-Ipfs-DagBlockCount"), 10, 64)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, blocks, uint64(2))
+	})
+
+	t.Run("Not computed for 304 Not Modified", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		req := mustNewRequest(t, http.MethodHead, ts.URL+"/ipfs/"+root.String()+"?format=raw", nil)
+		req.Header.Set("If-None-Match", `"`+root.String()+`.raw"`)
+		res := mustDoWithoutRedirect(t, req)
+		require.Equal(t, http.StatusNotModified, res.StatusCode)
+		require.Empty(t, res.Header.Get("X-Ipfs-DagSize"))
+	})
+
+	t.Run("Headers are not set on plain GET", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServer(t, backend)
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/", nil)
+		res := mustDoWithoutRedirect(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Empty(t, res.Header.Get("X-Ipfs-DagSize"))
+	})
+}
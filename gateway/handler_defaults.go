@@ -28,9 +28,13 @@ func (i *handler) serveDefaults(ctx context.Context, w http.ResponseWriter, r *h
 		getResp      *GetResponse
 	)
 
+	ctx, resolved, cancel := i.backendResolutionContext(ctx)
+	defer cancel()
+
 	switch r.Method {
 	case http.MethodHead:
 		pathMetadata, headResp, err = i.backend.Head(ctx, rq.mostlyResolvedPath())
+		err = withTimeoutCause(ctx, err)
 		if err != nil {
 			if isWebRequest(rq.responseFormat) {
 				forwardedPath, continueProcessing := i.handleWebRequestErrors(w, r, rq.mostlyResolvedPath(), rq.immutablePath, rq.contentPath, err, rq.logger)
@@ -38,6 +42,7 @@ func (i *handler) serveDefaults(ctx context.Context, w http.ResponseWriter, r *h
 					return false
 				}
 				pathMetadata, headResp, err = i.backend.Head(ctx, forwardedPath)
+				err = withTimeoutCause(ctx, err)
 				if err != nil {
 					err = fmt.Errorf("failed to resolve %s: %w", debugStr(rq.contentPath.String()), err)
 					i.webError(w, r, err, http.StatusInternalServerError)
@@ -61,12 +66,20 @@ func (i *handler) serveDefaults(ctx context.Context, w http.ResponseWriter, r *h
 			}
 		}
 
+		// Paginated directory listings need the entries in the same order
+		// on every request. Invalid parameters are reported when the
+		// listing is served.
+		if params, err := i.parseDirListingParams(r); err == nil && params.paginated() {
+			ctx = ContextWithOrderedDirListing(ctx)
+		}
+
 		// TODO: passing only resolved path here, instead of contentPath is
 		// harming content routing. Knowing original immutableContentPath will
 		// allow backend to find providers for parents, even when internal
 		// CIDs are not announced, and will provide better key for caching
 		// related DAGs.
 		pathMetadata, getResp, err = i.backend.Get(ctx, rq.mostlyResolvedPath(), ranges...)
+		err = withTimeoutCause(ctx, err)
 		if err != nil {
 			if isWebRequest(rq.responseFormat) {
 				forwardedPath, continueProcessing := i.handleWebRequestErrors(w, r, rq.mostlyResolvedPath(), rq.immutablePath, rq.contentPath, err, rq.logger)
@@ -74,6 +87,7 @@ func (i *handler) serveDefaults(ctx context.Context, w http.ResponseWriter, r *h
 					return false
 				}
 				pathMetadata, getResp, err = i.backend.Get(ctx, forwardedPath, ranges...)
+				err = withTimeoutCause(ctx, err)
 				if err != nil {
 					err = fmt.Errorf("failed to resolve %s: %w", debugStr(rq.contentPath.String()), err)
 					i.webError(w, r, err, http.StatusInternalServerError)
@@ -91,6 +105,7 @@ func (i *handler) serveDefaults(ctx context.Context, w http.ResponseWriter, r *h
 		i.webError(w, r, errors.New("invalid method: cannot use this HTTP method with the given request"), http.StatusInternalServerError)
 		return false
 	}
+	resolved()
 
 	setIpfsRootsHeader(w, rq, &pathMetadata)
 
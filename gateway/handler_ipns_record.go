@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -13,6 +14,11 @@ import (
 	"github.com/ipfs/boxo/ipns"
 	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -54,11 +60,18 @@ func (i *handler) serveIpnsRecord(ctx context.Context, w http.ResponseWriter, r
 		return false
 	}
 
+	// The record can also be rendered as DAG-JSON, for clients which need its
+	// fields without parsing protobufs.
+	renderJSON := rq.responseParams[ipnsRecordFormatKey] == "dag-json" || r.URL.Query().Get("ipns-record-"+ipnsRecordFormatKey) == "dag-json"
+
 	// Set cache control headers based on the TTL set in the IPNS record. If the
 	// TTL is not present, we use the Last-Modified tag. We are tracking IPNS
 	// caching on: https://github.com/ipfs/kubo/issues/1818.
 	// TODO: use addCacheControlHeaders once #1818 is fixed.
 	recordEtag := strconv.FormatUint(xxhash.Sum64(rawRecord), 32)
+	if renderJSON {
+		recordEtag += ".dag-json"
+	}
 	w.Header().Set("Etag", recordEtag)
 
 	// Terminate early if Etag matches. We cannot rely on handleIfNoneMatch since
@@ -68,25 +81,37 @@ func (i *handler) serveIpnsRecord(ctx context.Context, w http.ResponseWriter, r
 		return false
 	}
 
-	if ttl, err := record.TTL(); err == nil {
-		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
-	} else {
-		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	if seq, err := record.Sequence(); err == nil {
+		w.Header().Set("X-Ipns-Sequence", strconv.FormatUint(seq, 10))
 	}
+	addIpnsRecordCacheHeaders(w, record)
 
 	// Set Content-Disposition
 	var name string
 	if urlFilename := r.URL.Query().Get("filename"); urlFilename != "" {
 		name = urlFilename
+	} else if renderJSON {
+		name = key + ".ipns-record.json"
 	} else {
 		name = key + ".ipns-record"
 	}
 	setContentDispositionHeader(w, name, "attachment")
 
-	w.Header().Set("Content-Type", ipnsRecordResponseFormat)
+	body := rawRecord
+	contentType := ipnsRecordResponseFormat
+	if renderJSON {
+		body, err = ipnsRecordToDagJSON(record)
+		if err != nil {
+			i.webError(w, r, err, http.StatusInternalServerError)
+			return false
+		}
+		contentType = dagJsonResponseFormat
+	}
+
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	_, err = w.Write(rawRecord)
+	_, err = w.Write(body)
 	if err == nil {
 		// Update metrics
 		i.ipnsRecordGetMetric.WithLabelValues(rq.contentPath.Namespace()).Observe(time.Since(rq.begin).Seconds())
@@ -95,3 +120,83 @@ func (i *handler) serveIpnsRecord(ctx context.Context, w http.ResponseWriter, r
 
 	return false
 }
+
+// ipnsRecordFormatKey is the parameter of the IPNS Record response format
+// requesting a DAG-JSON rendering of the record, such as in
+// "Accept: application/vnd.ipfs.ipns-record; format=dag-json" or
+// "?format=ipns-record&ipns-record-format=dag-json".
+const ipnsRecordFormatKey = "format"
+
+// addIpnsRecordCacheHeaders sets the Cache-Control header based on the TTL of
+// the record, capped by its validity, and the Expires header to the end of
+// its validity. If the TTL is not present, Last-Modified is set instead.
+func addIpnsRecordCacheHeaders(w http.ResponseWriter, record *ipns.Record) {
+	eol, eolErr := record.Validity()
+	if eolErr == nil {
+		w.Header().Set("Expires", eol.UTC().Format(http.TimeFormat))
+	}
+
+	ttl, err := record.TTL()
+	if err != nil {
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		return
+	}
+	if eolErr == nil {
+		ttl = min(ttl, max(time.Until(eol), 0))
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+}
+
+// ipnsRecordToDagJSON renders the fields of the record as DAG-JSON. The
+// signed DAG-CBOR data and its signature are included, so that the record can
+// still be verified.
+func ipnsRecordToDagJSON(record *ipns.Record) ([]byte, error) {
+	value, err := record.Value()
+	if err != nil {
+		return nil, err
+	}
+	seq, err := record.Sequence()
+	if err != nil {
+		return nil, err
+	}
+	eol, err := record.Validity()
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := record.TTL()
+	if err != nil {
+		return nil, err
+	}
+	data, sig := record.SignedData()
+	pk, err := record.PubKey()
+	if err != nil && !errors.Is(err, ipns.ErrPublicKeyNotFound) {
+		return nil, err
+	}
+	var pkBytes []byte
+	if pk != nil {
+		if pkBytes, err = crypto.MarshalPublicKey(pk); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Value", qp.String(value.String()))
+		qp.MapEntry(ma, "Sequence", qp.Int(int64(seq)))
+		qp.MapEntry(ma, "Validity", qp.String(eol.UTC().Format(time.RFC3339Nano)))
+		qp.MapEntry(ma, "TTL", qp.Int(int64(ttl)))
+		if pkBytes != nil {
+			qp.MapEntry(ma, "PubKey", qp.Bytes(pkBytes))
+		}
+		qp.MapEntry(ma, "Data", qp.Bytes(data))
+		qp.MapEntry(ma, "SignatureV2", qp.Bytes(sig))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := dagjson.Encode(n, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIpnsRecord(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+
+	sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	name := ipns.NameFromPeer(pid)
+
+	eol := time.Now().Add(30 * time.Second)
+	rec, err := ipns.NewRecord(sk, path.FromCid(root), 7, eol, time.Hour)
+	require.NoError(t, err)
+	raw, err := ipns.MarshalRecord(rec)
+	require.NoError(t, err)
+
+	ipnsBackend := &updatableIPNSBackend{mockBackend: backend}
+	ipnsBackend.setRecord(raw)
+	ts := newTestServerWithConfig(t, ipnsBackend, Config{DeserializedResponses: true})
+
+	t.Run("Headers are derived from the record", func(t *testing.T) {
+		t.Parallel()
+
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipns/"+name.String()+"?format=ipns-record", nil)
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, raw, body)
+		require.Equal(t, ipnsRecordResponseFormat, res.Header.Get("Content-Type"))
+		require.Equal(t, "7", res.Header.Get("X-Ipns-Sequence"))
+		require.Equal(t, eol.UTC().Format(http.TimeFormat), res.Header.Get("Expires"))
+
+		// The TTL of an hour is capped by the validity of the record.
+		var maxAge int
+		_, err = fmt.Sscanf(res.Header.Get("Cache-Control"), "public, max-age=%d", &maxAge)
+		require.NoError(t, err)
+		require.LessOrEqual(t, maxAge, 30)
+	})
+
+	t.Run("Record is rendered as DAG-JSON", func(t *testing.T) {
+		t.Parallel()
+
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipns/"+name.String(), nil)
+		req.Header.Set("Accept", ipnsRecordResponseFormat+"; format=dag-json")
+		res := mustDo(t, req)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, dagJsonResponseFormat, res.Header.Get("Content-Type"))
+		require.Equal(t, "7", res.Header.Get("X-Ipns-Sequence"))
+		require.Equal(t, "/ipns/"+name.String()+"?format=ipns-record&ipns-record-format=dag-json", res.Header.Get("Content-Location"))
+
+		nb := basicnode.Prototype.Any.NewBuilder()
+		require.NoError(t, dagjson.Decode(nb, bytes.NewReader(body)))
+		n := nb.Build()
+
+		value, err := n.LookupByString("Value")
+		require.NoError(t, err)
+		v, err := value.AsString()
+		require.NoError(t, err)
+		require.Equal(t, path.FromCid(root).String(), v)
+
+		seq, err := n.LookupByString("Sequence")
+		require.NoError(t, err)
+		s, err := seq.AsInt()
+		require.NoError(t, err)
+		require.EqualValues(t, 7, s)
+
+		// The signed data allows verifying the record.
+		data, sig := rec.SignedData()
+		dataNode, err := n.LookupByString("Data")
+		require.NoError(t, err)
+		d, err := dataNode.AsBytes()
+		require.NoError(t, err)
+		require.Equal(t, data, d)
+		sigNode, err := n.LookupByString("SignatureV2")
+		require.NoError(t, err)
+		s2, err := sigNode.AsBytes()
+		require.NoError(t, err)
+		require.Equal(t, sig, s2)
+
+		// The query parameter of Content-Location gives the same response.
+		req = mustNewRequest(t, http.MethodGet, ts.URL+res.Header.Get("Content-Location"), nil)
+		res2 := mustDo(t, req)
+		defer res2.Body.Close()
+		body2, err := io.ReadAll(res2.Body)
+		require.NoError(t, err)
+		require.Equal(t, body, body2)
+		require.Equal(t, res.Header.Get("Etag"), res2.Header.Get("Etag"))
+	})
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	// offlineHeader and offlineQueryParam switch a single request to the
+	// offline mode. See [Config.Offline].
+	offlineHeader     = "X-Ipfs-Offline"
+	offlineQueryParam = "offline"
+)
+
+// ErrOffline is returned with HTTP 504 when a request in offline mode needs
+// content that is not available locally. See [Config.Offline].
+var ErrOffline = errors.New("content is not available locally and the gateway is in offline mode")
+
+type offlineContextKey struct{}
+
+// offlineState records whether a request in offline mode needed content that
+// is not available locally.
+type offlineState struct {
+	missed atomic.Bool
+}
+
+// ContextWithOffline returns a context for a request in offline mode. The
+// backends honoring it, such as [BlocksBackend] and the remote backends of this
+// package, only use the content they have locally for requests with this
+// context, and return [ErrOffline] for anything that would require network
+// retrieval.
+func ContextWithOffline(ctx context.Context) context.Context {
+	if IsOffline(ctx) {
+		return ctx
+	}
+	return context.WithValue(ctx, offlineContextKey{}, &offlineState{})
+}
+
+// IsOffline returns whether ctx is the context of a request in offline mode.
+// See [ContextWithOffline].
+func IsOffline(ctx context.Context) bool {
+	_, ok := ctx.Value(offlineContextKey{}).(*offlineState)
+	return ok
+}
+
+// offlineError returns [ErrOffline] for the content described by what, and
+// records that the request in offline mode missed content, so that errors
+// that do not carry this one, such as a failure to fetch all the nodes of a
+// DAG, are reported as such.
+func offlineError(ctx context.Context, what any) error {
+	if s, ok := ctx.Value(offlineContextKey{}).(*offlineState); ok {
+		s.missed.Store(true)
+	}
+	return fmt.Errorf("%w: %v", ErrOffline, what)
+}
+
+// withOfflineCause adds [ErrOffline] to err if the request in offline mode of
+// ctx missed content, so that the client gets 504 rather than a generic error.
+func withOfflineCause(ctx context.Context, err error) error {
+	s, ok := ctx.Value(offlineContextKey{}).(*offlineState)
+	if !ok || !s.missed.Load() || errors.Is(err, ErrOffline) || isErrNotFound(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrOffline, err)
+}
+
+// isOfflineRequest returns whether r must be served in offline mode, either
+// because of [Config.Offline], or because the client asked for it with the
+// X-Ipfs-Offline: true header or the ?offline query parameter.
+func (i *handler) isOfflineRequest(r *http.Request) bool {
+	if i.config.Offline || r.Header.Get(offlineHeader) == "true" {
+		return true
+	}
+	q := r.URL.Query()
+	return q.Has(offlineQueryParam) && q.Get(offlineQueryParam) != "false"
+}
@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ipfs/boxo/exchange"
+	"github.com/ipfs/boxo/exchange/offline"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	carblockstore "github.com/ipld/go-car/v2/blockstore"
+	"github.com/stretchr/testify/require"
+)
+
+// countingExchange counts the blocks it fetches.
+type countingExchange struct {
+	exchange.Interface
+	fetched atomic.Int32
+}
+
+func (e *countingExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	e.fetched.Add(1)
+	return e.Interface.GetBlock(ctx, c)
+}
+
+func (e *countingExchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	e.fetched.Add(int32(len(ks)))
+	return e.Interface.GetBlocks(ctx, ks)
+}
+
+// newOfflineTestBackend returns a backend with an empty blockstore, and an
+// exchange that fetches the blocks of the fixtures.
+func newOfflineTestBackend(t *testing.T) (*BlocksBackend, *countingExchange, cid.Cid) {
+	r, err := os.Open(filepath.Join("./testdata", "fixtures.car"))
+	require.NoError(t, err)
+	remote, err := carblockstore.NewReadOnly(r, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		remote.Close()
+		r.Close()
+	})
+	roots, err := remote.Roots()
+	require.NoError(t, err)
+
+	ex := &countingExchange{Interface: offline.Exchange(remote)}
+	backend, _, _ := newBlocksTestBackend(t, ex, WithNameSystem(mockNamesys{}))
+	return backend, ex, roots[0]
+}
+
+func requireOffline(t *testing.T, res *http.Response) {
+	t.Helper()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), ErrOffline.Error())
+}
+
+func TestOffline(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Per request", func(t *testing.T) {
+		t.Parallel()
+
+		backend, ex, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{DeserializedResponses: true})
+		url := ts.URL + "/ipfs/" + root.String() + "/subdir/fnord"
+
+		req := mustNewRequest(t, http.MethodGet, url, nil)
+		req.Header.Set("X-Ipfs-Offline", "true")
+		requireOffline(t, mustDo(t, req))
+		requireOffline(t, mustDo(t, mustNewRequest(t, http.MethodGet, url+"?offline", nil)))
+		require.Zero(t, ex.fetched.Load())
+
+		// Online requests fetch and cache the content.
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, url+"?offline=false", nil))
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		fetched := ex.fetched.Load()
+		require.NotZero(t, fetched)
+
+		// Which can then be served offline.
+		req = mustNewRequest(t, http.MethodGet, url, nil)
+		req.Header.Set("X-Ipfs-Offline", "true")
+		res = mustDo(t, req)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "fnord", string(body))
+		require.Equal(t, fetched, ex.fetched.Load())
+	})
+
+	t.Run("Global", func(t *testing.T) {
+		t.Parallel()
+
+		backend, ex, root := newOfflineTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{DeserializedResponses: true, Offline: true})
+
+		requireOffline(t, mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord?offline=false", nil)))
+		requireOffline(t, mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=raw", nil)))
+		requireOffline(t, mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipns/example.net/", nil)))
+		require.Zero(t, ex.fetched.Load())
+	})
+}
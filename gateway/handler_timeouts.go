@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPathResolutionTimeout is returned with HTTP 504 when resolving the
+	// content path takes longer than [Config.PathResolutionTimeout].
+	ErrPathResolutionTimeout = errors.New("timed out resolving the content path")
+
+	// ErrFirstBlockTimeout is returned with HTTP 504 when the first byte of the
+	// response body is not ready within [Config.FirstBlockTimeout].
+	ErrFirstBlockTimeout = errors.New("timed out waiting for the first block of the response")
+
+	// ErrStallTimeout is used when no data could be sent to the client for
+	// [Config.StallTimeout]. If the response has not started yet, it is
+	// returned with HTTP 504, otherwise the response is aborted.
+	ErrStallTimeout = errors.New("timed out waiting for more data, the transfer stalled")
+)
+
+func isTimeoutCause(err error) bool {
+	return errors.Is(err, ErrPathResolutionTimeout) ||
+		errors.Is(err, ErrFirstBlockTimeout) ||
+		errors.Is(err, ErrStallTimeout)
+}
+
+// withTimeoutCause adds the cause of the cancellation of ctx to err, if ctx
+// was cancelled by one of the per-request timeouts, so that the client gets
+// an error explaining which timeout was hit.
+func withTimeoutCause(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if !isTimeoutCause(cause) || errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cause, err)
+}
+
+// pathResolutionContext returns the context to use for resolving the content
+// path, bounded by [Config.PathResolutionTimeout].
+func (i *handler) pathResolutionContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.config.PathResolutionTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, i.config.PathResolutionTimeout, ErrPathResolutionTimeout)
+}
+
+// backendResolutionContext returns the context to use for the backend calls
+// resolving the content path before returning a response to read, such as
+// Get or GetCAR, bounded by [Config.PathResolutionTimeout]. The resolved
+// function must be called once the backend returned, so that the response
+// can be read with the context without the timeout, and the cancel function
+// once the response has been read.
+func (i *handler) backendResolutionContext(ctx context.Context) (context.Context, func(), context.CancelFunc) {
+	if i.config.PathResolutionTimeout <= 0 {
+		return ctx, func() {}, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(i.config.PathResolutionTimeout, func() {
+		cancel(ErrPathResolutionTimeout)
+	})
+	return ctx, func() { timer.Stop() }, func() {
+		timer.Stop()
+		cancel(nil)
+	}
+}
+
+// startTransferTimeouts enforces [Config.FirstBlockTimeout] and
+// [Config.StallTimeout] on the rest of the request. The returned request
+// carries a context that is cancelled when a timeout is hit, and the returned
+// writer tracks when data is sent. The returned function must be called once
+// the response is done.
+func (i *handler) startTransferTimeouts(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	firstBlock, stall := i.config.FirstBlockTimeout, i.config.StallTimeout
+	if firstBlock <= 0 && stall <= 0 {
+		return w, r, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(r.Context())
+	tw := &timeoutResponseWriter{
+		ResponseWriter: w,
+		stall:          stall,
+		cancel:         cancel,
+	}
+
+	switch {
+	case firstBlock > 0:
+		tw.timer = time.AfterFunc(firstBlock, func() { cancel(ErrFirstBlockTimeout) })
+	case stall > 0:
+		tw.timer = time.AfterFunc(stall, func() { cancel(ErrStallTimeout) })
+	}
+
+	return tw, r.WithContext(ctx), func() {
+		tw.stop()
+		cancel(nil)
+	}
+}
+
+// timeoutResponseWriter re-arms the stall timer every time data is written.
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+	stall  time.Duration
+	cancel context.CancelCauseFunc
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	started bool
+	stopped bool
+}
+
+func (w *timeoutResponseWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if !w.stopped {
+		if !w.started && w.stall > 0 {
+			// The first block timer is replaced by the stall timer.
+			w.timer.Stop()
+			w.timer = time.AfterFunc(w.stall, func() { w.cancel(ErrStallTimeout) })
+		} else if w.stall > 0 {
+			w.timer.Reset(w.stall)
+		} else {
+			w.timer.Stop()
+		}
+		w.started = true
+	}
+	w.mu.Unlock()
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *timeoutResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows [http.ResponseController] to reach the underlying writer.
+func (w *timeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *timeoutResponseWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	w.timer.Stop()
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowBackend blocks on path resolution, block retrieval or in the middle of
+// a CAR stream until the request context is done.
+type slowBackend struct {
+	*mockBackend
+	slowResolve bool
+	slowGet     bool
+	slowBlock   bool
+	stallCAR    bool
+}
+
+func (sb *slowBackend) Get(ctx context.Context, p path.ImmutablePath, ranges ...ByteRange) (ContentPathMetadata, *GetResponse, error) {
+	if sb.slowGet {
+		<-ctx.Done()
+		return ContentPathMetadata{}, nil, ctx.Err()
+	}
+	return sb.mockBackend.Get(ctx, p, ranges...)
+}
+
+func (sb *slowBackend) ResolveMutable(ctx context.Context, p path.Path) (path.ImmutablePath, time.Duration, time.Time, error) {
+	if sb.slowResolve {
+		<-ctx.Done()
+		return path.ImmutablePath{}, 0, time.Time{}, ctx.Err()
+	}
+	return sb.mockBackend.ResolveMutable(ctx, p)
+}
+
+func (sb *slowBackend) GetCAR(ctx context.Context, p path.ImmutablePath, params CarParams) (ContentPathMetadata, io.ReadCloser, error) {
+	if sb.slowBlock {
+		<-ctx.Done()
+		return ContentPathMetadata{}, nil, ctx.Err()
+	}
+	if sb.stallCAR {
+		return ContentPathMetadata{PathSegmentRoots: []cid.Cid{p.RootCid()}, LastSegment: p}, &stallingReader{ctx: ctx}, nil
+	}
+	return sb.mockBackend.GetCAR(ctx, p, params)
+}
+
+// stallingReader returns some data once, then blocks until ctx is done.
+type stallingReader struct {
+	ctx  context.Context
+	read bool
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if !r.read {
+		r.read = true
+		return copy(p, "some data"), nil
+	}
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+func (r *stallingReader) Close() error { return nil }
+
+func TestRequestTimeouts(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+	backend.namesys["/ipns/example.net"] = newMockNamesysItem(path.FromCid(root), 0)
+
+	t.Run("Path resolution timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, &slowBackend{mockBackend: backend, slowResolve: true}, Config{
+			DeserializedResponses: true,
+			PathResolutionTimeout: 50 * time.Millisecond,
+		})
+
+		res := mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipns/example.net/", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), ErrPathResolutionTimeout.Error())
+	})
+
+	t.Run("Path resolution timeout in the backend", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, &slowBackend{mockBackend: backend, slowGet: true}, Config{
+			DeserializedResponses: true,
+			PathResolutionTimeout: 50 * time.Millisecond,
+		})
+
+		res := mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/subdir/fnord", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), ErrPathResolutionTimeout.Error())
+	})
+
+	t.Run("First block timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, &slowBackend{mockBackend: backend, slowBlock: true}, Config{
+			DeserializedResponses: true,
+			FirstBlockTimeout:     50 * time.Millisecond,
+		})
+
+		res := mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=car", nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), ErrFirstBlockTimeout.Error())
+	})
+
+	t.Run("Stall timeout aborts the response", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, &slowBackend{mockBackend: backend, stallCAR: true}, Config{
+			DeserializedResponses: true,
+			FirstBlockTimeout:     time.Second,
+			StallTimeout:          50 * time.Millisecond,
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			res := mustDoWithoutRedirect(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"?format=car", nil))
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			_, _ = io.ReadAll(res.Body)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("stalled response was not aborted")
+		}
+	})
+}
+
+func TestBackendResolutionContext(t *testing.T) {
+	t.Parallel()
+
+	i := &handler{config: &Config{PathResolutionTimeout: time.Hour}}
+	ctx, resolved, cancel := i.backendResolutionContext(context.Background())
+	resolved()
+	require.NoError(t, ctx.Err(), "the response must be readable once resolved")
+	cancel()
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+	require.NotErrorIs(t, context.Cause(ctx), ErrPathResolutionTimeout)
+}
@@ -47,7 +47,7 @@ func (i *handler) serveRedirectsIfPresent(w http.ResponseWriter, r *http.Request
 		return path.ImmutablePath{}, false, true
 	}
 
-	redirectsPath, err := path.Join(rootPath, "_redirects")
+	redirectsPath, err := path.WithSegment(rootPath, "_redirects")
 	if err != nil {
 		err = fmt.Errorf("trouble processing _redirects path %q: %w", rootPath.String(), err)
 		i.webError(w, r, err, http.StatusInternalServerError)
@@ -64,13 +64,13 @@ func (i *handler) serveDirectory(ctx context.Context, w http.ResponseWriter, r *
 	}
 
 	// Check if directory has index.html, if so, serveFile
-	idxPath, err := path.Join(rq.contentPath, "index.html")
+	idxPath, err := path.WithSegment(rq.contentPath, "index.html")
 	if err != nil {
 		i.webError(w, r, err, http.StatusInternalServerError)
 		return false
 	}
 
-	indexPath, err := path.Join(resolvedPath, "index.html")
+	indexPath, err := path.WithSegment(resolvedPath, "index.html")
 	if err != nil {
 		i.webError(w, r, err, http.StatusInternalServerError)
 		return false
@@ -134,6 +134,12 @@ func (i *handler) serveDirectory(ctx context.Context, w http.ResponseWriter, r *
 		return false
 	}
 
+	listingParams, err := i.parseDirListingParams(r)
+	if err != nil {
+		i.webError(w, r, err, http.StatusBadRequest)
+		return false
+	}
+
 	// A HTML directory index will be presented, be sure to set the correct
 	// type instead of relying on autodetection (which may fail).
 	w.Header().Set("Content-Type", "text/html")
@@ -157,16 +163,17 @@ func (i *handler) serveDirectory(ctx context.Context, w http.ResponseWriter, r *
 		return true
 	}
 
-	var dirListing []assets.DirectoryItem
-	for l := range directoryMetadata.entries {
-		if l.Err != nil {
-			i.webError(w, r, l.Err, http.StatusInternalServerError)
-			return false
-		}
+	links, more, err := collectDirListing(directoryMetadata.entries, listingParams)
+	if err != nil {
+		i.webError(w, r, err, http.StatusInternalServerError)
+		return false
+	}
 
-		name := l.Link.Name
-		sz := l.Link.Size
-		linkCid := l.Link.Cid
+	var dirListing []assets.DirectoryItem
+	for _, l := range links {
+		name := l.Name
+		sz := l.Size
+		linkCid := l.Cid
 
 		hash := linkCid.String()
 		di := assets.DirectoryItem{
@@ -203,6 +210,8 @@ func (i *handler) serveDirectory(ctx context.Context, w http.ResponseWriter, r *
 		}
 	}
 
+	prevLink, nextLink, sortByNameLink, sortBySizeLink := dirListingNavigation(r, listingParams, len(links), more)
+
 	size := humanize.Bytes(directoryMetadata.dagSize)
 	hash := resolvedPath.RootCid().String()
 	globalData := i.getTemplateGlobalData(r, rq.contentPath)
@@ -216,6 +225,11 @@ func (i *handler) serveDirectory(ctx context.Context, w http.ResponseWriter, r *
 		Breadcrumbs: assets.Breadcrumbs(rq.contentPath.String(), globalData.DNSLink),
 		BackLink:    backLink,
 		Hash:        hash,
+
+		PrevPageLink:   prevLink,
+		NextPageLink:   nextLink,
+		SortByNameLink: sortByNameLink,
+		SortBySizeLink: sortBySizeLink,
 	}
 
 	rq.logger.Debugw("request processed", "tplDataDNSLink", globalData.DNSLink, "tplDataSize", size, "tplDataBackLink", backLink, "tplDataHash", hash)
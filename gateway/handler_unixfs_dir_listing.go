@@ -0,0 +1,214 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/ipfs/boxo/ipld/unixfs"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+const (
+	dirListingOffsetParam = "offset"
+	dirListingLimitParam  = "limit"
+	dirListingSortParam   = "sort"
+	dirListingOrderParam  = "order"
+
+	dirListingSortName = "name"
+	dirListingSortSize = "size"
+)
+
+// dirListingParams are the pagination and sorting parameters of a generated
+// HTML directory listing.
+type dirListingParams struct {
+	offset int
+	limit  int // -1 means no limit
+	sortBy string
+	desc   bool
+}
+
+// parseDirListingParams reads the ?offset, ?limit, ?sort and ?order query
+// parameters. The limit defaults to, and is capped to,
+// [Config.DirectoryListingPageSize] when it is set.
+func (i *handler) parseDirListingParams(r *http.Request) (dirListingParams, error) {
+	params := dirListingParams{limit: -1}
+	if pageSize := i.config.DirectoryListingPageSize; pageSize > 0 {
+		params.limit = pageSize
+	}
+
+	q := r.URL.Query()
+	if v := q.Get(dirListingOffsetParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return params, fmt.Errorf("invalid %s query parameter: %q", dirListingOffsetParam, v)
+		}
+		params.offset = n
+	}
+	if v := q.Get(dirListingLimitParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return params, fmt.Errorf("invalid %s query parameter: %q", dirListingLimitParam, v)
+		}
+		if params.limit < 0 || n < params.limit {
+			params.limit = n
+		}
+	}
+
+	switch v := q.Get(dirListingSortParam); v {
+	case "", dirListingSortName, dirListingSortSize:
+		params.sortBy = v
+	default:
+		return params, fmt.Errorf("invalid %s query parameter: %q", dirListingSortParam, v)
+	}
+
+	switch v := q.Get(dirListingOrderParam); v {
+	case "", "asc":
+	case "desc":
+		params.desc = true
+	default:
+		return params, fmt.Errorf("invalid %s query parameter: %q", dirListingOrderParam, v)
+	}
+
+	return params, nil
+}
+
+// paginated returns whether the listing is a page of the entries of the
+// directory in their own order, which then must be enumerated in the same
+// order by every request.
+func (p dirListingParams) paginated() bool {
+	return p.sortBy == "" && (p.offset > 0 || p.limit >= 0)
+}
+
+type orderedDirListingContextKey struct{}
+
+// ContextWithOrderedDirListing returns a context for a request whose
+// directory listing is paginated. The backends honoring it, such as
+// [BlocksBackend], enumerate the entries of the directories returned by Get
+// in the same order on every request, so that consecutive pages neither
+// repeat nor skip entries. Otherwise, entries may be enumerated in any order,
+// e.g. by walking the shards of HAMT-sharded directories in parallel.
+func ContextWithOrderedDirListing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, orderedDirListingContextKey{}, true)
+}
+
+// IsOrderedDirListing returns whether ctx is the context of a request whose
+// directory listing is paginated. See [ContextWithOrderedDirListing].
+func IsOrderedDirListing(ctx context.Context) bool {
+	ordered, _ := ctx.Value(orderedDirListingContextKey{}).(bool)
+	return ordered
+}
+
+// collectDirListing reads the page of links described by params from the
+// given entries. Without sorting, links are read in the order of the
+// directory, which backends enumerate deterministically for paginated
+// listings (see [ContextWithOrderedDirListing]) so that consecutive pages
+// neither repeat nor skip entries, and reading stops right after the
+// requested page, so that large sharded directories are not enumerated in
+// full. Sorting requires reading all the links. The returned boolean is true
+// if there are more links after the page.
+func collectDirListing(entries <-chan unixfs.LinkResult, params dirListingParams) ([]*ipld.Link, bool, error) {
+	if params.sortBy == "" {
+		var (
+			links   []*ipld.Link
+			skipped int
+		)
+		for l := range entries {
+			if l.Err != nil {
+				return nil, false, l.Err
+			}
+			if skipped < params.offset {
+				skipped++
+				continue
+			}
+			if params.limit >= 0 && len(links) == params.limit {
+				return links, true, nil
+			}
+			links = append(links, l.Link)
+		}
+		return links, false, nil
+	}
+
+	var links []*ipld.Link
+	for l := range entries {
+		if l.Err != nil {
+			return nil, false, l.Err
+		}
+		links = append(links, l.Link)
+	}
+
+	less := func(a, b *ipld.Link) bool {
+		if params.sortBy == dirListingSortSize && a.Size != b.Size {
+			return a.Size < b.Size
+		}
+		return a.Name < b.Name
+	}
+	sort.SliceStable(links, func(x, y int) bool {
+		if params.desc {
+			return less(links[y], links[x])
+		}
+		return less(links[x], links[y])
+	})
+
+	if params.offset >= len(links) {
+		return nil, false, nil
+	}
+	links = links[params.offset:]
+	if params.limit >= 0 && len(links) > params.limit {
+		return links[:params.limit], true, nil
+	}
+	return links, false, nil
+}
+
+// dirListingLink returns a query-only link to the current directory listing,
+// with the given query parameters changed. Empty values are removed. A
+// query-only link keeps working when the request path was rewritten, e.g. on
+// subdomain gateways.
+func dirListingLink(r *http.Request, changes map[string]string) string {
+	q := r.URL.Query()
+	for k, v := range changes {
+		if v == "" {
+			q.Del(k)
+		} else {
+			q.Set(k, v)
+		}
+	}
+	return "?" + q.Encode()
+}
+
+// dirListingNavigation returns the links to the previous and next pages, and
+// to the listing sorted by name and by size.
+func dirListingNavigation(r *http.Request, params dirListingParams, pageLen int, more bool) (prev, next, byName, bySize string) {
+	if params.offset > 0 {
+		prevOffset := 0
+		if params.limit >= 0 && params.offset > params.limit {
+			prevOffset = params.offset - params.limit
+		}
+		prev = dirListingLink(r, map[string]string{dirListingOffsetParam: offsetParam(prevOffset)})
+	}
+	if more {
+		next = dirListingLink(r, map[string]string{dirListingOffsetParam: offsetParam(params.offset + pageLen)})
+	}
+
+	sortLink := func(sortBy string) string {
+		order := ""
+		if params.sortBy == sortBy && !params.desc {
+			order = "desc"
+		}
+		return dirListingLink(r, map[string]string{
+			dirListingOffsetParam: "",
+			dirListingSortParam:   sortBy,
+			dirListingOrderParam:  order,
+		})
+	}
+	return prev, next, sortLink(dirListingSortName), sortLink(dirListingSortSize)
+}
+
+func offsetParam(offset int) string {
+	if offset == 0 {
+		return ""
+	}
+	return strconv.Itoa(offset)
+}
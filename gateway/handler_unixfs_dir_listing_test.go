@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/ipfs/boxo/ipld/unixfs"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectDirListing(t *testing.T) {
+	t.Parallel()
+
+	newEntries := func() <-chan unixfs.LinkResult {
+		ch := make(chan unixfs.LinkResult, 4)
+		ch <- unixfs.LinkResult{Link: &ipld.Link{Name: "c", Size: 1}}
+		ch <- unixfs.LinkResult{Link: &ipld.Link{Name: "a", Size: 3}}
+		ch <- unixfs.LinkResult{Link: &ipld.Link{Name: "d", Size: 2}}
+		ch <- unixfs.LinkResult{Link: &ipld.Link{Name: "b", Size: 3}}
+		close(ch)
+		return ch
+	}
+	names := func(links []*ipld.Link) []string {
+		var names []string
+		for _, l := range links {
+			names = append(names, l.Name)
+		}
+		return names
+	}
+
+	for _, tc := range []struct {
+		name     string
+		params   dirListingParams
+		expected []string
+		more     bool
+	}{
+		{"no limit", dirListingParams{limit: -1}, []string{"c", "a", "d", "b"}, false},
+		{"first page", dirListingParams{limit: 2}, []string{"c", "a"}, true},
+		{"last page", dirListingParams{offset: 2, limit: 2}, []string{"d", "b"}, false},
+		{"past the end", dirListingParams{offset: 10, limit: 2}, nil, false},
+		{"sort by name", dirListingParams{limit: 3, sortBy: "name"}, []string{"a", "b", "c"}, true},
+		{"sort by name desc", dirListingParams{limit: -1, sortBy: "name", desc: true}, []string{"d", "c", "b", "a"}, false},
+		{"sort by size", dirListingParams{offset: 1, limit: 2, sortBy: "size"}, []string{"d", "a"}, true},
+		{"sort by size desc", dirListingParams{limit: -1, sortBy: "size", desc: true}, []string{"b", "a", "d", "c"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			links, more, err := collectDirListing(newEntries(), tc.params)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, names(links))
+			require.Equal(t, tc.more, more)
+		})
+	}
+}
+
+func TestDirListingParamsPaginated(t *testing.T) {
+	t.Parallel()
+
+	require.False(t, dirListingParams{limit: -1}.paginated())
+	require.True(t, dirListingParams{limit: 10}.paginated())
+	require.True(t, dirListingParams{offset: 5, limit: -1}.paginated())
+	// Sorted listings do not depend on the order of the directory.
+	require.False(t, dirListingParams{offset: 5, limit: 10, sortBy: dirListingSortName}.paginated())
+
+	require.False(t, IsOrderedDirListing(context.Background()))
+	require.True(t, IsOrderedDirListing(ContextWithOrderedDirListing(context.Background())))
+}
+
+func TestDirectoryListingPagination(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "headers-test.car")
+	ts := newTestServerWithConfig(t, backend, Config{
+		DeserializedResponses:    true,
+		DirectoryListingPageSize: 10,
+	})
+	unpaginated := newTestServerWithConfig(t, backend, Config{
+		DeserializedResponses: true,
+	})
+
+	filenameRe := regexp.MustCompile(`\?filename=([^"&]+)"`)
+	getFrom := func(t *testing.T, ts *httptest.Server, query string) (int, string, []string) {
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String()+"/hamt/"+query, nil)
+		req.Header.Set("Accept", "text/html")
+		res := mustDoWithoutRedirect(t, req)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		var names []string
+		for _, m := range filenameRe.FindAllStringSubmatch(string(body), -1) {
+			names = append(names, m[1])
+		}
+		return res.StatusCode, string(body), names
+	}
+	get := func(t *testing.T, query string) (int, string, []string) {
+		return getFrom(t, ts, query)
+	}
+
+	t.Run("First page", func(t *testing.T) {
+		status, body, names := get(t, "")
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, names, 10)
+		require.Contains(t, body, `href="?offset=10"`)
+		require.NotContains(t, body, "Previous page")
+	})
+
+	t.Run("Second page", func(t *testing.T) {
+		_, _, first := get(t, "")
+		status, body, names := get(t, "?offset=5&limit=5")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, first[5:], names)
+		require.Contains(t, body, "Previous page")
+		require.Contains(t, body, "Next page")
+	})
+
+	t.Run("Unpaginated by default", func(t *testing.T) {
+		status, body, all := getFrom(t, unpaginated, "")
+		require.Equal(t, http.StatusOK, status)
+		require.Greater(t, len(all), 10)
+		require.NotContains(t, body, "Next page")
+
+		// The pages neither repeat nor skip entries. Unpaginated listings
+		// may be in another order.
+		var pages []string
+		for offset := 0; offset < len(all); offset += 10 {
+			_, _, names := get(t, fmt.Sprintf("?offset=%d", offset))
+			pages = append(pages, names...)
+		}
+		require.ElementsMatch(t, all, pages)
+
+		_, _, names := getFrom(t, unpaginated, "?offset=3&limit=4")
+		require.Equal(t, pages[3:7], names)
+	})
+
+	t.Run("Limit is capped to the page size", func(t *testing.T) {
+		_, _, names := get(t, "?limit=100")
+		require.Len(t, names, 10)
+	})
+
+	t.Run("Sorted by name", func(t *testing.T) {
+		status, _, names := get(t, "?sort=name")
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, names, 10)
+		require.True(t, sort.StringsAreSorted(names))
+
+		_, _, desc := get(t, "?sort=name&order=desc")
+		require.Len(t, desc, 10)
+		require.True(t, sort.IsSorted(sort.Reverse(sort.StringSlice(desc))))
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"?offset=-1", "?limit=0", "?sort=date", "?order=up"} {
+			status, _, _ := get(t, query)
+			require.Equal(t, http.StatusBadRequest, status, query)
+		}
+	})
+}
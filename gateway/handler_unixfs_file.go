@@ -37,10 +37,16 @@ func (i *handler) serveFile(ctx context.Context, w http.ResponseWriter, r *http.
 		// "most correct" we can be without doing that.
 		ctype = "inode/symlink"
 	} else {
-		ctype = mime.TypeByExtension(gopath.Ext(name))
+		ctype = i.contentTypeOverride(r, rq.contentPath.String(), name)
+		if ctype == "" {
+			ctype = mime.TypeByExtension(gopath.Ext(name))
+		}
 		if ctype == "" {
 			ctype = fileContentType
 		}
+		if ctype == "" && i.config.ContentTypeCache != nil {
+			ctype, _ = i.config.ContentTypeCache.Get(resolvedPath.RootCid())
+		}
 		if ctype == "" && returnRangeStartsAtZero {
 			// uses https://github.com/gabriel-vasile/mimetype library to determine the content type.
 			// Fixes https://github.com/ipfs/kubo/issues/7252
@@ -59,6 +65,9 @@ func (i *handler) serveFile(ctx context.Context, w http.ResponseWriter, r *http.
 
 			ctype = mimeType.String()
 			content = io.MultiReader(&buf, fileBytes)
+			if i.config.ContentTypeCache != nil {
+				i.config.ContentTypeCache.Add(resolvedPath.RootCid(), ctype)
+			}
 		}
 		// Strip the encoding from the HTML Content-Type header and let the
 		// browser figure it out.
@@ -72,6 +81,30 @@ func (i *handler) serveFile(ctx context.Context, w http.ResponseWriter, r *http.
 	// (unifies behavior across gateways and web browsers)
 	w.Header().Set("Content-Type", ctype)
 
+	if i.config.EarlyHints && ctype == "text/html" && r.Method == http.MethodGet && returnRangeStartsAtZero && r.Header.Get("Range") == "" {
+		var err error
+		content, err = sendEarlyHints(w, r, content)
+		if err != nil {
+			i.webError(w, r, err, http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	if i.config.Compression != nil {
+		// Caches must not send compressed responses to clients that do not
+		// accept them.
+		w.Header().Add("Vary", "Accept-Encoding")
+		if enc := i.negotiateContentEncoding(r, ctype, fileSize); enc != "" && returnRangeStartsAtZero {
+			w.Header().Set("Content-Encoding", enc)
+			if etag := w.Header().Get("Etag"); etag != "" {
+				w.Header().Set("Etag", getCompressedEtag(etag, enc))
+			}
+			cw := newCompressedResponseWriter(w, enc)
+			defer cw.Close()
+			w = cw
+		}
+	}
+
 	// ServeContent will take care of
 	// If-None-Match+Etag, Content-Length and range requests
 	_, dataSent, _ := serveContent(w, r, modtime, fileSize, content)
@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// earlyHintsMaxBytes is the size of the beginning of HTML files that is
+	// parsed to find the sub-resources to hint.
+	earlyHintsMaxBytes = 64 << 10
+
+	// earlyHintsMaxLinks is the maximum number of sub-resources hinted for a
+	// single HTML file.
+	earlyHintsMaxLinks = 16
+)
+
+// earlyHint is a sub-resource of an HTML page that the browser can start
+// fetching before the page is parsed.
+type earlyHint struct {
+	ref string
+	rel string
+	as  string
+}
+
+func (h earlyHint) String() string {
+	if h.as == "" {
+		return fmt.Sprintf("<%s>; rel=%s", h.ref, h.rel)
+	}
+	return fmt.Sprintf("<%s>; rel=%s; as=%s", h.ref, h.rel, h.as)
+}
+
+// sendEarlyHints parses the beginning of the HTML file in content, and adds a
+// preload Link header for each stylesheet, script and image it references
+// within the same DAG. Over HTTP/2 and later, these are sent right away in a
+// 103 Early Hints response, and they are kept in the final response. It
+// returns a reader with the entire content.
+func sendEarlyHints(w http.ResponseWriter, r *http.Request, content io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, content, earlyHintsMaxBytes); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	hints := findEarlyHints(buf.Bytes())
+	if len(hints) > 0 {
+		for _, h := range hints {
+			w.Header().Add("Link", h.String())
+		}
+		// Some HTTP/1.1 clients do not expect informational responses.
+		if r.ProtoMajor >= 2 {
+			w.WriteHeader(http.StatusEarlyHints)
+		}
+	}
+	return io.MultiReader(&buf, content), nil
+}
+
+// findEarlyHints returns the sub-resources referenced by the HTML document
+// in data, which may be truncated.
+func findEarlyHints(data []byte) []earlyHint {
+	var hints []earlyHint
+	seen := make(map[string]struct{})
+	add := func(ref, rel, as string) {
+		ref, ok := sameDAGReference(ref)
+		if !ok {
+			return
+		}
+		if _, ok := seen[ref]; ok {
+			return
+		}
+		seen[ref] = struct{}{}
+		hints = append(hints, earlyHint{ref: ref, rel: rel, as: as})
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for len(hints) < earlyHintsMaxLinks {
+		switch z.Next() {
+		case html.ErrorToken:
+			return hints
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+
+		name, hasAttr := z.TagName()
+		if !hasAttr {
+			continue
+		}
+		attrs := make(map[string]string)
+		for more := true; more; {
+			var k, v []byte
+			k, v, more = z.TagAttr()
+			attrs[string(k)] = string(v)
+		}
+
+		switch string(name) {
+		case "link":
+			rels := strings.Fields(strings.ToLower(attrs["rel"]))
+			for _, rel := range rels {
+				if rel == "stylesheet" {
+					add(attrs["href"], "preload", "style")
+					break
+				}
+				if rel == "modulepreload" {
+					add(attrs["href"], "modulepreload", "")
+					break
+				}
+			}
+		case "script":
+			if strings.EqualFold(attrs["type"], "module") {
+				add(attrs["src"], "modulepreload", "")
+			} else {
+				add(attrs["src"], "preload", "script")
+			}
+		case "img":
+			if !strings.EqualFold(attrs["loading"], "lazy") {
+				add(attrs["src"], "preload", "image")
+			}
+		}
+	}
+	return hints
+}
+
+// sameDAGReference returns the relative reference ref if it resolves within
+// the directory of the page in the same DAG: it has no scheme, host or
+// query, does not start with a slash, and does not go up the tree.
+func sameDAGReference(ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "\\") {
+		return "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" || u.RawQuery != "" || u.Path == "" {
+		return "", false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	// Drop the fragment, and escape what cannot be in a Link header.
+	return (&url.URL{Path: u.Path}).EscapedPath(), true
+}
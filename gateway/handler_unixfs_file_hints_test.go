@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/unixfs/importer"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+const earlyHintsTestPage = `<!DOCTYPE html>
+<html>
+<head>
+	<link rel="stylesheet" href="style.css">
+	<link rel="icon" href="favicon.ico">
+	<link rel="stylesheet" href="https://example.net/remote.css">
+	<script src="./js/app.js#main"></script>
+	<script type="module" src="js/module.js"></script>
+	<script src="/absolute.js"></script>
+</head>
+<body>
+	<img src="images/logo%20big.png">
+	<img src="../escape.png">
+	<img src="lazy.png" loading="lazy">
+	<img src="style.css">
+</body>
+</html>`
+
+var earlyHintsTestLinks = []string{
+	"<style.css>; rel=preload; as=style",
+	"<./js/app.js>; rel=preload; as=script",
+	"<js/module.js>; rel=modulepreload",
+	"<images/logo%20big.png>; rel=preload; as=image",
+}
+
+func TestFindEarlyHints(t *testing.T) {
+	t.Parallel()
+
+	var links []string
+	for _, h := range findEarlyHints([]byte(earlyHintsTestPage)) {
+		links = append(links, h.String())
+	}
+	require.Equal(t, earlyHintsTestLinks, links)
+
+	// Truncated documents are parsed up to where they end.
+	hints := findEarlyHints([]byte(earlyHintsTestPage[:bytes.Index([]byte(earlyHintsTestPage), []byte("<script"))]))
+	require.Len(t, hints, 1)
+
+	for _, ref := range []string{"", "#top", "?q=1", "//example.net/a.js", "data:text/css,", "a/../../b.js", `\a.js`} {
+		_, ok := sameDAGReference(ref)
+		require.False(t, ok, ref)
+	}
+}
+
+func newEarlyHintsTestBackend(t *testing.T) (*BlocksBackend, cid.Cid) {
+	backend, _, dag := newBlocksTestBackend(t, nil)
+	nd, err := importer.BuildDagFromReader(dag, chunker.NewSizeSplitter(bytes.NewReader([]byte(earlyHintsTestPage)), 256))
+	require.NoError(t, err)
+	return backend, nd.Cid()
+}
+
+func TestEarlyHints(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newEarlyHintsTestBackend(t)
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, backend, Config{DeserializedResponses: true})
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String(), nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Empty(t, res.Header.Values("Link"))
+	})
+
+	t.Run("Preload Link headers", func(t *testing.T) {
+		t.Parallel()
+
+		ts := newTestServerWithConfig(t, backend, Config{DeserializedResponses: true, EarlyHints: true})
+		res := mustDo(t, mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String(), nil))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "text/html", res.Header.Get("Content-Type"))
+		require.Equal(t, earlyHintsTestLinks, res.Header.Values("Link"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, earlyHintsTestPage, string(body))
+
+		// Range requests are not hinted.
+		req := mustNewRequest(t, http.MethodGet, ts.URL+"/ipfs/"+root.String(), nil)
+		req.Header.Set("Range", "bytes=10-20")
+		res = mustDo(t, req)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+		require.Empty(t, res.Header.Values("Link"))
+	})
+
+	t.Run("103 Early Hints over HTTP/2", func(t *testing.T) {
+		t.Parallel()
+
+		ts := httptest.NewUnstartedServer(NewHandler(Config{DeserializedResponses: true, EarlyHints: true}, backend))
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+		t.Cleanup(ts.Close)
+
+		var earlyLinks []string
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				if code == http.StatusEarlyHints {
+					earlyLinks = header.Values("Link")
+				}
+				return nil
+			},
+		})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/ipfs/"+root.String(), nil)
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 2, res.ProtoMajor)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, earlyHintsTestLinks, earlyLinks)
+		require.Equal(t, earlyHintsTestLinks, res.Header.Values("Link"))
+	})
+}
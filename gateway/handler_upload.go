@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	mc "github.com/multiformats/go-multicodec"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// uploadBatchSize is the number of blocks of a CAR upload stored at once.
+const uploadBatchSize = 64
+
+// maxUploadBlockSize is the size limit of the raw block uploads, the largest
+// block bitswap transfers.
+const maxUploadBlockSize = 2 << 20
+
+// uploadHandler handles the POST and PUT requests of a writable gateway, see
+// [Config.Writable].
+func (i *handler) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	wc := i.config.Writable
+
+	// The backend is wrapped, see newHandlerWithMetrics, and unsupported
+	// uploads fail with errors.ErrUnsupported instead.
+	backend, ok := i.backend.(WithUploads)
+	if !ok {
+		i.webError(w, r, errors.New("the backend does not support uploads"), http.StatusNotImplemented)
+		return
+	}
+	if r.URL.Path != "/ipfs/" && r.URL.Path != "/ipfs" {
+		i.webError(w, r, errors.New("uploads must be sent to /ipfs/"), http.StatusBadRequest)
+		return
+	}
+	if wc.Authorize == nil {
+		i.webError(w, r, errors.New("uploads are not authorized"), http.StatusForbidden)
+		return
+	}
+	if err := wc.Authorize(r); err != nil {
+		i.webError(w, r, err, http.StatusForbidden)
+		return
+	}
+	if wc.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, wc.MaxBodySize)
+	}
+
+	ctx := r.Context()
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var root cid.Cid
+	var err error
+	switch mediaType {
+	case rawResponseFormat:
+		root, err = uploadBlock(ctx, backend, http.MaxBytesReader(w, r.Body, maxUploadBlockSize))
+	case carResponseFormat:
+		root, err = uploadCAR(ctx, backend, r.Body, i.isStored)
+	case "multipart/form-data":
+		root, err = uploadMultipart(ctx, backend, r.Body, params["boundary"], wc.MaxEntries)
+	default:
+		root, err = addUnixFS(ctx, backend, files.NewReaderFile(r.Body))
+	}
+	if err != nil {
+		code := http.StatusBadRequest
+		var mbe *http.MaxBytesError
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			code = http.StatusNotImplemented
+		case errors.As(err, &mbe), errors.Is(err, files.ErrTooManyEntries), errors.Is(err, files.ErrTooLarge):
+			code = http.StatusRequestEntityTooLarge
+		}
+		i.webError(w, r, fmt.Errorf("failed to upload: %w", err), code)
+		return
+	}
+
+	log.Debugw("upload received", "cid", root)
+	w.Header().Set("IPFS-Hash", root.String())
+	w.Header().Set("Location", "/ipfs/"+root.String())
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintln(w, root)
+}
+
+// uploadBlock stores the raw block read from body.
+func uploadBlock(ctx context.Context, backend WithUploads, body io.Reader) (cid.Cid, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return cid.Undef, err
+	}
+	hash, err := mh.Sum(data, mh.SHA2_256, -1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	blk, err := blocks.NewBlockWithCid(data, cid.NewCidV1(uint64(mc.Raw), hash))
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := backend.PutBlocks(ctx, []blocks.Block{blk}); err != nil {
+		return cid.Undef, uploadBackendError(err)
+	}
+	return blk.Cid(), nil
+}
+
+// uploadCAR stores the blocks of the CAR read from body, and returns its
+// first root, which must be in the CAR or already stored.
+func uploadCAR(ctx context.Context, backend WithUploads, body io.Reader, isStored func(context.Context, cid.Cid) bool) (cid.Cid, error) {
+	br, err := carv2.NewBlockReader(body, carv2.WithTrustedCAR(false))
+	if err != nil {
+		return cid.Undef, err
+	}
+	if len(br.Roots) == 0 {
+		return cid.Undef, errors.New("CAR has no root")
+	}
+
+	root := br.Roots[0]
+	hasRoot := false
+	batch := make([]blocks.Block, 0, uploadBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := backend.PutBlocks(ctx, batch); err != nil {
+			return uploadBackendError(err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		blk, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return cid.Undef, err
+		}
+		hasRoot = hasRoot || blk.Cid().Equals(root)
+		batch = append(batch, blk)
+		if len(batch) == uploadBatchSize {
+			if err := flush(); err != nil {
+				return cid.Undef, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return cid.Undef, err
+	}
+	if !hasRoot && !isStored(ctx, root) {
+		return cid.Undef, fmt.Errorf("CAR root %s is neither in the CAR nor stored", root)
+	}
+	return root, nil
+}
+
+// isStored returns whether the block c is available locally, without fetching
+// it, see [ContextWithOffline].
+func (i *handler) isStored(ctx context.Context, c cid.Cid) bool {
+	_, f, err := i.backend.GetBlock(ContextWithOffline(ctx), path.FromCid(c))
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+// uploadMultipart imports the files and directories of the multipart body in
+// a directory.
+func uploadMultipart(ctx context.Context, backend WithUploads, body io.Reader, boundary string, maxEntries int) (cid.Cid, error) {
+	if boundary == "" {
+		return cid.Undef, errors.New("multipart boundary is missing")
+	}
+	dir, err := files.NewFileFromPartReader(multipart.NewReader(body, boundary), "multipart/form-data")
+	if err != nil {
+		return cid.Undef, err
+	}
+	return addUnixFS(ctx, backend, files.LimitDirectory(dir, files.WithMaxEntries(maxEntries)))
+}
+
+// addUnixFS imports node with the backend. The errors reading node are
+// errors of the request, and the other ones errors of the backend, see
+// [uploadBackendError].
+func addUnixFS(ctx context.Context, backend WithUploads, node files.Node) (cid.Cid, error) {
+	root, err := backend.AddUnixFS(ctx, uploadRequestNode(node))
+	var reqErr uploadRequestError
+	if err != nil && !errors.As(err, &reqErr) {
+		return cid.Undef, uploadBackendError(err)
+	}
+	return root, err
+}
+
+// uploadRequestError marks the errors reading the uploaded files.
+type uploadRequestError struct {
+	error
+}
+
+func (e uploadRequestError) Unwrap() error {
+	return e.error
+}
+
+// uploadRequestNode returns node with its read errors, and the ones of its
+// entries, marked as [uploadRequestError].
+func uploadRequestNode(node files.Node) files.Node {
+	switch n := node.(type) {
+	case *files.Symlink:
+		return n
+	case files.Directory:
+		return &uploadRequestDirectory{Directory: n}
+	case files.File:
+		return &uploadRequestFile{File: n}
+	default:
+		return n
+	}
+}
+
+type uploadRequestDirectory struct {
+	files.Directory
+}
+
+func (d *uploadRequestDirectory) Entries() files.DirIterator {
+	return &uploadRequestIterator{DirIterator: d.Directory.Entries()}
+}
+
+type uploadRequestIterator struct {
+	files.DirIterator
+}
+
+func (it *uploadRequestIterator) Node() files.Node {
+	return uploadRequestNode(it.DirIterator.Node())
+}
+
+func (it *uploadRequestIterator) Err() error {
+	if err := it.DirIterator.Err(); err != nil {
+		return uploadRequestError{err}
+	}
+	return nil
+}
+
+type uploadRequestFile struct {
+	files.File
+}
+
+func (f *uploadRequestFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err != nil && err != io.EOF {
+		err = uploadRequestError{err}
+	}
+	return n, err
+}
+
+// uploadBackendError makes the errors of the backend internal server errors,
+// except for the unsupported uploads and the blocked content.
+func uploadBackendError(err error) error {
+	if errors.Is(err, errors.ErrUnsupported) || isErrContentBlocked(err) {
+		return err
+	}
+	return NewErrorStatusCode(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,299 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange/offline"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func newUploadTestBackend(t *testing.T) *BlocksBackend {
+	backend, _, _ := newBlocksTestBackend(t, nil)
+	return backend
+}
+
+// failingBlockstore fails to store blocks, like a full disk.
+type failingBlockstore struct {
+	blockstore.Blockstore
+}
+
+func (bs failingBlockstore) Put(context.Context, blocks.Block) error {
+	return errors.New("disk full")
+}
+
+func (bs failingBlockstore) PutMany(context.Context, []blocks.Block) error {
+	return errors.New("disk full")
+}
+
+func mustUpload(t *testing.T, url, contentType string, body io.Reader) cid.Cid {
+	req := mustNewRequest(t, http.MethodPost, url+"/ipfs/", body)
+	req.Header.Set("Content-Type", contentType)
+	res := mustDo(t, req)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	c, err := cid.Parse(res.Header.Get("IPFS-Hash"))
+	require.NoError(t, err)
+	require.Equal(t, "/ipfs/"+c.String(), res.Header.Get("Location"))
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, c.String(), strings.TrimSpace(string(data)))
+	return c
+}
+
+func mustGetBody(t *testing.T, url string) []byte {
+	res := mustDo(t, mustNewRequest(t, http.MethodGet, url, nil))
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return data
+}
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		DeserializedResponses: true,
+		Writable: &WritableConfig{
+			Authorize:   func(r *http.Request) error { return nil },
+			MaxBodySize: 1024,
+			MaxEntries:  2,
+		},
+	}
+
+	t.Run("Raw block", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		c := mustUpload(t, ts.URL, rawResponseFormat, strings.NewReader("hello"))
+		require.Equal(t, "bafkreibm6jg3ux5qumhcn2b3flc3tyu6dmlb4xa7u5bf44yegnrjhc4yeq", c.String())
+		require.Equal(t, "hello", string(mustGetBody(t, ts.URL+"/ipfs/"+c.String())))
+	})
+
+	t.Run("CAR", func(t *testing.T) {
+		t.Parallel()
+		src := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+		c := mustUpload(t, src.URL, "text/plain", strings.NewReader("hello from a CAR"))
+		car := mustGetBody(t, src.URL+"/ipfs/"+c.String()+"?format=car")
+
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+		require.Equal(t, c, mustUpload(t, ts.URL, carResponseFormat, bytes.NewReader(car)))
+		require.Equal(t, "hello from a CAR", string(mustGetBody(t, ts.URL+"/ipfs/"+c.String())))
+	})
+
+	t.Run("CAR without its root", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		blk := blocks.NewBlock([]byte("not the root"))
+		missing := blocks.NewBlock([]byte("missing root")).Cid()
+		var car bytes.Buffer
+		require.NoError(t, carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{missing}, Version: 1}, &car))
+		require.NoError(t, util.LdWrite(&car, blk.Cid().Bytes(), blk.RawData()))
+
+		req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", &car)
+		req.Header.Set("Content-Type", carResponseFormat)
+		res := mustDo(t, req)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		// A root that is already stored is accepted.
+		stored := mustUpload(t, ts.URL, rawResponseFormat, strings.NewReader("stored root"))
+		car.Reset()
+		require.NoError(t, carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{stored}, Version: 1}, &car))
+		require.NoError(t, util.LdWrite(&car, blk.Cid().Bytes(), blk.RawData()))
+		require.Equal(t, stored, mustUpload(t, ts.URL, carResponseFormat, &car))
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", "a.txt")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte("file a"))
+		require.NoError(t, err)
+		fw, err = mw.CreateFormFile("file", "b.txt")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte("file b"))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		c := mustUpload(t, ts.URL, mw.FormDataContentType(), &body)
+		require.Equal(t, "file a", string(mustGetBody(t, ts.URL+"/ipfs/"+c.String()+"/a.txt")))
+		require.Equal(t, "file b", string(mustGetBody(t, ts.URL+"/ipfs/"+c.String()+"/b.txt")))
+	})
+
+	t.Run("Multipart with too many entries", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			fw, err := mw.CreateFormFile("file", name)
+			require.NoError(t, err)
+			_, err = fw.Write([]byte(name))
+			require.NoError(t, err)
+		}
+		require.NoError(t, mw.Close())
+
+		req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		res := mustDo(t, req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+
+	t.Run("UnixFS file", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		c := mustUpload(t, ts.URL, "text/plain", strings.NewReader("hello world"))
+		require.Equal(t, uint64(cid.Raw), c.Prefix().Codec)
+		require.Equal(t, "hello world", string(mustGetBody(t, ts.URL+"/ipfs/"+c.String())))
+	})
+
+	t.Run("Body too large", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", bytes.NewReader(make([]byte, 2048)))
+		req.Header.Set("Content-Type", rawResponseFormat)
+		res := mustDo(t, req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+
+	t.Run("Raw block too large", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), Config{
+			Writable: &WritableConfig{Authorize: config.Writable.Authorize},
+		})
+
+		req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", bytes.NewReader(make([]byte, maxUploadBlockSize+1)))
+		req.Header.Set("Content-Type", rawResponseFormat)
+		res := mustDo(t, req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+
+	t.Run("Not a root path", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), config)
+
+		res := mustDo(t, mustNewRequest(t, http.MethodPut, ts.URL+"/ipfs/bafkqaaa", strings.NewReader("hello")))
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), Config{
+			Writable: &WritableConfig{
+				Authorize: func(r *http.Request) error {
+					if r.Header.Get("Authorization") != "Bearer secret" {
+						return errors.New("invalid token")
+					}
+					return nil
+				},
+			},
+		})
+
+		res := mustDo(t, mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", strings.NewReader("hello")))
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", strings.NewReader("hello"))
+		req.Header.Set("Authorization", "Bearer secret")
+		res = mustDo(t, req)
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	})
+
+	t.Run("No authorizer", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), Config{Writable: &WritableConfig{}})
+
+		res := mustDo(t, mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", strings.NewReader("hello")))
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("Denylisted", func(t *testing.T) {
+		t.Parallel()
+		blocked, err := cid.NewPrefixV1(cid.Raw, mh.SHA2_256).Sum([]byte("blocked"))
+		require.NoError(t, err)
+		denylist, err := NewDenylist(WithDenylistRules("/ipfs/" + blocked.String()))
+		require.NoError(t, err)
+		backend := newUploadTestBackend(t)
+		ts := newTestServerWithConfig(t, backend, Config{
+			Writable: config.Writable,
+			Denylist: denylist,
+		})
+
+		for _, contentType := range []string{rawResponseFormat, "text/plain"} {
+			req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", strings.NewReader("blocked"))
+			req.Header.Set("Content-Type", contentType)
+			res := mustDo(t, req)
+			require.Equal(t, http.StatusGone, res.StatusCode, contentType)
+		}
+
+		// The blocked content was refused before being stored.
+		has, err := backend.blockStore.Has(context.Background(), blocked)
+		require.NoError(t, err)
+		require.False(t, has)
+	})
+
+	t.Run("Storage failure", func(t *testing.T) {
+		t.Parallel()
+		bs := failingBlockstore{blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))}
+		backend, err := NewBlocksBackend(blockservice.New(bs, offline.Exchange(bs)))
+		require.NoError(t, err)
+		ts := newTestServerWithConfig(t, backend, config)
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", "a.txt")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte("file a"))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		for contentType, body := range map[string]io.Reader{
+			"text/plain":             strings.NewReader("hello"),
+			mw.FormDataContentType(): &body,
+		} {
+			req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", body)
+			req.Header.Set("Content-Type", contentType)
+			res := mustDo(t, req)
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode, contentType)
+		}
+
+		// Malformed requests remain errors of the client.
+		req := mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", strings.NewReader("--boundary\r\nnot a part"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+		res := mustDo(t, req)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Read only", func(t *testing.T) {
+		t.Parallel()
+		ts := newTestServerWithConfig(t, newUploadTestBackend(t), Config{})
+
+		res := mustDo(t, mustNewRequest(t, http.MethodPost, ts.URL+"/ipfs/", strings.NewReader("hello")))
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+		require.NotContains(t, res.Header.Values("Allow"), http.MethodPost)
+	})
+}
@@ -8,6 +8,7 @@ import (
 // Headers is an HTTP middleware that sets the configured headers in all requests.
 type Headers struct {
 	headers map[string][]string
+	cors    *corsPolicies
 }
 
 // NewHeaders creates a new [Headers] middleware that applies the given headers
@@ -77,17 +78,37 @@ func (h *Headers) ApplyCors() *Headers {
 			"X-Stream-Output",
 			"X-Ipfs-Path",
 			"X-Ipfs-Roots",
+			"X-Ipfs-DagSize",
+			"X-Ipfs-DagBlockCount",
+			"X-Ipfs-DagStats",
+			"X-Ipfs-DagComplete",
+			"X-Ipfs-DagMissingBlocks",
+			"X-Ipns-Sequence",
 		}, h.headers[ACEHeadersName]...))
 
 	return h
 }
 
+// ApplyCORSPolicies applies the [CORSPolicy] of [Config.CORS] and
+// [PublicGateway.CORS] matching each request, on top of the headers set by
+// [Headers.ApplyCors].
+func (h *Headers) ApplyCORSPolicies(c Config) *Headers {
+	h.cors = &corsPolicies{
+		gateways: prepareHostnameGateways(c.PublicGateways),
+		policies: c.CORS,
+	}
+	return h
+}
+
 // Wrap wraps the given [http.Handler] with the headers middleware.
 func (h *Headers) Wrap(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		for k, v := range h.headers {
 			w.Header()[k] = v
 		}
+		if h.cors != nil {
+			h.cors.apply(w, r)
+		}
 
 		next.ServeHTTP(w, r)
 	})
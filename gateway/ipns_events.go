@@ -0,0 +1,302 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	gopath "path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+)
+
+const (
+	// DefaultIPNSEventsPollInterval is the default interval at which
+	// [IPNSEventsHandler] checks for newer IPNS records.
+	DefaultIPNSEventsPollInterval = time.Minute
+
+	// DefaultIPNSEventsMaxSubscribers is the default maximum number of
+	// concurrent subscriptions to an [IPNSEventsHandler].
+	DefaultIPNSEventsMaxSubscribers = 1000
+
+	// ipnsEventsKeepAlive is the interval at which comments are sent to idle
+	// subscribers, so that proxies do not close the connection.
+	ipnsEventsKeepAlive = 30 * time.Second
+)
+
+// IPNSEvent is the JSON-encoded data of the "update" events sent by
+// [IPNSEventsHandler].
+type IPNSEvent struct {
+	Name     string
+	Value    string
+	Sequence uint64
+	Validity time.Time
+	// TTL is the TTL of the record, in seconds.
+	TTL int64
+}
+
+// IPNSEventsOption configures an [IPNSEventsHandler].
+type IPNSEventsOption func(*IPNSEventsHandler)
+
+// WithIPNSEventsPollInterval sets how often the records of the subscribed
+// names are fetched with [IPFSBackend.GetIPNSRecord]. Defaults to
+// [DefaultIPNSEventsPollInterval].
+func WithIPNSEventsPollInterval(interval time.Duration) IPNSEventsOption {
+	return func(h *IPNSEventsHandler) {
+		h.pollInterval = interval
+	}
+}
+
+// WithIPNSEventsMaxSubscribers sets the maximum number of concurrent
+// subscriptions. Further requests get a 503 Service Unavailable. Defaults to
+// [DefaultIPNSEventsMaxSubscribers].
+func WithIPNSEventsMaxSubscribers(n int) IPNSEventsOption {
+	return func(h *IPNSEventsHandler) {
+		h.maxSubscribers = n
+	}
+}
+
+// IPNSEventsHandler is an [http.Handler] that lets clients subscribe to an IPNS
+// name and receive [server-sent events] when a newer record is observed, so
+// that applications can live-reload without polling the gateway.
+//
+// A subscription is a GET request whose last path segment is the IPNS name:
+//
+//	mux.Handle("/ipns-events/", gateway.NewIPNSEventsHandler(backend))
+//
+//	GET /ipns-events/k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8
+//
+// Each newer record is sent as an "update" event whose data is an [IPNSEvent]
+// and whose ID is the sequence number of the record, so reconnecting clients
+// sending Last-Event-ID only receive records they have not seen. The current
+// record is sent as soon as it is known.
+//
+// Records are polled with [IPFSBackend.GetIPNSRecord] once per name, no matter
+// the number of subscribers. Records observed by other means, e.g. IPNS over
+// PubSub, can be passed to [IPNSEventsHandler.Notify]. Records are validated
+// before being sent.
+//
+// [server-sent events]: https://html.spec.whatwg.org/multipage/server-sent-events.html
+type IPNSEventsHandler struct {
+	backend        IPFSBackend
+	pollInterval   time.Duration
+	maxSubscribers int
+
+	lk          sync.Mutex
+	watchers    map[string]*ipnsWatcher
+	subscribers int
+}
+
+// ipnsWatcher polls the record of a name for its subscribers.
+type ipnsWatcher struct {
+	name   ipns.Name
+	subs   map[chan IPNSEvent]struct{}
+	last   *IPNSEvent
+	cancel context.CancelFunc
+}
+
+var _ http.Handler = (*IPNSEventsHandler)(nil)
+
+// NewIPNSEventsHandler returns an [IPNSEventsHandler] backed by the given
+// [IPFSBackend].
+func NewIPNSEventsHandler(backend IPFSBackend, opts ...IPNSEventsOption) *IPNSEventsHandler {
+	h := &IPNSEventsHandler{
+		backend:        backend,
+		pollInterval:   DefaultIPNSEventsPollInterval,
+		maxSubscribers: DefaultIPNSEventsMaxSubscribers,
+		watchers:       make(map[string]*ipnsWatcher),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *IPNSEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := ipns.NameFromString(gopath.Base(r.URL.Path))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid IPNS name: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var lastSeen uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		lastSeen, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	events, ok := h.subscribe(name)
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.pollInterval.Seconds())))
+		http.Error(w, "too many subscribers", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.unsubscribe(name, events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		log.Debugw("cannot stream IPNS events", "name", name, "error", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(ipnsEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev := <-events:
+			if lastSeen != 0 && ev.Sequence <= lastSeen {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: update\ndata: %s\n\n", ev.Sequence, data)
+			if err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Notify passes a record of name observed out of band, e.g. with IPNS over
+// PubSub, to the subscribers of name, if it is newer than the last record
+// they received. It returns an error if the record is invalid.
+func (h *IPNSEventsHandler) Notify(name ipns.Name, rawRecord []byte) error {
+	rec, err := ipns.UnmarshalRecord(rawRecord)
+	if err != nil {
+		return err
+	}
+	if err := ipns.ValidateWithName(rec, name); err != nil {
+		return err
+	}
+
+	ev := IPNSEvent{Name: name.String()}
+	value, err := rec.Value()
+	if err != nil {
+		return err
+	}
+	ev.Value = value.String()
+	if ev.Sequence, err = rec.Sequence(); err != nil {
+		return err
+	}
+	if ev.Validity, err = rec.Validity(); err != nil {
+		return err
+	}
+	if ttl, err := rec.TTL(); err == nil {
+		ev.TTL = int64(ttl.Seconds())
+	}
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	watcher, ok := h.watchers[ev.Name]
+	if !ok || (watcher.last != nil && ev.Sequence <= watcher.last.Sequence) {
+		return nil
+	}
+	watcher.last = &ev
+	for sub := range watcher.subs {
+		sendLatestIPNSEvent(sub, ev)
+	}
+	return nil
+}
+
+// subscribe registers a subscriber of name, starting to poll its record if it
+// is the first one. It returns false if there are too many subscribers.
+func (h *IPNSEventsHandler) subscribe(name ipns.Name) (chan IPNSEvent, bool) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if h.subscribers >= h.maxSubscribers {
+		return nil, false
+	}
+	h.subscribers++
+
+	watcher, ok := h.watchers[name.String()]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		watcher = &ipnsWatcher{
+			name:   name,
+			subs:   make(map[chan IPNSEvent]struct{}),
+			cancel: cancel,
+		}
+		h.watchers[name.String()] = watcher
+		go h.poll(ctx, name)
+	}
+
+	// Only the last event is buffered: slow subscribers skip intermediate
+	// records.
+	events := make(chan IPNSEvent, 1)
+	watcher.subs[events] = struct{}{}
+	if watcher.last != nil {
+		events <- *watcher.last
+	}
+	return events, true
+}
+
+func (h *IPNSEventsHandler) unsubscribe(name ipns.Name, events chan IPNSEvent) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	h.subscribers--
+	watcher := h.watchers[name.String()]
+	delete(watcher.subs, events)
+	if len(watcher.subs) == 0 {
+		watcher.cancel()
+		delete(h.watchers, name.String())
+	}
+}
+
+// poll fetches the record of name every poll interval, until ctx is done.
+func (h *IPNSEventsHandler) poll(ctx context.Context, name ipns.Name) {
+	ticker := time.NewTicker(h.pollInterval)
+	defer ticker.Stop()
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, h.pollInterval)
+		raw, err := h.backend.GetIPNSRecord(fetchCtx, name.Cid())
+		cancel()
+		if err == nil {
+			err = h.Notify(name, raw)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Debugw("failed to fetch IPNS record for subscribers", "name", name, "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendLatestIPNSEvent sends ev to a subscriber, replacing the event it has not
+// received yet, if any. It must be called with the handler lock held.
+func sendLatestIPNSEvent(sub chan IPNSEvent, ev IPNSEvent) {
+	select {
+	case <-sub:
+	default:
+	}
+	sub <- ev
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/stretchr/testify/require"
+)
+
+type updatableIPNSBackend struct {
+	*mockBackend
+	lk     sync.Mutex
+	record []byte
+}
+
+func (mb *updatableIPNSBackend) GetIPNSRecord(ctx context.Context, c cid.Cid) ([]byte, error) {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
+	if mb.record == nil {
+		return nil, routing.ErrNotFound
+	}
+	return mb.record, nil
+}
+
+func (mb *updatableIPNSBackend) setRecord(raw []byte) {
+	mb.lk.Lock()
+	defer mb.lk.Unlock()
+	mb.record = raw
+}
+
+// readIPNSEvent reads the next "update" event of an event stream.
+func readIPNSEvent(t *testing.T, r *bufio.Reader) (string, IPNSEvent) {
+	t.Helper()
+
+	var (
+		id  string
+		ev  IPNSEvent
+		got bool
+	)
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && got:
+			return id, ev
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev))
+			got = true
+		}
+	}
+}
+
+func TestIPNSEventsHandler(t *testing.T) {
+	t.Parallel()
+
+	backend, root := newMockBackend(t, "fixtures.car")
+
+	sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	name := ipns.NameFromPeer(pid)
+
+	newRecord := func(seq uint64, value path.Path) []byte {
+		rec, err := ipns.NewRecord(sk, value, seq, time.Now().Add(time.Hour), time.Minute)
+		require.NoError(t, err)
+		raw, err := ipns.MarshalRecord(rec)
+		require.NoError(t, err)
+		return raw
+	}
+
+	ipnsBackend := &updatableIPNSBackend{mockBackend: backend}
+	ipnsBackend.setRecord(newRecord(1, path.FromCid(root)))
+
+	handler := NewIPNSEventsHandler(ipnsBackend, WithIPNSEventsPollInterval(10*time.Millisecond), WithIPNSEventsMaxSubscribers(1))
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/ipns-events/"+name.String(), nil)
+	require.NoError(t, err)
+	res, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	r := bufio.NewReader(res.Body)
+
+	// The current record is sent first.
+	id, ev := readIPNSEvent(t, r)
+	require.Equal(t, "1", id)
+	require.Equal(t, name.String(), ev.Name)
+	require.Equal(t, path.FromCid(root).String(), ev.Value)
+	require.Equal(t, int64(60), ev.TTL)
+
+	// Newer records are picked up by polling.
+	updated, err := path.Join(path.FromCid(root), "subdir")
+	require.NoError(t, err)
+	ipnsBackend.setRecord(newRecord(2, updated))
+	id, ev = readIPNSEvent(t, r)
+	require.Equal(t, "2", id)
+	require.Equal(t, updated.String(), ev.Value)
+
+	// Or notified out of band. Older records are ignored.
+	require.NoError(t, handler.Notify(name, newRecord(1, path.FromCid(root))))
+	require.NoError(t, handler.Notify(name, newRecord(3, path.FromCid(root))))
+	id, _ = readIPNSEvent(t, r)
+	require.Equal(t, "3", id)
+
+	// Invalid records are rejected.
+	otherSk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	otherRec, err := ipns.NewRecord(otherSk, path.FromCid(root), 4, time.Now().Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	otherRaw, err := ipns.MarshalRecord(otherRec)
+	require.NoError(t, err)
+	require.Error(t, handler.Notify(name, otherRaw))
+
+	// There can only be one subscriber.
+	res2, err := ts.Client().Get(ts.URL + "/ipns-events/" + name.String())
+	require.NoError(t, err)
+	res2.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, res2.StatusCode)
+
+	// The watcher stops once the subscriber is gone.
+	cancel()
+	require.Eventually(t, func() bool {
+		handler.lk.Lock()
+		defer handler.lk.Unlock()
+		return len(handler.watchers) == 0 && handler.subscribers == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestIPNSEventsHandlerInvalidRequests(t *testing.T) {
+	t.Parallel()
+
+	backend, _ := newMockBackend(t, "fixtures.car")
+	ts := httptest.NewServer(NewIPNSEventsHandler(backend))
+	t.Cleanup(ts.Close)
+
+	res, err := ts.Client().Get(ts.URL + "/ipns-events/example.com")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = ts.Client().Post(ts.URL+"/ipns-events/example.com", "text/plain", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
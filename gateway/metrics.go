@@ -2,11 +2,13 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 
 	"github.com/ipfs/boxo/files"
 	"github.com/ipfs/boxo/path"
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	prometheus "github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel"
@@ -180,6 +182,9 @@ func (b *ipfsBackendWithMetrics) GetDNSLinkRecord(ctx context.Context, fqdn stri
 
 var _ IPFSBackend = (*ipfsBackendWithMetrics)(nil)
 var _ WithContextHint = (*ipfsBackendWithMetrics)(nil)
+var _ WithDagStats = (*ipfsBackendWithMetrics)(nil)
+var _ WithUploads = (*ipfsBackendWithMetrics)(nil)
+var _ WithPartialCAR = (*ipfsBackendWithMetrics)(nil)
 
 func (b *ipfsBackendWithMetrics) WrapContextForRequest(ctx context.Context) context.Context {
 	if withCtxWrap, ok := b.backend.(WithContextHint); ok {
@@ -189,6 +194,10 @@ func (b *ipfsBackendWithMetrics) WrapContextForRequest(ctx context.Context) cont
 }
 
 func newHandlerWithMetrics(c *Config, backend IPFSBackend) *handler {
+	if c.Denylist != nil {
+		backend = newDenylistBackend(backend, c.Denylist)
+	}
+
 	i := &handler{
 		config:  c,
 		backend: newIPFSBackendWithMetrics(backend),
@@ -318,3 +327,71 @@ func registerMetric(registry prometheus.Registerer, metric prometheus.Collector)
 		log.Errorf("failed to register %v: %v", metric, err)
 	}
 }
+
+func (b *ipfsBackendWithMetrics) DagStats(ctx context.Context, path path.ImmutablePath, maxBlocks int) (DagStats, error) {
+	withDagStats, ok := b.backend.(WithDagStats)
+	if !ok {
+		return DagStats{}, errors.ErrUnsupported
+	}
+
+	begin := time.Now()
+	name := "IPFSBackend.DagStats"
+	ctx, span := spanTrace(ctx, name, trace.WithAttributes(attribute.String("path", path.String()), attribute.Int("maxBlocks", maxBlocks)))
+	defer span.End()
+
+	stats, err := withDagStats.DagStats(ctx, path, maxBlocks)
+
+	b.updateBackendCallMetric(name, err, begin)
+	return stats, err
+}
+
+func (b *ipfsBackendWithMetrics) GetPartialCAR(ctx context.Context, path path.ImmutablePath, params CarParams) (ContentPathMetadata, PartialCAR, error) {
+	withPartialCAR, ok := b.backend.(WithPartialCAR)
+	if !ok {
+		return ContentPathMetadata{}, nil, errors.ErrUnsupported
+	}
+
+	begin := time.Now()
+	name := "IPFSBackend.GetPartialCAR"
+	ctx, span := spanTrace(ctx, name, trace.WithAttributes(attribute.String("path", path.String())))
+	defer span.End()
+
+	md, pc, err := withPartialCAR.GetPartialCAR(ctx, path, params)
+
+	b.updateBackendCallMetric(name, err, begin)
+	return md, pc, err
+}
+
+func (b *ipfsBackendWithMetrics) PutBlocks(ctx context.Context, blks []blocks.Block) error {
+	withUploads, ok := b.backend.(WithUploads)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	begin := time.Now()
+	name := "IPFSBackend.PutBlocks"
+	ctx, span := spanTrace(ctx, name, trace.WithAttributes(attribute.Int("blocks", len(blks))))
+	defer span.End()
+
+	err := withUploads.PutBlocks(ctx, blks)
+
+	b.updateBackendCallMetric(name, err, begin)
+	return err
+}
+
+func (b *ipfsBackendWithMetrics) AddUnixFS(ctx context.Context, node files.Node) (cid.Cid, error) {
+	withUploads, ok := b.backend.(WithUploads)
+	if !ok {
+		return cid.Undef, errors.ErrUnsupported
+	}
+
+	begin := time.Now()
+	name := "IPFSBackend.AddUnixFS"
+	ctx, span := spanTrace(ctx, name)
+	defer span.End()
+
+	c, err := withUploads.AddUnixFS(ctx, node)
+
+	b.updateBackendCallMetric(name, err, begin)
+	return c, err
+}
@@ -14,11 +14,17 @@ import (
 	"time"
 
 	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange"
 	offline "github.com/ipfs/boxo/exchange/offline"
 	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
 	"github.com/ipfs/boxo/namesys"
 	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	format "github.com/ipfs/go-ipld-format"
 	carblockstore "github.com/ipld/go-car/v2/blockstore"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/routing"
@@ -202,6 +208,10 @@ func (mb *mockBackend) ResolvePath(ctx context.Context, immutablePath path.Immut
 	return mb.gw.ResolvePath(ctx, immutablePath)
 }
 
+func (mb *mockBackend) DagStats(ctx context.Context, immutablePath path.ImmutablePath, maxBlocks int) (DagStats, error) {
+	return mb.gw.(WithDagStats).DagStats(ctx, immutablePath, maxBlocks)
+}
+
 func (mb *mockBackend) resolvePathNoRootsReturned(ctx context.Context, ip path.Path) (path.ImmutablePath, error) {
 	var imPath path.ImmutablePath
 	var err error
@@ -230,6 +240,21 @@ func newTestServerAndNode(t *testing.T, fixturesFile string) (*httptest.Server,
 	return ts, backend, root
 }
 
+// newBlocksTestBackend returns a [BlocksBackend] over an empty in-memory
+// blockstore, with the blockstore and a DAG service to add the blocks of the
+// test. The blocks missing from the blockstore are fetched with ex, unless it
+// is nil.
+func newBlocksTestBackend(t *testing.T, ex exchange.Interface, opts ...BackendOption) (*BlocksBackend, blockstore.Blockstore, format.DAGService) {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	if ex == nil {
+		ex = offline.Exchange(bs)
+	}
+	blockService := blockservice.New(bs, ex)
+	backend, err := NewBlocksBackend(blockService, opts...)
+	require.NoError(t, err)
+	return backend, bs, merkledag.NewDAGService(blockService)
+}
+
 func newTestServer(t *testing.T, backend IPFSBackend) *httptest.Server {
 	return newTestServerWithConfig(t, backend, Config{
 		DeserializedResponses: true,
@@ -84,6 +84,10 @@ func (ps *remoteValueStore) SearchValue(ctx context.Context, k string, opts ...r
 }
 
 func (ps *remoteValueStore) fetch(ctx context.Context, name ipns.Name) ([]byte, error) {
+	if IsOffline(ctx) {
+		return nil, offlineError(ctx, name)
+	}
+
 	urlStr := fmt.Sprintf("%s/ipns/%s", ps.getRandomGatewayURL(), name.String())
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
 	if err != nil {
@@ -0,0 +1,102 @@
+package merkledag
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ProtoNodeBuilder creates ProtoNodes and RawNodes with a fixed CID version
+// and hash function, so that these choices can be made in a single place and
+// passed down to the layers building DAGs (e.g. as the CidBuilder of the
+// unixfs importer helpers or of an mfs Directory).
+//
+// The zero value is not usable, use [NewProtoNodeBuilder].
+type ProtoNodeBuilder struct {
+	prefix cid.Prefix
+}
+
+// DefaultProtoNodeBuilder is the builder used by the unixfs importers and by
+// mfs when they are not given a CID builder. It creates CIDv0 sha2-256 nodes.
+// It is a global option that can be replaced, e.g. with a CIDv1 blake3
+// builder, before building any DAG; it must not be changed concurrently with
+// DAG building.
+var DefaultProtoNodeBuilder = &ProtoNodeBuilder{prefix: v0CidPrefix}
+
+// ProtoNodeBuilderOption is an option for [NewProtoNodeBuilder].
+type ProtoNodeBuilderOption func(*cid.Prefix)
+
+// WithCidVersion sets the CID version of the nodes created by the builder.
+// Defaults to 0.
+func WithCidVersion(version uint64) ProtoNodeBuilderOption {
+	return func(p *cid.Prefix) {
+		p.Version = version
+	}
+}
+
+// WithHashFunction sets the multihash function used to hash the nodes created
+// by the builder, for example [mh.SHA2_512] or [mh.BLAKE3]. Defaults to
+// [mh.SHA2_256]. Hash functions other than [mh.SHA2_256] require CIDv1.
+func WithHashFunction(mhType uint64) ProtoNodeBuilderOption {
+	return func(p *cid.Prefix) {
+		p.MhType = mhType
+		p.MhLength = -1
+	}
+}
+
+// WithHashLength sets the length of the digest for hash functions that
+// support a variable length, such as [mh.BLAKE3]. Defaults to the natural
+// length of the hash function.
+func WithHashLength(length int) ProtoNodeBuilderOption {
+	return func(p *cid.Prefix) {
+		p.MhLength = length
+	}
+}
+
+// NewProtoNodeBuilder returns a [ProtoNodeBuilder] with the given options. It
+// returns an error if the hash function is not usable or if the combination
+// of CID version and hash function is not valid.
+func NewProtoNodeBuilder(opts ...ProtoNodeBuilderOption) (*ProtoNodeBuilder, error) {
+	prefix := v0CidPrefix
+	for _, opt := range opts {
+		opt(&prefix)
+	}
+
+	switch prefix.Version {
+	case 0:
+		if prefix.MhType != mh.SHA2_256 || (prefix.MhLength != -1 && prefix.MhLength != 32) {
+			return nil, fmt.Errorf("CIDv0 only supports sha2-256 with a 32 bytes digest")
+		}
+	case 1:
+	default:
+		return nil, fmt.Errorf("unknown CID version: %d", prefix.Version)
+	}
+
+	if err := checkHasher(prefix.MhType, prefix.MhLength); err != nil {
+		return nil, err
+	}
+
+	return &ProtoNodeBuilder{prefix: prefix}, nil
+}
+
+// CidBuilder returns the [cid.Builder] for dag-pb nodes created by the
+// builder. It can be used wherever a cid.Builder is expected, such as
+// [ProtoNode.SetCidBuilder].
+func (b *ProtoNodeBuilder) CidBuilder() cid.Builder {
+	return b.prefix
+}
+
+// NodeWithData builds a new ProtoNode with the given data, using the CID
+// version and hash function of the builder.
+func (b *ProtoNodeBuilder) NodeWithData(d []byte) *ProtoNode {
+	return &ProtoNode{data: d, builder: b.prefix}
+}
+
+// NewRawNode creates a RawNode with the given data, using the hash function
+// of the builder. Raw nodes are always CIDv1.
+func (b *ProtoNodeBuilder) NewRawNode(data []byte) (*RawNode, error) {
+	prefix := b.prefix
+	prefix.Version = 1
+	return NewRawNodeWPrefix(data, prefix)
+}
@@ -0,0 +1,72 @@
+package merkledag_test
+
+import (
+	"testing"
+
+	. "github.com/ipfs/boxo/ipld/merkledag"
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestProtoNodeBuilder(t *testing.T) {
+	data := []byte("hello world")
+
+	t.Run("defaults to CIDv0 and sha2-256", func(t *testing.T) {
+		b, err := NewProtoNodeBuilder()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, expected := b.NodeWithData(data).Cid(), NodeWithData(data).Cid(); !got.Equals(expected) {
+			t.Fatalf("got %s, expected %s", got, expected)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		mhType uint64
+	}{
+		{"sha2-512", mh.SHA2_512},
+		{"blake3", mh.BLAKE3},
+	} {
+		t.Run("CIDv1 with "+tc.name, func(t *testing.T) {
+			b, err := NewProtoNodeBuilder(WithCidVersion(1), WithHashFunction(tc.mhType))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			prefix := b.NodeWithData(data).Cid().Prefix()
+			if prefix.Version != 1 || prefix.Codec != cid.DagProtobuf || prefix.MhType != tc.mhType {
+				t.Fatalf("unexpected prefix %+v", prefix)
+			}
+
+			raw, err := b.NewRawNode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix = raw.Cid().Prefix()
+			if prefix.Version != 1 || prefix.Codec != cid.Raw || prefix.MhType != tc.mhType {
+				t.Fatalf("unexpected raw prefix %+v", prefix)
+			}
+
+			nd := NodeWithData(data)
+			if err := nd.SetCidBuilder(b.CidBuilder()); err != nil {
+				t.Fatal(err)
+			}
+			if !nd.Cid().Equals(b.NodeWithData(data).Cid()) {
+				t.Fatal("SetCidBuilder and NodeWithData disagree")
+			}
+		})
+	}
+
+	t.Run("CIDv0 requires sha2-256", func(t *testing.T) {
+		if _, err := NewProtoNodeBuilder(WithHashFunction(mh.BLAKE3)); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("unknown hash function", func(t *testing.T) {
+		if _, err := NewProtoNodeBuilder(WithCidVersion(1), WithHashFunction(0xdeadbeef)); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,490 @@
+package dagutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	legacy "github.com/ipfs/go-ipld-legacy"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+)
+
+// ErrCannotPatch is returned by Patch when a change cannot be applied to the
+// DAG.
+var ErrCannotPatch = errors.New("cannot apply change")
+
+// DiffStream calls emit with the changes that transform node 'a' into node
+// 'b', as soon as they are found, until emit returns an error. Unlike Diff, it
+// works on any IPLD node:
+//
+//   - The links of two ProtoNodes with the same data and uniquely named links
+//     are compared by name, and the path of their changes are link names.
+//   - Two other nodes of the same codec, which only differ by the targets of
+//     their links, are compared link by link, and the path of their changes
+//     are the paths of the links within the nodes.
+//
+// Otherwise, a Mod change replaces the whole node. The changes only reference
+// the roots of the sub-DAGs which differ, which can be transferred to turn 'a'
+// into 'b', and applied with Patch.
+func DiffStream(ctx context.Context, ng ipld.NodeGetter, a, b ipld.Node, emit func(*Change) error) error {
+	return diffStream(ctx, ng, "", a, b, emit)
+}
+
+func diffStream(ctx context.Context, ng ipld.NodeGetter, prefix string, a, b ipld.Node, emit func(*Change) error) error {
+	if a.Cid() == b.Cid() {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mod := &Change{Type: Mod, Path: prefix, Before: a.Cid(), After: b.Cid()}
+
+	pbA, okA := a.(*dag.ProtoNode)
+	pbB, okB := b.(*dag.ProtoNode)
+	if okA && okB {
+		if !bytes.Equal(pbA.Data(), pbB.Data()) || !uniqueLinkNames(pbA) || !uniqueLinkNames(pbB) {
+			return emit(mod)
+		}
+		return diffProtoLinks(ctx, ng, prefix, pbA, pbB, emit)
+	}
+
+	if okA || okB || a.Cid().Prefix().Codec != b.Cid().Prefix().Codec {
+		return emit(mod)
+	}
+	dmA, okA := a.(datamodel.Node)
+	dmB, okB := b.(datamodel.Node)
+	if !okA || !okB {
+		return emit(mod)
+	}
+	var pairs []linkPair
+	if !sameShape(dmA, dmB, datamodel.Path{}, &pairs) {
+		return emit(mod)
+	}
+	for _, pair := range pairs {
+		if err := diffLinks(ctx, ng, path.Join(prefix, pair.path.String()), pair.before, pair.after, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffProtoLinks compares the links of two ProtoNodes by name.
+func diffProtoLinks(ctx context.Context, ng ipld.NodeGetter, prefix string, a, b *dag.ProtoNode, emit func(*Change) error) error {
+	for _, la := range a.Links() {
+		lb, err := b.GetNodeLink(la.Name)
+		if err != nil {
+			if err := emit(&Change{Type: Remove, Path: path.Join(prefix, la.Name), Before: la.Cid}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := diffLinks(ctx, ng, path.Join(prefix, la.Name), la.Cid, lb.Cid, emit); err != nil {
+			return err
+		}
+	}
+	for _, lb := range b.Links() {
+		if _, err := a.GetNodeLink(lb.Name); err != nil {
+			if err := emit(&Change{Type: Add, Path: path.Join(prefix, lb.Name), After: lb.Cid}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffLinks compares the targets of two links.
+func diffLinks(ctx context.Context, ng ipld.NodeGetter, p string, a, b cid.Cid, emit func(*Change) error) error {
+	if a == b {
+		return nil
+	}
+	nodeA, err := ng.Get(ctx, a)
+	if err != nil {
+		return err
+	}
+	nodeB, err := ng.Get(ctx, b)
+	if err != nil {
+		return err
+	}
+	return diffStream(ctx, ng, p, nodeA, nodeB, emit)
+}
+
+func uniqueLinkNames(nd *dag.ProtoNode) bool {
+	names := make(map[string]struct{}, len(nd.Links()))
+	for _, l := range nd.Links() {
+		if l.Name == "" {
+			return false
+		}
+		if _, ok := names[l.Name]; ok {
+			return false
+		}
+		names[l.Name] = struct{}{}
+	}
+	return true
+}
+
+// linkPair is a link of two nodes with the same shape, whose target differs.
+type linkPair struct {
+	path          datamodel.Path
+	before, after cid.Cid
+}
+
+// sameShape returns true if x and y are equal, except for the targets of their
+// links, and appends the links whose target differ to pairs.
+func sameShape(x, y datamodel.Node, p datamodel.Path, pairs *[]linkPair) bool {
+	if x.Kind() != y.Kind() {
+		return false
+	}
+	switch x.Kind() {
+	case datamodel.Kind_Link:
+		lx, errX := x.AsLink()
+		ly, errY := y.AsLink()
+		if errX != nil || errY != nil {
+			return false
+		}
+		cx, okX := lx.(cidlink.Link)
+		cy, okY := ly.(cidlink.Link)
+		if !okX || !okY {
+			return false
+		}
+		if cx.Cid != cy.Cid {
+			*pairs = append(*pairs, linkPair{path: p, before: cx.Cid, after: cy.Cid})
+		}
+		return true
+	case datamodel.Kind_Map:
+		if x.Length() != y.Length() {
+			return false
+		}
+		it := x.MapIterator()
+		for !it.Done() {
+			k, vx, err := it.Next()
+			if err != nil {
+				return false
+			}
+			ks, err := k.AsString()
+			if err != nil {
+				return false
+			}
+			vy, err := y.LookupByString(ks)
+			if err != nil || !sameShape(vx, vy, p.AppendSegmentString(ks), pairs) {
+				return false
+			}
+		}
+		return true
+	case datamodel.Kind_List:
+		if x.Length() != y.Length() {
+			return false
+		}
+		for i := int64(0); i < x.Length(); i++ {
+			vx, errX := x.LookupByIndex(i)
+			vy, errY := y.LookupByIndex(i)
+			if errX != nil || errY != nil || !sameShape(vx, vy, p.AppendSegmentInt(i), pairs) {
+				return false
+			}
+		}
+		return true
+	default:
+		return datamodel.DeepEqual(x, y)
+	}
+}
+
+// Patch applies the changes, as returned by DiffStream or Diff, to root, and
+// returns the new root. The nodes referenced by the changes must be available
+// in ds, and the modified nodes are added to it. Within the nodes other than
+// ProtoNodes, an Add change whose path ends with "-" appends a link to a list.
+func Patch(ctx context.Context, ds ipld.DAGService, root ipld.Node, changes []*Change) (ipld.Node, error) {
+	for _, c := range changes {
+		var segs []string
+		if p := strings.Trim(c.Path, "/"); p != "" {
+			segs = strings.Split(p, "/")
+		}
+		nd, err := patchNode(ctx, ds, root, segs, c)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrCannotPatch, c.String(), err)
+		}
+		root = nd
+	}
+	return root, nil
+}
+
+func patchNode(ctx context.Context, ds ipld.DAGService, nd ipld.Node, segs []string, c *Change) (ipld.Node, error) {
+	if len(segs) == 0 {
+		if c.Type != Mod {
+			return nil, errors.New("only Mod changes apply to the root")
+		}
+		return ds.Get(ctx, c.After)
+	}
+
+	switch n := nd.(type) {
+	case *dag.ProtoNode:
+		return patchProtoNode(ctx, ds, n, segs, c)
+	case datamodel.Node:
+		return patchDatamodelNode(ctx, ds, nd, n, segs, c)
+	default:
+		return nil, fmt.Errorf("%s has no links", nd.Cid())
+	}
+}
+
+func patchProtoNode(ctx context.Context, ds ipld.DAGService, nd *dag.ProtoNode, segs []string, c *Change) (ipld.Node, error) {
+	pn := nd.Copy().(*dag.ProtoNode)
+	name := segs[0]
+
+	var child ipld.Node
+	var err error
+	if len(segs) > 1 {
+		lnk, err := pn.GetNodeLink(name)
+		if err != nil {
+			return nil, err
+		}
+		child, err = lnk.GetNode(ctx, ds)
+		if err != nil {
+			return nil, err
+		}
+		child, err = patchNode(ctx, ds, child, segs[1:], c)
+		if err != nil {
+			return nil, err
+		}
+	} else if c.Type != Remove {
+		child, err = ds.Get(ctx, c.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(segs) > 1 || c.Type != Add {
+		if err := pn.RemoveNodeLink(name); err != nil {
+			return nil, err
+		}
+	}
+	if child != nil {
+		if err := pn.AddNodeLink(name, child); err != nil {
+			return nil, err
+		}
+	}
+	if err := ds.Add(ctx, pn); err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+func patchDatamodelNode(ctx context.Context, ds ipld.DAGService, nd ipld.Node, n datamodel.Node, segs []string, c *Change) (ipld.Node, error) {
+	var patched datamodel.Node
+	var err error
+
+	// Descend in the sub-DAG of the link on the path, if any. Otherwise, the
+	// change applies to a link of this node.
+	var through *linkPair
+	for _, l := range datamodelLinks(n) {
+		ls := l.path.Segments()
+		if len(ls) < len(segs) && hasSegments(segs, ls) {
+			through = &l
+			break
+		}
+	}
+	if through != nil {
+		child, err := ds.Get(ctx, through.before)
+		if err != nil {
+			return nil, err
+		}
+		child, err = patchNode(ctx, ds, child, segs[len(through.path.Segments()):], c)
+		if err != nil {
+			return nil, err
+		}
+		patched, err = editDatamodelNode(n, through.path, Mod, child.Cid())
+	} else {
+		patched, err = editDatamodelNode(n, datamodel.ParsePath(strings.Join(segs, "/")), c.Type, c.After)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storeDatamodelNode(ctx, ds, nd.Cid().Prefix(), patched)
+}
+
+// editDatamodelNode adds, removes or replaces the link at path p of n. Links
+// are added to the end of a list with the "-" path segment.
+func editDatamodelNode(n datamodel.Node, p datamodel.Path, typ ChangeType, target cid.Cid) (datamodel.Node, error) {
+	value := basicnode.NewLink(cidlink.Link{Cid: target})
+	if typ == Mod {
+		return traversal.FocusedTransform(n, p, func(_ traversal.Progress, point datamodel.Node) (datamodel.Node, error) {
+			if point == nil || point.IsAbsent() {
+				return nil, fmt.Errorf("nothing to replace at %q", p)
+			}
+			return value, nil
+		}, false)
+	}
+
+	seg := p.Last()
+	return traversal.FocusedTransform(n, p.Pop(), func(_ traversal.Progress, parent datamodel.Node) (datamodel.Node, error) {
+		nb := parent.Prototype().NewBuilder()
+		switch parent.Kind() {
+		case datamodel.Kind_Map:
+			key := seg.String()
+			_, err := parent.LookupByString(key)
+			exists := err == nil
+			if typ == Add && exists {
+				return nil, fmt.Errorf("%q already exists", p)
+			}
+			if typ == Remove && !exists {
+				return nil, fmt.Errorf("nothing to remove at %q", p)
+			}
+			ma, err := nb.BeginMap(0)
+			if err != nil {
+				return nil, err
+			}
+			for it := parent.MapIterator(); !it.Done(); {
+				k, v, err := it.Next()
+				if err != nil {
+					return nil, err
+				}
+				if ks, _ := k.AsString(); typ == Remove && ks == key {
+					continue
+				}
+				if err := ma.AssembleKey().AssignNode(k); err != nil {
+					return nil, err
+				}
+				if err := ma.AssembleValue().AssignNode(v); err != nil {
+					return nil, err
+				}
+			}
+			if typ == Add {
+				if err := ma.AssembleKey().AssignString(key); err != nil {
+					return nil, err
+				}
+				if err := ma.AssembleValue().AssignNode(value); err != nil {
+					return nil, err
+				}
+			}
+			if err := ma.Finish(); err != nil {
+				return nil, err
+			}
+		case datamodel.Kind_List:
+			idx := parent.Length()
+			if seg.String() != "-" {
+				var err error
+				if idx, err = seg.Index(); err != nil {
+					return nil, err
+				}
+			}
+			if idx < 0 || idx > parent.Length() || (typ == Remove && idx == parent.Length()) {
+				return nil, fmt.Errorf("index out of range at %q", p)
+			}
+			la, err := nb.BeginList(0)
+			if err != nil {
+				return nil, err
+			}
+			for it := parent.ListIterator(); !it.Done(); {
+				i, v, err := it.Next()
+				if err != nil {
+					return nil, err
+				}
+				if i == idx {
+					if typ == Remove {
+						continue
+					}
+					if err := la.AssembleValue().AssignNode(value); err != nil {
+						return nil, err
+					}
+				}
+				if err := la.AssembleValue().AssignNode(v); err != nil {
+					return nil, err
+				}
+			}
+			if typ == Add && idx == parent.Length() {
+				if err := la.AssembleValue().AssignNode(value); err != nil {
+					return nil, err
+				}
+			}
+			if err := la.Finish(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("cannot add or remove links at %q", p)
+		}
+		return nb.Build(), nil
+	}, false)
+}
+
+// storeDatamodelNode encodes n like the node it replaces, and adds it to ds.
+func storeDatamodelNode(ctx context.Context, ds ipld.DAGService, prefix cid.Prefix, n datamodel.Node) (ipld.Node, error) {
+	var buf bytes.Buffer
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageWriteOpener = func(linking.LinkContext) (io.Writer, linking.BlockWriteCommitter, error) {
+		return &buf, func(datamodel.Link) error { return nil }, nil
+	}
+	lnk, err := lsys.Store(linking.LinkContext{Ctx: ctx}, cidlink.LinkPrototype{Prefix: prefix}, n)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := blocks.NewBlockWithCid(buf.Bytes(), lnk.(cidlink.Link).Cid)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := legacy.NewDecoder().DecodeNode(ctx, blk)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// datamodelLinks returns the links of n, with their path within n.
+func datamodelLinks(n datamodel.Node) []linkPair {
+	var links []linkPair
+	var walk func(n datamodel.Node, p datamodel.Path)
+	walk = func(n datamodel.Node, p datamodel.Path) {
+		switch n.Kind() {
+		case datamodel.Kind_Link:
+			if l, err := n.AsLink(); err == nil {
+				if cl, ok := l.(cidlink.Link); ok {
+					links = append(links, linkPair{path: p, before: cl.Cid})
+				}
+			}
+		case datamodel.Kind_Map:
+			it := n.MapIterator()
+			for !it.Done() {
+				k, v, err := it.Next()
+				if err != nil {
+					return
+				}
+				if ks, err := k.AsString(); err == nil {
+					walk(v, p.AppendSegmentString(ks))
+				}
+			}
+		case datamodel.Kind_List:
+			it := n.ListIterator()
+			for !it.Done() {
+				i, v, err := it.Next()
+				if err != nil {
+					return
+				}
+				walk(v, p.AppendSegmentInt(i))
+			}
+		}
+	}
+	walk(n, datamodel.Path{})
+	return links
+}
+
+func hasSegments(segs []string, prefix []datamodel.PathSegment) bool {
+	for i, s := range prefix {
+		if segs[i] != s.String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package dagutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+)
+
+func collectDiff(t *testing.T, ds ipld.DAGService, a, b ipld.Node) []*Change {
+	t.Helper()
+	var changes []*Change
+	err := DiffStream(context.Background(), ds, a, b, func(c *Change) error {
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func checkChanges(t *testing.T, changes []*Change, expect []*Change) {
+	t.Helper()
+	if len(changes) != len(expect) {
+		t.Fatalf("expected %d changes, got %v", len(expect), changes)
+	}
+	for i, c := range changes {
+		if *c != *expect[i] {
+			t.Errorf("expected change %q, got %q", expect[i].String(), c.String())
+		}
+	}
+}
+
+func checkPatch(t *testing.T, ds ipld.DAGService, a, b ipld.Node, changes []*Change) {
+	t.Helper()
+	patched, err := Patch(context.Background(), ds, a, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Cid() != b.Cid() {
+		t.Fatalf("patched root %s is not %s", patched.Cid(), b.Cid())
+	}
+}
+
+func TestDiffStreamProtoNodes(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	mkDir := func(links map[string]ipld.Node) *dag.ProtoNode {
+		nd := dag.NodeWithData([]byte("dir"))
+		for name, child := range links {
+			if err := nd.AddNodeLink(name, child); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	mkFile := func(data string) *dag.ProtoNode {
+		nd := dag.NodeWithData([]byte(data))
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+
+	fileA, fileC, fileC2, fileD := mkFile("a"), mkFile("c"), mkFile("c2"), mkFile("d")
+	a := mkDir(map[string]ipld.Node{"a": fileA, "b": mkDir(map[string]ipld.Node{"c": fileC})})
+	b := mkDir(map[string]ipld.Node{"b": mkDir(map[string]ipld.Node{"c": fileC2}), "d": fileD})
+
+	changes := collectDiff(t, ds, a, b)
+	checkChanges(t, changes, []*Change{
+		{Type: Remove, Path: "a", Before: fileA.Cid()},
+		{Type: Mod, Path: "b/c", Before: fileC.Cid(), After: fileC2.Cid()},
+		{Type: Add, Path: "d", After: fileD.Cid()},
+	})
+	checkPatch(t, ds, a, b, changes)
+
+	if changes := collectDiff(t, ds, a, a); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+}
+
+func TestDiffStreamDatamodelNodes(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	prefix := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: 0x12, MhLength: -1}
+
+	store := func(n datamodel.Node) ipld.Node {
+		nd, err := storeDatamodelNode(ctx, ds, prefix, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	mkLeaf := func(v int64) ipld.Node {
+		n, err := qp.BuildMap(basicnode.Prototype.Any, 1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "v", qp.Int(v))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store(n)
+	}
+	mkRoot := func(name string, child ipld.Node, items ...ipld.Node) ipld.Node {
+		n, err := qp.BuildMap(basicnode.Prototype.Any, 3, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String(name))
+			qp.MapEntry(ma, "child", qp.Link(cidlink.Link{Cid: child.Cid()}))
+			qp.MapEntry(ma, "items", qp.List(int64(len(items)), func(la datamodel.ListAssembler) {
+				for _, it := range items {
+					qp.ListEntry(la, qp.Link(cidlink.Link{Cid: it.Cid()}))
+				}
+			}))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store(n)
+	}
+
+	leaf1, leaf2, leaf3 := mkLeaf(1), mkLeaf(2), mkLeaf(3)
+
+	// Only links differ: the changes are at the paths of the links.
+	a := mkRoot("root", leaf1, leaf1, leaf2)
+	b := mkRoot("root", leaf2, leaf1, leaf3)
+	changes := collectDiff(t, ds, a, b)
+	checkChanges(t, changes, []*Change{
+		{Type: Mod, Path: "child", Before: leaf1.Cid(), After: leaf2.Cid()},
+		{Type: Mod, Path: "items/1", Before: leaf2.Cid(), After: leaf3.Cid()},
+	})
+	checkPatch(t, ds, a, b, changes)
+
+	// Links are added to a list: the root is replaced.
+	c := mkRoot("root", leaf1, leaf1, leaf2, leaf3)
+	changes = collectDiff(t, ds, a, c)
+	checkChanges(t, changes, []*Change{{Type: Mod, Before: a.Cid(), After: c.Cid()}})
+	checkPatch(t, ds, a, c, changes)
+
+	// Add and remove changes also apply within the nodes.
+	checkPatch(t, ds, a, c, []*Change{{Type: Add, Path: "items/-", After: leaf3.Cid()}})
+	d := mkRoot("root", leaf1, leaf1)
+	checkPatch(t, ds, a, d, []*Change{{Type: Remove, Path: "items/1", Before: leaf2.Cid()}})
+
+	// Changes apply through the links of the nodes.
+	e := mkRoot("root", leaf1, leaf1, mkRoot("sub", leaf2))
+	f := mkRoot("root", leaf1, leaf1, mkRoot("sub", leaf3))
+	changes = collectDiff(t, ds, e, f)
+	checkChanges(t, changes, []*Change{{Type: Mod, Path: "items/1/child", Before: leaf2.Cid(), After: leaf3.Cid()}})
+	checkPatch(t, ds, e, f, changes)
+}
+
+func TestDiffStreamStops(t *testing.T) {
+	ds := mdtest.Mock()
+	a := dag.NodeWithData([]byte("a"))
+	b := dag.NodeWithData([]byte("b"))
+
+	errStop := errors.New("stop")
+	err := DiffStream(context.Background(), ds, a, b, func(*Change) error { return errStop })
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected the error of emit, got %v", err)
+	}
+}
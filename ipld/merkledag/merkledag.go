@@ -170,16 +170,18 @@ func (n *dagService) Session(ctx context.Context) format.NodeGetter {
 	}
 }
 
-// FetchGraph fetches all nodes that are children of the given node
-func FetchGraph(ctx context.Context, root cid.Cid, serv format.DAGService) error {
-	return FetchGraphWithDepthLimit(ctx, root, -1, serv)
+// FetchGraph fetches all nodes that are children of the given node. The
+// options, such as [Prefetch], tune the concurrent walk of the DAG.
+func FetchGraph(ctx context.Context, root cid.Cid, serv format.DAGService, options ...WalkOption) error {
+	return FetchGraphWithDepthLimit(ctx, root, -1, serv, options...)
 }
 
 // FetchGraphWithDepthLimit fetches all nodes that are children to the given
 // node down to the given depth. maxDepth=0 means "only fetch root",
 // maxDepth=1 means "fetch root and its direct children" and so on...
-// maxDepth=-1 means unlimited.
-func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, serv format.DAGService) error {
+// maxDepth=-1 means unlimited. The options, such as [Prefetch], tune the
+// concurrent walk of the DAG.
+func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, serv format.DAGService, options ...WalkOption) error {
 	var ng format.NodeGetter = NewSession(ctx, serv)
 
 	set := make(map[cid.Cid]int)
@@ -206,9 +208,9 @@ func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, s
 	}
 
 	// If we have a ProgressTracker, we wrap the visit function to handle it
-	v, _ := ctx.Value(progressContextKey).(*ProgressTracker)
+	v := ProgressTrackerFromContext(ctx)
 	if v == nil {
-		return WalkDepth(ctx, GetLinksDirect(ng), root, visit, Concurrent())
+		return WalkDepth(ctx, GetLinksDirect(ng), root, visit, append([]WalkOption{Concurrent()}, options...)...)
 	}
 
 	visitProgress := func(c cid.Cid, depth int) bool {
@@ -218,7 +220,7 @@ func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, s
 		}
 		return false
 	}
-	return WalkDepth(ctx, GetLinksDirect(ng), root, visitProgress, Concurrent())
+	return WalkDepth(ctx, GetLinksDirect(ng), root, visitProgress, append([]WalkOption{Concurrent()}, options...)...)
 }
 
 // GetMany gets many nodes from the DAG at once.
@@ -300,6 +302,7 @@ const defaultConcurrentFetch = 32
 type walkOptions struct {
 	SkipRoot     bool
 	Concurrency  int
+	Prefetch     PrefetchStrategy
 	ErrorHandler func(c cid.Cid, err error) error
 }
 
@@ -447,6 +450,13 @@ func (p *ProgressTracker) DeriveContext(ctx context.Context) context.Context {
 	return context.WithValue(ctx, progressContextKey, p)
 }
 
+// ProgressTrackerFromContext returns the ProgressTracker set on ctx with
+// DeriveContext, or nil.
+func ProgressTrackerFromContext(ctx context.Context) *ProgressTracker {
+	v, _ := ctx.Value(progressContextKey).(*ProgressTracker)
+	return v
+}
+
 // Increment adds one to the total progress.
 func (p *ProgressTracker) Increment() {
 	p.lk.Lock()
@@ -462,19 +472,15 @@ func (p *ProgressTracker) Value() int {
 }
 
 func parallelWalkDepth(ctx context.Context, getLinks GetLinks, root cid.Cid, visit func(cid.Cid, int) bool, options *walkOptions) error {
-	type cidDepth struct {
-		cid   cid.Cid
-		depth int
-	}
-
 	type linksDepth struct {
-		links []*format.Link
-		depth int
+		links  []*format.Link
+		parent PrefetchCandidate
 	}
 
-	feed := make(chan cidDepth)
+	feed := make(chan PrefetchCandidate)
 	out := make(chan linksDepth)
-	done := make(chan struct{})
+	// done receives the depth of the nodes processed.
+	done := make(chan int)
 
 	var visitlk sync.Mutex
 	var wg sync.WaitGroup
@@ -488,8 +494,8 @@ func parallelWalkDepth(ctx context.Context, getLinks GetLinks, root cid.Cid, vis
 		go func() {
 			defer wg.Done()
 			for cdepth := range feed {
-				ci := cdepth.cid
-				depth := cdepth.depth
+				ci := cdepth.Cid
+				depth := cdepth.Depth
 
 				var shouldVisit bool
 
@@ -516,8 +522,8 @@ func parallelWalkDepth(ctx context.Context, getLinks GetLinks, root cid.Cid, vis
 					}
 
 					outLinks := linksDepth{
-						links: links,
-						depth: depth + 1,
+						links:  links,
+						parent: cdepth,
 					}
 
 					select {
@@ -527,7 +533,7 @@ func parallelWalkDepth(ctx context.Context, getLinks GetLinks, root cid.Cid, vis
 					}
 				}
 				select {
-				case done <- struct{}{}:
+				case done <- depth:
 				case <-fetchersCtx.Done():
 				}
 			}
@@ -535,43 +541,51 @@ func parallelWalkDepth(ctx context.Context, getLinks GetLinks, root cid.Cid, vis
 	}
 	defer close(feed)
 
-	send := feed
-	var todoQueue deque.Deque[cidDepth]
-	var inProgress int
-
-	next := cidDepth{
-		cid:   root,
-		depth: 0,
+	strategy := options.Prefetch
+	if strategy == nil {
+		strategy = PrefetchConfig{}
+	}
+	// The paths of the nodes are only needed to order them by link.
+	trackPaths := true
+	if cfg, ok := strategy.(PrefetchConfig); ok {
+		trackPaths = cfg.LinkOrder
 	}
+	var a, b PrefetchCandidate
+
+	var todoQueue deque.Deque[PrefetchCandidate]
+	todoQueue.PushBack(PrefetchCandidate{Cid: root})
+	inFlight := make(map[int]int)
+	var inProgress int
 
 	for {
+		if inProgress == 0 && todoQueue.Len() == 0 {
+			return nil
+		}
+
+		var send chan<- PrefetchCandidate
+		var next PrefetchCandidate
+		nextIndex := nextPrefetch(strategy, &todoQueue, inFlight, &a, &b)
+		if nextIndex >= 0 {
+			send = feed
+			next = todoQueue.At(nextIndex)
+		}
+
 		select {
 		case send <- next:
+			todoQueue.Remove(nextIndex)
 			inProgress++
-			if todoQueue.Len() > 0 {
-				next = todoQueue.PopFront()
-			} else {
-				next = cidDepth{}
-				send = nil
-			}
-		case <-done:
+			inFlight[next.Depth]++
+		case depth := <-done:
 			inProgress--
-			if inProgress == 0 && !next.cid.Defined() {
-				return nil
-			}
+			inFlight[depth]--
 		case linksDepth := <-out:
-			for _, lnk := range linksDepth.links {
-				cd := cidDepth{
-					cid:   lnk.Cid,
-					depth: linksDepth.depth,
-				}
-
-				if !next.cid.Defined() {
-					next = cd
-					send = feed
-				} else {
-					todoQueue.PushBack(cd)
+			parent := linksDepth.parent
+			for i, lnk := range linksDepth.links {
+				cand := PrefetchCandidate{Cid: lnk.Cid, Depth: parent.Depth + 1}
+				if trackPaths {
+					cand.Path = append(parent.Path[:len(parent.Path):len(parent.Path)], i)
 				}
+				todoQueue.PushBack(cand)
 			}
 		case err := <-errChan:
 			return err
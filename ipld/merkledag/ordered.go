@@ -0,0 +1,135 @@
+package merkledag
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// DefaultOrderedMaxBufferSize is the default maximum number of bytes of node
+// data that [GetManyOrdered] buffers while waiting for an earlier node.
+const DefaultOrderedMaxBufferSize = 32 << 20 // 32 MiB
+
+// orderedOptions represent the parameters of GetManyOrdered
+type orderedOptions struct {
+	Concurrency   int
+	MaxBufferSize int
+}
+
+// OrderedOption is a setter for orderedOptions
+type OrderedOption func(*orderedOptions)
+
+// OrderedConcurrency sets the maximum number of nodes fetched in parallel by
+// [GetManyOrdered]. Defaults to 32.
+func OrderedConcurrency(worker int) OrderedOption {
+	return func(opts *orderedOptions) {
+		opts.Concurrency = worker
+	}
+}
+
+// OrderedMaxBufferSize sets the maximum number of bytes of node data that
+// [GetManyOrdered] keeps in memory for nodes that arrived before the ones
+// preceding them. Once the limit is reached, no new fetch is started until the
+// buffer drains. Nodes that are still being fetched are not accounted for, so
+// memory use is bounded by this size plus [OrderedConcurrency] nodes. Defaults
+// to [DefaultOrderedMaxBufferSize].
+func OrderedMaxBufferSize(size int) OrderedOption {
+	return func(opts *orderedOptions) {
+		opts.MaxBufferSize = size
+	}
+}
+
+type orderedResult struct {
+	index int
+	node  format.Node
+	err   error
+}
+
+// GetManyOrdered fetches the nodes for the given keys with up to
+// [OrderedConcurrency] fetches in flight, and sends them on the returned
+// channel in the same order as keys. Duplicate keys are returned once per
+// occurrence.
+//
+// Unlike [format.NodeGetter.GetMany], every key yields exactly one result. If
+// a node can not be fetched, its error is sent in its position and no further
+// results are sent. The channel is closed once all results have been sent, an
+// error has been sent or the context is cancelled.
+func GetManyOrdered(ctx context.Context, ng format.NodeGetter, keys []cid.Cid, options ...OrderedOption) <-chan *format.NodeOption {
+	opts := orderedOptions{
+		Concurrency:   defaultConcurrentFetch,
+		MaxBufferSize: DefaultOrderedMaxBufferSize,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	out := make(chan *format.NodeOption, opts.Concurrency)
+	go func() {
+		defer close(out)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Workers never block on send: at most Concurrency fetches are in
+		// flight and the channel has room for all of them.
+		results := make(chan orderedResult, opts.Concurrency)
+		pending := make(map[int]orderedResult)
+		var next, started, inflight, buffered int
+
+		for next < len(keys) {
+			// Start fetches while there is room. The next node to emit is
+			// always either in flight or already emitted when the buffer is
+			// non-empty, so this can never deadlock.
+			for started < len(keys) && inflight < opts.Concurrency && (buffered < opts.MaxBufferSize || started == next) {
+				go func(i int) {
+					nd, err := ng.Get(ctx, keys[i])
+					results <- orderedResult{index: i, node: nd, err: err}
+				}(started)
+				started++
+				inflight++
+			}
+
+			select {
+			case res := <-results:
+				inflight--
+				pending[res.index] = res
+				if res.node != nil {
+					buffered += len(res.node.RawData())
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			for {
+				res, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+
+				var nodeOpt *format.NodeOption
+				if res.err != nil {
+					nodeOpt = &format.NodeOption{Err: res.err}
+				} else {
+					buffered -= len(res.node.RawData())
+					nodeOpt = &format.NodeOption{Node: res.node}
+				}
+
+				select {
+				case out <- nodeOpt:
+				case <-ctx.Done():
+					return
+				}
+				if res.err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,167 @@
+package merkledag_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/ipfs/boxo/ipld/merkledag"
+	dstest "github.com/ipfs/boxo/ipld/merkledag/test"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// delayGetter delays every Get by a random duration, so that nodes complete
+// out of order.
+type delayGetter struct {
+	ipld.NodeGetter
+	started atomic.Int64
+}
+
+func (dg *delayGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	dg.started.Add(1)
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+	return dg.NodeGetter.Get(ctx, c)
+}
+
+func addOrderedTestNodes(t *testing.T, ds ipld.DAGService, n int) []cid.Cid {
+	ctx := context.Background()
+	keys := make([]cid.Cid, 0, n)
+	for i := 0; i < n; i++ {
+		nd := NodeWithData([]byte{byte(i), byte(i >> 8)})
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, nd.Cid())
+	}
+	return keys
+}
+
+func TestGetManyOrdered(t *testing.T) {
+	ctx := context.Background()
+	ds := dstest.Mock()
+	keys := addOrderedTestNodes(t, ds, 100)
+	// Duplicates are returned once per occurrence.
+	keys = append(keys, keys[3], keys[3])
+
+	var i int
+	for opt := range GetManyOrdered(ctx, &delayGetter{NodeGetter: ds}, keys, OrderedConcurrency(16)) {
+		if opt.Err != nil {
+			t.Fatal(opt.Err)
+		}
+		if !opt.Node.Cid().Equals(keys[i]) {
+			t.Fatalf("result %d: got %s, expected %s", i, opt.Node.Cid(), keys[i])
+		}
+		i++
+	}
+	if i != len(keys) {
+		t.Fatalf("got %d results, expected %d", i, len(keys))
+	}
+}
+
+func TestGetManyOrderedError(t *testing.T) {
+	ctx := context.Background()
+	ds := dstest.Mock()
+	keys := addOrderedTestNodes(t, ds, 10)
+	// A sha256 CID missing from the store, unlike the identity CIDs which
+	// always resolve.
+	keys[5] = NodeWithData([]byte("missing")).Cid()
+
+	var i int
+	for opt := range GetManyOrdered(ctx, &delayGetter{NodeGetter: ds}, keys) {
+		if i < 5 {
+			if opt.Err != nil {
+				t.Fatal(opt.Err)
+			}
+		} else if !ipld.IsNotFound(opt.Err) {
+			t.Fatalf("expected not found error at position 5, got %v", opt.Err)
+		}
+		i++
+	}
+	if i != 6 {
+		t.Fatalf("got %d results, expected 6", i)
+	}
+}
+
+// blockFirstGetter blocks the fetch of the first key until released.
+type blockFirstGetter struct {
+	ipld.NodeGetter
+	first   cid.Cid
+	release chan struct{}
+	started atomic.Int64
+}
+
+func (bg *blockFirstGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	bg.started.Add(1)
+	if c.Equals(bg.first) {
+		select {
+		case <-bg.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return bg.NodeGetter.Get(ctx, c)
+}
+
+func TestGetManyOrderedMaxBufferSize(t *testing.T) {
+	ctx := context.Background()
+	ds := dstest.Mock()
+	keys := addOrderedTestNodes(t, ds, 50)
+
+	nd, err := ds.Get(ctx, keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(nd.RawData())
+
+	bg := &blockFirstGetter{NodeGetter: ds, first: keys[0], release: make(chan struct{})}
+	out := GetManyOrdered(ctx, bg, keys, OrderedConcurrency(8), OrderedMaxBufferSize(4*size))
+
+	// While the first node is blocked, only enough nodes to fill the buffer
+	// may be fetched on top of the ones in flight.
+	time.Sleep(50 * time.Millisecond)
+	if started := bg.started.Load(); started > 8+4 {
+		t.Fatalf("started %d fetches while the buffer is full", started)
+	}
+	close(bg.release)
+
+	var i int
+	for opt := range out {
+		if opt.Err != nil {
+			t.Fatal(opt.Err)
+		}
+		if !opt.Node.Cid().Equals(keys[i]) {
+			t.Fatalf("result %d: got %s, expected %s", i, opt.Node.Cid(), keys[i])
+		}
+		i++
+	}
+	if i != len(keys) {
+		t.Fatalf("got %d results, expected %d", i, len(keys))
+	}
+}
+
+func TestGetManyOrderedCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ds := dstest.Mock()
+	keys := addOrderedTestNodes(t, ds, 10)
+
+	bg := &blockFirstGetter{NodeGetter: ds, first: keys[0], release: make(chan struct{})}
+	out := GetManyOrdered(ctx, bg, keys)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for opt := range out {
+			if opt.Err != nil && !errors.Is(opt.Err, context.Canceled) {
+				t.Error(opt.Err)
+			}
+		}
+	}()
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,105 @@
+package merkledag
+
+import (
+	"slices"
+
+	"github.com/gammazero/deque"
+	cid "github.com/ipfs/go-cid"
+)
+
+// PrefetchCandidate is a node discovered by a concurrent walk, that is not
+// fetched yet.
+type PrefetchCandidate struct {
+	Cid   cid.Cid
+	Depth int
+	// Path is the position of the node in the DAG: the indexes of the links
+	// followed from the root to reach it. It is not set when the strategy is
+	// a [PrefetchConfig] without LinkOrder, which does not need it.
+	Path []int
+}
+
+// PrefetchStrategy decides which node a concurrent walk fetches next, among
+// the nodes discovered so far, so that walks can be tuned for different
+// storage and network characteristics. See [Prefetch].
+type PrefetchStrategy interface {
+	// Window returns the number of the oldest discovered nodes among which
+	// the next node to fetch is chosen. Values under 1 mean 1.
+	Window() int
+
+	// LevelConcurrency returns the maximum number of nodes at depth fetched
+	// at the same time, or 0 for no limit other than the concurrency of the
+	// walk.
+	LevelConcurrency(depth int) int
+
+	// Less reports whether a must be fetched before b.
+	Less(a, b *PrefetchCandidate) bool
+}
+
+// PrefetchConfig is a [PrefetchStrategy] with the same settings for every
+// level of the DAG. The zero value fetches the nodes in the order they are
+// discovered, which is the default of concurrent walks.
+type PrefetchConfig struct {
+	// BreadthWindow is the number of the oldest discovered nodes among which
+	// the next node to fetch is chosen. Larger windows make LinkOrder closer
+	// to a depth-first order. Defaults to 1.
+	BreadthWindow int
+
+	// PerLevelConcurrency, if positive, limits the number of nodes at the same
+	// depth fetched at the same time, for instance to start fetching the
+	// children of the first nodes of a wide level before the whole level is
+	// fetched.
+	PerLevelConcurrency int
+
+	// LinkOrder fetches the nodes of the window in the order of their links,
+	// that is the nodes under the first link of a node before the nodes under
+	// the next ones, which suits storages and peers serving the blocks of a
+	// DAG in this order.
+	LinkOrder bool
+}
+
+var _ PrefetchStrategy = PrefetchConfig{}
+
+func (c PrefetchConfig) Window() int {
+	return c.BreadthWindow
+}
+
+func (c PrefetchConfig) LevelConcurrency(int) int {
+	return c.PerLevelConcurrency
+}
+
+func (c PrefetchConfig) Less(a, b *PrefetchCandidate) bool {
+	return c.LinkOrder && slices.Compare(a.Path, b.Path) < 0
+}
+
+// Prefetch is a WalkOption setting the strategy deciding the order in which
+// the nodes are fetched by a concurrent walk, see [Concurrent] and
+// [Concurrency]. It has no effect on sequential walks.
+func Prefetch(strategy PrefetchStrategy) WalkOption {
+	return func(walkOptions *walkOptions) {
+		walkOptions.Prefetch = strategy
+	}
+}
+
+// nextPrefetch returns the index in queue of the next node to fetch, or -1 if
+// none can be fetched until a fetch in flight completes. inFlight is the
+// number of nodes fetched at each depth. a and b hold the candidates compared
+// with the strategy, so that the queue holds no pointers.
+func nextPrefetch(strategy PrefetchStrategy, queue *deque.Deque[PrefetchCandidate], inFlight map[int]int, a, b *PrefetchCandidate) int {
+	n := min(max(strategy.Window(), 1), queue.Len())
+	next := -1
+	for i := 0; i < n; i++ {
+		c := queue.At(i)
+		if limit := strategy.LevelConcurrency(c.Depth); limit > 0 && inFlight[c.Depth] >= limit {
+			continue
+		}
+		if next < 0 {
+			next = i
+			continue
+		}
+		*a, *b = c, queue.At(next)
+		if strategy.Less(a, b) {
+			next = i
+		}
+	}
+	return next
+}
@@ -0,0 +1,106 @@
+package merkledag
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gammazero/deque"
+	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestNextPrefetch(t *testing.T) {
+	var queue deque.Deque[PrefetchCandidate]
+	for _, c := range []PrefetchCandidate{
+		{Depth: 1, Path: []int{1}},
+		{Depth: 2, Path: []int{0, 1}},
+		{Depth: 2, Path: []int{0, 0}},
+		{Depth: 1, Path: []int{0}},
+	} {
+		queue.PushBack(c)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		strategy PrefetchConfig
+		inFlight map[int]int
+		next     int
+	}{
+		{"default", PrefetchConfig{}, nil, 0},
+		{"window without order", PrefetchConfig{BreadthWindow: 3}, nil, 0},
+		{"link order", PrefetchConfig{BreadthWindow: 3, LinkOrder: true}, nil, 2},
+		{"link order in the whole queue", PrefetchConfig{BreadthWindow: 10, LinkOrder: true}, nil, 3},
+		{"level concurrency", PrefetchConfig{BreadthWindow: 10, LinkOrder: true, PerLevelConcurrency: 1}, map[int]int{1: 1}, 2},
+		{"level concurrency blocks", PrefetchConfig{PerLevelConcurrency: 2}, map[int]int{1: 2}, -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var a, b PrefetchCandidate
+			if next := nextPrefetch(tc.strategy, &queue, tc.inFlight, &a, &b); next != tc.next {
+				t.Fatalf("next is %d, expected %d", next, tc.next)
+			}
+		})
+	}
+}
+
+func TestWalkPrefetch(t *testing.T) {
+	// A tree of width 4 and depth 3, whose nodes are named by their path.
+	const width, maxDepth = 4, 3
+	nodeCid := func(name string) cid.Cid {
+		h, err := mh.Sum([]byte(name), mh.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cid.NewCidV1(cid.Raw, h)
+	}
+	names := map[cid.Cid]string{}
+	var register func(name string)
+	register = func(name string) {
+		names[nodeCid(name)] = name
+		if len(name) < maxDepth {
+			for i := 0; i < width; i++ {
+				register(fmt.Sprint(name, i))
+			}
+		}
+	}
+	register("")
+
+	var lk sync.Mutex
+	inFlight := map[int]int{}
+	var maxInFlight int
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*format.Link, error) {
+		name := names[c]
+		lk.Lock()
+		inFlight[len(name)]++
+		maxInFlight = max(maxInFlight, inFlight[len(name)])
+		lk.Unlock()
+		defer func() {
+			lk.Lock()
+			inFlight[len(name)]--
+			lk.Unlock()
+		}()
+
+		var links []*format.Link
+		if len(name) < maxDepth {
+			for i := 0; i < width; i++ {
+				links = append(links, &format.Link{Cid: nodeCid(fmt.Sprint(name, i))})
+			}
+		}
+		return links, nil
+	}
+
+	set := cid.NewSet()
+	strategy := PrefetchConfig{BreadthWindow: 16, PerLevelConcurrency: 2, LinkOrder: true}
+	err := Walk(context.Background(), getLinks, nodeCid(""), set.Visit, Concurrency(8), Prefetch(strategy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != len(names) {
+		t.Fatalf("visited %d nodes, expected %d", set.Len(), len(names))
+	}
+	if maxInFlight > strategy.PerLevelConcurrency {
+		t.Fatalf("fetched %d nodes of a level at the same time, expected at most %d", maxInFlight, strategy.PerLevelConcurrency)
+	}
+}
@@ -29,9 +29,23 @@ type Options struct {
 	Func    Func            // the function to perform at each step
 	ErrFunc ErrFunc         // see ErrFunc. Optional
 
+	// LinkFilter, if set, is called for each link of the visited nodes
+	// before the linked node is fetched. Links it returns false for are not
+	// followed, pruning their subtree from the traversal. Optional
+	LinkFilter LinkFilter
+
 	SkipDuplicates bool // whether to skip duplicate nodes
 }
 
+// ErrSkipChildren can be returned by a Func to skip the children of the
+// current node, and continue the traversal with the rest of the DAG. It is
+// ignored in DFSPost order, where the children are visited before the node.
+var ErrSkipChildren = errors.New("skip children")
+
+// LinkFilter is the type of the function deciding whether the traversal
+// follows the link l of the current node.
+type LinkFilter func(current State, l *ipld.Link) bool
+
 // State is a current traversal state
 type State struct {
 	Node  ipld.Node
@@ -39,6 +53,7 @@ type State struct {
 }
 
 type traversal struct {
+	ctx  context.Context
 	opts Options
 	seen map[string]struct{}
 }
@@ -59,13 +74,17 @@ func (t *traversal) callFunc(next State) error {
 	return t.opts.Func(next)
 }
 
+func (t *traversal) followLink(curr State, l *ipld.Link) bool {
+	return t.opts.LinkFilter == nil || t.opts.LinkFilter(curr, l)
+}
+
 // getNode returns the node for link. If it return an error,
 // stop processing. if it returns a nil node, just skip it.
 //
 // the error handling is a little complicated.
 func (t *traversal) getNode(link *ipld.Link) (ipld.Node, error) {
 	getNode := func(l *ipld.Link) (ipld.Node, error) {
-		next, err := l.GetNode(context.TODO(), t.opts.DAG)
+		next, err := l.GetNode(t.ctx, t.opts.DAG)
 		if err != nil {
 			return nil, err
 		}
@@ -87,7 +106,7 @@ func (t *traversal) getNode(link *ipld.Link) (ipld.Node, error) {
 
 // Func is the type of the function called for each dag.Node visited by Traverse.
 // The traversal argument contains the current traversal state.
-// If an error is returned, processing stops.
+// If an error is returned, processing stops, unless it is ErrSkipChildren.
 type Func func(current State) error
 
 // ErrFunc is provided to handle problems when walking to the Node. Traverse
@@ -104,7 +123,60 @@ type ErrFunc func(err error) error
 // Traverse initiates a DAG traversal with the given options starting at
 // the given root.
 func Traverse(root ipld.Node, o Options) error {
+	return traverse(context.TODO(), root, o)
+}
+
+// Result is a state of a traversal run by TraverseChan, or the error that
+// stopped it.
+type Result struct {
+	State State
+	Err   error
+}
+
+// TraverseChan runs a DAG traversal with the given options starting at the
+// given root, and sends its states in order on the returned channel, which is
+// closed once the traversal is over. The traversal waits for each state to be
+// received before going on, and stops when ctx is canceled, which also
+// cancels the fetching of the nodes. If the traversal fails, other than
+// because ctx is canceled, its error is sent last.
+//
+// o.Func is optional. If set, it is called for each state before the state
+// is sent, and can return ErrSkipChildren to prune the traversal, or any
+// other error to stop it without sending the state.
+func TraverseChan(ctx context.Context, root ipld.Node, o Options) <-chan Result {
+	out := make(chan Result)
+
+	fn := o.Func
+	o.Func = func(current State) error {
+		var err error
+		if fn != nil {
+			if err = fn(current); err != nil && !errors.Is(err, ErrSkipChildren) {
+				return err
+			}
+		}
+		select {
+		case out <- Result{State: current}:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(out)
+		if err := traverse(ctx, root, o); err != nil && ctx.Err() == nil {
+			select {
+			case out <- Result{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func traverse(ctx context.Context, root ipld.Node, o Options) error {
 	t := traversal{
+		ctx:  ctx,
 		opts: o,
 		seen: map[string]struct{}{},
 	}
@@ -130,6 +202,9 @@ type dfsFunc func(state State, t *traversal) error
 
 func dfsPreTraverse(state State, t *traversal) error {
 	if err := t.callFunc(state); err != nil {
+		if errors.Is(err, ErrSkipChildren) {
+			return nil
+		}
 		return err
 	}
 	return dfsDescend(dfsPreTraverse, state, t)
@@ -139,11 +214,17 @@ func dfsPostTraverse(state State, t *traversal) error {
 	if err := dfsDescend(dfsPostTraverse, state, t); err != nil {
 		return err
 	}
-	return t.callFunc(state)
+	if err := t.callFunc(state); !errors.Is(err, ErrSkipChildren) {
+		return err
+	}
+	return nil
 }
 
 func dfsDescend(df dfsFunc, curr State, t *traversal) error {
 	for _, l := range curr.Node.Links() {
+		if !t.followLink(curr, l) {
+			continue
+		}
 		node, err := t.getNode(l)
 		if err != nil {
 			return err
@@ -178,10 +259,16 @@ func bfsTraverse(root State, t *traversal) error {
 
 		// call user's func
 		if err := t.callFunc(curr); err != nil {
+			if errors.Is(err, ErrSkipChildren) {
+				continue
+			}
 			return err
 		}
 
 		for _, l := range curr.Node.Links() {
+			if !t.followLink(curr, l) {
+				continue
+			}
 			node, err := t.getNode(l)
 			if err != nil {
 				return err
@@ -324,14 +324,126 @@ func TestBFSSkip(t *testing.T) {
 `))
 }
 
+func TestSkipChildren(t *testing.T) {
+	ds := mdagtest.Mock()
+	skip := func(current State) error {
+		if string(current.Node.(*mdag.ProtoNode).Data()) == "/a/aa" {
+			return ErrSkipChildren
+		}
+		return nil
+	}
+
+	testWalkOutputs(t, newBinaryTree(t, ds), Options{Order: DFSPre, DAG: ds, Func: skip}, []byte(`
+0 /a
+1 /a/aa
+1 /a/ab
+2 /a/ab/aba
+2 /a/ab/abb
+`))
+
+	testWalkOutputs(t, newBinaryTree(t, ds), Options{Order: BFS, DAG: ds, Func: skip}, []byte(`
+0 /a
+1 /a/aa
+1 /a/ab
+2 /a/ab/aba
+2 /a/ab/abb
+`))
+
+	// Children are visited first in post-order.
+	testWalkOutputs(t, newBinaryTree(t, ds), Options{Order: DFSPost, DAG: ds, Func: skip}, []byte(`
+2 /a/aa/aaa
+2 /a/aa/aab
+1 /a/aa
+2 /a/ab/aba
+2 /a/ab/abb
+1 /a/ab
+0 /a
+`))
+}
+
+func TestLinkFilter(t *testing.T) {
+	ds := mdagtest.Mock()
+	filter := func(current State, l *ipld.Link) bool {
+		return l.Name != "/a2/a/ab" && l.Name != "/a/aa2/a/aa/aab"
+	}
+
+	for _, order := range []Order{DFSPre, BFS} {
+		testWalkOutputs(t, newBinaryTree(t, ds), Options{Order: order, DAG: ds, LinkFilter: filter}, []byte(`
+0 /a
+1 /a/aa
+2 /a/aa/aaa
+`))
+	}
+
+	testWalkOutputs(t, newBinaryTree(t, ds), Options{Order: DFSPost, DAG: ds, LinkFilter: filter}, []byte(`
+2 /a/aa/aaa
+1 /a/aa
+0 /a
+`))
+}
+
+func TestTraverseChan(t *testing.T) {
+	ds := mdagtest.Mock()
+	root := newBinaryTree(t, ds)
+	skip := func(current State) error {
+		if string(current.Node.(*mdag.ProtoNode).Data()) == "/a/aa" {
+			return ErrSkipChildren
+		}
+		return nil
+	}
+
+	var actual []string
+	for res := range TraverseChan(context.Background(), root, Options{Order: BFS, DAG: ds, Func: skip}) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		actual = append(actual, fmt.Sprintf("%d %s", res.State.Depth, res.State.Node.(*mdag.ProtoNode).Data()))
+	}
+	expect := []string{"0 /a", "1 /a/aa", "1 /a/ab", "2 /a/ab/aba", "2 /a/ab/abb"}
+	if fmt.Sprint(actual) != fmt.Sprint(expect) {
+		t.Fatalf("expected %v, got %v", expect, actual)
+	}
+
+	// Canceling the context stops the traversal.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := TraverseChan(ctx, root, Options{Order: DFSPre, DAG: ds})
+	if res := <-ch; res.Err != nil || res.State.Node != root {
+		t.Fatalf("unexpected first result %v", res)
+	}
+	cancel()
+	for res := range ch {
+		if res.Err != nil {
+			t.Fatalf("unexpected error after cancellation: %s", res.Err)
+		}
+	}
+
+	// Errors are sent last.
+	missing := mdag.NodeWithData([]byte("/missing"))
+	broken := mdag.NodeWithData([]byte("/a"))
+	if err := broken.AddNodeLink("missing", missing); err != nil {
+		t.Fatal(err)
+	}
+	var results []Result
+	for res := range TraverseChan(context.Background(), broken, Options{Order: DFSPre, DAG: ds}) {
+		results = append(results, res)
+	}
+	if len(results) != 2 || results[0].State.Node != broken || !ipld.IsNotFound(results[1].Err) {
+		t.Fatalf("expected the root then a not found error, got %v", results)
+	}
+}
+
 func testWalkOutputs(t *testing.T, root ipld.Node, opts Options, expect []byte) {
 	expect = bytes.TrimLeft(expect, "\n")
 
 	buf := new(bytes.Buffer)
+	f := opts.Func
 	walk := func(current State) error {
 		s := fmt.Sprintf("%d %s\n", current.Depth, current.Node.(*mdag.ProtoNode).Data())
 		t.Logf("walk: %s", s)
 		buf.Write([]byte(s))
+		if f != nil {
+			return f(current)
+		}
 		return nil
 	}
 
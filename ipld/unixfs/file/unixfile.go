@@ -25,6 +25,9 @@ type ufsDirectory struct {
 	size  int64
 	mode  os.FileMode
 	mtime time.Time
+
+	// number of entries, -1 if unknown (HAMT sharded directories)
+	entries int
 }
 
 type ufsIterator struct {
@@ -134,6 +137,15 @@ func (d *ufsDirectory) Size() (int64, error) {
 	return d.size, nil
 }
 
+// EntryCount implements [files.EntryCounter] for the basic directories, whose
+// entries are the links of their node.
+func (d *ufsDirectory) EntryCount() (int, error) {
+	if d.entries < 0 {
+		return 0, files.ErrNotSupported
+	}
+	return d.entries, nil
+}
+
 type ufsFile struct {
 	uio.DagReader
 }
@@ -166,14 +178,20 @@ func newUnixfsDir(ctx context.Context, dserv ipld.DAGService, nd *dag.ProtoNode)
 		return nil, err
 	}
 
+	entries := -1
+	if fsn.Type() == ft.TDirectory {
+		entries = len(nd.Links())
+	}
+
 	return &ufsDirectory{
 		ctx:   ctx,
 		dserv: dserv,
 
-		dir:   dir,
-		size:  int64(size),
-		mode:  fsn.Mode(),
-		mtime: fsn.ModTime(),
+		dir:     dir,
+		size:    int64(size),
+		entries: entries,
+		mode:    fsn.Mode(),
+		mtime:   fsn.ModTime(),
 	}, nil
 }
 
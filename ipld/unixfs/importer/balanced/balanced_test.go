@@ -3,6 +3,7 @@ package balanced
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	mrand "math/rand"
@@ -15,8 +16,10 @@ import (
 	chunker "github.com/ipfs/boxo/chunker"
 	dag "github.com/ipfs/boxo/ipld/merkledag"
 	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-test/random"
+	mh "github.com/multiformats/go-multihash"
 )
 
 // TODO: extract these tests and more as a generic layout test suite
@@ -383,3 +386,130 @@ func testMetadata(t *testing.T, buf *bytes.Buffer) {
 		t.Errorf("got filemode %o, wanted %o", dr.Mode(), dbp.FileMode)
 	}
 }
+
+// addOrderDAGService records the order in which nodes are added.
+type addOrderDAGService struct {
+	ipld.DAGService
+	added []cid.Cid
+}
+
+func (ds *addOrderDAGService) Add(ctx context.Context, nd ipld.Node) error {
+	ds.added = append(ds.added, nd.Cid())
+	return ds.DAGService.Add(ctx, nd)
+}
+
+func TestParallelLeaves(t *testing.T) {
+	data := make([]byte, 300*1000)
+	random.NewRand().Read(data)
+
+	build := func(t *testing.T, size int, rawLeaves bool, parallelism int) (ipld.Node, []cid.Cid) {
+		ds := &addOrderDAGService{DAGService: mdtest.Mock()}
+		db, err := (&h.DagBuilderParams{
+			Dagserv:     ds,
+			Maxlinks:    8,
+			RawLeaves:   rawLeaves,
+			Parallelism: parallelism,
+		}).New(chunker.NewSizeSplitter(bytes.NewReader(data[:size]), 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err := Layout(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd, ds.added
+	}
+
+	for _, size := range []int{0, 500, 1000, 8500, len(data)} {
+		for _, rawLeaves := range []bool{false, true} {
+			t.Run(fmt.Sprintf("size=%d/rawLeaves=%t", size, rawLeaves), func(t *testing.T) {
+				want, wantAdded := build(t, size, rawLeaves, 0)
+				got, gotAdded := build(t, size, rawLeaves, 4)
+				if !got.Cid().Equals(want.Cid()) {
+					t.Fatalf("got root %s, wanted %s", got.Cid(), want.Cid())
+				}
+				if fmt.Sprint(gotAdded) != fmt.Sprint(wantAdded) {
+					t.Fatal("nodes were not added in the same order")
+				}
+			})
+		}
+	}
+}
+
+// failingSplitter returns an error after n chunks.
+type failingSplitter struct {
+	chunker.Splitter
+	n int
+}
+
+func (s *failingSplitter) NextBytes() ([]byte, error) {
+	if s.n == 0 {
+		return nil, errors.New("read failed")
+	}
+	s.n--
+	return s.Splitter.NextBytes()
+}
+
+func TestParallelLeavesError(t *testing.T) {
+	spl := &failingSplitter{
+		Splitter: chunker.NewSizeSplitter(random.NewRand(), 1000),
+		n:        50,
+	}
+	db, err := (&h.DagBuilderParams{
+		Dagserv:     mdtest.Mock(),
+		Maxlinks:    8,
+		Parallelism: 4,
+	}).New(spl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Layout(db); err == nil || err.Error() != "read failed" {
+		t.Fatalf("expected the error of the splitter, got %v", err)
+	}
+}
+
+func TestNodeBuilder(t *testing.T) {
+	data := random.Bytes(10 * 1024)
+	blake3, err := dag.NewProtoNodeBuilder(dag.WithCidVersion(1), dag.WithHashFunction(mh.BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(t *testing.T, nb *dag.ProtoNodeBuilder, rawLeaves bool) []cid.Cid {
+		ds := &addOrderDAGService{DAGService: mdtest.Mock()}
+		_, err := buildTestDagWithParams(chunker.NewSizeSplitter(bytes.NewReader(data), 1024), h.DagBuilderParams{
+			Dagserv:     ds,
+			Maxlinks:    4,
+			RawLeaves:   rawLeaves,
+			NodeBuilder: nb,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ds.added
+	}
+	checkPrefix := func(t *testing.T, cids []cid.Cid, version, mhType uint64) {
+		t.Helper()
+		for _, c := range cids {
+			expected := version
+			if c.Type() == cid.Raw {
+				// Raw leaves are always CIDv1.
+				expected = 1
+			}
+			if c.Version() != expected || c.Prefix().MhType != mhType {
+				t.Fatalf("expected CIDv%d with multihash 0x%x, got %s", expected, mhType, c)
+			}
+		}
+	}
+
+	for _, rawLeaves := range []bool{false, true} {
+		t.Run(fmt.Sprintf("rawLeaves=%t", rawLeaves), func(t *testing.T) {
+			checkPrefix(t, build(t, nil, rawLeaves), 0, mh.SHA2_256)
+			checkPrefix(t, build(t, blake3, rawLeaves), 1, mh.BLAKE3)
+
+			defer func(nb *dag.ProtoNodeBuilder) { dag.DefaultProtoNodeBuilder = nb }(dag.DefaultProtoNodeBuilder)
+			dag.DefaultProtoNodeBuilder = blake3
+			checkPrefix(t, build(t, nil, rawLeaves), 1, mh.BLAKE3)
+		})
+	}
+}
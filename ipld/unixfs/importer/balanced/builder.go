@@ -130,6 +130,8 @@ import (
 //	  | Chunk 1 |   | Chunk 2 |   | Chunk 3 |
 //	  +=========+   +=========+   + - - - - +
 func Layout(db *h.DagBuilderHelper) (ipld.Node, error) {
+	defer db.Close()
+
 	var root ipld.Node
 	var err error
 
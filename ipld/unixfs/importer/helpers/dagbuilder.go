@@ -31,8 +31,12 @@ type DagBuilderHelper struct {
 	nextData    []byte // the next item to return.
 	maxlinks    int
 	cidBuilder  cid.Builder
+	nodeBuilder *dag.ProtoNodeBuilder
 	fileMode    os.FileMode
 	fileModTime time.Time
+	parallelism int
+	pipeline    *leafPipeline
+	leafType    pb.Data_DataType
 
 	// Filestore support variables.
 	// ----------------------------
@@ -59,9 +63,13 @@ type DagBuilderParams struct {
 	// instead of using the unixfs TRaw type
 	RawLeaves bool
 
-	// CID Builder to use if set
+	// CID Builder to use if set. It takes precedence over NodeBuilder.
 	CidBuilder cid.Builder
 
+	// NodeBuilder picks the CID version and hash function of the nodes when
+	// CidBuilder is not set. Defaults to merkledag.DefaultProtoNodeBuilder.
+	NodeBuilder *dag.ProtoNodeBuilder
+
 	// DAGService to write blocks to (required)
 	Dagserv ipld.DAGService
 
@@ -74,6 +82,13 @@ type DagBuilderParams struct {
 	// NoCopy signals to the chunker that it should track fileinfo for
 	// filestore adds
 	NoCopy bool
+
+	// Parallelism is the number of leaf nodes encoded and hashed
+	// concurrently. Up to twice as many chunks are read ahead of the
+	// layout. The resulting DAG, and the order in which its nodes are added
+	// to the DAGService, do not depend on it. Values below 2 build the
+	// leaves one at a time.
+	Parallelism int
 }
 
 // New generates a new DagBuilderHelper from the given params and a given
@@ -87,6 +102,14 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 		maxlinks:    dbp.Maxlinks,
 		fileMode:    dbp.FileMode,
 		fileModTime: dbp.FileModTime,
+		parallelism: dbp.Parallelism,
+	}
+	if db.cidBuilder == nil {
+		db.nodeBuilder = dbp.NodeBuilder
+		if db.nodeBuilder == nil {
+			db.nodeBuilder = dag.DefaultProtoNodeBuilder
+		}
+		db.cidBuilder = db.nodeBuilder.CidBuilder()
 	}
 	if fi, ok := spl.Reader().(files.FileInfo); dbp.NoCopy && ok {
 		db.fullPath = fi.AbsPath()
@@ -117,6 +140,11 @@ func (db *DagBuilderHelper) prepareNext() {
 
 // Done returns whether or not we're done consuming the incoming data.
 func (db *DagBuilderHelper) Done() bool {
+	if db.pipeline != nil {
+		r := db.pipeline.peek()
+		return r == nil
+	}
+
 	// ensure we have an accurate perspective on data
 	// as `done` this may be called before `next`.
 	db.prepareNext() // idempotent
@@ -130,6 +158,14 @@ func (db *DagBuilderHelper) Done() bool {
 // if it returns nil, that signifies that the stream is at an end, and
 // that the current building operation should finish.
 func (db *DagBuilderHelper) Next() ([]byte, error) {
+	if db.pipeline != nil {
+		r := db.pipeline.pop()
+		if r == nil {
+			return nil, nil
+		}
+		return r.data, r.err
+	}
+
 	db.prepareNext() // idempotent
 	d := db.nextData
 	db.nextData = nil // signal we've consumed it
@@ -139,6 +175,16 @@ func (db *DagBuilderHelper) Next() ([]byte, error) {
 	return d, nil
 }
 
+// Close stops building leaves ahead of the layout (see
+// `DagBuilderParams.Parallelism`), which is needed when the layout stops
+// before consuming all the data, e.g. on errors. The layouts of the balanced
+// and trickle packages call it.
+func (db *DagBuilderHelper) Close() {
+	if db.pipeline != nil {
+		db.pipeline.close()
+	}
+}
+
 // GetDagServ returns the dagservice object this Helper is using
 func (db *DagBuilderHelper) GetDagServ() ipld.DAGService {
 	return db.dserv
@@ -159,8 +205,8 @@ func (db *DagBuilderHelper) NewLeafNode(data []byte, fsNodeType pb.Data_DataType
 
 	if db.rawLeaves {
 		// Encapsulate the data in a raw node.
-		if db.cidBuilder == nil {
-			return dag.NewRawNode(data), nil
+		if db.nodeBuilder != nil {
+			return db.nodeBuilder.NewRawNode(data)
 		}
 		rawnode, err := dag.NewRawNodeWPrefix(data, db.cidBuilder)
 		if err != nil {
@@ -214,7 +260,36 @@ func (db *DagBuilderHelper) FillNodeLayer(node *FSNodeOverDag) error {
 // the DAG file size). The size of the data is computed here because
 // after that it will be hidden by `NewLeafNode` inside a generic
 // `ipld.Node` representation.
+//
+// If `Parallelism` was set in the `DagBuilderParams`, the leaves of the next
+// chunks are built ahead, with the type given to the first call.
 func (db *DagBuilderHelper) NewLeafDataNode(fsNodeType pb.Data_DataType) (node ipld.Node, dataSize uint64, err error) {
+	if db.parallelism > 1 && db.pipeline == nil && db.recvdErr == nil {
+		db.pipeline = db.startLeafPipeline(db.spl, db.nextData, fsNodeType)
+		db.nextData = nil
+		db.leafType = fsNodeType
+	}
+
+	if db.pipeline != nil {
+		r := db.pipeline.pop()
+		switch {
+		case r == nil:
+			node, err = db.NewLeafNode(nil, fsNodeType)
+		case r.err != nil:
+			err = r.err
+		case fsNodeType != db.leafType:
+			dataSize = uint64(len(r.data))
+			node, err = db.NewLeafNode(r.data, fsNodeType)
+		default:
+			dataSize = uint64(len(r.data))
+			node, err = r.node, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return db.ProcessFileStore(node, dataSize), dataSize, nil
+	}
+
 	fileData, err := db.Next()
 	if err != nil {
 		return nil, 0, err
@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"io"
+	"sync"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	pb "github.com/ipfs/boxo/ipld/unixfs/pb"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// leafResult is a chunk of data, and the leaf node built from it.
+type leafResult struct {
+	data []byte
+	node ipld.Node
+	err  error
+}
+
+// leafPipeline reads the chunks of a splitter and builds their leaf nodes,
+// encoding and hashing them, with a pool of workers. The results are returned
+// in the order of the chunks: each chunk gets a slot in the results queue,
+// which is filled by the worker that builds its leaf, so the size of the queue
+// bounds the number of chunks in flight.
+type leafPipeline struct {
+	results chan chan leafResult
+	stop    chan struct{}
+	stopped sync.Once
+	wg      sync.WaitGroup
+
+	next *leafResult
+	eof  bool
+}
+
+// leafWork is a chunk to build a leaf node from, and the slot of its result.
+type leafWork struct {
+	data   []byte
+	result chan leafResult
+}
+
+// startLeafPipeline starts building the leaves of type fsNodeType, with first
+// as the first chunk if not nil, and then the chunks read from spl.
+func (db *DagBuilderHelper) startLeafPipeline(spl chunker.Splitter, first []byte, fsNodeType pb.Data_DataType) *leafPipeline {
+	p := &leafPipeline{
+		results: make(chan chan leafResult, 2*db.parallelism),
+		stop:    make(chan struct{}),
+	}
+	work := make(chan leafWork, db.parallelism)
+
+	p.wg.Add(db.parallelism)
+	for i := 0; i < db.parallelism; i++ {
+		go func() {
+			defer p.wg.Done()
+			for w := range work {
+				node, err := db.NewLeafNode(w.data, fsNodeType)
+				if err == nil {
+					// Encode and hash the node now, rather than when it
+					// is linked.
+					node.Cid()
+				}
+				w.result <- leafResult{data: w.data, node: node, err: err}
+			}
+		}()
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(work)
+		defer close(p.results)
+
+		data := first
+		for {
+			var err error
+			if data == nil {
+				data, err = spl.NextBytes()
+			}
+			if err == io.EOF || (data == nil && err == nil) {
+				return
+			}
+
+			result := make(chan leafResult, 1)
+			if err != nil {
+				result <- leafResult{err: err}
+			}
+			select {
+			case p.results <- result:
+			case <-p.stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+			select {
+			case work <- leafWork{data: data, result: result}:
+			case <-p.stop:
+				return
+			}
+			data = nil
+		}
+	}()
+
+	return p
+}
+
+// peek returns the next result without consuming it, or nil once all the
+// chunks were consumed.
+func (p *leafPipeline) peek() *leafResult {
+	if p.next == nil && !p.eof {
+		result, ok := <-p.results
+		if !ok {
+			p.eof = true
+			return nil
+		}
+		r := <-result
+		p.next = &r
+	}
+	return p.next
+}
+
+// pop consumes the next result, or returns nil once all the chunks were
+// consumed. A result with an error is never consumed.
+func (p *leafPipeline) pop() *leafResult {
+	r := p.peek()
+	if r != nil && r.err == nil {
+		p.next = nil
+	}
+	return r
+}
+
+// close stops the pipeline and waits for its goroutines to exit.
+func (p *leafPipeline) close() {
+	p.stopped.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
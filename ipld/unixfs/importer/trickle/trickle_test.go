@@ -782,3 +782,57 @@ func testMetadata(t *testing.T, rawLeaves UseRawLeaves) {
 		t.Errorf("got filemode %o, wanted %o", dr.Mode(), dbp.FileMode)
 	}
 }
+
+func TestParallelLeaves(t *testing.T) {
+	runBothSubtests(t, testParallelLeaves)
+}
+
+func testParallelLeaves(t *testing.T, rawLeaves UseRawLeaves) {
+	const nbytes = 256 * 1024
+	data := make([]byte, nbytes)
+	random.NewRand().Read(data)
+
+	build := func(parallelism int) ipld.Node {
+		ds := mdtest.Mock()
+		dbp := &h.DagBuilderParams{
+			Dagserv:     ds,
+			Maxlinks:    8,
+			RawLeaves:   bool(rawLeaves),
+			Parallelism: parallelism,
+		}
+		db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data[:nbytes/2]), 500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err := Layout(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data[nbytes/2:]), 500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err = Append(context.Background(), nd, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = VerifyTrickleDagStructure(nd, VerifyParams{
+			Getter:      ds,
+			Direct:      dbp.Maxlinks,
+			LayerRepeat: depthRepeat,
+			RawLeaves:   bool(rawLeaves),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+
+	want := build(0)
+	got := build(runtime.NumCPU() + 1)
+	if !got.Cid().Equals(want.Cid()) {
+		t.Fatalf("got root %s, wanted %s", got.Cid(), want.Cid())
+	}
+}
@@ -38,6 +38,8 @@ const depthRepeat = 4
 // DagBuilderHelper. See the module's description for a more detailed
 // explanation.
 func Layout(db *h.DagBuilderHelper) (ipld.Node, error) {
+	defer db.Close()
+
 	newRoot := db.NewFSNodeOverDag(ft.TFile)
 	root, _, err := fillTrickleRec(db, newRoot, -1)
 	if err != nil {
@@ -96,6 +98,8 @@ func fillTrickleRec(db *h.DagBuilderHelper, node *h.FSNodeOverDag, maxDepth int)
 
 // Append appends the data in `db` to the dag, using the Trickledag format
 func Append(ctx context.Context, basen ipld.Node, db *h.DagBuilderHelper) (out ipld.Node, errOut error) {
+	defer db.Close()
+
 	base, ok := basen.(*dag.ProtoNode)
 	if !ok {
 		return nil, dag.ErrNotProtobuf
@@ -3,6 +3,7 @@ package io
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 
 	"github.com/ipfs/boxo/ipld/unixfs/hamt"
@@ -30,6 +31,66 @@ var HAMTShardingSize = int(256 * units.KiB)
 // Needs to be a power of two (shard entry size) and multiple of 8 (bitfield size).
 var DefaultShardWidth = 256
 
+// DirectoryOption configures the directories created with
+// [NewDirectoryWithOptions] and [NewDirectoryFromNode].
+type DirectoryOption func(*directoryOptions)
+
+type directoryOptions struct {
+	shardWidth   int
+	shardingSize *int
+}
+
+// WithHAMTShardWidth sets the fan-out of the HAMT shards created when the
+// directory switches to a HAMTDirectory, instead of [DefaultShardWidth]. Wider
+// shards make for shallower trees, which suits directories with millions of
+// entries. It needs to be a power of two, a multiple of 8, and at most 1024.
+// Existing shards keep the width they were created with.
+func WithHAMTShardWidth(width int) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.shardWidth = width
+	}
+}
+
+// WithHAMTShardingSize sets the estimated size above which the directory
+// switches to a HAMTDirectory, and below which it switches back to a
+// BasicDirectory, instead of the global [HAMTShardingSize]. Zero disables the
+// switches.
+func WithHAMTShardingSize(size int) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.shardingSize = &size
+	}
+}
+
+func newDirectoryOptions(opts []DirectoryOption) (directoryOptions, error) {
+	var o directoryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shardWidth != 0 {
+		if _, err := hamt.Logtwo(o.shardWidth); err != nil || o.shardWidth%8 != 0 || o.shardWidth > 1024 {
+			return o, fmt.Errorf("invalid HAMT shard width %d: must be a power of two, a multiple of 8, and at most 1024", o.shardWidth)
+		}
+	}
+	return o, nil
+}
+
+// hamtShardWidth returns the width of the new HAMT shards.
+func (o *directoryOptions) hamtShardWidth() int {
+	if o.shardWidth != 0 {
+		return o.shardWidth
+	}
+	return DefaultShardWidth
+}
+
+// hamtShardingSize returns the size threshold of the switches between basic
+// and HAMT directories.
+func (o *directoryOptions) hamtShardingSize() int {
+	if o.shardingSize != nil {
+		return *o.shardingSize
+	}
+	return HAMTShardingSize
+}
+
 // Directory defines a UnixFS directory. It is used for creating, reading and
 // editing directories. It allows to work with different directory schemes,
 // like the basic or the HAMT implementation.
@@ -97,6 +158,8 @@ type BasicDirectory struct {
 	// (We maintain this value up to date even if the HAMTShardingSize is off
 	// since potentially the option could be activated on the fly.)
 	estimatedSize int
+
+	opts directoryOptions
 }
 
 // HAMTDirectory is the HAMT implementation of `Directory`.
@@ -108,16 +171,19 @@ type HAMTDirectory struct {
 	// Track the changes in size by the AddChild and RemoveChild calls
 	// for the HAMTShardingSize option.
 	sizeChange int
+
+	opts directoryOptions
 }
 
-func newEmptyBasicDirectory(dserv ipld.DAGService) *BasicDirectory {
-	return newBasicDirectoryFromNode(dserv, format.EmptyDirNode())
+func newEmptyBasicDirectory(dserv ipld.DAGService, opts directoryOptions) *BasicDirectory {
+	return newBasicDirectoryFromNode(dserv, format.EmptyDirNode(), opts)
 }
 
-func newBasicDirectoryFromNode(dserv ipld.DAGService, node *mdag.ProtoNode) *BasicDirectory {
+func newBasicDirectoryFromNode(dserv ipld.DAGService, node *mdag.ProtoNode, opts directoryOptions) *BasicDirectory {
 	basicDir := new(BasicDirectory)
 	basicDir.node = node
 	basicDir.dserv = dserv
+	basicDir.opts = opts
 
 	// Scan node links (if any) to restore estimated size.
 	basicDir.computeEstimatedSize()
@@ -128,7 +194,17 @@ func newBasicDirectoryFromNode(dserv ipld.DAGService, node *mdag.ProtoNode) *Bas
 // NewDirectory returns a Directory implemented by DynamicDirectory
 // containing a BasicDirectory that can be converted to a HAMTDirectory.
 func NewDirectory(dserv ipld.DAGService) Directory {
-	return &DynamicDirectory{newEmptyBasicDirectory(dserv)}
+	return &DynamicDirectory{newEmptyBasicDirectory(dserv, directoryOptions{})}
+}
+
+// NewDirectoryWithOptions is like [NewDirectory], but configures the
+// directory with opts. It returns an error if the options are invalid.
+func NewDirectoryWithOptions(dserv ipld.DAGService, opts ...DirectoryOption) (Directory, error) {
+	o, err := newDirectoryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DynamicDirectory{newEmptyBasicDirectory(dserv, o)}, nil
 }
 
 // ErrNotADir implies that the given node was not a unixfs directory
@@ -136,7 +212,12 @@ var ErrNotADir = errors.New("merkledag node was not a directory or shard")
 
 // NewDirectoryFromNode loads a unixfs directory from the given IPLD node and
 // DAGService.
-func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node) (Directory, error) {
+func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node, opts ...DirectoryOption) (Directory, error) {
+	o, err := newDirectoryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	protoBufNode, ok := node.(*mdag.ProtoNode)
 	if !ok {
 		return nil, ErrNotADir
@@ -149,13 +230,13 @@ func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node) (Directory, err
 
 	switch fsNode.Type() {
 	case format.TDirectory:
-		return &DynamicDirectory{newBasicDirectoryFromNode(dserv, protoBufNode.Copy().(*mdag.ProtoNode))}, nil
+		return &DynamicDirectory{newBasicDirectoryFromNode(dserv, protoBufNode.Copy().(*mdag.ProtoNode), o)}, nil
 	case format.THAMTShard:
 		shard, err := hamt.NewHamtFromDag(dserv, node)
 		if err != nil {
 			return nil, err
 		}
-		return &DynamicDirectory{&HAMTDirectory{shard, dserv, 0}}, nil
+		return &DynamicDirectory{&HAMTDirectory{shard: shard, dserv: dserv, opts: o}}, nil
 	}
 
 	return nil, ErrNotADir
@@ -203,7 +284,8 @@ func (d *BasicDirectory) AddChild(ctx context.Context, name string, node ipld.No
 }
 
 func (d *BasicDirectory) needsToSwitchToHAMTDir(name string, nodeToAdd ipld.Node) (bool, error) {
-	if HAMTShardingSize == 0 { // Option disabled.
+	shardingSize := d.opts.hamtShardingSize()
+	if shardingSize == 0 { // Option disabled.
 		return false, nil
 	}
 
@@ -220,7 +302,7 @@ func (d *BasicDirectory) needsToSwitchToHAMTDir(name string, nodeToAdd ipld.Node
 		operationSizeChange += linksize.LinkSizeFunction(name, nodeToAdd.Cid())
 	}
 
-	return d.estimatedSize+operationSizeChange >= HAMTShardingSize, nil
+	return d.estimatedSize+operationSizeChange >= shardingSize, nil
 }
 
 // addLinkChild adds the link as an entry to this directory under the given
@@ -325,8 +407,9 @@ func (d *BasicDirectory) GetCidBuilder() cid.Builder {
 func (d *BasicDirectory) switchToSharding(ctx context.Context) (*HAMTDirectory, error) {
 	hamtDir := new(HAMTDirectory)
 	hamtDir.dserv = d.dserv
+	hamtDir.opts = d.opts
 
-	shard, err := hamt.NewShard(d.dserv, DefaultShardWidth)
+	shard, err := hamt.NewShard(d.dserv, d.opts.hamtShardWidth())
 	if err != nil {
 		return nil, err
 	}
@@ -414,7 +497,7 @@ func (d *HAMTDirectory) GetCidBuilder() cid.Builder {
 
 // switchToBasic returns a BasicDirectory implementation of this directory.
 func (d *HAMTDirectory) switchToBasic(ctx context.Context) (*BasicDirectory, error) {
-	basicDir := newEmptyBasicDirectory(d.dserv)
+	basicDir := newEmptyBasicDirectory(d.dserv, d.opts)
 	basicDir.SetCidBuilder(d.GetCidBuilder())
 
 	err := d.ForEachLink(ctx, func(lnk *ipld.Link) error {
@@ -452,7 +535,7 @@ func (d *HAMTDirectory) removeFromSizeChange(name string, linkCid cid.Cid) {
 // nodeToAdd is nil). We compute both (potential) future subtraction and
 // addition to the size change.
 func (d *HAMTDirectory) needsToSwitchToBasicDir(ctx context.Context, name string, nodeToAdd ipld.Node) (switchToBasic bool, err error) {
-	if HAMTShardingSize == 0 { // Option disabled.
+	if d.opts.hamtShardingSize() == 0 { // Option disabled.
 		return false, nil
 	}
 
@@ -490,7 +573,8 @@ func (d *HAMTDirectory) needsToSwitchToBasicDir(ctx context.Context, name string
 // to keep counting) or an error occurs (like the context being canceled
 // if we take too much time fetching the necessary shards).
 func (d *HAMTDirectory) sizeBelowThreshold(ctx context.Context, sizeChange int) (below bool, err error) {
-	if HAMTShardingSize == 0 {
+	shardingSize := d.opts.hamtShardingSize()
+	if shardingSize == 0 {
 		panic("asked to compute HAMT size with HAMTShardingSize option off (0)")
 	}
 
@@ -508,7 +592,7 @@ func (d *HAMTDirectory) sizeBelowThreshold(ctx context.Context, sizeChange int)
 		}
 
 		partialSize += linksize.LinkSizeFunction(linkResult.Link.Name, linkResult.Link.Cid)
-		if partialSize+sizeChange >= HAMTShardingSize {
+		if partialSize+sizeChange >= shardingSize {
 			// We have already fetched enough shards to assert we are
 			//  above the threshold, so no need to keep fetching.
 			return false, nil
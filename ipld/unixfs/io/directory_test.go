@@ -119,7 +119,7 @@ func TestDuplicateAddDir(t *testing.T) {
 
 func TestBasicDirectory_estimatedSize(t *testing.T) {
 	ds := mdtest.Mock()
-	basicDir := newEmptyBasicDirectory(ds)
+	basicDir := newEmptyBasicDirectory(ds, directoryOptions{})
 
 	testDirectorySizeEstimation(t, basicDir, ds, func(dir Directory) int {
 		return dir.(*BasicDirectory).estimatedSize
@@ -230,7 +230,7 @@ func TestProductionLinkSize(t *testing.T) {
 	assert.Equal(t, 48, productionLinkSize(link.Name, link.Cid))
 
 	ds := mdtest.Mock()
-	basicDir := newEmptyBasicDirectory(ds)
+	basicDir := newEmptyBasicDirectory(ds, directoryOptions{})
 	assert.NoError(t, err)
 	for i := 0; i < 10; i++ {
 		basicDir.AddChild(context.Background(), strconv.FormatUint(uint64(i), 10), ft.EmptyFileNode())
@@ -289,6 +289,53 @@ func TestDynamicDirectorySwitch(t *testing.T) {
 	checkBasicDirectory(t, dir, "removed threshold entry, option at min, should switch down")
 }
 
+func TestDirectoryOptions(t *testing.T) {
+	linksize.LinkSizeFunction = mockLinkSizeFunc(1)
+	defer func() { linksize.LinkSizeFunction = productionLinkSize }()
+
+	ds := mdtest.Mock()
+	ctx := context.Background()
+	child := ft.EmptyDirNode()
+	assert.NoError(t, ds.Add(ctx, child))
+
+	dir, err := NewDirectoryWithOptions(ds, WithHAMTShardingSize(2), WithHAMTShardWidth(1024))
+	assert.NoError(t, err)
+	assert.NoError(t, dir.AddChild(ctx, "1", child))
+	checkBasicDirectory(t, dir, "below the threshold of the directory")
+	assert.NoError(t, dir.AddChild(ctx, "2", child))
+	checkHAMTDirectory(t, dir, "reached the threshold of the directory")
+
+	nd, err := dir.GetNode()
+	assert.NoError(t, err)
+	fsn, err := ft.FSNodeFromBytes(nd.(*mdag.ProtoNode).Data())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1024), fsn.Fanout())
+
+	// The options are kept when switching back and forth.
+	assert.NoError(t, dir.RemoveChild(ctx, "2"))
+	assert.NoError(t, dir.RemoveChild(ctx, "1"))
+	checkBasicDirectory(t, dir, "went below the threshold of the directory")
+	assert.NoError(t, dir.AddChild(ctx, "1", child))
+	assert.NoError(t, dir.AddChild(ctx, "2", child))
+	checkHAMTDirectory(t, dir, "reached the threshold of the directory again")
+
+	// The options apply to loaded directories.
+	dir, err = NewDirectoryFromNode(ds, ft.EmptyDirNode(), WithHAMTShardingSize(0))
+	assert.NoError(t, err)
+	oldHamtOption := HAMTShardingSize
+	defer func() { HAMTShardingSize = oldHamtOption }()
+	HAMTShardingSize = 1
+	assert.NoError(t, dir.AddChild(ctx, "1", child))
+	checkBasicDirectory(t, dir, "sharding disabled for the directory")
+
+	_, err = NewDirectoryFromNode(ds, ft.EmptyDirNode(), WithHAMTShardWidth(100))
+	assert.Error(t, err)
+	_, err = NewDirectoryFromNode(ds, ft.EmptyDirNode(), WithHAMTShardWidth(2048))
+	assert.Error(t, err)
+	_, err = NewDirectoryWithOptions(ds, WithHAMTShardWidth(100))
+	assert.Error(t, err)
+}
+
 func TestIntegrityOfDirectorySwitch(t *testing.T) {
 	ds := mdtest.Mock()
 	dir := NewDirectory(ds)
@@ -299,7 +346,7 @@ func TestIntegrityOfDirectorySwitch(t *testing.T) {
 	err := ds.Add(ctx, child)
 	assert.NoError(t, err)
 
-	basicDir := newEmptyBasicDirectory(ds)
+	basicDir := newEmptyBasicDirectory(ds, directoryOptions{})
 	hamtDir, err := newEmptyHAMTDirectory(ds, DefaultShardWidth)
 	assert.NoError(t, err)
 	for i := 0; i < 1000; i++ {
@@ -9,6 +9,10 @@ import (
 // [size limit]: https://specs.ipfs.tech/ipns/ipns-record/#record-size-limit
 const MaxRecordSize int = 10 << (10 * 1)
 
+// MaxMetadataSize is the maximum size of the DAG-CBOR encoded fields added to
+// an IPNS [Record] with [WithMetadata].
+const MaxMetadataSize int = 4 << 10
+
 // ErrExpiredRecord is returned when an IPNS [Record] is invalid due to being expired.
 var ErrExpiredRecord = errors.New("record is expired")
 
@@ -46,3 +50,11 @@ var ErrInvalidName = errors.New("name is invalid")
 
 // ErrInvalidPath is returned when an IPNS [Record] has an invalid path.
 var ErrInvalidPath = errors.New("value is not a valid content path")
+
+// ErrInvalidMetadata is returned when the fields added to an IPNS [Record] with
+// [WithMetadata] are invalid.
+var ErrInvalidMetadata = errors.New("record metadata is invalid")
+
+// ErrMetadataSize is returned when the fields added to an IPNS [Record] with
+// [WithMetadata] exceed [MaxMetadataSize].
+var ErrMetadataSize = errors.New("record metadata exceeds allowed size limit")
@@ -157,6 +157,41 @@ func (rec *Record) PubKey() (ic.PubKey, error) {
 	return nil, ErrPublicKeyNotFound
 }
 
+// SignedData returns the DAG-CBOR data of the IPNS Record and its signature,
+// which allows verifying the record without its Protobuf serialization, see
+// [Record Verification].
+//
+// [Record Verification]: https://specs.ipfs.tech/ipns/ipns-record/#record-verification
+func (rec *Record) SignedData() (data, signature []byte) {
+	return rec.pb.GetData(), rec.pb.GetSignatureV2()
+}
+
+// Metadata returns the additional fields of the DAG-CBOR data of the IPNS
+// Record, keyed by their name, or nil if there are none. These fields are
+// covered by the signature of the record, but their meaning is up to the
+// applications setting them with [WithMetadata]. Fields unknown to this
+// implementation are preserved when the record is unmarshalled and
+// marshalled again.
+func (rec *Record) Metadata() map[string]datamodel.Node {
+	var md map[string]datamodel.Node
+	it := rec.node.MapIterator()
+	for it != nil && !it.Done() {
+		k, v, err := it.Next()
+		if err != nil {
+			return md
+		}
+		key, err := k.AsString()
+		if err != nil || isReservedKey(key) {
+			continue
+		}
+		if md == nil {
+			md = make(map[string]datamodel.Node)
+		}
+		md[key] = v
+	}
+	return md
+}
+
 func (rec *Record) getBytesValue(key string) ([]byte, error) {
 	node, err := rec.node.LookupByString(key)
 	if err != nil {
@@ -193,9 +228,21 @@ const (
 	cborTTLKey          = "TTL"
 )
 
+// isReservedKey returns true if key is one of the fields of the DAG-CBOR data
+// defined by the specification.
+func isReservedKey(key string) bool {
+	switch key {
+	case cborValidityKey, cborValidityTypeKey, cborValueKey, cborSequenceKey, cborTTLKey:
+		return true
+	default:
+		return false
+	}
+}
+
 type options struct {
 	v1Compatibility bool
 	embedPublicKey  *bool
+	metadata        map[string]datamodel.Node
 }
 
 type Option func(*options)
@@ -212,6 +259,21 @@ func WithPublicKey(embedded bool) Option {
 	}
 }
 
+// WithMetadata adds the field key with the given value to the DAG-CBOR data of
+// the record, such as alternative transports or HTTP mirrors of the content.
+// The field is covered by the signature of the record and can be read with
+// [Record.Metadata]. The key cannot be one of the fields defined by the
+// specification, and the encoded fields cannot exceed [MaxMetadataSize]
+// bytes.
+func WithMetadata(key string, value datamodel.Node) Option {
+	return func(o *options) {
+		if o.metadata == nil {
+			o.metadata = make(map[string]datamodel.Node)
+		}
+		o.metadata[key] = value
+	}
+}
+
 func processOptions(opts ...Option) *options {
 	options := &options{
 		// TODO: produce V2-only records by default after IPIP-XXXX ships with Kubo
@@ -225,15 +287,29 @@ func processOptions(opts ...Option) *options {
 	return options
 }
 
+// Signer signs records with a private key, such as a [ic.PrivKey], or a key
+// held by an HSM or a KMS that never leaves it, see [keystore.Signer].
+//
+// [keystore.Signer]: https://pkg.go.dev/github.com/ipfs/boxo/keystore#Signer
+type Signer interface {
+	Sign([]byte) ([]byte, error)
+	GetPublic() ic.PubKey
+}
+
 // NewRecord creates a new IPNS [Record] and signs it with the given private key.
 // By default, we embed the public key for key types whose peer IDs do not encode
 // the public key, such as RSA and ECDSA key types. This can be changed with the
 // option [WithPublicKey]. In addition, records are, by default created with V1
-// compatibility.
-func NewRecord(sk ic.PrivKey, value path.Path, seq uint64, eol time.Time, ttl time.Duration, opts ...Option) (*Record, error) {
+// compatibility. Additional fields can be set with [WithMetadata]. The key can
+// be any [Signer].
+func NewRecord(sk Signer, value path.Path, seq uint64, eol time.Time, ttl time.Duration, opts ...Option) (*Record, error) {
 	options := processOptions(opts...)
 
-	node, err := createNode(value, seq, eol, ttl)
+	if err := validateMetadata(options.metadata); err != nil {
+		return nil, err
+	}
+
+	node, err := createNode(value, seq, eol, ttl, options.metadata)
 	if err != nil {
 		return nil, err
 	}
@@ -302,7 +378,46 @@ func NewRecord(sk ic.PrivKey, value path.Path, seq uint64, eol time.Time, ttl ti
 	}, nil
 }
 
-func createNode(value path.Path, seq uint64, eol time.Time, ttl time.Duration) (datamodel.Node, error) {
+// validateMetadata checks the fields set with [WithMetadata].
+func validateMetadata(md map[string]datamodel.Node) error {
+	if len(md) == 0 {
+		return nil
+	}
+
+	builder := basicnode.Prototype__Map{}.NewBuilder()
+	ma, err := builder.BeginMap(int64(len(md)))
+	if err != nil {
+		return err
+	}
+	for k, v := range md {
+		if k == "" || isReservedKey(k) {
+			return fmt.Errorf("%w: field %q is reserved", ErrInvalidMetadata, k)
+		}
+		if v == nil {
+			return fmt.Errorf("%w: field %q has no value", ErrInvalidMetadata, k)
+		}
+		if err := ma.AssembleKey().AssignString(k); err != nil {
+			return err
+		}
+		if err := ma.AssembleValue().AssignNode(v); err != nil {
+			return fmt.Errorf("%w: field %q: %w", ErrInvalidMetadata, k, err)
+		}
+	}
+	if err := ma.Finish(); err != nil {
+		return err
+	}
+
+	data, err := nodeToCBOR(builder.Build())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if len(data) > MaxMetadataSize {
+		return ErrMetadataSize
+	}
+	return nil
+}
+
+func createNode(value path.Path, seq uint64, eol time.Time, ttl time.Duration, metadata map[string]datamodel.Node) (datamodel.Node, error) {
 	m := make(map[string]ipld.Node)
 	var keys []string
 
@@ -321,6 +436,11 @@ func createNode(value path.Path, seq uint64, eol time.Time, ttl time.Duration) (
 	m[cborTTLKey] = basicnode.NewInt(int64(ttl))
 	keys = append(keys, cborTTLKey)
 
+	for k, v := range metadata {
+		m[k] = v
+		keys = append(keys, k)
+	}
+
 	sort.Slice(keys, func(i, j int) bool {
 		li, lj := len(keys[i]), len(keys[j])
 		if li == lj {
@@ -152,6 +152,28 @@ func TestNewRecord(t *testing.T) {
 			require.ErrorIs(t, err, ErrPublicKeyNotFound)
 		}
 	})
+
+	t.Run("Signed by a Signer", func(t *testing.T) {
+		t.Parallel()
+
+		// A key that can only sign, such as a key held by an HSM.
+		rec, err := NewRecord(hsmKey{sk}, testPath, seq, eol, ttl)
+		require.NoError(t, err)
+		require.NoError(t, Validate(rec, sk.GetPublic()))
+		fieldsMatch(t, rec, testPath, seq, eol, ttl)
+	})
+}
+
+type hsmKey struct {
+	sk ic.PrivKey
+}
+
+func (k hsmKey) Sign(data []byte) ([]byte, error) {
+	return k.sk.Sign(data)
+}
+
+func (k hsmKey) GetPublic() ic.PubKey {
+	return k.sk.GetPublic()
 }
 
 func TestExtractPublicKey(t *testing.T) {
@@ -290,3 +312,55 @@ func TestUnmarshal(t *testing.T) {
 		require.ErrorIs(t, err, ErrInvalidRecord)
 	})
 }
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+
+	sk, _, _ := mustKeyPair(t, ic.Ed25519)
+	eol := time.Now().Add(time.Hour)
+
+	t.Run("Round trips through marshalling", func(t *testing.T) {
+		t.Parallel()
+
+		mirrors := basicnode.NewString("https://mirror.example.com")
+		rec := mustNewRecord(t, sk, testPath, 1, eol, time.Minute, WithMetadata("Mirrors", mirrors), WithMetadata("x", basicnode.NewInt(7)))
+		fieldsMatch(t, rec, testPath, 1, eol, time.Minute)
+
+		// Unknown protobuf fields are also preserved.
+		data := append(mustMarshal(t, rec), 0xa0, 0x06, 0x01)
+		rec, err := UnmarshalRecord(data)
+		require.NoError(t, err)
+		require.NoError(t, Validate(rec, sk.GetPublic()))
+		require.Equal(t, data, mustMarshal(t, rec))
+
+		md := rec.Metadata()
+		require.Len(t, md, 2)
+		v, err := md["Mirrors"].AsString()
+		require.NoError(t, err)
+		require.Equal(t, "https://mirror.example.com", v)
+		i, err := md["x"].AsInt()
+		require.NoError(t, err)
+		require.EqualValues(t, 7, i)
+	})
+
+	t.Run("No metadata", func(t *testing.T) {
+		t.Parallel()
+
+		rec := mustNewRecord(t, sk, testPath, 1, eol, time.Minute)
+		require.Nil(t, rec.Metadata())
+	})
+
+	t.Run("Errors on reserved fields", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewRecord(sk, testPath, 1, eol, time.Minute, WithMetadata(cborValueKey, basicnode.NewString("/ipfs/bafkqaaa")))
+		require.ErrorIs(t, err, ErrInvalidMetadata)
+	})
+
+	t.Run("Errors on large metadata", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewRecord(sk, testPath, 1, eol, time.Minute, WithMetadata("big", basicnode.NewBytes(make([]byte, MaxMetadataSize))))
+		require.ErrorIs(t, err, ErrMetadataSize)
+	})
+}
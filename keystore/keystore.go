@@ -121,6 +121,11 @@ func (ks *FSKeystore) Get(name string) (ci.PrivKey, error) {
 	return ci.UnmarshalPrivateKey(data)
 }
 
+// Signer returns the private key of the given name, which signs with it.
+func (ks *FSKeystore) Signer(name string) (Signer, error) {
+	return ks.Get(name)
+}
+
 // Delete removes a key from the Keystore
 func (ks *FSKeystore) Delete(name string) error {
 	name, err := encode(name)
@@ -48,6 +48,11 @@ func (mk *MemKeystore) Get(name string) (ci.PrivKey, error) {
 	return k, nil
 }
 
+// Signer returns the private key of the given name, which signs with it.
+func (mk *MemKeystore) Signer(name string) (Signer, error) {
+	return mk.Get(name)
+}
+
 // Delete remove a key from the Keystore
 func (mk *MemKeystore) Delete(name string) error {
 	delete(mk.keys, name)
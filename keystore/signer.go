@@ -0,0 +1,76 @@
+package keystore
+
+import (
+	"errors"
+
+	ci "github.com/libp2p/go-libp2p/core/crypto"
+	pb "github.com/libp2p/go-libp2p/core/crypto/pb"
+)
+
+// ErrKeyNotExportable is returned when the private key cannot leave the
+// keystore, such as a key held by an HSM or a KMS, which can only sign with
+// it. See [SignerKeystore].
+var ErrKeyNotExportable = errors.New("private key cannot be exported from the keystore")
+
+// Signer signs data with a private key, such as a [ci.PrivKey], or a key
+// held by a PKCS#11 HSM, a TPM or a cloud KMS, that never leaves it. Signers
+// can sign IPNS records, see [ipns.NewRecord].
+//
+// [ipns.NewRecord]: https://pkg.go.dev/github.com/ipfs/boxo/ipns#NewRecord
+type Signer interface {
+	// GetPublic returns the public key paired with the private key.
+	GetPublic() ci.PubKey
+	// Sign signs the given bytes.
+	Sign([]byte) ([]byte, error)
+}
+
+// SignerKeystore is a Keystore that can sign with its keys. Keystores whose
+// keys cannot be exported, such as the keystores backed by HSMs or KMSs,
+// implement it and return ErrKeyNotExportable from Get. FSKeystore and
+// MemKeystore implement it too.
+type SignerKeystore interface {
+	Keystore
+	// Signer returns the signer of the key with the given name, or
+	// ErrNoSuchKey.
+	Signer(string) (Signer, error)
+}
+
+// GetSigner returns the signer of the key of ks with the given name, with
+// [SignerKeystore.Signer] if implemented, or otherwise with the private key
+// returned by Get.
+func GetSigner(ks Keystore, name string) (Signer, error) {
+	if sks, ok := ks.(SignerKeystore); ok {
+		return sks.Signer(name)
+	}
+	return ks.Get(name)
+}
+
+// PrivKey returns s as a [ci.PrivKey], for the APIs taking private keys but
+// only signing with them, such as the IPNS publishers. If s is not a
+// [ci.PrivKey], the Raw method of the returned key returns
+// ErrKeyNotExportable.
+func PrivKey(s Signer) ci.PrivKey {
+	if sk, ok := s.(ci.PrivKey); ok {
+		return sk
+	}
+	return signerPrivKey{s}
+}
+
+// signerPrivKey is a [ci.PrivKey] that can only sign.
+type signerPrivKey struct {
+	Signer
+}
+
+// Equals returns whether k is a private key with the same public key.
+func (sk signerPrivKey) Equals(k ci.Key) bool {
+	other, ok := k.(ci.PrivKey)
+	return ok && sk.GetPublic().Equals(other.GetPublic())
+}
+
+func (sk signerPrivKey) Raw() ([]byte, error) {
+	return nil, ErrKeyNotExportable
+}
+
+func (sk signerPrivKey) Type() pb.KeyType {
+	return sk.GetPublic().Type()
+}
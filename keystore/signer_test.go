@@ -0,0 +1,82 @@
+package keystore
+
+import (
+	"errors"
+	"testing"
+
+	ci "github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// hsmKeystore is a keystore whose keys can only sign.
+type hsmKeystore struct {
+	*MemKeystore
+}
+
+type hsmKey struct {
+	sk ci.PrivKey
+}
+
+func (k hsmKey) Sign(data []byte) ([]byte, error) {
+	return k.sk.Sign(data)
+}
+
+func (k hsmKey) GetPublic() ci.PubKey {
+	return k.sk.GetPublic()
+}
+
+func (ks hsmKeystore) Get(string) (ci.PrivKey, error) {
+	return nil, ErrKeyNotExportable
+}
+
+func (ks hsmKeystore) Signer(name string) (Signer, error) {
+	sk, err := ks.MemKeystore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return hsmKey{sk}, nil
+}
+
+func TestGetSigner(t *testing.T) {
+	k := privKeyOrFatal(t)
+	mem := NewMemKeystore()
+	if err := mem.Put("foo", k); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ks := range []Keystore{mem, hsmKeystore{mem}} {
+		s, err := GetSigner(ks, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := []byte("data")
+		sig, err := PrivKey(s).Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := k.GetPublic().Verify(data, sig); err != nil || !ok {
+			t.Fatal("invalid signature")
+		}
+
+		if _, err := GetSigner(ks, "bar"); !errors.Is(err, ErrNoSuchKey) {
+			t.Fatalf("expected ErrNoSuchKey, got %v", err)
+		}
+	}
+}
+
+func TestSignerPrivKey(t *testing.T) {
+	k := privKeyOrFatal(t)
+	if PrivKey(k) != k {
+		t.Fatal("private keys must be returned as is")
+	}
+
+	sk := PrivKey(hsmKey{k})
+	if _, err := sk.Raw(); !errors.Is(err, ErrKeyNotExportable) {
+		t.Fatalf("expected ErrKeyNotExportable, got %v", err)
+	}
+	if sk.Type() != k.Type() {
+		t.Fatal("wrong key type")
+	}
+	if !sk.Equals(k) || sk.Equals(privKeyOrFatal(t)) {
+		t.Fatal("keys must be equal if their public keys are")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"slices"
 	"sync"
 	"time"
 
@@ -41,14 +42,20 @@ type Directory struct {
 	// UnixFS directory implementation used for creating,
 	// reading and editing directories.
 	unixfsDir uio.Directory
+
+	// Options of the UnixFS directory, inherited by the child directories.
+	dirOpts []uio.DirectoryOption
 }
 
 // NewDirectory constructs a new MFS directory.
 //
 // You probably don't want to call this directly. Instead, construct a new root
 // using NewRoot.
-func NewDirectory(ctx context.Context, name string, node ipld.Node, parent parent, dserv ipld.DAGService) (*Directory, error) {
-	db, err := uio.NewDirectoryFromNode(dserv, node)
+//
+// The options configure the UnixFS directory, e.g. its HAMT sharding, and the
+// child directories inherit them.
+func NewDirectory(ctx context.Context, name string, node ipld.Node, parent parent, dserv ipld.DAGService, opts ...uio.DirectoryOption) (*Directory, error) {
+	db, err := uio.NewDirectoryFromNode(dserv, node, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +68,7 @@ func NewDirectory(ctx context.Context, name string, node ipld.Node, parent paren
 		},
 		ctx:          ctx,
 		unixfsDir:    db,
+		dirOpts:      opts,
 		entriesCache: make(map[string]FSNode),
 	}, nil
 }
@@ -141,7 +149,7 @@ func (d *Directory) cacheNode(name string, nd ipld.Node) (FSNode, error) {
 
 		switch fsn.Type() {
 		case ft.TDirectory, ft.THAMTShard:
-			ndir, err := NewDirectory(d.ctx, name, nd, d, d.dagService)
+			ndir, err := NewDirectory(d.ctx, name, nd, d, d.dagService, d.dirOpts...)
 			if err != nil {
 				return nil, err
 			}
@@ -271,6 +279,173 @@ func (d *Directory) ForEachEntry(ctx context.Context, f func(NodeListing) error)
 	})
 }
 
+// ListOptions selects the entries of a directory listed by ListEntries.
+type ListOptions struct {
+	// Offset is the number of matching entries skipped before the first
+	// listed one.
+	Offset int
+	// Limit is the maximum number of listed entries, or 0 for no limit.
+	Limit int
+	// Types are the types of the listed entries, or all types if empty.
+	Types []NodeType
+}
+
+// ListEntry is an entry of a directory listed by ListEntries.
+type ListEntry struct {
+	Name string
+	Type NodeType
+	// Size is the size of the content of files, or 0 for directories.
+	Size int64
+	Cid  cid.Cid
+	// Children is the number of entries of child directories, when it is
+	// cheaply available, or -1, e.g. for HAMT-sharded directories or files.
+	Children int
+}
+
+// errListDone stops the iteration of the links once the listing is
+// complete, and errListPageFull once a page of entries has been read.
+var (
+	errListDone     = errors.New("listing done")
+	errListPageFull = errors.New("listing page full")
+)
+
+// listPageSize is the number of entries ListEntries reads while holding the
+// lock of the directory, before passing them to the callback.
+var listPageSize = 256
+
+// listCursor is the position of ListEntries in the links of the directory.
+type listCursor struct {
+	next    int // index of the next link
+	skipped int // entries skipped by the offset so far
+	listed  int // entries listed so far
+}
+
+// ListEntries calls f for the entries of the directory selected by opts, in
+// the order of the links of the UnixFS directory, which is stable as long
+// as the directory is not modified. Unlike ForEachEntry, the children are
+// not cached, the links of HAMT-sharded directories are walked only until
+// the last listed entry, and the nodes of the entries skipped by Offset are
+// not fetched, unless they have to be filtered by type.
+//
+// The entries are read by pages, and f is called without holding the lock of
+// the directory, so it may access the directory.
+func (d *Directory) ListEntries(ctx context.Context, opts ListOptions, f func(ListEntry) error) error {
+	var cur listCursor
+	for {
+		page, done, err := d.listPage(ctx, opts, &cur)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page {
+			if err := f(entry); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// listPage reads the next page of entries of ListEntries from the position
+// of cur, and returns whether the listing is complete.
+func (d *Directory) listPage(ctx context.Context, opts ListOptions, cur *listCursor) ([]ListEntry, bool, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var page []ListEntry
+	i := 0
+	err := d.unixfsDir.ForEachLink(ctx, func(l *ipld.Link) error {
+		if i < cur.next {
+			i++
+			return nil
+		}
+		if opts.Limit > 0 && cur.listed >= opts.Limit {
+			return errListDone
+		}
+		if len(page) == listPageSize {
+			return errListPageFull
+		}
+		i++
+		if len(opts.Types) == 0 && cur.skipped < opts.Offset {
+			cur.skipped++
+			return nil
+		}
+
+		entry, err := d.listEntryUnsync(ctx, l)
+		if err != nil {
+			return err
+		}
+		if len(opts.Types) != 0 && !slices.Contains(opts.Types, entry.Type) {
+			return nil
+		}
+		if cur.skipped < opts.Offset {
+			cur.skipped++
+			return nil
+		}
+
+		cur.listed++
+		page = append(page, entry)
+		return nil
+	})
+	cur.next = i
+	switch err {
+	case nil, errListDone:
+		return page, true, nil
+	case errListPageFull:
+		return page, false, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// listEntryUnsync returns the entry of the link l, from the cached child if
+// any, without caching it otherwise.
+func (d *Directory) listEntryUnsync(ctx context.Context, l *ipld.Link) (ListEntry, error) {
+	var nd ipld.Node
+	var err error
+	if c, ok := d.entriesCache[l.Name]; ok {
+		nd, err = c.GetNode()
+	} else {
+		nd, err = l.GetNode(ctx, d.dagService)
+	}
+	if err != nil {
+		return ListEntry{}, err
+	}
+
+	entry := ListEntry{
+		Name:     l.Name,
+		Type:     TFile,
+		Cid:      nd.Cid(),
+		Children: -1,
+	}
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return ListEntry{}, err
+		}
+		switch fsn.Type() {
+		case ft.TDirectory:
+			entry.Type = TDir
+			entry.Children = len(nd.Links())
+		case ft.THAMTShard:
+			entry.Type = TDir
+		case ft.TFile, ft.TRaw, ft.TSymlink:
+			entry.Size = int64(fsn.FileSize())
+		case ft.TMetadata:
+			return ListEntry{}, ErrNotYetImplemented
+		default:
+			return ListEntry{}, ErrInvalidChild
+		}
+	case *dag.RawNode:
+		entry.Size = int64(len(nd.RawData()))
+	default:
+		return ListEntry{}, errors.New("unrecognized node type in list entry")
+	}
+	return entry, nil
+}
+
 func (d *Directory) Mkdir(name string) (*Directory, error) {
 	return d.MkdirWithOpts(name, MkdirOpts{})
 }
@@ -304,7 +479,8 @@ func (d *Directory) MkdirWithOpts(name string, opts MkdirOpts) (*Directory, erro
 		return nil, err
 	}
 
-	dirobj, err := NewDirectory(d.ctx, name, ndir, d, d.dagService)
+	dirOpts := append(d.dirOpts[:len(d.dirOpts):len(d.dirOpts)], opts.DirectoryOptions...)
+	dirobj, err := NewDirectory(d.ctx, name, ndir, d, d.dagService, dirOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -453,6 +629,10 @@ func (d *Directory) SetModTime(ts time.Time) error {
 func (d *Directory) setNodeData(data []byte, links []*ipld.Link) error {
 	nd := dag.NodeWithData(data)
 	nd.SetLinks(links)
+	// Keep the CID version and hash function of the directory.
+	if err := nd.SetCidBuilder(d.GetCidBuilder()); err != nil {
+		return err
+	}
 
 	err := d.dagService.Add(d.ctx, nd)
 	if err != nil {
@@ -466,7 +646,7 @@ func (d *Directory) setNodeData(data []byte, links []*ipld.Link) error {
 
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	db, err := uio.NewDirectoryFromNode(d.dagService, nd)
+	db, err := uio.NewDirectoryFromNode(d.dagService, nd, d.dirOpts...)
 	if err != nil {
 		return err
 	}
@@ -12,7 +12,9 @@ import (
 	mod "github.com/ipfs/boxo/ipld/unixfs/mod"
 
 	chunker "github.com/ipfs/boxo/chunker"
+	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
 )
 
 // File represents a file in the MFS, its logic its mainly targeted
@@ -263,8 +265,24 @@ func (fi *File) SetModTime(ts time.Time) error {
 }
 
 func (fi *File) setNodeData(data []byte) error {
+	old, err := fi.GetNode()
+	if err != nil {
+		return err
+	}
+
+	// Keep the CID version and hash function of the file. Raw leaves are
+	// always CIDv1, so when wrapping one in a ProtoNode only a non-default
+	// hash function is kept, otherwise the default builder is used.
+	var builder cid.Builder = old.Cid().Prefix()
+	if prefix := old.Cid().Prefix(); prefix.Codec == cid.Raw && prefix.MhType == mh.SHA2_256 {
+		builder = dag.DefaultProtoNodeBuilder.CidBuilder()
+	}
+
 	nd := dag.NodeWithData(data)
-	err := fi.inode.dagService.Add(context.TODO(), nd)
+	if err := nd.SetCidBuilder(builder); err != nil {
+		return err
+	}
+	err = fi.inode.dagService.Add(context.TODO(), nd)
 	if err != nil {
 		return err
 	}
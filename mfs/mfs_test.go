@@ -12,6 +12,7 @@ import (
 	"os"
 	gopath "path"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -32,6 +33,7 @@ import (
 	ds "github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	ipld "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
 )
 
 func emptyDirNode() *dag.ProtoNode {
@@ -1811,3 +1813,261 @@ func FuzzMkdirAndWriteConcurrently(f *testing.F) {
 		}
 	})
 }
+
+func TestMfsSetModeKeepsCidBuilder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, rt := setupRoot(ctx, t)
+	rootdir := rt.GetDirectory()
+
+	pnb, err := dag.NewProtoNodeBuilder(dag.WithCidVersion(1), dag.WithHashFunction(mh.BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := pnb.CidBuilder().(cid.Prefix)
+
+	checkPrefix := func(fsn FSNode) {
+		t.Helper()
+		nd, err := fsn.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := nd.Cid().Prefix()
+		if prefix.Version != expected.Version || prefix.MhType != expected.MhType {
+			t.Fatalf("expected CIDv%d with multihash 0x%x, got %s", expected.Version, expected.MhType, nd.Cid())
+		}
+	}
+
+	err = Mkdir(rt, "/dir", MkdirOpts{CidBuilder: pnb.CidBuilder()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirFsn, err := Lookup(rt, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := dirFsn.(*Directory)
+	if err = dir.SetMode(0o755); err != nil {
+		t.Fatal(err)
+	}
+	checkPrefix(dir)
+
+	err = rootdir.AddChild("file", pnb.NodeWithData(ft.FilePBData([]byte("hello"), 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileFsn, err := rootdir.Child("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := fileFsn.(*File)
+	if err = fi.SetModTime(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkPrefix(fi)
+}
+
+func TestDirectoryOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := getDagserv(t)
+	rt, err := NewRoot(ctx, ds, emptyDirNode(), nil, uio.WithHAMTShardingSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Mkdir(rt, "/a/b", MkdirOpts{
+		Mkparents:        true,
+		DirectoryOptions: []uio.DirectoryOption{uio.WithHAMTShardWidth(1024)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Lookup(rt, "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(*Directory).AddChild("file", getRandFile(t, ds, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.GetDirectory().Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, fanout := range map[string]uint64{"/": 256, "/a": 1024, "/a/b": 1024} {
+		fsn, err := Lookup(rt, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err := fsn.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ufs, err := ft.FSNodeFromBytes(nd.(*dag.ProtoNode).Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ufs.Type() != ft.THAMTShard || ufs.Fanout() != fanout {
+			t.Fatalf("%s: got a %s with fanout %d, wanted a HAMT shard with fanout %d", p, ufs.Type(), ufs.Fanout(), fanout)
+		}
+	}
+}
+
+func TestDirectoryListEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+	rootdir := rt.GetDirectory()
+
+	for i := 0; i < 6; i++ {
+		if err := rootdir.AddChild(fmt.Sprintf("file%d", i), getRandFile(t, ds, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := Mkdir(rt, fmt.Sprintf("/dir%d/child", i), MkdirOpts{Mkparents: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rootdir.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		rootdir.Uncache(fmt.Sprintf("dir%d", i))
+	}
+
+	list := func(opts ListOptions) []ListEntry {
+		t.Helper()
+		var entries []ListEntry
+		err := rootdir.ListEntries(ctx, opts, func(e ListEntry) error {
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	all := list(ListOptions{})
+	if len(all) != 10 {
+		t.Fatalf("listed %d entries, expected 10", len(all))
+	}
+	for _, e := range all {
+		switch e.Type {
+		case TFile:
+			if e.Size != 100 || e.Children != -1 {
+				t.Fatalf("file %s has size %d and %d children", e.Name, e.Size, e.Children)
+			}
+		case TDir:
+			if e.Children != 1 {
+				t.Fatalf("directory %s has %d children, expected 1", e.Name, e.Children)
+			}
+		}
+	}
+
+	var pages []ListEntry
+	for offset := 0; offset < len(all); offset += 3 {
+		page := list(ListOptions{Offset: offset, Limit: 3})
+		if len(page) > 3 {
+			t.Fatalf("listed %d entries, expected at most 3", len(page))
+		}
+		pages = append(pages, page...)
+	}
+	if !slices.Equal(pages, all) {
+		t.Fatal("pages differ from the whole listing")
+	}
+
+	dirs := list(ListOptions{Offset: 1, Limit: 2, Types: []NodeType{TDir}})
+	if len(dirs) != 2 {
+		t.Fatalf("listed %d directories, expected 2", len(dirs))
+	}
+	for _, e := range dirs {
+		if e.Type != TDir {
+			t.Fatalf("listed %s of type %d", e.Name, e.Type)
+		}
+	}
+
+	// The entries are listed without being cached.
+	if len(rootdir.entriesCache) != 0 {
+		t.Fatalf("%d entries were cached", len(rootdir.entriesCache))
+	}
+
+	// The entries are read by pages, and the directory can be accessed
+	// from the callback.
+	defer func(size int) { listPageSize = size }(listPageSize)
+	listPageSize = 3
+	var paged []ListEntry
+	err := rootdir.ListEntries(ctx, ListOptions{}, func(e ListEntry) error {
+		if _, err := rootdir.Child(e.Name); err != nil {
+			return err
+		}
+		paged = append(paged, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(paged, all) {
+		t.Fatal("paged listing differs from the whole listing")
+	}
+	if !slices.Equal(list(ListOptions{Offset: 1, Limit: 2, Types: []NodeType{TDir}}), dirs) {
+		t.Fatal("paged listing of directories differs")
+	}
+	if !slices.Equal(list(ListOptions{Offset: 2, Limit: 5}), all[2:7]) {
+		t.Fatal("paged listing with an offset differs")
+	}
+}
+
+func TestNewEmptyRoot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pnb, err := dag.NewProtoNodeBuilder(dag.WithCidVersion(1), dag.WithHashFunction(mh.BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkPrefix := func(t *testing.T, rt *Root, version, mhType uint64) {
+		t.Helper()
+		if err := Mkdir(rt, "/a/b", MkdirOpts{Mkparents: true, Flush: true}); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{"/", "/a", "/a/b"} {
+			fsn, err := Lookup(rt, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nd, err := fsn.GetNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix := nd.Cid().Prefix()
+			if prefix.Version != version || prefix.MhType != mhType {
+				t.Fatalf("%s: expected CIDv%d with multihash 0x%x, got %s", p, version, mhType, nd.Cid())
+			}
+		}
+	}
+
+	rt, err := NewEmptyRoot(ctx, getDagserv(t), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrefix(t, rt, 0, mh.SHA2_256)
+
+	rt, err = NewEmptyRoot(ctx, getDagserv(t), nil, pnb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrefix(t, rt, 1, mh.BLAKE3)
+
+	defer func(nb *dag.ProtoNodeBuilder) { dag.DefaultProtoNodeBuilder = nb }(dag.DefaultProtoNodeBuilder)
+	dag.DefaultProtoNodeBuilder = pnb
+	rt, err = NewEmptyRoot(ctx, getDagserv(t), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrefix(t, rt, 1, mh.BLAKE3)
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
 	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 )
@@ -125,6 +126,11 @@ type MkdirOpts struct {
 	CidBuilder cid.Builder
 	Mode       os.FileMode
 	ModTime    time.Time
+
+	// DirectoryOptions configure the UnixFS directories that are created,
+	// e.g. their HAMT sharding, in addition to the options inherited from
+	// their parent.
+	DirectoryOptions []uio.DirectoryOption
 }
 
 // Mkdir creates a directory at 'path' under the directory 'd', creating
@@ -155,7 +161,7 @@ func Mkdir(r *Root, pth string, opts MkdirOpts) error {
 	for i, d := range parts[:len(parts)-1] {
 		fsn, err := cur.Child(d)
 		if err == os.ErrNotExist && opts.Mkparents {
-			mkd, err := cur.Mkdir(d)
+			mkd, err := cur.MkdirWithOpts(d, MkdirOpts{DirectoryOptions: opts.DirectoryOptions})
 			if err != nil {
 				return err
 			}
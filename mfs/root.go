@@ -12,6 +12,7 @@ import (
 
 	dag "github.com/ipfs/boxo/ipld/merkledag"
 	ft "github.com/ipfs/boxo/ipld/unixfs"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
 
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
@@ -101,8 +102,10 @@ type Root struct {
 	repub *Republisher
 }
 
-// NewRoot creates a new Root and starts up a republisher routine for it.
-func NewRoot(parent context.Context, ds ipld.DAGService, node *dag.ProtoNode, pf PubFunc) (*Root, error) {
+// NewRoot creates a new Root and starts up a republisher routine for it. The
+// options configure the UnixFS directories of the tree, e.g. their HAMT
+// sharding.
+func NewRoot(parent context.Context, ds ipld.DAGService, node *dag.ProtoNode, pf PubFunc, opts ...uio.DirectoryOption) (*Root, error) {
 	var repub *Republisher
 	if pf != nil {
 		repub = NewRepublisher(pf, repubQuick, repubLong, node.Cid())
@@ -121,7 +124,7 @@ func NewRoot(parent context.Context, ds ipld.DAGService, node *dag.ProtoNode, pf
 
 	switch fsn.Type() {
 	case ft.TDirectory, ft.THAMTShard:
-		newDir, err := NewDirectory(parent, node.String(), node, root, ds)
+		newDir, err := NewDirectory(parent, node.String(), node, root, ds, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -137,6 +140,21 @@ func NewRoot(parent context.Context, ds ipld.DAGService, node *dag.ProtoNode, pf
 	return root, nil
 }
 
+// NewEmptyRoot creates a new Root over an empty directory built with the
+// given ProtoNodeBuilder, or with merkledag.DefaultProtoNodeBuilder if nil, so
+// that the directories created under it use the same CID version and hash
+// function.
+func NewEmptyRoot(parent context.Context, ds ipld.DAGService, pf PubFunc, nb *dag.ProtoNodeBuilder, opts ...uio.DirectoryOption) (*Root, error) {
+	if nb == nil {
+		nb = dag.DefaultProtoNodeBuilder
+	}
+	nd := nb.NodeWithData(ft.FolderPBData())
+	if err := ds.Add(parent, nd); err != nil {
+		return nil, err
+	}
+	return NewRoot(parent, ds, nd, pf, opts...)
+}
+
 // GetDirectory returns the root directory.
 func (kr *Root) GetDirectory() *Directory {
 	return kr.dir
@@ -0,0 +1,165 @@
+package dnslink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+)
+
+// DefaultCloudflareEndpoint is the base URL of the Cloudflare API.
+const DefaultCloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+// CloudflarePublisher is a [Publisher] updating the DNS records of the zones
+// hosted by Cloudflare.
+type CloudflarePublisher struct {
+	token string
+	opts  options
+}
+
+var _ Publisher = (*CloudflarePublisher)(nil)
+
+// NewCloudflarePublisher returns a [CloudflarePublisher] authenticated with
+// token, an API token with the DNS edit permission of the zones of the
+// domains to publish, and the zone read permission unless [WithZoneID] is
+// given.
+func NewCloudflarePublisher(token string, opts ...Option) *CloudflarePublisher {
+	return &CloudflarePublisher{
+		token: token,
+		opts:  processOptions(DefaultCloudflareEndpoint, opts),
+	}
+}
+
+// Publish implements [Publisher].
+func (p *CloudflarePublisher) Publish(ctx context.Context, domain string, value path.Path, options ...PublishOption) (Change, error) {
+	return publish(ctx, p, p.opts.zoneID, domain, value, options)
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// call calls the API and decodes the result of the response into result.
+func (p *CloudflarePublisher) call(ctx context.Context, method, path string, query url.Values, body, result any) error {
+	u := p.opts.endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := p.opts.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var cfRes cloudflareResponse
+	if err = json.NewDecoder(res.Body).Decode(&cfRes); err != nil {
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, res.Status)
+	}
+	if !cfRes.Success {
+		msgs := make([]string, len(cfRes.Errors))
+		for i, e := range cfRes.Errors {
+			msgs[i] = fmt.Sprintf("%s (%d)", e.Message, e.Code)
+		}
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, strings.Join(msgs, ", "))
+	}
+	if result != nil {
+		return json.Unmarshal(cfRes.Result, result)
+	}
+	return nil
+}
+
+func (p *CloudflarePublisher) findZone(ctx context.Context, name string) (string, error) {
+	for _, domain := range parentDomains(name) {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		err := p.call(ctx, http.MethodGet, "/zones", url.Values{"name": {domain}}, nil, &zones)
+		if err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrZoneNotFound, name)
+}
+
+// dnslinkRecord returns the DNSLink record among the TXT records of a name.
+func (p *CloudflarePublisher) dnslinkRecord(ctx context.Context, zone, name string) (*cloudflareRecord, error) {
+	var records []cloudflareRecord
+	err := p.call(ctx, http.MethodGet, "/zones/"+url.PathEscape(zone)+"/dns_records", url.Values{"type": {"TXT"}, "name": {name}}, nil, &records)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		// The content of the TXT records may be quoted.
+		records[i].Content = strings.Trim(records[i].Content, `"`)
+		if strings.HasPrefix(records[i].Content, "dnslink=") {
+			return &records[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *CloudflarePublisher) get(ctx context.Context, zone, name string) (string, time.Duration, bool, error) {
+	r, err := p.dnslinkRecord(ctx, zone, name)
+	if err != nil || r == nil {
+		return "", 0, false, err
+	}
+	// A TTL of 1 is the automatic TTL of Cloudflare, which is not known.
+	return r.Content, time.Duration(r.TTL) * time.Second, true, nil
+}
+
+func (p *CloudflarePublisher) set(ctx context.Context, zone, name, value string, ttl time.Duration) error {
+	r, err := p.dnslinkRecord(ctx, zone, name)
+	if err != nil {
+		return err
+	}
+	record := cloudflareRecord{
+		Type:    "TXT",
+		Name:    name,
+		Content: value,
+		TTL:     int(ttl / time.Second),
+	}
+	if r == nil {
+		return p.call(ctx, http.MethodPost, "/zones/"+url.PathEscape(zone)+"/dns_records", nil, record, nil)
+	}
+	return p.call(ctx, http.MethodPut, "/zones/"+url.PathEscape(zone)+"/dns_records/"+url.PathEscape(r.ID), nil, record, nil)
+}
@@ -0,0 +1,130 @@
+package dnslink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCloudflare serves the zone example.com, with ID "zone1", from the
+// Cloudflare API.
+type fakeCloudflare struct {
+	lk      sync.Mutex
+	records map[string]cloudflareRecord
+	writes  int
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	reply := func(result any) {
+		data, _ := json.Marshal(result)
+		_ = json.NewEncoder(w).Encode(cloudflareResponse{Success: true, Result: data})
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		zones := []map[string]string{}
+		if r.URL.Query().Get("name") == "example.com" {
+			zones = append(zones, map[string]string{"id": "zone1"})
+		}
+		reply(zones)
+	case r.Method == http.MethodGet && r.URL.Path == "/zones/zone1/dns_records":
+		records := []cloudflareRecord{}
+		for _, rec := range f.records {
+			if rec.Name == r.URL.Query().Get("name") && rec.Type == r.URL.Query().Get("type") {
+				records = append(records, rec)
+			}
+		}
+		reply(records)
+	case r.Method == http.MethodPost && r.URL.Path == "/zones/zone1/dns_records":
+		var rec cloudflareRecord
+		_ = json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = "record" + rec.Name
+		f.records[rec.ID] = rec
+		f.writes++
+		reply(rec)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/zones/zone1/dns_records/"):
+		var rec cloudflareRecord
+		_ = json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = strings.TrimPrefix(r.URL.Path, "/zones/zone1/dns_records/")
+		f.records[rec.ID] = rec
+		f.writes++
+		reply(rec)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCloudflarePublisher(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeCloudflare{records: map[string]cloudflareRecord{
+		"other": {ID: "other", Type: "TXT", Name: "_dnslink.example.com", Content: `"v=spf1 -all"`, TTL: 3600},
+	}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	p := NewCloudflarePublisher("token", WithEndpoint(srv.URL))
+	v1, err := path.NewPath("/ipfs/bafkqaaa")
+	require.NoError(t, err)
+	v2, err := path.NewPath("/ipns/example.net")
+	require.NoError(t, err)
+
+	t.Run("Create", func(t *testing.T) {
+		change, err := p.Publish(ctx, "www.Example.com.", v1)
+		require.NoError(t, err)
+		require.Equal(t, Change{Name: "_dnslink.www.example.com", New: "dnslink=/ipfs/bafkqaaa", TTL: DefaultTTL, Applied: true}, change)
+		require.Equal(t, cloudflareRecord{ID: "record_dnslink.www.example.com", Type: "TXT", Name: "_dnslink.www.example.com", Content: "dnslink=/ipfs/bafkqaaa", TTL: 300}, api.records["record_dnslink.www.example.com"])
+	})
+
+	t.Run("Update keeps the TTL", func(t *testing.T) {
+		change, err := p.Publish(ctx, "example.com", v1, PublishWithTTL(time.Minute))
+		require.NoError(t, err)
+		require.True(t, change.Applied)
+
+		change, err = p.Publish(ctx, "example.com", v2)
+		require.NoError(t, err)
+		require.Equal(t, Change{Name: "_dnslink.example.com", Old: "dnslink=/ipfs/bafkqaaa", New: "dnslink=/ipns/example.net", TTL: time.Minute, Applied: true}, change)
+		require.Equal(t, "dnslink=/ipns/example.net", api.records["record_dnslink.example.com"].Content)
+		require.Equal(t, `"v=spf1 -all"`, api.records["other"].Content, "other TXT records are kept")
+	})
+
+	t.Run("Unchanged and dry-run", func(t *testing.T) {
+		writes := api.writes
+		change, err := p.Publish(ctx, "example.com", v2)
+		require.NoError(t, err)
+		require.False(t, change.Applied)
+
+		change, err = p.Publish(ctx, "example.com", v1, PublishWithDryRun(true))
+		require.NoError(t, err)
+		require.False(t, change.Applied)
+		require.Equal(t, "dnslink=/ipfs/bafkqaaa", change.New)
+		require.Equal(t, writes, api.writes)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := p.Publish(ctx, "example.org", v1)
+		require.ErrorIs(t, err, ErrZoneNotFound)
+
+		_, err = NewCloudflarePublisher("bad", WithEndpoint(srv.URL)).Publish(ctx, "example.com", v1)
+		require.ErrorContains(t, err, "Invalid access token")
+
+		// The zone is not looked up when given.
+		_, err = NewCloudflarePublisher("token", WithEndpoint(srv.URL), WithZoneID("zone1")).Publish(ctx, "example.org", v1, PublishWithDryRun(true))
+		require.NoError(t, err)
+	})
+}
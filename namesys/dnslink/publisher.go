@@ -0,0 +1,209 @@
+// Package dnslink publishes [DNSLink] records, by updating the _dnslink TXT
+// records of domains with the APIs of their DNS providers, so that
+// applications can point a domain to new content when it changes.
+//
+// [DNSLink]: https://dnslink.dev/
+package dnslink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("namesys/dnslink")
+
+// DefaultTTL is the TTL of the DNSLink records created without
+// [PublishWithTTL].
+const DefaultTTL = 5 * time.Minute
+
+// ErrZoneNotFound is returned when the DNS provider does not host a zone
+// for the domain to publish.
+var ErrZoneNotFound = errors.New("no DNS zone found for domain")
+
+// Publisher publishes the DNSLink records of domains.
+type Publisher interface {
+	// Publish sets the DNSLink record of domain, the TXT record of
+	// _dnslink.{domain}, to value. The existing DNSLink record is replaced,
+	// or a new one is created.
+	Publish(ctx context.Context, domain string, value path.Path, options ...PublishOption) (Change, error)
+}
+
+// Change describes the update of a DNSLink record by a [Publisher].
+type Change struct {
+	// Name is the name of the TXT record, such as _dnslink.example.com.
+	Name string
+
+	// Old is the previous value of the record, such as
+	// dnslink=/ipfs/bafy..., or empty if the record did not exist.
+	Old string
+
+	// New is the value of the record.
+	New string
+
+	// TTL is the TTL of the record.
+	TTL time.Duration
+
+	// Applied is false if the record was not changed, in dry-run mode or
+	// because it already had the value and the TTL.
+	Applied bool
+}
+
+// PublishOptions are the options of [Publisher.Publish].
+type PublishOptions struct {
+	// TTL is the TTL of the record. If zero, the TTL of the existing record
+	// is kept, or [DefaultTTL] is used for new records.
+	TTL time.Duration
+
+	// DryRun returns the [Change] without updating the record.
+	DryRun bool
+}
+
+// PublishOption is used to set an option for [PublishOptions].
+type PublishOption func(*PublishOptions)
+
+// PublishWithTTL sets [PublishOptions.TTL].
+func PublishWithTTL(ttl time.Duration) PublishOption {
+	return func(o *PublishOptions) {
+		o.TTL = ttl
+	}
+}
+
+// PublishWithDryRun sets [PublishOptions.DryRun].
+func PublishWithDryRun(dryRun bool) PublishOption {
+	return func(o *PublishOptions) {
+		o.DryRun = dryRun
+	}
+}
+
+// ProcessPublishOptions converts an array of [PublishOption] into a [PublishOptions] object.
+func ProcessPublishOptions(opts []PublishOption) PublishOptions {
+	var publishOptions PublishOptions
+	for _, option := range opts {
+		option(&publishOptions)
+	}
+	return publishOptions
+}
+
+// Option configures the client of the API of a DNS provider.
+type Option func(*options)
+
+type options struct {
+	httpClient *http.Client
+	endpoint   string
+	zoneID     string
+	now        func() time.Time
+}
+
+// WithHTTPClient sets the HTTP client used to call the API. Defaults to
+// [http.DefaultClient].
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithEndpoint sets the base URL of the API, for instance to use a proxy.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// WithZoneID sets the ID of the zone of the domains to publish, which is
+// otherwise looked up from the domain names. All the domains published must
+// then be in this zone.
+func WithZoneID(id string) Option {
+	return func(o *options) {
+		o.zoneID = id
+	}
+}
+
+func processOptions(endpoint string, opts []Option) options {
+	o := options{
+		httpClient: http.DefaultClient,
+		endpoint:   endpoint,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// txtRecords reads and writes the TXT records of a zone of a DNS provider.
+type txtRecords interface {
+	// findZone returns the ID of the zone hosting name.
+	findZone(ctx context.Context, name string) (string, error)
+	// get returns the DNSLink value and the TTL of the TXT record name, or
+	// false if there is none.
+	get(ctx context.Context, zone, name string) (string, time.Duration, bool, error)
+	// set creates or replaces the TXT record name.
+	set(ctx context.Context, zone, name, value string, ttl time.Duration) error
+}
+
+// publish implements [Publisher.Publish] with the records of a provider.
+func publish(ctx context.Context, records txtRecords, zoneID, domain string, value path.Path, opts []PublishOption) (Change, error) {
+	options := ProcessPublishOptions(opts)
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if domain == "" {
+		return Change{}, errors.New("empty domain")
+	}
+	change := Change{
+		Name: "_dnslink." + domain,
+		New:  "dnslink=" + value.String(),
+		TTL:  options.TTL,
+	}
+
+	zone := zoneID
+	if zone == "" {
+		var err error
+		if zone, err = records.findZone(ctx, domain); err != nil {
+			return Change{}, err
+		}
+	}
+
+	old, ttl, found, err := records.get(ctx, zone, change.Name)
+	if err != nil {
+		return Change{}, fmt.Errorf("cannot read %s: %w", change.Name, err)
+	}
+	if found {
+		change.Old = old
+		if change.TTL == 0 {
+			change.TTL = ttl
+		}
+	}
+	if change.TTL == 0 {
+		change.TTL = DefaultTTL
+	}
+
+	if (found && change.Old == change.New && change.TTL == ttl) || options.DryRun {
+		return change, nil
+	}
+	if err = records.set(ctx, zone, change.Name, change.New, change.TTL); err != nil {
+		return Change{}, fmt.Errorf("cannot update %s: %w", change.Name, err)
+	}
+	change.Applied = true
+	log.Debugf("published %s: %q", change.Name, change.New)
+	return change, nil
+}
+
+// parentDomains returns domain and its parent domains, from the most
+// specific, as candidates for the zone hosting it.
+func parentDomains(domain string) []string {
+	var domains []string
+	for {
+		domains = append(domains, domain)
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return domains
+		}
+		domain = parent
+	}
+}
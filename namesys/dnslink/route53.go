@@ -0,0 +1,319 @@
+package dnslink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+)
+
+// DefaultRoute53Endpoint is the base URL of the Amazon Route 53 API.
+const DefaultRoute53Endpoint = "https://route53.amazonaws.com"
+
+const (
+	route53Version = "2013-04-01"
+	route53Region  = "us-east-1"
+	route53Service = "route53"
+	route53XMLNS   = "https://route53.amazonaws.com/doc/2013-04-01/"
+)
+
+// Route53Credentials are the AWS credentials used by [Route53Publisher].
+type Route53Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is the token of temporary credentials, if any.
+	SessionToken string
+}
+
+// Route53Publisher is a [Publisher] updating the DNS records of the hosted
+// zones of Amazon Route 53.
+type Route53Publisher struct {
+	creds Route53Credentials
+	opts  options
+}
+
+var _ Publisher = (*Route53Publisher)(nil)
+
+// NewRoute53Publisher returns a [Route53Publisher] authenticated with creds,
+// which must allow route53:ListResourceRecordSets and
+// route53:ChangeResourceRecordSets on the hosted zones of the domains to
+// publish, and route53:ListHostedZonesByName unless [WithZoneID] is given.
+func NewRoute53Publisher(creds Route53Credentials, opts ...Option) *Route53Publisher {
+	return &Route53Publisher{
+		creds: creds,
+		opts:  processOptions(DefaultRoute53Endpoint, opts),
+	}
+}
+
+// Publish implements [Publisher].
+func (p *Route53Publisher) Publish(ctx context.Context, domain string, value path.Path, options ...PublishOption) (Change, error) {
+	return publish(ctx, p, p.opts.zoneID, domain, value, options)
+}
+
+type route53Error struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+type route53RecordSet struct {
+	Name    string   `xml:"Name"`
+	Type    string   `xml:"Type"`
+	TTL     int64    `xml:"TTL"`
+	Records []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type route53ChangeRequest struct {
+	XMLName   xml.Name         `xml:"ChangeResourceRecordSetsRequest"`
+	XMLNS     string           `xml:"xmlns,attr"`
+	Action    string           `xml:"ChangeBatch>Changes>Change>Action"`
+	RecordSet route53RecordSet `xml:"ChangeBatch>Changes>Change>ResourceRecordSet"`
+}
+
+// call calls the API and decodes the response into result.
+func (p *Route53Publisher) call(ctx context.Context, method, path string, query url.Values, body, result any) error {
+	u := p.opts.endpoint + "/" + route53Version + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = xml.Marshal(body); err != nil {
+			return err
+		}
+		payload = append([]byte(xml.Header), payload...)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	if p.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.creds.SessionToken)
+	}
+	signV4(req, payload, p.creds, route53Region, route53Service, p.opts.now())
+
+	res, err := p.opts.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		var apiErr route53Error
+		if xml.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("route53: %s %s: %s: %s", method, path, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("route53: %s %s: %s", method, path, res.Status)
+	}
+	if result != nil {
+		return xml.Unmarshal(data, result)
+	}
+	return nil
+}
+
+func (p *Route53Publisher) findZone(ctx context.Context, name string) (string, error) {
+	for _, domain := range parentDomains(name) {
+		var zones struct {
+			HostedZones []struct {
+				ID     string `xml:"Id"`
+				Name   string `xml:"Name"`
+				Config struct {
+					PrivateZone bool `xml:"PrivateZone"`
+				} `xml:"Config"`
+			} `xml:"HostedZones>HostedZone"`
+		}
+		err := p.call(ctx, http.MethodGet, "/hostedzonesbyname", url.Values{"dnsname": {domain}, "maxitems": {"10"}}, nil, &zones)
+		if err != nil {
+			return "", err
+		}
+		// The zones are sorted by name, starting with domain.
+		for _, z := range zones.HostedZones {
+			if z.Name == domain+"." && !z.Config.PrivateZone {
+				return strings.TrimPrefix(z.ID, "/hostedzone/"), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrZoneNotFound, name)
+}
+
+// recordSet returns the TXT record set name, if it exists.
+func (p *Route53Publisher) recordSet(ctx context.Context, zone, name string) (route53RecordSet, bool, error) {
+	var sets struct {
+		RecordSets []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+	err := p.call(ctx, http.MethodGet, "/hostedzone/"+url.PathEscape(zone)+"/rrset", url.Values{"name": {name}, "type": {"TXT"}, "maxitems": {"1"}}, nil, &sets)
+	if err != nil {
+		return route53RecordSet{}, false, err
+	}
+	// The record sets are sorted by name, starting with name.
+	for _, set := range sets.RecordSets {
+		if set.Name == name+"." && set.Type == "TXT" {
+			return set, true, nil
+		}
+	}
+	return route53RecordSet{}, false, nil
+}
+
+func (p *Route53Publisher) get(ctx context.Context, zone, name string) (string, time.Duration, bool, error) {
+	set, found, err := p.recordSet(ctx, zone, name)
+	if err != nil || !found {
+		return "", 0, false, err
+	}
+	for _, r := range set.Records {
+		if v := unquoteTXT(r); strings.HasPrefix(v, "dnslink=") {
+			return v, time.Duration(set.TTL) * time.Second, true, nil
+		}
+	}
+	return "", 0, false, nil
+}
+
+// set replaces the DNSLink value of the TXT record set name, keeping its
+// other values, as UPSERT replaces the whole record set.
+func (p *Route53Publisher) set(ctx context.Context, zone, name, value string, ttl time.Duration) error {
+	existing, _, err := p.recordSet(ctx, zone, name)
+	if err != nil {
+		return err
+	}
+	records := make([]string, 0, len(existing.Records)+1)
+	replaced := false
+	for _, r := range existing.Records {
+		if !replaced && strings.HasPrefix(unquoteTXT(r), "dnslink=") {
+			r, replaced = quoteTXT(value), true
+		}
+		records = append(records, r)
+	}
+	if !replaced {
+		records = append(records, quoteTXT(value))
+	}
+
+	req := route53ChangeRequest{
+		XMLNS:  route53XMLNS,
+		Action: "UPSERT",
+		RecordSet: route53RecordSet{
+			Name:    name + ".",
+			Type:    "TXT",
+			TTL:     int64(ttl / time.Second),
+			Records: records,
+		},
+	}
+	return p.call(ctx, http.MethodPost, "/hostedzone/"+url.PathEscape(zone)+"/rrset", nil, req, nil)
+}
+
+// quoteTXT returns the value of a TXT record in the zone file format used by
+// Route 53, split in quoted strings of at most 255 characters.
+func quoteTXT(value string) string {
+	var b strings.Builder
+	for first := true; first || value != ""; first = false {
+		n := min(len(value), 255)
+		if !first {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.Quote(value[:n]))
+		value = value[n:]
+	}
+	return b.String()
+}
+
+// unquoteTXT returns the value of a TXT record returned by Route 53, by
+// joining its quoted strings.
+func unquoteTXT(value string) string {
+	var b strings.Builder
+	for value = strings.TrimSpace(value); value != ""; value = strings.TrimSpace(value) {
+		s, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			b.WriteString(value)
+			break
+		}
+		u, _ := strconv.Unquote(s)
+		b.WriteString(u)
+		value = value[len(s):]
+	}
+	return b.String()
+}
+
+// signV4 signs req with the AWS Signature Version 4, over all its headers.
+func signV4(req *http.Request, payload []byte, creds Route53Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted and encoded as in the canonical
+// requests of the AWS Signature Version 4.
+func canonicalQuery(query url.Values) string {
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, escape(k)+"="+escape(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
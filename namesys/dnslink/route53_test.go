@@ -0,0 +1,138 @@
+package dnslink
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignV4(t *testing.T) {
+	t.Parallel()
+
+	// The example of the AWS Signature Version 4 documentation.
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := Route53Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	require.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+}
+
+func TestQuoteTXT(t *testing.T) {
+	t.Parallel()
+
+	long := "dnslink=/ipfs/" + strings.Repeat("a", 300)
+	for _, v := range []string{"dnslink=/ipfs/bafkqaaa", `with "quotes"`, long} {
+		require.Equal(t, v, unquoteTXT(quoteTXT(v)))
+	}
+	require.Equal(t, 2, strings.Count(quoteTXT(long), `" "`)+1)
+}
+
+// fakeRoute53 serves the hosted zone example.com, with ID "Z1", from the
+// Route 53 API.
+type fakeRoute53 struct {
+	lk      sync.Mutex
+	records map[string]route53RecordSet
+	writes  int
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>InvalidClientTokenId</Code><Message>bad key</Message></Error></ErrorResponse>`))
+		return
+	}
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzonesbyname":
+		// Zones sorted by name, starting at dnsname.
+		fmt.Fprint(w, `<ListHostedZonesByNameResponse><HostedZones>`)
+		if name := q.Get("dnsname"); name <= "example.com" {
+			fmt.Fprint(w, `<HostedZone><Id>/hostedzone/Z1</Id><Name>example.com.</Name></HostedZone>`)
+		}
+		fmt.Fprint(w, `</HostedZones></ListHostedZonesByNameResponse>`)
+	case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset":
+		set, ok := f.records[q.Get("name")+"."]
+		if !ok {
+			set = route53RecordSet{Name: "zzz.example.com.", Type: "A", TTL: 60, Records: []string{"127.0.0.1"}}
+		}
+		data, _ := xml.Marshal(set)
+		fmt.Fprintf(w, `<ListResourceRecordSetsResponse><ResourceRecordSets><ResourceRecordSet>%s</ResourceRecordSet></ResourceRecordSets></ListResourceRecordSetsResponse>`,
+			strings.TrimSuffix(strings.TrimPrefix(string(data), "<route53RecordSet>"), "</route53RecordSet>"))
+	case r.Method == http.MethodPost && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset":
+		body, _ := io.ReadAll(r.Body)
+		var req route53ChangeRequest
+		if err := xml.Unmarshal(body, &req); err != nil || req.Action != "UPSERT" || r.Header.Get("Content-Type") != "application/xml" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f.records[req.RecordSet.Name] = req.RecordSet
+		f.writes++
+		fmt.Fprint(w, `<ChangeResourceRecordSetsResponse/>`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRoute53Publisher(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeRoute53{records: map[string]route53RecordSet{}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	p := NewRoute53Publisher(Route53Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, WithEndpoint(srv.URL))
+	v1, err := path.NewPath("/ipfs/bafkqaaa")
+	require.NoError(t, err)
+	v2, err := path.NewPath("/ipfs/bafkqaaa/sub")
+	require.NoError(t, err)
+
+	change, err := p.Publish(ctx, "app.example.com", v1, PublishWithTTL(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, Change{Name: "_dnslink.app.example.com", New: "dnslink=/ipfs/bafkqaaa", TTL: time.Hour, Applied: true}, change)
+	require.Equal(t, route53RecordSet{Name: "_dnslink.app.example.com.", Type: "TXT", TTL: 3600, Records: []string{`"dnslink=/ipfs/bafkqaaa"`}},
+		api.records["_dnslink.app.example.com."])
+
+	change, err = p.Publish(ctx, "app.example.com", v2)
+	require.NoError(t, err)
+	require.Equal(t, Change{Name: "_dnslink.app.example.com", Old: "dnslink=/ipfs/bafkqaaa", New: "dnslink=/ipfs/bafkqaaa/sub", TTL: time.Hour, Applied: true}, change)
+
+	change, err = p.Publish(ctx, "app.example.com", v2)
+	require.NoError(t, err)
+	require.False(t, change.Applied)
+	require.Equal(t, 2, api.writes)
+
+	// The other values of the record set are kept.
+	api.lk.Lock()
+	api.records["_dnslink.other.example.com."] = route53RecordSet{Name: "_dnslink.other.example.com.", Type: "TXT", TTL: 60, Records: []string{`"verification=123"`}}
+	api.lk.Unlock()
+	_, err = p.Publish(ctx, "other.example.com", v1, PublishWithTTL(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []string{`"verification=123"`, `"dnslink=/ipfs/bafkqaaa"`}, api.records["_dnslink.other.example.com."].Records)
+	_, err = p.Publish(ctx, "other.example.com", v2)
+	require.NoError(t, err)
+	require.Equal(t, []string{`"verification=123"`, `"dnslink=/ipfs/bafkqaaa/sub"`}, api.records["_dnslink.other.example.com."].Records)
+
+	_, err = p.Publish(ctx, "example.org", v1)
+	require.ErrorIs(t, err, ErrZoneNotFound)
+
+	_, err = NewRoute53Publisher(Route53Credentials{AccessKeyID: "other"}, WithEndpoint(srv.URL)).Publish(ctx, "example.com", v1)
+	require.ErrorContains(t, err, "InvalidClientTokenId: bad key")
+}
@@ -51,6 +51,7 @@ type namesys struct {
 	staticMap   map[string]*cacheEntry
 	cache       *lru.Cache[string, cacheEntry]
 	maxCacheTTL *time.Duration
+	maxDepth    uint
 }
 
 var _ NameSystem = &namesys{}
@@ -88,6 +89,16 @@ func WithMaxCacheTTL(dur time.Duration) Option {
 	}
 }
 
+// WithMaxDepth limits the recursion depth of every resolution. Depths
+// requested with [ResolveWithDepth] above the limit, including
+// [UnlimitedDepth], are lowered to it.
+func WithMaxDepth(depth uint) Option {
+	return func(ns *namesys) error {
+		ns.maxDepth = depth
+		return nil
+	}
+}
+
 // WithDNSResolver is an option that supplies a custom DNS resolver to use instead
 // of the system default.
 func WithDNSResolver(rslv madns.BasicResolver) Option {
@@ -157,14 +168,23 @@ func (ns *namesys) Resolve(ctx context.Context, p path.Path, options ...ResolveO
 	ctx, span := startSpan(ctx, "namesys.Resolve", trace.WithAttributes(attribute.Stringer("Path", p)))
 	defer span.End()
 
-	return resolve(ctx, ns, p, ProcessResolveOptions(options))
+	return resolve(ctx, ns, p, ns.resolveOptions(options))
 }
 
 func (ns *namesys) ResolveAsync(ctx context.Context, p path.Path, options ...ResolveOption) <-chan AsyncResult {
 	ctx, span := startSpan(ctx, "namesys.ResolveAsync", trace.WithAttributes(attribute.Stringer("Path", p)))
 	defer span.End()
 
-	return resolveAsync(ctx, ns, p, ProcessResolveOptions(options))
+	return resolveAsync(ctx, ns, p, ns.resolveOptions(options))
+}
+
+// resolveOptions processes the given options, applying the maximum depth.
+func (ns *namesys) resolveOptions(options []ResolveOption) ResolveOptions {
+	opts := ProcessResolveOptions(options)
+	if ns.maxDepth != UnlimitedDepth && (opts.Depth == UnlimitedDepth || opts.Depth > ns.maxDepth) {
+		opts.Depth = ns.maxDepth
+	}
+	return opts
 }
 
 // resolveOnce implements resolver.
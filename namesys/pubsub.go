@@ -0,0 +1,363 @@
+package namesys
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+// PubSub is the publish-subscribe system used by [PubsubValueStore] to
+// exchange IPNS Records. It can be implemented with libp2p's gossipsub, or any
+// other pubsub backend.
+type PubSub interface {
+	// Publish publishes data on topic.
+	Publish(ctx context.Context, topic string, data []byte) error
+
+	// Subscribe subscribes to the messages published on topic.
+	Subscribe(topic string) (Subscription, error)
+}
+
+// Subscription is a subscription to a [PubSub] topic.
+type Subscription interface {
+	// Next returns the next message published on the topic. It returns an
+	// error once the subscription is cancelled.
+	Next(ctx context.Context) ([]byte, error)
+
+	// Cancel cancels the subscription.
+	Cancel()
+}
+
+// PubsubTopic returns the [PubSub] topic of the IPNS Records of name, which is
+// the same as the one of the libp2p pubsub router used by Kubo.
+func PubsubTopic(name ipns.Name) string {
+	return "/record/" + base64.RawURLEncoding.EncodeToString(name.RoutingKey())
+}
+
+// PubsubValueStore is a [routing.ValueStore] exchanging IPNS Records over a
+// [PubSub] topic per name, in addition to another [routing.ValueStore] such as
+// the DHT. It can be passed to [NewNameSystem], or to [NewIPNSResolver] and
+// [NewIPNSPublisher].
+//
+// The topic of a name is subscribed to the first time the name is resolved,
+// and the best record received since is kept in memory, until it expires, to
+// answer the next resolutions without waiting for the other
+// [routing.ValueStore]. Records are published on the topic of their name, as
+// well as to the other [routing.ValueStore]. Past
+// [WithMaxPubsubSubscriptions] names, the least recently resolved name is
+// unsubscribed from.
+type PubsubValueStore struct {
+	ps        PubSub
+	routing   routing.ValueStore
+	validator ipns.Validator
+	maxSubs   int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	subs map[ipns.Name]*pubsubName
+}
+
+// pubsubName is the state of a subscribed name.
+type pubsubName struct {
+	sub  Subscription
+	best []byte
+	// eol is the end of the validity of best.
+	eol time.Time
+	// used is the last time the name was resolved.
+	used time.Time
+}
+
+// setBest makes the valid record data the best record of the name.
+func (ps *pubsubName) setBest(data []byte) {
+	ps.best = data
+	ps.eol = time.Time{}
+	if rec, err := ipns.UnmarshalRecord(data); err == nil {
+		ps.eol, _ = rec.Validity()
+	}
+}
+
+var _ routing.ValueStore = (*PubsubValueStore)(nil)
+
+// DefaultMaxPubsubSubscriptions is the default maximum number of names whose
+// topic a [PubsubValueStore] is subscribed to.
+const DefaultMaxPubsubSubscriptions = 1024
+
+// PubsubOption configures a [PubsubValueStore].
+type PubsubOption func(*PubsubValueStore)
+
+// WithMaxPubsubSubscriptions sets the maximum number of names whose topic is
+// subscribed to, instead of [DefaultMaxPubsubSubscriptions]. Past it, the
+// least recently resolved name is unsubscribed from. Zero means no limit.
+func WithMaxPubsubSubscriptions(n int) PubsubOption {
+	return func(s *PubsubValueStore) {
+		s.maxSubs = n
+	}
+}
+
+// NewPubsubValueStore constructs a [PubsubValueStore] from a [PubSub] and
+// another [routing.ValueStore], which can be nil to only use the [PubSub].
+func NewPubsubValueStore(ps PubSub, route routing.ValueStore, opts ...PubsubOption) *PubsubValueStore {
+	if ps == nil {
+		panic("attempt to create pubsub value store with nil pubsub system")
+	}
+	if route == nil {
+		route = routinghelpers.Null{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &PubsubValueStore{
+		ps:      ps,
+		routing: route,
+		maxSubs: DefaultMaxPubsubSubscriptions,
+		ctx:     ctx,
+		cancel:  cancel,
+		subs:    make(map[ipns.Name]*pubsubName),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// PutValue implements [routing.ValueStore]. IPNS Records are published on the
+// topic of their name, and put to the other [routing.ValueStore].
+func (s *PubsubValueStore) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	name, ok := pubsubKeyName(key)
+	if !ok {
+		return s.routing.PutValue(ctx, key, value, opts...)
+	}
+	if err := s.validator.Validate(key, value); err != nil {
+		return err
+	}
+	s.update(name, value)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.routing.PutValue(ctx, key, value, opts...)
+	}()
+	pubErr := s.ps.Publish(ctx, PubsubTopic(name), value)
+	routingErr := <-errs
+	if errors.Is(routingErr, routing.ErrNotSupported) {
+		routingErr = nil
+	}
+	return errors.Join(pubErr, routingErr)
+}
+
+// GetValue implements [routing.ValueStore]. The topic of the name of an IPNS
+// Record is subscribed to, and the best record received on it is returned if
+// any and not expired. Otherwise, the record is looked up with the other
+// [routing.ValueStore].
+func (s *PubsubValueStore) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	if name, ok := pubsubKeyName(key); ok {
+		if best, err := s.subscribe(name); err != nil {
+			log.Debugf("could not subscribe to the IPNS pubsub topic of %s: %s", name, err)
+		} else if best != nil {
+			return best, nil
+		}
+	}
+	return s.routing.GetValue(ctx, key, opts...)
+}
+
+// SearchValue implements [routing.ValueStore]. The topic of the name of an
+// IPNS Record is subscribed to, and the best record received on it is returned
+// first if any, followed by the better records found with the other
+// [routing.ValueStore].
+func (s *PubsubValueStore) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	name, ok := pubsubKeyName(key)
+	if !ok {
+		return s.routing.SearchValue(ctx, key, opts...)
+	}
+
+	best, err := s.subscribe(name)
+	if err != nil {
+		log.Debugf("could not subscribe to the IPNS pubsub topic of %s: %s", name, err)
+	}
+
+	vals, err := s.routing.SearchValue(ctx, key, opts...)
+	if err != nil && best == nil {
+		return nil, err
+	}
+
+	out := make(chan []byte, 1)
+	if best != nil {
+		out <- best
+	}
+	if err != nil {
+		close(out)
+		return out, nil
+	}
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case val, ok := <-vals:
+				if !ok {
+					return
+				}
+				if best != nil && !s.better(key, best, val) {
+					continue
+				}
+				best = val
+				s.update(name, val)
+				select {
+				case out <- val:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Subscriptions returns the names whose topic is subscribed to.
+func (s *PubsubValueStore) Subscriptions() []ipns.Name {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]ipns.Name, 0, len(s.subs))
+	for name := range s.subs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Cancel unsubscribes from the topic of name, and forgets its best record. It
+// returns false if the topic was not subscribed to.
+func (s *PubsubValueStore) Cancel(name ipns.Name) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ps, ok := s.subs[name]
+	if !ok {
+		return false
+	}
+	ps.sub.Cancel()
+	delete(s.subs, name)
+	return true
+}
+
+// Close unsubscribes from all the topics.
+func (s *PubsubValueStore) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, ps := range s.subs {
+		ps.sub.Cancel()
+		delete(s.subs, name)
+	}
+	return nil
+}
+
+// subscribe subscribes to the topic of name if needed, and returns the best
+// record received on it, or nil if there is none or it expired.
+func (s *PubsubValueStore) subscribe(name ipns.Name) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if ps, ok := s.subs[name]; ok {
+		ps.used = now
+		if ps.best != nil && !ps.eol.IsZero() && now.After(ps.eol) {
+			ps.best = nil
+		}
+		return ps.best, nil
+	}
+	if s.ctx.Err() != nil {
+		return nil, s.ctx.Err()
+	}
+
+	if s.maxSubs > 0 && len(s.subs) >= s.maxSubs {
+		s.evictLocked()
+	}
+	sub, err := s.ps.Subscribe(PubsubTopic(name))
+	if err != nil {
+		return nil, err
+	}
+	ps := &pubsubName{sub: sub, used: now}
+	s.subs[name] = ps
+	go s.handleSubscription(name, ps)
+	return nil, nil
+}
+
+// handleSubscription keeps the best valid record received on the topic of
+// name until the subscription is cancelled.
+func (s *PubsubValueStore) handleSubscription(name ipns.Name, ps *pubsubName) {
+	key := string(name.RoutingKey())
+	for {
+		data, err := ps.sub.Next(s.ctx)
+		if err != nil {
+			return
+		}
+		if err := s.validator.Validate(key, data); err != nil {
+			log.Debugf("invalid IPNS record received on the pubsub topic of %s: %s", name, err)
+			continue
+		}
+
+		s.mu.Lock()
+		if ps.best == nil || s.better(key, ps.best, data) {
+			ps.setBest(data)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// update replaces the best record of name by value, if name is subscribed to
+// and value is better.
+func (s *PubsubValueStore) update(name ipns.Name, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ps, ok := s.subs[name]
+	if ok && (ps.best == nil || s.better(string(name.RoutingKey()), ps.best, value)) {
+		ps.setBest(value)
+	}
+}
+
+// evictLocked unsubscribes from the topic of the least recently resolved
+// name.
+func (s *PubsubValueStore) evictLocked() {
+	var oldest ipns.Name
+	var oldestPS *pubsubName
+	for name, ps := range s.subs {
+		if oldestPS == nil || ps.used.Before(oldestPS.used) {
+			oldest, oldestPS = name, ps
+		}
+	}
+	if oldestPS == nil {
+		return
+	}
+	log.Debugf("unsubscribing from the IPNS pubsub topic of %s", oldest)
+	oldestPS.sub.Cancel()
+	delete(s.subs, oldest)
+}
+
+// better returns true if the record val is better than best.
+func (s *PubsubValueStore) better(key string, best, val []byte) bool {
+	i, err := s.validator.Select(key, [][]byte{best, val})
+	return err == nil && i == 1
+}
+
+// pubsubKeyName returns the name of an IPNS routing key.
+func pubsubKeyName(key string) (ipns.Name, bool) {
+	if !strings.HasPrefix(key, ipns.NamespacePrefix) {
+		return ipns.Name{}, false
+	}
+	name, err := ipns.NameFromRoutingKey([]byte(key))
+	if err != nil {
+		return ipns.Name{}, false
+	}
+	return name, true
+}
@@ -0,0 +1,200 @@
+package namesys
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/boxo/routing/offline"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	record "github.com/libp2p/go-libp2p-record"
+	tnet "github.com/libp2p/go-libp2p-testing/net"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPubSub struct {
+	mu   sync.Mutex
+	subs map[string]map[*mockSubscription]struct{}
+}
+
+func newMockPubSub() *mockPubSub {
+	return &mockPubSub{subs: make(map[string]map[*mockSubscription]struct{})}
+}
+
+func (ps *mockPubSub) Publish(ctx context.Context, topic string, data []byte) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for sub := range ps.subs[topic] {
+		select {
+		case sub.msgs <- data:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (ps *mockPubSub) Subscribe(topic string) (Subscription, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub := &mockSubscription{ps: ps, topic: topic, msgs: make(chan []byte, 16), done: make(chan struct{})}
+	if ps.subs[topic] == nil {
+		ps.subs[topic] = make(map[*mockSubscription]struct{})
+	}
+	ps.subs[topic][sub] = struct{}{}
+	return sub, nil
+}
+
+func (ps *mockPubSub) subscribers(topic string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.subs[topic])
+}
+
+type mockSubscription struct {
+	ps    *mockPubSub
+	topic string
+	msgs  chan []byte
+	done  chan struct{}
+}
+
+func (s *mockSubscription) Next(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-s.msgs:
+		return data, nil
+	case <-s.done:
+		return nil, errors.New("subscription cancelled")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *mockSubscription) Cancel() {
+	s.ps.mu.Lock()
+	defer s.ps.mu.Unlock()
+	delete(s.ps.subs[s.topic], s)
+	close(s.done)
+}
+
+func TestPubsubValueStore(t *testing.T) {
+	t.Parallel()
+
+	pathCat := path.FromCid(cid.MustParse("bafkqabddmf2au"))
+	pathDog := path.FromCid(cid.MustParse("bafkqabden5tqu"))
+
+	ps := newMockPubSub()
+	id := tnet.RandIdentityOrFatal(t)
+	name := ipns.NameFromPeer(id.ID())
+	ctx := context.Background()
+
+	// The publisher also puts its records to another routing system.
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	r := offline.NewOfflineRouter(dstore, record.NamespacedValidator{
+		"ipns": ipns.Validator{},
+		"pk":   record.PublicKeyValidator{},
+	})
+	publisherStore := NewPubsubValueStore(ps, r)
+	t.Cleanup(func() { publisherStore.Close() })
+	publisher := NewIPNSPublisher(publisherStore, dstore)
+
+	// The resolver only uses pubsub.
+	resolverStore := NewPubsubValueStore(ps, nil)
+	t.Cleanup(func() { resolverStore.Close() })
+	resolver := NewIPNSResolver(resolverStore)
+
+	// The topic is subscribed to on first resolve.
+	_, err := resolver.Resolve(ctx, name.AsPath())
+	require.Error(t, err)
+	require.Equal(t, []ipns.Name{name}, resolverStore.Subscriptions())
+	require.Equal(t, 1, ps.subscribers(PubsubTopic(name)))
+
+	// Published records are received over pubsub.
+	require.NoError(t, publisher.Publish(ctx, id.PrivateKey(), pathCat))
+	require.Eventually(t, func() bool {
+		res, err := resolver.Resolve(ctx, name.AsPath())
+		return err == nil && res.Path.String() == pathCat.String()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, publisher.Publish(ctx, id.PrivateKey(), pathDog))
+	require.Eventually(t, func() bool {
+		res, err := resolver.Resolve(ctx, name.AsPath())
+		return err == nil && res.Path.String() == pathDog.String()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Records are also put to the other routing system.
+	res, err := NewIPNSResolver(r).Resolve(ctx, name.AsPath())
+	require.NoError(t, err)
+	require.Equal(t, pathDog, res.Path)
+
+	// Invalid records are ignored.
+	require.NoError(t, ps.Publish(ctx, PubsubTopic(name), []byte("invalid")))
+	res, err = resolver.Resolve(ctx, name.AsPath())
+	require.NoError(t, err)
+	require.Equal(t, pathDog, res.Path)
+
+	// The publisher subscribed too, when looking up its previous record.
+	require.Equal(t, 2, ps.subscribers(PubsubTopic(name)))
+	require.True(t, resolverStore.Cancel(name))
+	require.False(t, resolverStore.Cancel(name))
+	require.Empty(t, resolverStore.Subscriptions())
+	require.Equal(t, 1, ps.subscribers(PubsubTopic(name)))
+}
+
+func TestPubsubValueStoreExpiredRecord(t *testing.T) {
+	t.Parallel()
+
+	ps := newMockPubSub()
+	id := tnet.RandIdentityOrFatal(t)
+	name := ipns.NameFromPeer(id.ID())
+	key := string(name.RoutingKey())
+	ctx := context.Background()
+
+	store := NewPubsubValueStore(ps, nil)
+	t.Cleanup(func() { store.Close() })
+	_, err := store.GetValue(ctx, key)
+	require.Error(t, err)
+
+	eol := time.Now().Add(500 * time.Millisecond)
+	rec, err := ipns.NewRecord(id.PrivateKey(), path.FromCid(cid.MustParse("bafkqabddmf2au")), 1, eol, 0)
+	require.NoError(t, err)
+	data, err := ipns.MarshalRecord(rec)
+	require.NoError(t, err)
+	require.NoError(t, ps.Publish(ctx, PubsubTopic(name), data))
+	require.Eventually(t, func() bool {
+		val, err := store.GetValue(ctx, key)
+		return err == nil && string(val) == string(data)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Once expired, the record is no longer returned.
+	time.Sleep(time.Until(eol) + 10*time.Millisecond)
+	_, err = store.GetValue(ctx, key)
+	require.ErrorIs(t, err, routing.ErrNotFound)
+}
+
+func TestPubsubValueStoreMaxSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	ps := newMockPubSub()
+	ctx := context.Background()
+	store := NewPubsubValueStore(ps, nil, WithMaxPubsubSubscriptions(1))
+	t.Cleanup(func() { store.Close() })
+
+	first := ipns.NameFromPeer(tnet.RandIdentityOrFatal(t).ID())
+	second := ipns.NameFromPeer(tnet.RandIdentityOrFatal(t).ID())
+	_, _ = store.GetValue(ctx, string(first.RoutingKey()))
+	_, _ = store.GetValue(ctx, string(second.RoutingKey()))
+
+	// The least recently resolved name was unsubscribed from.
+	require.Equal(t, []ipns.Name{second}, store.Subscriptions())
+	require.Equal(t, 0, ps.subscribers(PubsubTopic(first)))
+	require.Equal(t, 1, ps.subscribers(PubsubTopic(second)))
+}
@@ -120,11 +120,11 @@ func (rp *Republisher) republishEntries(ctx context.Context) error {
 			return err
 		}
 		for _, name := range keyNames {
-			priv, err := rp.ks.Get(name)
+			signer, err := keystore.GetSigner(rp.ks, name)
 			if err != nil {
 				return err
 			}
-			err = rp.republishEntry(ctx, priv)
+			err = rp.republishEntry(ctx, keystore.PrivKey(signer))
 			if err != nil {
 				return err
 			}
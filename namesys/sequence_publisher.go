@@ -0,0 +1,338 @@
+package namesys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/whyrusleeping/base32"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultRepublishInterval is the default interval used by
+	// [SequencePublisher.RunRepublisher] between republish rounds.
+	DefaultRepublishInterval = time.Hour * 4
+
+	// DefaultRepublishJitter is the default fraction of the republish interval
+	// used to randomize each republish round.
+	DefaultRepublishJitter = 0.1
+)
+
+// ErrNoPublishState is returned by [SequencePublisher.Republish] when there
+// is no persisted state for the given key, i.e. the key was never published
+// through a [SequencePublisher].
+var ErrNoPublishState = errors.New("no publish state for key")
+
+// PublishState is the state persisted by [SequencePublisher] for each key.
+type PublishState struct {
+	// Sequence is the last sequence number used to sign a record.
+	Sequence uint64
+
+	// Value is the last value that was published.
+	Value string
+
+	// Validity is the end of the validity window of the last published record.
+	Validity time.Time
+
+	// TTL is the TTL of the last published record.
+	TTL time.Duration
+}
+
+// SequencePublisher is a [Publisher] that persists, per key, the last used
+// sequence number and validity window in a [ds.Datastore]. Every record it
+// signs has a strictly greater sequence number than the previous one, also
+// across restarts, so that records it publishes are never rejected by the
+// routing system in favour of older ones.
+//
+// The persisted state is written before the record is put to the routing
+// system, so that a crash in between never leads to a sequence number being
+// reused.
+type SequencePublisher struct {
+	routing routing.ValueStore
+	ds      ds.Datastore
+
+	recordLifetime    time.Duration
+	republishInterval time.Duration
+	republishJitter   float64
+
+	mu sync.Mutex
+}
+
+var _ Publisher = &SequencePublisher{}
+
+// SequencePublisherOption is an option for [NewSequencePublisher].
+type SequencePublisherOption func(*SequencePublisher)
+
+// WithRecordLifetime sets the lifetime of records created by
+// [SequencePublisher.Republish]. Defaults to [ipns.DefaultRecordLifetime].
+func WithRecordLifetime(d time.Duration) SequencePublisherOption {
+	return func(p *SequencePublisher) {
+		p.recordLifetime = d
+	}
+}
+
+// WithRepublishInterval sets the interval between republish rounds of
+// [SequencePublisher.RunRepublisher]. Defaults to [DefaultRepublishInterval].
+func WithRepublishInterval(d time.Duration) SequencePublisherOption {
+	return func(p *SequencePublisher) {
+		p.republishInterval = d
+	}
+}
+
+// WithRepublishJitter sets the fraction (0 to 1) of the republish interval by
+// which each round is randomly shifted, so that many nodes started at the same
+// time do not republish in lockstep. Defaults to [DefaultRepublishJitter].
+func WithRepublishJitter(fraction float64) SequencePublisherOption {
+	return func(p *SequencePublisher) {
+		p.republishJitter = fraction
+	}
+}
+
+// NewSequencePublisher constructs a new [SequencePublisher] from a
+// [routing.ValueStore] and a [ds.Datastore].
+func NewSequencePublisher(route routing.ValueStore, ds ds.Datastore, opts ...SequencePublisherOption) *SequencePublisher {
+	if ds == nil {
+		panic("nil datastore")
+	}
+
+	p := &SequencePublisher{
+		routing:           route,
+		ds:                ds,
+		recordLifetime:    ipns.DefaultRecordLifetime,
+		republishInterval: DefaultRepublishInterval,
+		republishJitter:   DefaultRepublishJitter,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// PublishStateDsKey returns the datastore key under which [SequencePublisher]
+// persists the [PublishState] of the given name.
+func PublishStateDsKey(name ipns.Name) ds.Key {
+	return ds.NewKey("/ipns-publish-state/" + base32.RawStdEncoding.EncodeToString([]byte(name.Peer())))
+}
+
+// Publish signs and publishes a record for the given value with a sequence
+// number strictly greater than any previously used for this key.
+func (p *SequencePublisher) Publish(ctx context.Context, priv crypto.PrivKey, value path.Path, options ...PublishOption) error {
+	ctx, span := startSpan(ctx, "SequencePublisher.Publish", trace.WithAttributes(attribute.String("Value", value.String())))
+	defer span.End()
+
+	rec, err := p.nextRecord(ctx, priv, value, ProcessPublishOptions(options))
+	if err != nil {
+		return err
+	}
+
+	return PublishIPNSRecord(ctx, p.routing, priv.GetPublic(), rec)
+}
+
+// Republish publishes again the last value published for the given key, with
+// a new validity window of [WithRecordLifetime] and the next sequence number.
+// It returns [ErrNoPublishState] if the key was never published.
+func (p *SequencePublisher) Republish(ctx context.Context, priv crypto.PrivKey) error {
+	ctx, span := startSpan(ctx, "SequencePublisher.Republish")
+	defer span.End()
+
+	name, err := nameFromPrivKey(priv)
+	if err != nil {
+		return err
+	}
+
+	state, found, err := p.State(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNoPublishState
+	}
+
+	value, err := path.NewPath(state.Value)
+	if err != nil {
+		return err
+	}
+
+	opts := DefaultPublishOptions()
+	opts.EOL = time.Now().Add(p.recordLifetime)
+	if state.Validity.After(opts.EOL) {
+		opts.EOL = state.Validity
+	}
+	if state.TTL != 0 {
+		opts.TTL = state.TTL
+	}
+
+	rec, err := p.nextRecord(ctx, priv, value, opts)
+	if err != nil {
+		return err
+	}
+
+	return PublishIPNSRecord(ctx, p.routing, priv.GetPublic(), rec)
+}
+
+// RunRepublisher republishes the keys returned by the given function every
+// [WithRepublishInterval], randomly shifted by [WithRepublishJitter]. Keys
+// that were never published are skipped. It blocks until the context is
+// cancelled.
+func (p *SequencePublisher) RunRepublisher(ctx context.Context, keys func() ([]crypto.PrivKey, error)) {
+	timer := time.NewTimer(p.nextRepublishDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			privs, err := keys()
+			if err != nil {
+				log.Errorf("republisher could not list keys: %s", err)
+			}
+			for _, priv := range privs {
+				err := p.Republish(ctx, priv)
+				if err != nil && !errors.Is(err, ErrNoPublishState) {
+					log.Infof("republisher failed to republish: %s", err)
+				}
+			}
+			timer.Reset(p.nextRepublishDelay())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *SequencePublisher) nextRepublishDelay() time.Duration {
+	d := p.republishInterval
+	if p.republishJitter <= 0 {
+		return d
+	}
+	jitter := time.Duration(p.republishJitter * float64(d))
+	if jitter <= 0 {
+		return d
+	}
+	return d - jitter + time.Duration(rand.Int63n(int64(2*jitter)))
+}
+
+// State returns the persisted [PublishState] for the given name. The boolean
+// is false if there is no state for the name.
+func (p *SequencePublisher) State(ctx context.Context, name ipns.Name) (PublishState, bool, error) {
+	var state PublishState
+
+	data, err := p.ds.Get(ctx, PublishStateDsKey(name))
+	if err != nil {
+		if errors.Is(err, ds.ErrNotFound) {
+			return state, false, nil
+		}
+		return state, false, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false, err
+	}
+	return state, true, nil
+}
+
+func (p *SequencePublisher) nextRecord(ctx context.Context, priv crypto.PrivKey, value path.Path, opts PublishOptions) (*ipns.Record, error) {
+	name, err := nameFromPrivKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq, err := p.lastSequence(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	seq++
+
+	// Persist the state before anything leaves this node, so that a restart
+	// never signs two different records with the same sequence number.
+	state := PublishState{
+		Sequence: seq,
+		Value:    value.String(),
+		Validity: opts.EOL,
+		TTL:      opts.TTL,
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	stateKey := PublishStateDsKey(name)
+	if err := p.ds.Put(ctx, stateKey, data); err != nil {
+		return nil, err
+	}
+	if err := p.ds.Sync(ctx, stateKey); err != nil {
+		return nil, err
+	}
+
+	rec, err := ipns.NewRecord(priv, value, seq, opts.EOL, opts.TTL, opts.IPNSOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the record where IPNSPublisher.ListPublished and the republisher
+	// package expect it.
+	recData, err := ipns.MarshalRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	recKey := IpnsDsKey(name)
+	if err := p.ds.Put(ctx, recKey, recData); err != nil {
+		return nil, err
+	}
+	if err := p.ds.Sync(ctx, recKey); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// lastSequence returns the highest sequence number known for the name, taking
+// into account the persisted state, the locally stored record and the record
+// in the routing system. The latter two cover keys that were previously
+// published with a different [Publisher].
+func (p *SequencePublisher) lastSequence(ctx context.Context, name ipns.Name) (uint64, error) {
+	var seq uint64
+
+	state, found, err := p.State(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if found {
+		seq = state.Sequence
+	}
+
+	rec, err := (&IPNSPublisher{routing: p.routing, ds: p.ds}).GetPublished(ctx, name, !found)
+	if err != nil {
+		return 0, err
+	}
+	if rec != nil {
+		recSeq, err := rec.Sequence()
+		if err != nil {
+			return 0, err
+		}
+		if recSeq > seq {
+			seq = recSeq
+		}
+	}
+
+	return seq, nil
+}
+
+func nameFromPrivKey(priv crypto.PrivKey) (ipns.Name, error) {
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return ipns.Name{}, err
+	}
+	return ipns.NameFromPeer(id), nil
+}
@@ -0,0 +1,102 @@
+package namesys
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	mockrouting "github.com/ipfs/boxo/routing/mock"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	testutil "github.com/libp2p/go-libp2p-testing/net"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencePublisher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	id := testutil.RandIdentityOrFatal(t)
+	name := ipns.NameFromPeer(id.ID())
+	rt := mockrouting.NewServer().Client(id)
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+
+	value, err := path.NewPath("/ipfs/bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4")
+	require.NoError(t, err)
+
+	getSequence := func(t *testing.T) uint64 {
+		data, err := rt.GetValue(ctx, string(name.RoutingKey()))
+		require.NoError(t, err)
+		rec, err := ipns.UnmarshalRecord(data)
+		require.NoError(t, err)
+		seq, err := rec.Sequence()
+		require.NoError(t, err)
+		return seq
+	}
+
+	t.Run("Sequence increases even if value is unchanged", func(t *testing.T) {
+		p := NewSequencePublisher(rt, dstore)
+		require.NoError(t, p.Publish(ctx, id.PrivateKey(), value))
+		require.Equal(t, uint64(1), getSequence(t))
+		require.NoError(t, p.Publish(ctx, id.PrivateKey(), value))
+		require.Equal(t, uint64(2), getSequence(t))
+	})
+
+	t.Run("Sequence survives restarts", func(t *testing.T) {
+		p := NewSequencePublisher(rt, dstore)
+		require.NoError(t, p.Publish(ctx, id.PrivateKey(), value))
+		require.Equal(t, uint64(3), getSequence(t))
+
+		state, found, err := p.State(ctx, name)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, uint64(3), state.Sequence)
+		require.Equal(t, value.String(), state.Value)
+	})
+
+	t.Run("Sequence is higher than the locally stored record", func(t *testing.T) {
+		// Simulate a record written by another publisher with a higher sequence.
+		rec, err := ipns.NewRecord(id.PrivateKey(), value, 10, time.Now().Add(time.Hour), 0)
+		require.NoError(t, err)
+		data, err := ipns.MarshalRecord(rec)
+		require.NoError(t, err)
+		require.NoError(t, dstore.Put(ctx, IpnsDsKey(name), data))
+
+		p := NewSequencePublisher(rt, dstore)
+		require.NoError(t, p.Publish(ctx, id.PrivateKey(), value))
+		require.Equal(t, uint64(11), getSequence(t))
+	})
+
+	t.Run("Republish", func(t *testing.T) {
+		p := NewSequencePublisher(rt, dstore, WithRecordLifetime(2*time.Hour))
+		require.NoError(t, p.Republish(ctx, id.PrivateKey()))
+		require.Equal(t, uint64(12), getSequence(t))
+
+		state, _, err := p.State(ctx, name)
+		require.NoError(t, err)
+		require.Equal(t, value.String(), state.Value)
+		require.True(t, state.Validity.After(time.Now().Add(time.Hour)))
+	})
+
+	t.Run("Republish unknown key", func(t *testing.T) {
+		other := testutil.RandIdentityOrFatal(t)
+		p := NewSequencePublisher(rt, dstore)
+		require.ErrorIs(t, p.Republish(ctx, other.PrivateKey()), ErrNoPublishState)
+	})
+}
+
+func TestSequencePublisherJitter(t *testing.T) {
+	t.Parallel()
+
+	p := NewSequencePublisher(nil, ds.NewMapDatastore(), WithRepublishInterval(time.Hour), WithRepublishJitter(0.5))
+	for i := 0; i < 100; i++ {
+		d := p.nextRepublishDelay()
+		require.GreaterOrEqual(t, d, 30*time.Minute)
+		require.Less(t, d, 90*time.Minute)
+	}
+
+	p = NewSequencePublisher(nil, ds.NewMapDatastore(), WithRepublishInterval(time.Hour), WithRepublishJitter(0))
+	require.Equal(t, time.Hour, p.nextRepublishDelay())
+}
@@ -0,0 +1,125 @@
+package namesys
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ResolveSource identifies how a hop of a resolution was resolved.
+type ResolveSource string
+
+const (
+	// ResolveSourceCache is the source of hops resolved from the cache, or
+	// from the static mappings of IPFS_NS_MAP.
+	ResolveSourceCache ResolveSource = "cache"
+	// ResolveSourceIPNS is the source of hops resolved from IPNS Records.
+	ResolveSourceIPNS ResolveSource = "ipns"
+	// ResolveSourceDNSLink is the source of hops resolved from DNSLink records.
+	ResolveSourceDNSLink ResolveSource = "dnslink"
+)
+
+// ResolveStep describes one hop of a recursive resolution.
+type ResolveStep struct {
+	// Name is the path that was resolved in this hop.
+	Name path.Path
+	// Path is the path Name resolved to. It is nil if the hop failed.
+	Path    path.Path
+	Source  ResolveSource
+	TTL     time.Duration
+	LastMod time.Time
+	// Duration is the time it took to resolve this hop.
+	Duration time.Duration
+	Err      error
+}
+
+// TraceResolver is implemented by [Resolver]s that can report each hop of a
+// recursive resolution, such as the [NameSystem] returned by [NewNameSystem].
+type TraceResolver interface {
+	// ResolveWithTrace resolves like [Resolver.Resolve], and returns the hops
+	// that were resolved along the way, e.g. DNSLink, then IPNS. The steps are
+	// returned even if the resolution fails, with the failed hop last.
+	ResolveWithTrace(context.Context, path.Path, ...ResolveOption) (Result, []ResolveStep, error)
+}
+
+var _ TraceResolver = &namesys{}
+
+// ResolveWithTrace implements [TraceResolver].
+func (ns *namesys) ResolveWithTrace(ctx context.Context, p path.Path, options ...ResolveOption) (Result, []ResolveStep, error) {
+	ctx, span := startSpan(ctx, "namesys.ResolveWithTrace", trace.WithAttributes(attribute.Stringer("Path", p)))
+	defer span.End()
+
+	opts := ns.resolveOptions(options)
+
+	var (
+		result = Result{Path: p}
+		steps  []ResolveStep
+	)
+	for hop := uint(1); result.Path.Mutable(); hop++ {
+		step := ns.resolveStep(ctx, result.Path, opts)
+		steps = append(steps, step)
+		if step.Err != nil {
+			span.RecordError(step.Err)
+			return Result{}, steps, step.Err
+		}
+
+		result = Result{Path: step.Path, TTL: step.TTL, LastMod: step.LastMod}
+		if hop == opts.Depth && result.Path.Mutable() {
+			return result, steps, ErrResolveRecursion
+		}
+	}
+
+	span.SetAttributes(attribute.Int("Hops", len(steps)))
+	return result, steps, nil
+}
+
+// resolveStep resolves a single hop of p, keeping the best result.
+func (ns *namesys) resolveStep(ctx context.Context, p path.Path, options ResolveOptions) ResolveStep {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	step := ResolveStep{
+		Name:   p,
+		Source: ns.resolveSource(p),
+		Err:    ErrResolveFailed,
+	}
+
+	start := time.Now()
+	for res := range ns.resolveOnceAsync(ctx, p, options) {
+		if res.Err != nil {
+			// Keep the best result if a previous one succeeded.
+			if step.Path == nil {
+				step.Err = res.Err
+			}
+			continue
+		}
+		step.Path, step.TTL, step.LastMod, step.Err = res.Path, res.TTL, res.LastMod, nil
+	}
+	if step.Err == ErrResolveFailed && ctx.Err() != nil {
+		step.Err = ctx.Err()
+	}
+	step.Duration = time.Since(start)
+
+	return step
+}
+
+// resolveSource returns the source resolveOnceAsync uses for p, which must be
+// mutable.
+func (ns *namesys) resolveSource(p path.Path) ResolveSource {
+	name := p.Segments()[1]
+	if _, _, _, ok := ns.cacheGet(ipns.NamespacePrefix + name); ok {
+		return ResolveSourceCache
+	}
+	if _, err := ipns.NameFromString(name); err == nil {
+		return ResolveSourceIPNS
+	}
+	if _, ok := dns.IsDomainName(name); ok {
+		return ResolveSourceDNSLink
+	}
+	return ""
+}
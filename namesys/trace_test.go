@@ -0,0 +1,102 @@
+package namesys
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveWithTrace(t *testing.T) {
+	ns := &namesys{
+		ipnsResolver: mockResolverOne(),
+		dnsResolver:  mockResolverTwo(),
+	}
+
+	p, err := path.NewPath("/ipns/ipfs.io/a/b")
+	require.NoError(t, err)
+
+	res, steps, err := ns.ResolveWithTrace(context.Background(), p)
+	require.NoError(t, err)
+	require.Equal(t, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj/a/b", res.Path.String())
+	require.Len(t, steps, 3)
+
+	expected := []struct {
+		name, path string
+		source     ResolveSource
+	}{
+		{"/ipns/ipfs.io/a/b", "/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n/a/b", ResolveSourceDNSLink},
+		{"/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n/a/b", "/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy/a/b", ResolveSourceIPNS},
+		{"/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy/a/b", "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj/a/b", ResolveSourceIPNS},
+	}
+	for i, step := range steps {
+		require.NoError(t, step.Err)
+		require.Equal(t, expected[i].name, step.Name.String())
+		require.Equal(t, expected[i].path, step.Path.String())
+		require.Equal(t, expected[i].source, step.Source)
+	}
+
+	// Immutable paths need no hops.
+	p, err = path.NewPath("/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj")
+	require.NoError(t, err)
+	res, steps, err = ns.ResolveWithTrace(context.Background(), p)
+	require.NoError(t, err)
+	require.Equal(t, p.String(), res.Path.String())
+	require.Empty(t, steps)
+
+	// Failed hops are returned last.
+	p, err = path.NewPath("/ipns/example.com")
+	require.NoError(t, err)
+	_, steps, err = ns.ResolveWithTrace(context.Background(), p)
+	require.Error(t, err)
+	require.Len(t, steps, 1)
+	require.Equal(t, err, steps[0].Err)
+}
+
+func TestResolveWithTraceCache(t *testing.T) {
+	nsys := &namesys{
+		ipnsResolver: mockResolverOne(),
+		dnsResolver:  mockResolverTwo(),
+	}
+	require.NoError(t, WithCache(16)(nsys))
+
+	nsys.cacheSet("/ipns/ipfs.io", path.FromCid(cid.MustParse("bafkqabddmf2au")), time.Minute, time.Now())
+
+	p, err := path.NewPath("/ipns/ipfs.io")
+	require.NoError(t, err)
+	_, steps, err := nsys.ResolveWithTrace(context.Background(), p)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	require.Equal(t, ResolveSourceCache, steps[0].Source)
+	require.Equal(t, time.Minute, steps[0].TTL)
+}
+
+func TestMaxDepth(t *testing.T) {
+	ns := &namesys{
+		ipnsResolver: mockResolverOne(),
+		dnsResolver:  mockResolverTwo(),
+	}
+	require.NoError(t, WithMaxDepth(2)(ns))
+
+	p, err := path.NewPath("/ipns/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+	require.NoError(t, err)
+
+	for _, depth := range []uint{UnlimitedDepth, DefaultDepthLimit, 2} {
+		res, err := ns.Resolve(context.Background(), p, ResolveWithDepth(depth))
+		require.ErrorIs(t, err, ErrResolveRecursion)
+		require.Equal(t, "/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n", res.Path.String())
+
+		res, steps, err := ns.ResolveWithTrace(context.Background(), p, ResolveWithDepth(depth))
+		require.ErrorIs(t, err, ErrResolveRecursion)
+		require.Equal(t, "/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n", res.Path.String())
+		require.Len(t, steps, 2)
+	}
+
+	// Lower depths are kept.
+	_, steps, err := ns.ResolveWithTrace(context.Background(), p, ResolveWithDepth(1))
+	require.ErrorIs(t, err, ErrResolveRecursion)
+	require.Len(t, steps, 1)
+}
@@ -9,6 +9,8 @@ var (
 	ErrExpectedImmutable      = errors.New("path was expected to be immutable")
 	ErrInsufficientComponents = errors.New("path does not have enough components")
 	ErrUnknownNamespace       = errors.New("unknown namespace")
+	ErrInvalidSegment         = errors.New("invalid path segment")
+	ErrNoParent               = errors.New("path has no parent")
 )
 
 type ErrInvalidPath struct {
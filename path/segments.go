@@ -0,0 +1,141 @@
+package path
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateSegment returns an error wrapping [ErrInvalidSegment] if name cannot
+// be used as a single segment of a [Path]. Valid segments are non-empty UTF-8
+// strings other than "." and "..", without forward slashes or NUL bytes.
+func ValidateSegment(name string) error {
+	switch {
+	case name == "", name == ".", name == "..":
+		return fmt.Errorf("%w: %q", ErrInvalidSegment, name)
+	case strings.ContainsAny(name, "/\x00"):
+		return fmt.Errorf("%w: %q contains a forward slash or a NUL byte", ErrInvalidSegment, name)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("%w: %q is not valid UTF-8", ErrInvalidSegment, name)
+	}
+	return nil
+}
+
+// WithSegment returns a new [Path] with the given name appended as its last
+// segment. Unlike [Join], which splits and cleans its arguments, name must be a
+// single valid segment (see [ValidateSegment]), so that it can never escape
+// the root or add more than one segment. The trailing slash of p, if any, is
+// not preserved.
+func WithSegment(p Path, name string) (Path, error) {
+	if err := ValidateSegment(name); err != nil {
+		return nil, &ErrInvalidPath{err: err, path: p.String()}
+	}
+	return Join(p, name)
+}
+
+// Parent returns the [Path] without its last segment. It returns an error
+// wrapping [ErrNoParent] if p only has a namespace and a root. The trailing
+// slash of p, if any, is not preserved.
+func Parent(p Path) (Path, error) {
+	segments := p.Segments()
+	if len(segments) <= 2 {
+		return nil, &ErrInvalidPath{err: ErrNoParent, path: p.String()}
+	}
+	return NewPathFromSegments(segments[:len(segments)-1]...)
+}
+
+// EscapedString returns the path with each segment percent-encoded, so that it
+// can be used in the path of a URL. Use [NewPathFromEscaped] to parse it back.
+//
+// For example, a path with the segments ["ipfs", "bafy", "a b", "ü"] is
+// returned as "/ipfs/bafy/a%20b/%C3%BC".
+func EscapedString(p Path) string {
+	var sb strings.Builder
+	for _, s := range p.Segments() {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(s))
+	}
+	if strings.HasSuffix(p.String(), "/") {
+		sb.WriteByte('/')
+	}
+	return sb.String()
+}
+
+// NewPathFromEscaped returns a [Path] from a percent-encoded string, such as the
+// path of a URL or the output of [EscapedString]. Each segment is unescaped
+// and validated separately, so escaped forward slashes are rejected rather
+// than interpreted as separators.
+func NewPathFromEscaped(str string) (Path, error) {
+	if !strings.HasPrefix(str, "/") {
+		return nil, &ErrInvalidPath{err: ErrInsufficientComponents, path: str}
+	}
+
+	segments := StringToSegments(str)
+	for i, s := range segments {
+		name, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, &ErrInvalidPath{err: err, path: str}
+		}
+		if err := ValidateSegment(name); err != nil {
+			return nil, &ErrInvalidPath{err: err, path: str}
+		}
+		segments[i] = name
+	}
+
+	unescaped := SegmentsToString(segments...)
+	if strings.HasSuffix(str, "/") {
+		unescaped += "/"
+	}
+	return NewPath(unescaped)
+}
+
+// Builder builds a [Path] segment by segment, validating each segment with
+// [ValidateSegment]. The first error is returned by [Builder.Build]. Builders
+// are values: each method returns a new Builder, and the receiver can still be
+// used as a base for other paths.
+type Builder struct {
+	base          Path
+	segments      []string
+	trailingSlash bool
+	err           error
+}
+
+// NewBuilder returns a [Builder] for paths under base.
+func NewBuilder(base Path) Builder {
+	return Builder{base: base}
+}
+
+// Segment appends the given names, one segment each.
+func (b Builder) Segment(names ...string) Builder {
+	if b.err != nil {
+		return b
+	}
+	for _, name := range names {
+		if err := ValidateSegment(name); err != nil {
+			b.err = &ErrInvalidPath{err: err, path: b.base.String()}
+			return b
+		}
+	}
+	b.segments = append(b.segments[:len(b.segments):len(b.segments)], names...)
+	return b
+}
+
+// TrailingSlash sets whether the built path ends with a forward slash, which
+// is the convention for directories, e.g. in gateway URLs.
+func (b Builder) TrailingSlash(trailing bool) Builder {
+	b.trailingSlash = trailing
+	return b
+}
+
+// Build returns the [Path], or the first error encountered.
+func (b Builder) Build() (Path, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	str := SegmentsToString(append(b.base.Segments(), b.segments...)...)
+	if b.trailingSlash {
+		str += "/"
+	}
+	return NewPath(str)
+}
@@ -0,0 +1,120 @@
+package path
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRoot = "/ipfs/bafybeihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+
+func TestValidateSegment(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"a", "a b", "ü", "日本語", "a%2Fb", "..."} {
+		assert.NoError(t, ValidateSegment(name), name)
+	}
+	for _, name := range []string{"", ".", "..", "a/b", "/", "a\x00", "\xff"} {
+		assert.ErrorIs(t, ValidateSegment(name), ErrInvalidSegment, name)
+	}
+}
+
+func TestWithSegment(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewPath(testRoot + "/a/")
+	require.NoError(t, err)
+
+	sp, err := WithSegment(p, "ü b")
+	require.NoError(t, err)
+	assert.Equal(t, testRoot+"/a/ü b", sp.String())
+	assert.IsType(t, ImmutablePath{}, sp)
+
+	for _, name := range []string{"..", "b/../..", ""} {
+		_, err = WithSegment(p, name)
+		assert.ErrorIs(t, err, ErrInvalidSegment, name)
+		assert.ErrorIs(t, err, &ErrInvalidPath{}, name)
+	}
+}
+
+func TestParent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{testRoot + "/a/b", testRoot + "/a"},
+		{testRoot + "/a/b/", testRoot + "/a"},
+		{testRoot + "/a", testRoot},
+		{"/ipns/example.net/a", "/ipns/example.net"},
+	}
+	for _, testCase := range testCases {
+		p, err := NewPath(testCase.path)
+		require.NoError(t, err)
+		parent, err := Parent(p)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, parent.String())
+		assert.Equal(t, p.Mutable(), parent.Mutable())
+	}
+
+	for _, str := range []string{testRoot, testRoot + "/", "/ipns/example.net"} {
+		p, err := NewPath(str)
+		require.NoError(t, err)
+		_, err = Parent(p)
+		assert.ErrorIs(t, err, ErrNoParent, str)
+	}
+}
+
+func TestEscapedString(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		segments []string
+		trailing bool
+		escaped  string
+	}{
+		{[]string{"a", "b"}, false, testRoot + "/a/b"},
+		{[]string{"a b", "ü"}, false, testRoot + "/a%20b/%C3%BC"},
+		{[]string{"50%", "?#"}, true, testRoot + "/50%25/%3F%23/"},
+		{nil, true, testRoot + "/"},
+	}
+
+	base, err := NewPath(testRoot)
+	require.NoError(t, err)
+	for _, testCase := range testCases {
+		p, err := NewBuilder(base).Segment(testCase.segments...).TrailingSlash(testCase.trailing).Build()
+		require.NoError(t, err)
+		assert.Equal(t, testCase.escaped, EscapedString(p))
+
+		parsed, err := NewPathFromEscaped(testCase.escaped)
+		require.NoError(t, err)
+		assert.Equal(t, p.String(), parsed.String())
+	}
+
+	for _, str := range []string{"", "ipfs/bafy", testRoot + "/a%2Fb", testRoot + "/%2E%2E", testRoot + "/%zz"} {
+		_, err := NewPathFromEscaped(str)
+		assert.ErrorIs(t, err, &ErrInvalidPath{}, str)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	base, err := NewPath("/ipns/example.net")
+	require.NoError(t, err)
+
+	b := NewBuilder(base).Segment("a")
+	p1, err := b.Segment("b").Build()
+	require.NoError(t, err)
+	p2, err := b.Segment("c").TrailingSlash(true).Build()
+	require.NoError(t, err)
+
+	// Builders derived from the same base do not share segments.
+	assert.Equal(t, "/ipns/example.net/a/b", p1.String())
+	assert.Equal(t, "/ipns/example.net/a/c/", p2.String())
+
+	_, err = b.Segment("..").Segment("d").Build()
+	assert.ErrorIs(t, err, ErrInvalidSegment)
+}
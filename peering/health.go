@@ -0,0 +1,155 @@
+package peering
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+// DefaultFailureThreshold is the default number of consecutive failed probes
+// or reconnect attempts before a peer is considered unhealthy.
+const DefaultFailureThreshold = 3
+
+// PeerState is the connection state of a peer of the [PeeringService].
+type PeerState uint
+
+const (
+	// PeerStateDisconnected is the state of peers that were never
+	// connected, e.g. before the service is started.
+	PeerStateDisconnected PeerState = iota
+	// PeerStateConnected is the state of connected peers.
+	PeerStateConnected
+	// PeerStateUnhealthy is the state of connected peers that failed the
+	// health check. Their connections are closed, and they are reconnected.
+	PeerStateUnhealthy
+	// PeerStateReconnecting is the state of disconnected peers that are
+	// reconnected at the probe interval.
+	PeerStateReconnecting
+	// PeerStateBackingOff is the state of disconnected peers that failed
+	// enough reconnect attempts for further attempts to back off
+	// exponentially.
+	PeerStateBackingOff
+)
+
+func (s PeerState) String() string {
+	switch s {
+	case PeerStateDisconnected:
+		return "disconnected"
+	case PeerStateConnected:
+		return "connected"
+	case PeerStateUnhealthy:
+		return "unhealthy"
+	case PeerStateReconnecting:
+		return "reconnecting"
+	case PeerStateBackingOff:
+		return "backing off"
+	default:
+		return "unknown peer state: " + strconv.FormatUint(uint64(s), 10)
+	}
+}
+
+// PeerStateChange describes a transition of the state of a peer.
+type PeerStateChange struct {
+	Peer  peer.ID
+	State PeerState
+	// Failures is the number of consecutive failed probes or reconnect
+	// attempts.
+	Failures int
+	// Err is the error of the last failed probe or reconnect attempt, if
+	// any.
+	Err error
+}
+
+// Prober checks the health of a connected peer.
+type Prober func(ctx context.Context, p peer.ID) error
+
+// PingProber returns a [Prober] that pings peers with the libp2p ping
+// protocol.
+func PingProber(h host.Host) Prober {
+	return func(ctx context.Context, p peer.ID) error {
+		res := <-ping.Ping(ctx, h, p)
+		return res.Error
+	}
+}
+
+type config struct {
+	probeInterval    time.Duration
+	prober           Prober
+	failureThreshold int
+	maxBackoff       time.Duration
+	onStateChange    func(PeerStateChange)
+}
+
+// Option configures a [PeeringService].
+type Option func(*config)
+
+// WithProbeInterval enables health checks of connected peers, every interval.
+// Peers failing [WithFailureThreshold] consecutive probes are disconnected and
+// reconnected. Disconnected peers are reconnected every interval until the
+// failure threshold is reached, then attempts back off exponentially up to
+// [WithMaxBackoff].
+//
+// By default, health checks are disabled and reconnect attempts back off
+// exponentially from the start.
+func WithProbeInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.probeInterval = interval
+	}
+}
+
+// WithProber sets the health check used when [WithProbeInterval] is set.
+// Defaults to [PingProber].
+func WithProber(prober Prober) Option {
+	return func(cfg *config) {
+		cfg.prober = prober
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failed probes or
+// reconnect attempts before a peer is considered unhealthy. Defaults to
+// [DefaultFailureThreshold].
+func WithFailureThreshold(n int) Option {
+	return func(cfg *config) {
+		cfg.failureThreshold = n
+	}
+}
+
+// WithMaxBackoff sets the maximum time between reconnect attempts. Defaults
+// to 10 minutes.
+func WithMaxBackoff(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxBackoff = d
+	}
+}
+
+// WithPeerStateHandler sets a function called on every transition of the
+// state of a peer. It must not block.
+func WithPeerStateHandler(handler func(PeerStateChange)) Option {
+	return func(cfg *config) {
+		cfg.onStateChange = handler
+	}
+}
+
+// probeLoop probes the connected peers every probe interval, until ctx is
+// done.
+func (ps *PeeringService) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(ps.cfg.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		ps.mu.RLock()
+		for _, handler := range ps.peers {
+			go handler.probe()
+		}
+		ps.mu.RUnlock()
+	}
+}
@@ -0,0 +1,101 @@
+package peering
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextReconnectDelay(t *testing.T) {
+	cfg := &config{
+		probeInterval:    time.Second,
+		failureThreshold: 2,
+		maxBackoff:       time.Minute,
+	}
+	ph := &peerHandler{cfg: cfg}
+	ph.nextDelay = ph.initialDelay()
+
+	// Reconnect at the probe interval until the threshold is reached.
+	require.Equal(t, time.Second, ph.nextReconnectDelay())
+	ph.failures = 1
+	require.Equal(t, time.Second, ph.nextReconnectDelay())
+
+	// Then back off exponentially, up to the max backoff.
+	ph.failures = 2
+	prev := time.Second
+	for i := 0; i < 20; i++ {
+		d := ph.nextReconnectDelay()
+		require.LessOrEqual(t, d, time.Minute)
+		if prev < time.Minute*9/10 {
+			require.Greater(t, d, prev)
+		}
+		prev = d
+	}
+	require.GreaterOrEqual(t, prev, time.Minute*9/10)
+
+	// Without health checks, reconnect attempts back off from the start.
+	ph = &peerHandler{cfg: &config{failureThreshold: 2, maxBackoff: maxBackoff}}
+	ph.nextDelay = ph.initialDelay()
+	require.Greater(t, ph.nextReconnectDelay(), initialDelay)
+}
+
+func TestSetState(t *testing.T) {
+	var changes []PeerStateChange
+	cfg := &config{onStateChange: func(c PeerStateChange) { changes = append(changes, c) }}
+	ph := &peerHandler{peer: peer.ID("p"), cfg: cfg}
+
+	ph.setState(PeerStateConnected, 0, nil)()
+	// No transition, no notification.
+	ph.setState(PeerStateConnected, 0, nil)()
+	err := errors.New("boom")
+	ph.setState(PeerStateUnhealthy, 3, err)()
+
+	require.Equal(t, []PeerStateChange{
+		{Peer: "p", State: PeerStateConnected},
+		{Peer: "p", State: PeerStateUnhealthy, Failures: 3, Err: err},
+	}, changes)
+	require.Equal(t, "unhealthy", PeerStateUnhealthy.String())
+}
+
+func TestHealthCheck(t *testing.T) {
+	h1 := newNode(t)
+	h2 := newNode(t)
+
+	var (
+		mu     sync.Mutex
+		states []PeerState
+	)
+	seen := func(s PeerState) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, state := range states {
+			if state == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	ps := NewPeeringService(h1,
+		WithProbeInterval(100*time.Millisecond),
+		WithFailureThreshold(2),
+		WithProber(func(context.Context, peer.ID) error { return errors.New("unhealthy") }),
+		WithPeerStateHandler(func(c PeerStateChange) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, c.State)
+		}),
+	)
+	ps.AddPeer(peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()})
+	require.NoError(t, ps.Start())
+	defer ps.Stop()
+
+	require.Eventually(t, func() bool { return seen(PeerStateConnected) }, 10*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return seen(PeerStateUnhealthy) }, 10*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return seen(PeerStateReconnecting) }, 10*time.Second, 10*time.Millisecond)
+}
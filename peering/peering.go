@@ -16,7 +16,7 @@ import (
 )
 
 const (
-	// maxBackoff is the maximum time between reconnect attempts.
+	// maxBackoff is the default maximum time between reconnect attempts.
 	maxBackoff = 10 * time.Minute
 	// The backoff will be cut off when we get within 10% of the actual max.
 	// If we go over the max, we'll adjust the delay down to a random value
@@ -55,6 +55,7 @@ const (
 type peerHandler struct {
 	peer   peer.ID
 	host   host.Host
+	cfg    *config
 	ctx    context.Context
 	cancel context.CancelFunc
 
@@ -63,6 +64,10 @@ type peerHandler struct {
 	reconnectTimer *time.Timer
 
 	nextDelay time.Duration
+
+	state         PeerState
+	failures      int
+	probeFailures int
 }
 
 // setAddrs sets the addresses for this peer.
@@ -96,20 +101,49 @@ func (ph *peerHandler) stop() {
 }
 
 func (ph *peerHandler) nextBackoff() time.Duration {
-	if ph.nextDelay < maxBackoff {
+	max := maxBackoff
+	if ph.cfg != nil && ph.cfg.maxBackoff > 0 {
+		max = ph.cfg.maxBackoff
+	}
+	if ph.nextDelay < max {
 		ph.nextDelay += ph.nextDelay/2 + time.Duration(rand.Int63n(int64(ph.nextDelay)))
 	}
 
 	// If we've gone over the max backoff, reduce it under the max.
-	if ph.nextDelay > maxBackoff {
-		ph.nextDelay = maxBackoff
+	if ph.nextDelay > max {
+		ph.nextDelay = max
 		// randomize the backoff a bit (10%).
-		ph.nextDelay -= time.Duration(rand.Int63n(int64(maxBackoff) * maxBackoffJitter / 100))
+		ph.nextDelay -= time.Duration(rand.Int63n(int64(max) * maxBackoffJitter / 100))
 	}
 
 	return ph.nextDelay
 }
 
+// nextReconnectDelay returns the delay before the next reconnect attempt.
+// With health checks enabled, peers are reconnected at the probe interval
+// until the failure threshold is reached.
+func (ph *peerHandler) nextReconnectDelay() time.Duration {
+	if ph.cfg.probeInterval > 0 && ph.failures < ph.cfg.failureThreshold {
+		return ph.cfg.probeInterval
+	}
+	return ph.nextBackoff()
+}
+
+// setState records a state transition. It must be called with mu held, and
+// the returned function must be called once mu is released.
+func (ph *peerHandler) setState(state PeerState, failures int, err error) func() {
+	if ph.state == state {
+		return func() {}
+	}
+	ph.state = state
+	change := PeerStateChange{Peer: ph.peer, State: state, Failures: failures, Err: err}
+	return func() {
+		if ph.cfg.onStateChange != nil {
+			ph.cfg.onStateChange(change)
+		}
+	}
+}
+
 func (ph *peerHandler) reconnect() {
 	// Try connecting
 	addrs := ph.getAddrs()
@@ -119,15 +153,22 @@ func (ph *peerHandler) reconnect() {
 	if err != nil {
 		logger.Debugw("failed to reconnect", "peer", ph.peer, "error", err)
 		// Ok, we failed. Extend the timeout.
+		notify := func() {}
 		ph.mu.Lock()
 		if ph.reconnectTimer != nil {
 			// Only counts if the reconnectTimer still exists. If not, a
 			// connection _was_ somehow established.
-			ph.reconnectTimer.Reset(ph.nextBackoff())
+			ph.failures++
+			if ph.failures >= ph.cfg.failureThreshold && ph.state != PeerStateBackingOff {
+				logger.Infow("peer unreachable, backing off", "peer", ph.peer, "failures", ph.failures, "error", err)
+				notify = ph.setState(PeerStateBackingOff, ph.failures, err)
+			}
+			ph.reconnectTimer.Reset(ph.nextReconnectDelay())
 		}
 		// Otherwise, someone else has stopped us so we can assume that
 		// we're either connected or someone else will start us.
 		ph.mu.Unlock()
+		notify()
 	}
 
 	// Always call this. We could have connected since we processed the
@@ -136,26 +177,83 @@ func (ph *peerHandler) reconnect() {
 }
 
 func (ph *peerHandler) stopIfConnected() {
+	notify := func() {}
+	defer func() { notify() }()
 	ph.mu.Lock()
 	defer ph.mu.Unlock()
 
-	if ph.reconnectTimer != nil && ph.host.Network().Connectedness(ph.peer) == network.Connected {
+	if ph.host.Network().Connectedness(ph.peer) != network.Connected {
+		return
+	}
+	if ph.reconnectTimer != nil {
 		logger.Debugw("successfully reconnected", "peer", ph.peer)
 		ph.reconnectTimer.Stop()
 		ph.reconnectTimer = nil
-		ph.nextDelay = initialDelay
+		ph.nextDelay = ph.initialDelay()
+		ph.failures = 0
+	}
+	if ph.ctx.Err() == nil {
+		ph.probeFailures = 0
+		notify = ph.setState(PeerStateConnected, 0, nil)
 	}
 }
 
 // startIfDisconnected is the inverse of stopIfConnected.
 func (ph *peerHandler) startIfDisconnected() {
+	notify := func() {}
+	defer func() { notify() }()
 	ph.mu.Lock()
 	defer ph.mu.Unlock()
 
 	if ph.reconnectTimer == nil && ph.host.Network().Connectedness(ph.peer) != network.Connected {
 		logger.Debugw("disconnected from peer", "peer", ph.peer)
 		// Always start with a short timeout so we can stagger things a bit.
-		ph.reconnectTimer = time.AfterFunc(ph.nextBackoff(), ph.reconnect)
+		ph.reconnectTimer = time.AfterFunc(ph.nextReconnectDelay(), ph.reconnect)
+		if ph.state == PeerStateConnected || ph.state == PeerStateUnhealthy {
+			notify = ph.setState(PeerStateReconnecting, 0, nil)
+		}
+	}
+}
+
+// initialDelay returns the delay the exponential backoff starts from.
+func (ph *peerHandler) initialDelay() time.Duration {
+	if ph.cfg.probeInterval > 0 {
+		return ph.cfg.probeInterval
+	}
+	return initialDelay
+}
+
+// probe checks the health of the peer if it is connected. After enough
+// consecutive failures, its connections are closed so that it is reconnected.
+func (ph *peerHandler) probe() {
+	if ph.ctx.Err() != nil || ph.host.Network().Connectedness(ph.peer) != network.Connected {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ph.ctx, ph.cfg.probeInterval)
+	defer cancel()
+	err := ph.cfg.prober(ctx, ph.peer)
+
+	ph.mu.Lock()
+	if err == nil {
+		ph.probeFailures = 0
+		ph.mu.Unlock()
+		return
+	}
+	ph.probeFailures++
+	failures := ph.probeFailures
+	if failures < ph.cfg.failureThreshold || ph.state != PeerStateConnected {
+		ph.mu.Unlock()
+		logger.Debugw("peer health check failed", "peer", ph.peer, "failures", failures, "error", err)
+		return
+	}
+	notify := ph.setState(PeerStateUnhealthy, failures, err)
+	ph.mu.Unlock()
+	notify()
+
+	logger.Infow("peer unhealthy, reconnecting", "peer", ph.peer, "failures", failures, "error", err)
+	if err := ph.host.Network().ClosePeer(ph.peer); err != nil {
+		logger.Debugw("failed to close connections", "peer", ph.peer, "error", err)
 	}
 }
 
@@ -163,16 +261,28 @@ func (ph *peerHandler) startIfDisconnected() {
 // disconnect with a back-off.
 type PeeringService struct {
 	host host.Host
+	cfg  *config
 
-	mu    sync.RWMutex
-	peers map[peer.ID]*peerHandler
-	state State
+	mu     sync.RWMutex
+	peers  map[peer.ID]*peerHandler
+	state  State
+	cancel context.CancelFunc
 }
 
 // NewPeeringService constructs a new peering service. Peers can be added and
 // removed immediately, but connections won't be formed until `Start` is called.
-func NewPeeringService(host host.Host) *PeeringService {
-	return &PeeringService{host: host, peers: make(map[peer.ID]*peerHandler)}
+func NewPeeringService(host host.Host, opts ...Option) *PeeringService {
+	cfg := &config{
+		failureThreshold: DefaultFailureThreshold,
+		maxBackoff:       maxBackoff,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.probeInterval > 0 && cfg.prober == nil {
+		cfg.prober = PingProber(host)
+	}
+	return &PeeringService{host: host, cfg: cfg, peers: make(map[peer.ID]*peerHandler)}
 }
 
 // Start starts the peering service, connecting and maintaining connections to
@@ -195,6 +305,11 @@ func (ps *PeeringService) Start() error {
 	for _, handler := range ps.peers {
 		go handler.startIfDisconnected()
 	}
+	if ps.cfg.probeInterval > 0 {
+		var ctx context.Context
+		ctx, ps.cancel = context.WithCancel(context.Background())
+		go ps.probeLoop(ctx)
+	}
 	return nil
 }
 
@@ -214,6 +329,9 @@ func (ps *PeeringService) Stop() {
 	switch ps.state {
 	case StateInit, StateRunning:
 		logger.Infow("stopping")
+		if ps.cancel != nil {
+			ps.cancel()
+		}
 		for _, handler := range ps.peers {
 			handler.stop()
 		}
@@ -239,11 +357,12 @@ func (ps *PeeringService) AddPeer(info peer.AddrInfo) {
 		ps.host.ConnManager().Protect(info.ID, connmgrTag)
 
 		handler = &peerHandler{
-			host:      ps.host,
-			peer:      info.ID,
-			addrs:     info.Addrs,
-			nextDelay: initialDelay,
+			host:  ps.host,
+			cfg:   ps.cfg,
+			peer:  info.ID,
+			addrs: info.Addrs,
 		}
+		handler.nextDelay = handler.initialDelay()
 		handler.ctx, handler.cancel = context.WithCancel(context.Background())
 		ps.peers[info.ID] = handler
 		switch ps.state {
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"path"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
@@ -19,7 +20,6 @@ import (
 	"github.com/polydawn/refmt/obj/atlas"
 
 	"github.com/ipfs/boxo/ipld/merkledag"
-	"github.com/ipfs/boxo/ipld/merkledag/dagutils"
 	ipfspinner "github.com/ipfs/boxo/pinning/pinner"
 	"github.com/ipfs/boxo/pinning/pinner/dsindex"
 )
@@ -29,18 +29,29 @@ const (
 	pinKeyPath   = "/pins/pin"
 	indexKeyPath = "/pins/index"
 	dirtyKeyPath = "/pins/state/dirty"
+
+	versionKeyPath = "/pins/state/version"
 )
 
+// schemaVersion is the version of the layout of the pins in the datastore.
+// Version 2 added the index of the indirect pins, mapping the descendants of
+// the recursive pins to their roots and back.
+const schemaVersion = 2
+
 var (
 	log logging.StandardLogger = logging.Logger("pin")
 
 	linkDirect, linkRecursive string
 
-	pinCidDIndexPath string
-	pinCidRIndexPath string
-	pinNameIndexPath string
+	pinCidDIndexPath  string
+	pinCidRIndexPath  string
+	pinCidIIndexPath  string
+	pinRootIIndexPath string
+	pinCidPIndexPath  string
+	pinNameIndexPath  string
 
-	dirtyKey = ds.NewKey(dirtyKeyPath)
+	dirtyKey   = ds.NewKey(dirtyKeyPath)
+	versionKey = ds.NewKey(versionKeyPath)
 
 	pinAtl atlas.Atlas
 )
@@ -60,6 +71,9 @@ func init() {
 
 	pinCidRIndexPath = path.Join(indexKeyPath, "cidRindex")
 	pinCidDIndexPath = path.Join(indexKeyPath, "cidDindex")
+	pinCidIIndexPath = path.Join(indexKeyPath, "cidIindex")
+	pinRootIIndexPath = path.Join(indexKeyPath, "rootIindex")
+	pinCidPIndexPath = path.Join(indexKeyPath, "cidPindex")
 	pinNameIndexPath = path.Join(indexKeyPath, "nameIndex")
 
 	pinAtl = atlas.MustBuild(
@@ -95,6 +109,28 @@ type pinner struct {
 	cidRIndex dsindex.Indexer
 	nameIndex dsindex.Indexer
 
+	// cidIIndex maps the descendants of the recursive pins to their roots,
+	// so that indirect pins are found without walking the pinned DAGs, and
+	// rootIIndex maps the roots to their indexed descendants, so that they
+	// are removed from the index without walking the DAGs again.
+	cidIIndex  dsindex.Indexer
+	rootIIndex dsindex.Indexer
+	// cidPIndex holds the recursive pins whose descendants may not all be
+	// indexed, because some of their blocks were missing or their pin or
+	// unpin was interrupted. Their DAGs are walked to find indirect pins.
+	cidPIndex dsindex.Indexer
+
+	// unindexed holds the recursive pins whose descendants are not indexed
+	// yet while the index is built after an upgrade, and is nil otherwise.
+	// Their DAGs are walked to find indirect pins.
+	unindexed *cid.Set
+	// indexed is closed when the indexing started in the background by New
+	// is done.
+	indexed chan struct{}
+
+	// walkOptions tune the walks of the pinned DAGs, see WithPrefetch.
+	walkOptions []merkledag.WalkOption
+
 	clean int64
 	dirty int64
 }
@@ -122,6 +158,18 @@ func newPin(c cid.Cid, mode ipfspinner.Mode, name string) *pin {
 	}
 }
 
+// Option configures a pinner created with [New].
+type Option func(*pinner)
+
+// WithPrefetch sets the strategy with which the pinner fetches the DAGs it
+// pins recursively, and walks them to index their descendants, see
+// [merkledag.Prefetch].
+func WithPrefetch(strategy merkledag.PrefetchStrategy) Option {
+	return func(p *pinner) {
+		p.walkOptions = append(p.walkOptions, merkledag.Prefetch(strategy))
+	}
+}
+
 type syncDAGService interface {
 	ipld.DAGService
 	Sync() error
@@ -133,24 +181,40 @@ type syncDAGService interface {
 // By default, changes are automatically flushed to the datastore.  This can be
 // disabled by calling SetAutosync(false), which will require that Flush be
 // called explicitly.
-func New(ctx context.Context, dstore ds.Datastore, dserv ipld.DAGService) (*pinner, error) {
+//
+// Pins stored with the first version of the datastore layout are upgraded by
+// indexing the descendants of the recursive pins, which walks their DAGs once.
+// The index is built in the background with ctx, as are the recursive pins
+// whose descendants were partially indexed, and the DAGs that are not indexed
+// yet are walked to find indirect pins until then. If ctx is canceled first,
+// the indexing continues the next time the pinner is loaded.
+func New(ctx context.Context, dstore ds.Datastore, dserv ipld.DAGService, opts ...Option) (*pinner, error) {
 	p := &pinner{
-		autoSync:  true,
-		cidDIndex: dsindex.New(dstore, ds.NewKey(pinCidDIndexPath)),
-		cidRIndex: dsindex.New(dstore, ds.NewKey(pinCidRIndexPath)),
-		nameIndex: dsindex.New(dstore, ds.NewKey(pinNameIndexPath)),
-		dserv:     dserv,
-		dstore:    dstore,
+		autoSync:   true,
+		cidDIndex:  dsindex.New(dstore, ds.NewKey(pinCidDIndexPath)),
+		cidRIndex:  dsindex.New(dstore, ds.NewKey(pinCidRIndexPath)),
+		cidIIndex:  dsindex.New(dstore, ds.NewKey(pinCidIIndexPath)),
+		rootIIndex: dsindex.New(dstore, ds.NewKey(pinRootIIndexPath)),
+		cidPIndex:  dsindex.New(dstore, ds.NewKey(pinCidPIndexPath)),
+		nameIndex:  dsindex.New(dstore, ds.NewKey(pinNameIndexPath)),
+		dserv:      dserv,
+		dstore:     dstore,
+		indexed:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	version, err := p.loadVersion(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	data, err := dstore.Get(ctx, dirtyKey)
-	if err != nil {
-		if err == ds.ErrNotFound {
-			return p, nil
-		}
+	if err != nil && err != ds.ErrNotFound {
 		return nil, fmt.Errorf("cannot load dirty flag: %v", err)
 	}
-	if data[0] == 1 {
+	if err == nil && data[0] == 1 {
 		p.dirty = 1
 
 		err = p.rebuildIndexes(ctx)
@@ -159,9 +223,106 @@ func New(ctx context.Context, dstore ds.Datastore, dserv ipld.DAGService) (*pinn
 		}
 	}
 
+	upgrade := version < schemaVersion
+	if upgrade {
+		log.Infof("upgrading pins from version %d to %d", version, schemaVersion)
+		p.unindexed = cid.NewSet()
+		err = p.cidRIndex.ForEach(ctx, "", func(key, value string) bool {
+			c, err := cid.Cast([]byte(key))
+			if err != nil {
+				log.Errorf("invalid recursive pin index for key %q: %s", key, err)
+				return true
+			}
+			p.unindexed.Add(c)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot upgrade pins: %v", err)
+		}
+	}
+
+	go p.indexInBackground(ctx, upgrade)
+
 	return p, nil
 }
 
+// indexInBackground indexes the descendants of the recursive pins left
+// unindexed by an upgrade, saving the new version once they are all indexed,
+// and then the partially indexed ones.
+func (p *pinner) indexInBackground(ctx context.Context, upgrade bool) {
+	defer close(p.indexed)
+
+	if upgrade {
+		if err := p.indexUnindexedPins(ctx); err != nil {
+			if ctx.Err() != nil {
+				log.Infof("pin upgrade interrupted, to be continued when the pins are loaded again")
+			} else {
+				log.Errorf("cannot upgrade pins: %s", err)
+			}
+			return
+		}
+	}
+	if err := p.IndexPartialPins(ctx); err != nil && ctx.Err() == nil {
+		log.Errorf("cannot index partially indexed pins: %s", err)
+	}
+}
+
+// indexUnindexedPins indexes the descendants of the recursive pins left
+// unindexed by an upgrade, and saves the new version.
+func (p *pinner) indexUnindexedPins(ctx context.Context) error {
+	p.lock.RLock()
+	roots := p.unindexed.Keys()
+	p.lock.RUnlock()
+
+	for _, root := range roots {
+		ip, err := p.walkIndirectPins(ctx, root, false)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// The pin is kept partially indexed, so that its DAG
+			// is still walked to find its indirect pins.
+			log.Errorf("cannot index the descendants of recursive pin %s: %s", root, err)
+			ip = &indirectPins{root: root, partial: true}
+		}
+		if err = p.indexWalkedPin(ctx, ip); err != nil {
+			return err
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.unindexed = nil
+	if err := p.dstore.Put(ctx, versionKey, []byte{schemaVersion}); err != nil {
+		return fmt.Errorf("cannot save pin version: %v", err)
+	}
+	if err := p.dstore.Sync(ctx, versionKey); err != nil {
+		return fmt.Errorf("cannot sync pin version: %v", err)
+	}
+	log.Infof("indexed the descendants of %d recursive pins", len(roots))
+	return nil
+}
+
+// loadVersion returns the version of the layout of the pins in the
+// datastore. Datastores without version use the first layout.
+func (p *pinner) loadVersion(ctx context.Context) (int, error) {
+	data, err := p.dstore.Get(ctx, versionKey)
+	if err != nil {
+		if err == ds.ErrNotFound {
+			return 1, nil
+		}
+		return 0, fmt.Errorf("cannot load pin version: %v", err)
+	}
+	if len(data) != 1 {
+		return 0, fmt.Errorf("invalid pin version: %x", data)
+	}
+	if data[0] > schemaVersion {
+		return 0, fmt.Errorf("pins use version %d, which is newer than the supported version %d", data[0], schemaVersion)
+	}
+	return int(data[0]), nil
+}
+
 // SetAutosync allows auto-syncing to be enabled or disabled during runtime.
 // This may be used to turn off autosync before doing many repeated pinning
 // operations, and then turn it on after.  Returns the previous value.
@@ -190,36 +351,14 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool, name str
 func (p *pinner) doPinRecursive(ctx context.Context, c cid.Cid, fetch bool, name string) error {
 	cidKey := c.KeyString()
 
-	p.lock.Lock()
-	defer p.lock.Unlock()
-
-	found, err := p.cidRIndex.HasAny(ctx, cidKey)
+	// The DAG is fetched and walked before taking the lock.
+	ip, err := p.walkIndirectPins(ctx, c, fetch)
 	if err != nil {
 		return err
 	}
-	// Do not return immediately! Just remove the recursive pins for the current CID.
-	// This allows the process to continue and the pin to be re-added with a new name.
-	//
-	// TODO: remove this to support multiple pins per CID
-	if found {
-		_, err = p.removePinsForCid(ctx, c, ipfspinner.Recursive)
-		if err != nil {
-			return err
-		}
-	}
 
-	dirtyBefore := p.dirty
-
-	if fetch {
-		// temporary unlock to fetch the entire graph
-		p.lock.Unlock()
-		// Fetch graph starting at node identified by cid
-		err = merkledag.FetchGraph(ctx, c, p.dserv)
-		p.lock.Lock()
-		if err != nil {
-			return err
-		}
-	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
 	// If autosyncing, sync dag service before making any change to pins
 	err = p.flushDagService(ctx, false)
@@ -227,15 +366,19 @@ func (p *pinner) doPinRecursive(ctx context.Context, c cid.Cid, fetch bool, name
 		return err
 	}
 
-	// Only look again if something has changed.
-	if p.dirty != dirtyBefore {
-		found, err := p.cidRIndex.HasAny(ctx, cidKey)
+	found, err := p.cidRIndex.HasAny(ctx, cidKey)
+	if err != nil {
+		return err
+	}
+	// Remove the recursive pins for the current CID, so that it is pinned
+	// again with the new name.
+	//
+	// TODO: remove this to support multiple pins per CID
+	if found {
+		_, err = p.removePinsForCid(ctx, c, ipfspinner.Recursive)
 		if err != nil {
 			return err
 		}
-		if found {
-			return nil
-		}
 	}
 
 	// TODO: remove this to support multiple pins per CID
@@ -250,7 +393,7 @@ func (p *pinner) doPinRecursive(ctx context.Context, c cid.Cid, fetch bool, name
 		}
 	}
 
-	_, err = p.addPin(ctx, c, ipfspinner.Recursive, name)
+	_, err = p.addPin(ctx, c, ipfspinner.Recursive, name, ip)
 	if err != nil {
 		return err
 	}
@@ -287,7 +430,7 @@ func (p *pinner) doPinDirect(ctx context.Context, c cid.Cid, name string) error
 		}
 	}
 
-	_, err = p.addPin(ctx, c, ipfspinner.Direct, name)
+	_, err = p.addPin(ctx, c, ipfspinner.Direct, name, nil)
 	if err != nil {
 		return err
 	}
@@ -295,7 +438,9 @@ func (p *pinner) doPinDirect(ctx context.Context, c cid.Cid, name string) error
 	return p.flushPins(ctx, false)
 }
 
-func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, name string) (string, error) {
+// addPin stores a pin of c. The descendants of a recursive pin are indexed
+// from ip, walked before taking the lock, or walked now if ip is nil.
+func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, name string, ip *indirectPins) (string, error) {
 	// Create new pin and store in datastore
 	pp := newPin(c, mode, name)
 
@@ -307,6 +452,15 @@ func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, na
 
 	p.setDirty(ctx)
 
+	// A recursive pin is partially indexed until all its descendants are,
+	// so that the indirect pins of an interrupted pin, which rebuildIndexes
+	// completes, are found by walking its DAG.
+	if mode == ipfspinner.Recursive {
+		if err = p.cidPIndex.Add(ctx, c.KeyString(), c.KeyString()); err != nil {
+			return "", fmt.Errorf("could not add partial pin index: %v", err)
+		}
+	}
+
 	// Store the pin
 	err = p.dstore.Put(ctx, pp.dsKey(), pinData)
 	if err != nil {
@@ -316,7 +470,21 @@ func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, na
 	// Store CID index
 	switch mode {
 	case ipfspinner.Recursive:
+		if ip == nil {
+			if ip, err = p.walkIndirectPins(ctx, c, false); err != nil {
+				return "", err
+			}
+		}
+		if err = p.writeIndirectPins(ctx, ip); err != nil {
+			return "", fmt.Errorf("could not add indirect pin index: %w", err)
+		}
 		err = p.cidRIndex.Add(ctx, c.KeyString(), pp.Id)
+		if err == nil && !ip.partial {
+			_, err = p.cidPIndex.DeleteKey(ctx, c.KeyString())
+		}
+		if p.unindexed != nil {
+			p.unindexed.Remove(c)
+		}
 	case ipfspinner.Direct:
 		err = p.cidDIndex.Add(ctx, c.KeyString(), pp.Id)
 	default:
@@ -348,13 +516,31 @@ func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, na
 	return pp.Id, nil
 }
 
+// removePin removes the pin pp.
 func (p *pinner) removePin(ctx context.Context, pp *pin) error {
 	p.setDirty(ctx)
 	var err error
 
 	// Remove cid index from datastore
+	var unindex bool
 	if pp.Mode == ipfspinner.Recursive {
 		err = p.cidRIndex.Delete(ctx, pp.Cid.KeyString(), pp.Id)
+		if err != nil {
+			return err
+		}
+		// Keep the descendants indexed if the CID is still pinned
+		// recursively by another pin. Otherwise, it is partially indexed
+		// until they are removed, as in addPin, since rebuildIndexes undoes
+		// an interrupted unpin.
+		var pinned bool
+		pinned, err = p.cidRIndex.HasAny(ctx, pp.Cid.KeyString())
+		unindex = err == nil && !pinned
+		if unindex {
+			err = p.cidPIndex.Add(ctx, pp.Cid.KeyString(), pp.Cid.KeyString())
+		}
+		if err == nil && unindex {
+			err = p.removeIndirectPins(ctx, pp.Cid)
+		}
 	} else {
 		err = p.cidDIndex.Delete(ctx, pp.Cid.KeyString(), pp.Id)
 	}
@@ -377,6 +563,14 @@ func (p *pinner) removePin(ctx context.Context, pp *pin) error {
 		return err
 	}
 
+	if unindex {
+		if _, err = p.cidPIndex.DeleteKey(ctx, pp.Cid.KeyString()); err != nil {
+			return err
+		}
+		if p.unindexed != nil {
+			p.unindexed.Remove(pp.Cid)
+		}
+	}
 	return nil
 }
 
@@ -488,38 +682,344 @@ func (p *pinner) isPinnedWithType(ctx context.Context, c cid.Cid, mode ipfspinne
 	}
 
 	// Default is Indirect
-	visitedSet := cid.NewSet()
-
-	// No index for given CID, so search children of all recursive pinned CIDs
-	var has bool
-	var rc cid.Cid
-	var e error
-	err := p.cidRIndex.ForEach(ctx, "", func(key, value string) bool {
-		rc, e = cid.Cast([]byte(key))
-		if e != nil {
-			return false
+	roots, err := p.indirectRoots(ctx, []cid.Cid{c})
+	if err != nil {
+		return "", false, err
+	}
+	if rc, has := roots[c]; has {
+		return rc.String(), true, nil
+	}
+
+	return "", false, nil
+}
+
+// errWalkDone stops a walk of the descendants of a recursive pin.
+var errWalkDone = errors.New("walk done")
+
+// indirectRoots returns, for each of cids that is a descendant of a recursive
+// pin, one of the roots it is pinned via. The CIDs are looked up in the index
+// first, ignoring the entries of roots that are no longer pinned, left by an
+// interrupted unpin, and the ones that are not found are then searched in the
+// DAGs of the recursive pins that may not be fully indexed.
+func (p *pinner) indirectRoots(ctx context.Context, cids []cid.Cid) (map[cid.Cid]cid.Cid, error) {
+	found := make(map[cid.Cid]cid.Cid)
+	remaining := cid.NewSet()
+	for _, c := range cids {
+		rootKeys, err := p.cidIIndex.Search(ctx, c.KeyString())
+		if err != nil {
+			return nil, err
 		}
-		has, e = hasChild(ctx, p.dserv, rc, c, visitedSet.Visit)
-		if e != nil {
-			return false
+		for _, rootKey := range rootKeys {
+			pinned, err := p.cidRIndex.HasAny(ctx, rootKey)
+			if err != nil {
+				return nil, err
+			}
+			if pinned {
+				rc, err := cid.Cast([]byte(rootKey))
+				if err != nil {
+					return nil, err
+				}
+				found[c] = rc
+				break
+			}
 		}
-		if has {
-			return false
+		if _, ok := found[c]; !ok {
+			remaining.Add(c)
 		}
+	}
+	if remaining.Len() == 0 {
+		return found, nil
+	}
+
+	roots, err := p.unindexedRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		err = p.walkDescendants(ctx, p.dserv, root, func(c cid.Cid) error {
+			if remaining.Has(c) {
+				found[c] = root
+				remaining.Remove(c)
+				if remaining.Len() == 0 {
+					return errWalkDone
+				}
+			}
+			return nil
+		}, merkledag.IgnoreMissing())
+		if err == errWalkDone {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// unindexedRoots returns the recursive pins whose descendants may not all be
+// indexed: the ones left unindexed by an upgrade and the partially indexed
+// ones.
+func (p *pinner) unindexedRoots(ctx context.Context) ([]cid.Cid, error) {
+	var roots []cid.Cid
+	if p.unindexed != nil {
+		roots = p.unindexed.Keys()
+	}
+
+	var partial []string
+	err := p.cidPIndex.ForEach(ctx, "", func(key, value string) bool {
+		partial = append(partial, key)
 		return true
 	})
 	if err != nil {
-		return "", false, err
+		return nil, err
 	}
-	if e != nil {
-		return "", false, e
+	for _, rootKey := range partial {
+		pinned, err := p.cidRIndex.HasAny(ctx, rootKey)
+		if err != nil {
+			return nil, err
+		}
+		if !pinned {
+			continue
+		}
+		c, err := cid.Cast([]byte(rootKey))
+		if err != nil {
+			return nil, err
+		}
+		if p.unindexed == nil || !p.unindexed.Has(c) {
+			roots = append(roots, c)
+		}
 	}
+	return roots, nil
+}
 
-	if has {
-		return rc.String(), true, nil
+// indirectPins are the descendants of a recursive pin, to be added to the
+// index of the indirect pins.
+type indirectPins struct {
+	root cid.Cid
+	cids []cid.Cid
+	// partial is true if blocks were missing, such as the ones of a DAG
+	// pinned with PinWithMode before being fetched, so that their
+	// descendants could not be walked.
+	partial bool
+}
+
+// walkIndirectPins walks the descendants of the recursive pin root. It only
+// reads the DAG service, so that it is called before taking the lock. With
+// fetch, the DAG is fetched by the walk, as by merkledag.FetchGraph, and
+// missing blocks that cannot be fetched fail the walk. Otherwise, they are
+// skipped and the walk is partial.
+func (p *pinner) walkIndirectPins(ctx context.Context, root cid.Cid, fetch bool) (*indirectPins, error) {
+	ip := &indirectPins{root: root}
+	if fetch {
+		progress := merkledag.ProgressTrackerFromContext(ctx)
+		if progress != nil {
+			progress.Increment() // the root
+		}
+		err := p.walkDescendants(ctx, merkledag.NewSession(ctx, p.dserv), root, func(c cid.Cid) error {
+			ip.cids = append(ip.cids, c)
+			if progress != nil {
+				progress.Increment()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ip, nil
 	}
 
-	return "", false, nil
+	var missing atomic.Bool
+	err := p.walkDescendants(ctx, p.dserv, root, func(c cid.Cid) error {
+		ip.cids = append(ip.cids, c)
+		return nil
+	}, merkledag.OnError(func(c cid.Cid, err error) error {
+		if ipld.IsNotFound(err) {
+			missing.Store(true)
+			return nil
+		}
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	ip.partial = missing.Load()
+	return ip, nil
+}
+
+// indexBatchSize is the number of indirect pins written in a batch.
+const indexBatchSize = 1024
+
+// writeIndirectPins adds the descendants of ip to the index of the indirect
+// pins.
+func (p *pinner) writeIndirectPins(ctx context.Context, ip *indirectPins) error {
+	rootKey := ip.root.KeyString()
+	for start := 0; start < len(ip.cids); start += indexBatchSize {
+		batch, err := p.batch(ctx)
+		if err != nil {
+			return err
+		}
+		cidIndex, rootIndex := p.batchIndirectIndexes(batch)
+		for _, c := range ip.cids[start:min(start+indexBatchSize, len(ip.cids))] {
+			if err = cidIndex.Add(ctx, c.KeyString(), rootKey); err != nil {
+				return err
+			}
+			if err = rootIndex.Add(ctx, rootKey, c.KeyString()); err != nil {
+				return err
+			}
+		}
+		if err = batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeIndirectPins removes the indexed descendants of the recursive pin root
+// from the index of the indirect pins, without walking its DAG.
+func (p *pinner) removeIndirectPins(ctx context.Context, root cid.Cid) error {
+	rootKey := root.KeyString()
+	cidKeys, err := p.rootIIndex.Search(ctx, rootKey)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(cidKeys); start += indexBatchSize {
+		batch, err := p.batch(ctx)
+		if err != nil {
+			return err
+		}
+		cidIndex, rootIndex := p.batchIndirectIndexes(batch)
+		for _, cidKey := range cidKeys[start:min(start+indexBatchSize, len(cidKeys))] {
+			if err = cidIndex.Delete(ctx, cidKey, rootKey); err != nil {
+				return err
+			}
+			if err = rootIndex.Delete(ctx, rootKey, cidKey); err != nil {
+				return err
+			}
+		}
+		if err = batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchIndirectIndexes returns the indexes of the indirect pins, whose changes
+// are written to batch.
+func (p *pinner) batchIndirectIndexes(batch ds.Batch) (cidIndex, rootIndex dsindex.Indexer) {
+	bds := batchDatastore{Datastore: p.dstore, batch: batch}
+	return dsindex.New(bds, ds.NewKey(pinCidIIndexPath)), dsindex.New(bds, ds.NewKey(pinRootIIndexPath))
+}
+
+// batch returns a batch of changes to the datastore of the pinner.
+func (p *pinner) batch(ctx context.Context) (ds.Batch, error) {
+	if bds, ok := p.dstore.(ds.Batching); ok {
+		return bds.Batch(ctx)
+	}
+	return ds.NewBasicBatch(p.dstore), nil
+}
+
+// batchDatastore is a datastore whose changes are written to a batch.
+type batchDatastore struct {
+	ds.Datastore
+	batch ds.Batch
+}
+
+func (d batchDatastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return d.batch.Put(ctx, key, value)
+}
+
+func (d batchDatastore) Delete(ctx context.Context, key ds.Key) error {
+	return d.batch.Delete(ctx, key)
+}
+
+// IndexPartialPins indexes again the descendants of the partially indexed
+// recursive pins, such as the ones pinned with PinWithMode before their DAG
+// was fetched, whose DAGs are walked to find indirect pins until then. New
+// does so in the background when loading the pinner. The DAGs are walked
+// without holding the lock of the pinner.
+func (p *pinner) IndexPartialPins(ctx context.Context) error {
+	var roots []cid.Cid
+	p.lock.RLock()
+	err := p.cidPIndex.ForEach(ctx, "", func(key, value string) bool {
+		c, err := cid.Cast([]byte(key))
+		if err != nil {
+			log.Errorf("invalid partial pin index for key %q: %s", key, err)
+			return true
+		}
+		roots = append(roots, c)
+		return true
+	})
+	p.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		ip, err := p.walkIndirectPins(ctx, root, false)
+		if err != nil {
+			return fmt.Errorf("cannot index the descendants of recursive pin %s: %w", root, err)
+		}
+		if err = p.indexWalkedPin(ctx, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexWalkedPin writes the index of the descendants, walked in ip, of a
+// recursive pin that is left unindexed by an upgrade or partially indexed,
+// unless it was indexed since. The index of a root that is not pinned, left by
+// an interrupted pin or unpin, is removed.
+func (p *pinner) indexWalkedPin(ctx context.Context, ip *indirectPins) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	rootKey := ip.root.KeyString()
+	unindexed := p.unindexed != nil && p.unindexed.Has(ip.root)
+	partial, err := p.cidPIndex.HasAny(ctx, rootKey)
+	if err != nil || !(unindexed || partial) {
+		return err
+	}
+	p.setDirty(ctx)
+	pinned, err := p.cidRIndex.HasAny(ctx, rootKey)
+	if err != nil {
+		return err
+	}
+	if pinned {
+		err = p.writeIndirectPins(ctx, ip)
+		if err == nil && ip.partial {
+			err = p.cidPIndex.Add(ctx, rootKey, rootKey)
+		}
+	} else {
+		err = p.removeIndirectPins(ctx, ip.root)
+	}
+	if err == nil && !(pinned && ip.partial) {
+		_, err = p.cidPIndex.DeleteKey(ctx, rootKey)
+	}
+	if err != nil {
+		return err
+	}
+	if unindexed {
+		p.unindexed.Remove(ip.root)
+	}
+	return p.flushPins(ctx, false)
+}
+
+// walkDescendants calls fn once for each descendant of root, read from ng.
+func (p *pinner) walkDescendants(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, fn func(cid.Cid) error, options ...merkledag.WalkOption) error {
+	var err error
+	visited := cid.NewSet()
+	walkErr := merkledag.Walk(ctx, merkledag.GetLinksWithDAG(ng), root, func(c cid.Cid) bool {
+		if err != nil || !visited.Visit(c) {
+			return false
+		}
+		err = fn(c)
+		return err == nil
+	}, append(append(options, merkledag.SkipRoot(), merkledag.Concurrent()), p.walkOptions...)...)
+	if err != nil {
+		return err
+	}
+	return walkErr
 }
 
 // CheckIfPinned checks if a set of keys are pinned, more efficient than
@@ -555,36 +1055,27 @@ func (p *pinner) CheckIfPinned(ctx context.Context, cids ...cid.Cid) ([]ipfspinn
 		}
 	}
 
-	var e error
-	visited := cid.NewSet()
-	err := p.cidRIndex.ForEach(ctx, "", func(key, value string) bool {
-		var rk cid.Cid
-		rk, e = cid.Cast([]byte(key))
-		if e != nil {
-			return false
-		}
-		e = merkledag.Walk(ctx, merkledag.GetLinksWithDAG(p.dserv), rk, func(c cid.Cid) bool {
-			if toCheck.Len() == 0 || !visited.Visit(c) {
-				return false
-			}
-
+	checkIndirect := func() error {
+		var indirect []cid.Cid
+		for _, c := range cids {
 			if toCheck.Has(c) {
+				indirect = append(indirect, c)
+			}
+		}
+		roots, err := p.indirectRoots(ctx, indirect)
+		if err != nil {
+			return err
+		}
+		for _, c := range indirect {
+			if rk, has := roots[c]; has && toCheck.Has(c) {
 				pinned = append(pinned, ipfspinner.Pinned{Key: c, Mode: ipfspinner.Indirect, Via: rk})
 				toCheck.Remove(c)
 			}
-
-			return true
-		}, merkledag.Concurrent())
-		if e != nil {
-			return false
 		}
-		return toCheck.Len() > 0
-	})
-	if err != nil {
-		return nil, err
+		return nil
 	}
-	if e != nil {
-		return nil, e
+	if err := checkIndirect(); err != nil {
+		return nil, err
 	}
 
 	// Anything left in toCheck is not pinned
@@ -793,9 +1284,10 @@ func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error
 		return errors.New("'to' cid was already recursively pinned")
 	}
 
-	// Temporarily unlock while we fetch the differences.
+	// Temporarily unlock while we fetch the new DAG, walking the descendants
+	// of the new pin. The shared blocks are already stored.
 	p.lock.Unlock()
-	err = dagutils.DiffEnumerate(ctx, p.dserv, from, to)
+	toIP, err := p.walkIndirectPins(ctx, to, true)
 	p.lock.Lock()
 
 	if err != nil {
@@ -808,7 +1300,7 @@ func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error
 		return err
 	}
 
-	_, err = p.addPin(ctx, to, ipfspinner.Recursive, pin.Name)
+	_, err = p.addPin(ctx, to, ipfspinner.Recursive, pin.Name, toIP)
 	if err != nil {
 		return err
 	}
@@ -873,32 +1365,6 @@ func (p *pinner) PinWithMode(ctx context.Context, c cid.Cid, mode ipfspinner.Mod
 	}
 }
 
-// hasChild recursively looks for a Cid among the children of a root Cid.
-// The visit function can be used to shortcut already-visited branches.
-func hasChild(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, child cid.Cid, visit func(cid.Cid) bool) (bool, error) {
-	links, err := ipld.GetLinks(ctx, ng, root)
-	if err != nil {
-		return false, err
-	}
-	for _, lnk := range links {
-		c := lnk.Cid
-		if lnk.Cid.Equals(child) {
-			return true, nil
-		}
-		if visit(c) {
-			has, err := hasChild(ctx, ng, c, child, visit)
-			if err != nil {
-				return false, err
-			}
-
-			if has {
-				return has, nil
-			}
-		}
-	}
-	return false, nil
-}
-
 func encodePin(p *pin) ([]byte, error) {
 	b, err := cbor.MarshalAtlased(p, pinAtl)
 	if err != nil {
@@ -1074,5 +1540,8 @@ func (p *pinner) rebuildIndexes(ctx context.Context) error {
 	}
 
 	log.Errorf("checked %d pins for invalid indexes, repaired %d pins", checkedCount, repairedCount)
+
+	// The indirect pins of an interrupted pin or unpin are indexed again in
+	// the background, since they are partially indexed.
 	return p.flushPins(ctx, true)
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	mdag "github.com/ipfs/boxo/ipld/merkledag"
 	"github.com/stretchr/testify/require"
 
+	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
@@ -24,6 +26,7 @@ import (
 	"github.com/ipfs/go-test/random"
 
 	ipfspin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/boxo/pinning/pinner/dsindex"
 )
 
 type fakeLogger struct {
@@ -80,6 +83,24 @@ func assertPinnedWithType(t *testing.T, p ipfspin.Pinner, c cid.Cid, mode ipfspi
 	}
 }
 
+// assertPinnedVia checks that c is pinned indirectly, via one of roots.
+func assertPinnedVia(t *testing.T, p ipfspin.Pinner, c cid.Cid, roots ...cid.Cid) {
+	t.Helper()
+	via, pinned, err := p.IsPinnedWithType(context.Background(), c, ipfspin.Indirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned {
+		t.Fatal("expected", c, "to be pinned indirectly")
+	}
+	for _, root := range roots {
+		if via == root.String() {
+			return
+		}
+	}
+	t.Fatal("expected", c, "to be pinned via one of", roots, "got", via)
+}
+
 func assertUnpinned(t *testing.T, p ipfspin.Pinner, c cid.Cid, failmsg string) {
 	_, pinned, err := p.IsPinned(context.Background(), c)
 	if err != nil {
@@ -356,7 +377,7 @@ func TestAddLoadPin(t *testing.T) {
 
 	mode := ipfspin.Recursive
 	name := "my-pin"
-	pid, err := p.addPin(ctx, ak, mode, name)
+	pid, err := p.addPin(ctx, ak, mode, name, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -591,6 +612,75 @@ func TestPinRecursiveFail(t *testing.T) {
 	}
 }
 
+func TestVerify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+
+	// Keep a copy of the blocks to repair the pins.
+	backup := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	backupServ := mdag.NewDAGService(bs.New(backup, offline.Exchange(backup)))
+
+	p, err := New(ctx, dstore, dserv)
+	require.NoError(t, err)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	c, ck := randNode()
+	require.NoError(t, a.AddNodeLink("b", b))
+	require.NoError(t, a.AddNodeLink("c", c))
+	ak = a.Cid()
+	d, dk := randNode()
+	for _, nd := range []ipld.Node{a, b, c, d} {
+		require.NoError(t, dserv.Add(ctx, nd))
+		require.NoError(t, backupServ.Add(ctx, nd))
+	}
+	require.NoError(t, p.Pin(ctx, a, true, ""))
+	require.NoError(t, p.Pin(ctx, d, true, ""))
+
+	// b is missing, and c is corrupt.
+	require.NoError(t, bstore.DeleteBlock(ctx, bk))
+	require.NoError(t, bstore.DeleteBlock(ctx, ck))
+	corrupt, err := blocks.NewBlockWithCid([]byte("corrupt"), ck)
+	require.NoError(t, err)
+	require.NoError(t, bstore.Put(ctx, corrupt))
+
+	verify := func(opts ...ipfspin.VerifyOption) map[cid.Cid]ipfspin.VerifyResult {
+		results := make(map[cid.Cid]ipfspin.VerifyResult)
+		for res := range ipfspin.Verify(ctx, p, bstore, opts...) {
+			require.NoError(t, res.Err)
+			results[res.Pin] = res
+		}
+		require.Len(t, results, 2)
+		return results
+	}
+
+	results := verify()
+	require.True(t, results[dk].Ok())
+	require.False(t, results[ak].Ok())
+	bad := make(map[cid.Cid]error)
+	for _, bn := range results[ak].BadNodes {
+		require.False(t, bn.Repaired)
+		bad[bn.Cid] = bn.Err
+	}
+	require.Len(t, bad, 2)
+	require.True(t, ipld.IsNotFound(bad[bk]))
+	require.ErrorIs(t, bad[ck], ipfspin.ErrCorruptBlock)
+
+	results = verify(ipfspin.WithVerifyRepair(offline.Exchange(backup)))
+	require.True(t, results[ak].Ok())
+	require.Len(t, results[ak].BadNodes, 2)
+	for _, bn := range results[ak].BadNodes {
+		require.True(t, bn.Repaired)
+	}
+
+	results = verify()
+	require.True(t, results[ak].Ok())
+	require.Empty(t, results[ak].BadNodes)
+}
+
 func TestPinUpdate(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -1202,7 +1292,7 @@ func TestCidIndex(t *testing.T) {
 	cidKey := c.KeyString()
 
 	// Pin the cid
-	pid, err := pinner.addPin(ctx, c, ipfspin.Recursive, "")
+	pid, err := pinner.addPin(ctx, c, ipfspin.Recursive, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1395,6 +1485,337 @@ func verifyIndexValue(ctx context.Context, pinner *pinner, cidKey, expectedPid s
 	return nil
 }
 
+// makeChain adds a root linking to a child linking to a leaf, and returns them.
+func makeChain(ctx context.Context, t *testing.T, dserv ipld.DAGService) (root, child, leaf *mdag.ProtoNode) {
+	root, _ = randNode()
+	child, _ = randNode()
+	leaf, _ = randNode()
+	if err := child.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.AddMany(ctx, []ipld.Node{root, child, leaf}); err != nil {
+		t.Fatal(err)
+	}
+	return root, child, leaf
+}
+
+func TestIndirectIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := makeStore()
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, child, leaf := makeChain(ctx, t, dserv)
+	other, _ := randNode()
+	if err = other.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err = dserv.Add(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Pin(ctx, root, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Pin(ctx, other, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cid.Cid{child.Cid(), leaf.Cid()} {
+		roots, err := p.cidIIndex.Search(ctx, c.KeyString())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(roots) == 0 {
+			t.Fatal("expected descendant to be indexed")
+		}
+	}
+	assertPinnedVia(t, p, child.Cid(), root.Cid())
+	// The leaf is indexed under both roots.
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid(), other.Cid())
+
+	// The leaf is still pinned by the other root.
+	if err = p.Unpin(ctx, root.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, child.Cid(), "child should not be pinned")
+	assertPinnedVia(t, p, leaf.Cid(), other.Cid())
+	has, err := p.cidIIndex.HasAny(ctx, child.Cid().KeyString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected child to be removed from index")
+	}
+
+	if err = p.Unpin(ctx, other.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, leaf.Cid(), "leaf should not be pinned")
+	n, err := p.cidIIndex.DeleteAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected empty index, got %d entries", n)
+	}
+}
+
+// countingPrefetch counts the nodes scheduled by the walks using it.
+type countingPrefetch struct {
+	mdag.PrefetchConfig
+	calls *atomic.Int64
+}
+
+func (s countingPrefetch) Window() int {
+	s.calls.Add(1)
+	return s.PrefetchConfig.Window()
+}
+
+func TestPrefetch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := makeStore()
+	strategy := countingPrefetch{
+		PrefetchConfig: mdag.PrefetchConfig{BreadthWindow: 4, LinkOrder: true},
+		calls:          new(atomic.Int64),
+	}
+	p, err := New(ctx, dstore, dserv, WithPrefetch(strategy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, child, leaf := makeChain(ctx, t, dserv)
+
+	if err = p.Pin(ctx, root, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	assertPinnedVia(t, p, child.Cid(), root.Cid())
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid())
+	if strategy.calls.Load() == 0 {
+		t.Fatal("expected the prefetch strategy to be used")
+	}
+}
+
+func TestIndirectIndexMissingBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := makeStore()
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.indexed
+	root, _ := randNode()
+	child, _ := randNode()
+	leaf, _ := randNode()
+	if err = child.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err = root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pin the root before its descendants are fetched.
+	if err = dserv.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.PinWithMode(ctx, root.Cid(), ipfspin.Recursive, ""); err != nil {
+		t.Fatal(err)
+	}
+	assertPinnedVia(t, p, child.Cid(), root.Cid())
+
+	// The descendants fetched afterwards are found by walking the DAG until
+	// they are indexed by IndexPartialPins.
+	if err = dserv.AddMany(ctx, []ipld.Node{child, leaf}); err != nil {
+		t.Fatal(err)
+	}
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid())
+	has, err := p.cidIIndex.HasAny(ctx, leaf.Cid().KeyString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected leaf not to be indexed yet")
+	}
+	if err = p.IndexPartialPins(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.CheckIfPinned(ctx, leaf.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Mode != ipfspin.Indirect || !res[0].Via.Equals(root.Cid()) {
+		t.Fatalf("expected %s to be pinned via %s, got %s", leaf.Cid(), root.Cid(), res[0].String())
+	}
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid())
+	has, err = p.cidPIndex.HasAny(ctx, root.Cid().KeyString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected root to be fully indexed")
+	}
+
+	if err = p.Unpin(ctx, root.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	assertUnpinned(t, p, leaf.Cid(), "leaf should not be pinned")
+}
+
+func TestUpgradeVersion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := makeStore()
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, child, leaf := makeChain(ctx, t, dserv)
+	if err = p.Pin(ctx, root, true, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate pins saved with the first version, without indirect index.
+	if _, err = p.cidIIndex.DeleteAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.rootIIndex.DeleteAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = dstore.Delete(ctx, versionKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The DAGs are walked until the index is built in the background.
+	p, err = New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPinnedVia(t, p, child.Cid(), root.Cid())
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid())
+
+	<-p.indexed
+	has, err := p.cidIIndex.HasAny(ctx, leaf.Cid().KeyString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("expected leaf to be indexed")
+	}
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid())
+	data, err := dstore.Get(ctx, versionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 || data[0] != schemaVersion {
+		t.Fatalf("expected version %d, got %x", schemaVersion, data)
+	}
+
+	// Newer versions are not supported.
+	if err = dstore.Put(ctx, versionKey, []byte{schemaVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(ctx, dstore, dserv); err == nil {
+		t.Fatal("expected error loading newer version")
+	}
+}
+
+func TestInterruptedPin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := makeStore()
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, child, leaf := makeChain(ctx, t, dserv)
+	if err = p.Pin(ctx, root, true, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a pin interrupted before its descendants were all indexed.
+	rootKey := root.Cid().KeyString()
+	if err = p.cidPIndex.Add(ctx, rootKey, rootKey); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.removeIndirectPins(ctx, root.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.cidRIndex.DeleteKey(ctx, rootKey); err != nil {
+		t.Fatal(err)
+	}
+	p.setDirty(ctx)
+
+	// The pin is completed, and its DAG walked until indexed again.
+	p, err = New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPinnedVia(t, p, child.Cid(), root.Cid())
+	assertPinnedVia(t, p, leaf.Cid(), root.Cid())
+
+	<-p.indexed
+	has, err := p.cidIIndex.HasAny(ctx, leaf.Cid().KeyString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("expected leaf to be indexed")
+	}
+	has, err = p.cidPIndex.HasAny(ctx, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected root to be fully indexed")
+	}
+}
+
+func TestUnpinWithoutBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := makeStore()
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, child, leaf := makeChain(ctx, t, dserv)
+	progress := new(mdag.ProgressTracker)
+	if err = p.Pin(progress.DeriveContext(ctx), root, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if progress.Value() != 3 {
+		t.Fatalf("expected 3 fetched nodes, got %d", progress.Value())
+	}
+
+	// The descendants are removed from the index without walking the DAG.
+	if err = dserv.RemoveMany(ctx, []cid.Cid{child.Cid(), leaf.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Unpin(ctx, root.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []dsindex.Indexer{p.cidIIndex, p.rootIIndex, p.cidPIndex} {
+		has, err := index.HasAny(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			t.Fatal("expected empty index")
+		}
+	}
+}
+
 func BenchmarkDetails(b *testing.B) {
 	for count := 128; count <= 16386; count <<= 1 {
 		b.Run(fmt.Sprint("Keys-NoDetails-", count), func(b *testing.B) {
@@ -0,0 +1,40 @@
+package pin
+
+import (
+	"context"
+
+	"github.com/ipfs/boxo/blockstore"
+	cid "github.com/ipfs/go-cid"
+)
+
+// GCRoots returns a function listing the pins of the pinner as the roots of a
+// garbage collection of a [blockstore.SnapshotGCBlockstore]. Recursive and
+// internal pins are kept with their descendants, direct pins without.
+func GCRoots(pinner Pinner) blockstore.GCRootsFunc {
+	return func(ctx context.Context) (blockstore.GCRoots, error) {
+		return listGCRoots(ctx, pinner)
+	}
+}
+
+func listGCRoots(ctx context.Context, pinner Pinner) (blockstore.GCRoots, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var roots blockstore.GCRoots
+	for _, list := range []struct {
+		keys func(context.Context, bool) <-chan StreamedPin
+		out  *[]cid.Cid
+	}{
+		{pinner.RecursiveKeys, &roots.Recursive},
+		{pinner.InternalPins, &roots.Recursive},
+		{pinner.DirectKeys, &roots.Direct},
+	} {
+		for sp := range list.keys(ctx, false) {
+			if sp.Err != nil {
+				return blockstore.GCRoots{}, sp.Err
+			}
+			*list.out = append(*list.out, sp.Pin.Key)
+		}
+	}
+	return roots, nil
+}
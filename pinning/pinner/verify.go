@@ -0,0 +1,229 @@
+package pin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	legacy "github.com/ipfs/go-ipld-legacy"
+	logging "github.com/ipfs/go-log/v2"
+
+	// blank imports register the codecs of the blocks whose links are walked
+	_ "github.com/ipld/go-codec-dagpb"
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+)
+
+var log = logging.Logger("pin")
+
+// ErrCorruptBlock is the error of the blocks whose data does not match their
+// CID.
+var ErrCorruptBlock = errors.New("block data does not match its CID")
+
+// BadNode is a node of a pinned DAG that is missing or corrupt in the local
+// blockstore.
+type BadNode struct {
+	Cid cid.Cid
+	Err error
+	// Repaired is true if the node was fetched again and stored, see
+	// [WithVerifyRepair].
+	Repaired bool
+}
+
+// VerifyResult is the result of the verification of a recursive pin.
+type VerifyResult struct {
+	Pin      cid.Cid
+	BadNodes []BadNode
+	// Err is set if the pins could not be listed, in which case it is the last
+	// result.
+	Err error
+}
+
+// Ok returns true if all the nodes of the pin are available, possibly after
+// being repaired.
+func (r VerifyResult) Ok() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, n := range r.BadNodes {
+		if !n.Repaired {
+			return false
+		}
+	}
+	return true
+}
+
+type verifyOptions struct {
+	fetcher exchange.Fetcher
+}
+
+// VerifyOption configures [Verify].
+type VerifyOption func(*verifyOptions)
+
+// WithVerifyRepair fetches missing and corrupt blocks with the given fetcher,
+// e.g. a blockservice or bitswap, and stores them in the blockstore.
+func WithVerifyRepair(fetcher exchange.Fetcher) VerifyOption {
+	return func(o *verifyOptions) {
+		o.fetcher = fetcher
+	}
+}
+
+// Verify walks the DAGs of all recursive pins of the pinner, and checks that
+// every block is present in bs and matches its CID. A result is sent for each
+// pin, after its DAG has been walked. Blocks shared by several pins are
+// usually walked once, and their bad nodes are reported for each pin: the
+// results of up to about a million walked blocks, roughly 100 MiB, are kept
+// in memory, after which they are forgotten and shared blocks may be walked
+// again.
+//
+// The output channel is closed when all pins are verified, or when ctx is
+// done.
+func Verify(ctx context.Context, pinner Pinner, bs blockstore.Blockstore, opts ...VerifyOption) <-chan VerifyResult {
+	var o verifyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	v := &verifier{
+		bs:      bs,
+		fetcher: o.fetcher,
+		decoder: legacy.NewDecoder(),
+		checked: make(map[cid.Cid][]BadNode),
+	}
+
+	out := make(chan VerifyResult)
+	go func() {
+		defer close(out)
+
+		for sp := range pinner.RecursiveKeys(ctx, false) {
+			res := VerifyResult{Pin: sp.Pin.Key, Err: sp.Err}
+			if res.Err == nil {
+				res.BadNodes = v.verify(ctx, sp.Pin.Key)
+				if ctx.Err() != nil {
+					return
+				}
+			}
+
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+			if res.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// maxVerifyChecked bounds the number of blocks whose results are memoized by
+// [Verify], about a hundred bytes each.
+const maxVerifyChecked = 1 << 20
+
+type verifier struct {
+	bs      blockstore.Blockstore
+	fetcher exchange.Fetcher
+	decoder *legacy.Decoder
+	// checked memoizes the bad nodes of the DAG under each walked node.
+	checked map[cid.Cid][]BadNode
+}
+
+// verify returns the bad nodes of the DAG under root, without duplicates.
+func (v *verifier) verify(ctx context.Context, root cid.Cid) []BadNode {
+	var (
+		bad  []BadNode
+		seen = cid.NewSet()
+	)
+	for _, bn := range v.walk(ctx, root) {
+		if seen.Visit(bn.Cid) {
+			bad = append(bad, bn)
+		}
+	}
+	return bad
+}
+
+func (v *verifier) walk(ctx context.Context, c cid.Cid) []BadNode {
+	if ctx.Err() != nil {
+		return nil
+	}
+	if bad, ok := v.checked[c]; ok {
+		return bad
+	}
+
+	var bad []BadNode
+	blk, err := v.check(ctx, c)
+	if err != nil {
+		bn := BadNode{Cid: c, Err: err}
+		blk = nil
+		if v.fetcher != nil {
+			blk, bn.Repaired = v.repair(ctx, c, err)
+		}
+		bad = append(bad, bn)
+	}
+
+	if blk != nil {
+		nd, err := v.decoder.DecodeNode(ctx, blk)
+		if err != nil {
+			// The block is valid, but its links cannot be walked.
+			log.Errorf("verify: cannot decode %s: %s", c, err)
+		} else {
+			for _, l := range nd.Links() {
+				bad = append(bad, v.walk(ctx, l.Cid)...)
+			}
+		}
+	}
+
+	// Do not memoize the results of interrupted walks.
+	if ctx.Err() == nil {
+		if len(v.checked) >= maxVerifyChecked {
+			clear(v.checked)
+		}
+		v.checked[c] = bad
+	}
+	return bad
+}
+
+// check returns the block of c if it is present and matches c.
+func (v *verifier) check(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := v.bs.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return blk, validateBlock(blk)
+}
+
+// repair fetches the block of c and replaces the local copy.
+func (v *verifier) repair(ctx context.Context, c cid.Cid, cause error) (blocks.Block, bool) {
+	blk, err := v.fetcher.GetBlock(ctx, c)
+	if err == nil {
+		err = validateBlock(blk)
+	}
+	if err == nil && errors.Is(cause, ErrCorruptBlock) {
+		err = v.bs.DeleteBlock(ctx, c)
+	}
+	if err == nil {
+		err = v.bs.Put(ctx, blk)
+	}
+	if err != nil {
+		log.Errorf("verify: cannot repair %s: %s", c, err)
+		return nil, false
+	}
+	return blk, true
+}
+
+func validateBlock(blk blocks.Block) error {
+	c := blk.Cid()
+	sum, err := c.Prefix().Sum(blk.RawData())
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("%w: %s", ErrCorruptBlock, c)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package go_pinning_service_http_client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+)
+
+// BatchError is returned by batch operations when some of the operations
+// failed.
+type BatchError struct {
+	// Errors holds the error of each failed operation, by index in the batch.
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 0 {
+		return "no operation of the batch failed"
+	}
+	first := -1
+	for i := range e.Errors {
+		if first == -1 || i < first {
+			first = i
+		}
+	}
+	return fmt.Sprintf("%d operations of the batch failed, first error at index %d: %s", len(e.Errors), first, e.Errors[first])
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// AddRequest is a pin request of [Client.AddMany].
+type AddRequest struct {
+	Cid     cid.Cid
+	Options []AddOption
+}
+
+// AddMany adds the given pins concurrently, see [WithBatchConcurrency]. The
+// returned statuses are in the order of the requests, with nil for the pins
+// that failed, in which case a [*BatchError] is returned.
+func (c *Client) AddMany(ctx context.Context, reqs []AddRequest) ([]PinStatusGetter, error) {
+	res := make([]PinStatusGetter, len(reqs))
+	err := c.batch(ctx, len(reqs), func(ctx context.Context, i int) error {
+		var err error
+		res[i], err = c.Add(ctx, reqs[i].Cid, reqs[i].Options...)
+		return err
+	})
+	return res, err
+}
+
+// DeleteManyByID deletes the pins with the given request IDs concurrently, see
+// [WithBatchConcurrency]. If some deletions fail, a [*BatchError] is returned.
+func (c *Client) DeleteManyByID(ctx context.Context, pinIDs []string) error {
+	return c.batch(ctx, len(pinIDs), func(ctx context.Context, i int) error {
+		return c.DeleteByID(ctx, pinIDs[i])
+	})
+}
+
+// batch runs op for each index in [0, n), with at most batchConcurrency
+// operations at a time.
+func (c *Client) batch(ctx context.Context, n int, op func(context.Context, int) error) error {
+	var (
+		wg   sync.WaitGroup
+		lk   sync.Mutex
+		errs = make(map[int]error)
+	)
+
+	sem := make(chan struct{}, c.batchConcurrency)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			lk.Lock()
+			for j := i; j < n; j++ {
+				errs[j] = ctx.Err()
+			}
+			lk.Unlock()
+			wg.Wait()
+			return &BatchError{Errors: errs}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := op(ctx, i); err != nil {
+				lk.Lock()
+				errs[i] = err
+				lk.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
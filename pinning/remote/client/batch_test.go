@@ -0,0 +1,136 @@
+package go_pinning_service_http_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/pinning/remote/client/openapi"
+	"github.com/ipfs/go-test/random"
+	"github.com/stretchr/testify/require"
+)
+
+// batchServer accepts the pins and the deletions, except the ones of the CIDs
+// and request IDs in fail, and records the maximum number of concurrent
+// requests.
+type batchServer struct {
+	fail map[string]bool
+
+	active, maxActive atomic.Int32
+}
+
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	active := s.active.Add(1)
+	defer s.active.Add(-1)
+	for {
+		maxActive := s.maxActive.Load()
+		if active <= maxActive || s.maxActive.CompareAndSwap(maxActive, active) {
+			break
+		}
+	}
+	// Let the other requests of the batch run meanwhile.
+	time.Sleep(10 * time.Millisecond)
+
+	switch r.Method {
+	case http.MethodPost:
+		var pin openapi.Pin
+		if err := json.NewDecoder(r.Body).Decode(&pin); err != nil || s.fail[pin.Cid] {
+			http.Error(w, "rejected", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(openapi.NewPinStatus("request-"+pin.Cid, openapi.QUEUED, time.Now(), pin, []string{}))
+	case http.MethodDelete:
+		if s.fail[strings.TrimPrefix(r.URL.Path, "/pins/")] {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAddMany(t *testing.T) {
+	t.Parallel()
+
+	cids := random.Cids(6)
+	srv := &batchServer{fail: map[string]bool{cids[1].String(): true, cids[4].String(): true}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	reqs := make([]AddRequest, len(cids))
+	for i, c := range cids {
+		reqs[i] = AddRequest{Cid: c}
+	}
+	c := NewClient(ts.URL, "token", WithBatchConcurrency(2))
+	statuses, err := c.AddMany(context.Background(), reqs)
+
+	// Each failed pin is reported by its index.
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Errors, 2)
+	require.ErrorContains(t, batchErr.Errors[1], "http error 400")
+	require.ErrorContains(t, batchErr.Errors[4], "http error 400")
+	require.ErrorContains(t, err, "2 operations of the batch failed, first error at index 1")
+
+	require.Len(t, statuses, len(cids))
+	for i, ps := range statuses {
+		if i == 1 || i == 4 {
+			require.Nil(t, ps, i)
+			continue
+		}
+		require.Equal(t, "request-"+cids[i].String(), ps.GetRequestId())
+	}
+	require.LessOrEqual(t, srv.maxActive.Load(), int32(2))
+}
+
+func TestBatchErrorEmpty(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "no operation of the batch failed", (&BatchError{}).Error())
+}
+
+func TestDeleteManyByID(t *testing.T) {
+	t.Parallel()
+
+	srv := &batchServer{fail: map[string]bool{"missing": true}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "token")
+	require.NoError(t, c.DeleteManyByID(context.Background(), []string{"a", "b", "c"}))
+
+	err := c.DeleteManyByID(context.Background(), []string{"a", "missing", "c"})
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Errors, 1)
+	require.ErrorContains(t, batchErr.Errors[1], "http error 404")
+}
+
+func TestBatchCancelled(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(&batchServer{})
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := NewClient(ts.URL, "token", WithBatchConcurrency(1))
+	err := c.DeleteManyByID(ctx, []string{"a", "b", "c"})
+
+	// The operations that were not started are reported as cancelled.
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.NotEmpty(t, batchErr.Errors)
+	for _, err := range batchErr.Errors {
+		require.True(t, errors.Is(err, context.Canceled), err)
+	}
+}
@@ -19,10 +19,58 @@ var logger = logging.Logger("pinning-service-http-client")
 const UserAgent = "go-pinning-service-http-client"
 
 type Client struct {
-	client *openapi.APIClient
+	client           *openapi.APIClient
+	batchConcurrency int
 }
 
-func NewClient(url, bearerToken string) *Client {
+type clientSettings struct {
+	httpClient       *http.Client
+	maxRetries       int
+	minRetryBackoff  time.Duration
+	batchConcurrency int
+}
+
+type ClientOption func(options *clientSettings)
+
+// WithHTTPClient sets the HTTP client used to reach the pinning service.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(options *clientSettings) {
+		options.httpClient = client
+	}
+}
+
+// WithRetries retries requests failing with a network error, a 429 Too Many
+// Requests or a 5xx status, up to maxRetries times. Retries are delayed
+// exponentially starting from minBackoff, or by the Retry-After header of the
+// response. POST requests are sent with an Idempotency-Key header, the same
+// for all the attempts, so that services supporting it do not create the same
+// pin twice.
+func WithRetries(maxRetries int, minBackoff time.Duration) ClientOption {
+	return func(options *clientSettings) {
+		options.maxRetries = maxRetries
+		options.minRetryBackoff = minBackoff
+	}
+}
+
+// WithBatchConcurrency sets the number of concurrent requests of [Client.AddMany]
+// and [Client.DeleteManyByID]. Defaults to 8.
+func WithBatchConcurrency(n int) ClientOption {
+	return func(options *clientSettings) {
+		options.batchConcurrency = n
+	}
+}
+
+const defaultBatchConcurrency = 8
+
+func NewClient(url, bearerToken string, opts ...ClientOption) *Client {
+	settings := clientSettings{
+		httpClient:       http.DefaultClient,
+		batchConcurrency: defaultBatchConcurrency,
+	}
+	for _, o := range opts {
+		o(&settings)
+	}
+
 	config := openapi.NewConfiguration()
 	config.UserAgent = UserAgent
 	config.AddDefaultHeader("Authorization", "Bearer "+bearerToken)
@@ -31,23 +79,51 @@ func NewClient(url, bearerToken string) *Client {
 			URL: url,
 		},
 	}
+	config.HTTPClient = settings.httpClient
+	if settings.maxRetries > 0 {
+		httpClient := *settings.httpClient
+		httpClient.Transport = &retryTransport{
+			base:       httpClient.Transport,
+			maxRetries: settings.maxRetries,
+			minBackoff: settings.minRetryBackoff,
+		}
+		config.HTTPClient = &httpClient
+	}
 
-	return &Client{client: openapi.NewAPIClient(config)}
+	return &Client{
+		client:           openapi.NewAPIClient(config),
+		batchConcurrency: max(settings.batchConcurrency, 1),
+	}
 }
 
 // TODO: We should probably make sure there are no duplicates sent
 type lsSettings struct {
 	cids   []string
 	name   string
+	match  NameMatch
 	status []Status
 	before *time.Time
 	after  *time.Time
 	limit  *int32
 	meta   map[string]string
+	cursor *lsCursor
 }
 
 type LsOption func(options *lsSettings) error
 
+func newLsSettings(opts []LsOption) (*lsSettings, error) {
+	settings := new(lsSettings)
+	for _, o := range opts {
+		if err := o(settings); err != nil {
+			return nil, err
+		}
+	}
+	if settings.cursor != nil && settings.before != nil {
+		return nil, errors.New("cursor cannot be used with FilterBefore")
+	}
+	return settings, nil
+}
+
 var PinOpts = pinOpts{}
 
 type pinOpts struct {
@@ -79,6 +155,20 @@ func (pinLsOpts) FilterName(name string) LsOption {
 	}
 }
 
+// NameMatch sets how [pinLsOpts.FilterName] matches names. Defaults to
+// [NameMatchExact].
+func (pinLsOpts) NameMatch(match NameMatch) LsOption {
+	return func(options *lsSettings) error {
+		switch match {
+		case NameMatchExact, NameMatchIExact, NameMatchPartial, NameMatchIPartial:
+		default:
+			return fmt.Errorf("invalid name match %s", match)
+		}
+		options.match = match
+		return nil
+	}
+}
+
 func (pinLsOpts) FilterStatus(statuses ...Status) LsOption {
 	return func(options *lsSettings) error {
 		for _, s := range statuses {
@@ -128,6 +218,19 @@ func (pinLsOpts) Limit(limit int) LsOption {
 	}
 }
 
+// Cursor resumes listing after the last page returned by [Client.LsPage]. It
+// cannot be used with [pinLsOpts.FilterBefore].
+func (pinLsOpts) Cursor(cursor string) LsOption {
+	return func(options *lsSettings) error {
+		c, err := parseLsCursor(cursor)
+		if err != nil {
+			return fmt.Errorf("invalid cursor %q: %w", cursor, err)
+		}
+		options.cursor = c
+		return nil
+	}
+}
+
 func (pinLsOpts) LsMeta(meta map[string]string) LsOption {
 	return func(options *lsSettings) error {
 		options.meta = meta
@@ -153,12 +256,10 @@ type pinResults = openapi.PinResults
 //	}
 //	return <-lsErr
 func (c *Client) Ls(ctx context.Context, res chan<- PinStatusGetter, opts ...LsOption) (err error) {
-	settings := new(lsSettings)
-	for _, o := range opts {
-		if err = o(settings); err != nil {
-			close(res)
-			return err
-		}
+	settings, err := newLsSettings(opts)
+	if err != nil {
+		close(res)
+		return err
 	}
 
 	defer func() {
@@ -203,6 +304,7 @@ func (c *Client) Ls(ctx context.Context, res chan<- PinStatusGetter, opts ...LsO
 
 		oldestResult := results[batchSize-1]
 		settings.before = &oldestResult.Created
+		settings.cursor = nil
 	}
 }
 
@@ -232,13 +334,14 @@ func (c *Client) LsSync(ctx context.Context, opts ...LsOption) ([]PinStatusGette
 
 // Manual version of Ls that returns a single batch of results and int with total count
 func (c *Client) LsBatchSync(ctx context.Context, opts ...LsOption) ([]PinStatusGetter, int, error) {
-	settings := new(lsSettings)
-	for _, o := range opts {
-		if err := o(settings); err != nil {
-			return nil, 0, err
-		}
+	settings, err := newLsSettings(opts)
+	if err != nil {
+		return nil, 0, err
 	}
+	return c.lsBatch(ctx, settings)
+}
 
+func (c *Client) lsBatch(ctx context.Context, settings *lsSettings) ([]PinStatusGetter, int, error) {
 	pinRes, err := c.lsInternal(ctx, settings)
 	if err != nil {
 		return nil, 0, err
@@ -256,6 +359,38 @@ func (c *Client) LsBatchSync(ctx context.Context, opts ...LsOption) ([]PinStatus
 	return res, int(pinRes.Count), nil
 }
 
+// LsPage returns a single page of results, and a cursor to pass to
+// [pinLsOpts.Cursor] to get the next page with the same filters. The cursor is
+// empty when there are no more results. Unlike Ls, listing can be resumed
+// later, e.g. after a restart, by persisting the cursor.
+func (c *Client) LsPage(ctx context.Context, opts ...LsOption) ([]PinStatusGetter, string, error) {
+	settings, err := newLsSettings(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	res, count, err := c.lsBatch(ctx, settings)
+	if err != nil {
+		return nil, "", err
+	}
+	if count <= len(res) || len(res) == 0 {
+		return res, "", nil
+	}
+
+	// The next page starts with the pins created at the same time as the
+	// last one, which are not all on this page, except the ones already
+	// listed.
+	next := &lsCursor{Before: res[len(res)-1].GetCreated()}
+	if prev := settings.cursor; prev != nil && prev.Before.Equal(next.Before) {
+		next.Seen = prev.Seen
+	}
+	for _, r := range res {
+		if r.GetCreated().Equal(next.Before) {
+			next.Seen = append(next.Seen, r.GetRequestId())
+		}
+	}
+	return res, next.String(), nil
+}
+
 func (c *Client) lsInternal(ctx context.Context, settings *lsSettings) (pinResults, error) {
 	getter := c.client.PinsApi.PinsGet(ctx)
 	if len(settings.cids) > 0 {
@@ -268,16 +403,28 @@ func (c *Client) lsInternal(ctx context.Context, settings *lsSettings) (pinResul
 		}
 		getter = getter.Status(statuses)
 	}
-	if settings.limit == nil {
-		getter = getter.Limit(defaultLimit)
+	limit := int32(defaultLimit)
+	if settings.limit != nil {
+		limit = *settings.limit
+	}
+	before := settings.before
+	if cur := settings.cursor; cur != nil {
+		// Include the pins created at the time of the cursor, and ask for
+		// as many more pins as will be dropped for having been listed.
+		inclusive := cur.Before.Add(time.Nanosecond)
+		before = &inclusive
+		getter = getter.Limit(min(limit+int32(len(cur.Seen)), recordLimit))
 	} else {
-		getter = getter.Limit(*settings.limit)
+		getter = getter.Limit(limit)
 	}
 	if len(settings.name) > 0 {
 		getter = getter.Name(settings.name)
 	}
-	if settings.before != nil {
-		getter = getter.Before(*settings.before)
+	if settings.match != "" {
+		getter = getter.Match(openapi.TextMatchingStrategy(settings.match))
+	}
+	if before != nil {
+		getter = getter.Before(*before)
 	}
 	if settings.after != nil {
 		getter = getter.After(*settings.after)
@@ -292,6 +439,9 @@ func (c *Client) lsInternal(ctx context.Context, settings *lsSettings) (pinResul
 		return pinResults{}, httperr(httpresp, err)
 	}
 
+	if settings.cursor != nil {
+		results = settings.cursor.skipSeen(results, int(limit))
+	}
 	return results, nil
 }
 
@@ -0,0 +1,58 @@
+package go_pinning_service_http_client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/ipfs/boxo/pinning/remote/client/openapi"
+)
+
+// lsCursor is the position of [Client.LsPage] in a listing. Pins are listed
+// from the latest to the oldest, and several pins can be created at the same
+// time, so the cursor holds the creation time of the last pin listed, and the
+// request IDs of the pins created at that time that were already listed.
+type lsCursor struct {
+	Before time.Time `json:"before"`
+	Seen   []string  `json:"seen,omitempty"`
+}
+
+func parseLsCursor(s string) (*lsCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := new(lsCursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *lsCursor) String() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		// Cannot happen, the cursor only holds a time and strings.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// skipSeen removes the pins already listed from results, and keeps at most
+// limit pins.
+func (c *lsCursor) skipSeen(results openapi.PinResults, limit int) openapi.PinResults {
+	pins := make([]openapi.PinStatus, 0, len(results.Results))
+	for _, p := range results.Results {
+		if slices.Contains(c.Seen, p.Requestid) {
+			results.Count--
+			continue
+		}
+		pins = append(pins, p)
+	}
+	if len(pins) > limit {
+		pins = pins[:limit]
+	}
+	results.Results = pins
+	return results
+}
@@ -0,0 +1,100 @@
+package go_pinning_service_http_client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/pinning/remote/client/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+// lsServer lists its pins, sorted from the latest to the oldest, filtered by
+// the before and limit query parameters.
+type lsServer struct {
+	pins []openapi.PinStatus
+}
+
+func (s *lsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var before time.Time
+	if v := q.Get("before"); v != "" {
+		if before, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res := openapi.PinResults{Results: []openapi.PinStatus{}}
+	for _, p := range s.pins {
+		if !before.IsZero() && !p.Created.Before(before) {
+			continue
+		}
+		res.Count++
+		if len(res.Results) < limit {
+			res.Results = append(res.Results, p)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func TestLsPage(t *testing.T) {
+	t.Parallel()
+
+	// Pins created at the same time span several pages.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	srv := &lsServer{}
+	var all []string
+	for i, created := range []time.Duration{0, 0, 0, 0, 0, -1, -1, -2, -3, -3, -3} {
+		id := "request-" + strconv.Itoa(i)
+		srv.pins = append(srv.pins, *openapi.NewPinStatus(id, openapi.PINNED, now.Add(created*time.Second), *openapi.NewPin(testCid.String()), []string{}))
+		all = append(all, id)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := NewClient(ts.URL, "token")
+
+	var (
+		listed []string
+		cursor string
+	)
+	for {
+		opts := []LsOption{PinOpts.Limit(2)}
+		if cursor != "" {
+			opts = append(opts, PinOpts.Cursor(cursor))
+		}
+		res, next, err := c.LsPage(context.Background(), opts...)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res), 2)
+		for _, r := range res {
+			listed = append(listed, r.GetRequestId())
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	require.Equal(t, all, listed)
+}
+
+func TestLsCursorWithBefore(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient("http://127.0.0.1:0", "token")
+	cursor := (&lsCursor{Before: time.Now()}).String()
+	_, _, err := c.LsPage(context.Background(), PinOpts.FilterBefore(time.Now()), PinOpts.Cursor(cursor))
+	require.ErrorContains(t, err, "cursor cannot be used with FilterBefore")
+
+	_, _, err = c.LsPage(context.Background(), PinOpts.Cursor("not a cursor"))
+	require.ErrorContains(t, err, "invalid cursor")
+}
@@ -88,6 +88,16 @@ func (s Status) String() string {
 
 var validStatuses = []Status{"queued", "pinning", "pinned", "failed"}
 
+// NameMatch is the text matching strategy used when filtering pins by name.
+type NameMatch string
+
+const (
+	NameMatchExact    NameMatch = NameMatch(openapi.EXACT)
+	NameMatchIExact   NameMatch = NameMatch(openapi.IEXACT)
+	NameMatchPartial  NameMatch = NameMatch(openapi.PARTIAL)
+	NameMatchIPartial NameMatch = NameMatch(openapi.IPARTIAL)
+)
+
 // PinStatusGetter Getter for Pin object with status
 type PinStatusGetter interface {
 	fmt.Stringer
@@ -31,6 +31,7 @@ type apiPinsGetRequest struct {
 	apiService *PinsApiService
 	cid        *[]string
 	name       *string
+	match      *TextMatchingStrategy
 	status     *[]Status
 	before     *time.Time
 	after      *time.Time
@@ -48,6 +49,11 @@ func (r apiPinsGetRequest) Name(name string) apiPinsGetRequest {
 	return r
 }
 
+func (r apiPinsGetRequest) Match(match TextMatchingStrategy) apiPinsGetRequest {
+	r.match = &match
+	return r
+}
+
 func (r apiPinsGetRequest) Status(status []Status) apiPinsGetRequest {
 	r.status = &status
 	return r
@@ -119,6 +125,9 @@ func (r apiPinsGetRequest) Execute() (PinResults, *_nethttp.Response, error) {
 	if r.name != nil {
 		localVarQueryParams.Add("name", parameterToString(*r.name, ""))
 	}
+	if r.match != nil {
+		localVarQueryParams.Add("match", parameterToString(*r.match, ""))
+	}
 	if r.status != nil {
 		localVarQueryParams.Add("status", parameterToString(*r.status, "csv"))
 	}
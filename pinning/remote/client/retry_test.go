@@ -0,0 +1,188 @@
+package go_pinning_service_http_client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/pinning/remote/client/openapi"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+var testCid = cid.MustParse("bafkqaaa")
+
+// writePinStatus answers a pin request with a queued pin status.
+func writePinStatus(w http.ResponseWriter, r *http.Request) {
+	var pin openapi.Pin
+	if err := json.NewDecoder(r.Body).Decode(&pin); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(openapi.NewPinStatus("request-"+pin.Cid, openapi.QUEUED, time.Now(), pin, []string{}))
+}
+
+// retryServer answers the pin requests with the statuses in order, then with
+// a pin status, and records the Idempotency-Key of each attempt.
+type retryServer struct {
+	statuses   []int
+	retryAfter string
+
+	lk   sync.Mutex
+	keys []string
+}
+
+func (s *retryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	attempt := len(s.keys)
+	s.keys = append(s.keys, r.Header.Get(idempotencyKeyHeader))
+	s.lk.Unlock()
+
+	if attempt < len(s.statuses) {
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		http.Error(w, http.StatusText(s.statuses[attempt]), s.statuses[attempt])
+		return
+	}
+	writePinStatus(w, r)
+}
+
+func (s *retryServer) attempts() []string {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.keys
+}
+
+func TestRetries(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Transient errors are retried with the same Idempotency-Key", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &retryServer{statuses: []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}}
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		c := NewClient(ts.URL, "token", WithRetries(5, time.Millisecond))
+		ps, err := c.Add(context.Background(), testCid)
+		require.NoError(t, err)
+		require.Equal(t, "request-"+testCid.String(), ps.GetRequestId())
+
+		keys := srv.attempts()
+		require.Len(t, keys, 6)
+		require.NotEmpty(t, keys[0])
+		for _, key := range keys {
+			require.Equal(t, keys[0], key)
+		}
+	})
+
+	t.Run("Network errors are retried", func(t *testing.T) {
+		t.Parallel()
+
+		var dropped atomic.Bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if dropped.CompareAndSwap(false, true) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			writePinStatus(w, r)
+		}))
+		defer ts.Close()
+
+		c := NewClient(ts.URL, "token", WithRetries(1, time.Millisecond))
+		_, err := c.Add(context.Background(), testCid)
+		require.NoError(t, err)
+		require.True(t, dropped.Load())
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		t.Parallel()
+
+		for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict} {
+			srv := &retryServer{statuses: []int{status}}
+			ts := httptest.NewServer(srv)
+
+			c := NewClient(ts.URL, "token", WithRetries(3, time.Millisecond))
+			_, err := c.Add(context.Background(), testCid)
+			require.ErrorContains(t, err, "http error "+strconv.Itoa(status))
+			require.Len(t, srv.attempts(), 1, status)
+			ts.Close()
+		}
+	})
+
+	t.Run("Retries are limited", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &retryServer{statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		c := NewClient(ts.URL, "token", WithRetries(2, time.Millisecond))
+		_, err := c.Add(context.Background(), testCid)
+		require.ErrorContains(t, err, "http error 503")
+		require.Len(t, srv.attempts(), 3)
+	})
+
+	t.Run("Retry-After is honoured", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &retryServer{statuses: []int{http.StatusTooManyRequests}, retryAfter: "1"}
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		c := NewClient(ts.URL, "token", WithRetries(1, time.Millisecond))
+		start := time.Now()
+		_, err := c.Add(context.Background(), testCid)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Retries stop with the context", func(t *testing.T) {
+		t.Parallel()
+
+		srv := &retryServer{statuses: []int{http.StatusServiceUnavailable}, retryAfter: "60"}
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		c := NewClient(ts.URL, "token", WithRetries(1, time.Millisecond))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := c.Add(ctx, testCid)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Len(t, srv.attempts(), 1)
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	rt := &retryTransport{minBackoff: time.Second}
+	withRetryAfter := func(v string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {v}}}
+	}
+
+	// Exponential, and capped without overflowing.
+	require.Equal(t, time.Second, rt.backoff(0, nil))
+	require.Equal(t, 2*time.Second, rt.backoff(1, nil))
+	require.Equal(t, 32*time.Second, rt.backoff(5, nil))
+	require.Equal(t, maxRetryBackoff, rt.backoff(6, nil))
+	require.Equal(t, maxRetryBackoff, rt.backoff(1000, nil))
+
+	// Retry-After replaces the exponential backoff, and is capped too.
+	require.Equal(t, 5*time.Second, rt.backoff(3, withRetryAfter("5")))
+	require.Equal(t, time.Duration(0), rt.backoff(3, withRetryAfter("0")))
+	require.Equal(t, maxRetryBackoff, rt.backoff(0, withRetryAfter("3600")))
+	require.Equal(t, maxRetryBackoff, rt.backoff(0, withRetryAfter("99999999999999999999")))
+	require.Equal(t, 8*time.Second, rt.backoff(3, withRetryAfter("soon")))
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"errors"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	blocks "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/go-cid"
+)
+
+// demandQueueSize is the number of demand signals waiting to be processed
+// before new ones are dropped.
+const demandQueueSize = 1024
+
+// DemandSignaler is implemented by the provider systems which prioritize the
+// announcement of the content in demand, see [ProvideAhead]. Components
+// serving content, like the gateway or the bitswap server, can signal it
+// which content is requested from this node.
+type DemandSignaler interface {
+	// Demanded signals that c is being requested from this node. It must not
+	// block.
+	Demanded(c cid.Cid)
+}
+
+var _ DemandSignaler = (*reprovider)(nil)
+
+// ProvideAhead enables the tracking of the demand signaled with
+// [DemandSignaler.Demanded], for the size most recently demanded CIDs. These
+// are announced right away if they were not announced for interval, instead
+// of waiting for the next reprovide, and are announced first when
+// reproviding, before the CIDs of the [KeyProvider]. Only the CIDs found in
+// bs, the local blockstore, are announced.
+func ProvideAhead(bs blocks.Blockstore, size int, interval time.Duration) Option {
+	return func(system *reprovider) error {
+		if bs == nil {
+			return errors.New("provide-ahead requires a blockstore")
+		}
+		if size <= 0 {
+			return errors.New("provide-ahead size must be positive")
+		}
+		demand, err := lru.New[cid.Cid, time.Time](size)
+		if err != nil {
+			return err
+		}
+		system.demand = demand
+		system.demandBlockstore = bs
+		system.demandInterval = interval
+		system.demandCh = make(chan cid.Cid, demandQueueSize)
+		return nil
+	}
+}
+
+// Demanded implements [DemandSignaler]. It does nothing without
+// [ProvideAhead].
+func (s *reprovider) Demanded(c cid.Cid) {
+	if s.demandCh == nil {
+		return
+	}
+	select {
+	case s.demandCh <- c:
+	default:
+		log.Debugf("dropping demand signal for %s: too many pending", c)
+	}
+}
+
+// runProvideAhead announces the demanded CIDs until the system is closed.
+func (s *reprovider) runProvideAhead() {
+	for {
+		select {
+		case c := <-s.demandCh:
+			if last, ok := s.demand.Get(c); ok && time.Since(last) < s.demandInterval {
+				continue
+			}
+			if !s.hasDemanded(c) {
+				continue
+			}
+			s.demand.Add(c, time.Now())
+			if err := s.q.Enqueue(c); err != nil {
+				log.Debugf("could not provide ahead %s: %s", c, err)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// hasDemanded returns whether the demanded CID c is in the local blockstore.
+func (s *reprovider) hasDemanded(c cid.Cid) bool {
+	has, err := s.demandBlockstore.Has(s.ctx, c)
+	if err != nil {
+		log.Debugf("could not check whether %s is local: %s", c, err)
+		return false
+	}
+	return has
+}
+
+// demandedKeys returns the demanded CIDs that are still in the local
+// blockstore, most recently demanded first, and marks them as announced.
+func (s *reprovider) demandedKeys() []cid.Cid {
+	if s.demand == nil {
+		return nil
+	}
+
+	// Keys are the least recently demanded first, so updating them in that
+	// order keeps it.
+	keys := s.demand.Keys()
+	now := time.Now()
+	local := keys[:0]
+	for _, c := range keys {
+		if !s.hasDemanded(c) {
+			s.demand.Remove(c)
+			continue
+		}
+		s.demand.Add(c, now)
+		local = append(local, c)
+	}
+	keys = local
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	cid "github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
@@ -31,6 +32,8 @@ type Queue struct {
 	closed  sync.WaitGroup
 
 	counter uint64
+	// number of CIDs in the datastore
+	size atomic.Int64
 }
 
 // NewQueue creates a queue for cids
@@ -69,6 +72,11 @@ func (q *Queue) Enqueue(cid cid.Cid) error {
 	}
 }
 
+// Len returns the number of CIDs in the queue.
+func (q *Queue) Len() int {
+	return int(q.size.Load())
+}
+
 // Dequeue returns a channel that if listened to will remove entries from the queue
 func (q *Queue) Dequeue() <-chan cid.Cid {
 	return q.dequeue
@@ -82,6 +90,10 @@ func (q *Queue) worker() {
 	defer q.closed.Done()
 	defer q.close()
 
+	if err := q.countEntries(); err != nil {
+		log.Errorf("error counting the entries of the queue: %s", err)
+	}
+
 	for {
 		if c == cid.Undef {
 			head, err := q.getQueueHead()
@@ -100,6 +112,7 @@ func (q *Queue) worker() {
 						log.Errorf("error deleting queue entry with key (%s), due to error (%s), stopping provider", head.Key, err)
 						return
 					}
+					q.size.Add(-1)
 					continue
 				}
 			default:
@@ -129,12 +142,14 @@ func (q *Queue) worker() {
 				log.Errorf("Failed to enqueue cid: %s", err)
 				continue
 			}
+			q.size.Add(1)
 		case dequeue <- c:
 			err := q.ds.Delete(q.ctx, k)
 			if err != nil {
 				log.Errorf("Failed to delete queued cid %s with key %s: %s", c, k, err)
 				continue
 			}
+			q.size.Add(-1)
 			c = cid.Undef
 		case <-q.ctx.Done():
 			return
@@ -142,6 +157,24 @@ func (q *Queue) worker() {
 	}
 }
 
+// countEntries counts the CIDs left in the datastore by a previous run.
+func (q *Queue) countEntries() error {
+	results, err := q.ds.Query(q.ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	var n int64
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		n++
+	}
+	q.size.Add(n)
+	return nil
+}
+
 func (q *Queue) getQueueHead() (*query.Entry, error) {
 	qry := query.Query{Orders: []query.Order{query.OrderByKey{}}, Limit: 1}
 	results, err := q.ds.Query(q.ctx, qry)
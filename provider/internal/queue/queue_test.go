@@ -10,6 +10,7 @@ import (
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/sync"
 	"github.com/ipfs/go-test/random"
+	"github.com/stretchr/testify/require"
 )
 
 const blockSize = 4
@@ -125,3 +126,21 @@ func TestInitializationWithManyCids(t *testing.T) {
 
 	assertOrdered(cids, queue, t)
 }
+
+func TestLen(t *testing.T) {
+	ds := sync.MutexWrap(datastore.NewMapDatastore())
+	queue := NewQueue(ds)
+
+	cids := makeCids(10)
+	for _, c := range cids {
+		queue.Enqueue(c)
+	}
+	assertOrdered(cids[:3], queue, t)
+	require.Eventually(t, func() bool { return queue.Len() == 7 }, time.Second, time.Millisecond)
+	queue.Close()
+
+	// The entries left by a previous run are counted.
+	queue = NewQueue(ds)
+	defer queue.Close()
+	require.Eventually(t, func() bool { return queue.Len() == 7 }, time.Second, time.Millisecond)
+}
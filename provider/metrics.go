@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsCollector exports the [ReproviderStats] of a [System] to Prometheus.
+type statsCollector struct {
+	sys System
+
+	queueSize             *prometheus.Desc
+	provides              *prometheus.Desc
+	failures              *prometheus.Desc
+	provideDuration       *prometheus.Desc
+	provideRate           *prometheus.Desc
+	lastReprovideDuration *prometheus.Desc
+	reprovideInProgress   *prometheus.Desc
+	reprovideETA          *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*statsCollector)(nil)
+
+// NewStatsCollector returns a Prometheus collector of the stats of sys, read
+// with [System.Stat] when collected, to be registered by the caller:
+//
+//   - ipfs_provider_queue_size: the number of CIDs waiting to be announced.
+//   - ipfs_provider_provides_total: the number of CIDs announced.
+//   - ipfs_provider_provide_failures_total: the number of CIDs whose
+//     announcement failed, by type of error.
+//   - ipfs_provider_provide_duration_seconds: the average time to announce a
+//     CID.
+//   - ipfs_provider_provide_rate: the number of CIDs announced per second.
+//   - ipfs_provider_last_reprovide_duration_seconds: the time taken by the
+//     last reprovide batch.
+//   - ipfs_provider_reprovide_in_progress: 1 while reproviding.
+//   - ipfs_provider_reprovide_eta_seconds: the estimated time left to
+//     complete the reprovide in progress.
+func NewStatsCollector(sys System) prometheus.Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("ipfs", "provider", name), help, labels, nil)
+	}
+	return &statsCollector{
+		sys:                   sys,
+		queueSize:             desc("queue_size", "Number of CIDs waiting to be announced."),
+		provides:              desc("provides_total", "Number of CIDs announced."),
+		failures:              desc("provide_failures_total", "Number of CIDs whose announcement failed, by type of error.", "error"),
+		provideDuration:       desc("provide_duration_seconds", "Average time to announce a CID."),
+		provideRate:           desc("provide_rate", "Moving average of the number of CIDs announced per second."),
+		lastReprovideDuration: desc("last_reprovide_duration_seconds", "Time taken by the last reprovide batch."),
+		reprovideInProgress:   desc("reprovide_in_progress", "Whether a reprovide is in progress."),
+		reprovideETA:          desc("reprovide_eta_seconds", "Estimated time left to complete the reprovide in progress."),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueSize
+	ch <- c.provides
+	ch <- c.failures
+	ch <- c.provideDuration
+	ch <- c.provideRate
+	ch <- c.lastReprovideDuration
+	ch <- c.reprovideInProgress
+	ch <- c.reprovideETA
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.sys.Stat()
+	if err != nil {
+		log.Errorf("could not collect the provider stats: %s", err)
+		return
+	}
+
+	inProgress := 0.0
+	if !stats.ReprovideStarted.IsZero() {
+		inProgress = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.queueSize, prometheus.GaugeValue, float64(stats.QueueSize))
+	ch <- prometheus.MustNewConstMetric(c.provides, prometheus.CounterValue, float64(stats.TotalProvides))
+	for typ, n := range stats.Failures {
+		ch <- prometheus.MustNewConstMetric(c.failures, prometheus.CounterValue, float64(n), typ)
+	}
+	ch <- prometheus.MustNewConstMetric(c.provideDuration, prometheus.GaugeValue, stats.AvgProvideDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.provideRate, prometheus.GaugeValue, stats.ProvideRate)
+	ch <- prometheus.MustNewConstMetric(c.lastReprovideDuration, prometheus.GaugeValue, stats.LastReprovideDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.reprovideInProgress, prometheus.GaugeValue, inProgress)
+	ch <- prometheus.MustNewConstMetric(c.reprovideETA, prometheus.GaugeValue, stats.ReprovideETA.Seconds())
+}
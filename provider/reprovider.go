@@ -7,8 +7,11 @@ import (
 	"math"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
+	blocks "github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/boxo/provider/internal/queue"
 	"github.com/ipfs/boxo/verifcid"
 	"github.com/ipfs/go-cid"
@@ -34,6 +37,10 @@ const (
 	// MAGIC: how long we are willing to collect providers for the batch after
 	// we receive the first one
 	maxCollectionDuration = time.Minute * 10
+
+	// provideRateWeight is the weight of the last batch in the moving
+	// average of the provide rate.
+	provideRateWeight = 0.25
 )
 
 var log = logging.Logger("provider.batched")
@@ -62,6 +69,15 @@ type reprovider struct {
 	statLk                                    sync.Mutex
 	totalProvides, lastReprovideBatchSize     uint64
 	avgProvideDuration, lastReprovideDuration time.Duration
+	provideRate                               float64
+	failedProvides                            uint64
+	failures                                  map[string]uint64
+	// start of the reprovide in progress, and number of CIDs sent by the
+	// last complete one
+	reprovideStarted   time.Time
+	lastReprovideCount uint64
+	// number of CIDs sent by the reprovide in progress
+	reprovideSent atomic.Uint64
 
 	throughputCallback ThroughputCallback
 	// throughputProvideCurrentCount counts how many provides has been done since the last call to throughputCallback
@@ -71,6 +87,12 @@ type reprovider struct {
 	throughputMinimumProvides uint
 
 	keyPrefix datastore.Key
+
+	// demanded CIDs and when they were last announced, nil without ProvideAhead
+	demand           *lru.Cache[cid.Cid, time.Time]
+	demandInterval   time.Duration
+	demandCh         chan cid.Cid
+	demandBlockstore blocks.Blockstore
 }
 
 var _ System = (*reprovider)(nil)
@@ -111,6 +133,7 @@ func New(ds datastore.Batching, opts ...Option) (System, error) {
 		keyPrefix:             DefaultKeyPrefix,
 		reprovideCh:           make(chan cid.Cid),
 		noReprovideInFlight:   make(chan struct{}),
+		failures:              make(map[string]uint64),
 	}
 
 	for _, o := range opts {
@@ -347,6 +370,10 @@ func (s *reprovider) run() {
 			err := doProvideMany(s.ctx, s.rsys, keys)
 			if err != nil {
 				log.Debugf("providing failed %v", err)
+				s.statLk.Lock()
+				s.failedProvides += uint64(len(keys))
+				s.failures[ProvideErrorType(err)] += uint64(len(keys))
+				s.statLk.Unlock()
 				continue
 			}
 			dur := time.Since(start)
@@ -357,6 +384,14 @@ func (s *reprovider) run() {
 			s.statLk.Lock()
 			s.avgProvideDuration = time.Duration((totalProvideTime + dur) / (time.Duration(s.totalProvides) + time.Duration(len(keys))))
 			s.totalProvides += uint64(len(keys))
+			if dur > 0 {
+				rate := float64(len(keys)) / dur.Seconds()
+				if s.provideRate == 0 {
+					s.provideRate = rate
+				} else {
+					s.provideRate = provideRateWeight*rate + (1-provideRateWeight)*s.provideRate
+				}
+			}
 
 			log.Debugf("finished providing of %d keys. It took %v with an average of %v per provide", len(keys), dur, recentAvgProvideDuration)
 
@@ -390,6 +425,14 @@ func (s *reprovider) run() {
 		}
 	}()
 
+	if s.demand != nil {
+		s.closewg.Add(1)
+		go func() {
+			defer s.closewg.Done()
+			s.runProvideAhead()
+		}()
+	}
+
 	s.closewg.Add(1)
 	go func() {
 		defer s.closewg.Done()
@@ -473,6 +516,32 @@ func (s *reprovider) reprovide(ctx context.Context, force bool) error {
 		return err
 	}
 
+	s.statLk.Lock()
+	s.reprovideStarted = time.Now()
+	s.statLk.Unlock()
+	s.reprovideSent.Store(0)
+	complete := false
+	defer func() {
+		s.statLk.Lock()
+		s.reprovideStarted = time.Time{}
+		if complete {
+			s.lastReprovideCount = s.reprovideSent.Load()
+		}
+		s.statLk.Unlock()
+	}()
+
+	// Announce the content in demand first.
+	for _, c := range s.demandedKeys() {
+		select {
+		case s.reprovideCh <- c:
+			s.reprovideSent.Add(1)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.ctx.Done():
+			return errors.New("failed to reprovide: shutting down")
+		}
+	}
+
 reprovideCidLoop:
 	for {
 		select {
@@ -483,6 +552,7 @@ reprovideCidLoop:
 
 			select {
 			case s.reprovideCh <- c:
+				s.reprovideSent.Add(1)
 			case <-ctx.Done():
 				return ctx.Err()
 			case <-s.ctx.Done():
@@ -498,6 +568,7 @@ reprovideCidLoop:
 	// Wait until the underlying operation has completed
 	select {
 	case <-s.noReprovideInFlight:
+		complete = true
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -539,18 +610,72 @@ func (s *reprovider) shouldReprovide() bool {
 type ReproviderStats struct {
 	TotalProvides, LastReprovideBatchSize     uint64
 	AvgProvideDuration, LastReprovideDuration time.Duration
+
+	// QueueSize is the number of CIDs waiting in the provide queue.
+	QueueSize uint64
+	// ProvideRate is the moving average of the number of CIDs announced per
+	// second, while announcing.
+	ProvideRate float64
+	// FailedProvides is the number of CIDs whose announcement failed, and
+	// Failures breaks it down by type of error, see [ProvideErrorType].
+	FailedProvides uint64
+	Failures       map[string]uint64
+
+	// ReprovideStarted is when the reprovide in progress started, or zero
+	// if none is. ReprovideSent is the number of CIDs sent to be announced
+	// by it so far.
+	ReprovideStarted time.Time
+	ReprovideSent    uint64
+	// ReprovideETA estimates the time left to complete the reprovide in
+	// progress, from the number of CIDs of the previous one and the average
+	// provide duration. It is zero when unknown.
+	ReprovideETA time.Duration
 }
 
 // Stat returns various stats about this provider system
 func (s *reprovider) Stat() (ReproviderStats, error) {
 	s.statLk.Lock()
 	defer s.statLk.Unlock()
-	return ReproviderStats{
+	stats := ReproviderStats{
 		TotalProvides:          s.totalProvides,
 		LastReprovideBatchSize: s.lastReprovideBatchSize,
 		AvgProvideDuration:     s.avgProvideDuration,
 		LastReprovideDuration:  s.lastReprovideDuration,
-	}, nil
+		QueueSize:              uint64(s.q.Len()),
+		ProvideRate:            s.provideRate,
+		FailedProvides:         s.failedProvides,
+		Failures:               make(map[string]uint64, len(s.failures)),
+		ReprovideStarted:       s.reprovideStarted,
+	}
+	for typ, n := range s.failures {
+		stats.Failures[typ] = n
+	}
+	if !s.reprovideStarted.IsZero() {
+		stats.ReprovideSent = s.reprovideSent.Load()
+		if s.lastReprovideCount > stats.ReprovideSent {
+			stats.ReprovideETA = time.Duration(s.lastReprovideCount-stats.ReprovideSent) * s.avgProvideDuration
+		}
+	}
+	return stats, nil
+}
+
+// ProvideErrorType returns the type of a provide error reported in
+// [ReproviderStats.Failures]: "timeout" and "canceled" for the context
+// errors, and otherwise the Go type of the innermost wrapped error.
+func ProvideErrorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = inner
+	}
 }
 
 func doProvideMany(ctx context.Context, r Provide, keys []multihash.Multihash) error {
@@ -4,17 +4,21 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"fmt"
 	"runtime"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/boxo/internal/test"
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	mh "github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -313,3 +317,139 @@ func TestNewPrioritizedProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestProvideAhead(t *testing.T) {
+	t.Parallel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	cids := make([]cid.Cid, 5)
+	for i := range cids {
+		b := make([]byte, 32)
+		_, _ = rand.Read(b)
+		blk := blocks.NewBlock(b)
+		if i < 4 {
+			require.NoError(t, bs.Put(context.Background(), blk))
+		}
+		cids[i] = blk.Cid()
+	}
+	hot, cold, missing := cids[:3], cids[3], cids[4]
+
+	prov := &mockProvideMany{}
+	keyProvider := func(ctx context.Context) (<-chan cid.Cid, error) {
+		ch := make(chan cid.Cid, 1)
+		ch <- cold
+		close(ch)
+		return ch, nil
+	}
+	sys, err := New(dssync.MutexWrap(datastore.NewMapDatastore()),
+		Online(prov),
+		KeyProvider(keyProvider),
+		ReproviderInterval(0),
+		MaxBatchSize(1),
+		ProvideAhead(bs, 2, time.Hour),
+	)
+	require.NoError(t, err)
+	defer sys.Close()
+	ds := sys.(DemandSignaler)
+
+	waitKeys := func(expected ...cid.Cid) {
+		t.Helper()
+		var hashes []mh.Multihash
+		for _, c := range expected {
+			hashes = append(hashes, c.Hash())
+		}
+		require.EventuallyWithT(t, func(t *assert.CollectT) {
+			keys, _ := prov.GetKeys()
+			assert.Equal(t, hashes, keys)
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+
+	// Demanded CIDs are announced ahead, once per interval, unless they are
+	// not local.
+	ds.Demanded(missing)
+	ds.Demanded(hot[0])
+	waitKeys(hot[0])
+	ds.Demanded(hot[0])
+	ds.Demanded(hot[1])
+	waitKeys(hot[0], hot[1])
+	ds.Demanded(hot[2])
+	waitKeys(hot[0], hot[1], hot[2])
+
+	// Reproviding announces the most recently demanded CIDs first.
+	require.NoError(t, sys.Reprovide(context.Background()))
+	waitKeys(hot[0], hot[1], hot[2], hot[2], hot[1], cold)
+}
+
+type failingProvideMany struct {
+	mockProvideMany
+	err error
+}
+
+func (m *failingProvideMany) ProvideMany(ctx context.Context, keys []mh.Multihash) error {
+	m.lk.Lock()
+	err := m.err
+	m.lk.Unlock()
+	if err != nil {
+		return err
+	}
+	return m.mockProvideMany.ProvideMany(ctx, keys)
+}
+
+func TestStats(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	// Enqueue CIDs with an offline system.
+	sys, err := New(ds)
+	require.NoError(t, err)
+	for _, c := range makeCIDs(5) {
+		require.NoError(t, sys.Provide(context.Background(), c, true))
+	}
+	require.Eventually(t, func() bool {
+		stats, err := sys.Stat()
+		return err == nil && stats.QueueSize == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sys.Close())
+
+	// Fail to announce them.
+	prov := &failingProvideMany{err: fmt.Errorf("put: %w", context.DeadlineExceeded)}
+	keys := makeCIDs(10)
+	sys, err = New(ds, Online(prov), KeyProvider(newMockKeyChanFunc(keys)))
+	require.NoError(t, err)
+	defer sys.Close()
+
+	var stats ReproviderStats
+	require.Eventually(t, func() bool {
+		stats, err = sys.Stat()
+		return err == nil && stats.FailedProvides == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, map[string]uint64{"timeout": 5}, stats.Failures)
+	require.Zero(t, stats.QueueSize)
+	require.Zero(t, stats.TotalProvides)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(NewStatsCollector(sys)))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var failures float64
+	for _, f := range families {
+		if f.GetName() == "ipfs_provider_provide_failures_total" {
+			require.Len(t, f.GetMetric(), 1)
+			require.Equal(t, "timeout", f.GetMetric()[0].GetLabel()[0].GetValue())
+			failures = f.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	require.Equal(t, 5.0, failures)
+
+	// Reprovide successfully.
+	prov.lk.Lock()
+	prov.err = nil
+	prov.lk.Unlock()
+	require.NoError(t, sys.Reprovide(context.Background()))
+	require.Eventually(t, func() bool {
+		stats, err = sys.Stat()
+		return err == nil && stats.TotalProvides == uint64(len(keys))
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Positive(t, stats.ProvideRate)
+	require.True(t, stats.ReprovideStarted.IsZero())
+	require.Zero(t, stats.ReprovideETA)
+}
@@ -0,0 +1,330 @@
+// Package composer builds a [routing.Routing] out of several routing systems,
+// such as the DHT, delegated HTTP routers or static tables, with a policy for
+// each operation: which routers it is sent to, in parallel or one after the
+// other, and with which timeouts.
+//
+// For example, to find providers with the DHT and a delegated router in
+// parallel, giving the delegated router a head start, while only publishing
+// IPNS records with the DHT:
+//
+//	r, err := composer.New(
+//		composer.WithFindProviders(composer.Parallel(
+//			composer.Stage{Router: httpRouter, Timeout: 10 * time.Second, IgnoreErrors: true},
+//			composer.Stage{Router: dht, ExecuteAfter: 200 * time.Millisecond},
+//		)),
+//		composer.WithPutValue(composer.Sequential(composer.Stage{Router: dht})),
+//		composer.WithDefault(composer.Parallel(
+//			composer.Stage{Router: httpRouter, IgnoreErrors: true},
+//			composer.Stage{Router: dht},
+//		)),
+//	)
+package composer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	ci "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+)
+
+// Stage is a router that an operation is sent to.
+type Stage struct {
+	// Router the operation is sent to (required).
+	Router routing.Routing
+
+	// Timeout bounds the time spent by the operation in this router. Zero
+	// means no timeout.
+	Timeout time.Duration
+
+	// IgnoreErrors keeps the operation going when this router fails or times
+	// out, rather than failing it.
+	IgnoreErrors bool
+
+	// ExecuteAfter delays the start of the operation in this router, for
+	// example to give faster routers a head start. The Timeout starts after
+	// this delay. Only used by parallel policies.
+	ExecuteAfter time.Duration
+}
+
+// Policy is how an operation is sent to its stages.
+type Policy struct {
+	// Sequential sends the operation to one stage after the other, rather
+	// than to all of them at once. Lookups stop at the first stage with a
+	// result.
+	Sequential bool
+
+	// Stages the operation is sent to. An operation without stages is not
+	// supported: it fails, or finds nothing.
+	Stages []Stage
+}
+
+// Parallel returns the policy sending an operation to all the stages at
+// once, returning the first value found, or the providers found by all of
+// them.
+func Parallel(stages ...Stage) Policy {
+	return Policy{Stages: stages}
+}
+
+// Sequential returns the policy sending an operation to one stage after the
+// other, in order.
+func Sequential(stages ...Stage) Policy {
+	return Policy{Sequential: true, Stages: stages}
+}
+
+func (p Policy) validate() error {
+	for i, s := range p.Stages {
+		if s.Router == nil {
+			return fmt.Errorf("stage %d has no router", i)
+		}
+		if s.Timeout < 0 || s.ExecuteAfter < 0 {
+			return fmt.Errorf("stage %d has a negative duration", i)
+		}
+	}
+	return nil
+}
+
+func (p Policy) router() routing.Routing {
+	if len(p.Stages) == 0 {
+		return routinghelpers.Null{}
+	}
+
+	if p.Sequential {
+		routers := make([]*routinghelpers.SequentialRouter, len(p.Stages))
+		for i, s := range p.Stages {
+			routers[i] = &routinghelpers.SequentialRouter{
+				Router:      s.Router,
+				Timeout:     s.Timeout,
+				IgnoreError: s.IgnoreErrors,
+			}
+		}
+		return routinghelpers.NewComposableSequential(routers)
+	}
+
+	routers := make([]*routinghelpers.ParallelRouter, len(p.Stages))
+	for i, s := range p.Stages {
+		routers[i] = &routinghelpers.ParallelRouter{
+			Router:       s.Router,
+			Timeout:      s.Timeout,
+			IgnoreError:  s.IgnoreErrors,
+			ExecuteAfter: s.ExecuteAfter,
+		}
+	}
+	return routinghelpers.NewComposableParallel(routers)
+}
+
+type options struct {
+	defaultPolicy *Policy
+	findProviders *Policy
+	findPeer      *Policy
+	provide       *Policy
+	getValue      *Policy
+	putValue      *Policy
+}
+
+// Option configures the policies of a [Router].
+type Option func(*options)
+
+// WithDefault sets the policy of the operations without a policy of their
+// own. By default, these operations are not supported.
+func WithDefault(p Policy) Option {
+	return func(o *options) {
+		o.defaultPolicy = &p
+	}
+}
+
+// WithFindProviders sets the policy of FindProvidersAsync.
+func WithFindProviders(p Policy) Option {
+	return func(o *options) {
+		o.findProviders = &p
+	}
+}
+
+// WithFindPeer sets the policy of FindPeer.
+func WithFindPeer(p Policy) Option {
+	return func(o *options) {
+		o.findPeer = &p
+	}
+}
+
+// WithProvide sets the policy of Provide and ProvideMany.
+func WithProvide(p Policy) Option {
+	return func(o *options) {
+		o.provide = &p
+	}
+}
+
+// WithGetValue sets the policy of GetValue and SearchValue.
+func WithGetValue(p Policy) Option {
+	return func(o *options) {
+		o.getValue = &p
+	}
+}
+
+// WithPutValue sets the policy of PutValue.
+func WithPutValue(p Policy) Option {
+	return func(o *options) {
+		o.putValue = &p
+	}
+}
+
+// Router is a [routing.Routing] sending each operation to the stages of its
+// policy.
+type Router struct {
+	findProviders routing.Routing
+	findPeer      routing.Routing
+	provide       routing.Routing
+	getValue      routing.Routing
+	putValue      routing.Routing
+
+	// routers are the distinct routers of all the stages.
+	routers []routing.Routing
+}
+
+var (
+	_ routing.Routing                  = (*Router)(nil)
+	_ routinghelpers.ProvideManyRouter = (*Router)(nil)
+	_ routinghelpers.ReadyAbleRouter   = (*Router)(nil)
+	_ io.Closer                        = (*Router)(nil)
+)
+
+// New returns a [Router] with the given policies.
+func New(opts ...Option) (*Router, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := &Router{}
+	build := func(name string, p *Policy) (routing.Routing, error) {
+		if p == nil {
+			p = o.defaultPolicy
+		}
+		if p == nil {
+			return routinghelpers.Null{}, nil
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s policy: %w", name, err)
+		}
+		for _, s := range p.Stages {
+			r.addRouter(s.Router)
+		}
+		return p.router(), nil
+	}
+
+	var err error
+	if r.findProviders, err = build("find providers", o.findProviders); err != nil {
+		return nil, err
+	}
+	if r.findPeer, err = build("find peer", o.findPeer); err != nil {
+		return nil, err
+	}
+	if r.provide, err = build("provide", o.provide); err != nil {
+		return nil, err
+	}
+	if r.getValue, err = build("get value", o.getValue); err != nil {
+		return nil, err
+	}
+	if r.putValue, err = build("put value", o.putValue); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// addRouter adds router to the distinct routers of r. Routers that cannot be
+// compared, such as [routinghelpers.Parallel], are assumed to be distinct.
+func (r *Router) addRouter(router routing.Routing) {
+	if t := reflect.TypeOf(router); t.Comparable() {
+		for _, known := range r.routers {
+			if reflect.TypeOf(known) == t && known == router {
+				return
+			}
+		}
+	}
+	r.routers = append(r.routers, router)
+}
+
+func (r *Router) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	return r.findProviders.FindProvidersAsync(ctx, c, count)
+}
+
+func (r *Router) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	return r.findPeer.FindPeer(ctx, p)
+}
+
+func (r *Router) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	return r.provide.Provide(ctx, c, announce)
+}
+
+// ProvideMany provides keys with the routers of the provide policy, one key
+// at a time for the routers that cannot provide many at once.
+func (r *Router) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	if pm, ok := r.provide.(routinghelpers.ProvideManyRouter); ok {
+		return pm.ProvideMany(ctx, keys)
+	}
+	for _, k := range keys {
+		if err := r.provide.Provide(ctx, cid.NewCidV1(cid.Raw, k), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Router) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	return r.getValue.GetValue(ctx, key, opts...)
+}
+
+func (r *Router) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	return r.getValue.SearchValue(ctx, key, opts...)
+}
+
+func (r *Router) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	return r.putValue.PutValue(ctx, key, value, opts...)
+}
+
+// GetPublicKey uses the get value policy, see [routing.GetPublicKey].
+func (r *Router) GetPublicKey(ctx context.Context, p peer.ID) (ci.PubKey, error) {
+	return routing.GetPublicKey(r.getValue, ctx, p)
+}
+
+// Bootstrap bootstraps all the routers, once each.
+func (r *Router) Bootstrap(ctx context.Context) error {
+	var errs []error
+	for _, router := range r.routers {
+		if err := router.Bootstrap(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ready returns whether all the routers that can tell are ready.
+func (r *Router) Ready() bool {
+	for _, router := range r.routers {
+		if rr, ok := router.(routinghelpers.ReadyAbleRouter); ok && !rr.Ready() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes all the routers that can be closed, once each.
+func (r *Router) Close() error {
+	var errs []error
+	for _, router := range r.routers {
+		if c, ok := router.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,198 @@
+package composer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/core/test"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// testRouter stores values and provides a single provider. It waits for
+// delay, or for the context to be done, before answering.
+type testRouter struct {
+	routinghelpers.Null
+
+	delay    time.Duration
+	provider peer.AddrInfo
+
+	mu     sync.Mutex
+	values map[string][]byte
+
+	provided     atomic.Int32
+	bootstrapped atomic.Int32
+	closed       atomic.Int32
+}
+
+func newTestRouter(t *testing.T) *testRouter {
+	return &testRouter{
+		provider: peer.AddrInfo{ID: test.RandPeerIDFatal(t)},
+		values:   make(map[string][]byte),
+	}
+}
+
+func (r *testRouter) wait(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *testRouter) PutValue(ctx context.Context, key string, value []byte, _ ...routing.Option) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key] = value
+	return nil
+}
+
+func (r *testRouter) GetValue(ctx context.Context, key string, _ ...routing.Option) ([]byte, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.values[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return value, nil
+}
+
+func (r *testRouter) Provide(ctx context.Context, _ cid.Cid, _ bool) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	r.provided.Add(1)
+	return nil
+}
+
+func (r *testRouter) FindProvidersAsync(ctx context.Context, _ cid.Cid, _ int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo, 1)
+	go func() {
+		defer close(ch)
+		if r.wait(ctx) == nil {
+			ch <- r.provider
+		}
+	}()
+	return ch
+}
+
+func (r *testRouter) Bootstrap(context.Context) error {
+	r.bootstrapped.Add(1)
+	return nil
+}
+
+func (r *testRouter) Close() error {
+	r.closed.Add(1)
+	return nil
+}
+
+func testCid(t *testing.T) cid.Cid {
+	h, err := mh.Sum([]byte("composer"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTestRouter(t), newTestRouter(t)
+
+	r, err := New(
+		WithGetValue(Sequential(Stage{Router: a, IgnoreErrors: true}, Stage{Router: b})),
+		WithPutValue(Parallel(Stage{Router: b})),
+		WithFindProviders(Parallel(Stage{Router: a}, Stage{Router: b})),
+		WithProvide(Sequential(Stage{Router: a}, Stage{Router: b})),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, r.PutValue(ctx, "/key", []byte("value")))
+	_, err = a.GetValue(ctx, "/key")
+	require.ErrorIs(t, err, routing.ErrNotFound)
+	value, err := r.GetValue(ctx, "/key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+
+	var found []peer.ID
+	for p := range r.FindProvidersAsync(ctx, testCid(t), 0) {
+		found = append(found, p.ID)
+	}
+	require.ElementsMatch(t, []peer.ID{a.provider.ID, b.provider.ID}, found)
+
+	require.NoError(t, r.Provide(ctx, testCid(t), true))
+	require.NoError(t, r.ProvideMany(ctx, []mh.Multihash{testCid(t).Hash(), testCid(t).Hash()}))
+	require.Equal(t, int32(3), a.provided.Load())
+	require.Equal(t, int32(3), b.provided.Load())
+
+	// No policy, and no default policy.
+	_, err = r.FindPeer(ctx, a.provider.ID)
+	require.Error(t, err)
+	r, err = New()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.PutValue(ctx, "/key", nil), routing.ErrNotSupported)
+}
+
+func TestStageTimeout(t *testing.T) {
+	ctx := context.Background()
+	slow, fast := newTestRouter(t), newTestRouter(t)
+	slow.delay = time.Minute
+	require.NoError(t, fast.PutValue(ctx, "/key", []byte("value")))
+
+	r, err := New(WithDefault(Sequential(
+		Stage{Router: slow, Timeout: 10 * time.Millisecond, IgnoreErrors: true},
+		Stage{Router: fast},
+	)))
+	require.NoError(t, err)
+
+	start := time.Now()
+	value, err := r.GetValue(ctx, "/key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	// Without IgnoreErrors, the timeout fails the operation.
+	r, err = New(WithDefault(Sequential(Stage{Router: slow, Timeout: 10 * time.Millisecond}, Stage{Router: fast})))
+	require.NoError(t, err)
+	_, err = r.GetValue(ctx, "/key")
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+}
+
+func TestDistinctRouters(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTestRouter(t), newTestRouter(t)
+
+	r, err := New(
+		WithDefault(Parallel(Stage{Router: a})),
+		WithGetValue(Parallel(Stage{Router: a}, Stage{Router: b})),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Bootstrap(ctx))
+	require.NoError(t, r.Close())
+	for _, router := range []*testRouter{a, b} {
+		require.Equal(t, int32(1), router.bootstrapped.Load())
+		require.Equal(t, int32(1), router.closed.Load())
+	}
+	require.True(t, r.Ready())
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	_, err := New(WithFindPeer(Parallel(Stage{})))
+	require.Error(t, err)
+
+	_, err = New(WithDefault(Sequential(Stage{Router: routinghelpers.Null{}, Timeout: -time.Second})))
+	require.Error(t, err)
+}
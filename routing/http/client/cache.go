@@ -0,0 +1,275 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-clock"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+const (
+	// maxCachedBodySize is the size of the largest response body that is
+	// cached.
+	maxCachedBodySize = 1 << 20
+
+	// revalidateTimeout bounds the background requests revalidating stale
+	// responses.
+	revalidateTimeout = time.Minute
+)
+
+// WithCache caches the responses of the lookups (FindProviders, FindPeers and
+// GetIPNS) in memory, up to size responses, for as long as their
+// Cache-Control header allows it. Once a response is stale, it is still
+// returned for the stale-while-revalidate duration of its Cache-Control
+// header, while a fresh one is fetched in the background, and for the
+// stale-if-error duration when the server cannot be reached or fails.
+func WithCache(size int) Option {
+	return func(c *Client) error {
+		if size <= 0 {
+			return errors.New("cache size must be positive")
+		}
+		c.cacheSize = size
+		return nil
+	}
+}
+
+// cachingHTTPClient is an httpClient caching the responses to GET requests.
+type cachingHTTPClient struct {
+	inner httpClient
+	clock clock.Clock
+	cache *lru.Cache[string, *cachedResponse]
+
+	mu           sync.Mutex
+	revalidating map[string]struct{}
+}
+
+func newCachingHTTPClient(inner httpClient, size int, clk clock.Clock) (*cachingHTTPClient, error) {
+	cache, err := lru.New[string, *cachedResponse](size)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingHTTPClient{
+		inner:        inner,
+		clock:        clk,
+		cache:        cache,
+		revalidating: make(map[string]struct{}),
+	}, nil
+}
+
+type cachedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	stored     time.Time
+	cacheControl
+}
+
+// response returns a new response to req with the cached data.
+func (e *cachedResponse) response(req *http.Request, age time.Duration) *http.Response {
+	header := e.header.Clone()
+	header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.statusCode, http.StatusText(e.statusCode)),
+		StatusCode:    e.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+func cacheKey(req *http.Request) string {
+	return req.URL.String() + " " + req.Header.Get("Accept")
+}
+
+func (c *cachingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return c.inner.Do(req)
+	}
+
+	key := cacheKey(req)
+	e, ok := c.cache.Get(key)
+	if !ok {
+		return c.fetch(key, req)
+	}
+
+	age := c.clock.Since(e.stored)
+	if age < e.maxAge {
+		return e.response(req, age), nil
+	}
+	if age < e.maxAge+e.staleWhileRevalidate {
+		c.revalidate(key, req)
+		return e.response(req, age), nil
+	}
+
+	resp, err := c.fetch(key, req)
+	if (err != nil || resp.StatusCode >= http.StatusInternalServerError) && age < e.maxAge+e.staleIfError {
+		if err == nil {
+			resp.Body.Close()
+		}
+		logger.Debugw("serving stale response after error", "url", req.URL, "error", err)
+		return e.response(req, age), nil
+	}
+	return resp, err
+}
+
+// revalidate fetches a fresh response to req in the background, unless one is
+// already being fetched.
+func (c *cachingHTTPClient) revalidate(key string, req *http.Request) {
+	c.mu.Lock()
+	if _, ok := c.revalidating[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = struct{}{}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), revalidateTimeout)
+	req = req.Clone(ctx)
+	go func() {
+		defer func() {
+			cancel()
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		resp, err := c.fetch(key, req)
+		if err != nil {
+			logger.Debugw("could not revalidate cached response", "url", req.URL, "error", err)
+			return
+		}
+		// Reading the response caches it.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// fetch sends req, and caches the response if it can be cached. The response
+// of a streaming request is cached once it is read entirely.
+func (c *cachingHTTPClient) fetch(key string, req *http.Request) (*http.Response, error) {
+	resp, err := c.inner.Do(req)
+	if err != nil || (resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound) {
+		return resp, err
+	}
+
+	cc, ok := parseCacheControl(resp.Header.Get("Cache-Control"))
+	if !ok {
+		c.cache.Remove(key)
+		return resp, nil
+	}
+
+	e := &cachedResponse{
+		statusCode:   resp.StatusCode,
+		header:       resp.Header.Clone(),
+		stored:       c.clock.Now(),
+		cacheControl: cc,
+	}
+	store := func(body []byte) {
+		e.body = body
+		c.cache.Add(key, e)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == mediaTypeNDJSON {
+		resp.Body = &cachingBody{ReadCloser: resp.Body, store: store}
+		return resp, nil
+	}
+
+	// Other responses are small and read at once anyway.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBodySize+1))
+	rest := resp.Body
+	if err != nil {
+		rest.Close()
+		return nil, err
+	}
+	if len(body) <= maxCachedBodySize {
+		store(body)
+		rest.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	} else {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), rest), rest}
+	}
+	return resp, nil
+}
+
+// cachingBody stores the body of a response once it is read entirely.
+type cachingBody struct {
+	io.ReadCloser
+	store func([]byte)
+
+	buf  bytes.Buffer
+	done bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done {
+		return n, err
+	}
+	if b.buf.Len()+n > maxCachedBodySize {
+		b.done = true
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	switch {
+	case err == io.EOF:
+		b.done = true
+		b.store(b.buf.Bytes())
+	case err != nil:
+		b.done = true
+	}
+	return n, err
+}
+
+// cacheControl holds the directives of a Cache-Control header relevant to a
+// client-side cache.
+type cacheControl struct {
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+// parseCacheControl parses the Cache-Control header of a response, and
+// returns whether the response can be cached.
+func parseCacheControl(header string) (cacheControl, bool) {
+	var cc cacheControl
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		var d *time.Duration
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return cacheControl{}, false
+		case "max-age":
+			d = &cc.maxAge
+		case "stale-while-revalidate":
+			d = &cc.staleWhileRevalidate
+		case "stale-if-error":
+			d = &cc.staleIfError
+		default:
+			continue
+		}
+		seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		if err != nil || seconds < 0 {
+			continue
+		}
+		*d = time.Duration(seconds) * time.Second
+	}
+	return cc, cc.maxAge > 0 || cc.staleWhileRevalidate > 0 || cc.staleIfError > 0
+}
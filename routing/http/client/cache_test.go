@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-clock"
+	"github.com/ipfs/boxo/routing/http/types"
+	"github.com/ipfs/boxo/routing/http/types/iter"
+	"github.com/stretchr/testify/require"
+)
+
+type cacheTestServer struct {
+	requests     atomic.Int32
+	fail         atomic.Bool
+	cacheControl atomic.Value
+}
+
+func newCacheTestClient(t *testing.T, contentType string) (*Client, *cacheTestServer, *clock.Mock) {
+	peerID, _, _ := makeProviderAndIdentity()
+	body := fmt.Sprintf(`{"Schema":"peer","ID":%q,"Protocols":["transport-bitswap"]}`, peerID)
+	if contentType == mediaTypeJSON {
+		body = `{"Providers":[` + body + `]}`
+	}
+
+	s := &cacheTestServer{}
+	s.cacheControl.Store("max-age=10, stale-while-revalidate=100, stale-if-error=1000")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", s.cacheControl.Load().(string))
+		fmt.Fprintln(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := New(server.URL, WithCache(16))
+	require.NoError(t, err)
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	c.httpClient.(*cachingHTTPClient).clock = clk
+	return c, s, clk
+}
+
+func requireProviders(t *testing.T, c *Client) {
+	t.Helper()
+	it, err := c.FindProviders(context.Background(), makeCID())
+	require.NoError(t, err)
+	results := iter.ReadAll[iter.Result[types.Record]](it)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+}
+
+func TestCache(t *testing.T) {
+	for _, contentType := range []string{mediaTypeJSON, mediaTypeNDJSON} {
+		t.Run(contentType, func(t *testing.T) {
+			c, s, clk := newCacheTestClient(t, contentType)
+			key := makeCID()
+			find := func() {
+				t.Helper()
+				it, err := c.FindProviders(context.Background(), key)
+				require.NoError(t, err)
+				results := iter.ReadAll[iter.Result[types.Record]](it)
+				require.Len(t, results, 1)
+				require.NoError(t, results[0].Err)
+			}
+
+			find()
+			find()
+			require.Equal(t, int32(1), s.requests.Load())
+
+			// Stale responses are served while being revalidated.
+			clk.Add(15 * time.Second)
+			find()
+			require.Eventually(t, func() bool { return s.requests.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+			require.Eventually(t, func() bool {
+				find()
+				return s.requests.Load() == 2
+			}, 5*time.Second, 10*time.Millisecond)
+
+			// And when the server fails, within stale-if-error.
+			s.fail.Store(true)
+			clk.Add(200 * time.Second)
+			find()
+			require.Equal(t, int32(3), s.requests.Load())
+
+			clk.Add(time.Hour)
+			_, err := c.FindProviders(context.Background(), key)
+			require.Error(t, err)
+
+			// Other lookups are not cached.
+			s.fail.Store(false)
+			requireProviders(t, c)
+			require.Equal(t, int32(5), s.requests.Load())
+		})
+	}
+}
+
+func TestCacheNoStore(t *testing.T) {
+	c, s, _ := newCacheTestClient(t, mediaTypeJSON)
+	s.cacheControl.Store("no-store")
+
+	key := makeCID()
+	for i := 0; i < 2; i++ {
+		it, err := c.FindProviders(context.Background(), key)
+		require.NoError(t, err)
+		require.Len(t, iter.ReadAll[iter.Result[types.Record]](it), 1)
+	}
+	require.Equal(t, int32(2), s.requests.Load())
+}
+
+func TestParseCacheControl(t *testing.T) {
+	cc, ok := parseCacheControl("public, max-age=15, stale-while-revalidate=172800, stale-if-error=172800")
+	require.True(t, ok)
+	require.Equal(t, cacheControl{
+		maxAge:               15 * time.Second,
+		staleWhileRevalidate: 48 * time.Hour,
+		staleIfError:         48 * time.Hour,
+	}, cc)
+
+	for _, header := range []string{"", "public", "max-age=0", "max-age=60, no-cache", "no-store"} {
+		_, ok := parseCacheControl(header)
+		require.False(t, ok, header)
+	}
+}
@@ -62,6 +62,9 @@ type Client struct {
 	disableLocalFiltering bool
 	protocolFilter        []string
 	addrFilter            []string
+
+	// cacheSize is the number of responses cached, see [WithCache].
+	cacheSize int
 }
 
 // defaultUserAgent is used as a fallback to inform HTTP server which library
@@ -195,6 +198,14 @@ func New(baseURL string, opts ...Option) (*Client, error) {
 		return nil, errors.New("identity does not match provider")
 	}
 
+	if client.cacheSize > 0 {
+		cachingClient, err := newCachingHTTPClient(client.httpClient, client.cacheSize, client.clock)
+		if err != nil {
+			return nil, err
+		}
+		client.httpClient = cachingClient
+	}
+
 	return client, nil
 }
 
@@ -465,18 +465,19 @@ func (npqm *newProvideQueryMessage) debugMessage() {
 func (npqm *newProvideQueryMessage) handle(pqm *ProviderQueryManager) {
 	requestStatus, ok := pqm.inProgressRequestStatuses[npqm.k]
 	if !ok {
-		ctx, cancelFn := context.WithCancel(context.Background())
+		ctx, cancelFn := context.WithCancel(context.WithoutCancel(npqm.ctx))
 		span := trace.SpanFromContext(npqm.ctx)
 		span.AddEvent("NewQuery", trace.WithAttributes(attribute.Stringer("cid", npqm.k)))
 		ctx = trace.ContextWithSpan(ctx, span)
 
-		// Use context derived from background here, and not the context from the
+		// Use a context that is not canceled with the context from the
 		// request (npqm.ctx), because this inProgressRequestStatus applies to
 		// all in-progress requests for the CID (npqm.k).
 		//
-		// For tracing, this means that only the span from the first
-		// request-in-progress for a CID is used, even if there are multiple
-		// requests for the same CID.
+		// For tracing, and for the other values of the context, such as the
+		// session a dial is made for, this means that only the context from
+		// the first request-in-progress for a CID is used, even if there are
+		// multiple requests for the same CID.
 		requestStatus = &inProgressRequestStatus{
 			listeners: make(map[chan peer.AddrInfo]struct{}),
 			ctx:       ctx,
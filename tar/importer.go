@@ -0,0 +1,329 @@
+package tar
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	h "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/trickle"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("tar")
+
+// Importer builds a UnixFS DAG from a tar archive, without unpacking it to
+// disk. The archive can be gzip-compressed.
+//
+// The DAG is a directory holding the top-level entries of the archive, with
+// its files, directories and symlinks at the same paths. Hard links are
+// imported as copies of the files they point to, which share their blocks.
+// Other entries, such as devices, are skipped. Directories that are implied by
+// the paths of their entries, without an entry of their own, are created. When
+// an archive holds several files or symlinks at the same path, the last one is
+// kept, and the entries of a directory listed several times are merged. A file
+// or symlink at the path of a directory, or the other way round, is an error.
+//
+// If PreserveMode or PreserveMtime are set, the mode or the modification time
+// of the entries are stored in the DAG, except for sharded directories (see
+// [uio.WithHAMTShardingSize]) and symlinks, which cannot store them.
+type Importer struct {
+	// DAGService to write blocks to (required).
+	DAGService ipld.DAGService
+
+	// Chunker is the chunker specification of the files, as understood by
+	// [chunker.FromString]. Defaults to the default size splitter.
+	Chunker string
+
+	// RawLeaves stores the data of the files in raw leaves.
+	RawLeaves bool
+
+	// Trickle uses the trickle layout for files, instead of the balanced
+	// layout.
+	Trickle bool
+
+	// CidBuilder of the nodes, e.g. from merkledag.PrefixForCidVersion.
+	CidBuilder cid.Builder
+
+	// PreserveMode stores the mode of the entries.
+	PreserveMode bool
+
+	// PreserveMtime stores the modification time of the entries.
+	PreserveMtime bool
+
+	// DirectoryOptions configure the directories, e.g. their HAMT sharding.
+	DirectoryOptions []uio.DirectoryOption
+
+	// Parallelism is the number of leaves built concurrently for each file
+	// (see [h.DagBuilderParams]).
+	Parallelism int
+}
+
+// importEntry is a file, a symlink, or a directory of the archive.
+type importEntry struct {
+	node ipld.Node
+
+	// Set for directories.
+	children map[string]*importEntry
+	mode     os.FileMode
+	mtime    time.Time
+}
+
+func newImportDir() *importEntry {
+	return &importEntry{children: make(map[string]*importEntry)}
+}
+
+// Import reads the tar archive from r, adds its DAG to the DAGService and
+// returns its root directory.
+func (ti *Importer) Import(ctx context.Context, r io.Reader) (ipld.Node, error) {
+	if ti.DAGService == nil {
+		return nil, errors.New("tar: no DAGService to import to")
+	}
+
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gzr.Close()
+		r = gzr
+	} else {
+		r = br
+	}
+
+	root := newImportDir()
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := cleanImportPath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			dir := root
+			if name != "" {
+				dir, err = root.mkdirAll(name)
+				if err != nil {
+					return nil, err
+				}
+			}
+			dir.mode, dir.mtime = ti.stat(header)
+		case tar.TypeReg:
+			nd, err := ti.importFile(tr, header)
+			if err != nil {
+				return nil, fmt.Errorf("tar: could not import %s: %w", header.Name, err)
+			}
+			if err := root.set(name, &importEntry{node: nd}); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			nd, err := ti.importSymlink(ctx, header.Linkname)
+			if err != nil {
+				return nil, fmt.Errorf("tar: could not import %s: %w", header.Name, err)
+			}
+			if err := root.set(name, &importEntry{node: nd}); err != nil {
+				return nil, err
+			}
+		case tar.TypeLink:
+			target, err := cleanImportPath(header.Linkname)
+			if err != nil {
+				return nil, err
+			}
+			e, err := root.get(target)
+			if err != nil || e.node == nil {
+				return nil, fmt.Errorf("tar: hard link %s points to %s, which is not a file in the archive", header.Name, header.Linkname)
+			}
+			if err := root.set(name, &importEntry{node: e.node}); err != nil {
+				return nil, err
+			}
+		default:
+			log.Debugf("skipping tar entry %s of type %q", header.Name, header.Typeflag)
+		}
+	}
+
+	return ti.buildDir(ctx, root)
+}
+
+// cleanImportPath returns the slash-separated path of an entry relative to the
+// root of the archive, which is empty for the root itself.
+func cleanImportPath(name string) (string, error) {
+	for _, c := range strings.Split(name, "/") {
+		if c == ".." {
+			return "", fmt.Errorf("tar: invalid path %q", name)
+		}
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return name, nil
+}
+
+func (ti *Importer) stat(header *tar.Header) (mode os.FileMode, mtime time.Time) {
+	if ti.PreserveMode {
+		mode = header.FileInfo().Mode()
+	}
+	if ti.PreserveMtime {
+		mtime = header.ModTime
+	}
+	return mode, mtime
+}
+
+func (ti *Importer) importFile(r io.Reader, header *tar.Header) (ipld.Node, error) {
+	spl, err := chunker.FromString(r, ti.Chunker)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, mtime := ti.stat(header)
+	db, err := (&h.DagBuilderParams{
+		Dagserv:     ti.DAGService,
+		Maxlinks:    h.DefaultLinksPerBlock,
+		RawLeaves:   ti.RawLeaves,
+		CidBuilder:  ti.CidBuilder,
+		FileMode:    mode,
+		FileModTime: mtime,
+		Parallelism: ti.Parallelism,
+	}).New(spl)
+	if err != nil {
+		return nil, err
+	}
+
+	if ti.Trickle {
+		return trickle.Layout(db)
+	}
+	return balanced.Layout(db)
+}
+
+func (ti *Importer) importSymlink(ctx context.Context, target string) (ipld.Node, error) {
+	data, err := ft.SymlinkData(target)
+	if err != nil {
+		return nil, err
+	}
+	nd := dag.NodeWithData(data)
+	if ti.CidBuilder != nil {
+		if err := nd.SetCidBuilder(ti.CidBuilder); err != nil {
+			return nil, err
+		}
+	}
+	return nd, ti.DAGService.Add(ctx, nd)
+}
+
+// buildDir adds the directory e, and its child directories, to the
+// DAGService.
+func (ti *Importer) buildDir(ctx context.Context, e *importEntry) (ipld.Node, error) {
+	nd := ft.EmptyDirNodeWithStat(e.mode, e.mtime)
+	if ti.CidBuilder != nil {
+		if err := nd.SetCidBuilder(ti.CidBuilder); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := uio.NewDirectoryFromNode(ti.DAGService, nd, ti.DirectoryOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(e.children))
+	for name := range e.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := e.children[name]
+		childNode := child.node
+		if child.children != nil {
+			childNode, err = ti.buildDir(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := dir.AddChild(ctx, name, childNode); err != nil {
+			return nil, err
+		}
+	}
+
+	dirNode, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	return dirNode, ti.DAGService.Add(ctx, dirNode)
+}
+
+// mkdirAll returns the directory at the slash-separated path p, creating it
+// and its parents if needed.
+func (e *importEntry) mkdirAll(p string) (*importEntry, error) {
+	dir := e
+	for _, name := range strings.Split(p, "/") {
+		child, ok := dir.children[name]
+		if !ok {
+			child = newImportDir()
+			dir.children[name] = child
+		} else if child.children == nil {
+			return nil, fmt.Errorf("tar: %s is not a directory", p)
+		}
+		dir = child
+	}
+	return dir, nil
+}
+
+// get returns the entry at the slash-separated path p.
+func (e *importEntry) get(p string) (*importEntry, error) {
+	dir := e
+	for _, name := range strings.Split(p, "/") {
+		child, ok := dir.children[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		dir = child
+	}
+	return dir, nil
+}
+
+// set stores the file or symlink entry at the slash-separated path p.
+func (e *importEntry) set(p string, entry *importEntry) error {
+	if p == "" {
+		return errors.New("tar: the root of the archive must be a directory")
+	}
+	dir := e
+	if parent, name := path.Split(p); parent != "" {
+		var err error
+		dir, err = e.mkdirAll(strings.TrimSuffix(parent, "/"))
+		if err != nil {
+			return err
+		}
+		p = name
+	}
+	if child, ok := dir.children[p]; ok && child.children != nil {
+		return fmt.Errorf("tar: %s is a directory", p)
+	}
+	dir.children[p] = entry
+	return nil
+}
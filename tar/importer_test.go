@@ -0,0 +1,156 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTarEntry struct {
+	header tar.Header
+	data   string
+}
+
+func makeTar(t *testing.T, entries []testTarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.header
+		hdr.Size = int64(len(e.data))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(e.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestImport(t *testing.T) {
+	mtime := time.Unix(1638111600, 0)
+	archive := makeTar(t, []testTarEntry{
+		{header: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}},
+		{header: tar.Header{Name: "./dir/", Typeflag: tar.TypeDir, Mode: 0o700, ModTime: mtime}},
+		{header: tar.Header{Name: "./dir/file", Typeflag: tar.TypeReg, Mode: 0o640, ModTime: mtime}, data: "hello"},
+		{header: tar.Header{Name: "implied/nested/file", Typeflag: tar.TypeReg, Mode: 0o644}, data: "nested"},
+		{header: tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file"}},
+		{header: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "./dir/file"}},
+		{header: tar.Header{Name: "dev", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}},
+		{header: tar.Header{Name: "dup", Typeflag: tar.TypeReg, Mode: 0o644}, data: "first"},
+		{header: tar.Header{Name: "dup", Typeflag: tar.TypeReg, Mode: 0o644}, data: "second"},
+	})
+
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	ti := &Importer{DAGService: ds, PreserveMode: true, PreserveMtime: true}
+	root, err := ti.Import(ctx, bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	nd, err := unixfile.NewUnixfsFile(ctx, ds, root)
+	require.NoError(t, err)
+	got := map[string]string{}
+	err = files.Walk(nd, func(fpath string, nd files.Node) error {
+		switch nd := nd.(type) {
+		case *files.Symlink:
+			got[fpath] = "-> " + nd.Target
+		case files.File:
+			data, err := io.ReadAll(nd)
+			if err != nil {
+				return err
+			}
+			got[fpath] = string(data)
+		case files.Directory:
+			got[fpath] = "/"
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"":                    "/",
+		"dir":                 "/",
+		"dir/file":            "hello",
+		"dir/link":            "-> file",
+		"hard":                "hello",
+		"implied":             "/",
+		"implied/nested":      "/",
+		"implied/nested/file": "nested",
+		"dup":                 "second",
+	}, got)
+
+	dir, err := uio.NewDirectoryFromNode(ds, root)
+	require.NoError(t, err)
+	dirNode, err := dir.Find(ctx, "dir")
+	require.NoError(t, err)
+	fsn, err := ft.ExtractFSNode(dirNode)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), fsn.Mode()&os.ModePerm)
+	assert.True(t, mtime.Equal(fsn.ModTime()))
+
+	// The same archive, compressed, gives the same DAG.
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err = zw.Write(archive)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	gzRoot, err := ti.Import(ctx, &gz)
+	require.NoError(t, err)
+	assert.Equal(t, root.Cid(), gzRoot.Cid())
+}
+
+func TestImportSharded(t *testing.T) {
+	var entries []testTarEntry
+	for _, name := range []string{"a", "b", "c", "d"} {
+		entries = append(entries, testTarEntry{header: tar.Header{Name: "big/" + name, Typeflag: tar.TypeReg}, data: name})
+	}
+
+	ds := mdtest.Mock()
+	ti := &Importer{
+		DAGService:       ds,
+		RawLeaves:        true,
+		DirectoryOptions: []uio.DirectoryOption{uio.WithHAMTShardingSize(1), uio.WithHAMTShardWidth(1024)},
+	}
+	root, err := ti.Import(context.Background(), bytes.NewReader(makeTar(t, entries)))
+	require.NoError(t, err)
+
+	fsn, err := ft.ExtractFSNode(root)
+	require.NoError(t, err)
+	assert.Equal(t, ft.THAMTShard, fsn.Type())
+	assert.Equal(t, uint64(1024), fsn.Fanout())
+}
+
+func TestImportInvalid(t *testing.T) {
+	ds := mdtest.Mock()
+	for name, entries := range map[string][]testTarEntry{
+		"parent path": {
+			{header: tar.Header{Name: "../escape", Typeflag: tar.TypeReg}, data: "x"},
+		},
+		"file as directory": {
+			{header: tar.Header{Name: "file", Typeflag: tar.TypeReg}, data: "x"},
+			{header: tar.Header{Name: "file/child", Typeflag: tar.TypeReg}, data: "x"},
+		},
+		"directory as file": {
+			{header: tar.Header{Name: "dir", Typeflag: tar.TypeDir}},
+			{header: tar.Header{Name: "dir", Typeflag: tar.TypeReg}, data: "x"},
+		},
+		"missing hard link target": {
+			{header: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "missing"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := (&Importer{DAGService: ds}).Import(context.Background(), bytes.NewReader(makeTar(t, entries)))
+			assert.Error(t, err)
+		})
+	}
+}
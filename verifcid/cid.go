@@ -19,8 +19,13 @@ const (
 	maximumHashLength = 128
 )
 
-// ValidateCid validates multihash allowance behind given CID.
+// ValidateCid validates multihash allowance behind given CID. If allowlist is
+// a [*Policy], the digest length rules of the policy are used.
 func ValidateCid(allowlist Allowlist, c cid.Cid) error {
+	if p, ok := allowlist.(*Policy); ok {
+		return p.Validate(c)
+	}
+
 	pref := c.Prefix()
 	if !allowlist.IsAllowed(pref.MhType) {
 		return ErrPossiblyInsecureHashFunction
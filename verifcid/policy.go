@@ -0,0 +1,209 @@
+package verifcid
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+	metrics "github.com/ipfs/go-metrics-interface"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// RejectReason is the reason why a [Policy] rejected a CID.
+type RejectReason int
+
+const (
+	// RejectHashFunction is used for CIDs whose hash function is not allowed.
+	RejectHashFunction RejectReason = iota
+	// RejectDigestTooShort is used for CIDs whose digest is shorter than allowed.
+	RejectDigestTooShort
+	// RejectDigestTooLong is used for CIDs whose digest is longer than allowed.
+	RejectDigestTooLong
+
+	numRejectReasons
+)
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectHashFunction:
+		return "hash_function"
+	case RejectDigestTooShort:
+		return "digest_too_short"
+	case RejectDigestTooLong:
+		return "digest_too_long"
+	default:
+		return "unknown"
+	}
+}
+
+// PolicyRules are the rules enforced by a [Policy].
+type PolicyRules struct {
+	// Allowlist is the list of allowed hash functions. Defaults to
+	// [DefaultAllowlist] if nil.
+	Allowlist Allowlist
+
+	// MinDigestLength is the minimum length of a digest, in bytes. Defaults
+	// to 20 if zero.
+	MinDigestLength int
+
+	// MaxDigestLength is the maximum length of a digest, in bytes. Defaults
+	// to 128 if zero. It does not apply to identity CIDs.
+	MaxDigestLength int
+
+	// MaxIdentityDigestLength is the maximum length of the data inlined in
+	// identity CIDs, in bytes. Identity CIDs are not limited if zero.
+	MaxIdentityDigestLength int
+
+	// MinDigestLengthByCodec overrides MinDigestLength for CIDs of the given
+	// codecs.
+	MinDigestLengthByCodec map[uint64]int
+}
+
+// Policy is an [Allowlist] that also enforces digest lengths, and whose
+// [PolicyRules] can be replaced at runtime with [Policy.SetRules], e.g. to
+// temporarily block identity CIDs or long digests without a restart.
+//
+// [ValidateCid] uses the rules of a Policy when given one, so a Policy can be
+// passed wherever an [Allowlist] is expected, such as blockservice.WithAllowlist.
+// Rejections are counted by [RejectReason].
+type Policy struct {
+	rules      atomic.Pointer[PolicyRules]
+	rejections [numRejectReasons]atomic.Uint64
+	counters   [numRejectReasons]metrics.Counter
+}
+
+var _ Allowlist = (*Policy)(nil)
+
+type policyOptions struct {
+	metricsCtx context.Context
+}
+
+// PolicyOption is an option for [NewPolicy].
+type PolicyOption func(*policyOptions)
+
+// WithMetricsContext registers the rejection counters of the [Policy] with
+// go-metrics-interface, under the scope of the given context.
+func WithMetricsContext(ctx context.Context) PolicyOption {
+	return func(opts *policyOptions) {
+		opts.metricsCtx = ctx
+	}
+}
+
+// NewPolicy returns a new [Policy] enforcing the given rules.
+func NewPolicy(rules PolicyRules, opts ...PolicyOption) *Policy {
+	var options policyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	p := &Policy{}
+	if options.metricsCtx != nil {
+		for r := RejectReason(0); r < numRejectReasons; r++ {
+			p.counters[r] = metrics.NewCtx(options.metricsCtx, "verifcid.rejected_"+r.String()+"_total",
+				"Number of CIDs rejected by the verifcid policy ("+r.String()+")").Counter()
+		}
+	}
+	p.SetRules(rules)
+	return p
+}
+
+// SetRules atomically replaces the rules enforced by the policy.
+func (p *Policy) SetRules(rules PolicyRules) {
+	if rules.Allowlist == nil {
+		rules.Allowlist = DefaultAllowlist
+	}
+	if rules.MinDigestLength == 0 {
+		rules.MinDigestLength = minimumHashLength
+	}
+	if rules.MaxDigestLength == 0 {
+		rules.MaxDigestLength = maximumHashLength
+	}
+	byCodec := make(map[uint64]int, len(rules.MinDigestLengthByCodec))
+	for codec, l := range rules.MinDigestLengthByCodec {
+		byCodec[codec] = l
+	}
+	rules.MinDigestLengthByCodec = byCodec
+	p.rules.Store(&rules)
+}
+
+// Rules returns the rules currently enforced by the policy, with defaults
+// filled in.
+func (p *Policy) Rules() PolicyRules {
+	return *p.rules.Load()
+}
+
+// IsAllowed implements [Allowlist].
+func (p *Policy) IsAllowed(code uint64) bool {
+	return p.rules.Load().Allowlist.IsAllowed(code)
+}
+
+// Validate checks the given CID against the rules of the policy.
+func (p *Policy) Validate(c cid.Cid) error {
+	rules := p.rules.Load()
+	pref := c.Prefix()
+
+	if !rules.Allowlist.IsAllowed(pref.MhType) {
+		p.reject(RejectHashFunction)
+		return ErrPossiblyInsecureHashFunction
+	}
+
+	// The digest of identity CIDs is their data, which is only limited if
+	// the rules say so.
+	if pref.MhType == mh.IDENTITY {
+		if rules.MaxIdentityDigestLength > 0 && pref.MhLength > rules.MaxIdentityDigestLength {
+			p.reject(RejectDigestTooLong)
+			return &digestLengthError{ErrAboveMaximumHashLength, "most", rules.MaxIdentityDigestLength}
+		}
+		return nil
+	}
+
+	minLength := rules.MinDigestLength
+	if l, ok := rules.MinDigestLengthByCodec[pref.Codec]; ok {
+		minLength = l
+	}
+	if pref.MhLength < minLength {
+		p.reject(RejectDigestTooShort)
+		return &digestLengthError{ErrBelowMinimumHashLength, "least", minLength}
+	}
+
+	if pref.MhLength > rules.MaxDigestLength {
+		p.reject(RejectDigestTooLong)
+		return &digestLengthError{ErrAboveMaximumHashLength, "most", rules.MaxDigestLength}
+	}
+
+	return nil
+}
+
+// digestLengthError is returned by [Policy.Validate] for digests outside the
+// configured limits. It matches [ErrBelowMinimumHashLength] or
+// [ErrAboveMaximumHashLength] with errors.Is.
+type digestLengthError struct {
+	kind  error
+	bound string
+	limit int
+}
+
+func (e *digestLengthError) Error() string {
+	return fmt.Sprintf("hashes must be at %s %d bytes long", e.bound, e.limit)
+}
+
+func (e *digestLengthError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Rejections returns the number of CIDs rejected by the policy for the given
+// reason.
+func (p *Policy) Rejections(reason RejectReason) uint64 {
+	if reason < 0 || reason >= numRejectReasons {
+		return 0
+	}
+	return p.rejections[reason].Load()
+}
+
+func (p *Policy) reject(reason RejectReason) {
+	p.rejections[reason].Add(1)
+	if c := p.counters[reason]; c != nil {
+		c.Inc()
+	}
+}
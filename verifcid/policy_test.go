@@ -0,0 +1,122 @@
+package verifcid
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestPolicy(t *testing.T) {
+	mhcid := func(codec, code uint64, length int) cid.Cid {
+		mhash, err := mh.Sum([]byte("hello"), code, length)
+		if err != nil {
+			t.Fatalf("%v: code: %x length: %d", err, code, length)
+		}
+		return cid.NewCidV1(codec, mhash)
+	}
+
+	identity := mhcid(cid.Raw, mh.IDENTITY, -1)
+	sha256 := mhcid(cid.Raw, mh.SHA2_256, 32)
+	shortSha256 := mhcid(cid.Raw, mh.SHA2_256, 16)
+	longBlake3 := mhcid(cid.Raw, mh.BLAKE3, 100)
+
+	p := NewPolicy(PolicyRules{})
+	for _, c := range []cid.Cid{identity, sha256, longBlake3} {
+		if err := ValidateCid(p, c); err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+	}
+	if err := ValidateCid(p, shortSha256); !errors.Is(err, ErrBelowMinimumHashLength) {
+		t.Fatalf("expected ErrBelowMinimumHashLength, got %v", err)
+	}
+
+	// Identity CIDs are not limited by the maximum digest length, only by
+	// the opt-in maximum identity digest length.
+	largeIdentity, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.IDENTITY, MhLength: -1}.Sum(make([]byte, maximumHashLength+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateCid(p, largeIdentity); err != nil {
+		t.Fatal(err)
+	}
+	p.SetRules(PolicyRules{MaxIdentityDigestLength: maximumHashLength})
+	err = ValidateCid(p, largeIdentity)
+	if !errors.Is(err, ErrAboveMaximumHashLength) {
+		t.Fatalf("expected ErrAboveMaximumHashLength, got %v", err)
+	}
+	if err := ValidateCid(p, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	// Block identity CIDs and long digests, and accept short digests for raw
+	// blocks.
+	p.SetRules(PolicyRules{
+		Allowlist:              NewOverridingAllowlist(DefaultAllowlist, map[uint64]bool{mh.IDENTITY: false}),
+		MaxDigestLength:        64,
+		MinDigestLengthByCodec: map[uint64]int{cid.Raw: 16},
+	})
+	if p.IsAllowed(mh.IDENTITY) {
+		t.Fatal("identity should not be allowed")
+	}
+	if err := ValidateCid(p, identity); err != ErrPossiblyInsecureHashFunction {
+		t.Fatalf("expected ErrPossiblyInsecureHashFunction, got %v", err)
+	}
+	err = ValidateCid(p, longBlake3)
+	if !errors.Is(err, ErrAboveMaximumHashLength) {
+		t.Fatalf("expected ErrAboveMaximumHashLength, got %v", err)
+	}
+	if err.Error() != "hashes must be at most 64 bytes long" {
+		t.Fatalf("expected the configured limit in the error, got %q", err)
+	}
+	if err := ValidateCid(p, shortSha256); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateCid(p, mhcid(cid.DagCBOR, mh.SHA2_256, 16)); !errors.Is(err, ErrBelowMinimumHashLength) {
+		t.Fatalf("expected ErrBelowMinimumHashLength, got %v", err)
+	}
+
+	for reason, expected := range map[RejectReason]uint64{
+		RejectHashFunction:   1,
+		RejectDigestTooShort: 2,
+		RejectDigestTooLong:  2,
+	} {
+		if got := p.Rejections(reason); got != expected {
+			t.Errorf("%s: expected %d rejections, got %d", reason, expected, got)
+		}
+	}
+
+	rules := p.Rules()
+	if rules.MinDigestLength != minimumHashLength || rules.MaxDigestLength != 64 {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
+
+func TestPolicyConcurrentUpdates(t *testing.T) {
+	p := NewPolicy(PolicyRules{})
+	mhash, err := mh.Sum([]byte("hello"), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cid.NewCidV1(cid.Raw, mhash)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = p.Validate(c)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.SetRules(PolicyRules{MaxDigestLength: 32 + j})
+			}
+		}()
+	}
+	wg.Wait()
+}